@@ -0,0 +1,137 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package banner
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"us.figge.auto-ssh/internal/cmd"
+	"us.figge.auto-ssh/internal/core/banner"
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/flag"
+	"us.figge.auto-ssh/internal/core/utils"
+	"us.figge.auto-ssh/internal/resources/engine/host"
+)
+
+var bannerCmd = &cobra.Command{
+	Use:   "banner",
+	Short: "Displays and acknowledges the banners hosts show before login",
+	Run: func(cmd *cobra.Command, args []string) {
+		_ = cmd.Help()
+	},
+}
+
+var bannerShowCmd = &cobra.Command{
+	Use:   "show <host>",
+	Short: "Displays the banner a host shows before login",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		exitOnError(show(cmd, args[0]))
+	},
+}
+
+var bannerAckCmd = &cobra.Command{
+	Use:   "ack <host>",
+	Short: "Displays the banner of a host and records its acknowledgement after confirmation",
+	Long: `Displays the banner a host shows before login and, once confirmed, records in the
+host's bannerAcks file that it was read, by whom and when. Hosts with a bannerAcks
+file are not logged in to until their current banner has been acknowledged`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		exitOnError(ack(cmd, args[0]))
+	},
+}
+
+func init() {
+	cmd.RootCmd.AddCommand(bannerCmd)
+	bannerCmd.AddCommand(bannerShowCmd)
+	bannerCmd.AddCommand(bannerAckCmd)
+	flag.AddFlags(bannerShowCmd, flag.Core)
+	flag.AddFlags(bannerAckCmd, flag.Core, flag.Force)
+}
+
+func show(cmd *cobra.Command, ref string) error {
+	entry, text, err := fetch(cmd, ref)
+	if err != nil {
+		return err
+	}
+	hash := banner.Hash(text)
+	printBanner(entry, text, hash)
+	if entry.BannerAcks() != "" {
+		acknowledged, err := banner.Acknowledged(entry.BannerAcks(), entry.Name(), hash)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Acknowledged: %t\n", acknowledged)
+	}
+	return nil
+}
+
+func ack(cmd *cobra.Command, ref string) error {
+	entry, text, err := fetch(cmd, ref)
+	if err != nil {
+		return err
+	}
+	if entry.BannerAcks() == "" {
+		return fmt.Errorf("host (%s) has no bannerAcks file", entry.Name())
+	}
+	hash := banner.Hash(text)
+	printBanner(entry, text, hash)
+	acknowledged, err := banner.Acknowledged(entry.BannerAcks(), entry.Name(), hash)
+	if err != nil {
+		return err
+	}
+	if acknowledged {
+		fmt.Printf("The banner of %s has already been acknowledged\n", entry.Name())
+		return nil
+	}
+	answer, ok := utils.Ask("Acknowledge having read this banner (yes/no)? ", false, true)
+	if !ok || !strings.EqualFold(answer, "yes") {
+		fmt.Printf("Banner not acknowledged\n")
+		return nil
+	}
+	username := "unknown"
+	if usr, err := user.Current(); err == nil {
+		username = usr.Username
+	}
+	if err = banner.Acknowledge(entry.BannerAcks(), entry.Name(), hash, username); err != nil {
+		return err
+	}
+	fmt.Printf("Banner %s of %s acknowledged by %s\n", hash, entry.Name(), username)
+	return nil
+}
+
+// fetch connects to the host, by id or name, for its banner
+func fetch(cmd *cobra.Command, ref string) (*host.Entry, string, error) {
+	engine := host.NewEngine(cmd.Context(), config.C.Hosts)
+	entry, ok := engine.Lookup(ref)
+	if !ok {
+		return nil, "", fmt.Errorf("host (%s) undefined", ref)
+	}
+	text, err := entry.FetchBanner()
+	if err != nil {
+		return nil, "", err
+	}
+	if text == "" {
+		return nil, "", fmt.Errorf("host (%s) shows no banner", entry.Name())
+	}
+	return entry, text, nil
+}
+
+func printBanner(entry *host.Entry, text string, hash string) {
+	fmt.Printf("Banner of %s (%s) %s:\n\n", entry.Name(), entry.Remote().String(), hash)
+	fmt.Printf("%s\n\n", strings.TrimRight(text, "\r\n"))
+}
+
+func exitOnError(err error) {
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package cmd
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/log"
+)
+
+// runChild runs the command once every tunnel is ready, with the tunnel
+// entrances in its environment, and returns its exit code.  Signals are passed
+// on to the command, whose exit brings auto-ssh down
+func runChild(args []string) int {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+
+	log.Printf("  Info  - waiting for the tunnels before running %s\n", args[0])
+	ticker := time.NewTicker(readyPoll)
+	for !tunnelEngine.Ready() {
+		select {
+		case sig := <-sigChan:
+			ticker.Stop()
+			log.Printf("  Info  - received %v. Shutting down\n", sig)
+			return 128 + int(sig.(syscall.Signal))
+		case <-ticker.C:
+		}
+	}
+	ticker.Stop()
+
+	child := exec.Command(args[0], args[1:]...)
+	child.Stdin, child.Stdout, child.Stderr = os.Stdin, os.Stdout, os.Stderr
+	child.Env = append(os.Environ(), tunnelEnv()...)
+	if err := child.Start(); err != nil {
+		log.Printf("  Error - command (%s) cannot be run: %v\n", args[0], err)
+		return 127
+	}
+	done := make(chan error, 1)
+	go func() { done <- child.Wait() }()
+	for {
+		select {
+		case sig := <-sigChan:
+			_ = child.Process.Signal(sig)
+		case err := <-done:
+			var exitErr *exec.ExitError
+			if err == nil {
+				return 0
+			} else if errors.As(err, &exitErr) {
+				// Exiting as a shell would for a command killed by a signal
+				if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+					return 128 + int(status.Signal())
+				}
+				return exitErr.ExitCode()
+			}
+			log.Printf("  Error - command (%s) failed: %v\n", args[0], err)
+			return 1
+		}
+	}
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"us.figge.auto-ssh/internal/cmd"
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/flag"
+	"us.figge.auto-ssh/internal/core/log"
+	"us.figge.auto-ssh/internal/rest"
+	managerModels "us.figge.auto-ssh/internal/rest/models"
+)
+
+var disconnectCmd = &cobra.Command{
+	Use:   "disconnect <tunnel> <connection>...",
+	Short: "Closes client connections of a tunnel, by id or name, of a running auto-ssh",
+	Long: `Closes client connections of a tunnel, by id or name, of a running auto-ssh.
+Connections are given by the ids listed by status --connections`,
+	Args: cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := disconnect(cmd, args[0], args[1:]); err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	cmd.RootCmd.AddCommand(disconnectCmd)
+	flag.AddFlags(disconnectCmd, flag.Core, rest.Flags)
+}
+
+func disconnect(cmd *cobra.Command, ref string, connections []string) error {
+	client, err := rest.NewClient(config.C.Web)
+	if err != nil {
+		return err
+	}
+	ids, err := resolveTunnelIds(cmd.Context(), client, []string{ref})
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, connection := range connections {
+		if _, err = strconv.ParseInt(connection, 10, 64); err != nil {
+			fmt.Print(log.Format(fmt.Sprintf("  Error - connection (%s) is not a connection id\n", connection)))
+			failed++
+			continue
+		}
+		output := &managerModels.CloseConnectionOutput{}
+		path := fmt.Sprintf("/tunnels/%s/connections/%s", url.PathEscape(ids[0]), connection)
+		if err = client.Do(cmd.Context(), http.MethodDelete, path, nil, output); err != nil {
+			fmt.Printf("  Error - tunnel (%s) connection %s: %v\n", ref, connection, err)
+			failed++
+			continue
+		}
+		fmt.Printf("tunnel (%s) connection %d closed\n", ref, output.Connection)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d connections failed to close", failed, len(connections))
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/agent"
+	"us.figge.auto-ssh/internal/cmd"
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/flag"
+	"us.figge.auto-ssh/internal/core/log"
+	"us.figge.auto-ssh/internal/core/sshagent"
+	"us.figge.auto-ssh/internal/resources/engine/host"
+	"us.figge.auto-ssh/internal/resources/engine/tunnel"
+	engineModels "us.figge.auto-ssh/internal/resources/models"
+)
+
+// maxClockSkew is how far a host's clock may be from this one's before
+// certificates, one-time passwords and signed tokens start to be refused
+const maxClockSkew = 30 * time.Second
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Checks the environment the configuration runs in",
+	Long: `Checks what the configuration needs from the machine and network it runs on:
+the permissions of identity files, the ssh agent, the known_hosts files, that
+each host can be logged in to and has a clock in step with this one, and that
+each tunnel's entrance port is free. Each problem is printed with how to fix it,
+and the exit status is non-zero when any are found`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if problems := doctor(cmd); problems > 0 {
+			fmt.Printf("%d problem(s) found\n", problems)
+			os.Exit(1)
+		}
+		fmt.Printf("no problems found\n")
+	},
+}
+
+func init() {
+	cmd.RootCmd.AddCommand(doctorCmd)
+	flag.AddFlags(doctorCmd, flag.Core, flag.Bind, flag.PKCS11)
+}
+
+// checkup reports the outcome of each check, counting the problems found
+type checkup struct {
+	problems int
+}
+
+func (c *checkup) ok(format string, args ...any) {
+	fmt.Print(log.Format("  Info  - " + fmt.Sprintf(format, args...)))
+}
+
+func (c *checkup) warn(fix string, format string, args ...any) {
+	fmt.Print(log.Format("  Warn  - " + fmt.Sprintf(format, args...) + "\nfix: " + fix))
+}
+
+func (c *checkup) fail(fix string, format string, args ...any) {
+	c.problems++
+	fmt.Print(log.Format("  Error - " + fmt.Sprintf(format, args...) + "\nfix: " + fix))
+}
+
+func doctor(cmd *cobra.Command) int {
+	c := &checkup{}
+	hostEngine := host.NewEngine(cmd.Context(), config.C.Hosts)
+	c.identities()
+	c.agent()
+	c.knownHosts(hostEngine)
+	c.hosts(hostEngine)
+	c.ports(tunnel.NewEngine(cmd.Context(), hostEngine, config.C.Tunnels).Tunnels())
+	return c.problems
+}
+
+// identities checks identity files are private to their owner, as ssh refuses
+// keys others can read
+func (c *checkup) identities() {
+	for _, h := range config.C.Hosts {
+		identity := strings.TrimSpace(h.Identity)
+		if identity == "" || !config.IsFileIdentity(identity) {
+			continue
+		}
+		fi, err := os.Stat(identity)
+		switch {
+		case err != nil:
+			c.fail("correct the host's identity, or create the key with ssh-keygen -f "+identity,
+				"host (%s) identity file (%s) cannot be read: %v", h.Name, identity, errors.Unwrap(err))
+		case runtime.GOOS == "windows":
+			c.ok("host (%s) identity file (%s) found", h.Name, identity)
+		case fi.Mode().Perm()&0077 != 0:
+			c.fail("chmod 600 "+identity,
+				"host (%s) identity file (%s) can be read by others (%04o)", h.Name, identity, fi.Mode().Perm())
+		default:
+			c.ok("host (%s) identity file (%s) is private", h.Name, identity)
+		}
+	}
+}
+
+// agent checks the ssh agent can be reached, being a problem only when a host
+// forwards it
+func (c *checkup) agent() {
+	var needed []string
+	for _, h := range config.C.Hosts {
+		if h.Agent != nil && h.Agent.Forward && h.Agent.Source != config.AgentSourceIdentity {
+			needed = append(needed, h.Name)
+		}
+	}
+	conn, err := sshagent.Dial()
+	if err != nil {
+		if len(needed) > 0 {
+			c.fail("start ssh-agent, add the keys with ssh-add and export SSH_AUTH_SOCK",
+				"%v, needed by hosts (%s)", err, strings.Join(needed, ", "))
+		} else {
+			c.ok("%v, not needed by any host", err)
+		}
+		return
+	}
+	defer func() { _ = conn.Close() }()
+	keys, err := agent.NewClient(conn).List()
+	switch {
+	case err != nil:
+		c.fail("restart ssh-agent", "ssh-agent cannot list its keys: %v", err)
+	case len(keys) == 0 && len(needed) > 0:
+		c.warn("add the keys with ssh-add", "ssh-agent holds no keys, though hosts (%s) forward it", strings.Join(needed, ", "))
+	default:
+		c.ok("ssh-agent available with %d key(s)", len(keys))
+	}
+}
+
+// knownHosts checks each known_hosts file parses, is not writable by others
+// and records the keys of its hosts
+func (c *checkup) knownHosts(engine *host.Engine) {
+	files := map[string]*host.HostKeyManager{}
+	for _, cfgHost := range config.C.Hosts {
+		entry, ok := engine.Lookup(cfgHost.Id)
+		if !ok || entry.KnownHosts() == "" {
+			continue
+		}
+		file := entry.KnownHosts()
+		manager, checked := files[file]
+		if !checked {
+			manager = c.knownHostsFile(file)
+			files[file] = manager
+		}
+		if manager == nil || entry.Remote() == nil {
+			continue
+		}
+		if len(manager.Known(entry.Remote().String())) == 0 && !hashed(file) {
+			c.warn("once its fingerprints are verified, run: ash hostkey add "+entry.Name(),
+				"host (%s) key of %s is not in known_hosts (%s)", entry.Name(), entry.Remote(), file)
+		}
+	}
+}
+
+func (c *checkup) knownHostsFile(file string) *host.HostKeyManager {
+	fi, err := os.Stat(file)
+	if err != nil {
+		c.fail("create it with touch "+file+", then add each host's keys with ash hostkey add",
+			"known_hosts (%s) cannot be read: %v", file, errors.Unwrap(err))
+		return nil
+	}
+	if runtime.GOOS != "windows" && fi.Mode().Perm()&0022 != 0 {
+		c.fail("chmod go-w "+file, "known_hosts (%s) can be written by others (%04o)", file, fi.Mode().Perm())
+	}
+	manager, err := host.NewHostKeyManager(file)
+	if err != nil {
+		c.fail("correct or remove the lines named, then add the host's keys again with ash hostkey add",
+			"known_hosts (%s) %v", file, err)
+		return nil
+	}
+	c.ok("known_hosts (%s) is healthy", file)
+	return manager
+}
+
+// hashed reports whether the known_hosts file hashes its host names, which
+// cannot then be looked up
+func hashed(file string) bool {
+	bs, err := os.ReadFile(file)
+	return err == nil && bytes.Contains(bs, []byte("|1|"))
+}
+
+// hosts logs in to each host, through its jump hosts, and compares its clock
+// with this one's
+func (c *checkup) hosts(engine *host.Engine) {
+	for _, cfgHost := range config.C.Hosts {
+		entry, ok := engine.Lookup(cfgHost.Id)
+		if !ok || !entry.Valid() {
+			c.fail("run ash validate for the details", "host (%s) is invalid", cfgHost.Name)
+			continue
+		}
+		started := time.Now()
+		client, release, err := entry.Client()
+		if err != nil {
+			c.fail("check the host's address is reachable from here and its credentials are accepted",
+				"host (%s) cannot be logged in to at %s", entry.Name(), entry.Remote())
+			continue
+		}
+		c.ok("host (%s) logged in to in %v", entry.Name(), time.Since(started).Round(time.Millisecond))
+		c.clock(entry.Name(), func() ([]byte, error) {
+			session, err := client.NewSession()
+			if err != nil {
+				return nil, err
+			}
+			defer func() { _ = session.Close() }()
+			return session.Output("date -u +%s")
+		})
+		release()
+		entry.Close()
+	}
+}
+
+// clock compares the time the host gives with the middle of the time taken to
+// ask for it
+func (c *checkup) clock(name string, remoteTime func() ([]byte, error)) {
+	before := time.Now()
+	out, err := remoteTime()
+	after := time.Now()
+	if err != nil {
+		c.ok("host (%s) clock not checked: %v", name, err)
+		return
+	}
+	seconds, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	if err != nil {
+		c.ok("host (%s) clock not checked: date gave %q", name, strings.TrimSpace(string(out)))
+		return
+	}
+	local := before.Add(after.Sub(before) / 2)
+	skew := time.Unix(seconds, 0).Sub(local).Round(time.Second)
+	switch {
+	case skew > maxClockSkew:
+		c.fail("synchronise both clocks with ntp, as timedatectl set-ntp true does", "host (%s) clock is %v ahead of this one", name, skew)
+	case skew < -maxClockSkew:
+		c.fail("synchronise both clocks with ntp, as timedatectl set-ntp true does", "host (%s) clock is %v behind this one", name, -skew)
+	default:
+		c.ok("host (%s) clock is within %v of this one", name, maxClockSkew)
+	}
+}
+
+// ports checks the entrance of each tunnel opened here can be listened on
+func (c *checkup) ports(tunnels []engineModels.Tunnel) {
+	for _, t := range tunnels {
+		if !t.Valid() || t.Reverse() || t.Local() == nil || (t.Local().Port() == 0 && !t.Local().IsAbstract()) {
+			continue
+		}
+		address := t.Local().String()
+		ln, err := net.Listen(t.Local().Network(), address)
+		switch {
+		case errors.Is(err, syscall.EADDRINUSE) && t.Local().IsAbstract():
+			c.fail("stop what is listening there, found with ss -lxp, or change the tunnel's local address",
+				"tunnel (%s) entrance %s is already in use", t.Name(), address)
+		case errors.Is(err, syscall.EADDRINUSE):
+			c.fail("stop what is listening there, found with ss -ltnp or lsof -i :"+strconv.Itoa(t.Local().Port())+
+				", change the tunnel's local port, or run with --takeover should it be another auto-ssh",
+				"tunnel (%s) entrance %s is already in use", t.Name(), address)
+		case errors.Is(err, syscall.EACCES):
+			c.fail("use a port above 1023, or grant CAP_NET_BIND_SERVICE",
+				"tunnel (%s) entrance %s needs privileges to listen on", t.Name(), address)
+		case err != nil:
+			c.fail("correct the tunnel's local address", "tunnel (%s) entrance %s cannot be listened on: %v", t.Name(), address, err)
+		default:
+			_ = ln.Close()
+			c.ok("tunnel (%s) entrance %s is free", t.Name(), address)
+		}
+	}
+}
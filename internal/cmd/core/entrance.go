@@ -0,0 +1,84 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package core
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"us.figge.auto-ssh/internal/cmd"
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/flag"
+	"us.figge.auto-ssh/internal/core/preauth"
+)
+
+var (
+	entranceSubject string
+	entranceTTL     time.Duration
+)
+
+var entranceCmd = &cobra.Command{
+	Use:   "entrance",
+	Short: "Manages access to tunnel entrances requiring auth",
+	Run: func(cmd *cobra.Command, args []string) {
+		_ = cmd.Help()
+	},
+}
+
+var entranceTokenCmd = &cobra.Command{
+	Use:   "token <tunnel>",
+	Short: "Signs a token to authenticate to a tunnel's entrance with",
+	Long: `Signs a token with the auth secret of the tunnel, by its id or name, for a
+client to authenticate to its entrance with in place of the secret itself.  The
+token names its subject, recorded in the audit of each connection, and is no
+good once it expires or the secret is changed`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := entranceToken(args[0]); err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	cmd.RootCmd.AddCommand(entranceCmd)
+	entranceCmd.AddCommand(entranceTokenCmd)
+	flag.AddFlags(entranceTokenCmd, flag.Core)
+	entranceTokenCmd.Flags().StringVar(&entranceSubject, "subject", "", "who the token is issued to")
+	entranceTokenCmd.Flags().DurationVar(&entranceTTL, "ttl", config.DefaultTokenTTL, "how long the token is good for")
+}
+
+func entranceToken(ref string) error {
+	if entranceSubject == "" {
+		return fmt.Errorf("a token requires a --subject")
+	}
+	if entranceTTL <= 0 {
+		return fmt.Errorf("ttl(%s) must be positive", entranceTTL)
+	}
+	var found *config.Tunnel
+	for _, t := range config.C.Tunnels {
+		if t.Id == ref || t.Name == ref {
+			found = t
+			break
+		}
+	}
+	if found == nil {
+		return fmt.Errorf("tunnel (%s) not found", ref)
+	}
+	secret := found.Auth.SecretOrBlank()
+	if secret == "" {
+		return fmt.Errorf("tunnel (%s) has no auth secret", found.Name)
+	}
+	expires := time.Now().Add(entranceTTL)
+	token, err := preauth.Sign([]byte(secret), found.Name, entranceSubject, expires)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("token for %s to tunnel (%s), good until %s:\n%s\n", entranceSubject, found.Name, expires.Local().Format("2006-01-02 15:04:05"), token)
+	return nil
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"us.figge.auto-ssh/internal/cmd"
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/flag"
+	"us.figge.auto-ssh/internal/core/utils"
+	"us.figge.auto-ssh/internal/rest"
+	managerModels "us.figge.auto-ssh/internal/rest/models"
+)
+
+var panicCmd = &cobra.Command{
+	Use:   "panic [reason]",
+	Short: "Cuts all access through a running auto-ssh immediately",
+	Long: `Pulls the kill switch of a running auto-ssh: every tunnel entrance is closed,
+every connection dropped, the private keys held in memory overwritten and
+auto-ssh exits.  Nothing is reopened until auto-ssh is started again.
+
+RSA keys are not fully overwritten, the crypto library keeping a copy of them
+that cannot be reached, so they remain in memory until auto-ssh exits`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := pullKillSwitch(cmd, strings.Join(args, " ")); err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	cmd.RootCmd.AddCommand(panicCmd)
+	flag.AddFlags(panicCmd, flag.Core, flag.Force, rest.Flags)
+}
+
+func pullKillSwitch(cmd *cobra.Command, reason string) error {
+	if answer, ok := utils.Ask("Close every tunnel and stop auto-ssh? [yes/no]: ", false, true); !ok || !strings.EqualFold(answer, "yes") {
+		return fmt.Errorf("kill switch not pulled")
+	}
+	client, err := rest.NewClient(config.C.Web)
+	if err != nil {
+		return err
+	}
+	input := &managerModels.PullKillSwitchInput{Reason: reason}
+	output := &managerModels.PullKillSwitchOutput{}
+	if err = client.Do(cmd.Context(), http.MethodPost, "/panic", input, output); err != nil {
+		return err
+	}
+	fmt.Printf("kill switch pulled: %s\n", output.Reason)
+	return nil
+}
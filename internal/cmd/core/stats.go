@@ -0,0 +1,68 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"us.figge.auto-ssh/internal/cmd"
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/flag"
+	"us.figge.auto-ssh/internal/rest"
+	managerModels "us.figge.auto-ssh/internal/rest/models"
+)
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Manages the traffic totals of a running auto-ssh",
+	Run: func(cmd *cobra.Command, args []string) {
+		_ = cmd.Help()
+	},
+}
+
+var statsResetCmd = &cobra.Command{
+	Use:   "reset [tunnel]...",
+	Short: "Resets the traffic totals of tunnels, by id or name, or of every tunnel",
+	Long: `Resets the lifetime byte and connection totals shown by status --wide of the
+tunnels, by id or name, or of every tunnel when none are given`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := resetStats(cmd, args); err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	cmd.RootCmd.AddCommand(statsCmd)
+	statsCmd.AddCommand(statsResetCmd)
+	flag.AddFlags(statsResetCmd, flag.Core, rest.Flags)
+}
+
+func resetStats(cmd *cobra.Command, refs []string) error {
+	client, err := rest.NewClient(config.C.Web)
+	if err != nil {
+		return err
+	}
+	query := url.Values{}
+	for _, ref := range refs {
+		query.Add("tunnel", ref)
+	}
+	path := "/stats"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	output := &managerModels.ResetStatsOutput{}
+	if err = client.Do(cmd.Context(), http.MethodDelete, path, nil, output); err != nil {
+		return err
+	}
+	fmt.Printf("traffic totals reset: %s\n", strings.Join(output.Tunnels, ", "))
+	return nil
+}
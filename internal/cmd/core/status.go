@@ -0,0 +1,142 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"us.figge.auto-ssh/internal/cmd"
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/flag"
+	"us.figge.auto-ssh/internal/rest"
+	managerModels "us.figge.auto-ssh/internal/rest/models"
+)
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Displays the status of the tunnels and hosts of a running auto-ssh",
+	Run: func(cmd *cobra.Command, args []string) {
+		err := status(cmd)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	cmd.RootCmd.AddCommand(statusCmd)
+	flag.AddFlags(statusCmd, flag.Core, rest.Flags, flag.Json, flag.Wide, flag.Connections)
+}
+
+func status(cmd *cobra.Command) error {
+	client, err := rest.NewClient(config.C.Web)
+	if err != nil {
+		return err
+	}
+	path := "/status"
+	if config.ConnectionsFlag {
+		path += "?connections=true"
+	}
+	output := &managerModels.GetStatusOutput{}
+	if err = client.Do(cmd.Context(), http.MethodGet, path, nil, output); err != nil {
+		return err
+	}
+
+	if config.JsonFlag {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(output)
+	}
+
+	fmt.Printf("auto-ssh up %s\n\n", output.Uptime)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if config.WideFlag {
+		_, _ = fmt.Fprintf(w, "ID\tTUNNEL\tLOCAL\tSTATE\tCONNS\tUPTIME\tHOST\tREMOTE\tCONNECT\tTOTAL\tRCVD\tSENT\n")
+		for _, t := range output.Tunnels {
+			total, rcvd, sent := "-", "-", "-"
+			if t.Traffic != nil {
+				total, rcvd, sent = fmt.Sprintf("%d", t.Traffic.Connections), size(t.Traffic.BytesIn), size(t.Traffic.BytesOut)
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				t.Id, t.Name, entrance(t), state(t), t.Connections, dash(t.Uptime), dash(t.Host), t.Remote, dash(t.Latency), total, rcvd, sent)
+		}
+	} else {
+		_, _ = fmt.Fprintf(w, "ID\tTUNNEL\tPORT\tSTATE\tCONNS\n")
+		for _, t := range output.Tunnels {
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%d\n", t.Id, t.Name, t.Port, state(t), t.Connections)
+		}
+	}
+	_, _ = fmt.Fprintf(w, "\n")
+	if config.ConnectionsFlag {
+		_, _ = fmt.Fprintf(w, "TUNNEL\tCONN\tCLIENT\tTARGET\tPROTOCOL\tDURATION\tRCVD\tSENT\n")
+		for _, t := range output.Tunnels {
+			for _, c := range t.ActiveConnections {
+				_, _ = fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+					t.Name, c.Id, c.Client, c.Target, dash(c.Protocol), c.Duration, size(c.BytesIn), size(c.BytesOut))
+			}
+		}
+		_, _ = fmt.Fprintf(w, "\n")
+	}
+	if config.WideFlag {
+		_, _ = fmt.Fprintf(w, "ID\tHOST\tREMOTE\tVALID\tCONNECTED\tREFS\tJUMP\tRTT\n")
+		for _, h := range output.Hosts {
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%t\t%d\t%s\t%s\n",
+				h.Id, h.Name, h.Remote, h.Valid, h.Connected, h.References, dash(h.JumpHost), dash(h.Latency))
+		}
+	} else {
+		_, _ = fmt.Fprintf(w, "ID\tHOST\tCONNECTED\n")
+		for _, h := range output.Hosts {
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%t\n", h.Id, h.Name, h.Connected)
+		}
+	}
+	return w.Flush()
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// size formats a byte count in binary units
+func size(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// entrance is the address a tunnel listens on, as bound when the port was
+// left to the host, and where
+func entrance(t *managerModels.TunnelStatus) string {
+	address := t.Local
+	if t.Bound != "" {
+		address = t.Bound
+	}
+	if t.Reverse {
+		return address + " on " + t.Host
+	}
+	return address
+}
+
+func state(t *managerModels.TunnelStatus) string {
+	if !t.Enabled {
+		return "Disabled"
+	}
+	return t.Running
+}
@@ -0,0 +1,33 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package core
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"us.figge.auto-ssh/internal/cmd"
+	"us.figge.auto-ssh/internal/core/flag"
+	"us.figge.auto-ssh/internal/rest"
+)
+
+var stopCmd = &cobra.Command{
+	Use:   "stop <tunnel>...",
+	Short: "Stops one or more tunnels, by id or name, of a running auto-ssh",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := changeTunnelState(cmd.Context(), "stop", args)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	cmd.RootCmd.AddCommand(stopCmd)
+	flag.AddFlags(stopCmd, flag.Core, rest.Flags)
+}
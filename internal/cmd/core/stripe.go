@@ -0,0 +1,75 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package core
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"us.figge.auto-ssh/internal/cmd"
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/flag"
+	"us.figge.auto-ssh/internal/core/log"
+	"us.figge.auto-ssh/internal/core/stripe"
+)
+
+var (
+	stripeListen  string
+	stripeTimeout time.Duration
+)
+
+var stripeCmd = &cobra.Command{
+	Use:   "stripe",
+	Short: "Reassembles the connections of striped tunnels, run where their host can reach it",
+	Long: `Listens for the channels of tunnels configured with stripe, each connection
+being spread across several of them, puts each connection back together and
+connects on to the tunnel's forward address. Run it on the tunnel's host, or a
+machine the host reaches, with --listen matching the tunnel's stripe server.
+
+The forward address is named by the tunnel, so anyone who can reach the listen
+address can connect on from here. Keep it on 127.0.0.1 unless the machine's
+firewall keeps others from it`,
+	Example: `  ash stripe --listen 127.0.0.1:7900`,
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := serveStripes(); err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	cmd.RootCmd.AddCommand(stripeCmd)
+	flag.AddFlags(stripeCmd, flag.Core)
+	stripeCmd.Flags().StringVar(&stripeListen, "listen", config.DefaultStripeServer, "address the channels of striped tunnels arrive at")
+	stripeCmd.Flags().DurationVar(&stripeTimeout, "timeout", 10*time.Second, "how long a connection's channels have to arrive, and its forward address to answer")
+}
+
+func serveStripes() error {
+	ln, err := net.Listen("tcp", stripeListen)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = ln.Close() }()
+	log.Printf("  Info  - stripe server listening on %s\n", ln.Addr())
+	server := &stripe.Server{
+		Timeout: stripeTimeout,
+		Dial: func(target string) (net.Conn, error) {
+			return net.DialTimeout("tcp", target, stripeTimeout)
+		},
+		Joined: func(target string, streams int, err error) {
+			if err != nil {
+				log.Printf("  Warn  - stripe to %s across %d channels failed: %v\n", target, streams, err)
+			} else if config.VerboseFlag {
+				log.Printf("  Info  - stripe to %s across %d channels joined\n", target, streams)
+			}
+		},
+	}
+	return server.Serve(ln)
+}
@@ -0,0 +1,303 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package core
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"us.figge.auto-ssh/internal/cmd"
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/flag"
+	"us.figge.auto-ssh/internal/resources/engine/host"
+	engineStats "us.figge.auto-ssh/internal/resources/engine/stats"
+	"us.figge.auto-ssh/internal/resources/engine/tunnel"
+	engineModels "us.figge.auto-ssh/internal/resources/models"
+)
+
+const (
+	sqlPostgres = "postgres"
+	sqlMySQL    = "mysql"
+
+	// postgresSSLRequest asks a postgres server whether it speaks tls, which
+	// it answers before any authentication
+	postgresSSLRequest = 80877103
+	testPoll           = 10 * time.Millisecond
+)
+
+var (
+	testHTTP    string
+	testSQL     string
+	testTimeout time.Duration
+)
+
+var testCmd = &cobra.Command{
+	Use:   "test <tunnel>",
+	Short: "Opens a tunnel on its own and connects through it to its forward address",
+	Long: `Opens just the tunnel, given by id or name, on a port of its own so it does not
+clash with a running auto-ssh, connects through it to the tunnel's forward
+address, reports how long each step took and closes it again. Exits with a
+non-zero status should the connection not be made.
+
+With --http the service is sent a GET of the path and must answer, and with
+--sql postgres or --sql mysql the database must answer as one. Without either,
+the connection through the host to the forward address must be made. Http
+tunnels are sent a GET of / by default. The entrance's own auth, access rules and
+tls are left out, as they are not what is tested`,
+	Example: `  ash test db --sql postgres
+  ash test web --http /health`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := testTunnel(cmd, args[0]); err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	cmd.RootCmd.AddCommand(testCmd)
+	flag.AddFlags(testCmd, flag.Core, flag.PKCS11)
+	testCmd.Flags().StringVar(&testHTTP, "http", "", "path the service is sent a GET of")
+	testCmd.Flags().StringVar(&testSQL, "sql", "", "database the service must answer as: postgres or mysql")
+	testCmd.Flags().DurationVar(&testTimeout, "timeout", 30*time.Second, "how long the tunnel has to open and the service to answer")
+}
+
+func testTunnel(cmd *cobra.Command, ref string) error {
+	switch testSQL {
+	case "", sqlPostgres, sqlMySQL:
+	default:
+		return fmt.Errorf("sql (%s) must be %s or %s", testSQL, sqlPostgres, sqlMySQL)
+	}
+	if testHTTP != "" && testSQL != "" {
+		return fmt.Errorf("only one of http and sql can be given")
+	}
+	cfgTunnel, err := testable(ref)
+	if err != nil {
+		return err
+	}
+	if testHTTP == "" && testSQL == "" && cfgTunnel.HTTP != nil {
+		testHTTP = "/"
+	}
+
+	ctx, cancel := context.WithCancel(cmd.Context())
+	wg := &sync.WaitGroup{}
+	hostEngine := host.NewEngine(ctx, config.C.Hosts)
+	tunnelEngine := tunnel.NewEngine(ctx, hostEngine, []*config.Tunnel{cfgTunnel})
+	t := tunnelEngine.Tunnels()[0]
+	if !t.Valid() {
+		cancel()
+		return fmt.Errorf("tunnel (%s) is invalid", cfgTunnel.Name)
+	}
+	started := time.Now()
+	tunnelEngine.StartTunnels(ctx, engineStats.NewEngine(), wg)
+	err = waitReady(t, started.Add(testTimeout))
+	if err == nil {
+		fmt.Printf("tunnel (%s) opened on %s in %v\n", cfgTunnel.Name, t.BoundAddress(), since(started))
+		err = connectThrough(t, cfgTunnel)
+	}
+	if err != nil {
+		fmt.Printf("%v\n", err)
+	}
+	t.Stop()
+	cancel()
+	wg.Wait()
+	fmt.Printf("tunnel (%s) closed\n", cfgTunnel.Name)
+	if err != nil {
+		return fmt.Errorf("tunnel (%s) failed its test", cfgTunnel.Name)
+	}
+	return nil
+}
+
+// testable copies the tunnel's configuration to run on a port of its own,
+// without the features of its entrance that would stand in the way
+func testable(ref string) (*config.Tunnel, error) {
+	var found *config.Tunnel
+	for _, t := range config.C.Tunnels {
+		if t.Id == ref || (found == nil && t.Name == ref) {
+			found = t
+		}
+	}
+	switch {
+	case found == nil:
+		return nil, fmt.Errorf("tunnel (%s) undefined", ref)
+	case found.Reverse:
+		return nil, fmt.Errorf("tunnel (%s) is reverse, its entrance on its host cannot be tested from here", found.Name)
+	case found.Socks != nil || len(found.Routes) > 0 || found.Remote == nil || found.Remote.IsBlank():
+		return nil, fmt.Errorf("tunnel (%s) has no forward address of its own to test", found.Name)
+	}
+	// Entrances here must name their port, so one free for now is taken
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	address := ln.Addr().String()
+	_ = ln.Close()
+	t := *found
+	on := true
+	t.Local = config.NewAddress(address)
+	t.Bind, t.Enabled, t.Autostart, t.Require = "", &on, &on, false
+	t.Schedule, t.Prewarm, t.Watchdog, t.Status = nil, nil, nil, nil
+	t.Access, t.Auth, t.TLS, t.Capture = nil, nil, nil, nil
+	return &t, nil
+}
+
+func waitReady(t engineModels.Tunnel, deadline time.Time) error {
+	for {
+		ready, reason := t.Ready()
+		if ready {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("tunnel (%s) not ready after %v: %s", t.Name(), testTimeout, reason)
+		}
+		time.Sleep(testPoll)
+	}
+}
+
+// connectThrough connects to the entrance and has the service answer, or
+// without a service to ask, waits for the tunnel to dial the forward address
+func connectThrough(t engineModels.Tunnel, cfgTunnel *config.Tunnel) error {
+	dialed := t.Distributions().Dial.Count()
+	started := time.Now()
+	conn, err := net.DialTimeout("tcp", t.BoundAddress(), testTimeout)
+	if err != nil {
+		return fmt.Errorf("tunnel (%s) entrance cannot be connected to: %v", t.Name(), err)
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(started.Add(testTimeout))
+
+	target := cfgTunnel.Remote.String()
+	var answer string
+	switch {
+	case testHTTP != "":
+		answer, err = pingHTTP(conn, cfgTunnel, testHTTP)
+	case testSQL == sqlPostgres:
+		answer, err = pingPostgres(conn)
+	case testSQL == sqlMySQL:
+		answer, err = pingMySQL(conn)
+	default:
+		answer, err = awaitDial(t, conn, dialed)
+	}
+	if err != nil {
+		return fmt.Errorf("tunnel (%s) failed to reach %s after %v: %v", t.Name(), target, since(started), err)
+	}
+	fmt.Printf("tunnel (%s) reached %s in %v: %s\n", t.Name(), target, since(started), answer)
+	return nil
+}
+
+// awaitDial waits for the tunnel to have dialed the forward address, which it
+// does once the client connects, or for the service to speak first.  The
+// tunnel closing the connection means the dial failed
+func awaitDial(t engineModels.Tunnel, conn net.Conn, dialed uint64) (string, error) {
+	deadline := time.Now().Add(testTimeout)
+	buf := make([]byte, 1)
+	for time.Now().Before(deadline) {
+		if t.Distributions().Dial.Count() > dialed {
+			return "connected", nil
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(testPoll))
+		n, err := conn.Read(buf)
+		if n > 0 {
+			return "connected, the service spoke first", nil
+		}
+		var netErr net.Error
+		if err != nil && !(errors.As(err, &netErr) && netErr.Timeout()) {
+			if errors.Is(err, io.EOF) {
+				return "", errors.New("connection closed by the tunnel")
+			}
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("no connection after %v", testTimeout)
+}
+
+func pingHTTP(conn net.Conn, cfgTunnel *config.Tunnel, path string) (string, error) {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	hostHeader := cfgTunnel.Remote.String()
+	if cfgTunnel.HTTP != nil && cfgTunnel.HTTP.Host != "" {
+		hostHeader = cfgTunnel.HTTP.Host
+	}
+	req, err := http.NewRequest(http.MethodGet, "http://"+hostHeader+path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Close = true
+	req.Header.Set("User-Agent", "auto-ssh-test")
+	if err = req.Write(conn); err != nil {
+		return "", err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return "", err
+	}
+	_ = resp.Body.Close()
+	return fmt.Sprintf("GET %s returned %s", path, resp.Status), nil
+}
+
+// pingPostgres asks whether the server speaks tls, which any postgres server
+// answers with S or N without logging anything in
+func pingPostgres(conn net.Conn) (string, error) {
+	request := make([]byte, 8)
+	binary.BigEndian.PutUint32(request[0:4], 8)
+	binary.BigEndian.PutUint32(request[4:8], postgresSSLRequest)
+	if _, err := conn.Write(request); err != nil {
+		return "", err
+	}
+	reply := make([]byte, 1)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return "", err
+	}
+	switch reply[0] {
+	case 'S':
+		return "postgres answered, with tls", nil
+	case 'N':
+		return "postgres answered, without tls", nil
+	}
+	return "", fmt.Errorf("not postgres: answered %q", reply)
+}
+
+// pingMySQL reads the greeting a mysql server sends each client on connecting
+func pingMySQL(conn net.Conn) (string, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return "", err
+	}
+	length := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+	if length == 0 || length > 64*1024 {
+		return "", fmt.Errorf("not mysql: greeting of %d bytes", length)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(conn, payload); err != nil {
+		return "", err
+	}
+	switch payload[0] {
+	case 10:
+		version, _, _ := strings.Cut(string(payload[1:]), "\x00")
+		return "mysql " + version + " answered", nil
+	case 0xff:
+		if len(payload) > 3 {
+			return "", fmt.Errorf("mysql refused: %s", payload[3:])
+		}
+	}
+	return "", fmt.Errorf("not mysql: protocol %d", payload[0])
+}
+
+func since(started time.Time) time.Duration {
+	return time.Since(started).Round(time.Millisecond)
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"us.figge.auto-ssh/internal/cmd"
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/flag"
+	"us.figge.auto-ssh/internal/core/log"
+	"us.figge.auto-ssh/internal/rest"
+	managerModels "us.figge.auto-ssh/internal/rest/models"
+)
+
+var (
+	tokenAccess string
+)
+
+var tokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Manages the API tokens of a running auto-ssh",
+	Run: func(cmd *cobra.Command, args []string) {
+		_ = cmd.Help()
+	},
+}
+
+var tokenCreateCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "Issues an API token",
+	Long: `Issues an API token, printing it the one time it is shown.  Once a token has
+been issued, every request to the API must present one, with --token or
+$AUTO_SSH_TOKEN.  Issued tokens are kept in web.tokenFile`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := createToken(cmd, args[0]); err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var tokenListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists the issued API tokens",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := listTokens(cmd); err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var tokenRevokeCmd = &cobra.Command{
+	Use:   "revoke <name>...",
+	Short: "Revokes issued API tokens",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := revokeTokens(cmd, args); err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	cmd.RootCmd.AddCommand(tokenCmd)
+	tokenCmd.AddCommand(tokenCreateCmd, tokenListCmd, tokenRevokeCmd)
+	flag.AddFlags(tokenCreateCmd, flag.Core, rest.Flags)
+	flag.AddFlags(tokenListCmd, flag.Core, rest.Flags)
+	flag.AddFlags(tokenRevokeCmd, flag.Core, rest.Flags)
+	tokenCreateCmd.Flags().StringVar(&tokenAccess, "access", config.TokenAccessRead, "access granted by the token: read or admin")
+}
+
+func createToken(cmd *cobra.Command, name string) error {
+	client, err := rest.NewClient(config.C.Web)
+	if err != nil {
+		return err
+	}
+	input := &managerModels.CreateTokenInput{Name: name, Access: tokenAccess}
+	output := &managerModels.CreateTokenOutput{}
+	if err = client.Do(cmd.Context(), http.MethodPost, "/tokens", input, output); err != nil {
+		return err
+	}
+	fmt.Printf("token (%s) issued with %s access.  It will not be shown again:\n%s\n", output.Name, output.Access, output.Token)
+	return nil
+}
+
+func listTokens(cmd *cobra.Command) error {
+	client, err := rest.NewClient(config.C.Web)
+	if err != nil {
+		return err
+	}
+	output := &managerModels.ListTokensOutput{}
+	if err = client.Do(cmd.Context(), http.MethodGet, "/tokens", nil, output); err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(w, "NAME\tACCESS\tCREATED\n")
+	for _, t := range output.Items {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", t.Name, t.Access, t.Created.Local().Format("2006-01-02 15:04:05"))
+	}
+	return w.Flush()
+}
+
+func revokeTokens(cmd *cobra.Command, names []string) error {
+	client, err := rest.NewClient(config.C.Web)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, name := range names {
+		output := &managerModels.RevokeTokenOutput{}
+		if err = client.Do(cmd.Context(), http.MethodDelete, "/tokens/"+url.PathEscape(name), nil, output); err != nil {
+			fmt.Print(log.Format(fmt.Sprintf("  Error - token (%s) %v\n", name, err)))
+			failed++
+			continue
+		}
+		fmt.Printf("token (%s) revoked\n", output.Name)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d tokens failed to be revoked", failed, len(names))
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/rest"
+	managerModels "us.figge.auto-ssh/internal/rest/models"
+)
+
+// changeTunnelState applies the start or stop action to each tunnel, referenced
+// by either id or name, on the running auto-ssh instance
+func changeTunnelState(ctx context.Context, action string, refs []string) error {
+	client, err := rest.NewClient(config.C.Web)
+	if err != nil {
+		return err
+	}
+	ids, err := resolveTunnelIds(ctx, client, refs)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for i, id := range ids {
+		output := &managerModels.StartTunnelOutput{}
+		path := fmt.Sprintf("/tunnels/%s/%s", url.PathEscape(id), action)
+		if err = client.Do(ctx, http.MethodPatch, path, nil, output); err != nil {
+			fmt.Printf("  Error - tunnel (%s) %v\n", refs[i], err)
+			failed++
+			continue
+		}
+		running := "unknown"
+		if output.Status != nil {
+			running = output.Status.Running
+		}
+		fmt.Printf("tunnel (%s) %s\n", refs[i], running)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d tunnels failed to %s", failed, len(ids), action)
+	}
+	return nil
+}
+
+func resolveTunnelIds(ctx context.Context, client *rest.Client, refs []string) ([]string, error) {
+	list := &managerModels.ListTunnelOutput{}
+	if err := client.Do(ctx, http.MethodGet, "/tunnels?maxResults=1000", nil, list); err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		id := ""
+		for _, item := range list.Items {
+			if item.Id == ref {
+				id = item.Id
+				break
+			} else if item.Name == ref && id == "" {
+				id = item.Id
+			}
+		}
+		if id == "" {
+			return nil, fmt.Errorf("tunnel (%s) undefined", ref)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
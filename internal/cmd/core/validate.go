@@ -0,0 +1,155 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+	"us.figge.auto-ssh/internal/cmd"
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/flag"
+	"us.figge.auto-ssh/internal/core/log"
+	"us.figge.auto-ssh/internal/resources/engine/host"
+	"us.figge.auto-ssh/internal/resources/engine/tunnel"
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validates the configuration without opening any tunnels",
+	Long: `Validates the hosts and tunnels of the configuration file without opening any
+listeners or connections. Exits with a non-zero status when any errors are found`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := validate(cmd)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	cmd.RootCmd.AddCommand(validateCmd)
+	flag.AddFlags(validateCmd, flag.Core, flag.Bind, flag.PKCS11)
+}
+
+func validate(cmd *cobra.Command) error {
+	errorCount := 0
+	var lines map[string][]int
+	if config.FileName != "" {
+		bs, source, err := config.ReadLines(cmd.Context(), config.FileName)
+		if err != nil {
+			return err
+		}
+		errorCount += validateFields(bs, source)
+		lines = entryLines(bs, source)
+	}
+
+	hostEngine := host.NewEngine(cmd.Context(), config.C.Hosts)
+	hostIds := make(map[string]int)
+	for i, cfgHost := range config.C.Hosts {
+		// The engine keeps the first of hosts sharing an id and drops the rest
+		if first, ok := hostIds[cfgHost.Id]; ok {
+			log.Printf("  Error - hosts[%d]%s host (%s) id (%s) is already used by hosts[%d]\n",
+				i, lineRef(lines, "hosts", i), cfgHost.Name, cfgHost.Id, first)
+			errorCount++
+			continue
+		}
+		hostIds[cfgHost.Id] = i
+		if h, ok := hostEngine.Host(cfgHost.Id); !ok || !h.Valid() {
+			log.Printf("  Error - hosts[%d]%s host (%s) is invalid\n", i, lineRef(lines, "hosts", i), cfgHost.Name)
+			errorCount++
+		}
+	}
+	tunnel.NewEngine(cmd.Context(), hostEngine, config.C.Tunnels)
+	tunnelIds := make(map[string]int)
+	for i, cfgTunnel := range config.C.Tunnels {
+		if first, ok := tunnelIds[cfgTunnel.Id]; ok {
+			log.Printf("  Error - tunnels[%d]%s tunnel (%s) id (%s) is already used by tunnels[%d]\n",
+				i, lineRef(lines, "tunnels", i), cfgTunnel.Name, cfgTunnel.Id, first)
+			errorCount++
+			continue
+		}
+		tunnelIds[cfgTunnel.Id] = i
+		if cfgTunnel.Status == nil || !cfgTunnel.Status.Valid {
+			log.Printf("  Error - tunnels[%d]%s tunnel (%s) is invalid\n", i, lineRef(lines, "tunnels", i), cfgTunnel.Name)
+			errorCount++
+		}
+	}
+	if !config.C.Registry.Validate() {
+		errorCount++
+	}
+	if !config.C.Probe.Validate() {
+		errorCount++
+	}
+	if !config.C.StatsD.Validate() {
+		errorCount++
+	}
+	if !config.C.Health.Validate() {
+		errorCount++
+	}
+	if !config.C.Traffic.Validate() {
+		errorCount++
+	}
+
+	if errorCount > 0 {
+		return fmt.Errorf("configuration %s has %d error(s)", config.FileName, errorCount)
+	}
+	fmt.Printf("configuration %s is valid: %d hosts, %d tunnels\n", config.FileName, len(config.C.Hosts), len(config.C.Tunnels))
+	return nil
+}
+
+// validateFields strictly decodes the configuration, reporting unknown or
+// misspelt fields along with their line numbers in the source
+func validateFields(bs []byte, source config.Lines) int {
+	decoder := yaml.NewDecoder(bytes.NewReader(bs))
+	decoder.KnownFields(true)
+	err := decoder.Decode(config.NewConfig())
+	if err == nil || errors.Is(err, io.EOF) {
+		return 0
+	}
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		for _, msg := range typeErr.Errors {
+			log.Printf("  Error - %s\n", source.Translate(msg))
+		}
+		return len(typeErr.Errors)
+	}
+	log.Printf("  Error - %s\n", source.Translate(err.Error()))
+	return 1
+}
+
+// entryLines returns the line of the source on which each entry of the top
+// level sequences begins
+func entryLines(bs []byte, source config.Lines) map[string][]int {
+	lines := make(map[string][]int)
+	root := &yaml.Node{}
+	if err := yaml.Unmarshal(bs, root); err != nil || len(root.Content) == 0 {
+		return lines
+	}
+	doc := root.Content[0]
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		key, value := doc.Content[i], doc.Content[i+1]
+		if value.Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, entry := range value.Content {
+			lines[key.Value] = append(lines[key.Value], source.Source(entry.Line))
+		}
+	}
+	return lines
+}
+
+func lineRef(lines map[string][]int, group string, index int) string {
+	if index < len(lines[group]) {
+		return fmt.Sprintf(" line %d:", lines[group][index])
+	}
+	return ":"
+}
@@ -30,12 +30,12 @@ var versionCmd = &cobra.Command{
 
 func init() {
 	cmd.RootCmd.AddCommand(versionCmd)
-	flag.AddFlags(versionCmd, flag.Verbose)
+	flag.AddFlags(versionCmd, flag.Verbose, flag.FIPS)
 }
 
 func version(cmd *cobra.Command) error {
 	if cmd.Flag("verbose").Changed {
-		format := "%s version %s %s/%s, build %s, commit %s, built %v\n"
+		format := "%s version %s %s/%s, build %s, commit %s, built %v%s\n"
 		fmt.Printf(format,
 			os.Args[0],
 			config.Version,
@@ -44,14 +44,25 @@ func version(cmd *cobra.Command) error {
 			config.BuildNumber,
 			config.Commit,
 			time.Now().Format(time.DateTime),
+			fipsNote(),
 		)
 	} else {
-		fmt.Printf("%s verison %s %s/%s\n",
+		fmt.Printf("%s verison %s %s/%s%s\n",
 			os.Args[0],
 			config.Version,
 			runtime.GOOS,
 			runtime.GOARCH,
+			fipsNote(),
 		)
 	}
 	return nil
 }
+
+// fipsNote annotates the version in fips mode, for compliance reviews to see
+// the restrictions are in force
+func fipsNote() string {
+	if !config.FIPSFlag {
+		return ""
+	}
+	return ", fips mode: approved algorithms only, no password authentication, host keys checked"
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"us.figge.auto-ssh/internal/cmd"
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/flag"
+	"us.figge.auto-ssh/internal/core/log"
+	"us.figge.auto-ssh/internal/rest"
+	managerModels "us.figge.auto-ssh/internal/rest/models"
+)
+
+const waitPoll = 500 * time.Millisecond
+
+var waitTimeout time.Duration
+
+var waitCmd = &cobra.Command{
+	Use:   "wait <tunnel>...",
+	Short: "Waits until one or more tunnels, by id or name, of a running auto-ssh can forward connections",
+	Long: `Waits until each tunnel, by id or name, has its entrance open and its host connected,
+so scripts can use a tunnel as soon as it is usable. auto-ssh may still be starting
+when wait is run. Exits with an error should the timeout pass first`,
+	Example: `  ash run --ready-file /tmp/ash.ready &
+  ash wait db --timeout 30s && psql -h 127.0.0.1 -p 5432`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := wait(cmd.Context(), args)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	cmd.RootCmd.AddCommand(waitCmd)
+	flag.AddFlags(waitCmd, flag.Core, rest.Flags)
+	waitCmd.Flags().DurationVar(&waitTimeout, "timeout", time.Minute, "how long to wait for the tunnels to be ready")
+}
+
+func wait(ctx context.Context, refs []string) error {
+	client, err := rest.NewClient(config.C.Web)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, waitTimeout)
+	defer cancel()
+	ticker := time.NewTicker(waitPoll)
+	defer ticker.Stop()
+
+	// auto-ssh may not be answering yet
+	ids, err := resolveTunnelIds(ctx, client, refs)
+	for errors.Is(err, rest.ErrUnreachable) {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("auto-ssh unavailable after %v", waitTimeout)
+		case <-ticker.C:
+		}
+		ids, err = resolveTunnelIds(ctx, client, refs)
+	}
+	if err != nil {
+		return err
+	}
+	reasons := make(map[string]string)
+	for len(ids) > 0 {
+		var pending []string
+		for _, id := range ids {
+			output := &managerModels.TunnelReadyOutput{}
+			if err = client.Do(ctx, http.MethodGet, fmt.Sprintf("/tunnels/%s/ready", url.PathEscape(id)), nil, output); err != nil {
+				reasons[id] = err.Error()
+				pending = append(pending, id)
+			} else if !output.Ready {
+				reasons[id] = output.Reason
+				pending = append(pending, id)
+			} else {
+				fmt.Printf("tunnel (%s) ready\n", output.Name)
+			}
+		}
+		if ids = pending; len(ids) == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			for _, id := range ids {
+				fmt.Print(log.Format(fmt.Sprintf("  Error - tunnel (%s) not ready: %s\n", id, reasons[id])))
+			}
+			return fmt.Errorf("%d of %d tunnels not ready after %v", len(ids), len(refs), waitTimeout)
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
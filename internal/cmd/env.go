@@ -0,0 +1,80 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package cmd
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/log"
+)
+
+// tunnelEnvPrefix starts the names of the variables giving each tunnel's
+// entrance.  They are not numbered, so an auto-ssh reading its environment
+// does not take them for tunnel definitions
+const tunnelEnvPrefix = "AUTOSSH_TUNNEL_"
+
+// tunnelEnv names the address each tunnel's entrance is listening on, as
+// AUTOSSH_TUNNEL_<NAME>_ADDR, _HOST and _PORT, the name upper-cased with
+// anything but letters and digits replaced by underscores
+func tunnelEnv() []string {
+	var env []string
+	for _, tunnel := range tunnelEngine.Tunnels() {
+		if !tunnel.Valid() || tunnel.Reverse() || tunnel.Local() == nil {
+			continue
+		}
+		address := tunnel.BoundAddress()
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			continue
+		}
+		name := tunnelEnvPrefix + envName(tunnel.Name())
+		env = append(env, name+"_ADDR="+address, name+"_HOST="+host, name+"_PORT="+port)
+	}
+	return env
+}
+
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		} else if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// writeEnvFile writes the tunnel variables to the env file in dotenv form, for
+// other tools to source.  The file is replaced whole, so readers never see it
+// half written
+func writeEnvFile() {
+	if config.EnvFileFlag == "" {
+		return
+	}
+	content := strings.Join(tunnelEnv(), "\n") + "\n"
+	tmp := filepath.Join(filepath.Dir(config.EnvFileFlag), "."+filepath.Base(config.EnvFileFlag)+".tmp")
+	err := os.WriteFile(tmp, []byte(content), 0644)
+	if err == nil {
+		err = os.Rename(tmp, config.EnvFileFlag)
+	}
+	if err != nil {
+		log.Printf("  Error - env file (%s) cannot be written: %v\n", config.EnvFileFlag, err)
+	}
+}
+
+// removeEnvFile withdraws the env file as auto-ssh exits
+func removeEnvFile() {
+	if config.EnvFileFlag == "" {
+		return
+	}
+	if err := os.Remove(config.EnvFileFlag); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("  Warn  - env file (%s) cannot be removed: %v\n", config.EnvFileFlag, err)
+	}
+}
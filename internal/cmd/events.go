@@ -0,0 +1,53 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/log"
+)
+
+// initConsole sets how messages are written to stdout.  With --output json
+// the run's startup and shutdown are told as events, so tools wrapping
+// auto-ssh can follow it without parsing log lines
+func initConsole() {
+	switch config.OutputFlag {
+	case "", config.OutputText:
+	case config.OutputJSON:
+		log.SetJSON(true)
+	default:
+		fmt.Printf("output (%s) must be %s or %s\n", config.OutputFlag, config.OutputText, config.OutputJSON)
+		os.Exit(1)
+	}
+	log.SetColor(!config.NoColorFlag && log.ColorSupported(os.Stdout))
+	log.SetTimestamps(config.TimestampsFlag)
+}
+
+func emitStarting() {
+	log.Event("starting", map[string]any{"pid": os.Getpid(), "version": config.Version, "fips": config.FIPSFlag})
+}
+
+// emitReady names the address of each tunnel's entrance, as the env file does
+func emitReady() {
+	tunnels := []map[string]any{}
+	for _, tunnel := range tunnelEngine.Tunnels() {
+		if !tunnel.Valid() || tunnel.Reverse() || tunnel.Local() == nil {
+			continue
+		}
+		tunnels = append(tunnels, map[string]any{"name": tunnel.Name(), "address": tunnel.BoundAddress()})
+	}
+	log.Event("ready", map[string]any{"tunnels": tunnels})
+}
+
+func emitStopping(reason string) {
+	log.Event("stopping", map[string]any{"reason": reason})
+}
+
+func emitStopped(code int) {
+	log.Event("stopped", map[string]any{"code": code})
+}
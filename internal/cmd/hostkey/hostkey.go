@@ -0,0 +1,75 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package hostkey
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"us.figge.auto-ssh/internal/cmd"
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/resources/engine/host"
+)
+
+var (
+	knownHostsFile string
+)
+
+var hostkeyCmd = &cobra.Command{
+	Use:   "hostkey",
+	Short: "Manages the known_hosts entries of configured hosts",
+	Run: func(cmd *cobra.Command, args []string) {
+		_ = cmd.Help()
+	},
+}
+
+func init() {
+	cmd.RootCmd.AddCommand(hostkeyCmd)
+}
+
+func knownHostsFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&knownHostsFile, "known-hosts", "k", "", "known_hosts file to update. Defaults to the host's knownHosts")
+}
+
+func lookupHost(cmd *cobra.Command, ref string) (*host.Engine, *host.Entry, error) {
+	engine := host.NewEngine(cmd.Context(), config.C.Hosts)
+	entry, ok := engine.Lookup(ref)
+	if !ok {
+		return nil, nil, fmt.Errorf("host (%s) undefined", ref)
+	}
+	return engine, entry, nil
+}
+
+func hostKeyManager(engine *host.Engine, entry *host.Entry) (*host.HostKeyManager, error) {
+	file := knownHostsFile
+	if file == "" {
+		file = entry.KnownHosts()
+	}
+	if file == "" {
+		return nil, fmt.Errorf("host (%s) has no known_hosts file. See --known-hosts", entry.Name())
+	}
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		if err = os.WriteFile(file, nil, 0600); err != nil {
+			return nil, err
+		}
+	}
+	return engine.HostKeyManager(file)
+}
+
+func printKeys(entry *host.Entry, keys []ssh.PublicKey) {
+	fmt.Printf("Host keys presented by %s (%s):\n", entry.Name(), entry.Remote().String())
+	for _, key := range keys {
+		fmt.Printf("  %-20s %s\n", key.Type(), ssh.FingerprintSHA256(key))
+	}
+}
+
+func exitOnError(err error) {
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+}
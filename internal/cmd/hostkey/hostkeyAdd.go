@@ -0,0 +1,55 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package hostkey
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"us.figge.auto-ssh/internal/core/flag"
+	"us.figge.auto-ssh/internal/core/utils"
+)
+
+var hostkeyAddCmd = &cobra.Command{
+	Use:   "add <host>",
+	Short: "Scans a host and adds its keys to the known_hosts file after confirmation",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		exitOnError(add(cmd, args[0]))
+	},
+}
+
+func init() {
+	hostkeyCmd.AddCommand(hostkeyAddCmd)
+	flag.AddFlags(hostkeyAddCmd, flag.Core, flag.Force, knownHostsFlag)
+}
+
+func add(cmd *cobra.Command, ref string) error {
+	engine, entry, err := lookupHost(cmd, ref)
+	if err != nil {
+		return err
+	}
+	hkManager, err := hostKeyManager(engine, entry)
+	if err != nil {
+		return err
+	}
+	keys, err := entry.ScanHostKeys()
+	if err != nil {
+		return err
+	}
+	printKeys(entry, keys)
+	answer, ok := utils.Ask("Add these keys to the known_hosts file (yes/no)? ", false, true)
+	if !ok || !strings.EqualFold(answer, "yes") {
+		fmt.Printf("No keys added\n")
+		return nil
+	}
+	for _, key := range keys {
+		if err = hkManager.Add(entry.Remote().String(), key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
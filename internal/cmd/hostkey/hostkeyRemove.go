@@ -0,0 +1,43 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package hostkey
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"us.figge.auto-ssh/internal/core/flag"
+)
+
+var hostkeyRemoveCmd = &cobra.Command{
+	Use:   "remove <host>",
+	Short: "Removes all keys for a host from the known_hosts file",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		exitOnError(remove(cmd, args[0]))
+	},
+}
+
+func init() {
+	hostkeyCmd.AddCommand(hostkeyRemoveCmd)
+	flag.AddFlags(hostkeyRemoveCmd, flag.Core, knownHostsFlag)
+}
+
+func remove(cmd *cobra.Command, ref string) error {
+	engine, entry, err := lookupHost(cmd, ref)
+	if err != nil {
+		return err
+	}
+	hkManager, err := hostKeyManager(engine, entry)
+	if err != nil {
+		return err
+	}
+	removed, err := hkManager.Remove(entry.Remote().String())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Removed %d known_hosts entries for %s\n", removed, entry.Remote().String())
+	return nil
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package hostkey
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"us.figge.auto-ssh/internal/core/flag"
+	"us.figge.auto-ssh/internal/core/utils"
+)
+
+var hostkeyReplaceCmd = &cobra.Command{
+	Use:   "replace <host>",
+	Short: "Replaces the known_hosts keys of a host whose keys have changed, after confirmation",
+	Long: `Scans a host and shows how the keys it presents differ from those in the known_hosts
+file. Once confirmed, the host's entries are removed and the presented keys added.
+Only replace keys whose change has been verified with the host's administrator`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		exitOnError(replace(cmd, args[0]))
+	},
+}
+
+func init() {
+	hostkeyCmd.AddCommand(hostkeyReplaceCmd)
+	flag.AddFlags(hostkeyReplaceCmd, flag.Core, flag.Force, knownHostsFlag)
+}
+
+func replace(cmd *cobra.Command, ref string) error {
+	engine, entry, err := lookupHost(cmd, ref)
+	if err != nil {
+		return err
+	}
+	hkManager, err := hostKeyManager(engine, entry)
+	if err != nil {
+		return err
+	}
+	keys, err := entry.ScanHostKeys()
+	if err != nil {
+		return err
+	}
+	known := make(map[string]string)
+	for _, k := range hkManager.Known(entry.Remote().String()) {
+		known[k.Type] = fmt.Sprintf("%s (line %d)", k.Fingerprint, k.Line)
+	}
+
+	changed := false
+	fmt.Printf("Host keys of %s (%s):\n", entry.Name(), entry.Remote().String())
+	for _, key := range keys {
+		fingerprint := ssh.FingerprintSHA256(key)
+		knownKey, ok := known[key.Type()]
+		delete(known, key.Type())
+		switch {
+		case !ok:
+			changed = true
+			fmt.Printf("  %-20s new       %s\n", key.Type(), fingerprint)
+		case strings.HasPrefix(knownKey, fingerprint+" "):
+			fmt.Printf("  %-20s unchanged %s\n", key.Type(), fingerprint)
+		default:
+			changed = true
+			fmt.Printf("  %-20s known     %s\n", key.Type(), knownKey)
+			fmt.Printf("  %-20s presented %s\n", "", fingerprint)
+		}
+	}
+	for keyType, knownKey := range known {
+		changed = true
+		fmt.Printf("  %-20s removed   %s\n", keyType, knownKey)
+	}
+	if !changed {
+		fmt.Printf("The known_hosts keys of %s are up to date\n", entry.Name())
+		return nil
+	}
+
+	answer, ok := utils.Ask("Replace the known_hosts keys with those presented (yes/no)? ", false, true)
+	if !ok || !strings.EqualFold(answer, "yes") {
+		fmt.Printf("No keys replaced\n")
+		return nil
+	}
+	if _, err = hkManager.Remove(entry.Remote().String()); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err = hkManager.Add(entry.Remote().String(), key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
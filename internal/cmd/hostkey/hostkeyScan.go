@@ -0,0 +1,37 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package hostkey
+
+import (
+	"github.com/spf13/cobra"
+	"us.figge.auto-ssh/internal/core/flag"
+)
+
+var hostkeyScanCmd = &cobra.Command{
+	Use:   "scan <host>",
+	Short: "Displays the fingerprints of the keys presented by a host",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		exitOnError(scan(cmd, args[0]))
+	},
+}
+
+func init() {
+	hostkeyCmd.AddCommand(hostkeyScanCmd)
+	flag.AddFlags(hostkeyScanCmd, flag.Core)
+}
+
+func scan(cmd *cobra.Command, ref string) error {
+	_, entry, err := lookupHost(cmd, ref)
+	if err != nil {
+		return err
+	}
+	keys, err := entry.ScanHostKeys()
+	if err != nil {
+		return err
+	}
+	printKeys(entry, keys)
+	return nil
+}
@@ -0,0 +1,52 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package importer
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/spf13/cobra"
+	"us.figge.auto-ssh/internal/core/flag"
+	"us.figge.auto-ssh/internal/core/putty"
+)
+
+var importPuttyCmd = &cobra.Command{
+	Use:   "putty [session]...",
+	Short: "Converts PuTTY saved sessions, all by default, into hosts and tunnels",
+	Run: func(cmd *cobra.Command, args []string) {
+		err := importPutty(args)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	importCmd.AddCommand(importPuttyCmd)
+	flag.AddFlags(importPuttyCmd, flag.Verbose, outputFlag)
+}
+
+func importPutty(names []string) error {
+	sessions, err := putty.Sessions()
+	if err != nil {
+		return err
+	}
+	if len(names) > 0 {
+		sessions = slices.DeleteFunc(sessions, func(session *putty.Session) bool {
+			return !slices.Contains(names, session.Name)
+		})
+	}
+	if len(sessions) == 0 {
+		return fmt.Errorf("no PuTTY sessions found")
+	}
+	hosts, tunnels, warnings := putty.Convert(sessions)
+	for _, warning := range warnings {
+		_, _ = fmt.Fprintf(os.Stderr, "  Warn  - %s\n", warning)
+	}
+	return writeConfig(hosts, tunnels)
+}
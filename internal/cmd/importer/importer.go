@@ -0,0 +1,53 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package importer
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+	"us.figge.auto-ssh/internal/cmd"
+	"us.figge.auto-ssh/internal/core/config"
+)
+
+var (
+	outputFile string
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Converts the saved sessions of other ssh clients into auto-ssh configuration",
+	Run: func(cmd *cobra.Command, args []string) {
+		_ = cmd.Help()
+	},
+}
+
+func init() {
+	cmd.RootCmd.AddCommand(importCmd)
+}
+
+func outputFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&outputFile, "output", "o", "", "file to write the converted configuration to. Defaults to stdout")
+}
+
+// writeConfig emits the converted hosts and tunnels as yaml, suitable for
+// merging into an existing configuration file
+func writeConfig(hosts []*config.Host, tunnels []*config.Tunnel) error {
+	bs, err := yaml.Marshal(&config.Configuration{Hosts: hosts, Tunnels: tunnels})
+	if err != nil {
+		return err
+	}
+	if outputFile == "" {
+		fmt.Print(string(bs))
+		return nil
+	}
+	if err = os.WriteFile(outputFile, bs, 0600); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %d hosts and %d tunnels to %s\n", len(hosts), len(tunnels), outputFile)
+	return nil
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package cmd
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/log"
+	"us.figge.auto-ssh/internal/core/sdnotify"
+	"us.figge.auto-ssh/internal/resources/engine/leader"
+)
+
+// leadershipLost is set once the leader lock was lost, auto-ssh then exiting
+// with an error for its service manager to restart it standing by
+var leadershipLost atomic.Bool
+
+// lead stands by until this instance holds the leader lock, when configured,
+// reporting false should auto-ssh be stopped first.  Losing the lock stops
+// every tunnel, as a standby is free to start them
+func lead() bool {
+	if config.C.Leader == nil {
+		return true
+	}
+	// Started, as far as systemd is concerned, though standing by
+	notify(sdnotify.Ready, sdnotify.Status("standing by"))
+	standby, stopStandby := context.WithCancel(ctx)
+	go standbyHeartbeats(standby)
+	defer stopStandby()
+	return leader.NewEngine(config.C.Leader).Lead(ctx, wg, func() {
+		log.Printf("  Error - no longer leading. Stopping tunnels\n")
+		emitStopping("leadership lost")
+		leadershipLost.Store(true)
+		server.Shutdown()
+		cancel()
+	})
+}
+
+// standbyHeartbeats keeps systemd's watchdog content while standing by, there
+// being no tunnels yet for notifyWatchdog to judge health by
+func standbyHeartbeats(ctx context.Context) {
+	interval := sdnotify.WatchdogInterval()
+	if interval == 0 {
+		return
+	}
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			notify(sdnotify.Watchdog)
+		}
+	}
+}
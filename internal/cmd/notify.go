@@ -0,0 +1,88 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/log"
+	"us.figge.auto-ssh/internal/core/sdnotify"
+	"us.figge.auto-ssh/internal/managers"
+	managerModels "us.figge.auto-ssh/internal/rest/models"
+)
+
+// notify tells systemd the states, when it started auto-ssh
+func notify(states ...string) {
+	if err := sdnotify.Notify(states...); err != nil {
+		log.Printf("  Warn  - systemd cannot be notified: %v\n", err)
+	}
+}
+
+// notifyWatchdog sends systemd's watchdog a heartbeat at half its interval for
+// as long as auto-ssh is healthy, as /healthz judges it.  Heartbeats stop while
+// required tunnels, or their hosts with health.hosts set, are down past the
+// health grace, or should the engines stop answering, so systemd restarts it
+func notifyWatchdog(ctx context.Context) {
+	interval := sdnotify.WatchdogInterval()
+	if interval == 0 {
+		return
+	}
+	health, err := managers.NewHealthManager(ctx, config.C.Health, hostEngine, tunnelEngine)
+	if err != nil {
+		log.Printf("  Error - systemd watchdog cannot check health: %v\n", err)
+		return
+	}
+	log.Printf("  Info  - systemd watchdog expects a heartbeat every %v\n", interval)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval / 2)
+		defer ticker.Stop()
+		unhealthy := ""
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			output, err := health.GetHealth(ctx)
+			reason := unhealthyReason(output, err)
+			switch {
+			case reason == "":
+				if unhealthy != "" {
+					log.Printf("  Info  - healthy again, resuming systemd watchdog heartbeats\n")
+					notify(sdnotify.Watchdog, sdnotify.Status("tunnels ready"))
+				} else {
+					notify(sdnotify.Watchdog)
+				}
+			case reason != unhealthy:
+				log.Printf("  Warn  - unhealthy, withholding systemd watchdog heartbeats: %s\n", reason)
+				notify(sdnotify.Status("unhealthy: " + reason))
+			}
+			unhealthy = reason
+		}
+	}()
+}
+
+// unhealthyReason lists the failed health checks, or is blank when healthy
+func unhealthyReason(output *managerModels.GetHealthOutput, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	if output.Ok {
+		return ""
+	}
+	var reasons []string
+	for _, check := range output.Checks {
+		if !check.Ok {
+			reasons = append(reasons, fmt.Sprintf("tunnel (%s) %s", check.Name, check.Reason))
+		}
+	}
+	return strings.Join(reasons, ", ")
+}
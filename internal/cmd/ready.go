@@ -0,0 +1,67 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/log"
+	"us.figge.auto-ssh/internal/core/sdnotify"
+)
+
+const readyPoll = 250 * time.Millisecond
+
+// signalReady waits for every tunnel that should be running to have its
+// entrance open and its host connected, then writes the env file, ready file
+// and ready fd, tells systemd and emits the ready event, so whatever started auto-ssh can carry on
+// without guessing how long to sleep
+func signalReady(ctx context.Context) {
+	if config.ReadyFileFlag == "" && config.ReadyFdFlag == 0 && config.EnvFileFlag == "" && config.OutputFlag != config.OutputJSON && !sdnotify.Enabled() {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(readyPoll)
+		defer ticker.Stop()
+		for !tunnelEngine.Ready() {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+		log.Printf("  Info  - tunnels ready\n")
+		emitReady()
+		writeEnvFile()
+		if config.ReadyFileFlag != "" {
+			pid := fmt.Sprintf("%d\n", os.Getpid())
+			if err := os.WriteFile(config.ReadyFileFlag, []byte(pid), 0644); err != nil {
+				log.Printf("  Error - ready file (%s) cannot be written: %v\n", config.ReadyFileFlag, err)
+			}
+		}
+		if config.ReadyFdFlag != 0 {
+			f := os.NewFile(uintptr(config.ReadyFdFlag), "ready-fd")
+			if _, err := f.WriteString("READY\n"); err != nil {
+				log.Printf("  Error - ready fd (%d) cannot be written: %v\n", config.ReadyFdFlag, err)
+			}
+			_ = f.Close()
+		}
+		notify(sdnotify.Ready, sdnotify.Status("tunnels ready"))
+	}()
+}
+
+// removeReadyFile withdraws the ready file as auto-ssh exits
+func removeReadyFile() {
+	if config.ReadyFileFlag == "" {
+		return
+	}
+	if err := os.Remove(config.ReadyFileFlag); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("  Warn  - ready file (%s) cannot be removed: %v\n", config.ReadyFileFlag, err)
+	}
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package recording
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"us.figge.auto-ssh/internal/cmd"
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/flag"
+	"us.figge.auto-ssh/internal/core/recording"
+)
+
+var recordingCmd = &cobra.Command{
+	Use:   "recording",
+	Short: "Checks the recordings of sessions on hosts",
+	Run: func(cmd *cobra.Command, args []string) {
+		_ = cmd.Help()
+	},
+}
+
+var recordingVerifyCmd = &cobra.Command{
+	Use:   "verify <host>",
+	Short: "Verifies the recordings of a host have not been altered",
+	Long: `Verifies the recordings of sessions on a host, given by id or name, against the
+chain of hashes in its recording directory's recordings.log.  Recordings altered
+or removed since they were closed, and entries removed from or edited in the
+log, are reported and exit with a non-zero status.  Recordings not in the log
+are still being recorded, were cut short, or were added since`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := verify(args[0]); err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	cmd.RootCmd.AddCommand(recordingCmd)
+	recordingCmd.AddCommand(recordingVerifyCmd)
+	flag.AddFlags(recordingVerifyCmd, flag.Core)
+}
+
+func verify(ref string) error {
+	var found *config.Host
+	for _, h := range config.C.Hosts {
+		if h.Id == ref || h.Name == ref {
+			found = h
+			break
+		}
+	}
+	if found == nil {
+		return fmt.Errorf("host (%s) undefined", ref)
+	}
+	if found.Recording == nil {
+		return fmt.Errorf("host (%s) has no recording directory", found.Name)
+	}
+	results, err := recording.Verify(found.Recording.Directory)
+	if err != nil {
+		return fmt.Errorf("recordings of host (%s) cannot be verified: %w", found.Name, err)
+	}
+	if len(results) == 0 {
+		fmt.Printf("host (%s) has no recordings\n", found.Name)
+		return nil
+	}
+	failed := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(w, "RECORDING\tCLOSED\tSTATUS\n")
+	for _, r := range results {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", r.Name, r.Closed, r.Status)
+		if r.Status != recording.Verified && r.Status != recording.Unlogged {
+			failed++
+		}
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d recordings failed verification", failed, len(results))
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/log"
+)
+
+var (
+	configEtag string
+	// configRest fingerprints everything but the hosts and tunnels, which are
+	// the only sections applied without a restart
+	configRest string
+)
+
+func loadRemoteConfig() error {
+	config.C = config.NewConfig()
+	_, _ = fmt.Fprintf(os.Stderr, "Loading config from %s\n", config.FileName)
+	bs, etag, err := config.ReadRemote(context.Background(), config.FileName, "")
+	if err != nil {
+		return err
+	}
+	if err = yaml.Unmarshal(bs, config.C); err != nil {
+		return err
+	}
+	configEtag, configRest = etag, restFingerprint(config.C)
+	return nil
+}
+
+// watchRemoteConfig polls the remote configuration, applying the hosts and
+// tunnels whenever its ETag changes
+func watchRemoteConfig(ctx context.Context) {
+	interval := config.PollFlag
+	if interval <= 0 {
+		interval = config.DefaultPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		bs, etag, err := config.ReadRemote(ctx, config.FileName, configEtag)
+		if errors.Is(err, config.ErrNotModified) || ctx.Err() != nil {
+			continue
+		}
+		if err != nil {
+			log.Printf("  Warn  - remote configuration cannot be fetched: %v\n", err)
+			continue
+		}
+		cfg := config.NewConfig()
+		if err = yaml.Unmarshal(bs, cfg); err == nil {
+			err = config.ApplyEnv(cfg, os.Environ())
+		}
+		if err != nil {
+			log.Printf("  Error - remote configuration cannot be parsed, keeping the current configuration: %v\n", err)
+			configEtag = etag
+			continue
+		}
+		cfg.Redact()
+		log.Printf("  Info  - remote configuration changed. Applying\n")
+		if rest := restFingerprint(cfg); rest != configRest {
+			log.Printf("  Warn  - remote configuration changes outside of hosts and tunnels need a restart to apply\n")
+			configRest = rest
+		}
+		replaced := hostEngine.Apply(cfg.Hosts)
+		tunnelEngine.Apply(hostEngine, cfg.Tunnels, replaced)
+		writeEnvFile()
+		config.C.Hosts, config.C.Tunnels = cfg.Hosts, cfg.Tunnels
+		configEtag = etag
+	}
+}
+
+func restFingerprint(cfg *config.Configuration) string {
+	rest := *cfg
+	rest.Hosts, rest.Tunnels = nil, nil
+	return config.Fingerprint(&rest)
+}
@@ -16,10 +16,22 @@ import (
 
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v3"
+	"us.figge.auto-ssh/internal/core/audit"
 	"us.figge.auto-ssh/internal/core/config"
 	"us.figge.auto-ssh/internal/core/flag"
+	"us.figge.auto-ssh/internal/core/geoip"
+	"us.figge.auto-ssh/internal/core/journal"
+	"us.figge.auto-ssh/internal/core/killswitch"
+	"us.figge.auto-ssh/internal/core/log"
+	"us.figge.auto-ssh/internal/core/pkcs11"
+	"us.figge.auto-ssh/internal/core/sdnotify"
+	"us.figge.auto-ssh/internal/core/traffic"
 	"us.figge.auto-ssh/internal/resources/engine/host"
+	"us.figge.auto-ssh/internal/resources/engine/probe"
+	"us.figge.auto-ssh/internal/resources/engine/registry"
+	"us.figge.auto-ssh/internal/resources/engine/schedule"
 	engineStats "us.figge.auto-ssh/internal/resources/engine/stats"
+	"us.figge.auto-ssh/internal/resources/engine/statsd"
 	engineTunnel "us.figge.auto-ssh/internal/resources/engine/tunnel"
 	engineModels "us.figge.auto-ssh/internal/resources/models"
 	"us.figge.auto-ssh/internal/rest"
@@ -43,9 +55,12 @@ var RootCmd = &cobra.Command{
 	Short: "auto-ssh command line interface",
 	Long:  `A command line for establishing and managing automatic ssh tunneling`,
 	Run: func(cmd *cobra.Command, args []string) {
+		startLogging()
+		emitStarting()
+		receiveUpgrade()
 		startEngines()
 		startServer()
-		startApplication()
+		startApplication(args)
 	},
 }
 
@@ -57,15 +72,20 @@ func Execute() {
 }
 
 func init() {
-	cobra.OnInitialize(initContext, initConfig)
-	flag.AddFlags(RootCmd, rest.Flags, flag.Core)
+	cobra.OnInitialize(initContext, initConsole, initConfig)
+	flag.AddFlags(RootCmd, rest.Flags, rest.ServerFlags, flag.Core, flag.Bind, flag.Takeover, flag.Upgrade, flag.FailFast, flag.Ready, flag.EnvFile, flag.Poll, flag.PKCS11, flag.Quiet, flag.Output)
 }
 
 func initConfig() {
-	if err := initConfigE(); err != nil {
+	err := initConfigE()
+	if err == nil {
+		err = config.ApplyEnv(config.C, os.Environ())
+	}
+	if err != nil {
 		fmt.Printf("Failed to initialize configuration: %v\n", err)
 		os.Exit(1)
 	}
+	config.C.Redact()
 }
 func initConfigE() error {
 	// Locate the configuration file, if one was provided, or search for one
@@ -74,7 +94,13 @@ func initConfigE() error {
 	var err error
 	var paths []string
 
+	if config.IsRemote(config.FileName) {
+		return loadRemoteConfig()
+	}
 	if config.FileName != "" {
+		if fi, statErr := os.Stat(config.FileName); statErr == nil && !fi.IsDir() {
+			return loadConfig(config.FileName)
+		}
 		paths = append(paths, config.FileName)
 	} else {
 		var pwd, home string
@@ -99,23 +125,87 @@ func initConfigE() error {
 	config.C = config.NewConfig()
 	for _, path := range paths {
 		for _, filename := range configFilenames {
-			config.FileName = filepath.Join(path, filename)
-			bs, err = os.ReadFile(config.FileName)
+			bs, err = os.ReadFile(filepath.Join(path, filename))
 			if err == nil && len(bs) > 0 {
-				fmt.Printf("Loading config from %s\n", config.FileName)
-				err = yaml.Unmarshal(bs, config.C)
-				return err
+				return loadConfig(filepath.Join(path, filename))
 			}
 		}
 	}
-	fmt.Printf("No config file found.  Setting defaults")
+	if !config.QuietFlag {
+		_, _ = fmt.Fprintf(os.Stderr, "No config file found.  Setting defaults\n")
+	}
 	return nil
 }
 
+func loadConfig(filename string) error {
+	config.FileName = filename
+	config.C = config.NewConfig()
+	// Written to stderr so json output from commands remains parsable
+	if !config.QuietFlag {
+		_, _ = fmt.Fprintf(os.Stderr, "Loading config from %s\n", config.FileName)
+	}
+	// Configurations hold passphrases and secrets, so are kept as private as identities
+	if !config.CheckPermissions("config file", filename, config.PrivatePerms) {
+		return fmt.Errorf("config file (%s) can be accessed by others", filename)
+	}
+	bs, err := config.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(bs, config.C)
+}
+
 func initContext() {
 	ctx, cancel = context.WithCancel(context.Background())
 }
 
+func startLogging() {
+	if err := startLoggingE(); err != nil {
+		fmt.Printf("failed to start logging: %v\n", err)
+		os.Exit(1)
+	}
+	if config.QuietFlag {
+		log.SetStdoutLevel(log.LevelError)
+	}
+}
+func startLoggingE() error {
+	log.Start(ctx)
+	logging := config.C.Logging
+	if logging == nil {
+		return nil
+	}
+	level, err := log.ParseLevel(logging.Level)
+	if err != nil {
+		return err
+	}
+	log.SetStdoutLevel(level)
+	for _, s := range logging.Syslog {
+		if level, err = log.ParseLevel(s.Level); err != nil {
+			return err
+		}
+		sink, err := log.NewSyslogSink(s.Address, s.Facility, s.Tag)
+		if err != nil {
+			return err
+		}
+		name := s.Address
+		if name == "" {
+			name = "local syslog"
+		}
+		log.AddSink(name, sink, level)
+	}
+	if logging.Journald != nil {
+		if level, err = log.ParseLevel(logging.Journald.Level); err != nil {
+			return err
+		}
+		sink, err := log.NewJournaldSink(logging.Journald.Identifier)
+		if err != nil {
+			return err
+		}
+		log.AddSink("journald", sink, level)
+	}
+	return nil
+}
+
 func startEngines() {
 	if err := startEnginesE(); err != nil {
 		fmt.Printf("failed to start engines: %v\n", err)
@@ -123,6 +213,41 @@ func startEngines() {
 	}
 }
 func startEnginesE() error {
+	if config.C.Audit != nil {
+		if err := audit.Open(config.C.Audit.File); err != nil {
+			return err
+		}
+	}
+	if !config.C.Registry.Validate() {
+		return fmt.Errorf("invalid registry configuration")
+	}
+	if !config.C.Leader.Validate() {
+		return fmt.Errorf("invalid leader configuration")
+	}
+	if !config.C.Probe.Validate() {
+		return fmt.Errorf("invalid probe configuration")
+	}
+	if !config.C.StatsD.Validate() {
+		return fmt.Errorf("invalid statsd configuration")
+	}
+	if !config.C.Health.Validate() {
+		return fmt.Errorf("invalid health configuration")
+	}
+	if !config.C.Traffic.Validate() {
+		return fmt.Errorf("invalid traffic configuration")
+	}
+	if !config.C.Tor.Validate() {
+		return fmt.Errorf("invalid tor configuration")
+	}
+	if err := traffic.Open(config.C.Traffic.FileOrBlank(), config.C.Traffic.FlushOrDefault()); err != nil {
+		return err
+	}
+	if err := journal.Open(config.C.Journal.FileOrBlank()); err != nil {
+		return err
+	}
+	if err := geoip.Open(config.C.GeoIP.CountryOrBlank(), config.C.GeoIP.ASNOrBlank()); err != nil {
+		return err
+	}
 	hostEngine = host.NewEngine(ctx, config.C.Hosts)
 	tunnelEngine = engineTunnel.NewEngine(ctx, hostEngine, config.C.Tunnels)
 	statsEngine = engineStats.NewEngine()
@@ -137,26 +262,73 @@ func startServer() {
 }
 func startServerE() error {
 	var err error
-	server, err = rest.NewServer(ctx, config.C.Web, hostEngine, tunnelEngine, wg)
+	server, err = rest.NewServer(ctx, config.C.Web, config.C.Health, hostEngine, tunnelEngine, wg)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func startApplication() {
+// startApplication runs until signalled or, given a command, until the command
+// run once the tunnels are ready exits
+func startApplication(args []string) {
 	err := statsEngine.StartStatsTunnel(ctx, config.C.Monitor.StatsPort)
 	if err != nil {
 		return
 	}
+	if !lead() {
+		server.Shutdown()
+		shutdown(0)
+		return
+	}
 	tunnelEngine.StartTunnels(ctx, statsEngine, wg)
+	if err = tunnelEngine.CheckRequired(); err != nil {
+		log.Printf("  Error - %v. Exiting\n", err)
+		emitStopping(err.Error())
+		server.Shutdown()
+		cancel()
+		emitStopped(1)
+		log.CloseSinks()
+		os.Exit(1)
+	}
+	signalReady(ctx)
+	notifyWatchdog(ctx)
+	if len(args) == 0 {
+		readyUpgrade(ctx)
+	}
+	registry.NewEngine(config.C.Registry, tunnelEngine).Start(ctx, wg)
+	probe.NewEngine(config.C.Probe, hostEngine, tunnelEngine).Start(ctx, wg)
+	statsd.NewEngine(config.C.StatsD, tunnelEngine).Start(ctx, wg)
+	schedule.NewEngine(tunnelEngine).Start(ctx, wg)
+	if config.IsRemote(config.FileName) {
+		go watchRemoteConfig(ctx)
+	}
+
+	killswitch.OnPull(tunnelEngine.Kill)
+	killswitch.OnPull(hostEngine.Kill)
+	killswitch.OnPull(pkcs11.Close)
+	killswitch.OnPull(server.Shutdown)
+	killswitch.OnPull(audit.Close)
+	killswitch.OnPull(traffic.Close)
+
+	if len(args) > 0 {
+		code := runChild(args)
+		emitStopping(fmt.Sprintf("command (%s) exited with %d", args[0], code))
+		server.Shutdown()
+		cancel()
+		wg.Wait()
+		shutdown(code)
+		os.Exit(code)
+	}
 
 	go func() {
 		// Pressing Ctrl+C signals all threads to end. This in turn causes the below wg.Wait() to end
 		sigChan := make(chan os.Signal, 1)
 		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-		<-sigChan
-		fmt.Printf("\nsystem-service: received signal. Shutting down\n")
+		sig := <-sigChan
+		log.Printf("  Info  - received %v. Shutting down\n", sig)
+		emitStopping(sig.String())
+		notify(sdnotify.Stopping)
 		server.Shutdown()
 		cancel()
 	}()
@@ -164,4 +336,24 @@ func startApplication() {
 	wg.Wait()
 	server.Shutdown()
 	cancel()
+	code := 0
+	if leadershipLost.Load() {
+		code = 1
+	}
+	shutdown(code)
+	if code != 0 {
+		os.Exit(code)
+	}
+}
+
+func shutdown(code int) {
+	if !handedOver.Load() {
+		// Otherwise now the upgraded instance's
+		removeReadyFile()
+		removeEnvFile()
+	}
+	audit.Close()
+	traffic.Close()
+	emitStopped(code)
+	log.CloseSinks()
 }
@@ -0,0 +1,28 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"us.figge.auto-ssh/internal/core/flag"
+	"us.figge.auto-ssh/internal/rest"
+)
+
+var runCmd = &cobra.Command{
+	Use:   "run [-- <command>...]",
+	Short: "Starts the configured tunnels and the auto-ssh API server",
+	Long: `Starts the configured tunnels and the auto-ssh API server. Running ash without a command is equivalent.
+Given a command, it is run once the tunnels are ready, with each tunnel's entrance in
+AUTOSSH_TUNNEL_<NAME>_ADDR, _HOST and _PORT, and auto-ssh exits with its exit code
+once it finishes`,
+	Example: `  ash run -- go test ./integration/...
+  ash run -- sh -c 'psql -h $AUTOSSH_TUNNEL_DB_HOST -p $AUTOSSH_TUNNEL_DB_PORT'`,
+	Run: RootCmd.Run,
+}
+
+func init() {
+	RootCmd.AddCommand(runCmd)
+	flag.AddFlags(runCmd, rest.Flags, rest.ServerFlags, flag.Core, flag.Bind, flag.Takeover, flag.Upgrade, flag.FailFast, flag.Ready, flag.EnvFile, flag.Poll, flag.PKCS11, flag.Quiet, flag.Output)
+}
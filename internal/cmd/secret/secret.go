@@ -0,0 +1,67 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package secret
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"us.figge.auto-ssh/internal/cmd"
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/keychain"
+)
+
+var (
+	passwordFlag bool
+	otpFlag      bool
+)
+
+var secretCmd = &cobra.Command{
+	Use:   "secret",
+	Short: "Manages host passphrases, passwords and TOTP secrets held in the OS keychain",
+	Long: `Manages host passphrases, passwords and TOTP secrets held in the OS keychain
+(macOS Keychain, Windows Credential Manager or the Linux Secret Service). Secrets
+are used by hosts configured with keychain: true`,
+	Run: func(cmd *cobra.Command, args []string) {
+		_ = cmd.Help()
+	},
+}
+
+func init() {
+	cmd.RootCmd.AddCommand(secretCmd)
+}
+
+func kindFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&passwordFlag, "password", false, "the secret is the host password rather than the identity passphrase")
+	cmd.Flags().BoolVar(&otpFlag, "otp", false, "the secret is the TOTP secret answering the host's one-time password prompts")
+	cmd.MarkFlagsMutuallyExclusive("password", "otp")
+}
+
+// account resolves the host, by id or name, to its keychain account
+func account(ref string) (string, error) {
+	kind := keychain.KindPassphrase
+	if passwordFlag {
+		kind = keychain.KindPassword
+	} else if otpFlag {
+		kind = keychain.KindOTP
+	}
+	for _, host := range config.C.Hosts {
+		if host.Id == ref || host.Name == ref {
+			if !host.Keychain {
+				_, _ = fmt.Fprintf(os.Stderr, "  Warn  - host (%s) does not set keychain: true\n", host.Name)
+			}
+			return keychain.Account(host.Name, kind), nil
+		}
+	}
+	return "", fmt.Errorf("host (%s) undefined", ref)
+}
+
+func exitOnError(err error) {
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+}
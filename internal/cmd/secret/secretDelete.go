@@ -0,0 +1,39 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package secret
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"us.figge.auto-ssh/internal/core/flag"
+	"us.figge.auto-ssh/internal/core/keychain"
+)
+
+var secretDeleteCmd = &cobra.Command{
+	Use:   "delete <host>",
+	Short: "Removes a host secret from the OS keychain",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		exitOnError(remove(args[0]))
+	},
+}
+
+func init() {
+	secretCmd.AddCommand(secretDeleteCmd)
+	flag.AddFlags(secretDeleteCmd, flag.Config, kindFlag)
+}
+
+func remove(ref string) error {
+	acct, err := account(ref)
+	if err != nil {
+		return err
+	}
+	if err = keychain.Delete(acct); err != nil {
+		return err
+	}
+	fmt.Printf("Removed %s from the keychain\n", acct)
+	return nil
+}
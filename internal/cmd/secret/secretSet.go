@@ -0,0 +1,45 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package secret
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"us.figge.auto-ssh/internal/core/flag"
+	"us.figge.auto-ssh/internal/core/keychain"
+	"us.figge.auto-ssh/internal/core/utils"
+)
+
+var secretSetCmd = &cobra.Command{
+	Use:   "set <host>",
+	Short: "Prompts for and stores a host secret in the OS keychain",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		exitOnError(set(args[0]))
+	},
+}
+
+func init() {
+	secretCmd.AddCommand(secretSetCmd)
+	flag.AddFlags(secretSetCmd, flag.Config, kindFlag)
+}
+
+func set(ref string) error {
+	acct, err := account(ref)
+	if err != nil {
+		return err
+	}
+	secret, ok := utils.Askf("Enter %s: ", true, true, acct)
+	fmt.Println()
+	if !ok {
+		return fmt.Errorf("no secret entered")
+	}
+	if err = keychain.Set(acct, secret); err != nil {
+		return err
+	}
+	fmt.Printf("Stored %s in the keychain\n", acct)
+	return nil
+}
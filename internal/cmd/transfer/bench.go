@@ -0,0 +1,224 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package transfer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"us.figge.auto-ssh/internal/cmd"
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/flag"
+)
+
+const (
+	mebibyte = 1024 * 1024
+)
+
+var (
+	benchSize   int
+	benchBuffer int
+	benchPings  int
+	benchCipher string
+)
+
+var benchCmd = &cobra.Command{
+	Use:   "bench <tunnel>",
+	Short: "Measures the throughput and latency of a tunnel's host connection",
+	Long: `Pushes and pulls data over the ssh connection a tunnel, given by id or name,
+forwards through, reached with its host's settings and jump hosts. Throughput in each
+direction, the round trip latency of the connection and the cpu used are reported,
+so runs with different buffer sizes, ciphers or host settings can be compared.
+The host must provide cat and head to send the data to and from`,
+	Example: `  ash bench db --size 256
+  ash bench db --cipher aes128-gcm@openssh.com --buffer 65536`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		exitOnError(bench(cmd, args[0]))
+	},
+}
+
+func init() {
+	cmd.RootCmd.AddCommand(benchCmd)
+	flag.AddFlags(benchCmd, flag.Core, flag.PKCS11)
+	benchCmd.Flags().IntVar(&benchSize, "size", 64, "mebibytes pushed and pulled")
+	benchCmd.Flags().IntVar(&benchBuffer, "buffer", 32*1024, "bytes written or read at a time")
+	benchCmd.Flags().IntVar(&benchPings, "pings", 20, "round trips timed for latency")
+	benchCmd.Flags().StringVar(&benchCipher, "cipher", "", "cipher used in place of the host's own")
+}
+
+// result is one measured transfer
+type result struct {
+	bytes   int64
+	elapsed time.Duration
+	cpu     time.Duration
+}
+
+func (r result) String() string {
+	seconds := r.elapsed.Seconds()
+	return fmt.Sprintf("%8.1f MiB in %7.2fs %9.1f MiB/s   cpu %3.0f%%",
+		float64(r.bytes)/mebibyte, seconds, float64(r.bytes)/mebibyte/seconds, 100*r.cpu.Seconds()/seconds)
+}
+
+func bench(cmd *cobra.Command, ref string) error {
+	if benchSize <= 0 || benchBuffer <= 0 || benchPings < 0 {
+		return errors.New("size and buffer must be positive, and pings cannot be negative")
+	}
+	tunnel := findTunnel(ref)
+	if tunnel == nil {
+		return fmt.Errorf("tunnel (%s) undefined", ref)
+	}
+	if tunnel.Host == "" {
+		return fmt.Errorf("tunnel (%s) has no host", ref)
+	}
+	if benchCipher != "" {
+		withCipher(tunnel.Host, benchCipher)
+	}
+
+	entry, client, release, err := connect(newEngine(cmd), tunnel.Host)
+	if err != nil {
+		return err
+	}
+	defer entry.Close()
+	defer release()
+
+	fmt.Printf("Benchmarking tunnel (%s) through host (%s)\n", tunnel.Name, entry.Name())
+	size := int64(benchSize) * mebibyte
+	r, err := measure(func() (int64, error) { return push(client, size) })
+	if err != nil {
+		return fmt.Errorf("push failed: %v", err)
+	}
+	fmt.Printf("  push    %s\n", r)
+	r, err = measure(func() (int64, error) { return pull(client, size) })
+	if err != nil {
+		return fmt.Errorf("pull failed: %v", err)
+	}
+	fmt.Printf("  pull    %s\n", r)
+	if benchPings > 0 {
+		rtts, err := ping(client, benchPings)
+		if err != nil {
+			return fmt.Errorf("latency failed: %v", err)
+		}
+		fmt.Printf("  latency p50 %v  p90 %v  p99 %v  max %v (%d round trips)\n",
+			percentile(rtts, 50), percentile(rtts, 90), percentile(rtts, 99), percentile(rtts, 100), len(rtts))
+	}
+	return nil
+}
+
+func findTunnel(ref string) *config.Tunnel {
+	for _, tunnel := range config.C.Tunnels {
+		if tunnel.Id == ref {
+			return tunnel
+		}
+	}
+	for _, tunnel := range config.C.Tunnels {
+		if tunnel.Name == ref {
+			return tunnel
+		}
+	}
+	return nil
+}
+
+// withCipher restricts the configured host to a single cipher before it connects
+func withCipher(ref string, cipher string) {
+	for _, host := range config.C.Hosts {
+		if host.Id == ref || host.Name == ref {
+			if host.Algorithms == nil {
+				host.Algorithms = &config.Algorithms{}
+			}
+			host.Algorithms.Ciphers = []string{cipher}
+		}
+	}
+}
+
+func measure(transfer func() (int64, error)) (result, error) {
+	cpuStart := cpuTime()
+	start := time.Now()
+	n, err := transfer()
+	return result{bytes: n, elapsed: time.Since(start), cpu: cpuTime() - cpuStart}, err
+}
+
+// push writes size bytes to a remote cat discarding them, returning once the
+// remote end has consumed them all
+func push(client *ssh.Client, size int64) (int64, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = session.Close() }()
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return 0, err
+	}
+	if err = session.Start("cat > /dev/null"); err != nil {
+		return 0, err
+	}
+	buf := make([]byte, benchBuffer)
+	var n int64
+	for n < size {
+		chunk := buf[:min(int64(len(buf)), size-n)]
+		written, err := stdin.Write(chunk)
+		n += int64(written)
+		if err != nil {
+			return n, err
+		}
+	}
+	_ = stdin.Close()
+	return n, session.Wait()
+}
+
+// pull reads size bytes produced by a remote head
+func pull(client *ssh.Client, size int64) (int64, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = session.Close() }()
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return 0, err
+	}
+	if err = session.Start(fmt.Sprintf("head -c %d /dev/zero", size)); err != nil {
+		return 0, err
+	}
+	n, err := io.CopyBuffer(io.Discard, stdout, make([]byte, benchBuffer))
+	if err != nil {
+		return n, err
+	}
+	if err = session.Wait(); err != nil {
+		return n, err
+	}
+	if n != size {
+		return n, fmt.Errorf("received %d of %d bytes", n, size)
+	}
+	return n, nil
+}
+
+// ping times keepalive requests on the connection, returning them sorted. A
+// server refusing the request still answers it, which is all that is needed
+func ping(client *ssh.Client, count int) ([]time.Duration, error) {
+	rtts := make([]time.Duration, 0, count)
+	for i := 0; i < count; i++ {
+		start := time.Now()
+		if _, _, err := client.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+			return nil, err
+		}
+		rtts = append(rtts, time.Since(start))
+	}
+	sort.Slice(rtts, func(i, j int) bool { return rtts[i] < rtts[j] })
+	return rtts, nil
+}
+
+// percentile returns the nearest rank percentile of sorted durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	return sorted[max(rank, 0)].Round(time.Microsecond)
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package transfer
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+var (
+	recursive bool
+)
+
+// upload copies a local file, or directory when recursive, to the remote path
+func upload(s *session, local string, remote string) error {
+	fi, err := os.Stat(local)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return put(s, local, remote, fi.Mode())
+	}
+	if !recursive {
+		return fmt.Errorf("%s is a directory (see -r)", local)
+	}
+	if err = s.MkdirAll(remote); err != nil {
+		return fmt.Errorf("%s: %v", remote, err)
+	}
+	entries, err := os.ReadDir(local)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err = upload(s, filepath.Join(local, entry.Name()), path.Join(remote, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func put(s *session, local string, remote string, mode os.FileMode) error {
+	src, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = src.Close() }()
+	dst, err := s.OpenFile(remote, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return fmt.Errorf("%s: %v", remote, err)
+	}
+	n, err := dst.ReadFrom(src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", remote, err)
+	}
+	_ = s.Chmod(remote, mode.Perm())
+	fmt.Printf("%s -> %s:%s (%d bytes)\n", local, s.entry.Name(), remote, n)
+	return nil
+}
+
+// download copies a remote file, or directory when recursive, to the local path
+func download(s *session, remote string, local string) error {
+	fi, err := s.Stat(remote)
+	if err != nil {
+		return fmt.Errorf("%s: %v", remote, err)
+	}
+	if !fi.IsDir() {
+		return get(s, remote, local, fi.Mode())
+	}
+	if !recursive {
+		return fmt.Errorf("%s is a directory (see -r)", remote)
+	}
+	if err = os.MkdirAll(local, 0755); err != nil {
+		return err
+	}
+	entries, err := s.ReadDir(remote)
+	if err != nil {
+		return fmt.Errorf("%s: %v", remote, err)
+	}
+	for _, entry := range entries {
+		if err = download(s, path.Join(remote, entry.Name()), filepath.Join(local, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func get(s *session, remote string, local string, mode os.FileMode) error {
+	src, err := s.Open(remote)
+	if err != nil {
+		return fmt.Errorf("%s: %v", remote, err)
+	}
+	defer func() { _ = src.Close() }()
+	dst, err := os.OpenFile(local, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+	n, err := src.WriteTo(dst)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s:%s -> %s (%d bytes)\n", s.entry.Name(), remote, local, n)
+	return nil
+}
+
+// remoteTarget places the source inside the remote target when it is a directory
+func remoteTarget(s *session, target string, source string, many bool) string {
+	if fi, err := s.Stat(target); (err == nil && fi.IsDir()) || many {
+		return path.Join(target, filepath.Base(source))
+	}
+	return target
+}
+
+// localTarget places the source inside the local target when it is a directory
+func localTarget(target string, source string, many bool) string {
+	if fi, err := os.Stat(target); (err == nil && fi.IsDir()) || many {
+		return filepath.Join(target, path.Base(source))
+	}
+	return target
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package transfer
+
+import (
+	"errors"
+
+	"github.com/spf13/cobra"
+	"us.figge.auto-ssh/internal/cmd"
+	"us.figge.auto-ssh/internal/core/flag"
+)
+
+var cpCmd = &cobra.Command{
+	Use:   "cp <source>... <target>",
+	Short: "Copies files to or from a configured host",
+	Long: `Copies files between this machine and a configured host over sftp. Remote paths
+are written host:path, with the host given by id or name, and are reached with the
+host's own settings, through its jump hosts when it has any`,
+	Example: `  ash cp ./build.tar bastion:/tmp/
+  ash cp -r db:/var/log/postgresql ./logs`,
+	Args: cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		exitOnError(cp(cmd, args))
+	},
+}
+
+func init() {
+	cmd.RootCmd.AddCommand(cpCmd)
+	flag.AddFlags(cpCmd, flag.Core, flag.PKCS11)
+	cpCmd.Flags().BoolVarP(&recursive, "recursive", "r", false, "copies directories and their contents")
+}
+
+func cp(cmd *cobra.Command, args []string) error {
+	engine := newEngine(cmd)
+	target := parseLocation(engine, args[len(args)-1])
+	sources := make([]location, 0, len(args)-1)
+	for _, arg := range args[:len(args)-1] {
+		source := parseLocation(engine, arg)
+		switch {
+		case source.remote() && target.remote():
+			return errors.New("copying between hosts is not supported")
+		case !source.remote() && !target.remote():
+			return errors.New("either the sources or the target must be on a host, written host:path")
+		case source.remote() && len(sources) > 0 && sources[0].host != source.host:
+			return errors.New("all sources must be on the same host")
+		}
+		sources = append(sources, source)
+	}
+
+	ref := target.host
+	if ref == "" {
+		ref = sources[0].host
+	}
+	s, err := open(engine, ref)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	many := len(sources) > 1
+	for _, source := range sources {
+		if target.remote() {
+			err = upload(s, source.path, remoteTarget(s, target.path, source.path, many))
+		} else {
+			err = download(s, source.path, localTarget(target.path, source.path, many))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+//go:build unix
+
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package transfer
+
+import (
+	"syscall"
+	"time"
+)
+
+// cpuTime returns the user and system cpu time used by this process so far
+func cpuTime() time.Duration {
+	usage := syscall.Rusage{}
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
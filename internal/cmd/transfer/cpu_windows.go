@@ -0,0 +1,27 @@
+//go:build windows
+
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package transfer
+
+import (
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// cpuTime returns the user and kernel cpu time used by this process so far
+func cpuTime() time.Duration {
+	var creation, exit, kernel, user windows.Filetime
+	if err := windows.GetProcessTimes(windows.CurrentProcess(), &creation, &exit, &kernel, &user); err != nil {
+		return 0
+	}
+	return ticks(kernel) + ticks(user)
+}
+
+// ticks converts a filetime, counting 100 nanosecond intervals, to a duration
+func ticks(ft windows.Filetime) time.Duration {
+	return time.Duration((int64(ft.HighDateTime)<<32 | int64(ft.LowDateTime)) * 100)
+}
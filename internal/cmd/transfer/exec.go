@@ -0,0 +1,159 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package transfer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+	"us.figge.auto-ssh/internal/cmd"
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/flag"
+	"us.figge.auto-ssh/internal/core/recording"
+)
+
+var (
+	forwardAgent bool
+)
+
+const (
+	// exitUnknown is returned when the remote command ends without an exit status, as ssh does
+	exitUnknown = 255
+
+	// defaultWidth and defaultHeight size the recording of a session without a terminal
+	defaultWidth  = 80
+	defaultHeight = 24
+)
+
+var execCmd = &cobra.Command{
+	Use:   "exec <host> -- <command> [args...]",
+	Short: "Runs a command on a configured host",
+	Long: `Runs a command on a host, given by id or name, reached with the host's own
+settings and through its jump hosts when it has any. Standard input is passed to
+the command, its output is streamed back and its exit code becomes that of ash.
+
+With -A, or the host's agent forward setting, an ssh agent is forwarded so the
+command can authenticate onward, limited to the keys and confirmation the host's
+agent settings require. Root on the host can use the forwarded keys for as long
+as the command runs.
+
+Hosts with a recording directory have each session recorded there, for
+asciinema to play back and ash recording verify to check has not been altered`,
+	Example: `  ash exec bastion -- uptime
+  ash exec db -- pg_dump app > app.sql
+  ash exec -A bastion -- git pull`,
+	Args: cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		code, err := execute(cmd, args[0], strings.Join(args[1:], " "))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
+		os.Exit(code)
+	},
+}
+
+func init() {
+	cmd.RootCmd.AddCommand(execCmd)
+	flag.AddFlags(execCmd, flag.Core, flag.PKCS11)
+	execCmd.Flags().BoolVarP(&forwardAgent, "forward-agent", "A", false, "Forward the ssh agent to the command")
+}
+
+func execute(cmd *cobra.Command, ref string, command string) (int, error) {
+	entry, client, release, err := connect(newEngine(cmd), ref)
+	if err != nil {
+		return exitUnknown, err
+	}
+	defer entry.Close()
+	defer release()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return exitUnknown, fmt.Errorf("host (%s) session cannot be opened: %v", ref, err)
+	}
+	defer func() { _ = session.Close() }()
+	closeAgent, err := entry.ForwardAgent(client, session, forwardAgent)
+	if err != nil {
+		return exitUnknown, err
+	}
+	defer closeAgent()
+	var input io.Reader = os.Stdin
+	session.Stdout = os.Stdout
+	session.Stderr = os.Stderr
+	if r := entry.Recording(); r != nil {
+		recorder, err := record(entry.Name(), r, command)
+		if err != nil {
+			return exitUnknown, err
+		}
+		defer func() {
+			if err := recorder.Close(); err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+			}
+		}()
+		session.Stdout = recorder.Output(os.Stdout)
+		session.Stderr = recorder.Output(os.Stderr)
+		if r.Input {
+			input = recorder.Input(os.Stdin)
+		}
+	}
+	// Stdin is copied separately, as the session would otherwise wait for it to close
+	// before returning even though the command has already ended
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return exitUnknown, err
+	}
+	if err = session.Start(command); err != nil {
+		return exitUnknown, fmt.Errorf("host (%s) command cannot be started: %v", ref, err)
+	}
+	go func() {
+		_, _ = io.Copy(stdin, input)
+		_ = stdin.Close()
+	}()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+	go func() {
+		for sig := range sigChan {
+			if sig == syscall.SIGINT {
+				_ = session.Signal(ssh.SIGINT)
+			} else {
+				_ = session.Signal(ssh.SIGTERM)
+			}
+		}
+	}()
+
+	err = session.Wait()
+	var exitErr *ssh.ExitError
+	switch {
+	case err == nil:
+		return 0, nil
+	case errors.As(err, &exitErr):
+		return exitErr.ExitStatus(), nil
+	default:
+		return exitUnknown, err
+	}
+}
+
+// record starts the recording of the command's session, sized to the terminal
+// when there is one.  The command is not run unrecorded
+func record(host string, r *config.Recording, command string) (*recording.Recorder, error) {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		width, height = defaultWidth, defaultHeight
+	}
+	recorder, err := recording.Start(r.Directory, host, command, width, height)
+	if err != nil {
+		return nil, fmt.Errorf("host (%s) session cannot be recorded: %v", host, err)
+	}
+	return recorder, nil
+}
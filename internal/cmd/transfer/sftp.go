@@ -0,0 +1,192 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package transfer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"us.figge.auto-ssh/internal/cmd"
+	"us.figge.auto-ssh/internal/core/flag"
+)
+
+var sftpCmd = &cobra.Command{
+	Use:   "sftp <host>",
+	Short: "Opens an interactive sftp session on a configured host",
+	Long: `Opens an interactive sftp session on a host, given by id or name, reached with the
+host's own settings and through its jump hosts when it has any. Commands are read
+from standard input, so a batch of commands may be piped in. Type help for a list`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		exitOnError(shell(cmd, args[0], os.Stdin))
+	},
+}
+
+func init() {
+	cmd.RootCmd.AddCommand(sftpCmd)
+	flag.AddFlags(sftpCmd, flag.Core, flag.PKCS11)
+}
+
+const shellHelp = `  cd <path>              change remote directory
+  get [-r] <remote> [local]  download a file or directory
+  help                   show this help
+  lcd <path>             change local directory
+  lpwd                   print local directory
+  ls [path]              list remote directory
+  mkdir <path>           create remote directory
+  put [-r] <local> [remote]  upload a file or directory
+  pwd                    print remote directory
+  rename <old> <new>     rename remote file
+  rm <path>              remove remote file
+  rmdir <path>           remove remote directory
+  exit, quit, bye        end the session
+`
+
+func shell(cmd *cobra.Command, ref string, in io.Reader) error {
+	s, err := open(newEngine(cmd), ref)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	cwd, err := s.Getwd()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Connected to %s\n", s.entry.Name())
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Print("sftp> ")
+		if !scanner.Scan() {
+			fmt.Println()
+			return scanner.Err()
+		}
+		args := strings.Fields(scanner.Text())
+		if len(args) == 0 {
+			continue
+		}
+		if args[0] == "exit" || args[0] == "quit" || args[0] == "bye" {
+			return nil
+		}
+		if cwd, err = run(s, cwd, args); err != nil {
+			fmt.Printf("%v\n", err)
+		}
+	}
+}
+
+// run executes a single shell command, returning the remote working directory
+func run(s *session, cwd string, args []string) (string, error) {
+	remote := func(p string) string {
+		if path.IsAbs(p) {
+			return p
+		}
+		return path.Join(cwd, p)
+	}
+	recursive = len(args) > 1 && args[1] == "-r"
+	if recursive {
+		args = append(args[:1], args[2:]...)
+	}
+	arg := func(i int) (string, error) {
+		if i >= len(args) {
+			return "", fmt.Errorf("%s: missing argument. See help", args[0])
+		}
+		return args[i], nil
+	}
+
+	switch args[0] {
+	case "help", "?":
+		fmt.Print(shellHelp)
+	case "pwd":
+		fmt.Printf("Remote working directory: %s\n", cwd)
+	case "lpwd":
+		dir, err := os.Getwd()
+		if err != nil {
+			return cwd, err
+		}
+		fmt.Printf("Local working directory: %s\n", dir)
+	case "cd":
+		dir, err := arg(1)
+		if err != nil {
+			return cwd, err
+		}
+		fi, err := s.Stat(remote(dir))
+		if err != nil {
+			return cwd, fmt.Errorf("%s: %v", dir, err)
+		}
+		if !fi.IsDir() {
+			return cwd, fmt.Errorf("%s: not a directory", dir)
+		}
+		return remote(dir), nil
+	case "lcd":
+		dir, err := arg(1)
+		if err != nil {
+			return cwd, err
+		}
+		return cwd, os.Chdir(dir)
+	case "ls":
+		dir := cwd
+		if len(args) > 1 {
+			dir = remote(args[1])
+		}
+		entries, err := s.ReadDir(dir)
+		if err != nil {
+			return cwd, fmt.Errorf("%s: %v", dir, err)
+		}
+		for _, entry := range entries {
+			fmt.Printf("%s %10d %s %s\n", entry.Mode(), entry.Size(), entry.ModTime().Format("Jan _2 15:04"), entry.Name())
+		}
+	case "get":
+		source, err := arg(1)
+		if err != nil {
+			return cwd, err
+		}
+		target := path.Base(source)
+		if len(args) > 2 {
+			target = localTarget(args[2], source, false)
+		}
+		return cwd, download(s, remote(source), target)
+	case "put":
+		source, err := arg(1)
+		if err != nil {
+			return cwd, err
+		}
+		target := path.Join(cwd, filepath.Base(source))
+		if len(args) > 2 {
+			target = remoteTarget(s, remote(args[2]), source, false)
+		}
+		return cwd, upload(s, source, target)
+	case "mkdir", "rm", "rmdir":
+		target, err := arg(1)
+		if err != nil {
+			return cwd, err
+		}
+		switch args[0] {
+		case "mkdir":
+			err = s.Mkdir(remote(target))
+		case "rm":
+			err = s.Remove(remote(target))
+		default:
+			err = s.RemoveDirectory(remote(target))
+		}
+		if err != nil {
+			return cwd, fmt.Errorf("%s: %v", target, err)
+		}
+	case "rename":
+		if len(args) < 3 {
+			return cwd, fmt.Errorf("rename: requires the old and new names")
+		}
+		if err := s.Rename(remote(args[1]), remote(args[2])); err != nil {
+			return cwd, fmt.Errorf("%s: %v", args[1], err)
+		}
+	default:
+		return cwd, fmt.Errorf("%s: unknown command. See help", args[0])
+	}
+	return cwd, nil
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package transfer
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/sftp"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/resources/engine/host"
+)
+
+// session is an sftp client on a host's ssh connection
+type session struct {
+	*sftp.Client
+	entry   *host.Entry
+	release func()
+}
+
+func (s *session) Close() {
+	_ = s.Client.Close()
+	s.release()
+	s.entry.Close()
+}
+
+// location is a local path, or a path on a host when written host:path
+type location struct {
+	host string
+	path string
+}
+
+func (l location) remote() bool {
+	return l.host != ""
+}
+
+// parseLocation treats a prefix before the first colon as a host only when it
+// names a configured host, so local paths containing colons still work
+func parseLocation(engine *host.Engine, arg string) location {
+	if ref, path, ok := strings.Cut(arg, ":"); ok && ref != "" {
+		if _, found := engine.Lookup(ref); found {
+			if path == "" {
+				// The remote user's home directory, as with scp
+				path = "."
+			}
+			return location{host: ref, path: path}
+		}
+	}
+	return location{path: arg}
+}
+
+func open(engine *host.Engine, ref string) (*session, error) {
+	entry, client, release, err := connect(engine, ref)
+	if err != nil {
+		return nil, err
+	}
+	sftpClient, err := sftp.NewClient(client)
+	if err != nil {
+		release()
+		entry.Close()
+		return nil, fmt.Errorf("host (%s) sftp subsystem unavailable: %v", ref, err)
+	}
+	return &session{Client: sftpClient, entry: entry, release: release}, nil
+}
+
+// connect establishes the host's ssh connection, through its jump hosts when it
+// has any.  The release function and entry.Close must be called when done
+func connect(engine *host.Engine, ref string) (*host.Entry, *ssh.Client, func(), error) {
+	entry, ok := engine.Lookup(ref)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("host (%s) undefined", ref)
+	}
+	if !entry.Valid() {
+		return nil, nil, nil, fmt.Errorf("host (%s) is invalid", ref)
+	}
+	client, release, err := entry.Client()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return entry, client, release, nil
+}
+
+func newEngine(cmd *cobra.Command) *host.Engine {
+	return host.NewEngine(cmd.Context(), config.C.Hosts)
+}
+
+func exitOnError(err error) {
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,165 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/activation"
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/handoff"
+	"us.figge.auto-ssh/internal/core/log"
+	"us.figge.auto-ssh/internal/core/sdnotify"
+	"us.figge.auto-ssh/internal/core/utils/backoff"
+)
+
+const (
+	drainPoll = time.Second
+	// handoffWait is how long an upgraded instance waits for the one it
+	// replaced to stop serving upgrades, before serving them itself
+	handoffWait = 10 * time.Second
+)
+
+var (
+	upgrade *handoff.Upgrade
+	// handedOver is set once an upgraded instance has taken over, leaving
+	// the ready and env files it wrote in place
+	handedOver atomic.Bool
+)
+
+// receiveUpgrade takes the listening sockets over from the running instance
+// when started with --upgrade, for the tunnels, web server and stats monitor
+// to listen on as if systemd had passed them in
+func receiveUpgrade() {
+	if !config.UpgradeFlag {
+		return
+	}
+	var err error
+	if upgrade, err = handoff.Receive(handoff.Path(config.FileName)); err != nil {
+		log.Printf("  Error - cannot upgrade: %v\n", err)
+		log.CloseSinks()
+		os.Exit(1)
+	}
+	for _, s := range upgrade.Sockets {
+		activation.Add(s.Name, s.File)
+	}
+	log.Printf("  Info  - upgrading auto-ssh (pid %d), %d sockets taken over\n", upgrade.Pid, len(upgrade.Sockets))
+}
+
+// readyUpgrade tells the instance being upgraded once the tunnels with an
+// entrance here are ready, for it to drain.  Reverse tunnels cannot be ready
+// until it has, their entrances on the host being its until then
+func readyUpgrade(ctx context.Context) {
+	if upgrade == nil {
+		serveHandoff(ctx)
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(readyPoll)
+		defer ticker.Stop()
+		for !entrancesReady() {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+		if err := upgrade.Ready(); err != nil {
+			log.Printf("  Error - auto-ssh (pid %d) cannot be told to drain: %v\n", upgrade.Pid, err)
+			return
+		}
+		log.Printf("  Info  - upgraded. auto-ssh (pid %d) draining\n", upgrade.Pid)
+		serveHandoff(ctx)
+	}()
+}
+
+func entrancesReady() bool {
+	now := time.Now()
+	for _, t := range tunnelEngine.Tunnels() {
+		if t.Reverse() || !t.Valid() || !t.Enabled() || !t.AutoStarts() || !t.InSchedule(now) {
+			continue
+		}
+		if ready, _ := t.Ready(); !ready {
+			return false
+		}
+	}
+	return true
+}
+
+// serveHandoff waits for an instance started with --upgrade, offering it the
+// tunnels' entrances, named by their address, and the server's sockets
+func serveHandoff(ctx context.Context) {
+	path := handoff.Path(config.FileName)
+	b := backoff.NewBackoff(250*time.Millisecond, 2*time.Second)
+	deadline := time.Now().Add(handoffWait)
+	for {
+		err := handoff.Serve(ctx, path, offered, drain)
+		if err == nil {
+			return
+		}
+		if upgrade == nil || time.Now().After(deadline) {
+			log.Printf("  Warn  - upgrades cannot be served: %v\n", err)
+			return
+		}
+		// The instance upgraded has yet to stop serving
+		b.Wait(ctx)
+	}
+}
+
+func offered() []handoff.Socket {
+	var sockets []handoff.Socket
+	entrances := tunnelEngine.Entrances()
+	addresses := make([]string, 0, len(entrances))
+	for address := range entrances {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	for _, address := range addresses {
+		sockets = append(sockets, handoff.Socket{Name: address, Listener: entrances[address]})
+	}
+	for name, listener := range server.Listeners() {
+		sockets = append(sockets, handoff.Socket{Name: name, Listener: listener})
+	}
+	if listener := statsEngine.Listener(); listener != nil {
+		sockets = append(sockets, handoff.Socket{Name: "stats", Listener: listener})
+	}
+	return sockets
+}
+
+// drain stops accepting once an upgraded instance has taken over, and exits
+// once the connections being forwarded have closed
+func drain() {
+	handedOver.Store(true)
+	log.Printf("  Info  - upgraded auto-ssh has taken over. Draining\n")
+	emitStopping("upgraded")
+	notify(sdnotify.Stopping)
+	server.Shutdown()
+	if listener := statsEngine.Listener(); listener != nil {
+		_ = listener.Close()
+	}
+	tunnelEngine.Drain()
+	ticker := time.NewTicker(drainPoll)
+	defer ticker.Stop()
+	for {
+		connections := 0
+		for _, t := range tunnelEngine.Tunnels() {
+			connections += t.Connections()
+		}
+		if connections == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+	log.Printf("  Info  - drained. Exiting\n")
+	cancel()
+}
@@ -0,0 +1,150 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+// Package access decides which client addresses may connect through a tunnel,
+// by cidr, GeoIP country or autonomous system number
+package access
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"us.figge.auto-ssh/internal/core/geoip"
+)
+
+type rule struct {
+	text    string
+	network *net.IPNet
+	country string
+	asn     uint
+}
+
+// Rules refuse a client matching a deny rule, or, given allow rules, one
+// matching none of them
+type Rules struct {
+	allow   []*rule
+	deny    []*rule
+	country func(net.IP) string
+	asn     func(net.IP) uint
+}
+
+// Parse reads rules that are each a cidr or address, country:CC naming a
+// country by its ISO code, or asn:N naming an autonomous system
+func Parse(allow []string, deny []string) (*Rules, error) {
+	r := &Rules{country: geoip.Country, asn: geoip.ASN}
+	var err error
+	if r.allow, err = parse(allow); err != nil {
+		return nil, err
+	}
+	if r.deny, err = parse(deny); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func parse(texts []string) ([]*rule, error) {
+	rules := make([]*rule, 0, len(texts))
+	for _, text := range texts {
+		text = strings.TrimSpace(text)
+		r := &rule{text: text}
+		lower := strings.ToLower(text)
+		switch {
+		case strings.HasPrefix(lower, "country:"):
+			r.country = strings.ToUpper(text[len("country:"):])
+			if len(r.country) != 2 {
+				return nil, fmt.Errorf("access rule (%s) must name a country by its two letter code", text)
+			}
+		case strings.HasPrefix(lower, "asn:"):
+			number := strings.TrimPrefix(strings.ToLower(text[len("asn:"):]), "as")
+			n, err := strconv.ParseUint(number, 10, 32)
+			if err != nil || n == 0 {
+				return nil, fmt.Errorf("access rule (%s) must name an autonomous system by its number", text)
+			}
+			r.asn = uint(n)
+		default:
+			if ip := net.ParseIP(text); ip != nil {
+				bits := 128
+				if ip.To4() != nil {
+					ip, bits = ip.To4(), 32
+				}
+				r.network = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+			} else if _, network, err := net.ParseCIDR(text); err == nil {
+				r.network = network
+			} else {
+				return nil, fmt.Errorf("access rule (%s) must be a cidr, address, country:CC or asn:N", text)
+			}
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// NeedsCountry reports whether any rule names a country
+func (r *Rules) NeedsCountry() bool {
+	return needs(r.allow, r.deny, func(rl *rule) bool { return rl.country != "" })
+}
+
+// NeedsASN reports whether any rule names an autonomous system
+func (r *Rules) NeedsASN() bool {
+	return needs(r.allow, r.deny, func(rl *rule) bool { return rl.asn != 0 })
+}
+
+func needs(allow, deny []*rule, naming func(*rule) bool) bool {
+	for _, rules := range [][]*rule{allow, deny} {
+		for _, rl := range rules {
+			if naming(rl) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Check explains why the client is refused, or is nil when it is allowed
+func (r *Rules) Check(ip net.IP) error {
+	c := &client{ip: ip, rules: r}
+	for _, rl := range r.deny {
+		if c.matches(rl) {
+			return fmt.Errorf("denied by access rule (%s)", rl.text)
+		}
+	}
+	if len(r.allow) == 0 {
+		return nil
+	}
+	for _, rl := range r.allow {
+		if c.matches(rl) {
+			return nil
+		}
+	}
+	return fmt.Errorf("not allowed by any access rule")
+}
+
+// client looks its country and autonomous system up once, when first needed
+type client struct {
+	ip      net.IP
+	rules   *Rules
+	country *string
+	asn     *uint
+}
+
+func (c *client) matches(rl *rule) bool {
+	switch {
+	case rl.network != nil:
+		return rl.network.Contains(c.ip)
+	case rl.country != "":
+		if c.country == nil {
+			country := c.rules.country(c.ip)
+			c.country = &country
+		}
+		return *c.country == rl.country
+	default:
+		if c.asn == nil {
+			asn := c.rules.asn(c.ip)
+			c.asn = &asn
+		}
+		return *c.asn == rl.asn
+	}
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package access
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheck(t *testing.T) {
+	tests := map[string]struct {
+		allow   []string
+		deny    []string
+		allowed map[string]bool
+	}{
+		"no rules": {
+			allowed: map[string]bool{"203.0.113.9": true},
+		},
+		"cidr allow": {
+			allow:   []string{"10.0.0.0/8", "192.0.2.7", "2001:db8::/32"},
+			allowed: map[string]bool{"10.1.2.3": true, "192.0.2.7": true, "192.0.2.8": false, "2001:db8::1": true, "2001:db9::1": false},
+		},
+		"deny before allow": {
+			allow:   []string{"10.0.0.0/8"},
+			deny:    []string{"10.0.0.1"},
+			allowed: map[string]bool{"10.0.0.1": false, "10.0.0.2": true},
+		},
+		"country": {
+			allow:   []string{"country:nz", "10.0.0.0/8"},
+			allowed: map[string]bool{"198.51.100.1": true, "203.0.113.1": false, "10.0.0.1": true},
+		},
+		"asn deny": {
+			deny:    []string{"asn:AS64500"},
+			allowed: map[string]bool{"203.0.113.1": false, "198.51.100.1": true},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			rules, err := Parse(test.allow, test.deny)
+			require.NoError(tt, err)
+			rules.country = func(ip net.IP) string {
+				if ip.Equal(net.ParseIP("198.51.100.1")) {
+					return "NZ"
+				}
+				return "US"
+			}
+			rules.asn = func(ip net.IP) uint {
+				if ip.Equal(net.ParseIP("203.0.113.1")) {
+					return 64500
+				}
+				return 0
+			}
+			for ip, allowed := range test.allowed {
+				assert.Equal(tt, allowed, rules.Check(net.ParseIP(ip)) == nil, ip)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	rules, err := Parse([]string{"country:US"}, []string{"asn:64500"})
+	require.NoError(t, err)
+	assert.True(t, rules.NeedsCountry())
+	assert.True(t, rules.NeedsASN())
+
+	rules, err = Parse([]string{"10.0.0.0/8"}, nil)
+	require.NoError(t, err)
+	assert.False(t, rules.NeedsCountry())
+	assert.False(t, rules.NeedsASN())
+
+	for _, bad := range []string{"country:USA", "asn:x", "asn:0", "10.0.0.0/33", "example.com"} {
+		_, err = Parse([]string{bad}, nil)
+		assert.Error(t, err, bad)
+	}
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+// Package activation picks up sockets passed in by systemd socket activation so
+// tunnels can listen on privileged ports without auto-ssh running as root
+package activation
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"us.figge.auto-ssh/internal/core/log"
+)
+
+const (
+	// listenFdsStart is the first file descriptor systemd passes, following stdin, stdout and stderr
+	listenFdsStart = 3
+)
+
+type socket struct {
+	name string
+	file *os.File
+	addr *net.TCPAddr
+}
+
+var (
+	once    sync.Once
+	sockets []*socket
+)
+
+// Listener returns a listener on a socket passed in by systemd whose FileDescriptorName
+// matches one of names, or failing that, which is bound to address. The socket itself
+// stays open so a stopped tunnel can be started again
+func Listener(address string, names ...string) (net.Listener, bool) {
+	once.Do(load)
+	s := find(sockets, address, names...)
+	if s == nil {
+		return nil, false
+	}
+	ln, err := net.FileListener(s.file)
+	if err != nil {
+		log.Printf("  Error - activated socket (%s) cannot be used: %v\n", s.name, err)
+		return nil, false
+	}
+	return ln, true
+}
+
+// Activated reports whether a socket for the address or names was passed in by systemd
+func Activated(address string, names ...string) bool {
+	once.Do(load)
+	return find(sockets, address, names...) != nil
+}
+
+func find(sockets []*socket, address string, names ...string) *socket {
+	for _, name := range names {
+		for _, s := range sockets {
+			if name != "" && s.name == name {
+				return s
+			}
+		}
+	}
+	tcpAddr, err := net.ResolveTCPAddr("tcp", address)
+	if err != nil {
+		return nil
+	}
+	for _, s := range sockets {
+		if s.addr != nil && s.addr.Port == tcpAddr.Port && s.addr.IP.Equal(tcpAddr.IP) {
+			return s
+		}
+	}
+	return nil
+}
+
+func load() {
+	defer func() {
+		// Not to be inherited by child processes
+		_ = os.Unsetenv("LISTEN_PID")
+		_ = os.Unsetenv("LISTEN_FDS")
+		_ = os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	for i := 0; i < count; i++ {
+		name := "LISTEN_FD_" + strconv.Itoa(listenFdsStart+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		if s := newSocket(name, os.NewFile(uintptr(listenFdsStart+i), name)); s != nil {
+			log.Printf("  Info  - activated socket (%s) received for %s\n", name, s.addr)
+			sockets = append(sockets, s)
+		}
+	}
+}
+
+// Add makes a listening socket inherited other than from systemd, such as from
+// an instance being upgraded, available as if it had been activated
+func Add(name string, file *os.File) {
+	once.Do(load)
+	if s := newSocket(name, file); s != nil {
+		sockets = append(sockets, s)
+	}
+}
+
+func newSocket(name string, file *os.File) *socket {
+	ln, err := net.FileListener(file)
+	if err != nil {
+		log.Printf("  Warn  - activated socket (%s) is not a tcp listener: %v\n", name, err)
+		return nil
+	}
+	s := &socket{name: name, file: file}
+	s.addr, _ = ln.Addr().(*net.TCPAddr)
+	_ = ln.Close()
+	return s
+}
@@ -0,0 +1,40 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package activation
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFind(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer func() { _ = ln.Close() }()
+	address := ln.Addr().String()
+	sockets := []*socket{
+		{name: "web", addr: &net.TCPAddr{IP: net.IPv4(0, 0, 0, 0), Port: 8080}},
+		{name: "LISTEN_FD_4", addr: ln.Addr().(*net.TCPAddr)},
+	}
+
+	tests := map[string]struct {
+		address  string
+		names    []string
+		expected *socket
+	}{
+		"name":       {address: "127.0.0.1:1", names: []string{"db", "web"}, expected: sockets[0]},
+		"address":    {address: address, names: []string{"db"}, expected: sockets[1]},
+		"blank name": {address: "127.0.0.1:1", names: []string{""}},
+		"other ip":   {address: "127.0.0.2:8080"},
+		"invalid":    {address: "nowhere"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			assert.Equal(tt, test.expected, find(sockets, test.address, test.names...))
+		})
+	}
+}
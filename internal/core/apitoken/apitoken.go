@@ -0,0 +1,160 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package apitoken
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const tokenBytes = 32
+
+var (
+	ErrTokenExists   = errors.New("token already exists")
+	ErrTokenNotFound = errors.New("token not found")
+
+	lock   sync.Mutex
+	file   string
+	issued []*Issued
+)
+
+// Issued is a token handed out by the api.  Only a hash of the token is kept,
+// the token itself being shown once when issued
+type Issued struct {
+	Name    string    `json:"name"`
+	Access  string    `json:"access"`
+	Hash    string    `json:"hash"`
+	Created time.Time `json:"created"`
+}
+
+// Open loads the tokens issued by previous runs from the file, to which newly
+// issued and revoked tokens are written.  Without a file tokens only last
+// until auto-ssh exits
+func Open(filename string) error {
+	lock.Lock()
+	defer lock.Unlock()
+	file, issued = filename, nil
+	if filename == "" {
+		return nil
+	}
+	bs, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("token file (%s) cannot be read: %w", filename, err)
+	}
+	if len(bs) > 0 {
+		if err = json.Unmarshal(bs, &issued); err != nil {
+			return fmt.Errorf("token file (%s) cannot be decoded: %w", filename, err)
+		}
+	}
+	return nil
+}
+
+// Issue creates a random token, returning it for the caller to pass on
+func Issue(name string, access string) (string, *Issued, error) {
+	lock.Lock()
+	defer lock.Unlock()
+	for _, t := range issued {
+		if t.Name == name {
+			return "", nil, fmt.Errorf("%w: %s", ErrTokenExists, name)
+		}
+	}
+	bs := make([]byte, tokenBytes)
+	if _, err := rand.Read(bs); err != nil {
+		return "", nil, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(bs)
+	t := &Issued{Name: name, Access: access, Hash: hash(token), Created: time.Now().UTC().Truncate(time.Second)}
+	issued = append(issued, t)
+	if err := save(); err != nil {
+		issued = issued[:len(issued)-1]
+		return "", nil, err
+	}
+	return token, t, nil
+}
+
+// Revoke withdraws the named token
+func Revoke(name string) error {
+	lock.Lock()
+	defer lock.Unlock()
+	for i, t := range issued {
+		if t.Name == name {
+			issued = append(issued[:i], issued[i+1:]...)
+			if err := save(); err != nil {
+				issued = append(issued[:i], append([]*Issued{t}, issued[i:]...)...)
+				return err
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrTokenNotFound, name)
+}
+
+// Lookup returns the issued token presented
+func Lookup(token string) (*Issued, bool) {
+	lock.Lock()
+	defer lock.Unlock()
+	presented := []byte(hash(token))
+	for _, t := range issued {
+		if subtle.ConstantTimeCompare(presented, []byte(t.Hash)) == 1 {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// List returns the issued tokens
+func List() []Issued {
+	lock.Lock()
+	defer lock.Unlock()
+	list := make([]Issued, 0, len(issued))
+	for _, t := range issued {
+		list = append(list, *t)
+	}
+	return list
+}
+
+// Count is the number of tokens issued
+func Count() int {
+	lock.Lock()
+	defer lock.Unlock()
+	return len(issued)
+}
+
+func hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// save replaces the token file with the issued tokens.  Must be called
+// holding the lock
+func save() error {
+	if file == "" {
+		return nil
+	}
+	bs, err := json.MarshalIndent(issued, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(file), "."+filepath.Base(file)+".tmp")
+	if err = os.WriteFile(tmp, bs, 0600); err == nil {
+		err = os.Rename(tmp, file)
+	}
+	if err != nil {
+		return fmt.Errorf("token file (%s) cannot be written: %w", file, err)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package apitoken
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIssuedTokensPersisted(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "tokens.json")
+	assert.NoError(t, Open(filename))
+
+	token, issued, err := Issue("ci", "admin")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, token)
+	assert.NotContains(t, issued.Hash, token)
+	_, _, err = Issue("ci", "read")
+	assert.ErrorIs(t, err, ErrTokenExists)
+
+	assert.NoError(t, Open(filename))
+	found, ok := Lookup(token)
+	assert.True(t, ok)
+	assert.Equal(t, "ci", found.Name)
+	assert.Equal(t, "admin", found.Access)
+	_, ok = Lookup(token + "x")
+	assert.False(t, ok)
+
+	assert.NoError(t, Revoke("ci"))
+	assert.ErrorIs(t, Revoke("ci"), ErrTokenNotFound)
+	assert.NoError(t, Open(filename))
+	assert.Zero(t, Count())
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/log"
+)
+
+// Record describes a single forwarded connection from accept to close
+type Record struct {
+	Time       time.Time `json:"time"`
+	Started    time.Time `json:"started"`
+	TunnelId   string    `json:"tunnelId"`
+	Tunnel     string    `json:"tunnel"`
+	Host       string    `json:"host,omitempty"`
+	Client     string    `json:"client"`
+	Subject    string    `json:"subject,omitempty"`
+	Target     string    `json:"target"`
+	Protocol   string    `json:"protocol,omitempty"`
+	BytesIn    int64     `json:"bytesIn"`
+	BytesOut   int64     `json:"bytesOut"`
+	DurationMs int64     `json:"durationMs"`
+	Reason     string    `json:"reason"`
+}
+
+type Logger struct {
+	lock sync.Mutex
+	file *os.File
+}
+
+var (
+	defaultLogger = &Logger{}
+)
+
+// Open directs audit records to the file, which is created if necessary and
+// only ever appended to.  An empty filename disables auditing
+func Open(filename string) error {
+	defaultLogger.lock.Lock()
+	defer defaultLogger.lock.Unlock()
+	if defaultLogger.file != nil {
+		_ = defaultLogger.file.Close()
+		defaultLogger.file = nil
+	}
+	if filename == "" {
+		return nil
+	}
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("audit log (%s) cannot be opened: %w", filename, err)
+	}
+	defaultLogger.file = f
+	return nil
+}
+
+func Close() {
+	_ = Open("")
+}
+
+// Enabled reports whether records are being written
+func Enabled() bool {
+	defaultLogger.lock.Lock()
+	defer defaultLogger.lock.Unlock()
+	return defaultLogger.file != nil
+}
+
+// Write completes the record with its close time and duration and appends it
+// to the audit log as a single json line
+func Write(record *Record) {
+	record.Time = time.Now()
+	record.DurationMs = record.Time.Sub(record.Started).Milliseconds()
+	bs, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	defaultLogger.lock.Lock()
+	defer defaultLogger.lock.Unlock()
+	if defaultLogger.file == nil {
+		return
+	}
+	if _, err = defaultLogger.file.Write(append(bs, '\n')); err != nil {
+		log.Printf("  Error - failed to write audit record: %v\n", err)
+	}
+}
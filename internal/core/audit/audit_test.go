@@ -0,0 +1,51 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrite(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "audit.log")
+	assert.NoError(t, os.WriteFile(filename, []byte("{\"tunnel\":\"existing\"}\n"), 0600))
+
+	// Disabled logger silently drops records
+	Write(&Record{Tunnel: "dropped"})
+
+	assert.NoError(t, Open(filename))
+	assert.True(t, Enabled())
+	Write(&Record{Started: time.Now().Add(-time.Second), Tunnel: "one", BytesIn: 10, BytesOut: 20, Reason: "client closed"})
+	Write(&Record{Started: time.Now(), Tunnel: "two", Reason: "host unavailable"})
+	Close()
+	assert.False(t, Enabled())
+	Write(&Record{Tunnel: "dropped"})
+
+	f, err := os.Open(filename)
+	assert.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	var records []*Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		record := &Record{}
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), record))
+		records = append(records, record)
+	}
+	if assert.Len(t, records, 3) {
+		assert.Equal(t, "existing", records[0].Tunnel)
+		assert.Equal(t, "one", records[1].Tunnel)
+		assert.Equal(t, int64(10), records[1].BytesIn)
+		assert.Equal(t, int64(20), records[1].BytesOut)
+		assert.GreaterOrEqual(t, records[1].DurationMs, int64(1000))
+		assert.Equal(t, "host unavailable", records[2].Reason)
+	}
+}
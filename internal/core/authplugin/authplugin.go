@@ -0,0 +1,107 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+// Package authplugin runs the external commands hosts hand their
+// authentication to.  A command is run for each request, sent the Request as
+// json on stdin, and must write a Response as json to stdout before exiting
+// zero.  A credentials request asks for the keys or password to connect with,
+// a challenge request for the answers to a server's keyboard-interactive
+// questions, such as a one-time password.  A Response setting Error, or a
+// command exiting non-zero, fails the authentication, the command's stderr
+// being logged
+package authplugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Version is the protocol version sent with each request
+const Version = 1
+
+const (
+	RequestCredentials = "credentials"
+	RequestChallenge   = "challenge"
+)
+
+var ErrPlugin = errors.New("auth plugin failed")
+
+type Request struct {
+	Version  int               `json:"version"`
+	Type     string            `json:"type"`
+	Host     string            `json:"host"`
+	Remote   string            `json:"remote"`
+	Username string            `json:"username"`
+	Config   map[string]string `json:"config,omitempty"`
+
+	// Name, Instruction and Questions are the server's, for a challenge
+	Name        string     `json:"name,omitempty"`
+	Instruction string     `json:"instruction,omitempty"`
+	Questions   []Question `json:"questions,omitempty"`
+}
+
+type Question struct {
+	Prompt string `json:"prompt"`
+	Echo   bool   `json:"echo"`
+}
+
+// Response carries any of a pem private key, optionally encrypted with the
+// passphrase and accompanied by a certificate in authorized_keys format, and a
+// password for a credentials request, or an answer to each question of a
+// challenge.  Credentials are reused until Expires, or only for the connection
+// they were requested for when it is not set
+type Response struct {
+	PrivateKey  string     `json:"privateKey,omitempty"`
+	Passphrase  string     `json:"passphrase,omitempty"`
+	Certificate string     `json:"certificate,omitempty"`
+	Password    string     `json:"password,omitempty"`
+	Answers     []string   `json:"answers,omitempty"`
+	Expires     *time.Time `json:"expires,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// Run runs the command with the request, returning its response
+func Run(ctx context.Context, command string, args []string, req *Request) (*Response, error) {
+	req.Version = Version
+	in, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, command, args...)
+	cmd.Stdin = bytes.NewReader(in)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err = cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s: %v: %s", ErrPlugin, command, err, msg)
+		}
+		return nil, fmt.Errorf("%w: %s: %v", ErrPlugin, command, err)
+	}
+	resp := &Response{}
+	if err = json.Unmarshal(stdout.Bytes(), resp); err != nil {
+		return nil, fmt.Errorf("%w: %s: response cannot be decoded: %v", ErrPlugin, command, err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("%w: %s: %s", ErrPlugin, command, resp.Error)
+	}
+	if req.Type == RequestChallenge && len(resp.Answers) != len(req.Questions) {
+		return nil, fmt.Errorf("%w: %s: %d answers to %d questions", ErrPlugin, command, len(resp.Answers), len(req.Questions))
+	}
+	return resp, nil
+}
+
+// Usable tells whether the response's credentials may still be used
+func (r *Response) Usable(now time.Time) bool {
+	return r.Expires != nil && now.Before(*r.Expires)
+}
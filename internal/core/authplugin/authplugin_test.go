@@ -0,0 +1,54 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package authplugin
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func shell(t *testing.T, script string) (string, []string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugin scripts need a posix shell")
+	}
+	return "/bin/sh", []string{"-c", script}
+}
+
+func TestRunCredentials(t *testing.T) {
+	command, args := shell(t, `grep -q '"type":"credentials"' && echo '{"password":"secret","expires":"2099-01-01T00:00:00Z"}'`)
+	resp, err := Run(context.Background(), command, args, &Request{Type: RequestCredentials, Host: "bastion"})
+	require.NoError(t, err)
+	assert.Equal(t, "secret", resp.Password)
+	assert.True(t, resp.Usable(time.Now()))
+}
+
+func TestRunChallenge(t *testing.T) {
+	command, args := shell(t, `cat >/dev/null; echo '{"answers":["123456"]}'`)
+	req := &Request{Type: RequestChallenge, Questions: []Question{{Prompt: "Verification code: "}}}
+	resp, err := Run(context.Background(), command, args, req)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"123456"}, resp.Answers)
+	assert.False(t, resp.Usable(time.Now()))
+
+	req.Questions = append(req.Questions, Question{Prompt: "Password: "})
+	_, err = Run(context.Background(), command, args, req)
+	assert.True(t, errors.Is(err, ErrPlugin))
+}
+
+func TestRunFailure(t *testing.T) {
+	command, args := shell(t, `cat >/dev/null; echo '{"error":"denied"}'`)
+	_, err := Run(context.Background(), command, args, &Request{Type: RequestCredentials})
+	assert.ErrorContains(t, err, "denied")
+
+	command, args = shell(t, `echo 'no vpn' >&2; exit 2`)
+	_, err = Run(context.Background(), command, args, &Request{Type: RequestCredentials})
+	assert.ErrorContains(t, err, "no vpn")
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package banner
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var lock sync.Mutex
+
+// Hash identifies the text of a banner, in the form of an ssh fingerprint
+func Hash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// Acknowledged reports whether the banner of the host with the hash has been
+// acknowledged in the file.  A missing file holds no acknowledgements
+func Acknowledged(file string, host string, hash string) (bool, error) {
+	lock.Lock()
+	defer lock.Unlock()
+	f, err := os.Open(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("banner acknowledgements (%s) cannot be read: %w", file, err)
+	}
+	defer func() { _ = f.Close() }()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) >= 3 && fields[1] == host && fields[2] == hash {
+			return true, nil
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return false, fmt.Errorf("banner acknowledgements (%s) cannot be read: %w", file, err)
+	}
+	return false, nil
+}
+
+// Acknowledge records that the user has seen the banner of the host with the
+// hash.  Acknowledgements are appended to the file, a tab separated line each
+// of the time, host, hash and user, so it doubles as a record of who saw which
+// banner when
+func Acknowledge(file string, host string, hash string, user string) error {
+	lock.Lock()
+	defer lock.Unlock()
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("banner acknowledgements (%s) cannot be opened: %w", file, err)
+	}
+	line := strings.Join([]string{time.Now().UTC().Format(time.RFC3339), host, hash, user}, "\t") + "\n"
+	if _, err = f.WriteString(line); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("banner acknowledgements (%s) cannot be written: %w", file, err)
+	}
+	return f.Close()
+}
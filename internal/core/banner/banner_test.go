@@ -0,0 +1,47 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package banner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHash(t *testing.T) {
+	assert.Equal(t, "SHA256:47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU", Hash(""))
+	assert.NotEqual(t, Hash("Authorized use only\n"), Hash("Authorized use only"))
+}
+
+func TestAcknowledge(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "banners")
+	hash := Hash("Authorized use only")
+
+	ok, err := Acknowledged(file, "bastion", hash)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, Acknowledge(file, "bastion", hash, "jason"))
+	ok, err = Acknowledged(file, "bastion", hash)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = Acknowledged(file, "db", hash)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = Acknowledged(file, "bastion", Hash("Authorized use only, monitored"))
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	bs, err := os.ReadFile(file)
+	require.NoError(t, err)
+	fields := strings.Split(strings.TrimSuffix(string(bs), "\n"), "\t")
+	require.Len(t, fields, 4)
+	assert.Equal(t, []string{"bastion", hash, "jason"}, fields[1:])
+}
@@ -6,6 +6,8 @@ package config
 
 import (
 	"fmt"
+
+	"us.figge.auto-ssh/internal/core/log"
 )
 
 type Validations struct {
@@ -56,7 +58,7 @@ func (v *Validations) Output(returnErr error) error {
 		}
 		for _, entry := range v.Validations() {
 			if entry.IsError() || VerboseFlag {
-				fmt.Printf("%s\n", entry.Message())
+				fmt.Print(log.Format(entry.Message()))
 			}
 		}
 	}
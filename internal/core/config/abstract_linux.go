@@ -0,0 +1,9 @@
+//go:build linux
+
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package config
+
+const abstractSockets = true
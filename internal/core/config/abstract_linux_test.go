@@ -0,0 +1,28 @@
+//go:build linux
+
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddressValidateAbstract(t *testing.T) {
+	address := NewAddress("@auto-ssh.test")
+	assert.True(t, address.Validate("tunnel", "test", "local address", true, false))
+	assert.True(t, address.IsAbstract())
+	assert.Equal(t, "unix", address.Network())
+	assert.Equal(t, "@auto-ssh.test", address.String())
+	assert.Equal(t, "", address.Host())
+	assert.Equal(t, 0, address.Port())
+
+	assert.False(t, NewAddress("@").Validate("tunnel", "test", "local address", true, false))
+	assert.False(t, NewAddress("@"+strings.Repeat("a", maxAbstractName)).Validate("tunnel", "test", "local address", true, false))
+	assert.Equal(t, "tcp", NewAddress("127.0.0.1:80").Network())
+}
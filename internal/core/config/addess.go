@@ -6,12 +6,18 @@ package config
 
 import (
 	"encoding/json"
-	"fmt"
 	"net"
 	"strconv"
 	"strings"
+
+	"us.figge.auto-ssh/internal/core/log"
+	"us.figge.auto-ssh/internal/core/tor"
 )
 
+// maxAbstractName is the longest abstract unix socket address, the @ included,
+// standing in for the leading nul of the 108 byte sun_path
+const maxAbstractName = 108
+
 type Address struct {
 	valid             bool
 	address           string
@@ -25,64 +31,93 @@ func NewAddress(address string) *Address {
 	}
 }
 
+// Validate checks the address is host:port, with ip6 addresses in brackets,
+// defaulting the port or host when only one is given.  Host names are kept
+// rather than replaced by an address so dialing can race the ip4 and ip6
+// addresses they resolve to.  Remote addresses need not resolve locally
 func (a *Address) Validate(group string, name string, attr string, remote bool, defaultPort bool) bool {
+	return a.validate(group, name, attr, remote, defaultPort, false)
+}
+
+// ValidateListen checks an address to be listened on by a host, which may
+// leave the port to the host by giving port 0
+func (a *Address) ValidateListen(group string, name string, attr string) bool {
+	return a.validate(group, name, attr, true, false, true)
+}
+
+func (a *Address) validate(group string, name string, attr string, remote bool, defaultPort bool, anyPort bool) bool {
 	a.valid = true
-	parts := strings.Split(a.address, ":")
-	if len(parts) == 1 {
-		if defaultPort {
-			parts = []string{parts[0], "22"}
-		} else {
-			parts = []string{"0.0.0.0", parts[0]}
+	if a.IsAbstract() {
+		return a.validateAbstract(group, name, attr)
+	}
+	host, port, err := net.SplitHostPort(a.address)
+	if err != nil {
+		switch {
+		case !strings.Contains(a.address, ":"):
+			if defaultPort {
+				host, port = a.address, "22"
+			} else {
+				host, port = "0.0.0.0", a.address
+			}
+		case defaultPort && net.ParseIP(a.address) != nil:
+			host, port = a.address, "22"
+		default:
+			log.Printf(
+				"  Error - %s(%s) %s(%s) is invalid.  Required syntax is <address>:<port>, with ip6 addresses in brackets\n",
+				group, name, attr, a.address,
+			)
+			a.valid = false
+			return false
 		}
-	} else if len(parts) > 2 {
-		fmt.Printf(
-			"  Error - %s(%s) %s(%s) is invalid.  Required syntax is <ip address>:<port>\n",
-			group, name, attr, a.address,
-		)
-		a.valid = false
-		return false
 	}
 
-	ips, err := net.LookupIP(parts[0])
-	if err != nil {
+	if tor.IsOnion(host) {
+		// Onion addresses are known only to tor, and asking dns of them leaks them
+	} else if ips, err := net.LookupIP(host); err != nil {
 		if !remote {
-			fmt.Printf("  Error - %s(%s) %s(%s) cannot be resolved\n", group, name, attr, parts[0])
+			log.Printf("  Error - %s(%s) %s(%s) cannot be resolved\n", group, name, attr, host)
 			a.valid = false
 		} else {
-			fmt.Printf("  Warn  - %s(%s) %s(%s) cannot be resolved local\n", group, name, attr, parts[0])
+			log.Printf("  Warn  - %s(%s) %s(%s) cannot be resolved local\n", group, name, attr, host)
 		}
 	} else if len(ips) == 0 {
-		fmt.Printf("  Error - %s(%s) %s(%s) has no valid IP addresses associated with it\n", group, name, attr, parts[0])
+		log.Printf("  Error - %s(%s) %s(%s) has no valid IP addresses associated with it\n", group, name, attr, host)
 		a.valid = false
-	} else {
-		if ipv4 := ips[0].To4(); ipv4 == nil {
-			fmt.Printf("  Error - %s(%s) %s(%s) cannot be converted to a valid IP4 address\n", group, name, attr, parts[0])
-			a.valid = false
-		} else if !remote {
-			a.address = ipv4.String()
-		} else {
-			a.address = parts[0]
-		}
-		//a.resolvedAddresses, err = net.ResolveIPAddr("tcp", a.address)
-		//if err != nil {
-		//	fmt.Printf("  Error - %s(%s) cannot reverse resolve IP4 address (%s): %v\n", group, name, a.address, err)
-		//	a.valid = false
-		//}
+	} else if ip := net.ParseIP(host); ip != nil {
+		host = ip.String()
 	}
 
-	if i, err := strconv.Atoi(parts[1]); err != nil {
-		fmt.Printf("  Error - %s(%s) %s port(%s) %v\n", group, name, attr, parts[1], err.Error())
+	if i, err := strconv.Atoi(port); err != nil {
+		log.Printf("  Error - %s(%s) %s port(%s) %v\n", group, name, attr, port, err.Error())
 		a.valid = false
-	} else if i < 1 || i > 65536 {
-		fmt.Printf("  Error - %s(%s) %s port(%s) range is invalid.  Must be between 1 and 65536\n", group, name, attr, parts[1])
+	} else if (i < 1 && !(anyPort && i == 0)) || i > 65536 {
+		log.Printf("  Error - %s(%s) %s port(%s) range is invalid.  Must be between 1 and 65536\n", group, name, attr, port)
 		a.valid = false
 	} else {
-		a.address = fmt.Sprintf("%s:%d", a.address, i)
+		a.address = net.JoinHostPort(host, strconv.Itoa(i))
 		a.port = i
 	}
 	return a.valid
 }
 
+// validateAbstract checks an abstract unix socket name, @ followed by the name
+// given to it outside the filesystem.  These exist only on linux
+func (a *Address) validateAbstract(group string, name string, attr string) bool {
+	switch {
+	case !abstractSockets:
+		log.Printf("  Error - %s(%s) %s(%s) is an abstract unix socket, which only linux supports\n", group, name, attr, a.address)
+		a.valid = false
+	case len(a.address) == 1:
+		log.Printf("  Error - %s(%s) %s(%s) is missing the name of the abstract unix socket\n", group, name, attr, a.address)
+		a.valid = false
+	case len(a.address) > maxAbstractName:
+		log.Printf("  Error - %s(%s) %s(%s) name is longer than %d characters\n", group, name, attr, a.address, maxAbstractName-1)
+		a.valid = false
+	}
+	a.port = 0
+	return a.valid
+}
+
 func (a *Address) UnmarshalJSON(data []byte) error {
 	a.address = strings.TrimSpace(string(data))
 	return nil
@@ -96,6 +131,10 @@ func (a *Address) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	return unmarshal(&a.address)
 }
 
+func (a *Address) MarshalYAML() (interface{}, error) {
+	return a.address, nil
+}
+
 func (a *Address) IsBlank() bool {
 	return a.address == ""
 }
@@ -108,4 +147,39 @@ func (a *Address) Port() int {
 	return a.port
 }
 
-func (a *Address) String() string { return a.address }
+// IsAbstract reports whether the address names an abstract unix socket, as
+// @name, rather than a host and port
+func (a *Address) IsAbstract() bool {
+	return a != nil && strings.HasPrefix(a.address, "@")
+}
+
+// Network is the network the address is listened on or dialed with
+func (a *Address) Network() string {
+	if a.IsAbstract() {
+		return "unix"
+	}
+	return "tcp"
+}
+
+// Host is the host of the address, blank for an address that is only a port
+// or an abstract unix socket
+func (a *Address) Host() string {
+	if a == nil || a.IsAbstract() {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(a.address)
+	if err == nil {
+		return host
+	}
+	if _, err = strconv.Atoi(a.address); err == nil {
+		return ""
+	}
+	return a.address
+}
+
+func (a *Address) String() string {
+	if a == nil {
+		return ""
+	}
+	return a.address
+}
@@ -0,0 +1,46 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddressValidate(t *testing.T) {
+	tests := map[string]struct {
+		input       string
+		defaultPort bool
+		valid       bool
+		expected    string
+	}{
+		"ip4":               {input: "127.0.0.1:2222", valid: true, expected: "127.0.0.1:2222"},
+		"ip6":               {input: "[::1]:2222", valid: true, expected: "[::1]:2222"},
+		"ip6-default-port":  {input: "::1", defaultPort: true, valid: true, expected: "[::1]:22"},
+		"ip6-unbracketed":   {input: "::1:2222", valid: false},
+		"name":              {input: "localhost:2222", valid: true, expected: "localhost:2222"},
+		"name-default-port": {input: "localhost", defaultPort: true, valid: true, expected: "localhost:22"},
+		"port-only":         {input: "8080", valid: true, expected: "0.0.0.0:8080"},
+		"bad-port":          {input: "127.0.0.1:http", valid: false},
+		"port-range":        {input: "127.0.0.1:0", valid: false},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			address := NewAddress(test.input)
+			assert.Equal(tt, test.valid, address.Validate("host", name, "address", false, test.defaultPort))
+			if test.valid {
+				assert.Equal(tt, test.expected, address.String())
+			}
+		})
+	}
+}
+
+func TestAddressValidateListen(t *testing.T) {
+	address := NewAddress("127.0.0.1:0")
+	assert.True(t, address.ValidateListen("tunnel", "test", "local address"))
+	assert.Equal(t, "127.0.0.1:0", address.String())
+	assert.False(t, NewAddress("127.0.0.1:-1").ValidateListen("tunnel", "test", "local address"))
+}
@@ -4,8 +4,102 @@
 
 package config
 
+import (
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/log"
+	"us.figge.auto-ssh/internal/core/stripe"
+)
+
 const (
 	Undefined = "<default>"
+
+	DefaultConnectTimeout = 15 * time.Second
+	DefaultChannelTimeout = 10 * time.Second
+	DefaultDialTimeout    = 10 * time.Second
+	DefaultIdleTimeout    = 5 * time.Minute
+	DefaultResolveTimeout = time.Minute
+	// DefaultFallbackDelay is the connection attempt delay recommended by RFC 8305
+	DefaultFallbackDelay = 250 * time.Millisecond
+
+	DefaultRegistryInterval = 10 * time.Second
+	DefaultConsulAddress    = "http://127.0.0.1:8500"
+	DefaultEtcdEndpoint     = "http://127.0.0.1:2379"
+	DefaultEtcdPrefix       = "/auto-ssh/services"
+
+	DefaultProbeInterval = 30 * time.Second
+
+	DefaultStatsDAddress  = "127.0.0.1:8125"
+	DefaultStatsDInterval = 10 * time.Second
+	DefaultStatsDPrefix   = "auto_ssh"
+
+	DefaultLeaderKey = "auto-ssh/leader"
+	DefaultLeaderTTL = 15 * time.Second
+
+	HostKeyAcceptNew = "accept-new"
+	HostKeyStrict    = "strict"
+	HostKeyOff       = "off"
+
+	TransportTCP       = "tcp"
+	TransportWebSocket = "websocket"
+	TransportTor       = "tor"
+
+	DefaultTorSOCKS   = "127.0.0.1:9050"
+	DefaultTorControl = "127.0.0.1:9051"
+
+	AgentSourceAgent    = "agent"
+	AgentSourceIdentity = "identity"
+
+	DefaultHealthGrace = 2 * time.Minute
+
+	DefaultRetryDelay    = 500 * time.Millisecond
+	DefaultRetryMaxDelay = 5 * time.Second
+
+	DefaultQueueSize    = 64
+	DefaultQueueTimeout = 30 * time.Second
+
+	DefaultStripeStreams = 4
+	DefaultStripeServer  = "127.0.0.1:7900"
+
+	DefaultPrewarmMaxIdle = time.Minute
+
+	DefaultWatchdogInterval = 30 * time.Second
+	DefaultWatchdogTimeout  = 10 * time.Second
+	DefaultWatchdogFailures = 3
+
+	DefaultDampingFlaps         = 3
+	DefaultDampingWindow        = 5 * time.Minute
+	DefaultDampingHoldDown      = 30 * time.Second
+	DefaultDampingMaxHoldDown   = 10 * time.Minute
+	DefaultDampingRetryInterval = time.Second
+
+	DefaultAuthPluginTimeout = 10 * time.Second
+
+	DefaultCredentialTTL           = 5 * time.Minute
+	DefaultCredentialHelperTimeout = time.Minute
+
+	DefaultTrafficFlush = 30 * time.Second
+
+	DefaultCaptureMaxSize = 10
+
+	DefaultFilterTimeout = 10 * time.Second
+
+	MinAuthSecretLength = 16
+	DefaultTokenTTL     = 30 * 24 * time.Hour
+
+	OutputText = "text"
+	OutputJSON = "json"
+
+	TokenAccessRead  = "read"
+	TokenAccessAdmin = "admin"
 )
 
 var ( // Build values
@@ -16,42 +110,764 @@ var ( // Build values
 )
 
 var ( // Argument flags
-	FileName    string
-	C           *Configuration
-	VerboseFlag bool
-	ForcedFlag  bool
-	PromptFlag  bool
-	CurlFlag    bool
-	RawFlag     bool
+	FileName        string
+	C               *Configuration
+	VerboseFlag     bool
+	ForcedFlag      bool
+	PromptFlag      bool
+	CurlFlag        bool
+	RawFlag         bool
+	JsonFlag        bool
+	WideFlag        bool
+	ConnectionsFlag bool
+	BindFlag        string
+	TakeoverFlag    bool
+	UpgradeFlag     bool
+	FailFastFlag    bool
+	ReadyFileFlag   string
+	ReadyFdFlag     int
+	EnvFileFlag     string
+	PKCS11Flag      string
+	PollFlag        time.Duration
+	RedactFlag      bool
+	NoColorFlag     bool
+	TimestampsFlag  bool
+	QuietFlag       bool
+	OutputFlag      string
+	StrictPermsFlag bool
+	FixPermsFlag    bool
+	FIPSFlag        bool
 )
 
 type Configuration struct {
-	Hosts   []*Host   `yaml:"hosts,omitempty" json:"hosts,omitempty"`
-	Tunnels []*Tunnel `yaml:"tunnels,omitempty" json:"tunnels,omitempty"`
-	Monitor *Monitor  `yaml:"monitor,omitempty" json:"monitor,omitempty"`
-	Web     *Web      `yaml:"web,omitempty" json:"web,omitempty"`
+	Hosts    []*Host   `yaml:"hosts,omitempty" json:"hosts,omitempty"`
+	Tunnels  []*Tunnel `yaml:"tunnels,omitempty" json:"tunnels,omitempty"`
+	Monitor  *Monitor  `yaml:"monitor,omitempty" json:"monitor,omitempty"`
+	Web      *Web      `yaml:"web,omitempty" json:"web,omitempty"`
+	Audit    *Audit    `yaml:"audit,omitempty" json:"audit,omitempty"`
+	Logging  *Logging  `yaml:"logging,omitempty" json:"logging,omitempty"`
+	Registry *Registry `yaml:"registry,omitempty" json:"registry,omitempty"`
+	Probe    *Probe    `yaml:"probe,omitempty" json:"probe,omitempty"`
+	Health   *Health   `yaml:"health,omitempty" json:"health,omitempty"`
+	Traffic  *Traffic  `yaml:"traffic,omitempty" json:"traffic,omitempty"`
+	Journal  *Journal  `yaml:"journal,omitempty" json:"journal,omitempty"`
+	Leader   *Leader   `yaml:"leader,omitempty" json:"leader,omitempty"`
+	GeoIP    *GeoIP    `yaml:"geoip,omitempty" json:"geoip,omitempty"`
+	StatsD   *StatsD   `yaml:"statsd,omitempty" json:"statsd,omitempty"`
+	Tor      *Tor      `yaml:"tor,omitempty" json:"tor,omitempty"`
 }
 
+type Logging struct {
+	Level    string    `yaml:"level,omitempty" json:"level,omitempty"`
+	Syslog   []*Syslog `yaml:"syslog,omitempty" json:"syslog,omitempty"`
+	Journald *Journald `yaml:"journald,omitempty" json:"journald,omitempty"`
+}
+
+type Syslog struct {
+	Address  string `yaml:"address,omitempty" json:"address,omitempty"`
+	Facility string `yaml:"facility,omitempty" json:"facility,omitempty"`
+	Tag      string `yaml:"tag,omitempty" json:"tag,omitempty"`
+	Level    string `yaml:"level,omitempty" json:"level,omitempty"`
+}
+
+type Journald struct {
+	Identifier string `yaml:"identifier,omitempty" json:"identifier,omitempty"`
+	Level      string `yaml:"level,omitempty" json:"level,omitempty"`
+}
+
+type Audit struct {
+	File string `yaml:"file,omitempty" json:"file,omitempty"`
+}
+
+// Traffic keeps each tunnel's lifetime byte and connection totals in File, so
+// they survive restarts, writing it every Flush, 30 seconds by default, while
+// they change.  Without a file the totals start over with each run
+type Traffic struct {
+	File  string   `yaml:"file,omitempty" json:"file,omitempty"`
+	Flush Duration `yaml:"flush,omitempty" json:"flush,omitempty"`
+}
+
+// Journal keeps the state auto-ssh is put in while running in File: the
+// tunnels started or stopped through the api or cli, and the ports hosts
+// assigned to reverse tunnels.  A restart after a crash or reboot resumes that
+// state rather than the configuration's
+type Journal struct {
+	File string `yaml:"file,omitempty" json:"file,omitempty"`
+}
+
+// GeoIP names the MaxMind DB files tunnel access rules look clients up in:
+// Country, a GeoLite2 or GeoIP2 country or city database, and ASN, a GeoLite2
+// ASN database.  Each is read again once its file changes
+type GeoIP struct {
+	Country string `yaml:"country,omitempty" json:"country,omitempty"`
+	ASN     string `yaml:"asn,omitempty" json:"asn,omitempty"`
+}
+
+// Leader pairs instances running the same configuration, only the one holding
+// the lock starting its tunnels while the others stand by to take over should
+// it die.  The lock is File, on storage every instance can reach, or Key in
+// Consul or etcd, 'auto-ssh/leader' by default.  TTL is how long the lock
+// outlives an instance that died holding it, 15 seconds by default
+type Leader struct {
+	File   string   `yaml:"file,omitempty" json:"file,omitempty"`
+	Consul *Consul  `yaml:"consul,omitempty" json:"consul,omitempty"`
+	Etcd   *Etcd    `yaml:"etcd,omitempty" json:"etcd,omitempty"`
+	Key    string   `yaml:"key,omitempty" json:"key,omitempty"`
+	TTL    Duration `yaml:"ttl,omitempty" json:"ttl,omitempty"`
+}
+
+// Registry publishes the entrances of started tunnels to service discovery so
+// other services can find them.  Advertise is the address published for tunnels
+// listening on every interface, and defaults to the host name
+type Registry struct {
+	Interval  Duration `yaml:"interval,omitempty" json:"interval,omitempty"`
+	Advertise string   `yaml:"advertise,omitempty" json:"advertise,omitempty"`
+	Consul    *Consul  `yaml:"consul,omitempty" json:"consul,omitempty"`
+	Etcd      *Etcd    `yaml:"etcd,omitempty" json:"etcd,omitempty"`
+}
+
+type Consul struct {
+	Address string `yaml:"address,omitempty" json:"address,omitempty"`
+	Token   string `yaml:"token,omitempty" json:"token,omitempty"`
+}
+
+type Etcd struct {
+	Endpoints []string `yaml:"endpoints,omitempty" json:"endpoints,omitempty"`
+	Prefix    string   `yaml:"prefix,omitempty" json:"prefix,omitempty"`
+}
+
+// Probe periodically measures the round trip time of each connected host's ssh
+// connection and the time taken to connect to each started tunnel's forward
+// address.  Probing is off unless configured
+type Probe struct {
+	Interval Duration `yaml:"interval,omitempty" json:"interval,omitempty"`
+}
+
+// Tor is the local Tor that hosts at .onion addresses, and those whose
+// transport is tor, are connected to through, at its SOCKS port,
+// 127.0.0.1:9050 by default.  Onion services are published through its
+// Control port, 127.0.0.1:9051 by default, authenticating with
+// ControlPassword, which may be env:NAME, or else the cookie Tor names
+type Tor struct {
+	SOCKS           string `yaml:"socks,omitempty" json:"socks,omitempty"`
+	Control         string `yaml:"control,omitempty" json:"control,omitempty"`
+	ControlPassword string `yaml:"controlPassword,omitempty" json:"controlPassword,omitempty"`
+}
+
+// StatsD pushes each tunnel's metrics every Interval, ten seconds by default,
+// to a StatsD server or the DogStatsD server of a Datadog agent at Address,
+// 127.0.0.1:8125 by default.  Metric names begin with Prefix, auto_ssh by
+// default.  With DogStatsD set the tunnel is named by a tag of each metric,
+// along with Tags, rather than in the metric's name
+type StatsD struct {
+	Address   string   `yaml:"address,omitempty" json:"address,omitempty"`
+	Interval  Duration `yaml:"interval,omitempty" json:"interval,omitempty"`
+	Prefix    string   `yaml:"prefix,omitempty" json:"prefix,omitempty"`
+	DogStatsD bool     `yaml:"dogstatsd,omitempty" json:"dogstatsd,omitempty"`
+	Tags      []string `yaml:"tags,omitempty" json:"tags,omitempty"`
+}
+
+// Health sets what the /healthz and /readyz endpoints check.  Require lists the
+// ids or names of the tunnels that must be started, defaulting to every tunnel
+// auto-ssh starts by itself, and Hosts requires their hosts to be connected too.
+// Grace is how long a required tunnel may be down before auto-ssh is unhealthy
+type Health struct {
+	Require []string `yaml:"require,omitempty" json:"require,omitempty"`
+	Hosts   bool     `yaml:"hosts,omitempty" json:"hosts,omitempty"`
+	Grace   Duration `yaml:"grace,omitempty" json:"grace,omitempty"`
+}
+
+// Host is an ssh server tunnels travel through.  Identity is the path of the
+// private key file, the key itself inline, or env:NAME naming the environment
+// variable holding it.  An sk-ssh-ed25519 or sk-ecdsa security key identity signs
+// through ssh-agent, which must hold the key.  HostKeyPolicy is accept-new, the
+// default, adding the keys of hosts not yet in known_hosts, strict, refusing
+// them, or off, checking no host keys at all.  MaxChannels caps the forwarded
+// channels sharing the host's ssh connection, further ones opening additional
+// connections, and is unlimited by default.  Socket tunes the tcp connection to
+// the host, not one through a jump host, which every channel shares.  The ssh
+// library fixes each channel's window at 2MiB and its packets at 32KiB, so on
+// a long fat link it is the connection's buffers that can be raised.
+// Transport is tcp, the default, websocket, carrying the connection in the
+// WebSocket described by WebSocket, Remote then naming the host as its
+// known_hosts does, or tor, connecting through Tor.  Hosts at .onion addresses
+// are always connected to through Tor
 type Host struct {
-	Id         string    `yaml:"id" json:"id"`
-	Name       string    `yaml:"name" json:"name"`
-	Remote     *Address  `yaml:"remote" json:"remove"`
-	Username   string    `yaml:"username" json:"username"`
-	Passphrase string    `yaml:"passphrase,omitempty"  json:"passphrase,omitempty"`
-	Identity   string    `yaml:"identity" json:"identity"`
-	KnownHosts string    `yaml:"knownHosts" json:"knownHosts"`
-	JumpHost   string    `yaml:"jumpHost" json:"jumpHost"`
-	Metadata   *Metadata `yaml:"metadata,omitempty" json:"metadata,omitempty"`
+	Id            string      `yaml:"id" json:"id"`
+	Name          string      `yaml:"name" json:"name"`
+	Remote        *Address    `yaml:"remote" json:"remove"`
+	Username      string      `yaml:"username" json:"username"`
+	Passphrase    string      `yaml:"passphrase,omitempty"  json:"passphrase,omitempty"`
+	Identity      string      `yaml:"identity" json:"identity"`
+	Keychain      bool        `yaml:"keychain,omitempty" json:"keychain,omitempty"`
+	KnownHosts    string      `yaml:"knownHosts" json:"knownHosts"`
+	HostKeyPolicy string      `yaml:"hostKeyPolicy,omitempty" json:"hostKeyPolicy,omitempty"`
+	JumpHost      string      `yaml:"jumpHost" json:"jumpHost"`
+	Algorithms    *Algorithms `yaml:"algorithms,omitempty" json:"algorithms,omitempty"`
+	Compression   bool        `yaml:"compression,omitempty" json:"compression,omitempty"`
+	MaxChannels   int         `yaml:"maxChannels,omitempty" json:"maxChannels,omitempty"`
+	Agent         *Agent      `yaml:"agent,omitempty" json:"agent,omitempty"`
+	PKCS11        *PKCS11     `yaml:"pkcs11,omitempty" json:"pkcs11,omitempty"`
+	AuthPlugin    *AuthPlugin `yaml:"authPlugin,omitempty" json:"authPlugin,omitempty"`
+	OTP           *OTP        `yaml:"otp,omitempty" json:"otp,omitempty"`
+	GSSAPI        *GSSAPI     `yaml:"gssapi,omitempty" json:"gssapi,omitempty"`
+	Timeouts      *Timeouts   `yaml:"timeouts,omitempty" json:"timeouts,omitempty"`
+	Socket        *Socket     `yaml:"socket,omitempty" json:"socket,omitempty"`
+	Metadata      *Metadata   `yaml:"metadata,omitempty" json:"metadata,omitempty"`
+	// CredentialHelper is a command asked for the host's password, identity
+	// passphrase and one-time passwords, in the manner of a git credential
+	// helper.  Secrets other than one-time passwords are cached for
+	// CredentialTTL, five minutes by default
+	CredentialHelper string   `yaml:"credentialHelper,omitempty" json:"credentialHelper,omitempty"`
+	CredentialTTL    Duration `yaml:"credentialTTL,omitempty" json:"credentialTTL,omitempty"`
+	// BannerAcks is a file of acknowledged banners.  When set, the host is only
+	// logged in to once the banner it shows before login has been acknowledged
+	// with banner ack, so a changed banner must be read again
+	BannerAcks string     `yaml:"bannerAcks,omitempty" json:"bannerAcks,omitempty"`
+	Recording  *Recording `yaml:"recording,omitempty" json:"recording,omitempty"`
+	Damping    *Damping   `yaml:"damping,omitempty" json:"damping,omitempty"`
+	Transport  string     `yaml:"transport,omitempty" json:"transport,omitempty"`
+	WebSocket  *WebSocket `yaml:"websocket,omitempty" json:"websocket,omitempty"`
+}
+
+// WebSocket carries a host's ssh connection in a WebSocket to URL, a ws:// or
+// wss:// address, for bastions exposed only through an https ingress.  Headers
+// are sent with the upgrade, such as the token an access proxy asks for, and
+// may each be env:NAME.  The https_proxy of the environment is connected
+// through, as corporate proxies require
+type WebSocket struct {
+	URL     string            `yaml:"url" json:"url"`
+	Headers map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+}
+
+// Damping holds a flapping host down rather than reconnecting each time a
+// tunnel asks for it.  A host whose connection drops Flaps times within Window
+// is declared unstable and not connected to for HoldDown, doubling each time
+// it is declared so again up to MaxHoldDown, until it stays connected for a
+// Window.  Failed connections are retried no more often than RetryInterval,
+// backing off up to MaxHoldDown while they keep failing
+type Damping struct {
+	Flaps         int      `yaml:"flaps,omitempty" json:"flaps,omitempty"`
+	Window        Duration `yaml:"window,omitempty" json:"window,omitempty"`
+	HoldDown      Duration `yaml:"holdDown,omitempty" json:"holdDown,omitempty"`
+	MaxHoldDown   Duration `yaml:"maxHoldDown,omitempty" json:"maxHoldDown,omitempty"`
+	RetryInterval Duration `yaml:"retryInterval,omitempty" json:"retryInterval,omitempty"`
+}
+
+// Recording records each session of ash exec on the host as an asciicast in
+// Directory, which asciinema plays back, the hashes of the recordings chained
+// in the directory's recordings.log for ash recording verify to check.  With
+// Input set what is typed is recorded as well as the output, passwords
+// included
+type Recording struct {
+	Directory string `yaml:"directory" json:"directory"`
+	Input     bool   `yaml:"input,omitempty" json:"input,omitempty"`
+}
+
+// Timeouts bound each stage of establishing a forwarded connection.  Connect
+// covers the tcp dial and ssh handshake, Channel the opening of a channel on an
+// established connection, and Dial the direct dial of a tunnel's forward address.
+// Idle is how long a host's ssh connection is kept open once nothing uses it.
+// ReadIdle and WriteIdle close a tunnel connection once no data has arrived
+// from, or been returned to, the client for that long, and are off by default.
+// Fallback is the head start the preferred address family of a dual stack name
+// gets before the other family is dialed in parallel.  Resolve is how often the
+// name of a connected host is looked up again to follow dns changes.  Lifetime
+// caps how long a host's ssh connection is used before it is replaced by a new
+// one, the shortest of the host's and its tunnels' applying, and is off by default
+type Timeouts struct {
+	Connect   Duration `yaml:"connect,omitempty" json:"connect,omitempty"`
+	Channel   Duration `yaml:"channel,omitempty" json:"channel,omitempty"`
+	Dial      Duration `yaml:"dial,omitempty" json:"dial,omitempty"`
+	Idle      Duration `yaml:"idle,omitempty" json:"idle,omitempty"`
+	ReadIdle  Duration `yaml:"readIdle,omitempty" json:"readIdle,omitempty"`
+	WriteIdle Duration `yaml:"writeIdle,omitempty" json:"writeIdle,omitempty"`
+	Fallback  Duration `yaml:"fallback,omitempty" json:"fallback,omitempty"`
+	Resolve   Duration `yaml:"resolve,omitempty" json:"resolve,omitempty"`
+	Lifetime  Duration `yaml:"lifetime,omitempty" json:"lifetime,omitempty"`
+}
+
+// Agent forwards an ssh agent to the host, so commands run there with exec can
+// authenticate onward as the user.  While a command runs, anyone with root on the
+// host can use the forwarded keys through the agent socket, which is why it is
+// off unless Forward is set.  Source is agent, the default, the local agent at
+// SSH_AUTH_SOCK or on Windows the OpenSSH agent or Pageant, or identity, offering
+// only the host's own identity.  Keys limits the keys offered, by SHA256
+// fingerprint or comment, and Confirm asks at the terminal before each
+// signature, so a key cannot be used unnoticed
+type Agent struct {
+	Forward bool     `yaml:"forward,omitempty" json:"forward,omitempty"`
+	Source  string   `yaml:"source,omitempty" json:"source,omitempty"`
+	Keys    []string `yaml:"keys,omitempty" json:"keys,omitempty"`
+	Confirm bool     `yaml:"confirm,omitempty" json:"confirm,omitempty"`
 }
 
+// PKCS11 authenticates with the keys of a smart card, or a YubiKey in PIV mode,
+// through its PKCS#11 provider library, such as /usr/lib/opensc-pkcs11.so, so
+// the keys are never exported.  Provider defaults to the --pkcs11 flag.  Pin
+// unlocks the card, given as the pin itself or env:NAME naming the environment
+// variable holding it
+type PKCS11 struct {
+	Provider string `yaml:"provider,omitempty" json:"provider,omitempty"`
+	Pin      string `yaml:"pin,omitempty" json:"-"`
+}
+
+// AuthPlugin hands a host's authentication to an external command, such as the
+// client of an in-house certificate authority or MFA system.  Command is run
+// with Args each time the host connects, and to answer keyboard-interactive
+// questions, exchanging json as described by the authplugin package.  Config is
+// passed to the command as is, and Timeout bounds each run, ten seconds by
+// default
+type AuthPlugin struct {
+	Command string            `yaml:"command" json:"command"`
+	Args    []string          `yaml:"args,omitempty" json:"args,omitempty"`
+	Config  map[string]string `yaml:"config,omitempty" json:"config,omitempty"`
+	Timeout Duration          `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+}
+
+// OTP answers the one-time password prompts of a host's keyboard-interactive
+// authentication, such as Google Authenticator's "Verification code:", so the
+// host reconnects unattended.  Secret is the base32 TOTP secret, or otpauth://
+// uri, enrolled in the authenticator, given as the secret itself or env:NAME
+// naming the environment variable holding it.  Hosts with keychain set read it
+// from the OS keychain when it is absent, and without any secret the code is
+// asked for at the terminal.  Digits and Period, six and thirty seconds by
+// default, match the authenticator's.  Prompt is a regular expression matching
+// the prompts answered, by default those mentioning a code, token, otp or
+// verification
+type OTP struct {
+	Secret string   `yaml:"secret,omitempty" json:"-"`
+	Digits int      `yaml:"digits,omitempty" json:"digits,omitempty"`
+	Period Duration `yaml:"period,omitempty" json:"period,omitempty"`
+	Prompt string   `yaml:"prompt,omitempty" json:"prompt,omitempty"`
+}
+
+// GSSAPI authenticates with the Kerberos tickets of the user's credentials
+// cache, as kinit or sssd leave them, for bastions joined to Active Directory
+// that accept no keys.  CCache defaults to $KRB5CCNAME, then /tmp/krb5cc_<uid>,
+// and must be a file.  Krb5Conf defaults to $KRB5_CONFIG, then /etc/krb5.conf.
+// The cache is read again for each connection, so renewed tickets are used.
+// ServicePrincipal is the host's, host/<remote host> by default
+type GSSAPI struct {
+	CCache           string `yaml:"ccache,omitempty" json:"ccache,omitempty"`
+	Krb5Conf         string `yaml:"krb5Conf,omitempty" json:"krb5Conf,omitempty"`
+	ServicePrincipal string `yaml:"servicePrincipal,omitempty" json:"servicePrincipal,omitempty"`
+}
+
+// Prewarm keeps Size channels to a tunnel's forward address open while it runs,
+// so a client connection does not wait for one to open.  A channel unused for
+// MaxIdle, a minute by default, is replaced, as servers drop connections left
+// silent.  Ping checks the host's ssh connection with a keepalive before a
+// channel is handed out, so one on a dead connection is never used
+type Prewarm struct {
+	Size    int      `yaml:"size" json:"size"`
+	MaxIdle Duration `yaml:"maxIdle,omitempty" json:"maxIdle,omitempty"`
+	Ping    bool     `yaml:"ping,omitempty" json:"ping,omitempty"`
+}
+
+// RateLimit caps the connections each client address may open through a
+// tunnel: Rate a second once a Burst of them, Rate rounded up by default, is
+// spent, and Concurrent at once.  Either is unlimited when zero.  Connections
+// beyond are closed as soon as they are accepted
+type RateLimit struct {
+	Rate       float64 `yaml:"rate,omitempty" json:"rate,omitempty"`
+	Burst      int     `yaml:"burst,omitempty" json:"burst,omitempty"`
+	Concurrent int     `yaml:"concurrent,omitempty" json:"concurrent,omitempty"`
+}
+
+// Access decides which clients may connect through a tunnel by their address.
+// A client is refused should it match a Deny rule, or, given Allow rules, match
+// none of them.  Each rule is a cidr or address, country:CC for a country by
+// its ISO code, or asn:N for an autonomous system, the last two looked up in
+// the geoip databases
+type Access struct {
+	Allow []string `yaml:"allow,omitempty" json:"allow,omitempty"`
+	Deny  []string `yaml:"deny,omitempty" json:"deny,omitempty"`
+}
+
+// Auth has clients authenticate on connecting, before anything they send is
+// forwarded, so an entrance others can reach is not raw access to what it
+// forwards to.  A client answers a challenge with the shared Secret, or
+// presents a token signed with it by ash entrance token.  Another auto-ssh
+// forwarding to the entrance authenticates with its tunnel's remoteAuth.  The
+// secret may be env:NAME
+type Auth struct {
+	Secret string `yaml:"secret,omitempty" json:"-"`
+}
+
+// RemoteAuth authenticates to the forward address, the entrance of another
+// auto-ssh requiring auth, with the Token when given and otherwise the shared
+// Secret, before the client's traffic is forwarded.  Either may be env:NAME
+type RemoteAuth struct {
+	Secret string `yaml:"secret,omitempty" json:"-"`
+	Token  string `yaml:"token,omitempty" json:"-"`
+}
+
+// Watchdog sends probe traffic through a tunnel end to end every Interval, as
+// autossh -M does, recycling the host's ssh connection once Failures probes in
+// a row have failed, for a connection that answers keepalives yet no longer
+// carries traffic.  A probe connects to the forward address through the host,
+// or for a reverse tunnel to its entrance from the host.  With Echo set the
+// probe also writes to the connection and waits for the bytes to come back, for
+// a tunnel to an echo service.  Probes are abandoned after Timeout
+type Watchdog struct {
+	Interval Duration `yaml:"interval,omitempty" json:"interval,omitempty"`
+	Timeout  Duration `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	Failures int      `yaml:"failures,omitempty" json:"failures,omitempty"`
+	Echo     bool     `yaml:"echo,omitempty" json:"echo,omitempty"`
+}
+
+// Retry dials a tunnel's forward address again, up to Attempts more times, when
+// it cannot be reached, so a client is not turned away while the target is still
+// coming up.  Delay is the wait before the first retry, doubling up to MaxDelay
+type Retry struct {
+	Attempts int      `yaml:"attempts,omitempty" json:"attempts,omitempty"`
+	Delay    Duration `yaml:"delay,omitempty" json:"delay,omitempty"`
+	MaxDelay Duration `yaml:"maxDelay,omitempty" json:"maxDelay,omitempty"`
+}
+
+// Queue holds clients accepted while a tunnel's host is reconnecting, up to
+// Size of them, rather than turn them away, each waiting up to Timeout for the
+// host to come back.  Clients beyond Size, or still waiting after Timeout, are
+// reset, http tunnels' with a 503
+type Queue struct {
+	Size    int      `yaml:"size,omitempty" json:"size,omitempty"`
+	Timeout Duration `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+}
+
+// Stripe spreads each connection through a tunnel across Streams channels to
+// its host, four by default, so a bulk transfer over a long fat link is not
+// held to what one channel's window allows.  The channels are put back
+// together by ash stripe listening at Server, 127.0.0.1:7900 by default, as
+// the host reaches it, which connects on to the forward address
+type Stripe struct {
+	Streams int      `yaml:"streams,omitempty" json:"streams,omitempty"`
+	Server  *Address `yaml:"server,omitempty" json:"server,omitempty"`
+}
+
+// Onion publishes a reverse tunnel's forward address as a Tor onion service on
+// Port, the forward address's port by default, alongside its entrance on its
+// host.  The service's key is kept in KeyFile, so its address outlives
+// restarts, a new address being made each start without one.  Clients over Tor
+// reach the forward address directly, not through the tunnel's access rules
+// or auth
+type Onion struct {
+	Port    int    `yaml:"port,omitempty" json:"port,omitempty"`
+	KeyFile string `yaml:"keyFile,omitempty" json:"keyFile,omitempty"`
+}
+
+type Algorithms struct {
+	Ciphers           []string `yaml:"ciphers,omitempty" json:"ciphers,omitempty"`
+	MACs              []string `yaml:"macs,omitempty" json:"macs,omitempty"`
+	KeyExchanges      []string `yaml:"keyExchanges,omitempty" json:"keyExchanges,omitempty"`
+	HostKeyAlgorithms []string `yaml:"hostKeyAlgorithms,omitempty" json:"hostKeyAlgorithms,omitempty"`
+}
+
+// Tunnel is a forward from a local entrance to a remote address.  A tunnel
+// that is not enabled never starts, while one that does not autostart waits to
+// be started through the api or cli.  A scheduled tunnel only runs within its
+// schedule's windows.  A reverse tunnel, as ssh -R, opens its entrance on the
+// host instead, its clients' connections being forwarded from the local
+// machine, and a reverse socks tunnel has them reach any address from here
 type Tunnel struct {
-	Id       string    `yaml:"id" json:"id"`
-	Name     string    `yaml:"name" json:"name"`
-	Local    *Address  `yaml:"local" json:"local"`
-	Remote   *Address  `yaml:"remote" json:"remote"`
-	Host     string    `yaml:"host,omitempty" json:"host,omitempty"`
-	Metadata *Metadata `yaml:"metadata,omitempty" json:"metadata,omitempty"`
-	Status   *Status   `yaml:"status,omitempty" json:"status,omitempty"`
+	Id         string      `yaml:"id" json:"id"`
+	Name       string      `yaml:"name" json:"name"`
+	Local      *Address    `yaml:"local" json:"local"`
+	Remote     *Address    `yaml:"remote" json:"remote"`
+	Host       string      `yaml:"host,omitempty" json:"host,omitempty"`
+	Bind       string      `yaml:"bind,omitempty" json:"bind,omitempty"`
+	Reverse    bool        `yaml:"reverse,omitempty" json:"reverse,omitempty"`
+	Enabled    *bool       `yaml:"enabled,omitempty" json:"enabled,omitempty"`
+	Autostart  *bool       `yaml:"autostart,omitempty" json:"autostart,omitempty"`
+	Require    bool        `yaml:"require,omitempty" json:"require,omitempty"`
+	Schedule   *Schedule   `yaml:"schedule,omitempty" json:"schedule,omitempty"`
+	Retry      *Retry      `yaml:"retry,omitempty" json:"retry,omitempty"`
+	Queue      *Queue      `yaml:"queue,omitempty" json:"queue,omitempty"`
+	Stripe     *Stripe     `yaml:"stripe,omitempty" json:"stripe,omitempty"`
+	Onion      *Onion      `yaml:"onion,omitempty" json:"onion,omitempty"`
+	Prewarm    *Prewarm    `yaml:"prewarm,omitempty" json:"prewarm,omitempty"`
+	Watchdog   *Watchdog   `yaml:"watchdog,omitempty" json:"watchdog,omitempty"`
+	RateLimit  *RateLimit  `yaml:"rateLimit,omitempty" json:"rateLimit,omitempty"`
+	Access     *Access     `yaml:"access,omitempty" json:"access,omitempty"`
+	Auth       *Auth       `yaml:"auth,omitempty" json:"auth,omitempty"`
+	RemoteAuth *RemoteAuth `yaml:"remoteAuth,omitempty" json:"remoteAuth,omitempty"`
+	Socks      *Socks      `yaml:"socks,omitempty" json:"socks,omitempty"`
+	TLS        *TLS        `yaml:"tls,omitempty" json:"tls,omitempty"`
+	Routes     []*Route    `yaml:"routes,omitempty" json:"routes,omitempty"`
+	HTTP       *HTTP       `yaml:"http,omitempty" json:"http,omitempty"`
+	Sniff      bool        `yaml:"sniff,omitempty" json:"sniff,omitempty"`
+	Capture    *Capture    `yaml:"capture,omitempty" json:"capture,omitempty"`
+	Filters    []*Filter   `yaml:"filters,omitempty" json:"filters,omitempty"`
+	Timeouts   *Timeouts   `yaml:"timeouts,omitempty" json:"timeouts,omitempty"`
+	Socket     *Socket     `yaml:"socket,omitempty" json:"socket,omitempty"`
+	Metadata   *Metadata   `yaml:"metadata,omitempty" json:"metadata,omitempty"`
+	Status     *Status     `yaml:"status,omitempty" json:"status,omitempty"`
+}
+
+// Socks makes the tunnel a SOCKS5 proxy, as ssh -D does, each client naming
+// the address to reach through the host in place of a forward address.  With
+// Username set, clients must give it and Password, so an entrance others can
+// reach is not an open proxy.  The password may be env:NAME
+type Socks struct {
+	Username string `yaml:"username,omitempty" json:"username,omitempty"`
+	Password string `yaml:"password,omitempty" json:"-"`
+}
+
+func (s *Socks) Validate(group string, name string) bool {
+	if s == nil {
+		return true
+	}
+	valid := true
+	if s.Username != "" && s.Password == "" {
+		log.Printf("  Error - %s(%s) socks username requires a password\n", group, name)
+		valid = false
+	} else if s.Username == "" && s.Password != "" {
+		log.Printf("  Error - %s(%s) socks password requires a username\n", group, name)
+		valid = false
+	} else if len(s.Username) > 255 {
+		log.Printf("  Error - %s(%s) socks username cannot be longer than 255 bytes\n", group, name)
+		valid = false
+	}
+	if env, ok := strings.CutPrefix(s.Password, "env:"); ok && os.Getenv(env) == "" {
+		log.Printf("  Error - %s(%s) socks password environment variable (%s) is not set\n", group, name, env)
+		valid = false
+	} else if !ok && len(s.Password) > 255 {
+		log.Printf("  Error - %s(%s) socks password cannot be longer than 255 bytes\n", group, name)
+		valid = false
+	}
+	return valid
+}
+
+// Credentials are the username and password clients must give, the password
+// read from the environment when given as env:NAME.  Both are blank when
+// clients need not authenticate
+func (s *Socks) Credentials() (string, string) {
+	if s == nil {
+		return "", ""
+	}
+	if env, ok := strings.CutPrefix(s.Password, "env:"); ok {
+		return s.Username, os.Getenv(env)
+	}
+	return s.Username, s.Password
+}
+
+func (a *Auth) Validate(group string, name string) bool {
+	if a == nil {
+		return true
+	}
+	return validateSecret(group, name, "auth secret", a.Secret, true)
+}
+
+// SecretOrBlank is the shared secret, read from the environment when given
+// as env:NAME
+func (a *Auth) SecretOrBlank() string {
+	if a == nil {
+		return ""
+	}
+	return fromEnv(a.Secret)
+}
+
+func (r *RemoteAuth) Validate(group string, name string) bool {
+	if r == nil {
+		return true
+	}
+	if r.Secret == "" && r.Token == "" {
+		log.Printf("  Error - %s(%s) remoteAuth requires a secret or token\n", group, name)
+		return false
+	}
+	if r.Secret != "" && r.Token != "" {
+		log.Printf("  Error - %s(%s) remoteAuth cannot have both a secret and a token\n", group, name)
+		return false
+	}
+	if r.Token != "" {
+		return validateSecret(group, name, "remoteAuth token", r.Token, false)
+	}
+	return validateSecret(group, name, "remoteAuth secret", r.Secret, true)
+}
+
+// SecretOrBlank is the shared secret, read from the environment when given
+// as env:NAME
+func (r *RemoteAuth) SecretOrBlank() string {
+	if r == nil {
+		return ""
+	}
+	return fromEnv(r.Secret)
+}
+
+// TokenOrBlank is the token, read from the environment when given as env:NAME
+func (r *RemoteAuth) TokenOrBlank() string {
+	if r == nil {
+		return ""
+	}
+	return fromEnv(r.Token)
+}
+
+// validateSecret checks a secret is given and, named as env:NAME, that its
+// environment variable is set, warning of one too short to resist guessing
+func validateSecret(group string, name string, field string, secret string, warnShort bool) bool {
+	if secret == "" {
+		log.Printf("  Error - %s(%s) %s cannot be blank\n", group, name, field)
+		return false
+	}
+	if env, ok := strings.CutPrefix(secret, "env:"); ok && os.Getenv(env) == "" {
+		log.Printf("  Error - %s(%s) %s environment variable (%s) is not set\n", group, name, field, env)
+		return false
+	}
+	if warnShort && len(fromEnv(secret)) < MinAuthSecretLength {
+		log.Printf("  Warn  - %s(%s) %s is shorter than %d characters\n", group, name, field, MinAuthSecretLength)
+	}
+	return true
+}
+
+func fromEnv(value string) string {
+	if env, ok := strings.CutPrefix(value, "env:"); ok {
+		return os.Getenv(env)
+	}
+	return value
+}
+
+// TLS has the tunnel's entrance serve tls, the client's traffic being
+// forwarded as plain text, for clients that insist on tls to a service that
+// has none.  Without a certificate one is signed by the tunnel itself
+type TLS struct {
+	CertificateFile string `yaml:"certificateFile,omitempty" json:"certificateFile,omitempty"`
+	CertificateKey  string `yaml:"certificateKey,omitempty" json:"certificateKey,omitempty"`
+}
+
+func (t *TLS) Validate(group string, name string) bool {
+	if t == nil {
+		return true
+	}
+	if t.CertificateFile != "" && t.CertificateKey == "" {
+		log.Printf("  Error - %s(%s) tls certificateKey must be specified if certificateFile is set\n", group, name)
+		return false
+	} else if t.CertificateFile == "" && t.CertificateKey != "" {
+		log.Printf("  Error - %s(%s) tls certificateFile must be specified if certificateKey is set\n", group, name)
+		return false
+	}
+	return true
+}
+
+// SelfSigned reports whether the tunnel signs its own certificate
+func (t *TLS) SelfSigned() bool {
+	return t != nil && t.CertificateFile == ""
+}
+
+// HTTP has the tunnel proxy http to its forward address, sending the Host
+// header the service expects and pointing the absolute urls of its redirects
+// back at the entrance, for web apps that build urls from their own name
+type HTTP struct {
+	// Host is sent to the service in place of the client's, the forward
+	// address by default
+	Host string `yaml:"host,omitempty" json:"host,omitempty"`
+}
+
+func (h *HTTP) Validate(group string, name string) bool {
+	if h == nil {
+		return true
+	}
+	h.Host = strings.TrimSpace(h.Host)
+	if strings.ContainsAny(h.Host, "/ ") {
+		log.Printf("  Error - %s(%s) http host(%s) must be a host name, optionally with a port\n", group, name, h.Host)
+		return false
+	}
+	return true
+}
+
+// HostOrDefault is the Host header sent to the service at the forward address
+func (h *HTTP) HostOrDefault(forward string) string {
+	if h == nil || h.Host == "" {
+		return forward
+	}
+	return h.Host
+}
+
+// Capture writes the traffic of the tunnel's connections to File in pcap
+// format, as the client sends and receives it, so tls the tunnel terminates is
+// captured decrypted.  The capture starts with the tunnel and stops once the
+// file holds MaxSize megabytes, 10 by default, or Duration has passed
+type Capture struct {
+	File     string   `yaml:"file" json:"file"`
+	MaxSize  int      `yaml:"maxSize,omitempty" json:"maxSize,omitempty"`
+	Duration Duration `yaml:"duration,omitempty" json:"duration,omitempty"`
+}
+
+func (c *Capture) Validate(group string, name string) bool {
+	if c == nil {
+		return true
+	}
+	valid := true
+	if strings.TrimSpace(c.File) == "" {
+		log.Printf("  Error - %s(%s) capture file cannot be blank\n", group, name)
+		valid = false
+	}
+	if c.MaxSize < 0 {
+		log.Printf("  Error - %s(%s) capture maxSize(%d) cannot be negative\n", group, name, c.MaxSize)
+		valid = false
+	}
+	if c.Duration < 0 {
+		log.Printf("  Error - %s(%s) capture duration(%s) cannot be negative\n", group, name, c.Duration)
+		valid = false
+	}
+	return valid
+}
+
+// MaxBytes is the size the capture file may grow to
+func (c *Capture) MaxBytes() int64 {
+	if c == nil || c.MaxSize == 0 {
+		return DefaultCaptureMaxSize << 20
+	}
+	return int64(c.MaxSize) << 20
+}
+
+// Filter inspects the first bytes each client of the tunnel sends, before they
+// are forwarded, and may close the connection.  Name picks a filter built in or
+// registered with the filter package, such as ldap-plaintext-bind, and Command
+// an external one run with Args, exchanging json as described by the filter
+// package.  Config is passed to either, and Timeout bounds each run of a
+// command, ten seconds by default
+type Filter struct {
+	Name    string            `yaml:"name,omitempty" json:"name,omitempty"`
+	Command string            `yaml:"command,omitempty" json:"command,omitempty"`
+	Args    []string          `yaml:"args,omitempty" json:"args,omitempty"`
+	Config  map[string]string `yaml:"config,omitempty" json:"config,omitempty"`
+	Timeout Duration          `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+}
+
+func (f *Filter) Validate(group string, name string) bool {
+	valid := true
+	if (f.Name == "") == (f.Command == "") {
+		log.Printf("  Error - %s(%s) filter requires either a name or a command\n", group, name)
+		valid = false
+	} else if f.Command != "" {
+		if _, err := exec.LookPath(f.Command); err != nil {
+			log.Printf("  Error - %s(%s) filter command (%s) cannot be run: %v\n", group, name, f.Command, err)
+			valid = false
+		}
+	}
+	if f.Timeout < 0 {
+		log.Printf("  Error - %s(%s) filter timeout(%s) cannot be negative\n", group, name, f.Timeout)
+		valid = false
+	}
+	return valid
+}
+
+func (f *Filter) TimeoutOrDefault() time.Duration {
+	return f.Timeout.OrDefault(DefaultFilterTimeout)
+}
+
+// Socket tunes the tcp sockets of a tunnel.  NoDelay, KeepAlive and the buffer
+// sizes apply to client connections and direct forward connections, while the
+// reuse options apply to the tunnel's listener.  Unset values keep the
+// operating system defaults
+type Socket struct {
+	NoDelay           *bool    `yaml:"noDelay,omitempty" json:"noDelay,omitempty"`
+	KeepAlive         *bool    `yaml:"keepAlive,omitempty" json:"keepAlive,omitempty"`
+	KeepAliveInterval Duration `yaml:"keepAliveInterval,omitempty" json:"keepAliveInterval,omitempty"`
+	SendBuffer        int      `yaml:"sendBuffer,omitempty" json:"sendBuffer,omitempty"`
+	ReceiveBuffer     int      `yaml:"receiveBuffer,omitempty" json:"receiveBuffer,omitempty"`
+	ReuseAddress      bool     `yaml:"reuseAddress,omitempty" json:"reuseAddress,omitempty"`
+	ReusePort         bool     `yaml:"reusePort,omitempty" json:"reusePort,omitempty"`
 }
 
 type Status struct {
@@ -93,6 +909,30 @@ type Web struct {
 	CertificateFile string `yaml:"certificateFile,omitempty" json:"certificateFile,omitempty"`
 	CertificateKey  string `yaml:"certificateKey,omitempty" json:"certificateKey,omitempty"`
 	KeyPassphrase   string `yaml:"keyPassphrase,omitempty" json:"keyPassphrase,omitempty"`
+	// GrpcPort serves the gRPC control interface alongside the REST api, with
+	// the same certificates and tokens.  Zero disables it
+	GrpcPort int16 `yaml:"grpcPort,omitempty" json:"grpcPort,omitempty"`
+	// Tokens, when any are given, must be presented by every request as a
+	// bearer token, those with read access only being refused changes.  With
+	// ReadOnly set nothing may be changed whatever the token
+	Tokens   []*Token `yaml:"tokens,omitempty" json:"tokens,omitempty"`
+	ReadOnly bool     `yaml:"readOnly,omitempty" json:"readOnly,omitempty"`
+	// TokenFile keeps the tokens issued by token create.  Without it they are
+	// forgotten when auto-ssh exits
+	TokenFile string `yaml:"tokenFile,omitempty" json:"tokenFile,omitempty"`
+	// ClientCA requires a client certificate signed by it of every request,
+	// https only.  ClientCertificate and ClientKey are presented by the cli
+	ClientCA          string `yaml:"clientCA,omitempty" json:"clientCA,omitempty"`
+	ClientCertificate string `yaml:"clientCertificate,omitempty" json:"clientCertificate,omitempty"`
+	ClientKey         string `yaml:"clientKey,omitempty" json:"clientKey,omitempty"`
+}
+
+// Token grants access to the api to whoever presents it, read by default or
+// admin to make changes
+type Token struct {
+	Name   string `yaml:"name,omitempty" json:"name,omitempty"`
+	Token  string `yaml:"token" json:"token"`
+	Access string `yaml:"access,omitempty" json:"access,omitempty"`
 }
 
 func NewConfig() *Configuration {
@@ -108,11 +948,24 @@ func NewConfig() *Configuration {
 				{Metric: "Id", Ascending: true},
 			},
 		},
-		Web: &Web{},
+		Web:     &Web{},
+		Audit:   &Audit{},
+		Logging: &Logging{},
 	}
 	return &config
 }
 
+// Fingerprint identifies a definition so a reloaded configuration can tell which
+// of its hosts and tunnels changed.  It must be taken before validation, which
+// may normalise the definition
+func Fingerprint(v interface{}) string {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(bs)
+}
+
 func (c *Configuration) WriteConfig() {
 
 }
@@ -120,6 +973,706 @@ func (c *Configuration) Validate() Validations {
 	return NewValidations()
 }
 
+func (t *Timeouts) Validate(group string, name string) bool {
+	if t == nil {
+		return true
+	}
+	valid := true
+	attrs := []string{"connect", "channel", "dial", "idle", "readIdle", "writeIdle", "fallback", "resolve", "lifetime"}
+	for i, d := range []Duration{t.Connect, t.Channel, t.Dial, t.Idle, t.ReadIdle, t.WriteIdle, t.Fallback, t.Resolve, t.Lifetime} {
+		if d < 0 {
+			log.Printf("  Error - %s(%s) %s timeout(%s) cannot be negative\n", group, name, attrs[i], d)
+			valid = false
+		} else if d > 0 && timeoutIgnored(group, attrs[i]) {
+			log.Printf("  Warn  - %s(%s) %s timeout(%s) ignored, as it has no effect on a %s\n", group, name, attrs[i], d, group)
+		}
+	}
+	return valid
+}
+
+// timeoutIgnored reports whether the timeout has no effect on the group: the
+// ssh connection's timeouts are the host's, and the forwarded connection's the
+// tunnel's
+func timeoutIgnored(group string, attr string) bool {
+	switch group {
+	case "host":
+		return attr == "dial" || attr == "readIdle" || attr == "writeIdle"
+	case "tunnel":
+		return attr == "connect" || attr == "channel" || attr == "resolve"
+	}
+	return false
+}
+
+func (r *Retry) Validate(group string, name string) bool {
+	if r == nil {
+		return true
+	}
+	valid := true
+	if r.Attempts < 0 {
+		log.Printf("  Error - %s(%s) retry attempts(%d) cannot be negative\n", group, name, r.Attempts)
+		valid = false
+	}
+	if r.Delay < 0 {
+		log.Printf("  Error - %s(%s) retry delay(%s) cannot be negative\n", group, name, r.Delay)
+		valid = false
+	}
+	if r.MaxDelay < 0 {
+		log.Printf("  Error - %s(%s) retry maxDelay(%s) cannot be negative\n", group, name, r.MaxDelay)
+		valid = false
+	}
+	return valid
+}
+
+func (r *Retry) AttemptsOrZero() int {
+	if r == nil {
+		return 0
+	}
+	return r.Attempts
+}
+
+func (r *Retry) DelayOrDefault() time.Duration {
+	if r == nil {
+		return DefaultRetryDelay
+	}
+	return r.Delay.OrDefault(DefaultRetryDelay)
+}
+
+func (r *Retry) MaxDelayOrDefault() time.Duration {
+	if r == nil {
+		return DefaultRetryMaxDelay
+	}
+	return r.MaxDelay.OrDefault(DefaultRetryMaxDelay)
+}
+
+func (q *Queue) Validate(group string, name string) bool {
+	if q == nil {
+		return true
+	}
+	valid := true
+	if q.Size < 0 {
+		log.Printf("  Error - %s(%s) queue size(%d) cannot be negative\n", group, name, q.Size)
+		valid = false
+	}
+	if q.Timeout < 0 {
+		log.Printf("  Error - %s(%s) queue timeout(%s) cannot be negative\n", group, name, q.Timeout)
+		valid = false
+	}
+	return valid
+}
+
+func (q *Queue) SizeOrDefault() int {
+	if q == nil || q.Size == 0 {
+		return DefaultQueueSize
+	}
+	return q.Size
+}
+
+func (q *Queue) TimeoutOrDefault() time.Duration {
+	if q == nil {
+		return DefaultQueueTimeout
+	}
+	return q.Timeout.OrDefault(DefaultQueueTimeout)
+}
+
+func (s *Stripe) Validate(group string, name string) bool {
+	if s == nil {
+		return true
+	}
+	valid := true
+	if s.Streams < 0 || s.Streams > stripe.MaxStreams {
+		log.Printf("  Error - %s(%s) stripe streams(%d) must be between 1 and %d\n", group, name, s.Streams, stripe.MaxStreams)
+		valid = false
+	}
+	if s.Server == nil {
+		s.Server = NewAddress(DefaultStripeServer)
+	}
+	if !s.Server.Validate(group, name, "stripe server", true, false) {
+		valid = false
+	}
+	return valid
+}
+
+func (s *Stripe) StreamsOrDefault() int {
+	if s.Streams == 0 {
+		return DefaultStripeStreams
+	}
+	return s.Streams
+}
+
+func (r *RateLimit) Validate(group string, name string) bool {
+	if r == nil {
+		return true
+	}
+	valid := true
+	if r.Rate < 0 {
+		log.Printf("  Error - %s(%s) rateLimit rate(%g) cannot be negative\n", group, name, r.Rate)
+		valid = false
+	}
+	if r.Burst < 0 {
+		log.Printf("  Error - %s(%s) rateLimit burst(%d) cannot be negative\n", group, name, r.Burst)
+		valid = false
+	} else if r.Burst > 0 && r.Rate == 0 {
+		log.Printf("  Error - %s(%s) rateLimit burst requires a rate\n", group, name)
+		valid = false
+	}
+	if r.Concurrent < 0 {
+		log.Printf("  Error - %s(%s) rateLimit concurrent(%d) cannot be negative\n", group, name, r.Concurrent)
+		valid = false
+	}
+	if valid && r.Rate == 0 && r.Concurrent == 0 {
+		log.Printf("  Warn  - %s(%s) rateLimit sets neither rate nor concurrent\n", group, name)
+	}
+	return valid
+}
+
+func (r *RateLimit) BurstOrDefault() int {
+	if r.Burst == 0 {
+		return int(math.Ceil(r.Rate))
+	}
+	return r.Burst
+}
+
+func (t *Traffic) Validate() bool {
+	if t == nil {
+		return true
+	}
+	if t.Flush < 0 {
+		log.Printf("  Error - traffic flush(%s) cannot be negative\n", t.Flush)
+		return false
+	}
+	return true
+}
+
+func (t *Traffic) FileOrBlank() string {
+	if t == nil {
+		return ""
+	}
+	return t.File
+}
+
+func (g *GeoIP) CountryOrBlank() string {
+	if g == nil {
+		return ""
+	}
+	return g.Country
+}
+
+func (g *GeoIP) ASNOrBlank() string {
+	if g == nil {
+		return ""
+	}
+	return g.ASN
+}
+
+func (j *Journal) FileOrBlank() string {
+	if j == nil {
+		return ""
+	}
+	return j.File
+}
+
+func (t *Traffic) FlushOrDefault() time.Duration {
+	if t == nil {
+		return DefaultTrafficFlush
+	}
+	return t.Flush.OrDefault(DefaultTrafficFlush)
+}
+
+func (p *Prewarm) Validate(group string, name string) bool {
+	if p == nil {
+		return true
+	}
+	valid := true
+	if p.Size < 0 {
+		log.Printf("  Error - %s(%s) prewarm size(%d) cannot be negative\n", group, name, p.Size)
+		valid = false
+	}
+	if p.MaxIdle < 0 {
+		log.Printf("  Error - %s(%s) prewarm maxIdle(%s) cannot be negative\n", group, name, p.MaxIdle)
+		valid = false
+	}
+	return valid
+}
+
+func (p *Prewarm) SizeOrZero() int {
+	if p == nil {
+		return 0
+	}
+	return p.Size
+}
+
+func (w *Watchdog) Validate(group string, name string) bool {
+	if w == nil {
+		return true
+	}
+	valid := true
+	if w.Interval < 0 {
+		log.Printf("  Error - %s(%s) watchdog interval(%s) cannot be negative\n", group, name, w.Interval)
+		valid = false
+	}
+	if w.Timeout < 0 {
+		log.Printf("  Error - %s(%s) watchdog timeout(%s) cannot be negative\n", group, name, w.Timeout)
+		valid = false
+	}
+	if w.Failures < 0 {
+		log.Printf("  Error - %s(%s) watchdog failures(%d) cannot be negative\n", group, name, w.Failures)
+		valid = false
+	}
+	return valid
+}
+
+func (w *Watchdog) IntervalOrDefault() time.Duration {
+	return w.Interval.OrDefault(DefaultWatchdogInterval)
+}
+
+func (w *Watchdog) TimeoutOrDefault() time.Duration {
+	return w.Timeout.OrDefault(DefaultWatchdogTimeout)
+}
+
+func (w *Watchdog) FailuresOrDefault() int {
+	if w.Failures == 0 {
+		return DefaultWatchdogFailures
+	}
+	return w.Failures
+}
+
+func (w *WebSocket) Validate(group string, name string) bool {
+	if w == nil {
+		log.Printf("  Error - %s(%s) websocket transport requires a websocket url\n", group, name)
+		return false
+	}
+	valid := true
+	u, err := url.Parse(w.URL)
+	switch {
+	case w.URL == "":
+		log.Printf("  Error - %s(%s) websocket url cannot be blank\n", group, name)
+		valid = false
+	case err != nil:
+		log.Printf("  Error - %s(%s) websocket url (%s) invalid: %v\n", group, name, w.URL, err)
+		valid = false
+	case u.Scheme != "ws" && u.Scheme != "wss":
+		log.Printf("  Error - %s(%s) websocket url (%s) must be ws:// or wss://\n", group, name, w.URL)
+		valid = false
+	case u.Host == "":
+		log.Printf("  Error - %s(%s) websocket url (%s) requires a host\n", group, name, w.URL)
+		valid = false
+	}
+	for header, value := range w.Headers {
+		if env, ok := strings.CutPrefix(value, "env:"); ok && os.Getenv(env) == "" {
+			log.Printf("  Error - %s(%s) websocket header %s environment variable (%s) is not set\n", group, name, header, env)
+			valid = false
+		}
+	}
+	return valid
+}
+
+// Header returns the headers sent with the upgrade, read from the environment
+// where named so
+func (w *WebSocket) Header() http.Header {
+	header := http.Header{}
+	for name, value := range w.Headers {
+		header.Set(name, fromEnv(value))
+	}
+	return header
+}
+
+func (d *Damping) Validate(group string, name string) bool {
+	if d == nil {
+		return true
+	}
+	valid := true
+	if d.Flaps < 0 {
+		log.Printf("  Error - %s(%s) damping flaps(%d) cannot be negative\n", group, name, d.Flaps)
+		valid = false
+	}
+	attrs := []string{"window", "holdDown", "maxHoldDown", "retryInterval"}
+	for i, v := range []Duration{d.Window, d.HoldDown, d.MaxHoldDown, d.RetryInterval} {
+		if v < 0 {
+			log.Printf("  Error - %s(%s) damping %s(%s) cannot be negative\n", group, name, attrs[i], v)
+			valid = false
+		}
+	}
+	if valid && d.MaxHoldDownOrDefault() < d.HoldDownOrDefault() {
+		log.Printf("  Error - %s(%s) damping maxHoldDown(%s) cannot be less than holdDown(%s)\n",
+			group, name, d.MaxHoldDownOrDefault(), d.HoldDownOrDefault())
+		valid = false
+	}
+	return valid
+}
+
+func (d *Damping) FlapsOrDefault() int {
+	if d.Flaps == 0 {
+		return DefaultDampingFlaps
+	}
+	return d.Flaps
+}
+
+func (d *Damping) WindowOrDefault() time.Duration {
+	return d.Window.OrDefault(DefaultDampingWindow)
+}
+
+func (d *Damping) HoldDownOrDefault() time.Duration {
+	return d.HoldDown.OrDefault(DefaultDampingHoldDown)
+}
+
+func (d *Damping) MaxHoldDownOrDefault() time.Duration {
+	return d.MaxHoldDown.OrDefault(DefaultDampingMaxHoldDown)
+}
+
+func (d *Damping) RetryIntervalOrDefault() time.Duration {
+	return d.RetryInterval.OrDefault(DefaultDampingRetryInterval)
+}
+
+func (r *Recording) Validate(group string, name string) bool {
+	if r == nil {
+		return true
+	}
+	if strings.TrimSpace(r.Directory) == "" {
+		log.Printf("  Error - %s(%s) recording requires a directory\n", group, name)
+		return false
+	}
+	return true
+}
+
+func (a *AuthPlugin) Validate(group string, name string) bool {
+	if a == nil {
+		return true
+	}
+	valid := true
+	if a.Command == "" {
+		log.Printf("  Error - %s(%s) authPlugin requires a command\n", group, name)
+		valid = false
+	} else if _, err := exec.LookPath(a.Command); err != nil {
+		log.Printf("  Error - %s(%s) authPlugin command (%s) cannot be run: %v\n", group, name, a.Command, err)
+		valid = false
+	}
+	if a.Timeout < 0 {
+		log.Printf("  Error - %s(%s) authPlugin timeout(%s) cannot be negative\n", group, name, a.Timeout)
+		valid = false
+	}
+	return valid
+}
+
+func (a *AuthPlugin) TimeoutOrDefault() time.Duration {
+	if a == nil {
+		return DefaultAuthPluginTimeout
+	}
+	return a.Timeout.OrDefault(DefaultAuthPluginTimeout)
+}
+
+func (p *Prewarm) MaxIdleOrDefault() time.Duration {
+	if p == nil {
+		return DefaultPrewarmMaxIdle
+	}
+	return p.MaxIdle.OrDefault(DefaultPrewarmMaxIdle)
+}
+
+func (s *Socket) Validate(group string, name string) bool {
+	if s == nil {
+		return true
+	}
+	valid := true
+	if s.KeepAliveInterval < 0 {
+		log.Printf("  Error - %s(%s) socket keepAliveInterval(%s) cannot be negative\n", group, name, s.KeepAliveInterval)
+		valid = false
+	} else if s.KeepAliveInterval > 0 && s.KeepAlive != nil && !*s.KeepAlive {
+		log.Printf("  Warn  - %s(%s) socket keepAliveInterval ignored as keepAlive is disabled\n", group, name)
+	}
+	if s.SendBuffer < 0 {
+		log.Printf("  Error - %s(%s) socket sendBuffer(%d) cannot be negative\n", group, name, s.SendBuffer)
+		valid = false
+	}
+	if s.ReceiveBuffer < 0 {
+		log.Printf("  Error - %s(%s) socket receiveBuffer(%d) cannot be negative\n", group, name, s.ReceiveBuffer)
+		valid = false
+	}
+	return valid
+}
+
+func (r *Registry) Validate() bool {
+	if r == nil {
+		return true
+	}
+	valid := true
+	if r.Interval < 0 {
+		log.Printf("  Error - registry interval(%s) cannot be negative\n", r.Interval)
+		valid = false
+	}
+	var addresses []string
+	if r.Consul != nil {
+		addresses = append(addresses, r.Consul.Address)
+	}
+	if r.Etcd != nil {
+		addresses = append(addresses, r.Etcd.Endpoints...)
+	}
+	for _, address := range addresses {
+		if address == "" {
+			continue
+		}
+		if u, err := url.Parse(address); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			log.Printf("  Error - registry address(%s) must be an http or https url\n", address)
+			valid = false
+		}
+	}
+	if r.Consul == nil && r.Etcd == nil {
+		log.Printf("  Warn  - registry defines neither consul nor etcd\n")
+	}
+	return valid
+}
+
+func (r *Registry) IntervalOrDefault() time.Duration {
+	return r.Interval.OrDefault(DefaultRegistryInterval)
+}
+
+func (l *Leader) Validate() bool {
+	if l == nil {
+		return true
+	}
+	valid := true
+	locks := 0
+	for _, set := range []bool{l.File != "", l.Consul != nil, l.Etcd != nil} {
+		if set {
+			locks++
+		}
+	}
+	if locks != 1 {
+		log.Printf("  Error - leader must define one of file, consul or etcd\n")
+		valid = false
+	}
+	if l.TTL < 0 {
+		log.Printf("  Error - leader ttl(%s) cannot be negative\n", l.TTL)
+		valid = false
+	}
+	var addresses []string
+	if l.Consul != nil {
+		addresses = append(addresses, l.Consul.Address)
+	}
+	if l.Etcd != nil {
+		addresses = append(addresses, l.Etcd.Endpoints...)
+	}
+	for _, address := range addresses {
+		if address == "" {
+			continue
+		}
+		if u, err := url.Parse(address); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			log.Printf("  Error - leader address(%s) must be an http or https url\n", address)
+			valid = false
+		}
+	}
+	return valid
+}
+
+func (l *Leader) KeyOrDefault() string {
+	if l.Key == "" {
+		return DefaultLeaderKey
+	}
+	return l.Key
+}
+
+func (l *Leader) TTLOrDefault() time.Duration {
+	return l.TTL.OrDefault(DefaultLeaderTTL)
+}
+
+func (p *Probe) Validate() bool {
+	if p != nil && p.Interval < 0 {
+		log.Printf("  Error - probe interval(%s) cannot be negative\n", p.Interval)
+		return false
+	}
+	return true
+}
+
+func (p *Probe) IntervalOrDefault() time.Duration {
+	return p.Interval.OrDefault(DefaultProbeInterval)
+}
+
+func (t *Tor) Validate() bool {
+	if t == nil {
+		return true
+	}
+	valid := true
+	if _, _, err := net.SplitHostPort(t.SOCKSOrDefault()); err != nil {
+		log.Printf("  Error - tor socks(%s) is not host:port: %v\n", t.SOCKS, err)
+		valid = false
+	}
+	if _, _, err := net.SplitHostPort(t.ControlOrDefault()); err != nil {
+		log.Printf("  Error - tor control(%s) is not host:port: %v\n", t.Control, err)
+		valid = false
+	}
+	if env, ok := strings.CutPrefix(t.ControlPassword, "env:"); ok && os.Getenv(env) == "" {
+		log.Printf("  Error - tor controlPassword environment variable (%s) is not set\n", env)
+		valid = false
+	}
+	return valid
+}
+
+func (t *Tor) SOCKSOrDefault() string {
+	if t == nil || t.SOCKS == "" {
+		return DefaultTorSOCKS
+	}
+	return t.SOCKS
+}
+
+func (t *Tor) ControlOrDefault() string {
+	if t == nil || t.Control == "" {
+		return DefaultTorControl
+	}
+	return t.Control
+}
+
+// ControlPasswordOrBlank is the control password, read from the environment
+// when given as env:NAME
+func (t *Tor) ControlPasswordOrBlank() string {
+	if t == nil {
+		return ""
+	}
+	return fromEnv(t.ControlPassword)
+}
+
+func (o *Onion) Validate(group string, name string) bool {
+	if o == nil {
+		return true
+	}
+	valid := true
+	if o.Port < 0 || o.Port > 65535 {
+		log.Printf("  Error - %s(%s) onion port(%d) must be between 1 and 65535\n", group, name, o.Port)
+		valid = false
+	}
+	if o.KeyFile != "" && !CheckPermissions("onion keyFile", o.KeyFile, PrivatePerms) {
+		valid = false
+	}
+	return valid
+}
+
+func (s *StatsD) Validate() bool {
+	if s == nil {
+		return true
+	}
+	valid := true
+	if s.Interval < 0 {
+		log.Printf("  Error - statsd interval(%s) cannot be negative\n", s.Interval)
+		valid = false
+	}
+	if _, _, err := net.SplitHostPort(s.AddressOrDefault()); err != nil {
+		log.Printf("  Error - statsd address(%s) is not host:port: %v\n", s.Address, err)
+		valid = false
+	}
+	if len(s.Tags) > 0 && !s.DogStatsD {
+		log.Printf("  Error - statsd tags require dogstatsd\n")
+		valid = false
+	}
+	for _, tag := range s.Tags {
+		if tag == "" || strings.ContainsAny(tag, ",|# ") {
+			log.Printf("  Error - statsd tag(%s) cannot be blank or contain commas, pipes, hashes or spaces\n", tag)
+			valid = false
+		}
+	}
+	return valid
+}
+
+func (s *StatsD) AddressOrDefault() string {
+	if s.Address == "" {
+		return DefaultStatsDAddress
+	}
+	return s.Address
+}
+
+func (s *StatsD) IntervalOrDefault() time.Duration {
+	return s.Interval.OrDefault(DefaultStatsDInterval)
+}
+
+func (s *StatsD) PrefixOrDefault() string {
+	if s.Prefix == "" {
+		return DefaultStatsDPrefix
+	}
+	return s.Prefix
+}
+
+func (h *Health) Validate() bool {
+	if h != nil && h.Grace < 0 {
+		log.Printf("  Error - health grace(%s) cannot be negative\n", h.Grace)
+		return false
+	}
+	return true
+}
+
+func (h *Health) GraceOrDefault() time.Duration {
+	if h == nil {
+		return DefaultHealthGrace
+	}
+	return h.Grace.OrDefault(DefaultHealthGrace)
+}
+
+func (t *Tunnel) IsEnabled() bool {
+	return t.Enabled == nil || *t.Enabled
+}
+
+func (t *Tunnel) AutoStarts() bool {
+	return t.IsEnabled() && (t.Autostart == nil || *t.Autostart)
+}
+
+func (t *Timeouts) ConnectTimeout() time.Duration {
+	if t == nil {
+		return DefaultConnectTimeout
+	}
+	return t.Connect.OrDefault(DefaultConnectTimeout)
+}
+
+func (t *Timeouts) ChannelTimeout() time.Duration {
+	if t == nil {
+		return DefaultChannelTimeout
+	}
+	return t.Channel.OrDefault(DefaultChannelTimeout)
+}
+
+func (t *Timeouts) DialTimeout() time.Duration {
+	if t == nil {
+		return DefaultDialTimeout
+	}
+	return t.Dial.OrDefault(DefaultDialTimeout)
+}
+
+func (t *Timeouts) IdleTimeout() time.Duration {
+	if t == nil {
+		return DefaultIdleTimeout
+	}
+	return t.Idle.OrDefault(DefaultIdleTimeout)
+}
+
+func (t *Timeouts) FallbackDelay() time.Duration {
+	if t == nil {
+		return DefaultFallbackDelay
+	}
+	return t.Fallback.OrDefault(DefaultFallbackDelay)
+}
+
+func (t *Timeouts) ResolveTimeout() time.Duration {
+	if t == nil {
+		return DefaultResolveTimeout
+	}
+	return t.Resolve.OrDefault(DefaultResolveTimeout)
+}
+
+func (t *Timeouts) ReadIdleTimeout() time.Duration {
+	if t == nil {
+		return 0
+	}
+	return t.ReadIdle.Duration()
+}
+
+func (t *Timeouts) WriteIdleTimeout() time.Duration {
+	if t == nil {
+		return 0
+	}
+	return t.WriteIdle.Duration()
+}
+
+func (t *Timeouts) MaxLifetime() time.Duration {
+	if t == nil {
+		return 0
+	}
+	return t.Lifetime.Duration()
+}
+
 func (w *Web) Merge(in *Web) *Web {
 	out := *w
 	if out.Port == 0 {
@@ -128,6 +1681,9 @@ func (w *Web) Merge(in *Web) *Web {
 	if out.Address == "" {
 		out.Address = in.Address
 	}
+	if out.GrpcPort == 0 {
+		out.GrpcPort = in.GrpcPort
+	}
 	if out.CertificateFile == "" {
 		out.CertificateFile = in.CertificateFile
 	}
@@ -137,5 +1693,26 @@ func (w *Web) Merge(in *Web) *Web {
 	if out.KeyPassphrase == "" {
 		out.KeyPassphrase = in.KeyPassphrase
 	}
+	if len(out.Tokens) == 0 {
+		out.Tokens = in.Tokens
+	}
+	out.ReadOnly = out.ReadOnly || in.ReadOnly
+	if out.TokenFile == "" {
+		out.TokenFile = in.TokenFile
+	}
+	if out.ClientCA == "" {
+		out.ClientCA = in.ClientCA
+	}
+	if out.ClientCertificate == "" {
+		out.ClientCertificate = in.ClientCertificate
+	}
+	if out.ClientKey == "" {
+		out.ClientKey = in.ClientKey
+	}
 	return &out
 }
+
+// Admin tells whether the token may change the running configuration
+func (t *Token) Admin() bool {
+	return t.Access == TokenAccessAdmin
+}
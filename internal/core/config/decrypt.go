@@ -0,0 +1,111 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+var (
+	AgeIdentityFile string
+
+	ageHeader    = []byte("age-encryption.org/v1")
+	sopsRegEx    = regexp.MustCompile(`(?m)^sops:\s*$`)
+	sopsMacRegEx = regexp.MustCompile(`(?m)^\s+mac:\s`)
+)
+
+// ReadFile reads the configuration file, decrypting it when it has been
+// encrypted with age or SOPS, expands any environment variable references and
+// resolves the match blocks and host inheritance
+func ReadFile(filename string) ([]byte, error) {
+	bs, _, err := readFile(filename)
+	return bs, err
+}
+
+func readFile(filename string) ([]byte, Lines, error) {
+	bs, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	if bs, err = decrypt(filename, bs); err != nil {
+		return nil, nil, err
+	}
+	return resolveLines(bs, localEnvironment())
+}
+
+func decrypt(filename string, bs []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(bs, ageHeader) || bytes.HasPrefix(bs, []byte(armor.Header)):
+		return decryptAge(bs)
+	case sopsRegEx.Match(bs) && sopsMacRegEx.Match(bs):
+		return decryptSops(filename)
+	}
+	return bs, nil
+}
+
+func decryptAge(bs []byte) ([]byte, error) {
+	identityFile := ageIdentityFile()
+	f, err := os.Open(identityFile)
+	if err != nil {
+		return nil, fmt.Errorf("age identity cannot be read: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	identities, err := age.ParseIdentities(f)
+	if err != nil {
+		return nil, fmt.Errorf("age identity (%s) cannot be parsed: %w", identityFile, err)
+	}
+
+	var in io.Reader = bytes.NewReader(bs)
+	if bytes.HasPrefix(bs, []byte(armor.Header)) {
+		in = armor.NewReader(in)
+	}
+	r, err := age.Decrypt(in, identities...)
+	if err != nil {
+		return nil, fmt.Errorf("configuration cannot be decrypted: %w", err)
+	}
+	return io.ReadAll(r)
+}
+
+// decryptSops delegates to the sops binary, which supports age, pgp and the
+// cloud key management services
+func decryptSops(filename string) ([]byte, error) {
+	cmd := exec.Command("sops", "--decrypt", filename)
+	cmd.Env = os.Environ()
+	if AgeIdentityFile != "" {
+		cmd.Env = append(cmd.Env, "SOPS_AGE_KEY_FILE="+AgeIdentityFile)
+	}
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("sops failed to decrypt configuration: %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// ageIdentityFile returns the identity given by flag, falling back to the
+// locations used by sops
+func ageIdentityFile() string {
+	if AgeIdentityFile != "" {
+		return AgeIdentityFile
+	}
+	if file := os.Getenv("SOPS_AGE_KEY_FILE"); file != "" {
+		return file
+	}
+	if dir, err := os.UserConfigDir(); err == nil {
+		return filepath.Join(dir, "sops", "age", "keys.txt")
+	}
+	return ""
+}
@@ -0,0 +1,186 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	envPrefix       = "AUTOSSH_"
+	envHostPrefix   = envPrefix + "HOST_"
+	envTunnelPrefix = envPrefix + "TUNNEL_"
+)
+
+// ApplyEnv completes the configuration from AUTOSSH_ environment variables, so
+// auto-ssh can run in a container without a configuration file.
+//
+// AUTOSSH_USERNAME, AUTOSSH_IDENTITY, AUTOSSH_PASSPHRASE, AUTOSSH_KNOWN_HOSTS and
+// AUTOSSH_HOST_KEY_POLICY are the defaults of every host not setting its own.  The
+// identity is a file, the key itself or env:NAME, as in the configuration.
+//
+// AUTOSSH_HOST_<n> adds a host as [name=][user@]address[:port], and
+// AUTOSSH_TUNNEL_<n> a tunnel as [name=][bind:]port:target:port[@host], where the
+// host is the id or name of a configured host or else [user@]address[:port]
+func ApplyEnv(c *Configuration, environ []string) error {
+	env := make(map[string]string)
+	for _, kv := range environ {
+		if name, value, ok := strings.Cut(kv, "="); ok && strings.HasPrefix(name, envPrefix) {
+			env[name] = value
+		}
+	}
+	for _, name := range numbered(env, envHostPrefix) {
+		host, err := envHost(strings.TrimPrefix(name, envHostPrefix), env[name])
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		c.Hosts = append(c.Hosts, host)
+	}
+	for _, name := range numbered(env, envTunnelPrefix) {
+		tunnel, err := c.envTunnel(strings.TrimPrefix(name, envTunnelPrefix), env[name])
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		c.Tunnels = append(c.Tunnels, tunnel)
+	}
+
+	for _, host := range c.Hosts {
+		if host.Username == "" {
+			host.Username = env[envPrefix+"USERNAME"]
+		}
+		if host.Identity == "" {
+			host.Identity = env[envPrefix+"IDENTITY"]
+			if host.Passphrase == "" {
+				host.Passphrase = env[envPrefix+"PASSPHRASE"]
+			}
+		}
+		if host.KnownHosts == "" {
+			host.KnownHosts = env[envPrefix+"KNOWN_HOSTS"]
+		}
+		if host.HostKeyPolicy == "" {
+			host.HostKeyPolicy = env[envPrefix+"HOST_KEY_POLICY"]
+		}
+	}
+	return nil
+}
+
+// numbered returns the variables with the prefix in the order of their numbers
+func numbered(env map[string]string, prefix string) []string {
+	var names []string
+	for name := range env {
+		if _, err := strconv.Atoi(strings.TrimPrefix(name, prefix)); err == nil && strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, _ := strconv.Atoi(strings.TrimPrefix(names[i], prefix))
+		b, _ := strconv.Atoi(strings.TrimPrefix(names[j], prefix))
+		return a < b
+	})
+	return names
+}
+
+func envHost(n string, spec string) (*Host, error) {
+	name, spec := envName(spec)
+	host := parseHostSpec(spec)
+	if host == nil {
+		return nil, fmt.Errorf("host (%s) must be [name=][user@]address[:port]", spec)
+	}
+	host.Id = "env-host-" + n
+	if name != "" {
+		host.Name = name
+	}
+	return host, nil
+}
+
+func (c *Configuration) envTunnel(n string, spec string) (*Tunnel, error) {
+	name, spec := envName(spec)
+	forward, hostSpec, hasHost := strings.Cut(spec, "@")
+	parts := splitColons(forward)
+	if len(parts) != 3 && len(parts) != 4 {
+		return nil, fmt.Errorf("tunnel (%s) must be [name=][bind:]port:target:port[@host]", spec)
+	}
+	local := "127.0.0.1:" + parts[0]
+	if len(parts) == 4 {
+		local = parts[0] + ":" + parts[1]
+	}
+	tunnel := &Tunnel{
+		Id:     "env-" + n,
+		Name:   name,
+		Local:  NewAddress(local),
+		Remote: NewAddress(parts[len(parts)-2] + ":" + parts[len(parts)-1]),
+	}
+	if tunnel.Name == "" {
+		tunnel.Name = tunnel.Id
+	}
+	if hasHost {
+		host, err := c.envTunnelHost(hostSpec)
+		if err != nil {
+			return nil, err
+		}
+		tunnel.Host = host
+	}
+	return tunnel, nil
+}
+
+// envTunnelHost returns the id of the tunnel's host, adding a host for an
+// address that is not already configured
+func (c *Configuration) envTunnelHost(spec string) (string, error) {
+	for _, host := range c.Hosts {
+		if host.Id == spec || host.Name == spec {
+			return host.Id, nil
+		}
+	}
+	host := parseHostSpec(spec)
+	if host == nil {
+		return "", fmt.Errorf("tunnel host (%s) must be a host id or name, or [user@]address[:port]", spec)
+	}
+	host.Id = spec
+	c.Hosts = append(c.Hosts, host)
+	return host.Id, nil
+}
+
+func parseHostSpec(spec string) *Host {
+	user, address, hasUser := strings.Cut(spec, "@")
+	if !hasUser {
+		user, address = "", spec
+	}
+	if address == "" || strings.ContainsAny(address, "@ ") {
+		return nil
+	}
+	return &Host{Name: address, Username: user, Remote: NewAddress(address)}
+}
+
+// envName splits a leading name= from the spec
+func envName(spec string) (string, string) {
+	name, rest, ok := strings.Cut(spec, "=")
+	if !ok || strings.ContainsAny(name, ":@[") {
+		return "", strings.TrimSpace(spec)
+	}
+	return strings.TrimSpace(name), strings.TrimSpace(rest)
+}
+
+// splitColons splits on the colons outside of brackets, leaving ip6 addresses whole
+func splitColons(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, r := range s {
+		switch r {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case ':':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ExpandEnv replaces ${VAR} references in the values of the configuration with
+// the value of the environment variable.  ${VAR:-fallback} uses the fallback
+// when VAR is unset or empty, ${VAR-fallback} only when VAR is unset, and $${
+// escapes a literal ${.  Values are expanded once parsed, so an environment
+// value is never read as yaml, and keys and comments are left as they are.
+// Reports whether any value changed
+func ExpandEnv(node *yaml.Node) (bool, error) {
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		changed := false
+		for _, child := range node.Content {
+			expanded, err := ExpandEnv(child)
+			if err != nil {
+				return false, err
+			}
+			changed = changed || expanded
+		}
+		return changed, nil
+	case yaml.MappingNode:
+		changed := false
+		for i := 1; i < len(node.Content); i += 2 {
+			expanded, err := ExpandEnv(node.Content[i])
+			if err != nil {
+				return false, err
+			}
+			changed = changed || expanded
+		}
+		return changed, nil
+	case yaml.ScalarNode:
+		if !strings.Contains(node.Value, "${") {
+			return false, nil
+		}
+		value, err := expandString(node.Value)
+		if err != nil {
+			return false, fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		node.Value = value
+		if node.Style == 0 {
+			// Typed by its expanded value, as a port given as ${PORT} is a number
+			node.Tag = ""
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+func expandString(s string) (string, error) {
+	out := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '$' && i+2 < len(s) && s[i+1] == '$' && s[i+2] == '{':
+			out.WriteString("${")
+			i += 2
+			continue
+		case s[i] == '$' && i+1 < len(s) && s[i+1] == '{':
+			end := strings.IndexByte(s[i+2:], '}')
+			if end < 0 || strings.IndexByte(s[i+2:i+2+end], '\n') >= 0 {
+				return "", fmt.Errorf("unterminated variable reference")
+			}
+			value, err := expandReference(s[i+2 : i+2+end])
+			if err != nil {
+				return "", err
+			}
+			out.WriteString(value)
+			i += end + 2
+			continue
+		}
+		out.WriteByte(s[i])
+	}
+	return out.String(), nil
+}
+
+func expandReference(ref string) (string, error) {
+	name, fallback, hasFallback := ref, "", false
+	emptyIsUnset := false
+	if i := strings.Index(ref, ":-"); i >= 0 {
+		name, fallback, hasFallback, emptyIsUnset = ref[:i], ref[i+2:], true, true
+	} else if i = strings.Index(ref, "-"); i >= 0 {
+		name, fallback, hasFallback = ref[:i], ref[i+1:], true
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("empty variable reference")
+	}
+	value, ok := os.LookupEnv(name)
+	if hasFallback && (!ok || (emptyIsUnset && value == "")) {
+		return fallback, nil
+	}
+	return value, nil
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestExpandString(t *testing.T) {
+	t.Setenv("ASH_USER", "ec2-user")
+	t.Setenv("ASH_EMPTY", "")
+	tests := map[string]struct {
+		input    string
+		expected string
+	}{
+		"none":             {input: "bob", expected: "bob"},
+		"set":              {input: "${ASH_USER}", expected: "ec2-user"},
+		"unset":            {input: "${ASH_UNSET}", expected: ""},
+		"fallback-set":     {input: "${ASH_USER:-bob}", expected: "ec2-user"},
+		"fallback-unset":   {input: "${ASH_UNSET:-bob}", expected: "bob"},
+		"fallback-empty":   {input: "${ASH_EMPTY:-bob}", expected: "bob"},
+		"unset-only-empty": {input: "${ASH_EMPTY-bob}", expected: ""},
+		"unset-only":       {input: "${ASH_UNSET-bob}", expected: "bob"},
+		"fallback-path":    {input: "${ASH_UNSET:-~/.ssh/id_rsa}", expected: "~/.ssh/id_rsa"},
+		"escaped":          {input: "$${ASH_USER}", expected: "${ASH_USER}"},
+		"dollar":           {input: "pa$$word$", expected: "pa$$word$"},
+		"multiple":         {input: "${ASH_USER}@${ASH_UNSET:-host}", expected: "ec2-user@host"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			actual, err := expandString(test.input)
+			assert.NoError(tt, err)
+			assert.Equal(tt, test.expected, actual)
+		})
+	}
+}
+
+func TestExpandEnvValues(t *testing.T) {
+	tests := map[string]string{
+		"comment":  "a #b",
+		"mapping":  "x: y",
+		"quotes":   `it's "quoted"`,
+		"newline":  "line one\nline two",
+		"flow":     "[a, b]",
+		"anchor":   "&anchor *alias",
+		"document": "---",
+	}
+	for name, value := range tests {
+		t.Run(name, func(tt *testing.T) {
+			tt.Setenv("ASH_VALUE", value)
+			bs, err := resolve([]byte("hosts:\n  - id: \"01\"\n    username: ${ASH_VALUE}\n    passphrase: \"${ASH_VALUE}\"\n"), testEnvironment("", nil))
+			require.NoError(tt, err)
+			cfg := &Configuration{}
+			require.NoError(tt, yaml.Unmarshal(bs, cfg))
+			require.Len(tt, cfg.Hosts, 1)
+			assert.Equal(tt, value, cfg.Hosts[0].Username)
+			assert.Equal(tt, value, cfg.Hosts[0].Passphrase)
+			assert.Equal(tt, "01", cfg.Hosts[0].Id)
+		})
+	}
+}
+
+func TestExpandEnvTyped(t *testing.T) {
+	t.Setenv("ASH_PORT", "9000")
+	bs, err := resolve([]byte("monitor:\n  statsPort: ${ASH_PORT}\n"), testEnvironment("", nil))
+	require.NoError(t, err)
+	cfg := &Configuration{}
+	require.NoError(t, yaml.Unmarshal(bs, cfg))
+	assert.Equal(t, 9000, cfg.Monitor.StatsPort)
+}
+
+func TestExpandEnvSkipsComments(t *testing.T) {
+	input := "# set username to ${USER or a fallback\nhosts:\n  - id: \"01\" # ${NOT_EXPANDED}\n    username: bob\n"
+	bs, err := resolve([]byte(input), testEnvironment("", nil))
+	require.NoError(t, err)
+	assert.Equal(t, input, string(bs))
+}
+
+func TestExpandEnvErrors(t *testing.T) {
+	_, err := resolve([]byte("a: 1\nb: ${OPEN\n"), testEnvironment("", nil))
+	assert.EqualError(t, err, "line 2: unterminated variable reference")
+	_, err = resolve([]byte("a: ${}"), testEnvironment("", nil))
+	assert.EqualError(t, err, "line 1: empty variable reference")
+}
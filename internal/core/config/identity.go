@@ -0,0 +1,52 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	inlineKeyPrefix   = "-----BEGIN "
+	envIdentityPrefix = "env:"
+	redactedIdentity  = "(inline key)"
+)
+
+// IsFileIdentity reports whether the identity is the path of a key file, rather
+// than the private key itself or env:NAME naming the environment variable holding it
+func IsFileIdentity(identity string) bool {
+	return !strings.HasPrefix(identity, inlineKeyPrefix) && !strings.HasPrefix(identity, envIdentityPrefix)
+}
+
+// ReadIdentity returns the private key of the identity.  Keys given inline or
+// through the environment may have their newlines escaped, as env files and
+// container orchestrators often cannot hold them
+func ReadIdentity(identity string) ([]byte, error) {
+	if IsFileIdentity(identity) {
+		return os.ReadFile(identity)
+	}
+	key := identity
+	if name, ok := strings.CutPrefix(identity, envIdentityPrefix); ok {
+		var set bool
+		if key, set = os.LookupEnv(name); !set {
+			return nil, fmt.Errorf("environment variable %s not set", name)
+		}
+	}
+	if strings.Contains(key, `\n`) && !strings.Contains(key, "\n") {
+		key = strings.ReplaceAll(key, `\n`, "\n")
+	}
+	return []byte(key), nil
+}
+
+// RedactIdentity returns the identity fit for logs and output, hiding a key
+// given inline
+func RedactIdentity(identity string) string {
+	if strings.HasPrefix(identity, inlineKeyPrefix) {
+		return redactedIdentity
+	}
+	return identity
+}
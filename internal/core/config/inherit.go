@@ -0,0 +1,143 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package config
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	inheritsKey = "inherits"
+	abstractKey = "abstract"
+)
+
+var (
+	// notInherited are the host keys that identify a host rather than configure it
+	notInherited = map[string]bool{"id": true, "name": true, inheritsKey: true, abstractKey: true}
+)
+
+// resolveInheritance fills in the hosts that name a base host, by id or name,
+// in inherits with every setting of the base they do not set themselves.  Bases
+// may inherit in turn.  Hosts marked abstract only serve as bases and are dropped
+func resolveInheritance(doc *yaml.Node) error {
+	index := keyIndex(doc, "hosts")
+	if index < 0 || doc.Content[index+1].Kind != yaml.SequenceNode {
+		return nil
+	}
+	hosts := doc.Content[index+1]
+	resolved := make(map[*yaml.Node]bool)
+	for _, host := range hosts.Content {
+		if err := inherit(hosts, host, resolved, nil); err != nil {
+			return err
+		}
+	}
+	concrete := hosts.Content[:0]
+	for _, host := range hosts.Content {
+		if scalar(host, abstractKey) != "true" {
+			removeKey(host, abstractKey)
+			concrete = append(concrete, host)
+		}
+	}
+	hosts.Content = concrete
+	return nil
+}
+
+// inherits reports whether any host of the configuration names a base host
+func inherits(doc *yaml.Node) bool {
+	index := keyIndex(doc, "hosts")
+	if index < 0 || doc.Content[index+1].Kind != yaml.SequenceNode {
+		return false
+	}
+	for _, host := range doc.Content[index+1].Content {
+		if host.Kind == yaml.MappingNode && keyIndex(host, inheritsKey) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func inherit(hosts *yaml.Node, host *yaml.Node, resolved map[*yaml.Node]bool, chain []string) error {
+	if host.Kind != yaml.MappingNode || resolved[host] {
+		return nil
+	}
+	name := hostName(host)
+	for _, link := range chain {
+		if link == name {
+			return fmt.Errorf("line %d: host (%s) inherits from itself", host.Line, name)
+		}
+	}
+	ref := scalar(host, inheritsKey)
+	if ref != "" {
+		base := hostByRef(hosts, ref)
+		if base == nil {
+			return fmt.Errorf("line %d: host (%s) inherits from undefined host (%s)", host.Line, name, ref)
+		}
+		if err := inherit(hosts, base, resolved, append(chain, name)); err != nil {
+			return err
+		}
+		fill(host, base)
+		removeKey(host, inheritsKey)
+	}
+	resolved[host] = true
+	return nil
+}
+
+// fill copies the settings of base missing from host, descending into mappings
+// such as algorithms and timeouts so they can be partially overridden
+func fill(host *yaml.Node, base *yaml.Node) {
+	for i := 0; i+1 < len(base.Content); i += 2 {
+		key, value := base.Content[i], base.Content[i+1]
+		if notInherited[key.Value] {
+			continue
+		}
+		index := keyIndex(host, key.Value)
+		switch {
+		case index < 0:
+			host.Content = append(host.Content, key, value)
+		case value.Kind == yaml.MappingNode && host.Content[index+1].Kind == yaml.MappingNode:
+			fillMapping(host.Content[index+1], value)
+		}
+	}
+}
+
+func fillMapping(dst *yaml.Node, src *yaml.Node) {
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		index := keyIndex(dst, key.Value)
+		switch {
+		case index < 0:
+			dst.Content = append(dst.Content, key, value)
+		case value.Kind == yaml.MappingNode && dst.Content[index+1].Kind == yaml.MappingNode:
+			fillMapping(dst.Content[index+1], value)
+		}
+	}
+}
+
+func hostByRef(hosts *yaml.Node, ref string) *yaml.Node {
+	if host := byId(hosts, ref); host != nil {
+		return host
+	}
+	for _, host := range hosts.Content {
+		if scalar(host, "name") == ref {
+			return host
+		}
+	}
+	return nil
+}
+
+func hostName(host *yaml.Node) string {
+	if name := scalar(host, "name"); name != "" {
+		return name
+	}
+	return scalar(host, "id")
+}
+
+func removeKey(mapping *yaml.Node, key string) {
+	if index := keyIndex(mapping, key); index >= 0 {
+		mapping.Content = append(mapping.Content[:index], mapping.Content[index+2:]...)
+	}
+}
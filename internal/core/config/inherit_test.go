@@ -0,0 +1,76 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+const inheritConfig = `hosts:
+  - id: base
+    abstract: true
+    username: ops
+    identity: ~/.ssh/bastion
+    keychain: true
+    timeouts:
+      connect: 5s
+      idle: 10m
+  - id: east
+    inherits: base
+    remote: east.example.com:22
+  - id: west
+    name: west
+    inherits: base
+    remote: west.example.com:22
+    keychain: false
+    timeouts:
+      connect: 20s
+  - id: west-2
+    inherits: west
+    remote: west2.example.com:22
+`
+
+func TestResolveInheritance(t *testing.T) {
+	bs, err := resolve([]byte(inheritConfig), testEnvironment("", nil))
+	assert.NoError(t, err)
+	cfg := &Configuration{}
+	assert.NoError(t, yaml.Unmarshal(bs, cfg))
+	if !assert.Len(t, cfg.Hosts, 3) {
+		return
+	}
+	tests := map[string]struct {
+		host     *Host
+		remote   string
+		keychain bool
+		connect  string
+	}{
+		"east":   {host: cfg.Hosts[0], remote: "east.example.com:22", keychain: true, connect: "5s"},
+		"west":   {host: cfg.Hosts[1], remote: "west.example.com:22", keychain: false, connect: "20s"},
+		"west-2": {host: cfg.Hosts[2], remote: "west2.example.com:22", keychain: false, connect: "20s"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			assert.Equal(tt, name, test.host.Id)
+			assert.Equal(tt, test.remote, test.host.Remote.String())
+			assert.Equal(tt, "ops", test.host.Username)
+			assert.Equal(tt, "~/.ssh/bastion", test.host.Identity)
+			assert.Equal(tt, test.keychain, test.host.Keychain)
+			assert.Equal(tt, test.connect, test.host.Timeouts.Connect.String())
+			assert.Equal(tt, "10m0s", test.host.Timeouts.Idle.String())
+		})
+	}
+	assert.Equal(t, "", cfg.Hosts[0].Name)
+}
+
+func TestResolveInheritanceErrors(t *testing.T) {
+	env := testEnvironment("", nil)
+	_, err := resolve([]byte("hosts:\n  - id: a\n    inherits: b\n"), env)
+	assert.ErrorContains(t, err, "undefined host (b)")
+	_, err = resolve([]byte("hosts:\n  - id: a\n    inherits: b\n  - id: b\n    inherits: a\n"), env)
+	assert.ErrorContains(t, err, "inherits from itself")
+}
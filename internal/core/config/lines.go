@@ -0,0 +1,71 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+var lineRegex = regexp.MustCompile(`\bline (\d+)\b`)
+
+// Lines maps the lines of resolved configuration, written out again once its
+// values were expanded, its match blocks applied or its hosts inherited, back
+// to the lines of the source they came from.  Settings a host inherits refer
+// to its base, and those a match block sets to the block.  A nil Lines is the
+// configuration as read
+type Lines map[int]int
+
+// Source is the line of the source the resolved configuration's line came from
+func (l Lines) Source(line int) int {
+	if source, ok := l[line]; ok {
+		return source
+	}
+	return line
+}
+
+// Translate rewrites the line numbers of a message about the resolved
+// configuration, such as a decoding error, to those of the source
+func (l Lines) Translate(msg string) string {
+	if l == nil {
+		return msg
+	}
+	return lineRegex.ReplaceAllStringFunc(msg, func(match string) string {
+		line, err := strconv.Atoi(match[len("line "):])
+		if err != nil {
+			return match
+		}
+		return fmt.Sprintf("line %d", l.Source(line))
+	})
+}
+
+// sourceLines maps the lines of out, the resolved tree written out, to the
+// lines its nodes were read from, which they kept through resolution
+func sourceLines(resolved *yaml.Node, out []byte) Lines {
+	written := &yaml.Node{}
+	if err := yaml.Unmarshal(out, written); err != nil {
+		return nil
+	}
+	lines := Lines{}
+	mapLines(lines, resolved, written)
+	return lines
+}
+
+// mapLines walks the trees together, the innermost node on a line deciding
+// where it came from, as a sequence begins on the line of its first entry
+func mapLines(lines Lines, source *yaml.Node, written *yaml.Node) {
+	if written.Line > 0 && source.Line > 0 {
+		lines[written.Line] = source.Line
+	}
+	if source.Kind == yaml.AliasNode || len(source.Content) != len(written.Content) {
+		return
+	}
+	for i := range source.Content {
+		mapLines(lines, source.Content[i], written.Content[i])
+	}
+}
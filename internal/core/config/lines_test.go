@@ -0,0 +1,62 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package config
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+const linesConfig = `hosts:
+  - id: base
+    abstract: true
+    username: ops
+    identity: ~/.ssh/bastion
+
+  - id: east
+    inherits: base
+    remote: ${ASH_REMOTE:-east.example.com:22}
+    colour: red
+tunnels:
+  - id: db
+    remote: db:5432
+    host: east
+`
+
+func TestResolveLines(t *testing.T) {
+	bs, lines, err := resolveLines([]byte(linesConfig), testEnvironment("", nil))
+	require.NoError(t, err)
+	require.NotNil(t, lines)
+
+	root := &yaml.Node{}
+	require.NoError(t, yaml.Unmarshal(bs, root))
+	hosts := root.Content[0].Content[1]
+	require.Len(t, hosts.Content, 1)
+	assert.Equal(t, 7, lines.Source(hosts.Content[0].Line), "host east")
+	tunnels := root.Content[0].Content[3]
+	assert.Equal(t, 12, lines.Source(tunnels.Content[0].Line), "tunnel db")
+	username := hosts.Content[0].Content[keyIndex(hosts.Content[0], "username")]
+	assert.Equal(t, 4, lines.Source(username.Line), "inherited from base")
+
+	decoder := yaml.NewDecoder(bytes.NewReader(bs))
+	decoder.KnownFields(true)
+	err = decoder.Decode(&Configuration{})
+	var typeErr *yaml.TypeError
+	require.ErrorAs(t, err, &typeErr)
+	assert.Equal(t, "line 10: field colour not found in type config.Host", lines.Translate(typeErr.Errors[0]))
+}
+
+func TestResolveLinesUntouched(t *testing.T) {
+	bs, lines, err := resolveLines([]byte("hosts:\n  - id: east\n    username: ops # match: not a block\n"), testEnvironment("", nil))
+	require.NoError(t, err)
+	assert.Nil(t, lines)
+	assert.Equal(t, 3, lines.Source(3))
+	assert.Equal(t, "line 3: bad", lines.Translate("line 3: bad"))
+	assert.Equal(t, "hosts:\n  - id: east\n    username: ops # match: not a block\n", string(bs))
+}
@@ -0,0 +1,255 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	matchKey = "match"
+)
+
+// When holds the conditions of a match block, every one given must hold for the
+// block to apply.  Hostname and the env values are glob patterns, Gateway is the
+// address or cidr of the current default gateway and SSID the wifi network joined
+type When struct {
+	Hostname string            `yaml:"hostname,omitempty"`
+	OS       string            `yaml:"os,omitempty"`
+	Gateway  string            `yaml:"gateway,omitempty"`
+	SSID     string            `yaml:"ssid,omitempty"`
+	Env      map[string]string `yaml:"env,omitempty"`
+}
+
+// environment is what the conditions are tested against, gathered lazily as
+// the gateway and ssid lookups are comparatively slow
+type environment struct {
+	hostname func() string
+	os       string
+	gateway  func() net.IP
+	ssid     func() string
+	env      func(string) (string, bool)
+}
+
+func localEnvironment() *environment {
+	return &environment{
+		hostname: func() string { name, _ := os.Hostname(); return name },
+		os:       runtime.GOOS,
+		gateway:  defaultGateway,
+		ssid:     currentSSID,
+		env:      os.LookupEnv,
+	}
+}
+
+// Resolve expands the environment variable references in the configuration's
+// values, then applies the match blocks that hold on this machine and the
+// inheritance between hosts.  Configuration using none of them is returned
+// untouched so line numbers still refer to the file
+func Resolve(bs []byte) ([]byte, error) {
+	return resolve(bs, localEnvironment())
+}
+
+func resolve(bs []byte, env *environment) ([]byte, error) {
+	bs, _, err := resolveLines(bs, env)
+	return bs, err
+}
+
+// resolveLines resolves the configuration as Resolve does, along with the
+// lines of the source each line of the result came from
+func resolveLines(bs []byte, env *environment) ([]byte, Lines, error) {
+	root := &yaml.Node{}
+	if err := yaml.Unmarshal(bs, root); err != nil || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		// Left for the configuration's own decoding to report
+		return bs, nil, nil
+	}
+	doc := root.Content[0]
+	expanded, err := ExpandEnv(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !expanded && keyIndex(doc, matchKey) < 0 && !inherits(doc) {
+		return bs, nil, nil
+	}
+	if err = resolveMatches(doc, env); err != nil {
+		return nil, nil, err
+	}
+	if err = resolveInheritance(doc); err != nil {
+		return nil, nil, err
+	}
+	out, err := yaml.Marshal(root)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, sourceLines(root, out), nil
+}
+
+// resolveMatches merges the match blocks whose conditions hold over the rest of
+// the configuration in order.  Mappings merge key by key, host and tunnel entries
+// by id, and anything else is replaced
+func resolveMatches(doc *yaml.Node, env *environment) error {
+	index := keyIndex(doc, matchKey)
+	if index < 0 {
+		return nil
+	}
+	blocks := doc.Content[index+1]
+	doc.Content = append(doc.Content[:index], doc.Content[index+2:]...)
+	if blocks.Kind != yaml.SequenceNode {
+		return fmt.Errorf("line %d: match must be a list of blocks", blocks.Line)
+	}
+	for _, block := range blocks.Content {
+		if block.Kind != yaml.MappingNode {
+			return fmt.Errorf("line %d: match block must be a mapping", block.Line)
+		}
+		when, body, err := splitBlock(block)
+		if err != nil {
+			return err
+		}
+		if when.matches(env) {
+			merge(doc, body)
+		}
+	}
+	return nil
+}
+
+// keyIndex returns the index of the key within the mapping, or -1
+func keyIndex(mapping *yaml.Node, key string) int {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func splitBlock(block *yaml.Node) (*When, *yaml.Node, error) {
+	when := &When{}
+	body := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for i := 0; i+1 < len(block.Content); i += 2 {
+		key, value := block.Content[i], block.Content[i+1]
+		if key.Value != "when" {
+			body.Content = append(body.Content, key, value)
+			continue
+		}
+		bs, err := yaml.Marshal(value)
+		if err != nil {
+			return nil, nil, err
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(bs))
+		decoder.KnownFields(true)
+		if err = decoder.Decode(when); err != nil {
+			return nil, nil, fmt.Errorf("line %d: match condition: %w", value.Line, err)
+		}
+	}
+	return when, body, nil
+}
+
+func (w *When) matches(env *environment) bool {
+	if w.Hostname != "" && !glob(w.Hostname, env.hostname()) {
+		return false
+	}
+	if w.OS != "" && !strings.EqualFold(w.OS, env.os) {
+		return false
+	}
+	if w.Gateway != "" && !gatewayMatches(w.Gateway, env.gateway()) {
+		return false
+	}
+	if w.SSID != "" && !glob(w.SSID, env.ssid()) {
+		return false
+	}
+	for name, pattern := range w.Env {
+		value, ok := env.env(name)
+		if !ok || !glob(pattern, value) {
+			return false
+		}
+	}
+	return true
+}
+
+func glob(pattern string, value string) bool {
+	matched, err := path.Match(pattern, value)
+	return err == nil && matched
+}
+
+func gatewayMatches(want string, gateway net.IP) bool {
+	if gateway == nil {
+		return false
+	}
+	if _, network, err := net.ParseCIDR(want); err == nil {
+		return network.Contains(gateway)
+	}
+	return gateway.Equal(net.ParseIP(want))
+}
+
+func merge(dst *yaml.Node, src *yaml.Node) {
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		found := false
+		for j := 0; j+1 < len(dst.Content); j += 2 {
+			if dst.Content[j].Value != key.Value {
+				continue
+			}
+			found = true
+			dst.Content[j+1] = mergeValue(dst.Content[j+1], value)
+			break
+		}
+		if !found {
+			dst.Content = append(dst.Content, key, value)
+		}
+	}
+}
+
+func mergeValue(dst *yaml.Node, src *yaml.Node) *yaml.Node {
+	switch {
+	case dst.Kind == yaml.MappingNode && src.Kind == yaml.MappingNode:
+		merge(dst, src)
+		return dst
+	case dst.Kind == yaml.SequenceNode && src.Kind == yaml.SequenceNode && identified(dst) && identified(src):
+		for _, item := range src.Content {
+			if existing := byId(dst, scalar(item, "id")); existing != nil {
+				merge(existing, item)
+			} else {
+				dst.Content = append(dst.Content, item)
+			}
+		}
+		return dst
+	}
+	return src
+}
+
+// identified reports whether every entry of the sequence is a mapping with an id
+func identified(seq *yaml.Node) bool {
+	for _, item := range seq.Content {
+		if item.Kind != yaml.MappingNode || scalar(item, "id") == "" {
+			return false
+		}
+	}
+	return true
+}
+
+func byId(seq *yaml.Node, id string) *yaml.Node {
+	for _, item := range seq.Content {
+		if scalar(item, "id") == id {
+			return item
+		}
+	}
+	return nil
+}
+
+func scalar(mapping *yaml.Node, key string) string {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key && mapping.Content[i+1].Kind == yaml.ScalarNode {
+			return mapping.Content[i+1].Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,37 @@
+//go:build darwin
+
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package config
+
+import (
+	"net"
+	"os/exec"
+	"strings"
+)
+
+func defaultGateway() net.IP {
+	out, err := exec.Command("route", "-n", "get", "default").Output()
+	if err != nil {
+		return nil
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if gateway, ok := strings.CutPrefix(strings.TrimSpace(line), "gateway:"); ok {
+			return net.ParseIP(strings.TrimSpace(gateway))
+		}
+	}
+	return nil
+}
+
+func currentSSID() string {
+	out, err := exec.Command("networksetup", "-getairportnetwork", "en0").Output()
+	if err != nil {
+		return ""
+	}
+	if _, ssid, ok := strings.Cut(strings.TrimSpace(string(out)), "Network: "); ok {
+		return ssid
+	}
+	return ""
+}
@@ -0,0 +1,63 @@
+//go:build linux
+
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+func defaultGateway() net.IP {
+	bs, err := os.ReadFile("/proc/net/route")
+	if err != nil {
+		return nil
+	}
+	return parseRoutes(bs)
+}
+
+// parseRoutes finds the gateway of the default route in /proc/net/route, where
+// addresses are hex in host byte order
+func parseRoutes(bs []byte) net.IP {
+	scanner := bufio.NewScanner(bytes.NewReader(bs))
+	scanner.Scan() // Header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		raw, err := hex.DecodeString(fields[2])
+		if err != nil || len(raw) != 4 {
+			continue
+		}
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, binary.LittleEndian.Uint32(raw))
+		return ip
+	}
+	return nil
+}
+
+func currentSSID() string {
+	if out, err := exec.Command("iwgetid", "-r").Output(); err == nil {
+		return strings.TrimSpace(string(out))
+	}
+	out, err := exec.Command("nmcli", "-t", "-f", "active,ssid", "dev", "wifi").Output()
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if ssid, ok := strings.CutPrefix(line, "yes:"); ok {
+			return ssid
+		}
+	}
+	return ""
+}
@@ -0,0 +1,19 @@
+//go:build !linux && !darwin && !windows
+
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package config
+
+import (
+	"net"
+)
+
+func defaultGateway() net.IP {
+	return nil
+}
+
+func currentSSID() string {
+	return ""
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package config
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+const matchConfig = `hosts:
+  - id: "01"
+    name: bastion
+    remote: bastion.example.com:22
+    username: me
+tunnels:
+  - id: "10"
+    name: db
+    remote: db:5432
+    host: "01"
+match:
+  - when:
+      gateway: 10.1.0.0/16
+      env:
+        OFFICE: "y*"
+    hosts:
+      - id: "01"
+        remote: bastion.corp:22
+    tunnels:
+      - id: "11"
+        name: wiki
+        remote: wiki:443
+        host: "01"
+  - when:
+      hostname: "laptop-*"
+      os: plan9
+    hosts:
+      - id: "01"
+        username: nobody
+`
+
+func testEnvironment(gateway string, vars map[string]string) *environment {
+	return &environment{
+		hostname: func() string { return "laptop-7" },
+		os:       "linux",
+		gateway:  func() net.IP { return net.ParseIP(gateway) },
+		ssid:     func() string { return "" },
+		env: func(name string) (string, bool) {
+			value, ok := vars[name]
+			return value, ok
+		},
+	}
+}
+
+func TestResolveMatches(t *testing.T) {
+	tests := map[string]struct {
+		env     *environment
+		remote  string
+		tunnels int
+	}{
+		"office":     {env: testEnvironment("10.1.4.1", map[string]string{"OFFICE": "yes"}), remote: "bastion.corp:22", tunnels: 2},
+		"no env":     {env: testEnvironment("10.1.4.1", nil), remote: "bastion.example.com:22", tunnels: 1},
+		"elsewhere":  {env: testEnvironment("192.168.1.1", map[string]string{"OFFICE": "yes"}), remote: "bastion.example.com:22", tunnels: 1},
+		"no gateway": {env: testEnvironment("", map[string]string{"OFFICE": "yes"}), remote: "bastion.example.com:22", tunnels: 1},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			bs, err := resolve([]byte(matchConfig), test.env)
+			assert.NoError(tt, err)
+			cfg := &Configuration{}
+			assert.NoError(tt, yaml.Unmarshal(bs, cfg))
+			if assert.Len(tt, cfg.Hosts, 1) {
+				assert.Equal(tt, test.remote, cfg.Hosts[0].Remote.String())
+				assert.Equal(tt, "me", cfg.Hosts[0].Username)
+			}
+			assert.Len(tt, cfg.Tunnels, test.tunnels)
+		})
+	}
+}
+
+func TestResolveMatchesErrors(t *testing.T) {
+	env := testEnvironment("", nil)
+	bs := []byte("tunnels: []\n")
+	resolved, err := resolve(bs, env)
+	assert.NoError(t, err)
+	assert.Equal(t, bs, resolved)
+
+	_, err = resolve([]byte("match:\n  - when:\n      color: red\n"), env)
+	assert.ErrorContains(t, err, "field color not found")
+	_, err = resolve([]byte("match: office\n"), env)
+	assert.Error(t, err)
+}
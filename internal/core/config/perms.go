@@ -0,0 +1,56 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package config
+
+import (
+	"os"
+	"runtime"
+
+	"us.figge.auto-ssh/internal/core/log"
+)
+
+const (
+	// PrivatePerms are the permissions others must not have on a file holding
+	// secrets, as ssh insists of identity files
+	PrivatePerms os.FileMode = 0077
+	// SharedPerms are the permissions others must not have on a file they may
+	// read but whose changes are trusted, as ssh insists of known_hosts
+	SharedPerms os.FileMode = 0022
+)
+
+// CheckPermissions warns when others have any of the permissions forbidden
+// on the file, tightening them with --fix-perms, and with --strict-perms
+// refuses the file.  Files that do not exist and windows, whose files carry
+// no such permissions, are left to the caller
+func CheckPermissions(what string, path string, forbidden os.FileMode) bool {
+	if runtime.GOOS == "windows" {
+		return true
+	}
+	fi, err := os.Stat(path)
+	if err != nil || fi.IsDir() || fi.Mode().Perm()&forbidden == 0 {
+		return true
+	}
+	mode := fi.Mode().Perm()
+	access := "read"
+	if mode&forbidden&0022 != 0 {
+		access = "written"
+	}
+	if FixPermsFlag {
+		if err = os.Chmod(path, mode&^forbidden); err == nil {
+			log.Printf("  Info  - %s (%s) could be %s by others. Permissions changed from %04o to %04o\n",
+				what, path, access, mode, mode&^forbidden)
+			return true
+		}
+		log.Printf("  Error - %s (%s) permissions cannot be changed: %v\n", what, path, err)
+	}
+	if StrictPermsFlag {
+		log.Printf("  Error - %s (%s) can be %s by others (%04o). Run with --fix-perms or chmod %04o %s\n",
+			what, path, access, mode, mode&^forbidden, path)
+		return false
+	}
+	log.Printf("  Warn  - %s (%s) can be %s by others (%04o). Run with --fix-perms or chmod %04o %s\n",
+		what, path, access, mode, mode&^forbidden, path)
+	return true
+}
@@ -0,0 +1,50 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("windows files carry no unix permissions")
+	}
+	tests := map[string]struct {
+		mode      os.FileMode
+		forbidden os.FileMode
+		strict    bool
+		fix       bool
+		ok        bool
+		expected  os.FileMode
+	}{
+		"private":         {mode: 0600, forbidden: PrivatePerms, ok: true, expected: 0600},
+		"shared-readable": {mode: 0644, forbidden: SharedPerms, ok: true, expected: 0644},
+		"warn":            {mode: 0644, forbidden: PrivatePerms, ok: true, expected: 0644},
+		"strict":          {mode: 0640, forbidden: PrivatePerms, strict: true, ok: false, expected: 0640},
+		"fix":             {mode: 0664, forbidden: PrivatePerms, fix: true, ok: true, expected: 0600},
+		"fix-strict":      {mode: 0666, forbidden: SharedPerms, strict: true, fix: true, ok: true, expected: 0644},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			StrictPermsFlag, FixPermsFlag = test.strict, test.fix
+			defer func() { StrictPermsFlag, FixPermsFlag = false, false }()
+			path := filepath.Join(tt.TempDir(), "file")
+			require.NoError(tt, os.WriteFile(path, []byte("secret"), 0600))
+			require.NoError(tt, os.Chmod(path, test.mode))
+			assert.Equal(tt, test.ok, CheckPermissions("test file", path, test.forbidden))
+			fi, err := os.Stat(path)
+			require.NoError(tt, err)
+			assert.Equal(tt, test.expected, fi.Mode().Perm())
+		})
+	}
+	assert.True(t, CheckPermissions("test file", filepath.Join(t.TempDir(), "missing"), PrivatePerms))
+}
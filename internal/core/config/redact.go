@@ -0,0 +1,56 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package config
+
+import (
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+
+	"us.figge.auto-ssh/internal/core/log"
+)
+
+// Redact has the log replace the usernames, identity and known hosts files and
+// host names of the configuration with stable hashes when --redact is set, so
+// logs can be shipped to a third party.  The local user and their home
+// directory are redacted as well, as paths reveal them.  Loopback hosts reveal
+// nothing and are left for the entrances sharing them to remain readable
+func (c *Configuration) Redact() {
+	if !RedactFlag || c == nil {
+		return
+	}
+	if home, err := os.UserHomeDir(); err == nil && home != "/" {
+		log.Redact(home)
+	}
+	if u, err := user.Current(); err == nil {
+		log.Redact(u.Username)
+	}
+	for _, h := range c.Hosts {
+		log.Redact(h.Username, h.KnownHosts)
+		redactHost(h.Remote.Host())
+		if h.WebSocket != nil {
+			if u, err := url.Parse(h.WebSocket.URL); err == nil {
+				redactHost(u.Hostname())
+			}
+		}
+		if IsFileIdentity(h.Identity) {
+			log.Redact(h.Identity)
+		}
+	}
+	for _, t := range c.Tunnels {
+		redactHost(t.Remote.Host())
+		if t.Socks != nil {
+			log.Redact(t.Socks.Username)
+		}
+	}
+}
+
+func redactHost(host string) {
+	if ip := net.ParseIP(host); host == "localhost" || ip != nil && ip.IsLoopback() {
+		return
+	}
+	log.Redact(host)
+}
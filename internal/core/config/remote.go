@@ -0,0 +1,218 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package config
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultPollInterval = time.Minute
+
+	remoteTimeout = 30 * time.Second
+	// emptyHash is the sha256 of an empty request body
+	emptyHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+var (
+	ErrNotModified = errors.New("configuration not modified")
+	remoteClient   = &http.Client{Timeout: remoteTimeout}
+)
+
+// IsRemote reports whether the configuration source is fetched over http(s) or from s3
+func IsRemote(source string) bool {
+	return strings.HasPrefix(source, "https://") || strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "s3://")
+}
+
+// Read reads the configuration from a file or a remote source
+func Read(ctx context.Context, source string) ([]byte, error) {
+	bs, _, err := ReadLines(ctx, source)
+	return bs, err
+}
+
+// ReadLines reads the configuration as Read does, along with the lines of the
+// source each of its lines came from, for messages to refer to
+func ReadLines(ctx context.Context, source string) ([]byte, Lines, error) {
+	if !IsRemote(source) {
+		return readFile(source)
+	}
+	bs, lines, _, err := readRemote(ctx, source, "")
+	return bs, lines, err
+}
+
+// ReadRemote fetches the configuration from an https url or an s3 object,
+// returning ErrNotModified when its ETag still matches etag.  The fetched
+// configuration is decrypted, expanded and matched just as a local file would be
+func ReadRemote(ctx context.Context, source string, etag string) ([]byte, string, error) {
+	bs, _, etag, err := readRemote(ctx, source, etag)
+	return bs, etag, err
+}
+
+func readRemote(ctx context.Context, source string, etag string) ([]byte, Lines, string, error) {
+	req, err := remoteRequest(ctx, source)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if strings.HasPrefix(source, "s3://") {
+		signS3(req, time.Now())
+	}
+	resp, err := remoteClient.Do(req)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, nil, etag, ErrNotModified
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, "", fmt.Errorf("configuration (%s) cannot be fetched: %s", source, resp.Status)
+	}
+	bs, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if bs, err = decryptRemote(source, bs); err != nil {
+		return nil, nil, "", err
+	}
+	bs, lines, err := resolveLines(bs, localEnvironment())
+	return bs, lines, resp.Header.Get("ETag"), err
+}
+
+func remoteRequest(ctx context.Context, source string) (*http.Request, error) {
+	u, err := url.Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "s3" {
+		if u.Host == "" || strings.Trim(u.Path, "/") == "" {
+			return nil, fmt.Errorf("s3 source (%s) must be s3://bucket/key", source)
+		}
+		u = s3URL(u.Host, strings.TrimPrefix(u.Path, "/"))
+	}
+	return http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+}
+
+// decryptRemote decrypts fetched configuration.  sops only reads files, so
+// sops encrypted configuration is written to a temporary file first
+func decryptRemote(source string, bs []byte) ([]byte, error) {
+	if !(sopsRegEx.Match(bs) && sopsMacRegEx.Match(bs)) {
+		return decrypt(source, bs)
+	}
+	f, err := os.CreateTemp("", "auto-ssh-*"+filepath.Ext(source))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+	_, err = f.Write(bs)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decryptSops(f.Name())
+}
+
+func s3Region() string {
+	for _, name := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if region := os.Getenv(name); region != "" {
+			return region
+		}
+	}
+	return "us-east-1"
+}
+
+// s3URL addresses the object virtual host style on aws, or path style when
+// AWS_ENDPOINT_URL_S3 or AWS_ENDPOINT_URL point at an s3 compatible store
+func s3URL(bucket string, key string) *url.URL {
+	for _, name := range []string{"AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"} {
+		if endpoint := os.Getenv(name); endpoint != "" {
+			if u, err := url.Parse(strings.TrimSuffix(endpoint, "/")); err == nil {
+				u.Path += "/" + bucket + "/" + key
+				return u
+			}
+		}
+	}
+	return &url.URL{Scheme: "https", Host: fmt.Sprintf("%s.s3.%s.amazonaws.com", bucket, s3Region()), Path: "/" + key}
+}
+
+// signS3 signs the request with AWS signature version 4 using the credentials
+// from the environment.  Without credentials the request is sent anonymously
+func signS3(req *http.Request, now time.Time) {
+	accessKey, secretKey := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKey == "" || secretKey == "" {
+		return
+	}
+	if token := os.Getenv("AWS_SESSION_TOKEN"); token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+	sign(req, accessKey, secretKey, s3Region(), now)
+}
+
+func sign(req *http.Request, accessKey string, secretKey string, region string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", amzDate[:8], region)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptyHash)
+
+	// Every header present is signed, other than the conditional one which changes between polls
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		if name != "If-None-Match" {
+			headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	canonicalHeaders := &strings.Builder{}
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptyHash,
+	}, "\n")
+	hash := sha256.Sum256([]byte(canonical))
+	toSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(hash[:])}, "\n")
+
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{amzDate[:8], region, "s3", "aws4_request"} {
+		key = hmacSha256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSha256(key, toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
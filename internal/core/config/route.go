@@ -0,0 +1,63 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package config
+
+import (
+	"strings"
+
+	"us.figge.auto-ssh/internal/core/log"
+)
+
+// Route sends the tls clients of a tunnel asking for ServerName to its own
+// forward address, so one entrance can front many services.  A ServerName of
+// *.example.com matches any one label in front of example.com
+type Route struct {
+	ServerName string   `yaml:"serverName" json:"serverName"`
+	Remote     *Address `yaml:"remote" json:"remote"`
+}
+
+func (r *Route) Validate(group string, name string) bool {
+	valid := true
+	r.ServerName = strings.ToLower(strings.TrimSpace(r.ServerName))
+	if r.ServerName == "" {
+		log.Printf("  Error - %s(%s) route serverName cannot be blank\n", group, name)
+		valid = false
+	} else if strings.Contains(strings.TrimPrefix(r.ServerName, "*."), "*") {
+		log.Printf("  Error - %s(%s) route serverName(%s) may only start with a wildcard label\n", group, name, r.ServerName)
+		valid = false
+	}
+	if r.Remote == nil || r.Remote.IsBlank() {
+		log.Printf("  Error - %s(%s) route (%s) requires a forward address\n", group, name, r.ServerName)
+		valid = false
+	} else if !r.Remote.Validate(group, name, "route forward address", true, false) {
+		valid = false
+	}
+	return valid
+}
+
+// Matches reports whether the route is for the server a client asked for
+func (r *Route) Matches(serverName string) bool {
+	if domain, ok := strings.CutPrefix(r.ServerName, "*."); ok {
+		label, rest, found := strings.Cut(serverName, ".")
+		return found && label != "" && strings.EqualFold(rest, domain)
+	}
+	return strings.EqualFold(r.ServerName, serverName)
+}
+
+// MatchRoute returns the route for the server a client asked for, routes
+// naming the server outright being preferred to wildcards
+func MatchRoute(routes []*Route, serverName string) *Route {
+	var wildcard *Route
+	for _, r := range routes {
+		if !r.Matches(serverName) {
+			continue
+		} else if !strings.HasPrefix(r.ServerName, "*.") {
+			return r
+		} else if wildcard == nil {
+			wildcard = r
+		}
+	}
+	return wildcard
+}
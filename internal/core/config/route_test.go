@@ -0,0 +1,50 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchRoute(t *testing.T) {
+	routes := []*Route{
+		{ServerName: "*.example.com", Remote: NewAddress("10.0.0.1:443")},
+		{ServerName: "api.example.com", Remote: NewAddress("10.0.0.2:443")},
+		{ServerName: "other.net", Remote: NewAddress("10.0.0.3:443")},
+	}
+	for _, r := range routes {
+		assert.True(t, r.Validate("tunnel", "test"))
+	}
+
+	tests := map[string]struct {
+		serverName string
+		remote     string
+	}{
+		"exact preferred to wildcard": {serverName: "api.example.com", remote: "10.0.0.2:443"},
+		"wildcard":                    {serverName: "www.example.com", remote: "10.0.0.1:443"},
+		"case insensitive":            {serverName: "Other.NET", remote: "10.0.0.3:443"},
+		"wildcard needs a label":      {serverName: "example.com"},
+		"wildcard matches one label":  {serverName: "a.b.example.com"},
+		"no server name":              {serverName: ""},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			route := MatchRoute(routes, test.serverName)
+			if test.remote == "" {
+				assert.Nil(tt, route)
+			} else if assert.NotNil(tt, route) {
+				assert.Equal(tt, test.remote, route.Remote.String())
+			}
+		})
+	}
+}
+
+func TestRouteValidate(t *testing.T) {
+	assert.False(t, (&Route{ServerName: " ", Remote: NewAddress("10.0.0.1:443")}).Validate("tunnel", "test"))
+	assert.False(t, (&Route{ServerName: "a.*.com", Remote: NewAddress("10.0.0.1:443")}).Validate("tunnel", "test"))
+	assert.False(t, (&Route{ServerName: "a.com"}).Validate("tunnel", "test"))
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/log"
+)
+
+const minutesPerDay = 24 * 60
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Schedule limits a tunnel to windows of the week, in the given time zone or
+// otherwise local time.  The tunnel is started as a window opens and stopped as
+// the last one open closes
+type Schedule struct {
+	Timezone string    `yaml:"timezone,omitempty" json:"timezone,omitempty"`
+	Windows  []*Window `yaml:"windows" json:"windows"`
+	location *time.Location
+}
+
+// Window is open from From until To, as hh:mm, on each of its Days.  Days are
+// a list and ranges of weekdays such as "mon-fri,sun", defaulting to every day.
+// A window ending before it starts runs on past midnight, while one without
+// times is open all day
+type Window struct {
+	Days string `yaml:"days,omitempty" json:"days,omitempty"`
+	From string `yaml:"from,omitempty" json:"from,omitempty"`
+	To   string `yaml:"to,omitempty" json:"to,omitempty"`
+	days [7]bool
+	from int
+	to   int
+}
+
+func (s *Schedule) Validate(group string, name string) bool {
+	if s == nil {
+		return true
+	}
+	valid := true
+	s.location = time.Local
+	if s.Timezone != "" {
+		location, err := time.LoadLocation(s.Timezone)
+		if err != nil {
+			log.Printf("  Error - %s(%s) schedule timezone(%s) unknown: %v\n", group, name, s.Timezone, err)
+			valid = false
+		}
+		s.location = location
+	}
+	if len(s.Windows) == 0 {
+		log.Printf("  Error - %s(%s) schedule requires at least one window\n", group, name)
+		valid = false
+	}
+	for i, w := range s.Windows {
+		if err := w.parse(); err != nil {
+			log.Printf("  Error - %s(%s) schedule window %d: %v\n", group, name, i+1, err)
+			valid = false
+		}
+	}
+	return valid
+}
+
+// Active reports whether any window is open at the given time.  There being
+// no schedule, the tunnel is always active
+func (s *Schedule) Active(now time.Time) bool {
+	if s == nil {
+		return true
+	}
+	if s.location != nil {
+		now = now.In(s.location)
+	}
+	minute := now.Hour()*60 + now.Minute()
+	today := now.Weekday()
+	yesterday := (today + 6) % 7
+	for _, w := range s.Windows {
+		if w.from < w.to {
+			if w.days[today] && minute >= w.from && minute < w.to {
+				return true
+			}
+		} else if w.days[today] && minute >= w.from || w.days[yesterday] && minute < w.to {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *Window) parse() error {
+	if w == nil {
+		return fmt.Errorf("cannot be empty")
+	}
+	var err error
+	if w.days, err = parseDays(w.Days); err != nil {
+		return err
+	}
+	if w.from, err = parseClock(w.From, 0); err != nil {
+		return fmt.Errorf("from: %w", err)
+	} else if w.from == minutesPerDay {
+		return fmt.Errorf("from(%s) must be before 24:00", w.From)
+	}
+	if w.to, err = parseClock(w.To, minutesPerDay); err != nil {
+		return fmt.Errorf("to: %w", err)
+	}
+	if w.from == w.to {
+		return fmt.Errorf("from(%s) and to(%s) cannot be the same", w.From, w.To)
+	}
+	return nil
+}
+
+func parseDays(spec string) ([7]bool, error) {
+	var days [7]bool
+	if strings.TrimSpace(spec) == "" {
+		return [7]bool{true, true, true, true, true, true, true}, nil
+	}
+	for _, part := range strings.Split(spec, ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		start, ok := weekdays[strings.ToLower(strings.TrimSpace(first))]
+		if !ok {
+			return days, fmt.Errorf("day(%s) unknown", strings.TrimSpace(first))
+		}
+		end := start
+		if isRange {
+			if end, ok = weekdays[strings.ToLower(strings.TrimSpace(last))]; !ok {
+				return days, fmt.Errorf("day(%s) unknown", strings.TrimSpace(last))
+			}
+		}
+		for d := start; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == end {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// parseClock returns the minute of the day of an hh:mm time, 24:00 being the
+// end of the day
+func parseClock(clock string, blank int) (int, error) {
+	if clock == "" {
+		return blank, nil
+	}
+	var hour, minute int
+	if n, err := fmt.Sscanf(clock, "%d:%d", &hour, &minute); err != nil || n != 2 {
+		return 0, fmt.Errorf("time(%s) must be hh:mm", clock)
+	}
+	if hour < 0 || minute < 0 || minute > 59 || hour*60+minute > minutesPerDay {
+		return 0, fmt.Errorf("time(%s) out of range", clock)
+	}
+	return hour*60 + minute, nil
+}
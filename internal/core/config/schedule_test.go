@@ -0,0 +1,75 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduleActive(t *testing.T) {
+	schedule := &Schedule{
+		Timezone: "UTC",
+		Windows: []*Window{
+			{Days: "mon-fri", From: "09:00", To: "17:30"},
+			{Days: "sat", From: "22:00", To: "02:00"},
+		},
+	}
+	assert.True(t, schedule.Validate("tunnel", "test"))
+
+	// 2024-01-01 is a Monday
+	tests := map[string]struct {
+		at     time.Time
+		active bool
+	}{
+		"before hours":       {at: time.Date(2024, 1, 1, 8, 59, 0, 0, time.UTC), active: false},
+		"opening":            {at: time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC), active: true},
+		"closing":            {at: time.Date(2024, 1, 5, 17, 30, 0, 0, time.UTC), active: false},
+		"weekend":            {at: time.Date(2024, 1, 6, 12, 0, 0, 0, time.UTC), active: false},
+		"saturday night":     {at: time.Date(2024, 1, 6, 23, 0, 0, 0, time.UTC), active: true},
+		"past midnight":      {at: time.Date(2024, 1, 7, 1, 59, 0, 0, time.UTC), active: true},
+		"after late window":  {at: time.Date(2024, 1, 7, 2, 0, 0, 0, time.UTC), active: false},
+		"other time zone":    {at: time.Date(2024, 1, 1, 9, 0, 0, 0, time.FixedZone("EST", -5*60*60)), active: true},
+		"monday before 2 am": {at: time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC), active: false},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			assert.Equal(tt, test.active, schedule.Active(test.at))
+		})
+	}
+	assert.True(t, (*Schedule)(nil).Active(time.Now()))
+}
+
+func TestScheduleValidate(t *testing.T) {
+	tests := map[string]struct {
+		window *Window
+		valid  bool
+	}{
+		"all day":         {window: &Window{}, valid: true},
+		"day range wraps": {window: &Window{Days: "fri-mon"}, valid: true},
+		"day list":        {window: &Window{Days: "Mon, wed,sun", From: "08:00"}, valid: true},
+		"end of day":      {window: &Window{From: "18:00", To: "24:00"}, valid: true},
+		"unknown day":     {window: &Window{Days: "monday"}, valid: false},
+		"bad time":        {window: &Window{From: "9am"}, valid: false},
+		"out of range":    {window: &Window{To: "25:00"}, valid: false},
+		"empty window":    {window: &Window{From: "10:00", To: "10:00"}, valid: false},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			schedule := &Schedule{Windows: []*Window{test.window}}
+			assert.Equal(tt, test.valid, schedule.Validate("tunnel", "test"))
+		})
+	}
+	assert.False(t, (&Schedule{}).Validate("tunnel", "test"))
+	assert.False(t, (&Schedule{Timezone: "Mars/Olympus", Windows: []*Window{{}}}).Validate("tunnel", "test"))
+}
+
+func TestParseDays(t *testing.T) {
+	days, err := parseDays("fri-mon")
+	assert.NoError(t, err)
+	assert.Equal(t, [7]bool{true, true, false, false, false, true, true}, days)
+}
@@ -0,0 +1,44 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package config
+
+import (
+	"net"
+)
+
+// Apply tunes a tcp connection, quietly ignoring connections that are not
+// tcp such as ssh channels
+func (s *Socket) Apply(conn net.Conn) error {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if s == nil || !ok {
+		return nil
+	}
+	if s.NoDelay != nil {
+		if err := tcpConn.SetNoDelay(*s.NoDelay); err != nil {
+			return err
+		}
+	}
+	if s.KeepAlive != nil {
+		if err := tcpConn.SetKeepAlive(*s.KeepAlive); err != nil {
+			return err
+		}
+	}
+	if s.KeepAliveInterval > 0 && (s.KeepAlive == nil || *s.KeepAlive) {
+		if err := tcpConn.SetKeepAlivePeriod(s.KeepAliveInterval.Duration()); err != nil {
+			return err
+		}
+	}
+	if s.SendBuffer > 0 {
+		if err := tcpConn.SetWriteBuffer(s.SendBuffer); err != nil {
+			return err
+		}
+	}
+	if s.ReceiveBuffer > 0 {
+		if err := tcpConn.SetReadBuffer(s.ReceiveBuffer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
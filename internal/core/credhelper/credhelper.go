@@ -0,0 +1,182 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+// Package credhelper asks external commands for the secrets a host needs, in
+// the manner of git credential helpers.  The helper command is run by the
+// shell with get, or erase once a secret has been refused, appended, and sent
+// key=value lines on stdin ending with a blank line:
+//
+//	protocol=ssh
+//	host=bastion.example.com:22
+//	username=me
+//	name=bastion
+//	kind=password|passphrase|otp
+//	prompt=Verification code:
+//
+// For get it answers with key=value lines of its own, password holding the
+// secret and the optional password_expiry_utc the unix time it expires.  Other
+// keys are ignored.  Passwords and passphrases are cached for the ttl, or until
+// they expire if sooner, one-time passwords never
+package credhelper
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	KindPassword   = "password"
+	KindPassphrase = "passphrase"
+	KindOTP        = "otp"
+
+	actionGet   = "get"
+	actionErase = "erase"
+)
+
+var ErrHelper = errors.New("credential helper failed")
+
+// Request describes the secret wanted
+type Request struct {
+	Host     string
+	Username string
+	Name     string
+	Kind     string
+	Prompt   string
+}
+
+func (r *Request) key() string {
+	return r.Kind + "\x00" + r.Username + "\x00" + r.Host + "\x00" + r.Prompt
+}
+
+type cached struct {
+	secret  string
+	expires time.Time
+}
+
+// Helper runs a credential helper command, caching the secrets it returns
+type Helper struct {
+	command string
+	ttl     time.Duration
+	lock    sync.Mutex
+	cache   map[string]cached
+}
+
+func New(command string, ttl time.Duration) *Helper {
+	return &Helper{command: command, ttl: ttl, cache: make(map[string]cached)}
+}
+
+// Get returns the secret, from the cache while it lasts
+func (h *Helper) Get(ctx context.Context, req *Request) (string, error) {
+	key := req.key()
+	h.lock.Lock()
+	if c, ok := h.cache[key]; ok && time.Now().Before(c.expires) {
+		h.lock.Unlock()
+		return c.secret, nil
+	}
+	h.lock.Unlock()
+
+	out, err := h.run(ctx, actionGet, req)
+	if err != nil {
+		return "", err
+	}
+	values := parse(out)
+	secret, ok := values["password"]
+	if !ok {
+		return "", fmt.Errorf("%w: %s gave no %s", ErrHelper, h.command, req.Kind)
+	}
+	if req.Kind != KindOTP && h.ttl > 0 {
+		expires := time.Now().Add(h.ttl)
+		if unix, err := strconv.ParseInt(values["password_expiry_utc"], 10, 64); err == nil && time.Unix(unix, 0).Before(expires) {
+			expires = time.Unix(unix, 0)
+		}
+		h.lock.Lock()
+		h.cache[key] = cached{secret: secret, expires: expires}
+		h.lock.Unlock()
+	}
+	return secret, nil
+}
+
+// Erase forgets the cached secrets of the kind and tells the helper they were
+// refused, so it can drop any it keeps
+func (h *Helper) Erase(ctx context.Context, req *Request) error {
+	h.lock.Lock()
+	for key := range h.cache {
+		if strings.HasPrefix(key, req.Kind+"\x00"+req.Username+"\x00"+req.Host+"\x00") {
+			delete(h.cache, key)
+		}
+	}
+	h.lock.Unlock()
+	_, err := h.run(ctx, actionErase, req)
+	return err
+}
+
+// Clear forgets every cached secret
+func (h *Helper) Clear() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	clear(h.cache)
+}
+
+func (h *Helper) run(ctx context.Context, action string, req *Request) ([]byte, error) {
+	var in bytes.Buffer
+	in.WriteString("protocol=ssh\n")
+	for _, kv := range [][2]string{
+		{"host", req.Host},
+		{"username", req.Username},
+		{"name", req.Name},
+		{"kind", req.Kind},
+		{"prompt", req.Prompt},
+	} {
+		if kv[1] != "" {
+			in.WriteString(kv[0] + "=" + strings.ReplaceAll(kv[1], "\n", " ") + "\n")
+		}
+	}
+	in.WriteString("\n")
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		fields := strings.Fields(h.command)
+		cmd = exec.CommandContext(ctx, fields[0], append(fields[1:], action)...)
+	} else {
+		cmd = exec.CommandContext(ctx, "/bin/sh", "-c", h.command+" "+action)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = &in
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s %s: %v: %s", ErrHelper, h.command, action, err, msg)
+		}
+		return nil, fmt.Errorf("%w: %s %s: %v", ErrHelper, h.command, action, err)
+	}
+	return stdout.Bytes(), nil
+}
+
+func parse(out []byte) map[string]string {
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			break
+		}
+		if key, value, ok := strings.Cut(line, "="); ok {
+			values[key] = value
+		}
+	}
+	return values
+}
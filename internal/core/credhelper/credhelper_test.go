@@ -0,0 +1,86 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package credhelper
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// helper writes a script counting its runs and answering with the kind asked
+// for, returning the helper command and the file of runs
+func helper(t *testing.T, answer string) (string, string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("helper scripts need a posix shell")
+	}
+	dir := t.TempDir()
+	runs := filepath.Join(dir, "runs")
+	script := filepath.Join(dir, "helper")
+	body := "#!/bin/sh\nkind=$(grep '^kind=' | cut -d= -f2)\necho \"$1 $kind\" >> " + runs + "\n" +
+		"[ \"$1\" = get ] && printf '" + answer + "' \"$kind\"\nexit 0\n"
+	require.NoError(t, os.WriteFile(script, []byte(body), 0700))
+	return script, runs
+}
+
+func lines(t *testing.T, file string) []string {
+	bs, err := os.ReadFile(file)
+	require.NoError(t, err)
+	return strings.Split(strings.TrimSpace(string(bs)), "\n")
+}
+
+func TestGetCaches(t *testing.T) {
+	command, runs := helper(t, `username=me\npassword=%s-secret\n`)
+	h := New(command, time.Minute)
+	req := &Request{Host: "bastion:22", Username: "me", Kind: KindPassword}
+
+	secret, err := h.Get(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, "password-secret", secret)
+	_, err = h.Get(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"get password"}, lines(t, runs))
+
+	require.NoError(t, h.Erase(context.Background(), req))
+	_, err = h.Get(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"get password", "erase password", "get password"}, lines(t, runs))
+}
+
+func TestGetOTPNotCached(t *testing.T) {
+	command, runs := helper(t, `password=123456\n`)
+	h := New(command, time.Minute)
+	req := &Request{Host: "bastion:22", Kind: KindOTP, Prompt: "Verification code: "}
+	for range 2 {
+		secret, err := h.Get(context.Background(), req)
+		require.NoError(t, err)
+		assert.Equal(t, "123456", secret)
+	}
+	assert.Len(t, lines(t, runs), 2)
+}
+
+func TestGetExpiry(t *testing.T) {
+	command, runs := helper(t, `password=x\npassword_expiry_utc=1\n`)
+	h := New(command, time.Minute)
+	req := &Request{Host: "bastion:22", Kind: KindPassphrase}
+	for range 2 {
+		_, err := h.Get(context.Background(), req)
+		require.NoError(t, err)
+	}
+	assert.Len(t, lines(t, runs), 2)
+}
+
+func TestGetMissing(t *testing.T) {
+	command, _ := helper(t, `username=%s\n`)
+	_, err := New(command, time.Minute).Get(context.Background(), &Request{Kind: KindPassword})
+	assert.ErrorIs(t, err, ErrHelper)
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package damping
+
+import (
+	"time"
+
+	"us.figge.auto-ssh/internal/core/utils/backoff"
+)
+
+// Damper tracks the connections to a host dropping, or flapping, declaring the
+// host unstable once it flaps too often within a window and holding it down,
+// refusing to connect, for a time that doubles each time it is declared so.
+// Failed connections are spaced out with a backoff.  A Damper is not safe for
+// concurrent use, being guarded by the lock of its host
+type Damper struct {
+	flaps       int
+	window      time.Duration
+	holdDown    time.Duration
+	maxHoldDown time.Duration
+	retry       *backoff.Backoff
+
+	dropped   []time.Time
+	penalty   time.Duration
+	heldUntil time.Time
+	retryAt   time.Time
+	upSince   time.Time
+	unstable  bool
+}
+
+func NewDamper(flaps int, window, holdDown, maxHoldDown, retryInterval time.Duration) *Damper {
+	return &Damper{
+		flaps:       flaps,
+		window:      window,
+		holdDown:    holdDown,
+		maxHoldDown: maxHoldDown,
+		retry:       backoff.NewBackoff(retryInterval, maxHoldDown),
+		penalty:     holdDown,
+	}
+}
+
+// Allow reports whether the host may be connected to, or else how long until
+// it may be
+func (d *Damper) Allow(now time.Time) (time.Duration, bool) {
+	if now.Before(d.heldUntil) {
+		return d.heldUntil.Sub(now), false
+	}
+	if now.Before(d.retryAt) {
+		return d.retryAt.Sub(now), false
+	}
+	return 0, true
+}
+
+// Failed spaces out the next attempt after a connection failed
+func (d *Damper) Failed(now time.Time) {
+	d.retryAt = now.Add(d.retry.Next())
+}
+
+func (d *Damper) Connected(now time.Time) {
+	d.retry.Reset()
+	d.retryAt = time.Time{}
+	d.upSince = now
+}
+
+// Dropped records the connection flapping, reporting whether the host has just
+// been declared unstable and for how long it is held down
+func (d *Damper) Dropped(now time.Time) (time.Duration, bool) {
+	d.upSince = time.Time{}
+	kept := d.dropped[:0]
+	for _, t := range d.dropped {
+		if now.Sub(t) < d.window {
+			kept = append(kept, t)
+		}
+	}
+	d.dropped = append(kept, now)
+	if len(d.dropped) < d.flaps {
+		return 0, false
+	}
+	hold := d.penalty
+	d.heldUntil = now.Add(hold)
+	d.penalty = min(2*d.penalty, d.maxHoldDown)
+	d.dropped = nil
+	d.unstable = true
+	return hold, true
+}
+
+// Stable reports whether an unstable host has since stayed connected for the
+// window, forgiving the hold downs it has served when it has
+func (d *Damper) Stable(now time.Time) bool {
+	if !d.unstable || d.upSince.IsZero() || now.Sub(d.upSince) < d.window {
+		return false
+	}
+	d.unstable = false
+	d.penalty = d.holdDown
+	return true
+}
+
+func (d *Damper) Unstable() bool {
+	return d.unstable
+}
+
+func (d *Damper) Window() time.Duration {
+	return d.window
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package damping
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDamperHoldsDownFlappingHost(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	d := NewDamper(3, time.Minute, 10*time.Second, 25*time.Second, time.Second)
+	for i := 0; i < 2; i++ {
+		d.Connected(now)
+		_, declared := d.Dropped(now)
+		assert.False(t, declared)
+		now = now.Add(time.Second)
+	}
+	d.Connected(now)
+	hold, declared := d.Dropped(now)
+	assert.True(t, declared)
+	assert.Equal(t, 10*time.Second, hold)
+	assert.True(t, d.Unstable())
+
+	wait, ok := d.Allow(now.Add(4 * time.Second))
+	assert.False(t, ok)
+	assert.Equal(t, 6*time.Second, wait)
+	_, ok = d.Allow(now.Add(10 * time.Second))
+	assert.True(t, ok)
+
+	// Declared again, the hold down doubles up to its maximum
+	for i := 0; i < 3; i++ {
+		hold, declared = d.Dropped(now)
+	}
+	assert.True(t, declared)
+	assert.Equal(t, 20*time.Second, hold)
+	for i := 0; i < 3; i++ {
+		hold, _ = d.Dropped(now)
+	}
+	assert.Equal(t, 25*time.Second, hold)
+}
+
+func TestDamperForgetsOldFlaps(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	d := NewDamper(2, time.Minute, 10*time.Second, time.Minute, time.Second)
+	_, declared := d.Dropped(now)
+	assert.False(t, declared)
+	_, declared = d.Dropped(now.Add(2 * time.Minute))
+	assert.False(t, declared)
+	_, declared = d.Dropped(now.Add(2*time.Minute + time.Second))
+	assert.True(t, declared)
+}
+
+func TestDamperStable(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	d := NewDamper(1, time.Minute, 10*time.Second, time.Minute, time.Second)
+	hold, _ := d.Dropped(now)
+	assert.Equal(t, 10*time.Second, hold)
+	d.Connected(now.Add(hold))
+	assert.False(t, d.Stable(now.Add(30*time.Second)))
+	assert.True(t, d.Stable(now.Add(hold+time.Minute)))
+	assert.False(t, d.Unstable())
+	assert.False(t, d.Stable(now.Add(hold+time.Minute)))
+
+	// Forgiven, the next hold down starts over
+	hold, _ = d.Dropped(now.Add(2 * time.Minute))
+	assert.Equal(t, 10*time.Second, hold)
+}
+
+func TestDamperSpacesOutFailures(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	d := NewDamper(3, time.Minute, 10*time.Second, 3*time.Second, time.Second)
+	d.Failed(now)
+	wait, ok := d.Allow(now)
+	assert.False(t, ok)
+	assert.Equal(t, time.Second, wait)
+	d.Failed(now)
+	wait, _ = d.Allow(now)
+	assert.Equal(t, 2*time.Second, wait)
+	d.Failed(now)
+	wait, _ = d.Allow(now)
+	assert.Equal(t, 3*time.Second, wait)
+
+	d.Connected(now)
+	_, ok = d.Allow(now)
+	assert.True(t, ok)
+	d.Failed(now)
+	wait, _ = d.Allow(now)
+	assert.Equal(t, time.Second, wait)
+}
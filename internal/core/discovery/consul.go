@@ -0,0 +1,41 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package discovery
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"us.figge.auto-ssh/internal/core/config"
+)
+
+// Consul calls the http api of a consul agent
+type Consul struct {
+	client  *http.Client
+	address string
+	headers map[string]string
+}
+
+func NewConsul(client *http.Client, cfg *config.Consul) *Consul {
+	c := &Consul{
+		client:  client,
+		address: strings.TrimSuffix(cfg.Address, "/"),
+		headers: map[string]string{},
+	}
+	if c.address == "" {
+		c.address = config.DefaultConsulAddress
+	}
+	if cfg.Token != "" {
+		c.headers["X-Consul-Token"] = cfg.Token
+	}
+	return c
+}
+
+// Call sends body to the api, a path such as /v1/agent/service/register with
+// any query, decoding the response into result
+func (c *Consul) Call(ctx context.Context, method string, api string, body, result interface{}) error {
+	return call(ctx, c.client, method, c.address+api, c.headers, body, result)
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+// Package discovery talks to the consul agent and etcd v3 json gateway apis
+// that tunnels are registered with and leader locks are held in
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ErrNotFound is an api answering 404, as consul does for a session or check
+// that no longer exists
+var ErrNotFound = errors.New("not found")
+
+// call sends a json request and decodes any json response into result
+func call(ctx context.Context, client *http.Client, method, url string, headers map[string]string, body, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		bs, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(bs)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	bs, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s %s returned %d", ErrNotFound, method, url, resp.StatusCode)
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s %s returned %d: %s", method, url, resp.StatusCode, bytes.TrimSpace(bs))
+	}
+	if result != nil && len(bs) > 0 {
+		return json.Unmarshal(bs, result)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"us.figge.auto-ssh/internal/core/config"
+)
+
+func TestConsulCall(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secret", r.Header.Get("X-Consul-Token"))
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		switch r.URL.Path {
+		case "/v1/session/create":
+			body, _ := io.ReadAll(r.Body)
+			assert.JSONEq(t, `{"Name":"test"}`, string(body))
+			_, _ = w.Write([]byte(`{"ID":"abc"}`))
+		case "/v1/session/renew/gone":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte("broken\n"))
+		}
+	}))
+	defer server.Close()
+	c := NewConsul(server.Client(), &config.Consul{Address: server.URL + "/", Token: "secret"})
+
+	created := &struct{ ID string }{}
+	require.NoError(t, c.Call(context.Background(), http.MethodPut, "/v1/session/create", map[string]string{"Name": "test"}, created))
+	assert.Equal(t, "abc", created.ID)
+	assert.ErrorIs(t, c.Call(context.Background(), http.MethodPut, "/v1/session/renew/gone", nil, nil), ErrNotFound)
+	err := c.Call(context.Background(), http.MethodGet, "/v1/other", nil, nil)
+	assert.EqualError(t, err, "GET "+server.URL+"/v1/other returned 500: broken")
+}
+
+func TestEtcdLease(t *testing.T) {
+	ttl := "30"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		body := map[string]any{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		switch r.URL.Path {
+		case "/v3/lease/grant":
+			assert.Equal(t, float64(30), body["TTL"])
+			_, _ = w.Write([]byte(`{"ID":"7","TTL":"30"}`))
+		case "/v3/lease/keepalive":
+			assert.Equal(t, "7", body["ID"])
+			_, _ = w.Write([]byte(`{"result":{"ID":"7","TTL":"` + ttl + `"}}`))
+		case "/v3/lease/revoke":
+			_, _ = w.Write([]byte(`{}`))
+		}
+	}))
+	defer server.Close()
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+	e := NewEtcd(server.Client(), &config.Etcd{Endpoints: []string{unreachable.URL, server.URL + "/"}})
+
+	ctx := context.Background()
+	lease, err := e.Grant(ctx, 30*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "7", lease)
+	assert.NoError(t, e.KeepAlive(ctx, lease))
+	ttl = "0"
+	assert.ErrorIs(t, e.KeepAlive(ctx, lease), ErrLeaseExpired)
+	assert.NoError(t, e.Revoke(ctx, lease))
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/config"
+)
+
+// ErrLeaseExpired is a lease etcd no longer has, along with its keys
+var ErrLeaseExpired = errors.New("lease expired")
+
+// Etcd calls the v3 json gateway of an etcd cluster
+type Etcd struct {
+	client    *http.Client
+	endpoints []string
+}
+
+type etcdLease struct {
+	ID  string `json:"ID"`
+	TTL string `json:"TTL"`
+}
+
+func NewEtcd(client *http.Client, cfg *config.Etcd) *Etcd {
+	e := &Etcd{client: client}
+	for _, endpoint := range cfg.Endpoints {
+		e.endpoints = append(e.endpoints, strings.TrimSuffix(endpoint, "/"))
+	}
+	if len(e.endpoints) == 0 {
+		e.endpoints = []string{config.DefaultEtcdEndpoint}
+	}
+	return e
+}
+
+// Call posts body to the api, such as /v3/kv/put, trying each endpoint in turn
+// until one answers
+func (e *Etcd) Call(ctx context.Context, api string, body, result interface{}) error {
+	var err error
+	for _, endpoint := range e.endpoints {
+		if err = call(ctx, e.client, http.MethodPost, endpoint+api, nil, body, result); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// Grant creates a lease lasting ttl unless kept alive, returning its id
+func (e *Etcd) Grant(ctx context.Context, ttl time.Duration) (string, error) {
+	lease := &etcdLease{}
+	if err := e.Call(ctx, "/v3/lease/grant", map[string]interface{}{"TTL": int64(ttl.Seconds())}, lease); err != nil {
+		return "", err
+	}
+	if lease.ID == "" {
+		return "", errors.New("lease grant returned no lease")
+	}
+	return lease.ID, nil
+}
+
+// KeepAlive renews the lease, failing with ErrLeaseExpired once it has gone
+func (e *Etcd) KeepAlive(ctx context.Context, lease string) error {
+	result := &struct {
+		Result etcdLease `json:"result"`
+	}{}
+	if err := e.Call(ctx, "/v3/lease/keepalive", map[string]string{"ID": lease}, result); err != nil {
+		return err
+	}
+	if result.Result.TTL == "" || result.Result.TTL == "0" {
+		return fmt.Errorf("%w: lease %s", ErrLeaseExpired, lease)
+	}
+	return nil
+}
+
+// Revoke ends the lease, deleting the keys bound to it
+func (e *Etcd) Revoke(ctx context.Context, lease string) error {
+	return e.Call(ctx, "/v3/lease/revoke", map[string]string{"ID": lease}, nil)
+}
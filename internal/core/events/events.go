@@ -0,0 +1,100 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	KindTunnel     = "tunnel"
+	KindHost       = "host"
+	KindConnection = "connection"
+)
+
+// Event is a change in the state of a tunnel, host or tunnel connection
+type Event struct {
+	Time   time.Time `json:"time"`
+	Kind   string    `json:"kind"`
+	Id     string    `json:"id"`
+	Name   string    `json:"name"`
+	State  string    `json:"state"`
+	Detail string    `json:"detail,omitempty"`
+	// Connection numbers the tunnel's client connection of a connection event,
+	// the id and name being the tunnel's
+	Connection int64 `json:"connection,omitempty"`
+}
+
+// Subscription receives the events published after it was made.  Events are
+// dropped rather than wait on a subscriber that has fallen behind
+type Subscription struct {
+	C       <-chan Event
+	c       chan Event
+	dropped atomic.Int64
+}
+
+// Dropped is the number of events missed by falling behind
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+var (
+	lock        sync.Mutex
+	subscribers = make(map[*Subscription]struct{})
+)
+
+// Publish hands the event to every subscriber
+func Publish(kind string, id string, name string, state string, detail string) {
+	publish(Event{Time: time.Now(), Kind: kind, Id: id, Name: name, State: state, Detail: detail})
+}
+
+// PublishConnection hands an event of one of a tunnel's client connections to
+// every subscriber
+func PublishConnection(tunnelId string, tunnelName string, connection int64, state string, detail string) {
+	publish(Event{
+		Time:       time.Now(),
+		Kind:       KindConnection,
+		Id:         tunnelId,
+		Name:       tunnelName,
+		State:      state,
+		Detail:     detail,
+		Connection: connection,
+	})
+}
+
+func publish(e Event) {
+	lock.Lock()
+	defer lock.Unlock()
+	for s := range subscribers {
+		select {
+		case s.c <- e:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
+
+// Subscribe starts receiving events, holding up to buffer of them for the
+// subscriber
+func Subscribe(buffer int) *Subscription {
+	c := make(chan Event, buffer)
+	s := &Subscription{C: c, c: c}
+	lock.Lock()
+	defer lock.Unlock()
+	subscribers[s] = struct{}{}
+	return s
+}
+
+// Unsubscribe stops the events, closing the subscription's channel
+func Unsubscribe(s *Subscription) {
+	lock.Lock()
+	defer lock.Unlock()
+	if _, ok := subscribers[s]; ok {
+		delete(subscribers, s)
+		close(s.c)
+	}
+}
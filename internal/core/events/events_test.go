@@ -0,0 +1,41 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublish(t *testing.T) {
+	s := Subscribe(1)
+	Publish(KindTunnel, "10", "echo", "Started", "")
+	Publish(KindTunnel, "10", "echo", "Stopped", "")
+
+	e := <-s.C
+	assert.Equal(t, KindTunnel, e.Kind)
+	assert.Equal(t, "Started", e.State)
+	assert.False(t, e.Time.IsZero())
+	assert.Equal(t, int64(1), s.Dropped())
+
+	Unsubscribe(s)
+	_, open := <-s.C
+	assert.False(t, open)
+	Publish(KindHost, "01", "bastion", "Connected", "")
+	Unsubscribe(s)
+}
+
+func TestPublishConnection(t *testing.T) {
+	s := Subscribe(1)
+	defer Unsubscribe(s)
+	PublishConnection("10", "echo", 3, "Opened", "127.0.0.1:50000")
+
+	e := <-s.C
+	assert.Equal(t, KindConnection, e.Kind)
+	assert.Equal(t, "10", e.Id)
+	assert.Equal(t, int64(3), e.Connection)
+	assert.Equal(t, "127.0.0.1:50000", e.Detail)
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+// Package filter inspects the first bytes the clients of a tunnel send, before
+// they are forwarded, so a connection carrying something it should not, such
+// as a plain text LDAP bind, can be closed.  Filters are written in Go and
+// registered by name, or are external commands.  A command is run for each
+// inspection, sent a Request as json on stdin, and must write a Response as
+// json to stdout before exiting zero.  A command that fails denies the
+// connection
+package filter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Version is the protocol version sent with each request to a command
+const Version = 1
+
+// Verdict is a filter's decision on a connection
+type Verdict string
+
+const (
+	// Continue forwards the bytes inspected and inspects those that follow
+	Continue Verdict = "continue"
+	// Allow forwards the connection without further inspection
+	Allow Verdict = "allow"
+	// Deny closes the connection without forwarding the bytes inspected
+	Deny Verdict = "deny"
+)
+
+var (
+	ErrUnknownFilter = errors.New("filter unknown")
+	ErrCommand       = errors.New("filter command failed")
+
+	lock      sync.RWMutex
+	factories = make(map[string]Factory)
+)
+
+// Connection describes the connection being inspected
+type Connection struct {
+	Tunnel string `json:"tunnel"`
+	Client string `json:"client"`
+	Target string `json:"target"`
+}
+
+// Filter decides on a connection from the bytes its client has sent so far,
+// the reason being logged and audited when it denies.  Filters are shared by
+// the connections of a tunnel, so must be safe to use concurrently
+type Filter interface {
+	Inspect(conn *Connection, data []byte) (Verdict, string)
+}
+
+// Factory makes a filter with the configuration given for a tunnel
+type Factory func(config map[string]string) (Filter, error)
+
+// Register makes a Go filter available to tunnels by name
+func Register(name string, factory Factory) {
+	lock.Lock()
+	defer lock.Unlock()
+	factories[name] = factory
+}
+
+// New makes the named filter with the configuration
+func New(name string, config map[string]string) (Filter, error) {
+	lock.RLock()
+	factory, ok := factories[name]
+	lock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s. Known filters are %s", ErrUnknownFilter, name, strings.Join(Names(), ", "))
+	}
+	return factory(config)
+}
+
+// Names lists the filters registered
+func Names() []string {
+	lock.RLock()
+	defer lock.RUnlock()
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Request is sent to a filter command, Data being base64 in the json
+type Request struct {
+	Version int               `json:"version"`
+	Conn    *Connection       `json:"connection"`
+	Data    []byte            `json:"data"`
+	Config  map[string]string `json:"config,omitempty"`
+}
+
+// Response is a filter command's verdict, with its reason for denying
+type Response struct {
+	Verdict Verdict `json:"verdict"`
+	Reason  string  `json:"reason,omitempty"`
+}
+
+// Command is a filter run as an external command
+type Command struct {
+	Command string
+	Args    []string
+	Config  map[string]string
+	Timeout time.Duration
+}
+
+func (c *Command) Inspect(conn *Connection, data []byte) (Verdict, string) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+	defer cancel()
+	resp, err := c.run(ctx, &Request{Version: Version, Conn: conn, Data: data, Config: c.Config})
+	if err != nil {
+		return Deny, err.Error()
+	}
+	return resp.Verdict, resp.Reason
+}
+
+func (c *Command) run(ctx context.Context, req *Request) (*Response, error) {
+	in, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.Command, c.Args...)
+	cmd.Stdin = bytes.NewReader(in)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err = cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s: %v: %s", ErrCommand, c.Command, err, msg)
+		}
+		return nil, fmt.Errorf("%w: %s: %v", ErrCommand, c.Command, err)
+	}
+	resp := &Response{}
+	if err = json.Unmarshal(stdout.Bytes(), resp); err != nil {
+		return nil, fmt.Errorf("%w: %s: response cannot be decoded: %v", ErrCommand, c.Command, err)
+	}
+	switch resp.Verdict {
+	case Continue, Allow, Deny:
+		return resp, nil
+	default:
+		return nil, fmt.Errorf("%w: %s: verdict (%s) unknown", ErrCommand, c.Command, resp.Verdict)
+	}
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package filter
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ber lays out an element with a short form length
+func ber(tag byte, content ...[]byte) []byte {
+	var bs []byte
+	for _, c := range content {
+		bs = append(bs, c...)
+	}
+	return append([]byte{tag, byte(len(bs))}, bs...)
+}
+
+func bind(password string) []byte {
+	return ber(berSequence,
+		ber(berInteger, []byte{1}),
+		ber(ldapBindRequest, ber(berInteger, []byte{3}), ber(0x04, []byte("cn=admin")), ber(ldapSimpleAuth, []byte(password))),
+	)
+}
+
+func TestLDAPPlaintextBind(t *testing.T) {
+	f, err := New("ldap-plaintext-bind", nil)
+	require.NoError(t, err)
+	startTLS := ber(berSequence, ber(berInteger, []byte{1}), ber(ldapExtendedReq, ber(ldapRequestName, []byte(ldapStartTLSName))))
+	search := ber(berSequence, ber(berInteger, []byte{1}), ber(0x63, ber(0x04, []byte("dc=example"))))
+
+	tests := map[string]struct {
+		data    []byte
+		verdict Verdict
+	}{
+		"simple bind":         {data: bind("secret"), verdict: Deny},
+		"bind after search":   {data: append(search, bind("secret")...), verdict: Deny},
+		"anonymous bind":      {data: bind(""), verdict: Continue},
+		"partial bind":        {data: bind("secret")[:10], verdict: Continue},
+		"start tls":           {data: startTLS, verdict: Allow},
+		"tls":                 {data: []byte{0x16, 0x03, 0x01, 0x00, 0x10}, verdict: Allow},
+		"search then waiting": {data: search, verdict: Continue},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			verdict, _ := f.Inspect(&Connection{}, test.data)
+			assert.Equal(tt, test.verdict, verdict)
+		})
+	}
+}
+
+func TestNewUnknown(t *testing.T) {
+	_, err := New("nonesuch", nil)
+	assert.True(t, errors.Is(err, ErrUnknownFilter))
+	assert.Contains(t, Names(), "ldap-plaintext-bind")
+}
+
+func TestCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("filter scripts need a posix shell")
+	}
+	command := func(script string) *Command {
+		return &Command{Command: "/bin/sh", Args: []string{"-c", script}, Timeout: 5 * time.Second}
+	}
+	// "aGVsbG8=" is hello in base64
+	verdict, _ := command(`grep -q '"data":"aGVsbG8="' && echo '{"verdict":"allow"}'`).Inspect(&Connection{Tunnel: "t"}, []byte("hello"))
+	assert.Equal(t, Allow, verdict)
+
+	verdict, reason := command(`cat >/dev/null; echo '{"verdict":"deny","reason":"no thanks"}'`).Inspect(&Connection{}, nil)
+	assert.Equal(t, Deny, verdict)
+	assert.Equal(t, "no thanks", reason)
+
+	verdict, reason = command(`cat >/dev/null; echo '{"verdict":"maybe"}'`).Inspect(&Connection{}, nil)
+	assert.Equal(t, Deny, verdict)
+	assert.Contains(t, reason, "unknown")
+
+	verdict, reason = command(`echo broken >&2; exit 1`).Inspect(&Connection{}, nil)
+	assert.Equal(t, Deny, verdict)
+	assert.Contains(t, reason, "broken")
+}
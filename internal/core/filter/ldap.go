@@ -0,0 +1,102 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package filter
+
+import "bytes"
+
+const (
+	berSequence      = 0x30
+	berInteger       = 0x02
+	ldapBindRequest  = 0x60
+	ldapExtendedReq  = 0x77
+	ldapSimpleAuth   = 0x80
+	ldapRequestName  = 0x80
+	ldapStartTLSName = "1.3.6.1.4.1.1466.20037"
+)
+
+func init() {
+	Register("ldap-plaintext-bind", func(map[string]string) (Filter, error) {
+		return ldapPlaintextBind{}, nil
+	})
+}
+
+// ldapPlaintextBind denies LDAP simple binds with a password sent in plain
+// text, allowing connections that start tls first or are not LDAP at all
+type ldapPlaintextBind struct{}
+
+func (ldapPlaintextBind) Inspect(_ *Connection, data []byte) (Verdict, string) {
+	for len(data) > 0 {
+		if data[0] != berSequence {
+			// Not LDAP, or tls as for ldaps
+			return Allow, ""
+		}
+		message, rest, ok := berElement(data)
+		if !ok {
+			return Continue, ""
+		}
+		data = rest
+		// The message id precedes the operation
+		_, op, ok := berElement(message)
+		if !ok || len(message) == 0 || message[0] != berInteger || len(op) == 0 {
+			return Allow, ""
+		}
+		switch op[0] {
+		case ldapBindRequest:
+			if ldapSimplePassword(op) {
+				return Deny, "ldap simple bind in plain text"
+			}
+		case ldapExtendedReq:
+			if content, _, ok := berElement(op); ok && len(content) > 0 && content[0] == ldapRequestName {
+				if name, _, ok := berElement(content); ok && bytes.Equal(name, []byte(ldapStartTLSName)) {
+					return Allow, ""
+				}
+			}
+		}
+	}
+	return Continue, ""
+}
+
+// ldapSimplePassword reports whether a bind request carries a simple password
+func ldapSimplePassword(op []byte) bool {
+	content, _, ok := berElement(op)
+	if !ok {
+		return false
+	}
+	// version, then name, then the authentication choice
+	for range 2 {
+		if _, content, ok = berElement(content); !ok {
+			return false
+		}
+	}
+	if len(content) == 0 || content[0] != ldapSimpleAuth {
+		return false
+	}
+	password, _, ok := berElement(content)
+	return ok && len(password) > 0
+}
+
+// berElement splits the content of the ber element data starts with from the
+// data that follows it
+func berElement(data []byte) ([]byte, []byte, bool) {
+	if len(data) < 2 {
+		return nil, nil, false
+	}
+	length, header := int(data[1]), 2
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 4 || len(data) < 2+n {
+			return nil, nil, false
+		}
+		length = 0
+		for _, b := range data[2 : 2+n] {
+			length = length<<8 | int(b)
+		}
+		header += n
+	}
+	if len(data) < header+length {
+		return nil, nil, false
+	}
+	return data[header : header+length], data[header+length:], true
+}
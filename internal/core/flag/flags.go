@@ -24,7 +24,8 @@ func Curl(cmd *cobra.Command) {
 }
 
 func Config(cmd *cobra.Command) {
-	cmd.Flags().StringVarP(&config.FileName, "config", "c", "", "optional configuration file")
+	cmd.Flags().StringVarP(&config.FileName, "config", "c", "", "optional configuration file, https url or s3://bucket/key")
+	cmd.Flags().StringVar(&config.AgeIdentityFile, "age-identity", "", "age identity used to decrypt an encrypted configuration file")
 }
 
 func Prompt(cmd *cobra.Command) {
@@ -39,6 +40,77 @@ func Verbose(cmd *cobra.Command) {
 	cmd.Flags().BoolVarP(&config.VerboseFlag, "verbose", "v", false, "displays supplemental information")
 }
 
+func Json(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&config.JsonFlag, "json", false, "prints the response as json")
+}
+
+func Wide(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&config.WideFlag, "wide", false, "prints additional columns")
+}
+
+func Connections(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&config.ConnectionsFlag, "connections", false, "lists each tunnel's active client connections")
+}
+
+func Bind(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&config.BindFlag, "bind", "", "overrides where every tunnel listens: loopback, all, an ip address or an interface")
+}
+
+func Takeover(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&config.TakeoverFlag, "takeover", false, "stops a previous auto-ssh instance holding a port this instance needs")
+}
+
+func Upgrade(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&config.UpgradeFlag, "upgrade", false, "takes the listening sockets over from a running auto-ssh with the same configuration, which drains and exits")
+}
+
+func FailFast(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&config.FailFastFlag, "fail-fast", false, "exits with an error should any tunnel fail to start, as if every tunnel set require")
+}
+
+func Ready(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&config.ReadyFileFlag, "ready-file", "", "file written with the process id once every tunnel is listening and connected, and removed on exit")
+	cmd.Flags().IntVar(&config.ReadyFdFlag, "ready-fd", 0, "file descriptor written to and closed once every tunnel is listening and connected")
+}
+
+func EnvFile(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&config.EnvFileFlag, "env-file", "", "dotenv file written with each tunnel's entrance once the tunnels are ready, and removed on exit")
+}
+
+func PKCS11(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&config.PKCS11Flag, "pkcs11", "", "PKCS#11 provider library whose smart card keys every host may authenticate with")
+}
+
+func Poll(cmd *cobra.Command) {
+	cmd.Flags().DurationVar(&config.PollFlag, "poll", config.DefaultPollInterval, "how often a remote configuration is checked for changes")
+}
+
+func Redact(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&config.RedactFlag, "redact", false, "replaces usernames, identity file paths and host names in logs with stable hashes")
+}
+
+func Console(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&config.NoColorFlag, "no-color", false, "disables colored output, as does NO_COLOR or output that is not a terminal")
+	cmd.Flags().BoolVar(&config.TimestampsFlag, "timestamps", false, "starts each message with the time")
+}
+
+func Quiet(cmd *cobra.Command) {
+	cmd.Flags().BoolVarP(&config.QuietFlag, "quiet", "q", false, "prints errors only")
+}
+
+func Output(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&config.OutputFlag, "output", config.OutputText, "output format: text, or json for an object per line with the startup and shutdown events")
+}
+
+func Perms(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&config.StrictPermsFlag, "strict-perms", false, "refuses identity, config and known_hosts files others can read or write, as ssh does")
+	cmd.Flags().BoolVar(&config.FixPermsFlag, "fix-perms", false, "removes the permissions others have on identity, config and known_hosts files")
+}
+
+func FIPS(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&config.FIPSFlag, "fips", false, "restricts hosts to fips approved algorithms, refusing password authentication and unknown host keys")
+}
+
 // Rest adds: curl, raw raw
 func Rest(cmd *cobra.Command) {
 	Curl(cmd)
@@ -51,9 +123,13 @@ func Default(cmd *cobra.Command) {
 	Rest(cmd)
 }
 
-// Core adds: Config Verbose Prompt
+// Core adds: Config Verbose Prompt Redact Console Perms FIPS
 func Core(cmd *cobra.Command) {
 	Config(cmd)
 	Verbose(cmd)
 	Prompt(cmd)
+	Redact(cmd)
+	Console(cmd)
+	Perms(cmd)
+	FIPS(cmd)
 }
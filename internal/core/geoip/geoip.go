@@ -0,0 +1,143 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+// Package geoip looks client addresses up in the MaxMind DB files configured,
+// for the country they are in and the autonomous system announcing them.  A
+// database is read again once its file changes, as geoipupdate replaces it
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/log"
+	"us.figge.auto-ssh/internal/core/mmdb"
+)
+
+// checkInterval is how often a database file is checked for a newer one
+const checkInterval = time.Minute
+
+type database struct {
+	lock    sync.Mutex
+	file    string
+	reader  *mmdb.Reader
+	modTime time.Time
+	checked time.Time
+}
+
+var (
+	countries = &database{}
+	asns      = &database{}
+)
+
+// Open reads the country and ASN databases.  An empty filename leaves that
+// database out, nothing then being found in it
+func Open(country string, asn string) error {
+	if err := countries.open(country); err != nil {
+		return err
+	}
+	return asns.open(asn)
+}
+
+func (d *database) open(file string) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.file, d.reader = file, nil
+	if file == "" {
+		return nil
+	}
+	return d.load(time.Now())
+}
+
+func (d *database) load(now time.Time) error {
+	info, err := os.Stat(d.file)
+	if err != nil {
+		return fmt.Errorf("geoip database (%s) cannot be read: %w", d.file, err)
+	}
+	reader, err := mmdb.Open(d.file)
+	if err != nil {
+		return fmt.Errorf("geoip database (%s) cannot be read: %w", d.file, err)
+	}
+	d.reader, d.modTime, d.checked = reader, info.ModTime(), now
+	log.Printf("  Info  - geoip database (%s) loaded: %s\n", d.file, reader.DatabaseType)
+	return nil
+}
+
+// HasCountry reports whether a country database is configured
+func HasCountry() bool {
+	return countries.configured()
+}
+
+// HasASN reports whether an ASN database is configured
+func HasASN() bool {
+	return asns.configured()
+}
+
+func (d *database) configured() bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.file != ""
+}
+
+// Country is the ISO code of the country the address is in, falling back to
+// that of the country its network is registered to, or blank when not known
+func Country(ip net.IP) string {
+	record := countries.lookup(ip)
+	for _, keys := range [][]string{{"country", "iso_code"}, {"registered_country", "iso_code"}} {
+		if iso, ok := mmdb.Path(record, keys...); ok {
+			if s, ok := iso.(string); ok && s != "" {
+				return strings.ToUpper(s)
+			}
+		}
+	}
+	return ""
+}
+
+// ASN is the number of the autonomous system announcing the address, or zero
+// when not known
+func ASN(ip net.IP) uint {
+	if number, ok := mmdb.Path(asns.lookup(ip), "autonomous_system_number"); ok {
+		if n, ok := number.(uint64); ok {
+			return uint(n)
+		}
+	}
+	return 0
+}
+
+func (d *database) lookup(ip net.IP) interface{} {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.file == "" || ip == nil {
+		return nil
+	}
+	d.refresh(time.Now())
+	if d.reader == nil {
+		return nil
+	}
+	record, _, err := d.reader.Lookup(ip)
+	if err != nil {
+		log.Printf("  Warn  - geoip database (%s) lookup of %v failed: %v\n", d.file, ip, err)
+	}
+	return record
+}
+
+// refresh reads the database again should its file have changed, carrying on
+// with the one already read should the new one be unreadable
+func (d *database) refresh(now time.Time) {
+	if now.Sub(d.checked) < checkInterval {
+		return
+	}
+	d.checked = now
+	info, err := os.Stat(d.file)
+	if err != nil || info.ModTime().Equal(d.modTime) {
+		return
+	}
+	if err = d.load(now); err != nil {
+		log.Printf("  Warn  - %v. Keeping the database already loaded\n", err)
+	}
+}
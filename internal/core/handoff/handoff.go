@@ -0,0 +1,61 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+// Package handoff passes the listening sockets of a running auto-ssh to a newer
+// one started with --upgrade, over a unix socket only their user can reach and
+// whose other end each checks is run by that user, so clients are never refused
+// while the binary is replaced.  The running instance drains once the newer one
+// reports its tunnels ready
+package handoff
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+)
+
+const (
+	requestUpgrade = "upgrade"
+	replyReady     = "ready"
+	// maxSockets stays within the descriptors one message may carry
+	maxSockets = 250
+)
+
+// Socket is a listening socket named for the instance taking it over: the web
+// server's "web", or a tunnel entrance's address
+type Socket struct {
+	Name     string
+	Listener net.Listener
+}
+
+// Received is a socket taken over from the running instance
+type Received struct {
+	Name string
+	File *os.File
+}
+
+// offer is the message naming the sockets whose descriptors accompany it
+type offer struct {
+	Pid   int      `json:"pid"`
+	Names []string `json:"names"`
+}
+
+// Path is the unix socket an instance running the configuration hands off on,
+// in the user's runtime directory or, without one, a directory of their own
+// in the temporary directory
+func Path(configuration string) string {
+	if abs, err := filepath.Abs(configuration); err == nil && configuration != "" {
+		if _, err = os.Stat(abs); err == nil {
+			configuration = abs
+		}
+	}
+	sum := sha256.Sum256([]byte(configuration))
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), fmt.Sprintf("auto-ssh-%d", os.Getuid()))
+	}
+	return filepath.Join(dir, fmt.Sprintf("auto-ssh-%x.sock", sum[:6]))
+}
@@ -0,0 +1,32 @@
+//go:build !unix
+
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package handoff
+
+import (
+	"context"
+	"fmt"
+)
+
+// Serve is not supported without unix sockets able to pass descriptors
+func Serve(ctx context.Context, path string, offered func() []Socket, takenOver func()) error {
+	return fmt.Errorf("upgrades are not supported on this platform")
+}
+
+// Upgrade is the running instance's side of a handoff to this one
+type Upgrade struct {
+	Pid     int
+	Sockets []Received
+}
+
+// Receive is not supported without unix sockets able to pass descriptors
+func Receive(path string) (*Upgrade, error) {
+	return nil, fmt.Errorf("upgrades are not supported on this platform")
+}
+
+func (u *Upgrade) Ready() error {
+	return nil
+}
@@ -0,0 +1,276 @@
+//go:build unix
+
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package handoff
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"us.figge.auto-ssh/internal/core/log"
+)
+
+const requestTimeout = 10 * time.Second
+
+// Serve listens on path for a newer instance asking to take over, handing it
+// the sockets offered at that moment.  Once it reports its tunnels ready,
+// takenOver is called and no further upgrades are served.  Should the newer
+// instance go away before then, this one carries on as before
+func Serve(ctx context.Context, path string, offered func() []Socket, takenOver func()) error {
+	ln, err := listen(path)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		_ = ln.Close()
+	}()
+	go func() {
+		for {
+			conn, err := ln.AcceptUnix()
+			if err != nil {
+				_ = os.Remove(path)
+				return
+			}
+			if err = checkPeer(conn); err != nil {
+				log.Printf("  Warn  - upgrade refused: %v\n", err)
+				_ = conn.Close()
+				continue
+			}
+			if serve(conn, offered) {
+				// Left for the upgraded instance to replace with its own
+				_ = ln.Close()
+				takenOver()
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// listen opens the unix socket, replacing one left behind by an instance that
+// has gone, but not one still being served
+func listen(path string) (*net.UnixListener, error) {
+	dir := filepath.Dir(path)
+	if err := os.Mkdir(dir, 0700); err != nil && !errors.Is(err, os.ErrExist) {
+		return nil, err
+	}
+	if err := checkDir(dir); err != nil {
+		return nil, err
+	}
+	addr := &net.UnixAddr{Name: path, Net: "unix"}
+	ln, err := net.ListenUnix("unix", addr)
+	if err != nil && errors.Is(err, syscall.EADDRINUSE) {
+		if conn, dialErr := net.Dial("unix", path); dialErr == nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("another auto-ssh is serving upgrades on %s", path)
+		}
+		_ = os.Remove(path)
+		ln, err = net.ListenUnix("unix", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	ln.SetUnlinkOnClose(false)
+	if err = os.Chmod(path, 0600); err != nil {
+		_ = ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// checkDir makes sure the directory holding the socket is the user's own and
+// closed to others, so no one else can put a socket in its place
+func checkDir(dir string) error {
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !info.IsDir() || !ok || int(stat.Uid) != os.Getuid() || info.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("%s is not a directory only this user can reach", dir)
+	}
+	return nil
+}
+
+// checkPeer makes sure the other end of the connection is run by this user
+func checkPeer(conn *net.UnixConn) error {
+	uid, err := peerUid(conn)
+	if err != nil {
+		return fmt.Errorf("peer cannot be identified: %w", err)
+	}
+	if uid != os.Getuid() {
+		return fmt.Errorf("peer is run by user %d", uid)
+	}
+	return nil
+}
+
+// serve hands the offered sockets to the instance on the connection, reporting
+// whether it went on to take over
+func serve(conn *net.UnixConn, offered func() []Socket) bool {
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetReadDeadline(time.Now().Add(requestTimeout))
+	reader := bufio.NewReader(conn)
+	if request, err := reader.ReadString('\n'); err != nil || strings.TrimSpace(request) != requestUpgrade {
+		return false
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+
+	o := offer{Pid: os.Getpid()}
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+	for _, s := range offered() {
+		filer, ok := s.Listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			log.Printf("  Warn  - socket (%s) cannot be handed over\n", s.Name)
+			continue
+		}
+		f, err := filer.File()
+		if err != nil {
+			log.Printf("  Warn  - socket (%s) cannot be handed over: %v\n", s.Name, err)
+			continue
+		}
+		if len(files) == maxSockets {
+			_ = f.Close()
+			log.Printf("  Warn  - socket (%s) cannot be handed over: more than %d sockets\n", s.Name, maxSockets)
+			continue
+		}
+		o.Names = append(o.Names, s.Name)
+		files = append(files, f)
+	}
+	header, err := json.Marshal(o)
+	if err != nil {
+		return false
+	}
+	fds := make([]int, len(files))
+	for i, f := range files {
+		fds[i] = int(f.Fd())
+	}
+	var rights []byte
+	if len(fds) > 0 {
+		rights = unix.UnixRights(fds...)
+	}
+	if _, _, err = conn.WriteMsgUnix(append(header, '\n'), rights, nil); err != nil {
+		log.Printf("  Warn  - sockets cannot be handed over: %v\n", err)
+		return false
+	}
+	log.Printf("  Info  - %d sockets handed to an upgrading auto-ssh. Waiting for its tunnels\n", len(files))
+
+	reply, err := reader.ReadString('\n')
+	if err != nil || strings.TrimSpace(reply) != replyReady {
+		log.Printf("  Warn  - upgrading auto-ssh went away before its tunnels were ready. Carrying on\n")
+		return false
+	}
+	return true
+}
+
+// Upgrade is the running instance's side of a handoff to this one
+type Upgrade struct {
+	conn    *net.UnixConn
+	Pid     int
+	Sockets []Received
+}
+
+// Receive asks the instance serving on path for its sockets
+func Receive(path string) (*Upgrade, error) {
+	if err := checkDir(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	conn, err := net.DialUnix("unix", nil, &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, fmt.Errorf("no running auto-ssh to upgrade: %w", err)
+	}
+	if err = checkPeer(conn); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("running auto-ssh refused: %w", err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(requestTimeout))
+	if _, err = conn.Write([]byte(requestUpgrade + "\n")); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	buf := make([]byte, 64*1024)
+	oob := make([]byte, unix.CmsgSpace(maxSockets*4))
+	n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("sockets not received: %w", err)
+	}
+	files, err := parseRights(oob[:oobn])
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	header := buf[:n]
+	for len(header) == 0 || header[len(header)-1] != '\n' {
+		// The rest of a long list of names
+		m, err := conn.Read(buf)
+		if err != nil {
+			closeAll(files)
+			_ = conn.Close()
+			return nil, fmt.Errorf("sockets not received: %w", err)
+		}
+		header = append(header, buf[:m]...)
+	}
+	var o offer
+	if err = json.Unmarshal(header, &o); err != nil || len(o.Names) != len(files) {
+		closeAll(files)
+		_ = conn.Close()
+		return nil, fmt.Errorf("sockets received do not match their names")
+	}
+	_ = conn.SetDeadline(time.Time{})
+	u := &Upgrade{conn: conn, Pid: o.Pid}
+	for i, f := range files {
+		u.Sockets = append(u.Sockets, Received{Name: o.Names[i], File: f})
+	}
+	return u, nil
+}
+
+func parseRights(oob []byte) ([]*os.File, error) {
+	messages, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil, fmt.Errorf("sockets not received: %w", err)
+	}
+	var files []*os.File
+	for _, m := range messages {
+		fds, err := unix.ParseUnixRights(&m)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			files = append(files, os.NewFile(uintptr(fd), "handoff"))
+		}
+	}
+	return files, nil
+}
+
+func closeAll(files []*os.File) {
+	for _, f := range files {
+		_ = f.Close()
+	}
+}
+
+// Ready tells the running instance this one's tunnels are ready, for it to
+// drain and exit
+func (u *Upgrade) Ready() error {
+	defer func() { _ = u.conn.Close() }()
+	_, err := u.conn.Write([]byte(replyReady + "\n"))
+	return err
+}
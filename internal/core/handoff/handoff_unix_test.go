@@ -0,0 +1,119 @@
+//go:build unix
+
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package handoff
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// privateDir is a temporary directory only this user can reach
+func privateDir(t *testing.T) string {
+	dir := t.TempDir()
+	require.NoError(t, os.Chmod(dir, 0700))
+	return dir
+}
+
+func TestHandoff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	path := filepath.Join(privateDir(t), "handoff.sock")
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = ln.Close() }()
+	takenOver := make(chan struct{})
+	offered := func() []Socket { return []Socket{{Name: "web", Listener: ln}} }
+	require.NoError(t, Serve(ctx, path, offered, func() { close(takenOver) }))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// Abandoned before its tunnels were ready, so the running instance carries on
+	abandoned, err := Receive(path)
+	require.NoError(t, err)
+	closeAll([]*os.File{abandoned.Sockets[0].File})
+	_ = abandoned.conn.Close()
+
+	u, err := Receive(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.Getpid(), u.Pid)
+	require.Len(t, u.Sockets, 1)
+	assert.Equal(t, "web", u.Sockets[0].Name)
+	received, err := net.FileListener(u.Sockets[0].File)
+	require.NoError(t, err)
+	defer func() { _ = received.Close() }()
+	assert.Equal(t, ln.Addr().String(), received.Addr().String())
+	select {
+	case <-takenOver:
+		t.Fatal("taken over before ready")
+	default:
+	}
+
+	require.NoError(t, u.Ready())
+	select {
+	case <-takenOver:
+	case <-time.After(5 * time.Second):
+		t.Fatal("not taken over once ready")
+	}
+	_, err = Receive(path)
+	assert.Error(t, err)
+}
+
+func TestServeRefusesSecondInstance(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	path := filepath.Join(privateDir(t), "handoff.sock")
+	none := func() []Socket { return nil }
+	require.NoError(t, Serve(ctx, path, none, func() {}))
+	assert.Error(t, Serve(ctx, path, none, func() {}))
+}
+
+func TestServeReplacesStaleSocket(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	path := filepath.Join(privateDir(t), "handoff.sock")
+	require.NoError(t, os.WriteFile(path, nil, 0600))
+	assert.NoError(t, Serve(ctx, path, func() []Socket { return nil }, func() {}))
+}
+
+func TestServeRefusesSharedDirectory(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir := t.TempDir()
+	require.NoError(t, os.Chmod(dir, 0777))
+	err := Serve(ctx, filepath.Join(dir, "handoff.sock"), func() []Socket { return nil }, func() {})
+	assert.EqualError(t, err, dir+" is not a directory only this user can reach")
+	_, err = Receive(filepath.Join(dir, "handoff.sock"))
+	assert.Error(t, err)
+}
+
+func TestServeCreatesDirectory(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir := filepath.Join(privateDir(t), "auto-ssh")
+	require.NoError(t, Serve(ctx, filepath.Join(dir, "handoff.sock"), func() []Socket { return nil }, func() {}))
+	info, err := os.Stat(dir)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+}
+
+func TestPath(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", "/run/user/1000")
+	assert.Equal(t, "/run/user/1000", filepath.Dir(Path("ash.yaml")))
+	assert.NotEqual(t, Path("ash.yaml"), Path("other.yaml"))
+	t.Setenv("XDG_RUNTIME_DIR", "")
+	assert.Equal(t, filepath.Join(os.TempDir(), fmt.Sprintf("auto-ssh-%d", os.Getuid())), filepath.Dir(Path("ash.yaml")))
+}
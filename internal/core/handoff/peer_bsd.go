@@ -0,0 +1,32 @@
+//go:build darwin || freebsd
+
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package handoff
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// peerUid is the user running the other end of the connection
+func peerUid(conn *net.UnixConn) (int, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	var cred *unix.Xucred
+	var credErr error
+	if err = raw.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptXucred(int(fd), unix.SOL_LOCAL, unix.LOCAL_PEERCRED)
+	}); err != nil {
+		return 0, err
+	}
+	if credErr != nil {
+		return 0, credErr
+	}
+	return int(cred.Uid), nil
+}
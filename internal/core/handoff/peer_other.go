@@ -0,0 +1,18 @@
+//go:build unix && !linux && !darwin && !freebsd
+
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package handoff
+
+import (
+	"errors"
+	"net"
+)
+
+// peerUid cannot tell who runs the other end of a connection on this platform,
+// so upgrades are refused rather than handing sockets to an unknown process
+func peerUid(conn *net.UnixConn) (int, error) {
+	return 0, errors.New("not supported on this platform")
+}
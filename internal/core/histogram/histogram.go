@@ -0,0 +1,100 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+// Package histogram counts observations into buckets by their upper bounds, as
+// Prometheus does, for the distribution of values rather than just their sum,
+// and estimates of its quantiles
+package histogram
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+var (
+	// DurationBounds bucket connection durations in seconds
+	DurationBounds = []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300, 900, 3600, 14400}
+	// SizeBounds bucket bytes, in powers of four from a kilobyte to a gigabyte
+	SizeBounds = []float64{1 << 10, 1 << 12, 1 << 14, 1 << 16, 1 << 18, 1 << 20, 1 << 22, 1 << 24, 1 << 26, 1 << 28, 1 << 30}
+	// LatencyBounds bucket latencies in seconds
+	LatencyBounds = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+)
+
+type Histogram struct {
+	lock   sync.Mutex
+	bounds []float64
+	// counts holds the observations of each bucket, the last those above every bound
+	counts []uint64
+	sum    float64
+}
+
+// New buckets observations by the ascending upper bounds
+func New(bounds []float64) *Histogram {
+	return &Histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.counts[i]++
+	h.sum += v
+}
+
+// Snapshot is a histogram as of a moment
+type Snapshot struct {
+	Bounds []float64
+	// Cumulative counts the observations up to each bound, the last being
+	// every observation
+	Cumulative []uint64
+	Sum        float64
+}
+
+func (h *Histogram) Snapshot() Snapshot {
+	if h == nil {
+		return Snapshot{}
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	s := Snapshot{Bounds: h.bounds, Cumulative: make([]uint64, len(h.counts)), Sum: h.sum}
+	var total uint64
+	for i, c := range h.counts {
+		total += c
+		s.Cumulative[i] = total
+	}
+	return s
+}
+
+func (s Snapshot) Count() uint64 {
+	if len(s.Cumulative) == 0 {
+		return 0
+	}
+	return s.Cumulative[len(s.Cumulative)-1]
+}
+
+// Quantile estimates the value below which the fraction q of observations
+// fall, interpolating within its bucket as histogram_quantile does.  Those
+// above every bound are reported at the highest bound, and NaN without any
+// observations
+func (s Snapshot) Quantile(q float64) float64 {
+	count := s.Count()
+	if count == 0 || q < 0 || q > 1 {
+		return math.NaN()
+	}
+	rank := q * float64(count)
+	i := sort.Search(len(s.Cumulative), func(i int) bool { return float64(s.Cumulative[i]) >= rank })
+	if i == len(s.Bounds) {
+		return s.Bounds[len(s.Bounds)-1]
+	}
+	lower, below := 0.0, uint64(0)
+	if i > 0 {
+		lower, below = s.Bounds[i-1], s.Cumulative[i-1]
+	}
+	inBucket := s.Cumulative[i] - below
+	if inBucket == 0 {
+		return s.Bounds[i]
+	}
+	return lower + (s.Bounds[i]-lower)*(rank-float64(below))/float64(inBucket)
+}
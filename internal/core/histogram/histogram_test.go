@@ -0,0 +1,60 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package histogram
+
+import (
+	"math"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObserve(t *testing.T) {
+	h := New([]float64{1, 2, 5})
+	for _, v := range []float64{0.5, 1, 1.5, 3, 4, 10} {
+		h.Observe(v)
+	}
+	s := h.Snapshot()
+	assert.Equal(t, []uint64{2, 3, 5, 6}, s.Cumulative, "bounds are inclusive")
+	assert.Equal(t, uint64(6), s.Count())
+	assert.Equal(t, 20.0, s.Sum)
+}
+
+func TestQuantile(t *testing.T) {
+	h := New([]float64{10, 20, 30})
+	for i := 0; i < 100; i++ {
+		h.Observe(15)
+	}
+	s := h.Snapshot()
+	assert.InDelta(t, 15.0, s.Quantile(0.5), 0.001)
+	assert.InDelta(t, 19.9, s.Quantile(0.99), 0.001)
+
+	h.Observe(100)
+	assert.Equal(t, 30.0, h.Snapshot().Quantile(1), "above every bound is reported at the highest")
+	assert.True(t, math.IsNaN(New(DurationBounds).Snapshot().Quantile(0.5)))
+	assert.True(t, math.IsNaN(s.Quantile(2)))
+}
+
+func TestConcurrent(t *testing.T) {
+	h := New(SizeBounds)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				h.Observe(float64(j * 1024))
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, uint64(10000), h.Snapshot().Count())
+}
+
+func TestNilSnapshot(t *testing.T) {
+	var h *Histogram
+	assert.Equal(t, uint64(0), h.Snapshot().Count())
+}
@@ -0,0 +1,174 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+// Package journal keeps the state auto-ssh was put in while running, so that a
+// restart after a crash or reboot resumes it rather than the configuration's
+// defaults.  Every change is written through to the journal file before it is
+// acted on
+package journal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/log"
+)
+
+const (
+	Started = "started"
+	Stopped = "stopped"
+)
+
+// Tunnel is what the journal remembers of a tunnel: whether it was last started
+// or stopped by request, and the port its host assigned to its entrance
+type Tunnel struct {
+	Requested string    `json:"requested,omitempty"`
+	Port      int       `json:"port,omitempty"`
+	Updated   time.Time `json:"updated"`
+}
+
+type store struct {
+	lock    sync.Mutex
+	file    string
+	tunnels map[string]*Tunnel
+}
+
+var (
+	defaultStore = &store{tunnels: make(map[string]*Tunnel)}
+)
+
+// Open loads the journal file.  An empty filename turns the journal off, so
+// nothing is recorded or resumed
+func Open(filename string) error {
+	s := defaultStore
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.file = filename
+	s.tunnels = make(map[string]*Tunnel)
+	if filename == "" {
+		return nil
+	}
+	bs, err := os.ReadFile(filename)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("journal (%s) cannot be read: %w", filename, err)
+	}
+	if len(bs) > 0 {
+		if err = json.Unmarshal(bs, &s.tunnels); err != nil {
+			return fmt.Errorf("journal (%s) cannot be decoded: %w", filename, err)
+		}
+	}
+	return nil
+}
+
+// Request records the tunnel being started or stopped by request
+func Request(tunnelId string, requested string) {
+	s := defaultStore
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.file == "" {
+		return
+	}
+	t := s.tunnel(tunnelId)
+	if t.Requested == requested {
+		return
+	}
+	t.Requested = requested
+	s.save()
+}
+
+// Requested is whether the tunnel was last started or stopped by request, or
+// blank when it never was
+func Requested(tunnelId string) string {
+	s := defaultStore
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if t, ok := s.tunnels[tunnelId]; ok {
+		return t.Requested
+	}
+	return ""
+}
+
+// SetPort records the port the tunnel's host assigned to its entrance
+func SetPort(tunnelId string, port int) {
+	s := defaultStore
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.file == "" {
+		return
+	}
+	t := s.tunnel(tunnelId)
+	if t.Port == port {
+		return
+	}
+	t.Port = port
+	s.save()
+}
+
+// Port is the port last assigned to the tunnel's entrance, or zero
+func Port(tunnelId string) int {
+	s := defaultStore
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if t, ok := s.tunnels[tunnelId]; ok {
+		return t.Port
+	}
+	return 0
+}
+
+// tunnel returns the tunnel's entry, adding it if necessary, and marks it
+// updated.  Must be called holding the lock
+func (s *store) tunnel(tunnelId string) *Tunnel {
+	t, ok := s.tunnels[tunnelId]
+	if !ok {
+		t = &Tunnel{}
+		s.tunnels[tunnelId] = t
+	}
+	t.Updated = time.Now().UTC().Truncate(time.Second)
+	return t
+}
+
+// save replaces the journal file, syncing it and its directory so the change
+// survives a crash.  Must be called holding the lock
+func (s *store) save() {
+	bs, err := json.MarshalIndent(s.tunnels, "", "  ")
+	if err == nil {
+		err = writeFile(s.file, bs)
+	}
+	if err != nil {
+		log.Printf("  Error - journal (%s) cannot be written: %v\n", s.file, err)
+	}
+}
+
+func writeFile(file string, bs []byte) error {
+	dir := filepath.Dir(file)
+	tmp := filepath.Join(dir, "."+filepath.Base(file)+".tmp")
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(bs); err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err = os.Rename(tmp, file); err != nil {
+		return err
+	}
+	if d, err := os.Open(dir); err == nil {
+		// Not every platform can sync a directory, and the rename is done
+		_ = d.Sync()
+		_ = d.Close()
+	}
+	return nil
+}
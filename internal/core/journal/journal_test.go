@@ -0,0 +1,50 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package journal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournalPersisted(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "journal.json")
+
+	assert.NoError(t, Open(filename))
+	assert.Equal(t, "", Requested("one"))
+	Request("one", Started)
+	Request("two", Stopped)
+	SetPort("two", 40123)
+
+	assert.NoError(t, Open(filename))
+	assert.Equal(t, Started, Requested("one"))
+	assert.Equal(t, Stopped, Requested("two"))
+	assert.Equal(t, 0, Port("one"))
+	assert.Equal(t, 40123, Port("two"))
+
+	Request("one", Stopped)
+	assert.NoError(t, Open(filename))
+	assert.Equal(t, Stopped, Requested("one"))
+
+	_, err := os.Stat(filepath.Join(filepath.Dir(filename), ".journal.json.tmp"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestJournalOff(t *testing.T) {
+	assert.NoError(t, Open(""))
+	Request("one", Started)
+	SetPort("one", 40123)
+	assert.Equal(t, "", Requested("one"))
+	assert.Equal(t, 0, Port("one"))
+}
+
+func TestJournalCorrupt(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "journal.json")
+	assert.NoError(t, os.WriteFile(filename, []byte("{"), 0600))
+	assert.Error(t, Open(filename))
+}
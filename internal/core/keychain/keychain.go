@@ -0,0 +1,42 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package keychain
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	service = "auto-ssh"
+
+	KindPassphrase = "passphrase"
+	KindPassword   = "password"
+	KindOTP        = "otp"
+)
+
+var (
+	ErrNotFound = errors.New("secret not found in keychain")
+)
+
+// Account returns the keychain account under which a host's secret is stored
+func Account(hostName string, kind string) string {
+	return fmt.Sprintf("%s/%s", hostName, kind)
+}
+
+// Get retrieves the secret stored for the account
+func Get(account string) (string, error) {
+	return get(account)
+}
+
+// Set stores the secret for the account, replacing any existing secret
+func Set(account string, secret string) error {
+	return set(account, secret)
+}
+
+// Delete removes the secret stored for the account
+func Delete(account string) error {
+	return remove(account)
+}
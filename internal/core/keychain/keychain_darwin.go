@@ -0,0 +1,67 @@
+//go:build darwin
+
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package keychain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// The macOS security tool exits with 44 when an item cannot be found
+const errSecItemNotFound = 44
+
+func get(account string) (string, error) {
+	out, err := exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w").Output()
+	if err != nil {
+		return "", securityError(err)
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+// set gives the secret to security's interactive mode on its stdin, as
+// arguments can be read by anyone through ps.  Interactive mode does not exit
+// with a failing command's status, so anything written to stderr is the error
+func set(account string, secret string) error {
+	if strings.ContainsAny(secret, "\r\n") {
+		return errors.New("keychain secret cannot span lines")
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n",
+		quote(service), quote(account), quote(secret)))
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%w: %s", securityError(err), strings.TrimSpace(stderr.String()))
+	}
+	if msg := strings.TrimSpace(stderr.String()); msg != "" {
+		return errors.New(msg)
+	}
+	return nil
+}
+
+// quote makes s a single argument to a command in security's interactive mode
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func remove(account string) error {
+	if err := exec.Command("security", "delete-generic-password", "-s", service, "-a", account).Run(); err != nil {
+		return securityError(err)
+	}
+	return nil
+}
+
+func securityError(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == errSecItemNotFound {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,46 @@
+//go:build !darwin && !windows
+
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package keychain
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// The Secret Service is reached through secret-tool (libsecret), which exits
+// with 1 and no output when a lookup finds nothing
+
+func get(account string) (string, error) {
+	out, err := exec.Command("secret-tool", "lookup", "service", service, "account", account).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) == 0 {
+			return "", ErrNotFound
+		}
+		return "", err
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+func set(account string, secret string) error {
+	cmd := exec.Command("secret-tool", "store", "--label", fmt.Sprintf("%s %s", service, account),
+		"service", service, "account", account)
+	cmd.Stdin = strings.NewReader(secret)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func remove(account string) error {
+	if _, err := get(account); err != nil {
+		return err
+	}
+	return exec.Command("secret-tool", "clear", "service", service, "account", account).Run()
+}
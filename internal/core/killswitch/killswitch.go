@@ -0,0 +1,105 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package killswitch
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"math/big"
+	"os"
+	"runtime/debug"
+	"sync"
+
+	"us.figge.auto-ssh/internal/core/log"
+)
+
+// ExitCode is the status auto-ssh exits with once the switch is pulled
+const ExitCode = 3
+
+var (
+	lock   sync.Mutex
+	hooks  []func()
+	keys   = map[string]any{}
+	pulled bool
+)
+
+// OnPull registers a func run when the switch is pulled, in the order
+// registered, before key material is wiped
+func OnPull(fn func()) {
+	lock.Lock()
+	defer lock.Unlock()
+	hooks = append(hooks, fn)
+}
+
+// Protect records private key material held in memory, so it can be wiped
+// when the switch is pulled.  The key replaces any protected before for the
+// same owner, as a reloaded identity retires the previous one
+func Protect(owner string, key any) {
+	lock.Lock()
+	defer lock.Unlock()
+	keys[owner] = key
+}
+
+// Pull closes everything auto-ssh has open through the registered funcs,
+// overwrites the private keys it holds and exits.  Only the first pull has
+// any effect.  RSA keys cannot be fully overwritten, as the crypto library
+// keeps its own copy of their values out of reach
+func Pull(reason string) {
+	lock.Lock()
+	if pulled {
+		lock.Unlock()
+		return
+	}
+	pulled = true
+	fns := hooks
+	lock.Unlock()
+
+	log.Printf("  Error - kill switch pulled: %s\n", reason)
+	for _, fn := range fns {
+		fn()
+	}
+	wipe()
+	log.Printf("  Error - kill switch: access cut, exiting\n")
+	log.CloseSinks()
+	os.Exit(ExitCode)
+}
+
+// wipe overwrites every protected key and hands the freed memory back to the
+// operating system.  Only the exported values of an RSA key are overwritten,
+// not the copy held inside its precomputed values
+func wipe() {
+	lock.Lock()
+	defer lock.Unlock()
+	for _, key := range keys {
+		switch k := key.(type) {
+		case ed25519.PrivateKey:
+			clear(k)
+		case *ed25519.PrivateKey:
+			clear(*k)
+		case *rsa.PrivateKey:
+			zero(k.D)
+			for _, p := range k.Primes {
+				zero(p)
+			}
+			zero(k.Precomputed.Dp)
+			zero(k.Precomputed.Dq)
+			zero(k.Precomputed.Qinv)
+		case *ecdsa.PrivateKey:
+			zero(k.D)
+		case []byte:
+			clear(k)
+		}
+	}
+	clear(keys)
+	debug.FreeOSMemory()
+}
+
+func zero(n *big.Int) {
+	if n != nil {
+		clear(n.Bits())
+		n.SetInt64(0)
+	}
+}
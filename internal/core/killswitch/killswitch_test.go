@@ -0,0 +1,50 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package killswitch
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWipe(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	secret := []byte("secret")
+
+	Protect("ed25519", &edKey)
+	Protect("rsa", rsaKey)
+	Protect("ecdsa", ecKey)
+	Protect("secret", secret)
+	wipe()
+
+	assert.Equal(t, make([]byte, ed25519.PrivateKeySize), []byte(edKey))
+	assert.Zero(t, rsaKey.D.Sign())
+	for _, p := range rsaKey.Primes {
+		assert.Zero(t, p.Sign())
+	}
+	assert.Zero(t, ecKey.D.Sign())
+	assert.Equal(t, make([]byte, len(secret)), secret)
+	assert.Empty(t, keys)
+}
+
+func TestProtectReplaces(t *testing.T) {
+	Protect("identity web", []byte("old"))
+	Protect("identity web", []byte("new"))
+	Protect("identity db", []byte("db"))
+	assert.Len(t, keys, 2)
+	assert.Equal(t, []byte("new"), keys["identity web"])
+	clear(keys)
+}
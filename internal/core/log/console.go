@@ -0,0 +1,146 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const (
+	colorReset = "\x1b[0m"
+	colorDim   = "\x1b[2m"
+	// labelWidth aligns the messages of every level in one column
+	labelWidth      = 5
+	timestampLayout = "2006-01-02 15:04:05.000"
+)
+
+var levelColors = map[Level]string{
+	LevelError: "\x1b[31m",
+	LevelWarn:  "\x1b[33m",
+	LevelInfo:  "\x1b[32m",
+	LevelDebug: "\x1b[90m",
+}
+
+// console formats messages written to stdout
+type console struct {
+	color      bool
+	timestamps bool
+	json       bool
+}
+
+// ColorSupported reports whether output to the file may be colored, it being
+// a terminal and NO_COLOR not being set
+func ColorSupported(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// SetColor colors the level of messages written to stdout
+func SetColor(enabled bool) {
+	defaultLM.lock.Lock()
+	defer defaultLM.lock.Unlock()
+	defaultLM.console.color = enabled
+}
+
+// SetTimestamps starts messages written to stdout with the time
+func SetTimestamps(enabled bool) {
+	defaultLM.lock.Lock()
+	defer defaultLM.lock.Unlock()
+	defaultLM.console.timestamps = enabled
+}
+
+// SetJSON writes a json object per line to stdout in place of each message,
+// for tools wrapping auto-ssh to parse, along with the events given to Event
+func SetJSON(enabled bool) {
+	defaultLM.lock.Lock()
+	defer defaultLM.lock.Unlock()
+	defaultLM.console.json = enabled
+}
+
+// Event writes a json object of the event and its fields to stdout when
+// SetJSON is set, and nothing otherwise, the messages logged alongside
+// telling of it in text.  Events are written whatever the stdout level
+func Event(name string, fields map[string]any) {
+	defaultLM.lock.Lock()
+	defer defaultLM.lock.Unlock()
+	if !defaultLM.console.json {
+		return
+	}
+	fmt.Print(defaultLM.console.object(time.Now(), name, fields))
+}
+
+// Format returns a message in the "  Error - " style as it is written to
+// stdout, for output printed directly to line up with the log
+func Format(msg string) string {
+	defaultLM.lock.Lock()
+	defer defaultLM.lock.Unlock()
+	return defaultLM.console.format(time.Now(), msg)
+}
+
+// format labels the message with its level, lining the text of every level
+// up in one column, continuation lines included
+func (c console) format(now time.Time, msg string) string {
+	if c.json {
+		level, text := levelOf(msg)
+		fields := map[string]any{"level": level.String(), "message": text}
+		for key, value := range fieldsOf(text) {
+			fields[key] = value
+		}
+		return c.object(now, "log", fields)
+	}
+	level, text := split(msg)
+	label := strings.ToUpper(level.String())
+	label += strings.Repeat(" ", labelWidth-len(label))
+	prefix, width := "  ", 2+labelWidth+1
+	if c.timestamps {
+		prefix += c.paint(colorDim, now.Format(timestampLayout)) + " "
+		width += len(timestampLayout) + 1
+	}
+	text = strings.ReplaceAll(text, "\n", "\n"+strings.Repeat(" ", width))
+	return prefix + c.paint(levelColors[level], label) + " " + text + "\n"
+}
+
+func (c console) object(now time.Time, event string, fields map[string]any) string {
+	object := map[string]any{"time": now.Format(time.RFC3339Nano), "event": event}
+	for key, value := range fields {
+		if _, ok := object[key]; !ok {
+			object[key] = value
+		}
+	}
+	// Unescaped, so messages read as they would in text
+	var b strings.Builder
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(object); err != nil {
+		b.Reset()
+		_ = encoder.Encode(map[string]any{"time": object["time"], "event": event, "error": err.Error()})
+	}
+	return b.String()
+}
+
+func (c console) paint(color string, s string) string {
+	if !c.color {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// split separates the level of a message from its text, keeping any
+// indentation the text has beyond the prefix
+func split(msg string) (Level, string) {
+	msg = strings.TrimRight(msg, "\n")
+	if level, text, ok := cutLevel(strings.TrimLeft(msg, " ")); ok {
+		return level, strings.TrimPrefix(text, " ")
+	}
+	return LevelInfo, strings.TrimSpace(msg)
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package log
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsoleFormat(t *testing.T) {
+	now := time.Date(2024, 5, 1, 13, 4, 5, 6_000_000, time.UTC)
+	tests := map[string]struct {
+		console  console
+		msg      string
+		expected string
+	}{
+		"error":     {msg: "  Error - tunnel (web) failed\n", expected: "  ERROR tunnel (web) failed\n"},
+		"warn":      {msg: "  Warn  - host (db) slow\n", expected: "  WARN  host (db) slow\n"},
+		"debug":     {msg: "  Debug - received 5 bytes\n", expected: "  DEBUG received 5 bytes\n"},
+		"plain":     {msg: "server is shut down\n", expected: "  INFO  server is shut down\n"},
+		"indented":  {msg: "  Error -   known     ssh-ed25519\n", expected: "  ERROR   known     ssh-ed25519\n"},
+		"multiline": {msg: "  Warn  - first\nsecond\n", expected: "  WARN  first\n        second\n"},
+		"timestamp": {
+			console:  console{timestamps: true},
+			msg:      "  Info  - ready\n",
+			expected: "  2024-05-01 13:04:05.006 INFO  ready\n",
+		},
+		"color": {
+			console:  console{color: true},
+			msg:      "  Error - boom\n",
+			expected: "  \x1b[31mERROR\x1b[0m boom\n",
+		},
+		"json": {
+			console:  console{json: true, color: true},
+			msg:      "  Error - tunnel (web) failed\n",
+			expected: `{"event":"log","level":"error","message":"tunnel (web) failed","time":"2024-05-01T13:04:05.006Z","tunnel":"web"}` + "\n",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			assert.Equal(tt, test.expected, test.console.format(now, test.msg))
+		})
+	}
+}
+
+func TestColorSupported(t *testing.T) {
+	t.Setenv("NO_COLOR", "1")
+	assert.False(t, ColorSupported(nil))
+}
+
+func TestConsoleObject(t *testing.T) {
+	now := time.Date(2024, 5, 1, 13, 4, 5, 0, time.UTC)
+	c := console{json: true}
+	assert.Equal(t, `{"event":"ready","time":"2024-05-01T13:04:05Z","tunnels":2}`+"\n", c.object(now, "ready", map[string]any{"tunnels": 2, "event": "other"}))
+	assert.Equal(t, `{"event":"stopped","time":"2024-05-01T13:04:05Z"}`+"\n", c.object(now, "stopped", nil))
+	assert.Equal(t, `{"event":"log","message":"web -> 0.0.0.0:80","time":"2024-05-01T13:04:05Z"}`+"\n", c.object(now, "log", map[string]any{"message": "web -> 0.0.0.0:80"}))
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	journaldSocket = "/run/systemd/journal/socket"
+)
+
+type journaldSink struct {
+	lock       sync.Mutex
+	identifier string
+	conn       *net.UnixConn
+	addr       *net.UnixAddr
+}
+
+// NewJournaldSink writes messages to systemd-journald using its native
+// protocol, attaching the tunnel and host names as TUNNEL and HOST fields
+func NewJournaldSink(identifier string) (Sink, error) {
+	if identifier == "" {
+		identifier = "auto-ssh"
+	}
+	if _, err := os.Stat(journaldSocket); err != nil {
+		return nil, fmt.Errorf("journald unavailable: %w", err)
+	}
+	addr := &net.UnixAddr{Name: journaldSocket, Net: "unixgram"}
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create journald socket: %w", err)
+	}
+	j := &journaldSink{identifier: identifier, conn: conn, addr: addr}
+	return j, nil
+}
+
+func (j *journaldSink) Write(entry *Entry) error {
+	var buf bytes.Buffer
+	journalField(&buf, "MESSAGE", entry.Message)
+	journalField(&buf, "PRIORITY", fmt.Sprintf("%d", syslogSeverity(entry.Level)))
+	journalField(&buf, "SYSLOG_IDENTIFIER", j.identifier)
+	keys := make([]string, 0, len(entry.Fields))
+	for key := range entry.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		journalField(&buf, strings.ToUpper(key), entry.Fields[key])
+	}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	_, _, err := j.conn.WriteMsgUnix(buf.Bytes(), nil, j.addr)
+	return err
+}
+
+func (j *journaldSink) Close() error {
+	return j.conn.Close()
+}
+
+// journalField appends a field, switching to the length prefixed form when
+// the value spans lines
+func journalField(buf *bytes.Buffer, key string, value string) {
+	if !strings.Contains(value, "\n") {
+		buf.WriteString(key + "=" + value + "\n")
+		return
+	}
+	buf.WriteString(key + "\n")
+	_ = binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value + "\n")
+}
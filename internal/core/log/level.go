@@ -0,0 +1,78 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package log
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Level int
+
+const (
+	LevelError Level = iota
+	LevelWarn
+	LevelInfo
+	LevelDebug
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelError:
+		return "error"
+	case LevelWarn:
+		return "warn"
+	case LevelDebug:
+		return "debug"
+	default:
+		return "info"
+	}
+}
+
+// ParseLevel converts a configured level name.  An empty name selects info
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "error":
+		return LevelError, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "", "info":
+		return LevelInfo, nil
+	case "debug":
+		return LevelDebug, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level: %s", name)
+}
+
+// levelOf derives the level of a message from its "  Error - " style prefix,
+// returning the message with the prefix removed
+func levelOf(msg string) (Level, string) {
+	trimmed := strings.TrimSpace(msg)
+	if level, text, ok := cutLevel(trimmed); ok {
+		return level, strings.TrimSpace(text)
+	}
+	return LevelInfo, trimmed
+}
+
+// cutLevel removes the "Error - " style prefix the message starts with,
+// reporting whether it had one
+func cutLevel(msg string) (Level, string, bool) {
+	for _, prefix := range []struct {
+		name  string
+		level Level
+	}{
+		{"Error", LevelError},
+		{"Warn", LevelWarn},
+		{"Info", LevelInfo},
+		{"Debug", LevelDebug},
+	} {
+		if rest, ok := strings.CutPrefix(msg, prefix.name); ok {
+			if rest, ok = strings.CutPrefix(strings.TrimLeft(rest, " "), "-"); ok {
+				return prefix.level, rest, true
+			}
+		}
+	}
+	return LevelInfo, msg, false
+}
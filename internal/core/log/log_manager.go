@@ -17,12 +17,14 @@ type msgEntry struct {
 }
 
 type LogManager struct {
-	history []*msgEntry
-	lock    sync.Mutex
-	stdChn  chan string
-	ctx     context.Context
-	size    int
-	ttl     time.Duration
+	history  []*msgEntry
+	lock     sync.Mutex
+	ctx      context.Context
+	size     int
+	ttl      time.Duration
+	stdLevel Level
+	sinks    []*sinkEntry
+	console  console
 }
 
 var (
@@ -45,11 +47,11 @@ func LogOptionTTL(ttl time.Duration) LogOption {
 
 func init() {
 	defaultLM = &LogManager{
-		history: make([]*msgEntry, 0),
-		stdChn:  make(chan string, 100),
-		lock:    sync.Mutex{},
-		size:    1000,
-		ttl:     time.Hour * 24,
+		history:  make([]*msgEntry, 0),
+		lock:     sync.Mutex{},
+		size:     1000,
+		ttl:      time.Hour * 24,
+		stdLevel: LevelDebug,
 	}
 }
 
@@ -62,7 +64,6 @@ func InitLogManager(options ...LogOption) {
 func Start(ctx context.Context) {
 	if defaultLM.ctx == nil {
 		defaultLM.ctx = ctx
-		go defaultLM.captureMessages()
 		go defaultLM.sweeper()
 	}
 }
@@ -95,27 +96,18 @@ func (lm *LogManager) expireMessages() {
 	}
 }
 
-func (lm *LogManager) captureMessages() {
-	for {
-		select {
-		case <-lm.ctx.Done():
-			return
-		case msg := <-lm.stdChn:
-			func() {
-				lm.lock.Lock()
-				defer lm.lock.Unlock()
-				lm.history = append(lm.history, &msgEntry{expiration: time.Now().Add(lm.ttl), msg: msg})
-				fmt.Printf(msg)
-				if len(lm.history) > lm.size {
-					lm.history = lm.history[:lm.size]
-				}
-			}()
-		}
-	}
-}
-
+// Printf records the message in the history and writes it to stdout and any
+// configured sinks, with any redacted values replaced.  Sinks are written in
+// the background, dropping messages when one falls too far behind
 func Printf(format string, v ...any) {
-	defaultLM.stdChn <- fmt.Sprintf(format, v...)
+	msg := redact(fmt.Sprintf(format, v...))
+	defaultLM.lock.Lock()
+	defer defaultLM.lock.Unlock()
+	defaultLM.history = append(defaultLM.history, &msgEntry{expiration: time.Now().Add(defaultLM.ttl), msg: msg})
+	if len(defaultLM.history) > defaultLM.size {
+		defaultLM.history = defaultLM.history[len(defaultLM.history)-defaultLM.size:]
+	}
+	defaultLM.dispatch(msg)
 }
 
 func Messages() []string {
@@ -0,0 +1,96 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package log
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	redactLock sync.RWMutex
+	redactions []string
+)
+
+// Redact registers values that are never to appear in messages, each being
+// replaced by Redacted of it.  Values are only replaced where they stand as a
+// whole word, so a username of root leaves rooted alone
+func Redact(values ...string) {
+	redactLock.Lock()
+	defer redactLock.Unlock()
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" || hasRedaction(value) {
+			continue
+		}
+		redactions = append(redactions, value)
+	}
+	// Longest first, so a path is replaced whole before any name within it
+	sort.SliceStable(redactions, func(i, j int) bool { return len(redactions[i]) > len(redactions[j]) })
+}
+
+func hasRedaction(value string) bool {
+	for _, r := range redactions {
+		if r == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Redacted returns the placeholder a redacted value is replaced by.  It is a
+// hash of the value, the same in every run, so messages about the same host
+// can still be correlated without revealing it
+func Redacted(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return "<redacted:" + hex.EncodeToString(sum[:4]) + ">"
+}
+
+// redact replaces the registered values in the message
+func redact(msg string) string {
+	redactLock.RLock()
+	defer redactLock.RUnlock()
+	for _, value := range redactions {
+		msg = replaceWord(msg, value)
+	}
+	return msg
+}
+
+func replaceWord(msg string, value string) string {
+	first, _ := utf8.DecodeRuneInString(value)
+	last, _ := utf8.DecodeLastRuneInString(value)
+	var b strings.Builder
+	for {
+		i := strings.Index(msg, value)
+		if i < 0 {
+			break
+		}
+		end := i + len(value)
+		before, _ := utf8.DecodeLastRuneInString(msg[:i])
+		after, _ := utf8.DecodeRuneInString(msg[end:])
+		if isWord(before) && isWord(first) || isWord(after) && isWord(last) {
+			b.WriteString(msg[:i+1])
+			msg = msg[i+1:]
+			continue
+		}
+		b.WriteString(msg[:i])
+		b.WriteString(Redacted(value))
+		msg = msg[end:]
+	}
+	if b.Len() == 0 {
+		return msg
+	}
+	b.WriteString(msg)
+	return b.String()
+}
+
+func isWord(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
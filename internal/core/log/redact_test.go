@@ -0,0 +1,41 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package log
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedact(t *testing.T) {
+	defer func() { redactions = nil }()
+	Redact("root", "db.example.com", "/home/jason", "/home/jason/.ssh/id_ed25519", "", "root")
+	assert.Len(t, redactions, 4)
+
+	tests := map[string]struct {
+		msg      string
+		expected string
+	}{
+		"username": {msg: "host (db) user root denied", expected: "host (db) user " + Redacted("root") + " denied"},
+		"within":   {msg: "rooted chroot root_ca", expected: "rooted chroot root_ca"},
+		"hostname": {msg: "dial db.example.com:22 failed", expected: "dial " + Redacted("db.example.com") + ":22 failed"},
+		"path":     {msg: "identity file (/home/jason/.ssh/id_ed25519) cannot be read", expected: "identity file (" + Redacted("/home/jason/.ssh/id_ed25519") + ") cannot be read"},
+		"prefix":   {msg: "known hosts /home/jason/.ssh/known_hosts", expected: "known hosts " + Redacted("/home/jason") + "/.ssh/known_hosts"},
+		"repeated": {msg: "root@db.example.com root", expected: Redacted("root") + "@" + Redacted("db.example.com") + " " + Redacted("root")},
+		"none":     {msg: "tunnel (web) ready", expected: "tunnel (web) ready"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			assert.Equal(tt, test.expected, redact(test.msg))
+		})
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	assert.Equal(t, Redacted("root"), Redacted("root"))
+	assert.NotEqual(t, Redacted("root"), Redacted("admin"))
+	assert.Regexp(t, `^<redacted:[0-9a-f]{8}>$`, Redacted("root"))
+}
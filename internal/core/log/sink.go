@@ -0,0 +1,149 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package log
+
+import (
+	"fmt"
+	"regexp"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// sinkBuffer is how many messages wait for a sink before more are dropped
+	sinkBuffer = 1024
+	// sinkFlush bounds how long CloseSinks waits for the sinks to catch up
+	sinkFlush = 2 * time.Second
+)
+
+// Entry is a single message as delivered to a sink
+type Entry struct {
+	Time    time.Time
+	Level   Level
+	Message string
+	Fields  map[string]string
+}
+
+// Sink is a log destination in addition to stdout
+type Sink interface {
+	Write(entry *Entry) error
+	Close() error
+}
+
+// sinkEntry feeds a sink from its own goroutine, so a slow or unreachable
+// destination holds up neither the caller nor the other sinks
+type sinkEntry struct {
+	sink    Sink
+	level   Level
+	name    string
+	entries chan *Entry
+	done    chan struct{}
+	dropped atomic.Int64
+}
+
+var (
+	fieldRegex = regexp.MustCompile(`\b(tunnel|host) ?\(([^)]+)\)`)
+)
+
+// fieldsOf extracts the tunnel and host names that messages carry in the form
+// "tunnel (name)" so structured sinks can index them
+func fieldsOf(msg string) map[string]string {
+	fields := map[string]string{}
+	for _, match := range fieldRegex.FindAllStringSubmatch(msg, -1) {
+		if _, ok := fields[match[1]]; !ok {
+			fields[match[1]] = match[2]
+		}
+	}
+	return fields
+}
+
+// SetStdoutLevel restricts the messages written to stdout
+func SetStdoutLevel(level Level) {
+	defaultLM.lock.Lock()
+	defer defaultLM.lock.Unlock()
+	defaultLM.stdLevel = level
+}
+
+// AddSink registers a destination that receives every message at or above
+// the given level
+func AddSink(name string, sink Sink, level Level) {
+	defaultLM.lock.Lock()
+	defer defaultLM.lock.Unlock()
+	s := &sinkEntry{sink: sink, level: level, name: name, entries: make(chan *Entry, sinkBuffer), done: make(chan struct{})}
+	defaultLM.sinks = append(defaultLM.sinks, s)
+	go s.run(defaultLM)
+}
+
+// CloseSinks removes all registered sinks, giving them a moment to write the
+// messages still waiting for them before they are closed.  A sink still
+// writing after that is closed once its write gives up
+func CloseSinks() {
+	defaultLM.lock.Lock()
+	sinks := defaultLM.sinks
+	defaultLM.sinks = nil
+	defaultLM.lock.Unlock()
+
+	deadline := time.After(sinkFlush)
+	for _, s := range sinks {
+		close(s.entries)
+	}
+	for _, s := range sinks {
+		select {
+		case <-s.done:
+			_ = s.sink.Close()
+		case <-deadline:
+			go func() {
+				<-s.done
+				_ = s.sink.Close()
+			}()
+		}
+	}
+}
+
+// run writes the sink's messages until it is closed, reporting when it starts
+// failing and how many messages were dropped while it could not keep up
+func (s *sinkEntry) run(lm *LogManager) {
+	defer close(s.done)
+	failed := false
+	for entry := range s.entries {
+		if n := s.dropped.Swap(0); n > 0 {
+			lm.warn(fmt.Sprintf("  Warn  - log sink (%s) dropped %d messages\n", s.name, n))
+		}
+		err := s.sink.Write(entry)
+		if err != nil && !failed {
+			lm.warn(fmt.Sprintf("  Warn  - log sink (%s) failed: %v\n", s.name, err))
+		}
+		failed = err != nil
+	}
+}
+
+// warn writes a message about the sinks to stdout only, as the sinks may be
+// what is failing
+func (lm *LogManager) warn(msg string) {
+	lm.lock.Lock()
+	defer lm.lock.Unlock()
+	fmt.Print(lm.console.format(time.Now(), msg))
+}
+
+func (lm *LogManager) dispatch(msg string) {
+	level, text := levelOf(msg)
+	if level <= lm.stdLevel {
+		fmt.Print(lm.console.format(time.Now(), msg))
+	}
+	if len(lm.sinks) == 0 {
+		return
+	}
+	entry := &Entry{Time: time.Now(), Level: level, Message: text, Fields: fieldsOf(text)}
+	for _, s := range lm.sinks {
+		if level > s.level {
+			continue
+		}
+		select {
+		case s.entries <- entry:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
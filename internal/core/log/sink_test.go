@@ -0,0 +1,145 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package log
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLevelOf(t *testing.T) {
+	tests := map[string]struct {
+		msg     string
+		level   Level
+		message string
+	}{
+		"error":     {msg: "  Error - tunnel (web) failed\n", level: LevelError, message: "tunnel (web) failed"},
+		"warn":      {msg: "  Warn  - host (db) slow\n", level: LevelWarn, message: "host (db) slow"},
+		"info":      {msg: "  Info  - ready\n", level: LevelInfo, message: "ready"},
+		"plain":     {msg: "server is shut down\n", level: LevelInfo, message: "server is shut down"},
+		"no-dash":   {msg: "Warning: added key\n", level: LevelInfo, message: "Warning: added key"},
+		"no-spaces": {msg: "Error- boom", level: LevelError, message: "boom"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			level, message := levelOf(test.msg)
+			assert.Equal(tt, test.level, level)
+			assert.Equal(tt, test.message, message)
+		})
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for name, expected := range map[string]Level{"": LevelInfo, "ERROR": LevelError, "warning": LevelWarn, "debug": LevelDebug} {
+		level, err := ParseLevel(name)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, level)
+	}
+	_, err := ParseLevel("loud")
+	assert.Error(t, err)
+}
+
+func TestFieldsOf(t *testing.T) {
+	assert.Equal(t, map[string]string{"tunnel": "web", "host": "bastion"},
+		fieldsOf("tunnel (web) remote host (bastion) is invalid"))
+	assert.Equal(t, map[string]string{"tunnel": "db"}, fieldsOf("tunnel(db) local address(:5432) cannot be resolved"))
+	assert.Equal(t, map[string]string{}, fieldsOf("server is shut down"))
+}
+
+func TestSyslogSink(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer func() { _ = pc.Close() }()
+
+	sink, err := NewSyslogSink(pc.LocalAddr().String(), "local3", "ash")
+	assert.NoError(t, err)
+	defer func() { _ = sink.Close() }()
+
+	assert.NoError(t, sink.Write(&Entry{
+		Time:    time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Level:   LevelWarn,
+		Message: `tunnel (w"b) stalled`,
+		Fields:  map[string]string{"tunnel": `w"b`},
+	}))
+	buf := make([]byte, 1024)
+	_ = pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	assert.NoError(t, err)
+	hostname, _ := os.Hostname()
+	expected := fmt.Sprintf(`<156>1 2024-05-01T12:00:00Z %s ash %d - [fields@32473 level="warn" tunnel="w\"b"] tunnel (w"b) stalled`,
+		hostname, os.Getpid())
+	assert.Equal(t, expected, string(buf[:n]))
+
+	_, err = NewSyslogSink("127.0.0.1:514", "nowhere", "")
+	assert.Error(t, err)
+	_, err = NewSyslogSink("ftp://127.0.0.1:514", "", "")
+	assert.Error(t, err)
+}
+
+// blockedSink holds every write until released, recording those written
+type blockedSink struct {
+	release chan struct{}
+	lock    sync.Mutex
+	written []string
+	closed  bool
+}
+
+func (b *blockedSink) Write(entry *Entry) error {
+	<-b.release
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.written = append(b.written, entry.Message)
+	return nil
+}
+
+func (b *blockedSink) Close() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.closed = true
+	return nil
+}
+
+func TestSinkDoesNotBlock(t *testing.T) {
+	sink := &blockedSink{release: make(chan struct{})}
+	AddSink("blocked", sink, LevelError)
+	defer CloseSinks()
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < sinkBuffer+10; i++ {
+			Printf("  Error - message %d\n", i)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Printf blocked on a stalled sink")
+	}
+	defaultLM.lock.Lock()
+	s := defaultLM.sinks[len(defaultLM.sinks)-1]
+	defaultLM.lock.Unlock()
+	assert.Positive(t, s.dropped.Load())
+	close(sink.release)
+}
+
+func TestCloseSinksFlushes(t *testing.T) {
+	sink := &blockedSink{release: make(chan struct{})}
+	close(sink.release)
+	AddSink("flushed", sink, LevelError)
+	Printf("  Error - first\n")
+	Printf("  Error - second\n")
+	CloseSinks()
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	assert.Equal(t, []string{"first", "second"}, sink.written)
+	assert.True(t, sink.closed)
+}
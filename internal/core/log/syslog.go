@@ -0,0 +1,190 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package log
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	syslogStructuredId = "fields@32473"
+)
+
+var (
+	syslogFacilities = map[string]int{
+		"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+		"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+		"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+		"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+	}
+	syslogLocalPaths = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+)
+
+type syslogSink struct {
+	lock     sync.Mutex
+	network  string
+	address  string
+	local    bool
+	facility int
+	tag      string
+	hostname string
+	conn     net.Conn
+}
+
+// NewSyslogSink writes messages to syslog.  An empty address selects the local
+// syslog daemon, otherwise the address takes the form [udp|tcp://]host[:port]
+// and messages are formatted per RFC 5424
+func NewSyslogSink(address string, facility string, tag string) (Sink, error) {
+	s := &syslogSink{tag: tag}
+	if s.tag == "" {
+		s.tag = "auto-ssh"
+	}
+	if facility == "" {
+		facility = "daemon"
+	}
+	var ok bool
+	if s.facility, ok = syslogFacilities[strings.ToLower(facility)]; !ok {
+		return nil, fmt.Errorf("unknown syslog facility: %s", facility)
+	}
+	s.hostname, _ = os.Hostname()
+	if s.hostname == "" {
+		s.hostname = "-"
+	}
+
+	if address == "" {
+		s.local = true
+	} else {
+		if !strings.Contains(address, "://") {
+			address = "udp://" + address
+		}
+		u, err := url.Parse(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid syslog address (%s): %w", address, err)
+		}
+		if u.Scheme != "udp" && u.Scheme != "tcp" {
+			return nil, fmt.Errorf("unsupported syslog network: %s", u.Scheme)
+		}
+		s.network = u.Scheme
+		s.address = u.Host
+		if u.Port() == "" {
+			s.address = net.JoinHostPort(u.Hostname(), "514")
+		}
+	}
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *syslogSink) connect() error {
+	if !s.local {
+		conn, err := net.DialTimeout(s.network, s.address, 5*time.Second)
+		if err != nil {
+			return fmt.Errorf("unable to reach syslog at %s: %w", s.address, err)
+		}
+		s.conn = conn
+		return nil
+	}
+	for _, path := range syslogLocalPaths {
+		for _, network := range []string{"unixgram", "unix"} {
+			if conn, err := net.Dial(network, path); err == nil {
+				s.conn = conn
+				return nil
+			}
+		}
+	}
+	return errors.New("local syslog daemon unavailable")
+}
+
+func (s *syslogSink) Write(entry *Entry) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	msg := s.format(entry)
+	if s.conn == nil {
+		if err := s.connect(); err != nil {
+			return err
+		}
+	}
+	_ = s.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	if _, err := s.conn.Write(msg); err != nil {
+		// Reconnect once, stream connections in particular drop when the
+		// collector restarts
+		_ = s.conn.Close()
+		s.conn = nil
+		if err = s.connect(); err != nil {
+			return err
+		}
+		_ = s.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		_, err = s.conn.Write(msg)
+		return err
+	}
+	return nil
+}
+
+func (s *syslogSink) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func (s *syslogSink) format(entry *Entry) []byte {
+	priority := s.facility*8 + syslogSeverity(entry.Level)
+	if s.local {
+		// Local daemons expect the traditional BSD format
+		return []byte(fmt.Sprintf("<%d>%s %s[%d]: %s\n", priority, entry.Time.Format(time.Stamp), s.tag, os.Getpid(), entry.Message))
+	}
+	msg := fmt.Sprintf("<%d>1 %s %s %s %d - %s %s", priority, entry.Time.Format(time.RFC3339Nano), s.hostname, s.tag,
+		os.Getpid(), structuredData(entry), entry.Message)
+	if s.network == "tcp" {
+		// Octet counting framing per RFC 6587
+		return []byte(fmt.Sprintf("%d %s", len(msg), msg))
+	}
+	return []byte(msg)
+}
+
+func syslogSeverity(level Level) int {
+	switch level {
+	case LevelError:
+		return 3
+	case LevelWarn:
+		return 4
+	case LevelDebug:
+		return 7
+	default:
+		return 6
+	}
+}
+
+func structuredData(entry *Entry) string {
+	var sb strings.Builder
+	sb.WriteString("[" + syslogStructuredId + " level=\"" + entry.Level.String() + "\"")
+	keys := make([]string, 0, len(entry.Fields))
+	for key := range entry.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		sb.WriteString(" " + key + "=\"" + sdEscaper.Replace(entry.Fields[key]) + "\"")
+	}
+	sb.WriteString("]")
+	return sb.String()
+}
+
+var (
+	sdEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+)
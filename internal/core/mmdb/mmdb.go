@@ -0,0 +1,328 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+// Package mmdb looks addresses up in MaxMind DB files, such as the GeoLite2
+// country and ASN databases, decoding the record found into maps, slices,
+// strings, numbers and booleans
+package mmdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"os"
+)
+
+// dataSeparator is the run of zeros between the search tree and the data section
+const dataSeparator = 16
+
+var metadataStart = []byte("\xAB\xCD\xEFMaxMind.com")
+
+type Reader struct {
+	buffer     []byte
+	tree       []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint
+	// DatabaseType is the database's own description of its records, such as GeoLite2-Country
+	DatabaseType string
+}
+
+func Open(path string) (*Reader, error) {
+	buffer, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return New(buffer)
+}
+
+func New(buffer []byte) (*Reader, error) {
+	start := bytes.LastIndex(buffer, metadataStart)
+	if start < 0 {
+		return nil, errors.New("not a MaxMind DB: metadata not found")
+	}
+	metadata, _, err := (&decoder{buffer: buffer[start+len(metadataStart):]}).decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("metadata cannot be read: %w", err)
+	}
+	m, ok := metadata.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("metadata is not a map")
+	}
+	r := &Reader{buffer: buffer}
+	r.nodeCount = toUint(m["node_count"])
+	r.recordSize = toUint(m["record_size"])
+	r.ipVersion = toUint(m["ip_version"])
+	r.DatabaseType, _ = m["database_type"].(string)
+	if r.recordSize != 24 && r.recordSize != 28 && r.recordSize != 32 {
+		return nil, fmt.Errorf("record size %d is not supported", r.recordSize)
+	}
+	if r.ipVersion != 4 && r.ipVersion != 6 {
+		return nil, fmt.Errorf("ip version %d is not supported", r.ipVersion)
+	}
+	treeSize := r.nodeCount * r.recordSize / 4
+	if treeSize+dataSeparator > uint(start) {
+		return nil, errors.New("search tree is larger than the file")
+	}
+	r.tree = buffer[:treeSize]
+	r.data = buffer[treeSize+dataSeparator : start]
+	if r.ipVersion == 6 {
+		// IPv4 addresses sit under ::/96
+		node := uint(0)
+		for i := 0; i < 96 && node < r.nodeCount; i++ {
+			node = r.record(node, 0)
+		}
+		r.ipv4Start = node
+	}
+	return r, nil
+}
+
+// Lookup decodes the record for the address, reporting false when the
+// database has none
+func (r *Reader) Lookup(ip net.IP) (interface{}, bool, error) {
+	node := uint(0)
+	bits := ip.To4()
+	if bits != nil {
+		node = r.ipv4Start
+	} else if bits = ip.To16(); bits == nil {
+		return nil, false, fmt.Errorf("%v is not an ip address", ip)
+	} else if r.ipVersion == 4 {
+		return nil, false, nil
+	}
+	for i := 0; i < len(bits)*8 && node < r.nodeCount; i++ {
+		bit := uint(bits[i/8]>>(7-uint(i%8))) & 1
+		node = r.record(node, bit)
+	}
+	switch {
+	case node == r.nodeCount:
+		return nil, false, nil
+	case node < r.nodeCount:
+		return nil, false, errors.New("search tree is corrupt")
+	}
+	offset := node - r.nodeCount - dataSeparator
+	if offset >= uint(len(r.data)) {
+		return nil, false, errors.New("record pointer is past the data section")
+	}
+	value, _, err := (&decoder{buffer: r.data}).decode(offset, 0)
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// record is the left or right record of a node in the search tree
+func (r *Reader) record(node, right uint) uint {
+	switch r.recordSize {
+	case 24:
+		b := r.tree[node*6+right*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		b := r.tree[node*7:]
+		if right == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(r.tree[node*8+right*4:]))
+	}
+}
+
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// maxDepth bounds the nesting decoded, so a corrupt file cannot recurse forever
+const maxDepth = 32
+
+type decoder struct {
+	buffer []byte
+}
+
+// decode returns the value at offset, and the offset following it
+func (d *decoder) decode(offset uint, depth int) (interface{}, uint, error) {
+	if depth > maxDepth {
+		return nil, 0, errors.New("data nested too deeply")
+	}
+	ctrl, err := d.byte(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset++
+	kind := uint(ctrl >> 5)
+	if kind == typePointer {
+		pointer, next, err := d.pointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(pointer, depth+1)
+		return value, next, err
+	}
+	if kind == typeExtended {
+		extended, err := d.byte(offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		kind = 7 + uint(extended)
+		offset++
+	}
+	size := uint(ctrl & 0x1F)
+	if kind != typeBool && size >= 29 {
+		extra := size - 28
+		b, err := d.bytes(offset, extra)
+		if err != nil {
+			return nil, 0, err
+		}
+		offset += extra
+		n := uint(0)
+		for _, c := range b {
+			n = n<<8 | uint(c)
+		}
+		size = [...]uint{29, 285, 65821}[extra-1] + n
+	}
+	switch kind {
+	case typeMap:
+		m := make(map[string]interface{}, min(size, 64))
+		for i := uint(0); i < size; i++ {
+			var key, value interface{}
+			if key, offset, err = d.decode(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			if value, offset, err = d.decode(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, 0, errors.New("map key is not a string")
+			}
+			m[k] = value
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]interface{}, 0, min(size, 64))
+		for i := uint(0); i < size; i++ {
+			var value interface{}
+			if value, offset, err = d.decode(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+		}
+		return a, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	}
+	b, err := d.bytes(offset, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset += size
+	switch kind {
+	case typeString:
+		return string(b), offset, nil
+	case typeBytes:
+		return append([]byte{}, b...), offset, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, errors.New("double is not 8 bytes")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, errors.New("float is not 4 bytes")
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), offset, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, 0, errors.New("unsigned integer is too long")
+		}
+		n := uint64(0)
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		return n, offset, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, errors.New("signed integer is too long")
+		}
+		n := uint32(0)
+		for _, c := range b {
+			n = n<<8 | uint32(c)
+		}
+		return int64(int32(n)), offset, nil
+	case typeUint128:
+		return new(big.Int).SetBytes(b), offset, nil
+	default:
+		return nil, 0, fmt.Errorf("data type %d is not supported", kind)
+	}
+}
+
+func (d *decoder) pointer(ctrl byte, offset uint) (uint, uint, error) {
+	extra := uint(ctrl>>3)&0x3 + 1
+	b, err := d.bytes(offset, extra)
+	if err != nil {
+		return 0, 0, err
+	}
+	n := uint(0)
+	if extra < 4 {
+		n = uint(ctrl & 0x7)
+	}
+	for _, c := range b {
+		n = n<<8 | uint(c)
+	}
+	n += [...]uint{0, 2048, 526336, 0}[extra-1]
+	return n, offset + extra, nil
+}
+
+func (d *decoder) byte(offset uint) (byte, error) {
+	if offset >= uint(len(d.buffer)) {
+		return 0, errors.New("data truncated")
+	}
+	return d.buffer[offset], nil
+}
+
+func (d *decoder) bytes(offset, size uint) ([]byte, error) {
+	if offset+size > uint(len(d.buffer)) || offset+size < offset {
+		return nil, errors.New("data truncated")
+	}
+	return d.buffer[offset : offset+size], nil
+}
+
+func toUint(value interface{}) uint {
+	n, _ := value.(uint64)
+	return uint(n)
+}
+
+// Path follows the keys through nested maps, returning the value at the end
+func Path(value interface{}, keys ...string) (interface{}, bool) {
+	for _, key := range keys {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
@@ -0,0 +1,166 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package mmdb
+
+import (
+	"net"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// encode writes a value in the MaxMind DB data format
+func encode(value interface{}) []byte {
+	header := func(kind, size int) []byte {
+		if kind < 8 {
+			return []byte{byte(kind<<5 | size)}
+		}
+		return []byte{byte(size), byte(kind - 7)}
+	}
+	unsigned := func(kind int, n uint64) []byte {
+		var b []byte
+		for ; n > 0; n >>= 8 {
+			b = append([]byte{byte(n)}, b...)
+		}
+		return append(header(kind, len(b)), b...)
+	}
+	switch v := value.(type) {
+	case string:
+		return append(header(typeString, len(v)), v...)
+	case uint16:
+		return unsigned(typeUint16, uint64(v))
+	case uint32:
+		return unsigned(typeUint32, uint64(v))
+	case []byte:
+		// Already encoded, such as a pointer
+		return v
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		b := header(typeMap, len(v))
+		for _, key := range keys {
+			b = append(b, encode(key)...)
+			b = append(b, encode(v[key])...)
+		}
+		return b
+	}
+	panic("unsupported")
+}
+
+type node struct {
+	children [2]*node
+	data     int
+}
+
+// build writes an IPv6 database of 24 bit records holding each network's record
+func build(networks map[string][]byte, shared []byte) []byte {
+	root := &node{data: -1}
+	data := append([]byte{}, shared...)
+	for cidr, record := range networks {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		ip := network.IP.To16()
+		ones, _ := network.Mask.Size()
+		if ip4 := network.IP.To4(); ip4 != nil {
+			// IPv4 sits under ::/96
+			ip = append(make(net.IP, 12), ip4...)
+			ones += 96
+		}
+		n := root
+		for i := 0; i < ones; i++ {
+			bit := ip[i/8] >> (7 - uint(i%8)) & 1
+			if n.children[bit] == nil {
+				n.children[bit] = &node{data: -1}
+			}
+			n = n.children[bit]
+		}
+		n.data = len(data)
+		data = append(data, record...)
+	}
+	var nodes []*node
+	var number func(n *node)
+	number = func(n *node) {
+		nodes = append(nodes, n)
+		for _, child := range n.children {
+			if child != nil && child.data < 0 {
+				number(child)
+			}
+		}
+	}
+	number(root)
+	index := map[*node]int{}
+	for i, n := range nodes {
+		index[n] = i
+	}
+	var tree []byte
+	for _, n := range nodes {
+		for _, child := range n.children {
+			value := len(nodes)
+			if child != nil && child.data >= 0 {
+				value = len(nodes) + dataSeparator + child.data
+			} else if child != nil {
+				value = index[child]
+			}
+			tree = append(tree, byte(value>>16), byte(value>>8), byte(value))
+		}
+	}
+	buffer := append(tree, make([]byte, dataSeparator)...)
+	buffer = append(buffer, data...)
+	buffer = append(buffer, metadataStart...)
+	return append(buffer, encode(map[string]interface{}{
+		"node_count":    uint32(len(nodes)),
+		"record_size":   uint16(24),
+		"ip_version":    uint16(6),
+		"database_type": "Test-Country",
+	})...)
+}
+
+func TestLookup(t *testing.T) {
+	shared := encode("US")
+	pointer := []byte{typePointer << 5, 0}
+	db := build(map[string][]byte{
+		"192.0.2.0/24":  encode(map[string]interface{}{"country": map[string]interface{}{"iso_code": pointer}}),
+		"2001:db8::/32": encode(map[string]interface{}{"autonomous_system_number": uint32(64500), "country": map[string]interface{}{"iso_code": "NZ"}}),
+	}, shared)
+	r, err := New(db)
+	require.NoError(t, err)
+	assert.Equal(t, "Test-Country", r.DatabaseType)
+
+	record, ok, err := r.Lookup(net.ParseIP("192.0.2.77"))
+	require.NoError(t, err)
+	require.True(t, ok)
+	iso, _ := Path(record, "country", "iso_code")
+	assert.Equal(t, "US", iso)
+
+	record, ok, err = r.Lookup(net.ParseIP("2001:db8::1"))
+	require.NoError(t, err)
+	require.True(t, ok)
+	iso, _ = Path(record, "country", "iso_code")
+	assert.Equal(t, "NZ", iso)
+	asn, _ := Path(record, "autonomous_system_number")
+	assert.Equal(t, uint64(64500), asn)
+
+	_, ok, err = r.Lookup(net.ParseIP("198.51.100.1"))
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	_, ok = Path(record, "city", "names")
+	assert.False(t, ok)
+}
+
+func TestCorrupt(t *testing.T) {
+	_, err := New([]byte("not a database"))
+	assert.Error(t, err)
+
+	db := build(map[string][]byte{"192.0.2.0/24": encode("x")}, nil)
+	_, err = New(db[len(db)-20:])
+	assert.Error(t, err, "tree larger than the file")
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+// Package openmetrics writes metrics in the OpenMetrics text format scraped
+// by Prometheus, or in the older Prometheus text format for scrapers that do
+// not ask for OpenMetrics
+package openmetrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"us.figge.auto-ssh/internal/core/histogram"
+)
+
+const (
+	ContentType     = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+	TextContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+type Kind string
+
+const (
+	Gauge     Kind = "gauge"
+	Counter   Kind = "counter"
+	Histogram Kind = "histogram"
+)
+
+// Accepts reports whether the Accept header of a scrape asks for OpenMetrics
+func Accepts(accept string) bool {
+	return strings.Contains(accept, "application/openmetrics-text")
+}
+
+type Writer struct {
+	w      *bufio.Writer
+	open   bool
+	family string
+	kind   Kind
+}
+
+// NewWriter writes OpenMetrics when open is set, and otherwise the Prometheus
+// text format
+func NewWriter(w io.Writer, open bool) *Writer {
+	return &Writer{w: bufio.NewWriter(w), open: open}
+}
+
+// Label is a name and value distinguishing the samples of a family
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Family begins the metric family, which unit, when given, must end the name
+// of.  Counters are named without their _total suffix
+func (w *Writer) Family(name string, kind Kind, unit string, help string) {
+	w.family, w.kind = name, kind
+	w.line("# TYPE " + name + " " + string(kind))
+	if unit != "" && w.open {
+		w.line("# UNIT " + name + " " + unit)
+	}
+	w.line("# HELP " + name + " " + escape(help, false))
+}
+
+// Sample writes the value of the current family for the labels
+func (w *Writer) Sample(value float64, labels ...Label) {
+	name := w.family
+	if w.kind == Counter {
+		name += "_total"
+	}
+	w.sample(name, labels, value)
+}
+
+// Histogram writes the snapshot as the current family's sample for the labels
+func (w *Writer) Histogram(s histogram.Snapshot, labels ...Label) {
+	le := append(labels[:len(labels):len(labels)], Label{Name: "le"})
+	for i, bound := range s.Bounds {
+		le[len(le)-1].Value = format(bound)
+		w.sample(w.family+"_bucket", le, float64(cumulative(s, i)))
+	}
+	le[len(le)-1].Value = "+Inf"
+	w.sample(w.family+"_bucket", le, float64(s.Count()))
+	w.sample(w.family+"_sum", labels, s.Sum)
+	w.sample(w.family+"_count", labels, float64(s.Count()))
+}
+
+func cumulative(s histogram.Snapshot, i int) uint64 {
+	if i < len(s.Cumulative) {
+		return s.Cumulative[i]
+	}
+	return 0
+}
+
+// Close ends the exposition and flushes what was written
+func (w *Writer) Close() error {
+	if w.open {
+		w.line("# EOF")
+	}
+	return w.w.Flush()
+}
+
+func (w *Writer) sample(name string, labels []Label, value float64) {
+	b := strings.Builder{}
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(l.Name + `="` + escape(l.Value, true) + `"`)
+		}
+		b.WriteByte('}')
+	}
+	b.WriteString(" " + format(value))
+	w.line(b.String())
+}
+
+func (w *Writer) line(s string) {
+	_, _ = w.w.WriteString(s + "\n")
+}
+
+func format(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func escape(s string, quotes bool) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	if quotes {
+		s = strings.ReplaceAll(s, `"`, `\"`)
+	}
+	return s
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package openmetrics
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"us.figge.auto-ssh/internal/core/histogram"
+)
+
+func write(open bool) string {
+	b := &bytes.Buffer{}
+	w := NewWriter(b, open)
+	tunnel := Label{Name: "tunnel", Value: `db "primary"`}
+	w.Family("auto_ssh_tunnel_up", Gauge, "", "Whether the tunnel is started")
+	w.Sample(1, tunnel)
+	w.Family("auto_ssh_tunnel_connections", Counter, "", "Connections closed")
+	w.Sample(3, tunnel)
+	h := histogram.New([]float64{0.5, 1})
+	h.Observe(0.25)
+	h.Observe(2)
+	w.Family("auto_ssh_tunnel_dial_seconds", Histogram, "seconds", "Time to connect")
+	w.Histogram(h.Snapshot(), tunnel)
+	_ = w.Close()
+	return b.String()
+}
+
+func TestOpenMetrics(t *testing.T) {
+	assert.Equal(t, `# TYPE auto_ssh_tunnel_up gauge
+# HELP auto_ssh_tunnel_up Whether the tunnel is started
+auto_ssh_tunnel_up{tunnel="db \"primary\""} 1
+# TYPE auto_ssh_tunnel_connections counter
+# HELP auto_ssh_tunnel_connections Connections closed
+auto_ssh_tunnel_connections_total{tunnel="db \"primary\""} 3
+# TYPE auto_ssh_tunnel_dial_seconds histogram
+# UNIT auto_ssh_tunnel_dial_seconds seconds
+# HELP auto_ssh_tunnel_dial_seconds Time to connect
+auto_ssh_tunnel_dial_seconds_bucket{tunnel="db \"primary\"",le="0.5"} 1
+auto_ssh_tunnel_dial_seconds_bucket{tunnel="db \"primary\"",le="1"} 1
+auto_ssh_tunnel_dial_seconds_bucket{tunnel="db \"primary\"",le="+Inf"} 2
+auto_ssh_tunnel_dial_seconds_sum{tunnel="db \"primary\""} 2.25
+auto_ssh_tunnel_dial_seconds_count{tunnel="db \"primary\""} 2
+# EOF
+`, write(true))
+}
+
+func TestText(t *testing.T) {
+	text := write(false)
+	assert.NotContains(t, text, "# UNIT")
+	assert.NotContains(t, text, "# EOF")
+	require.Contains(t, text, `auto_ssh_tunnel_dial_seconds_bucket{tunnel="db \"primary\"",le="+Inf"} 2`)
+}
+
+func TestAccepts(t *testing.T) {
+	assert.True(t, Accepts("application/openmetrics-text;version=1.0.0,text/plain;version=0.0.4;q=0.5"))
+	assert.False(t, Accepts("text/plain"))
+}
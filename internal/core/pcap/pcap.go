@@ -0,0 +1,266 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+// Package pcap writes the traffic of forwarded connections to a pcap file as
+// tcp streams, so it can be read by Wireshark.  Packets are synthesized from
+// the bytes forwarded, the stream opening with a handshake and closing with a
+// fin from each side
+package pcap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/log"
+)
+
+const (
+	magic      = 0xa1b23c4d // nanosecond timestamps
+	linkRaw    = 101
+	snapLen    = 65535
+	maxPayload = 65000
+
+	tcpFin = 0x01
+	tcpSyn = 0x02
+	tcpPsh = 0x08
+	tcpAck = 0x10
+)
+
+// Writer appends the packets of any number of streams to a pcap file, until
+// the file reaches its size limit or its time is up
+type Writer struct {
+	lock    sync.Mutex
+	name    string
+	file    *os.File
+	w       *bufio.Writer
+	size    int64
+	maxSize int64
+	until   time.Time
+	stopped bool
+}
+
+// Create starts a pcap file for the named tunnel.  A maxSize or until of zero
+// sets no limit
+func Create(filename string, name string, maxSize int64, until time.Time) (*Writer, error) {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("capture file (%s) cannot be created: %w", filename, err)
+	}
+	w := &Writer{name: name, file: f, w: bufio.NewWriter(f), maxSize: maxSize, until: until}
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:], magic)
+	binary.LittleEndian.PutUint16(header[4:], 2)
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], snapLen)
+	binary.LittleEndian.PutUint32(header[20:], linkRaw)
+	if _, err = w.w.Write(header); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("capture file (%s) cannot be written: %w", filename, err)
+	}
+	w.size = int64(len(header))
+	return w, nil
+}
+
+// Close flushes the packets written and closes the file, after which writes
+// are ignored
+func (w *Writer) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.w.Flush()
+	if cerr := w.file.Close(); err == nil {
+		err = cerr
+	}
+	w.file = nil
+	return err
+}
+
+// Stream is one forwarded connection, from the client to the tunnel entrance
+type Stream struct {
+	w      *Writer
+	lock   sync.Mutex
+	client *net.TCPAddr
+	server *net.TCPAddr
+	seq    [2]uint32
+}
+
+// Stream begins the capture of a connection.  Addresses other than tcp ones
+// are captured as 0.0.0.0:0
+func (w *Writer) Stream(client net.Addr, server net.Addr) *Stream {
+	s := &Stream{w: w, client: tcpAddr(client), server: tcpAddr(server)}
+	s.seq[0], s.seq[1] = 1000, 5000
+	s.packet(true, tcpSyn, nil)
+	s.seq[0]++
+	s.packet(false, tcpSyn|tcpAck, nil)
+	s.seq[1]++
+	s.packet(true, tcpAck, nil)
+	return s
+}
+
+// Write captures data sent by the client, or by the server when fromClient is
+// false
+func (s *Stream) Write(data []byte, fromClient bool) {
+	for len(data) > 0 {
+		n := min(len(data), maxPayload)
+		s.packet(fromClient, tcpPsh|tcpAck, data[:n])
+		data = data[n:]
+	}
+}
+
+// Close ends the capture of the connection with a fin from both sides
+func (s *Stream) Close() {
+	s.packet(true, tcpFin|tcpAck, nil)
+	s.packet(false, tcpFin|tcpAck, nil)
+	s.w.flush()
+}
+
+func (w *Writer) flush() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.file != nil {
+		_ = w.w.Flush()
+	}
+}
+
+func (s *Stream) packet(fromClient bool, flags byte, payload []byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	side, src, dst := 0, s.client, s.server
+	if !fromClient {
+		side, src, dst = 1, s.server, s.client
+	}
+	s.w.write(buildPacket(src, dst, s.seq[side], s.seq[1-side], flags, payload))
+	s.seq[side] += uint32(len(payload))
+	if flags&tcpFin != 0 {
+		s.seq[side]++
+	}
+}
+
+func (w *Writer) write(packet []byte) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.file == nil || w.stopped {
+		return
+	}
+	now := time.Now()
+	record := int64(16 + len(packet))
+	switch {
+	case w.maxSize > 0 && w.size+record > w.maxSize:
+		w.stop("its size limit was reached")
+		return
+	case !w.until.IsZero() && now.After(w.until):
+		w.stop("its time was up")
+		return
+	}
+	header := make([]byte, 16)
+	binary.LittleEndian.PutUint32(header[0:], uint32(now.Unix()))
+	binary.LittleEndian.PutUint32(header[4:], uint32(now.Nanosecond()))
+	binary.LittleEndian.PutUint32(header[8:], uint32(len(packet)))
+	binary.LittleEndian.PutUint32(header[12:], uint32(len(packet)))
+	_, _ = w.w.Write(header)
+	if _, err := w.w.Write(packet); err != nil {
+		log.Printf("  Error - tunnel (%s) capture cannot be written: %v\n", w.name, err)
+		w.stopped = true
+		return
+	}
+	w.size += record
+}
+
+// stop ends the capture, keeping the packets written.  Must be called holding
+// the lock
+func (w *Writer) stop(reason string) {
+	w.stopped = true
+	_ = w.w.Flush()
+	log.Printf("  Info  - tunnel (%s) capture stopped as %s\n", w.name, reason)
+}
+
+func tcpAddr(addr net.Addr) *net.TCPAddr {
+	if tcp, ok := addr.(*net.TCPAddr); ok {
+		return tcp
+	}
+	return &net.TCPAddr{IP: net.IPv4zero}
+}
+
+// buildPacket lays out an ip4 or ip6 packet carrying a tcp segment, ip6 being
+// used whenever either address is not an ip4 one
+func buildPacket(src *net.TCPAddr, dst *net.TCPAddr, seq uint32, ack uint32, flags byte, payload []byte) []byte {
+	tcp := make([]byte, 20+len(payload))
+	binary.BigEndian.PutUint16(tcp[0:], uint16(src.Port))
+	binary.BigEndian.PutUint16(tcp[2:], uint16(dst.Port))
+	binary.BigEndian.PutUint32(tcp[4:], seq)
+	if flags&tcpAck != 0 {
+		binary.BigEndian.PutUint32(tcp[8:], ack)
+	}
+	tcp[12] = 5 << 4
+	tcp[13] = flags
+	binary.BigEndian.PutUint16(tcp[14:], 65535)
+	copy(tcp[20:], payload)
+
+	src4, dst4 := src.IP.To4(), dst.IP.To4()
+	if src4 != nil && dst4 != nil {
+		pseudo := make([]byte, 0, 12)
+		pseudo = append(append(pseudo, src4...), dst4...)
+		pseudo = append(pseudo, 0, 6, byte(len(tcp)>>8), byte(len(tcp)))
+		binary.BigEndian.PutUint16(tcp[16:], checksum(pseudo, tcp))
+
+		ip := make([]byte, 20, 20+len(tcp))
+		ip[0] = 0x45
+		binary.BigEndian.PutUint16(ip[2:], uint16(20+len(tcp)))
+		ip[8] = 64
+		ip[9] = 6
+		copy(ip[12:], src4)
+		copy(ip[16:], dst4)
+		binary.BigEndian.PutUint16(ip[10:], checksum(ip))
+		return append(ip, tcp...)
+	}
+
+	src16, dst16 := src.IP.To16(), dst.IP.To16()
+	if src16 == nil {
+		src16 = net.IPv6unspecified
+	}
+	if dst16 == nil {
+		dst16 = net.IPv6unspecified
+	}
+	pseudo := make([]byte, 0, 40)
+	pseudo = append(append(pseudo, src16...), dst16...)
+	pseudo = binary.BigEndian.AppendUint32(pseudo, uint32(len(tcp)))
+	pseudo = append(pseudo, 0, 0, 0, 6)
+	binary.BigEndian.PutUint16(tcp[16:], checksum(pseudo, tcp))
+
+	ip := make([]byte, 40, 40+len(tcp))
+	ip[0] = 0x60
+	binary.BigEndian.PutUint16(ip[4:], uint16(len(tcp)))
+	ip[6] = 6
+	ip[7] = 64
+	copy(ip[8:], src16)
+	copy(ip[24:], dst16)
+	return append(ip, tcp...)
+}
+
+// checksum is the internet checksum of the data taken together
+func checksum(data ...[]byte) uint16 {
+	var sum uint32
+	odd := false
+	for _, d := range data {
+		for _, b := range d {
+			if odd {
+				sum += uint32(b)
+			} else {
+				sum += uint32(b) << 8
+			}
+			odd = !odd
+		}
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum)
+}
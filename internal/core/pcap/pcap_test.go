@@ -0,0 +1,89 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package pcap
+
+import (
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// packets splits a pcap file into its packets
+func packets(t *testing.T, file string) [][]byte {
+	bs, err := os.ReadFile(file)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, len(bs), 24)
+	assert.Equal(t, uint32(magic), binary.LittleEndian.Uint32(bs))
+	assert.Equal(t, uint32(linkRaw), binary.LittleEndian.Uint32(bs[20:]))
+	var list [][]byte
+	for bs = bs[24:]; len(bs) >= 16; {
+		n := int(binary.LittleEndian.Uint32(bs[8:]))
+		list = append(list, bs[16:16+n])
+		bs = bs[16+n:]
+	}
+	return list
+}
+
+func TestStream(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "capture.pcap")
+	w, err := Create(file, "test", 0, time.Time{})
+	require.NoError(t, err)
+	client := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 50000}
+	server := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5432}
+	s := w.Stream(client, server)
+	s.Write([]byte("request"), true)
+	s.Write([]byte("response"), false)
+	s.Close()
+	require.NoError(t, w.Close())
+
+	list := packets(t, file)
+	require.Len(t, list, 7)
+	request := list[3]
+	assert.Equal(t, byte(0x45), request[0])
+	assert.Equal(t, uint16(0), checksum(request[:20]), "ip4 header checksum")
+	assert.Equal(t, uint16(50000), binary.BigEndian.Uint16(request[20:]))
+	assert.Equal(t, uint16(5432), binary.BigEndian.Uint16(request[22:]))
+	assert.Equal(t, "request", string(request[40:]))
+	response := list[4]
+	assert.Equal(t, "response", string(response[40:]))
+	// The server acknowledges all the client has sent
+	assert.Equal(t, binary.BigEndian.Uint32(request[24:])+7, binary.BigEndian.Uint32(response[28:]))
+}
+
+func TestStreamIPv6(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "capture.pcap")
+	w, err := Create(file, "test", 0, time.Time{})
+	require.NoError(t, err)
+	s := w.Stream(&net.TCPAddr{IP: net.IPv6loopback, Port: 50000}, &net.TCPAddr{IP: net.IPv6loopback, Port: 80})
+	s.Write([]byte("GET /"), true)
+	require.NoError(t, w.Close())
+
+	list := packets(t, file)
+	require.Len(t, list, 4)
+	assert.Equal(t, byte(0x60), list[3][0])
+	assert.Equal(t, "GET /", string(list[3][60:]))
+}
+
+func TestSizeLimit(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "capture.pcap")
+	w, err := Create(file, "test", 300, time.Time{})
+	require.NoError(t, err)
+	s := w.Stream(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 50000}, &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 80})
+	s.Write(make([]byte, 100), true)
+	s.Write([]byte("small"), true)
+	require.NoError(t, w.Close())
+
+	fi, err := os.Stat(file)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, fi.Size(), int64(300))
+	// The handshake fits but the first write does not, and nothing follows it
+	assert.Len(t, packets(t, file), 3)
+}
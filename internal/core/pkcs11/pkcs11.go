@@ -0,0 +1,51 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package pkcs11
+
+import (
+	"errors"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	ErrUnsupported = errors.New("PKCS#11 providers require a build with cgo")
+
+	lock    sync.Mutex
+	loaded  = make(map[string][]ssh.Signer)
+	closers = make(map[string]func())
+)
+
+// Signers returns a signer for every key on the tokens of the PKCS#11 provider
+// library, logging in with the pin when one is given.  The keys never leave the
+// token, each signature being made by it.  A provider is loaded once and its
+// keys shared by every host using it
+func Signers(provider string, pin string) ([]ssh.Signer, error) {
+	lock.Lock()
+	defer lock.Unlock()
+	if signers, ok := loaded[provider]; ok {
+		return signers, nil
+	}
+	signers, closer, err := load(provider, pin)
+	if err != nil {
+		return nil, err
+	}
+	loaded[provider] = signers
+	closers[provider] = closer
+	return signers, nil
+}
+
+// Close logs out of every token and unloads the providers, after which their
+// keys can no longer sign
+func Close() {
+	lock.Lock()
+	defer lock.Unlock()
+	for provider, closer := range closers {
+		closer()
+		delete(closers, provider)
+		delete(loaded, provider)
+	}
+}
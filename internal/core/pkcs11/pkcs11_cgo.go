@@ -0,0 +1,294 @@
+//go:build cgo
+
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package pkcs11
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sync"
+
+	p11 "github.com/miekg/pkcs11"
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	curves = map[string]elliptic.Curve{
+		"1.2.840.10045.3.1.7": elliptic.P256(),
+		"1.3.132.0.34":        elliptic.P384(),
+		"1.3.132.0.35":        elliptic.P521(),
+	}
+
+	// DER prefixes of the DigestInfo a CKM_RSA_PKCS signature is made over
+	digestInfo = map[crypto.Hash][]byte{
+		crypto.SHA1:   {0x30, 0x21, 0x30, 0x09, 0x06, 0x05, 0x2b, 0x0e, 0x03, 0x02, 0x1a, 0x05, 0x00, 0x04, 0x14},
+		crypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+		crypto.SHA512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+	}
+)
+
+// session is a token's open session, which may only be used by one signature
+// at a time
+type session struct {
+	ctx    *p11.Ctx
+	handle p11.SessionHandle
+	lock   sync.Mutex
+}
+
+type key struct {
+	session *session
+	handle  p11.ObjectHandle
+	public  crypto.PublicKey
+}
+
+func load(provider string, pin string) ([]ssh.Signer, func(), error) {
+	ctx := p11.New(provider)
+	if ctx == nil {
+		return nil, nil, fmt.Errorf("PKCS#11 provider (%s) cannot be loaded", provider)
+	}
+	if err := ctx.Initialize(); err != nil && !errors.Is(err, p11.Error(p11.CKR_CRYPTOKI_ALREADY_INITIALIZED)) {
+		return nil, nil, fmt.Errorf("PKCS#11 provider (%s) cannot be initialized: %w", provider, err)
+	}
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return nil, nil, fmt.Errorf("PKCS#11 provider (%s) tokens cannot be listed: %w", provider, err)
+	}
+	var signers []ssh.Signer
+	var sessions []*session
+	for _, slot := range slots {
+		handle, err := ctx.OpenSession(slot, p11.CKF_SERIAL_SESSION)
+		if err != nil {
+			return nil, nil, fmt.Errorf("PKCS#11 provider (%s) slot %d cannot be opened: %w", provider, slot, err)
+		}
+		s := &session{ctx: ctx, handle: handle}
+		if pin != "" {
+			if err = ctx.Login(handle, p11.CKU_USER, pin); err != nil && !errors.Is(err, p11.Error(p11.CKR_USER_ALREADY_LOGGED_IN)) {
+				_ = ctx.CloseSession(handle)
+				return nil, nil, fmt.Errorf("PKCS#11 provider (%s) slot %d login failed: %w", provider, slot, err)
+			}
+		}
+		keys, err := s.keys()
+		if err != nil {
+			return nil, nil, fmt.Errorf("PKCS#11 provider (%s) slot %d keys cannot be read: %w", provider, slot, err)
+		}
+		for _, k := range keys {
+			signer, err := ssh.NewSignerFromSigner(k)
+			if err == nil {
+				signers = append(signers, signer)
+			}
+		}
+		if len(keys) == 0 {
+			_ = ctx.CloseSession(handle)
+		} else {
+			sessions = append(sessions, s)
+		}
+	}
+	if len(signers) == 0 {
+		if pin == "" {
+			return nil, nil, fmt.Errorf("PKCS#11 provider (%s) offers no keys, a pin may be required", provider)
+		}
+		return nil, nil, fmt.Errorf("PKCS#11 provider (%s) offers no keys", provider)
+	}
+	return signers, func() { unload(ctx, sessions) }, nil
+}
+
+// unload logs out of the provider's sessions and finalizes it
+func unload(ctx *p11.Ctx, sessions []*session) {
+	for _, s := range sessions {
+		s.lock.Lock()
+		_ = ctx.Logout(s.handle)
+		_ = ctx.CloseSession(s.handle)
+		s.lock.Unlock()
+	}
+	_ = ctx.Finalize()
+	ctx.Destroy()
+}
+
+// keys returns the rsa and ecdsa private keys of the token whose public key
+// can be found, as a public key object or a certificate of the same id
+func (s *session) keys() ([]*key, error) {
+	handles, err := s.find([]*p11.Attribute{p11.NewAttribute(p11.CKA_CLASS, p11.CKO_PRIVATE_KEY)})
+	if err != nil {
+		return nil, err
+	}
+	var keys []*key
+	for _, handle := range handles {
+		attrs, err := s.ctx.GetAttributeValue(s.handle, handle, []*p11.Attribute{p11.NewAttribute(p11.CKA_ID, nil)})
+		if err != nil {
+			continue
+		}
+		if public := s.publicKey(attrs[0].Value); public != nil {
+			keys = append(keys, &key{session: s, handle: handle, public: public})
+		}
+	}
+	return keys, nil
+}
+
+func (s *session) find(template []*p11.Attribute) ([]p11.ObjectHandle, error) {
+	if err := s.ctx.FindObjectsInit(s.handle, template); err != nil {
+		return nil, err
+	}
+	defer func() { _ = s.ctx.FindObjectsFinal(s.handle) }()
+	var handles []p11.ObjectHandle
+	for {
+		found, _, err := s.ctx.FindObjects(s.handle, 16)
+		if err != nil {
+			return nil, err
+		}
+		if len(found) == 0 {
+			return handles, nil
+		}
+		handles = append(handles, found...)
+	}
+}
+
+func (s *session) publicKey(id []byte) crypto.PublicKey {
+	handles, err := s.find([]*p11.Attribute{
+		p11.NewAttribute(p11.CKA_CLASS, p11.CKO_PUBLIC_KEY),
+		p11.NewAttribute(p11.CKA_ID, id),
+	})
+	if err == nil && len(handles) > 0 {
+		if public := s.readPublicKey(handles[0]); public != nil {
+			return public
+		}
+	}
+	handles, err = s.find([]*p11.Attribute{
+		p11.NewAttribute(p11.CKA_CLASS, p11.CKO_CERTIFICATE),
+		p11.NewAttribute(p11.CKA_ID, id),
+	})
+	if err != nil || len(handles) == 0 {
+		return nil
+	}
+	attrs, err := s.ctx.GetAttributeValue(s.handle, handles[0], []*p11.Attribute{p11.NewAttribute(p11.CKA_VALUE, nil)})
+	if err != nil {
+		return nil
+	}
+	cert, err := x509.ParseCertificate(attrs[0].Value)
+	if err != nil {
+		return nil
+	}
+	switch cert.PublicKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		return cert.PublicKey
+	}
+	return nil
+}
+
+func (s *session) readPublicKey(handle p11.ObjectHandle) crypto.PublicKey {
+	attrs, err := s.ctx.GetAttributeValue(s.handle, handle, []*p11.Attribute{p11.NewAttribute(p11.CKA_KEY_TYPE, nil)})
+	if err != nil {
+		return nil
+	}
+	switch ulong(attrs[0].Value) {
+	case p11.CKK_RSA:
+		attrs, err = s.ctx.GetAttributeValue(s.handle, handle, []*p11.Attribute{
+			p11.NewAttribute(p11.CKA_MODULUS, nil),
+			p11.NewAttribute(p11.CKA_PUBLIC_EXPONENT, nil),
+		})
+		if err != nil {
+			return nil
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(attrs[0].Value),
+			E: int(new(big.Int).SetBytes(attrs[1].Value).Int64()),
+		}
+	case p11.CKK_EC:
+		attrs, err = s.ctx.GetAttributeValue(s.handle, handle, []*p11.Attribute{
+			p11.NewAttribute(p11.CKA_EC_PARAMS, nil),
+			p11.NewAttribute(p11.CKA_EC_POINT, nil),
+		})
+		if err != nil {
+			return nil
+		}
+		return ecPublicKey(attrs[0].Value, attrs[1].Value)
+	}
+	return nil
+}
+
+// ecPublicKey decodes a named curve and an uncompressed point, which most
+// providers wrap in a DER octet string
+func ecPublicKey(params []byte, point []byte) crypto.PublicKey {
+	var oid asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(params, &oid); err != nil {
+		return nil
+	}
+	curve, ok := curves[oid.String()]
+	if !ok {
+		return nil
+	}
+	var raw []byte
+	if rest, err := asn1.Unmarshal(point, &raw); err == nil && len(rest) == 0 {
+		point = raw
+	}
+	size := (curve.Params().BitSize + 7) / 8
+	if len(point) != 1+2*size || point[0] != 4 {
+		return nil
+	}
+	return &ecdsa.PublicKey{
+		Curve: curve,
+		X:     new(big.Int).SetBytes(point[1 : 1+size]),
+		Y:     new(big.Int).SetBytes(point[1+size:]),
+	}
+}
+
+// ulong decodes an attribute holding a CK_ULONG, whose size and byte order are
+// those of the platform
+func ulong(b []byte) uint {
+	switch len(b) {
+	case 4:
+		return uint(binary.NativeEndian.Uint32(b))
+	case 8:
+		return uint(binary.NativeEndian.Uint64(b))
+	}
+	return 0
+}
+
+func (k *key) Public() crypto.PublicKey {
+	return k.public
+}
+
+// Sign has the token sign the digest, returning an ecdsa signature in the DER
+// form expected of a crypto.Signer
+func (k *key) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	var mechanism uint
+	data := digest
+	switch k.public.(type) {
+	case *rsa.PublicKey:
+		prefix, ok := digestInfo[opts.HashFunc()]
+		if !ok {
+			return nil, fmt.Errorf("PKCS#11 hash %v unsupported", opts.HashFunc())
+		}
+		mechanism = p11.CKM_RSA_PKCS
+		data = append(append([]byte{}, prefix...), digest...)
+	case *ecdsa.PublicKey:
+		mechanism = p11.CKM_ECDSA
+	}
+
+	k.session.lock.Lock()
+	defer k.session.lock.Unlock()
+	ctx, handle := k.session.ctx, k.session.handle
+	if err := ctx.SignInit(handle, []*p11.Mechanism{p11.NewMechanism(mechanism, nil)}, k.handle); err != nil {
+		return nil, err
+	}
+	signature, err := ctx.Sign(handle, data)
+	if err != nil || mechanism != p11.CKM_ECDSA {
+		return signature, err
+	}
+	half := len(signature) / 2
+	return asn1.Marshal(struct{ R, S *big.Int }{
+		R: new(big.Int).SetBytes(signature[:half]),
+		S: new(big.Int).SetBytes(signature[half:]),
+	})
+}
@@ -0,0 +1,15 @@
+//go:build !cgo
+
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package pkcs11
+
+import (
+	"golang.org/x/crypto/ssh"
+)
+
+func load(string, string) ([]ssh.Signer, func(), error) {
+	return nil, nil, ErrUnsupported
+}
@@ -0,0 +1,195 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+// Package preauth is the handshake a tunnel's entrance can require before it
+// forwards anything.  The entrance sends a random challenge, which the client
+// answers with an hmac of it keyed with the shared secret, or with a token
+// signed with the secret naming who it was issued to, until when, and for
+// which tunnel.  Only then does either side's traffic flow
+package preauth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	greeting = "auto-ssh-auth/1"
+	// Timeout bounds the whole handshake, so a client saying nothing cannot
+	// hold a connection open
+	Timeout = 10 * time.Second
+
+	nonceSize   = 32
+	maxLine     = 4096
+	tokenPrefix = "v1."
+)
+
+var (
+	ErrDenied = errors.New("authentication denied")
+)
+
+type claims struct {
+	Tunnel  string `json:"tun"`
+	Subject string `json:"sub"`
+	Expires int64  `json:"exp"`
+}
+
+// Challenge requires the client on conn to authenticate for the tunnel,
+// returning who it is: the subject of its token, or blank when it proved it
+// holds the secret
+func Challenge(conn net.Conn, secret []byte, tunnel string) (string, error) {
+	_ = conn.SetDeadline(time.Now().Add(Timeout))
+	defer func() { _ = conn.SetDeadline(time.Time{}) }()
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	if _, err := fmt.Fprintf(conn, "%s %s\n", greeting, hex.EncodeToString(nonce)); err != nil {
+		return "", err
+	}
+	answer, err := readLine(conn)
+	if err != nil {
+		return "", fmt.Errorf("authentication unreadable: %w", err)
+	}
+	kind, value, _ := strings.Cut(answer, " ")
+	var subject string
+	switch kind {
+	case "hmac":
+		given, decodeErr := hex.DecodeString(value)
+		if decodeErr != nil || !hmac.Equal(given, response(secret, nonce)) {
+			err = fmt.Errorf("%w: secret does not match", ErrDenied)
+		}
+	case "token":
+		subject, err = Verify(secret, value, tunnel, time.Now())
+	default:
+		err = fmt.Errorf("%w: client did not authenticate", ErrDenied)
+	}
+	if err != nil {
+		_, _ = io.WriteString(conn, "denied\n")
+		return subject, err
+	}
+	if _, err = io.WriteString(conn, "ok\n"); err != nil {
+		return subject, err
+	}
+	return subject, nil
+}
+
+// Respond authenticates to the entrance on conn, with the token when given and
+// otherwise by proving it holds the secret
+func Respond(conn net.Conn, secret []byte, token string) error {
+	_ = conn.SetDeadline(time.Now().Add(Timeout))
+	defer func() { _ = conn.SetDeadline(time.Time{}) }()
+	line, err := readLine(conn)
+	if err != nil {
+		return fmt.Errorf("authentication challenge unreadable: %w", err)
+	}
+	version, challenge, _ := strings.Cut(line, " ")
+	nonce, err := hex.DecodeString(challenge)
+	if version != greeting || err != nil || len(nonce) != nonceSize {
+		return fmt.Errorf("entrance did not ask to authenticate")
+	}
+	answer := "hmac " + hex.EncodeToString(response(secret, nonce))
+	if token != "" {
+		answer = "token " + token
+	}
+	if _, err = io.WriteString(conn, answer+"\n"); err != nil {
+		return err
+	}
+	if reply, err := readLine(conn); err != nil {
+		return fmt.Errorf("authentication reply unreadable: %w", err)
+	} else if reply != "ok" {
+		return ErrDenied
+	}
+	return nil
+}
+
+// response keys the hmac of the challenge with the secret, distinct from the
+// signature of any token
+func response(secret, nonce []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("challenge\n"))
+	mac.Write(nonce)
+	return mac.Sum(nil)
+}
+
+// Sign issues a token for the subject to authenticate to the tunnel with until
+// it expires, without being given the secret.  The tunnel is named so a token
+// is no good for another tunnel sharing the secret
+func Sign(secret []byte, tunnel string, subject string, expires time.Time) (string, error) {
+	payload, err := json.Marshal(&claims{Tunnel: tunnel, Subject: subject, Expires: expires.Unix()})
+	if err != nil {
+		return "", err
+	}
+	signed := tokenPrefix + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature(secret, signed)), nil
+}
+
+// Verify checks the token was signed with the secret for the tunnel and has
+// not expired, returning its subject
+func Verify(secret []byte, token string, tunnel string, now time.Time) (string, error) {
+	signed, sig, ok := cutLast(token, ".")
+	if !ok || !strings.HasPrefix(signed, tokenPrefix) {
+		return "", fmt.Errorf("%w: token malformed", ErrDenied)
+	}
+	given, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(given, signature(secret, signed)) {
+		return "", fmt.Errorf("%w: token signature does not match", ErrDenied)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(signed, tokenPrefix))
+	if err != nil {
+		return "", fmt.Errorf("%w: token malformed", ErrDenied)
+	}
+	c := &claims{}
+	if err = json.Unmarshal(payload, c); err != nil {
+		return "", fmt.Errorf("%w: token malformed", ErrDenied)
+	}
+	if c.Tunnel != tunnel {
+		return c.Subject, fmt.Errorf("%w: token of %s is for another tunnel", ErrDenied, c.Subject)
+	}
+	if now.Unix() >= c.Expires {
+		return c.Subject, fmt.Errorf("%w: token of %s expired %s", ErrDenied, c.Subject, time.Unix(c.Expires, 0).Format(time.RFC3339))
+	}
+	return c.Subject, nil
+}
+
+func signature(secret []byte, signed string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("token\n" + signed))
+	return mac.Sum(nil)
+}
+
+func cutLast(s, sep string) (string, string, bool) {
+	i := strings.LastIndex(s, sep)
+	if i < 0 {
+		return s, "", false
+	}
+	return s[:i], s[i+len(sep):], true
+}
+
+// readLine reads up to a newline a byte at a time, so nothing the other side
+// sends once authenticated is read along with it
+func readLine(conn net.Conn) (string, error) {
+	line := make([]byte, 0, 128)
+	b := make([]byte, 1)
+	for len(line) < maxLine {
+		if _, err := io.ReadFull(conn, b); err != nil {
+			return "", err
+		}
+		if b[0] == '\n' {
+			return strings.TrimSuffix(string(line), "\r"), nil
+		}
+		line = append(line, b[0])
+	}
+	return "", errors.New("line too long")
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package preauth
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func handshake(t *testing.T, serverSecret []byte, clientSecret []byte, token string) (string, error, error) {
+	server, client := net.Pipe()
+	defer func() { _ = server.Close() }()
+	defer func() { _ = client.Close() }()
+	responded := make(chan error, 1)
+	go func() {
+		responded <- Respond(client, clientSecret, token)
+	}()
+	subject, err := Challenge(server, serverSecret, "db")
+	if err == nil {
+		// Traffic flows once authenticated
+		go func() { _, _ = server.Write([]byte("greeting")) }()
+		b := make([]byte, 8)
+		_, readErr := client.Read(b)
+		require.NoError(t, readErr)
+		assert.Equal(t, "greeting", string(b))
+	}
+	return subject, err, <-responded
+}
+
+func TestSecret(t *testing.T) {
+	secret := []byte("correct horse battery staple")
+	subject, err, responded := handshake(t, secret, secret, "")
+	assert.NoError(t, err)
+	assert.NoError(t, responded)
+	assert.Equal(t, "", subject)
+
+	_, err, responded = handshake(t, secret, []byte("wrong"), "")
+	assert.ErrorIs(t, err, ErrDenied)
+	assert.ErrorIs(t, responded, ErrDenied)
+}
+
+func TestToken(t *testing.T) {
+	secret := []byte("correct horse battery staple")
+	token, err := Sign(secret, "db", "alice", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	subject, err, responded := handshake(t, secret, nil, token)
+	assert.NoError(t, err)
+	assert.NoError(t, responded)
+	assert.Equal(t, "alice", subject)
+
+	_, err = Verify([]byte("another secret"), token, "db", time.Now())
+	assert.ErrorIs(t, err, ErrDenied)
+	_, err = Verify(secret, token, "cache", time.Now())
+	assert.ErrorIs(t, err, ErrDenied)
+	subject, err = Verify(secret, token, "db", time.Now().Add(2*time.Hour))
+	assert.ErrorIs(t, err, ErrDenied)
+	assert.Equal(t, "alice", subject)
+	_, err = Verify(secret, token[:len(token)-2], "db", time.Now())
+	assert.ErrorIs(t, err, ErrDenied)
+}
+
+func TestUnauthenticatedClient(t *testing.T) {
+	server, client := net.Pipe()
+	defer func() { _ = client.Close() }()
+	go func() {
+		b := make([]byte, 128)
+		_, _ = client.Read(b)
+		_, _ = client.Write([]byte("SELECT 1;\n"))
+		_, _ = client.Read(b)
+	}()
+	_, err := Challenge(server, []byte("secret"), "db")
+	assert.True(t, errors.Is(err, ErrDenied))
+}
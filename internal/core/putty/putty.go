@@ -0,0 +1,121 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package putty
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/utils"
+)
+
+const (
+	sessionsKey = `Software\SimonTatham\PuTTY\Sessions`
+)
+
+var (
+	idRegEx = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+)
+
+// Session holds the values of a PuTTY saved session relevant to auto-ssh
+type Session struct {
+	Name            string
+	HostName        string
+	Port            int
+	UserName        string
+	PublicKeyFile   string
+	PortForwardings string
+}
+
+// Convert translates the sessions into host and tunnel definitions.  Forwardings
+// that auto-ssh cannot represent are returned as warnings
+func Convert(sessions []*Session) ([]*config.Host, []*config.Tunnel, []string) {
+	var hosts []*config.Host
+	var tunnels []*config.Tunnel
+	var warnings []string
+	for _, session := range sessions {
+		name := sessionName(session.Name)
+		if session.HostName == "" {
+			warnings = append(warnings, fmt.Sprintf("session (%s) has no host name", name))
+			continue
+		}
+		port := session.Port
+		if port == 0 {
+			port = 22
+		}
+		hostId := idRegEx.ReplaceAllString(name, "-")
+		username, hostname := session.UserName, session.HostName
+		if i := strings.LastIndex(hostname, "@"); i >= 0 {
+			username, hostname = utils.DefaultString(username, hostname[:i]), hostname[i+1:]
+		}
+		hosts = append(hosts, &config.Host{
+			Id:       hostId,
+			Name:     name,
+			Remote:   config.NewAddress(fmt.Sprintf("%s:%d", hostname, port)),
+			Username: username,
+			Identity: session.PublicKeyFile,
+		})
+		if strings.HasSuffix(strings.ToLower(session.PublicKeyFile), ".ppk") {
+			warnings = append(warnings, fmt.Sprintf(
+				"session (%s) identity (%s) must be converted to OpenSSH format with puttygen", name, session.PublicKeyFile,
+			))
+		}
+
+		for i, forward := range ParseForwardings(session.PortForwardings) {
+			if forward.Type != "L" {
+				warnings = append(warnings, fmt.Sprintf(
+					"session (%s) %s forwarding of %s is not supported", name, forward.Type, forward.Local,
+				))
+				continue
+			}
+			tunnels = append(tunnels, &config.Tunnel{
+				Id:     fmt.Sprintf("%s-%d", hostId, i+1),
+				Name:   fmt.Sprintf("%s %s", name, forward.Local),
+				Local:  config.NewAddress(forward.Local),
+				Remote: config.NewAddress(forward.Remote),
+				Host:   hostId,
+			})
+		}
+	}
+	return hosts, tunnels, warnings
+}
+
+// Forwarding is a single entry of a session's PortForwardings value
+type Forwarding struct {
+	Type   string
+	Local  string
+	Remote string
+}
+
+// ParseForwardings splits the PuTTY PortForwardings value, such as
+// "L8080=localhost:80,4L127.0.0.1:5432=db:5432,D1080", into its entries
+func ParseForwardings(value string) []*Forwarding {
+	var forwards []*Forwarding
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		// Strip the address family prefix
+		entry = strings.TrimLeft(entry, "46")
+		if len(entry) < 2 {
+			continue
+		}
+		forward := &Forwarding{Type: entry[:1]}
+		local, remote, _ := strings.Cut(entry[1:], "=")
+		forward.Local = local
+		forward.Remote = remote
+		forwards = append(forwards, forward)
+	}
+	return forwards
+}
+
+// sessionName reverses PuTTY's escaping of session names in the registry
+func sessionName(name string) string {
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		return unescaped
+	}
+	return name
+}
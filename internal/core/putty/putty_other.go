@@ -0,0 +1,17 @@
+//go:build !windows
+
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package putty
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Sessions is only supported on windows where PuTTY stores sessions in the registry
+func Sessions() ([]*Session, error) {
+	return nil, fmt.Errorf("importing PuTTY sessions is not supported on %s", runtime.GOOS)
+}
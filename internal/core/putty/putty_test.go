@@ -0,0 +1,44 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package putty
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseForwardings(t *testing.T) {
+	forwards := ParseForwardings("L8080=localhost:80,4L127.0.0.1:5432=db:5432,R2222=localhost:22,D1080")
+	assert.Equal(t, 4, len(forwards))
+	assert.Equal(t, Forwarding{Type: "L", Local: "8080", Remote: "localhost:80"}, *forwards[0])
+	assert.Equal(t, Forwarding{Type: "L", Local: "127.0.0.1:5432", Remote: "db:5432"}, *forwards[1])
+	assert.Equal(t, "R", forwards[2].Type)
+	assert.Equal(t, Forwarding{Type: "D", Local: "1080"}, *forwards[3])
+	assert.Empty(t, ParseForwardings(""))
+}
+
+func TestConvert(t *testing.T) {
+	hosts, tunnels, warnings := Convert([]*Session{
+		{
+			Name:            "Prod%20Bastion",
+			HostName:        "ops@bastion.example.com",
+			PublicKeyFile:   `C:\keys\prod.ppk`,
+			PortForwardings: "L5432=db:5432,D1080",
+		},
+		{Name: "empty"},
+	})
+	assert.Equal(t, 1, len(hosts))
+	assert.Equal(t, "Prod-Bastion", hosts[0].Id)
+	assert.Equal(t, "Prod Bastion", hosts[0].Name)
+	assert.Equal(t, "bastion.example.com:22", hosts[0].Remote.String())
+	assert.Equal(t, "ops", hosts[0].Username)
+	assert.Equal(t, 1, len(tunnels))
+	assert.Equal(t, "Prod-Bastion-1", tunnels[0].Id)
+	assert.Equal(t, "5432", tunnels[0].Local.String())
+	assert.Equal(t, "db:5432", tunnels[0].Remote.String())
+	assert.Equal(t, "Prod-Bastion", tunnels[0].Host)
+	assert.Equal(t, 3, len(warnings))
+}
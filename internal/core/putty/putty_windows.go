@@ -0,0 +1,52 @@
+//go:build windows
+
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package putty
+
+import (
+	"golang.org/x/sys/windows/registry"
+)
+
+// Sessions reads the saved sessions of the current user from the registry
+func Sessions() ([]*Session, error) {
+	key, err := registry.OpenKey(registry.CURRENT_USER, sessionsKey, registry.ENUMERATE_SUB_KEYS)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = key.Close() }()
+
+	names, err := key.ReadSubKeyNames(-1)
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]*Session, 0, len(names))
+	for _, name := range names {
+		session, err := readSession(name)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+func readSession(name string) (*Session, error) {
+	key, err := registry.OpenKey(registry.CURRENT_USER, sessionsKey+`\`+name, registry.QUERY_VALUE)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = key.Close() }()
+
+	session := &Session{Name: name}
+	session.HostName, _, _ = key.GetStringValue("HostName")
+	session.UserName, _, _ = key.GetStringValue("UserName")
+	session.PublicKeyFile, _, _ = key.GetStringValue("PublicKeyFile")
+	session.PortForwardings, _, _ = key.GetStringValue("PortForwardings")
+	if port, _, err := key.GetIntegerValue("PortNumber"); err == nil {
+		session.Port = int(port)
+	}
+	return session, nil
+}
@@ -0,0 +1,313 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+// Package recording records sessions on a host as asciicast v2 files, which
+// asciinema plays back.  As each recording is closed its hash is appended to
+// the directory's log, chained to the hash of the entry before it, so a
+// recording altered or removed since, or an entry dropped from the log, is
+// evident when the directory is verified
+package recording
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// LogName is the file in a recording directory chaining its recordings' hashes
+	LogName = "recordings.log"
+	suffix  = ".cast"
+)
+
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+type header struct {
+	Version   int    `json:"version"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	Timestamp int64  `json:"timestamp"`
+	Command   string `json:"command,omitempty"`
+	Title     string `json:"title,omitempty"`
+}
+
+// Recorder writes the events of one session to its recording
+type Recorder struct {
+	lock    sync.Mutex
+	dir     string
+	name    string
+	file    *os.File
+	writer  io.Writer
+	sum     hash.Hash
+	started time.Time
+	// pending holds the start of a character split across writes
+	pending map[string][]byte
+	err     error
+}
+
+// Start creates the recording of a session running the command on the host in
+// the directory, for a terminal of the width and height
+func Start(dir string, host string, command string, width int, height int) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("recording directory (%s) cannot be created: %w", dir, err)
+	}
+	started := time.Now()
+	base := fmt.Sprintf("%s-%s", unsafeName.ReplaceAllString(host, "_"), started.UTC().Format("20060102T150405.000Z"))
+	name := base + suffix
+	file, err := os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	for n := 2; errors.Is(err, os.ErrExist) && n <= 100; n++ {
+		// Another session on the host started in the same millisecond
+		name = fmt.Sprintf("%s-%d%s", base, n, suffix)
+		file, err = os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("recording cannot be created: %w", err)
+	}
+	r := &Recorder{
+		dir:     dir,
+		name:    name,
+		file:    file,
+		sum:     sha256.New(),
+		started: started,
+		pending: make(map[string][]byte),
+	}
+	r.writer = io.MultiWriter(file, r.sum)
+	if err = r.writeLine(&header{Version: 2, Width: width, Height: height, Timestamp: started.Unix(), Command: command, Title: host}); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("recording cannot be written: %w", err)
+	}
+	return r, nil
+}
+
+// Name is the recording's file name within its directory
+func (r *Recorder) Name() string {
+	return r.name
+}
+
+// Output records what is written to w as the session's output
+func (r *Recorder) Output(w io.Writer) io.Writer {
+	return &stream{recorder: r, kind: "o", w: w}
+}
+
+// Input records what is read from reader as the session's input
+func (r *Recorder) Input(reader io.Reader) io.Reader {
+	return io.TeeReader(reader, &stream{recorder: r, kind: "i", w: io.Discard})
+}
+
+type stream struct {
+	recorder *Recorder
+	kind     string
+	w        io.Writer
+}
+
+func (s *stream) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	s.recorder.event(s.kind, p[:n])
+	return n, err
+}
+
+// event appends the data as an event of the kind, holding back a character
+// split across writes so each event is valid utf-8
+func (r *Recorder) event(kind string, p []byte) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.file == nil || r.err != nil {
+		return
+	}
+	data := append(r.pending[kind], p...)
+	cut := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	r.pending[kind] = append([]byte(nil), data[cut:]...)
+	if cut > 0 {
+		r.err = r.writeLine([]interface{}{time.Since(r.started).Seconds(), kind, string(data[:cut])})
+	}
+}
+
+func (r *Recorder) writeLine(v interface{}) error {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = r.writer.Write(append(bs, '\n'))
+	return err
+}
+
+// Close completes the recording, chaining its hash to the directory's log
+func (r *Recorder) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.file == nil {
+		return r.err
+	}
+	for kind, data := range r.pending {
+		if len(data) > 0 && r.err == nil {
+			r.err = r.writeLine([]interface{}{time.Since(r.started).Seconds(), kind, string(data)})
+		}
+	}
+	if err := r.file.Close(); err != nil && r.err == nil {
+		r.err = err
+	}
+	r.file = nil
+	if r.err != nil {
+		return fmt.Errorf("recording (%s) incomplete: %w", r.name, r.err)
+	}
+	if err := appendLog(r.dir, r.name, hex.EncodeToString(r.sum.Sum(nil))); err != nil {
+		return fmt.Errorf("recording (%s) cannot be logged: %w", r.name, err)
+	}
+	return nil
+}
+
+// entry is a line of the log: when a recording was closed, its name, the hash
+// of its contents and the chain, the hash of the previous entry's chain and
+// this entry's name and hash
+type entry struct {
+	closed string
+	name   string
+	sum    string
+	chain  string
+}
+
+func chain(previous string, name string, sum string) string {
+	h := sha256.Sum256([]byte(previous + "\n" + name + "\n" + sum))
+	return hex.EncodeToString(h[:])
+}
+
+func appendLog(dir string, name string, sum string) error {
+	f, err := os.OpenFile(filepath.Join(dir, LogName), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	// Sessions ending together would otherwise chain to the same entry
+	unlock, err := lockFile(f)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	entries, err := readLog(f)
+	if err != nil {
+		return err
+	}
+	previous := ""
+	if len(entries) > 0 {
+		previous = entries[len(entries)-1].chain
+	}
+	_, err = fmt.Fprintf(f, "%s\t%s\t%s\t%s\n", time.Now().UTC().Format(time.RFC3339), name, sum, chain(previous, name, sum))
+	return err
+}
+
+func readLog(r io.Reader) ([]entry, error) {
+	var entries []entry
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("%s line %d is malformed", LogName, line)
+		}
+		entries = append(entries, entry{closed: fields[0], name: fields[1], sum: fields[2], chain: fields[3]})
+	}
+	return entries, scanner.Err()
+}
+
+// Status is what verifying found of a recording
+type Status string
+
+const (
+	Verified Status = "verified"
+	// Altered recordings no longer have the contents they were closed with
+	Altered Status = "altered"
+	// Missing recordings are in the log but not the directory
+	Missing Status = "missing"
+	// Unlogged recordings are in the directory but not the log, being still
+	// recorded, cut short, or added since
+	Unlogged Status = "unlogged"
+	// Unchained entries of the log do not follow from the entry before, the log
+	// having been edited
+	Unchained Status = "unchained"
+)
+
+type Result struct {
+	Name   string
+	Closed string
+	Status Status
+}
+
+// Verify checks the recordings in the directory against its log, reporting
+// each one's status.  It fails only when the log cannot be read
+func Verify(dir string) ([]Result, error) {
+	f, err := os.Open(filepath.Join(dir, LogName))
+	if errors.Is(err, os.ErrNotExist) {
+		f = nil
+	} else if err != nil {
+		return nil, err
+	}
+	var entries []entry
+	if f != nil {
+		entries, err = readLog(f)
+		_ = f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	var results []Result
+	logged := make(map[string]bool)
+	previous := ""
+	for _, e := range entries {
+		logged[e.name] = true
+		result := Result{Name: e.name, Closed: e.closed, Status: Verified}
+		if e.chain != chain(previous, e.name, e.sum) {
+			result.Status = Unchained
+		} else if sum, err := fileSum(filepath.Join(dir, e.name)); errors.Is(err, os.ErrNotExist) {
+			result.Status = Missing
+		} else if err != nil {
+			return nil, err
+		} else if sum != e.sum {
+			result.Status = Altered
+		}
+		previous = e.chain
+		results = append(results, result)
+	}
+	casts, err := filepath.Glob(filepath.Join(dir, "*"+suffix))
+	if err != nil {
+		return nil, err
+	}
+	for _, cast := range casts {
+		if name := filepath.Base(cast); !logged[name] {
+			results = append(results, Result{Name: name, Status: Unlogged})
+		}
+	}
+	return results, nil
+}
+
+func fileSum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package recording
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func record(t *testing.T, dir string, output ...string) string {
+	r, err := Start(dir, "db server", "uptime", 80, 24)
+	require.NoError(t, err)
+	var terminal bytes.Buffer
+	w := r.Output(&terminal)
+	for _, o := range output {
+		_, err = w.Write([]byte(o))
+		require.NoError(t, err)
+	}
+	require.NoError(t, r.Close())
+	assert.Equal(t, strings.Join(output, ""), terminal.String())
+	return r.Name()
+}
+
+func TestRecording(t *testing.T) {
+	dir := t.TempDir()
+	euro := "€"
+	name := record(t, dir, "up 3 days ", euro[:1], euro[1:], "\n")
+	assert.True(t, strings.HasPrefix(name, "db_server-"))
+
+	f, err := os.Open(filepath.Join(dir, name))
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	scanner := bufio.NewScanner(f)
+	require.True(t, scanner.Scan())
+	h := &header{}
+	require.NoError(t, json.Unmarshal(scanner.Bytes(), h))
+	assert.Equal(t, 2, h.Version)
+	assert.Equal(t, "uptime", h.Command)
+	var output string
+	for scanner.Scan() {
+		var event []interface{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		require.Len(t, event, 3)
+		assert.Equal(t, "o", event[1])
+		output += event[2].(string)
+	}
+	assert.Equal(t, "up 3 days €\n", output, "characters split across writes are kept whole")
+}
+
+func TestVerify(t *testing.T) {
+	dir := t.TempDir()
+	first := record(t, dir, "one\n")
+	second := record(t, dir, "two\n")
+	third := record(t, dir, "three\n")
+	results, err := Verify(dir)
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	for _, r := range results {
+		assert.Equal(t, Verified, r.Status, r.Name)
+	}
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, second), []byte("rewritten"), 0600))
+	require.NoError(t, os.Remove(filepath.Join(dir, third)))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "planted"+suffix), nil, 0600))
+	results, err = Verify(dir)
+	require.NoError(t, err)
+	statuses := make(map[string]Status)
+	for _, r := range results {
+		statuses[r.Name] = r.Status
+	}
+	assert.Equal(t, map[string]Status{first: Verified, second: Altered, third: Missing, "planted" + suffix: Unlogged}, statuses)
+}
+
+func TestVerifyEditedLog(t *testing.T) {
+	dir := t.TempDir()
+	record(t, dir, "one\n")
+	second := record(t, dir, "two\n")
+	third := record(t, dir, "three\n")
+	path := filepath.Join(dir, LogName)
+	bs, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.SplitAfter(string(bs), "\n")
+	// The entry of the second recording dropped, hiding it
+	require.NoError(t, os.WriteFile(path, []byte(lines[0]+lines[2]), 0600))
+	results, err := Verify(dir)
+	require.NoError(t, err)
+	statuses := make(map[string]Status)
+	for _, r := range results {
+		statuses[r.Name] = r.Status
+	}
+	assert.Equal(t, Unchained, statuses[third])
+	assert.Equal(t, Unlogged, statuses[second])
+}
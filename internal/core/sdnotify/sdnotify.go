@@ -0,0 +1,95 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+// Package sdnotify tells systemd how auto-ssh is doing through the socket it
+// names in NOTIFY_SOCKET, for services of Type=notify, and paces the
+// heartbeats of a service with WatchdogSec set
+package sdnotify
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	Ready    = "READY=1"
+	Stopping = "STOPPING=1"
+	Watchdog = "WATCHDOG=1"
+)
+
+var (
+	once     sync.Once
+	socket   string
+	interval time.Duration
+)
+
+// Enabled reports whether auto-ssh was started by systemd expecting to be told
+// when it is ready
+func Enabled() bool {
+	once.Do(load)
+	return socket != ""
+}
+
+// WatchdogInterval is how often systemd expects a heartbeat, or zero when it
+// does not watch auto-ssh
+func WatchdogInterval() time.Duration {
+	once.Do(load)
+	return interval
+}
+
+// Notify sends systemd the states, each a KEY=value line.  Nothing is sent when
+// auto-ssh was not started by systemd
+func Notify(states ...string) error {
+	once.Do(load)
+	if socket == "" {
+		return nil
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+	_, err = conn.Write([]byte(strings.Join(states, "\n")))
+	return err
+}
+
+// Status is the state describing auto-ssh to systemctl status
+func Status(status string) string {
+	return "STATUS=" + strings.ReplaceAll(status, "\n", " ")
+}
+
+func load() {
+	defer func() {
+		// Not to be inherited by child processes
+		_ = os.Unsetenv("NOTIFY_SOCKET")
+		_ = os.Unsetenv("WATCHDOG_USEC")
+		_ = os.Unsetenv("WATCHDOG_PID")
+	}()
+	socket, interval = parse(os.Getenv("NOTIFY_SOCKET"), os.Getenv("WATCHDOG_USEC"), os.Getenv("WATCHDOG_PID"), os.Getpid())
+}
+
+// parse reads the environment systemd sets.  A socket beginning with @ is in
+// the abstract namespace, and the watchdog is only for the process it names
+func parse(notifySocket string, watchdogUsec string, watchdogPid string, pid int) (string, time.Duration) {
+	if strings.HasPrefix(notifySocket, "@") {
+		notifySocket = "\x00" + notifySocket[1:]
+	}
+	if notifySocket == "" {
+		return "", 0
+	}
+	if watchdogPid != "" {
+		if p, err := strconv.Atoi(watchdogPid); err != nil || p != pid {
+			return notifySocket, 0
+		}
+	}
+	usec, err := strconv.ParseInt(watchdogUsec, 10, 64)
+	if err != nil || usec <= 0 {
+		return notifySocket, 0
+	}
+	return notifySocket, time.Duration(usec) * time.Microsecond
+}
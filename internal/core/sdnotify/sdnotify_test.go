@@ -0,0 +1,38 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package sdnotify
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := map[string]struct {
+		socket   string
+		usec     string
+		pid      string
+		expected string
+		interval time.Duration
+	}{
+		"not systemd":   {usec: "30000000"},
+		"path":          {socket: "/run/systemd/notify", expected: "/run/systemd/notify"},
+		"abstract":      {socket: "@/org/freedesktop/systemd1/notify/1", expected: "\x00/org/freedesktop/systemd1/notify/1"},
+		"watchdog":      {socket: "/run/n", usec: "30000000", expected: "/run/n", interval: 30 * time.Second},
+		"watchdog pid":  {socket: "/run/n", usec: "30000000", pid: "42", expected: "/run/n", interval: 30 * time.Second},
+		"other pid":     {socket: "/run/n", usec: "30000000", pid: "43", expected: "/run/n"},
+		"invalid usec":  {socket: "/run/n", usec: "soon", expected: "/run/n"},
+		"negative usec": {socket: "/run/n", usec: "-1", expected: "/run/n"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			socket, interval := parse(test.socket, test.usec, test.pid, 42)
+			assert.Equal(tt, test.expected, socket)
+			assert.Equal(tt, test.interval, interval)
+		})
+	}
+}
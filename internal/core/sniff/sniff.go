@@ -0,0 +1,118 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+// Package sniff labels a connection with the protocol it carries from the
+// first bytes either side sends
+package sniff
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	postgresProtocol3 = 196608
+	postgresSSL       = 80877103
+	postgresGSSEnc    = 80877104
+	mysqlProtocol10   = 0x0a
+)
+
+var errHelloRead = errors.New("client hello read")
+
+// Client labels a connection from the first bytes sent by the client, blank
+// when the protocol is not recognized
+func Client(data []byte) string {
+	switch {
+	case len(data) > 5 && data[0] == 0x16 && data[1] == 0x03:
+		if serverName := helloServerName(data); serverName != "" {
+			return "TLS (" + serverName + ")"
+		}
+		return "TLS"
+	case bytes.HasPrefix(data, []byte("SSH-")):
+		return "SSH"
+	case bytes.HasPrefix(data, []byte("PRI * HTTP/2.0\r\n")):
+		return "HTTP/2"
+	case isHTTP(data):
+		req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(data)))
+		if err == nil && req.Host != "" {
+			return "HTTP (" + req.Host + ")"
+		}
+		return "HTTP"
+	case len(data) >= 8 && int(binary.BigEndian.Uint32(data)) >= 8:
+		switch binary.BigEndian.Uint32(data[4:]) {
+		case postgresProtocol3:
+			return "Postgres"
+		case postgresSSL:
+			return "Postgres (ssl)"
+		case postgresGSSEnc:
+			return "Postgres (gss)"
+		}
+	}
+	return ""
+}
+
+// Server labels a connection from the first bytes sent by the server, for
+// protocols the server speaks first in.  Blank when not recognized
+func Server(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("SSH-")):
+		return "SSH"
+	case len(data) > 5 && data[3] == 0 && data[4] == mysqlProtocol10:
+		if version, _, ok := bytes.Cut(data[5:], []byte{0}); ok && len(version) > 0 {
+			return "MySQL (" + string(version) + ")"
+		}
+		return "MySQL"
+	}
+	return ""
+}
+
+// isHTTP reports whether the data starts with an http/1 request line
+func isHTTP(data []byte) bool {
+	line, _, _ := bytes.Cut(data, []byte("\r\n"))
+	method, rest, ok := bytes.Cut(line, []byte(" "))
+	if !ok || len(method) == 0 {
+		return false
+	}
+	for _, c := range method {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return bytes.Contains(rest, []byte(" HTTP/1."))
+}
+
+// helloServerName reads the server name from a tls client hello, blank when
+// there is none or the hello did not fit in the data
+func helloServerName(data []byte) string {
+	var serverName string
+	_ = tls.Server(&helloConn{r: bytes.NewReader(data)}, &tls.Config{
+		GetConfigForClient: func(info *tls.ClientHelloInfo) (*tls.Config, error) {
+			serverName = info.ServerName
+			return nil, errHelloRead
+		},
+	}).Handshake()
+	return strings.ToLower(serverName)
+}
+
+// helloConn feeds a handshake the hello and discards its answer
+type helloConn struct {
+	r io.Reader
+}
+
+func (c *helloConn) Read(b []byte) (int, error)         { return c.r.Read(b) }
+func (c *helloConn) Write(b []byte) (int, error)        { return len(b), nil }
+func (c *helloConn) Close() error                       { return nil }
+func (c *helloConn) LocalAddr() net.Addr                { return &net.TCPAddr{} }
+func (c *helloConn) RemoteAddr() net.Addr               { return &net.TCPAddr{} }
+func (c *helloConn) SetDeadline(_ time.Time) error      { return nil }
+func (c *helloConn) SetReadDeadline(_ time.Time) error  { return nil }
+func (c *helloConn) SetWriteDeadline(_ time.Time) error { return nil }
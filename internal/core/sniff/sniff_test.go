@@ -0,0 +1,56 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package sniff
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func clientHello(t *testing.T, serverName string) []byte {
+	client, server := net.Pipe()
+	defer func() { _ = server.Close() }()
+	go func() {
+		_ = tls.Client(client, &tls.Config{ServerName: serverName, InsecureSkipVerify: true}).Handshake()
+		_ = client.Close()
+	}()
+	buf := make([]byte, 16*1024)
+	n, err := server.Read(buf)
+	assert.NoError(t, err)
+	return buf[:n]
+}
+
+func TestClient(t *testing.T) {
+	tests := map[string]struct {
+		data  []byte
+		label string
+	}{
+		"tls with sni":   {data: clientHello(t, "DB.Example.com"), label: "TLS (db.example.com)"},
+		"tls truncated":  {data: clientHello(t, "db.example.com")[:40], label: "TLS"},
+		"http":           {data: []byte("GET /x HTTP/1.1\r\nHost: app.local:8080\r\n\r\n"), label: "HTTP (app.local:8080)"},
+		"http partial":   {data: []byte("POST /x HTTP/1.1\r\nHo"), label: "HTTP"},
+		"http2":          {data: []byte("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"), label: "HTTP/2"},
+		"ssh":            {data: []byte("SSH-2.0-OpenSSH_9.6\r\n"), label: "SSH"},
+		"postgres":       {data: []byte{0, 0, 0, 40, 0, 3, 0, 0, 'u', 's', 'e', 'r', 0}, label: "Postgres"},
+		"postgres ssl":   {data: []byte{0, 0, 0, 8, 0x04, 0xd2, 0x16, 0x2f}, label: "Postgres (ssl)"},
+		"unknown":        {data: []byte("hello\n"), label: ""},
+		"lowercase verb": {data: []byte("get / HTTP/1.1\r\n"), label: ""},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			assert.Equal(tt, test.label, Client(test.data))
+		})
+	}
+}
+
+func TestServer(t *testing.T) {
+	mysql := append([]byte{0x4a, 0, 0, 0, 0x0a}, []byte("8.0.36\x00rest")...)
+	assert.Equal(t, "MySQL (8.0.36)", Server(mysql))
+	assert.Equal(t, "SSH", Server([]byte("SSH-2.0-OpenSSH_9.6\r\n")))
+	assert.Equal(t, "", Server([]byte("220 smtp ready\r\n")))
+}
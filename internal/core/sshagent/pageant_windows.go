@@ -0,0 +1,123 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package sshagent
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// Pageant answers agent requests sent to its window as WM_COPYDATA messages
+// naming a shared memory mapping, which holds the request and then the reply
+const (
+	pageantCopyDataID = 0x804e50ba
+	pageantMaxMessage = 8192
+	wmCopyData        = 0x004a
+)
+
+var (
+	user32      = windows.NewLazySystemDLL("user32.dll")
+	findWindow  = user32.NewProc("FindWindowW")
+	sendMessage = user32.NewProc("SendMessageW")
+	moveMemory  = windows.NewLazySystemDLL("kernel32.dll").NewProc("RtlMoveMemory")
+
+	pageantLock sync.Mutex
+)
+
+type copyData struct {
+	data   uintptr
+	length uint32
+	ptr    unsafe.Pointer
+}
+
+// pageantConn queries Pageant once a whole request has been written, keeping
+// the reply to be read
+type pageantConn struct {
+	request  bytes.Buffer
+	response bytes.Buffer
+}
+
+func (c *pageantConn) Write(p []byte) (int, error) {
+	c.request.Write(p)
+	for c.request.Len() >= 4 {
+		length := 4 + int(binary.BigEndian.Uint32(c.request.Bytes()))
+		if c.request.Len() < length {
+			break
+		}
+		reply, err := pageantQuery(c.request.Next(length))
+		if err != nil {
+			return 0, err
+		}
+		c.response.Write(reply)
+	}
+	return len(p), nil
+}
+
+func (c *pageantConn) Read(p []byte) (int, error) {
+	if c.response.Len() == 0 {
+		return 0, io.EOF
+	}
+	return c.response.Read(p)
+}
+
+func (c *pageantConn) Close() error {
+	return nil
+}
+
+func pageantWindow() uintptr {
+	name, _ := windows.UTF16PtrFromString("Pageant")
+	window, _, _ := findWindow.Call(uintptr(unsafe.Pointer(name)), uintptr(unsafe.Pointer(name)))
+	return window
+}
+
+func pageantRunning() bool {
+	return pageantWindow() != 0
+}
+
+func pageantQuery(request []byte) ([]byte, error) {
+	if len(request) > pageantMaxMessage {
+		return nil, errors.New("agent request too large for Pageant")
+	}
+	pageantLock.Lock()
+	defer pageantLock.Unlock()
+	window := pageantWindow()
+	if window == 0 {
+		return nil, errors.New("Pageant is not running")
+	}
+
+	name := fmt.Sprintf("PageantRequest%08x", windows.GetCurrentThreadId())
+	mappingName, _ := windows.UTF16PtrFromString(name)
+	mapping, err := windows.CreateFileMapping(windows.InvalidHandle, nil, windows.PAGE_READWRITE, 0, pageantMaxMessage, mappingName)
+	if err != nil {
+		return nil, fmt.Errorf("Pageant shared memory cannot be created: %w", err)
+	}
+	defer func() { _ = windows.CloseHandle(mapping) }()
+	view, err := windows.MapViewOfFile(mapping, windows.FILE_MAP_WRITE, 0, 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("Pageant shared memory cannot be mapped: %w", err)
+	}
+	defer func() { _ = windows.UnmapViewOfFile(view) }()
+	_, _, _ = moveMemory.Call(view, uintptr(unsafe.Pointer(&request[0])), uintptr(len(request)))
+
+	ansiName := append([]byte(name), 0)
+	message := copyData{data: pageantCopyDataID, length: uint32(len(ansiName)), ptr: unsafe.Pointer(&ansiName[0])}
+	if ok, _, _ := sendMessage.Call(window, wmCopyData, 0, uintptr(unsafe.Pointer(&message))); ok == 0 {
+		return nil, errors.New("Pageant refused the request")
+	}
+	reply := make([]byte, pageantMaxMessage)
+	_, _, _ = moveMemory.Call(uintptr(unsafe.Pointer(&reply[0])), view, pageantMaxMessage)
+	length := 4 + int(binary.BigEndian.Uint32(reply))
+	if length > pageantMaxMessage {
+		return nil, errors.New("Pageant reply too large")
+	}
+	return reply[:length], nil
+}
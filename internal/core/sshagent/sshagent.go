@@ -0,0 +1,20 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package sshagent
+
+import (
+	"fmt"
+	"io"
+)
+
+// Dial connects to the user's ssh agent: the socket at SSH_AUTH_SOCK or, on
+// Windows, the OpenSSH agent's named pipe and otherwise Pageant
+func Dial() (io.ReadWriteCloser, error) {
+	conn, err := dial()
+	if err != nil {
+		return nil, fmt.Errorf("ssh-agent unavailable: %w", err)
+	}
+	return conn, nil
+}
@@ -0,0 +1,22 @@
+//go:build !windows
+
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package sshagent
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+)
+
+func dial() (io.ReadWriteCloser, error) {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, errors.New("SSH_AUTH_SOCK not set")
+	}
+	return net.Dial("unix", socket)
+}
@@ -0,0 +1,31 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package sshagent
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// The OpenSSH agent listens on a named pipe, which SSH_AUTH_SOCK may name
+// instead.  A unix socket path, as set by Git Bash or Cygwin, cannot be used
+const openSSHPipe = `\\.\pipe\openssh-ssh-agent`
+
+func dial() (io.ReadWriteCloser, error) {
+	pipe := openSSHPipe
+	if socket := os.Getenv("SSH_AUTH_SOCK"); strings.HasPrefix(socket, `\\.\pipe\`) {
+		pipe = socket
+	}
+	conn, err := os.OpenFile(pipe, os.O_RDWR, 0)
+	if err == nil {
+		return conn, nil
+	}
+	if pageantRunning() {
+		return &pageantConn{}, nil
+	}
+	return nil, fmt.Errorf("neither the OpenSSH agent (%s) nor Pageant is running: %v", pipe, err)
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+// Package statsd sends metrics to a StatsD server, or the DogStatsD server of
+// a Datadog agent, over udp.  Metrics are buffered until flushed, as many to a
+// packet as fit
+package statsd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxPacket keeps each packet within an ethernet frame, as the agents recommend
+const maxPacket = 1432
+
+var unsafe = regexp.MustCompile(`[^A-Za-z0-9_.\-]+`)
+
+type Client struct {
+	lock   sync.Mutex
+	conn   net.Conn
+	prefix string
+	// tags are added to every metric, only DogStatsD having any
+	tags    []string
+	tagged  bool
+	packets [][]byte
+	packet  bytes.Buffer
+}
+
+// New sends to the server at the address.  Metric names are prefixed with the
+// prefix, and with tagged set every metric carries the tags
+func New(address string, prefix string, tagged bool, tags []string) (*Client, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("statsd (%s) unreachable: %w", address, err)
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, ".") {
+		prefix += "."
+	}
+	return &Client{conn: conn, prefix: prefix, tagged: tagged, tags: tags}, nil
+}
+
+// Sanitize makes the name safe as part of a metric name or tag, the dots
+// splitting a name into its hierarchy included
+func Sanitize(name string) string {
+	return strings.ReplaceAll(unsafe.ReplaceAllString(name, "_"), ".", "_")
+}
+
+// Gauge sets the metric to the value
+func (c *Client) Gauge(name string, value float64, tags ...string) {
+	c.add(name, strconv.FormatFloat(value, 'f', -1, 64), "g", tags)
+}
+
+// Count adds the delta to the metric
+func (c *Client) Count(name string, delta int64, tags ...string) {
+	c.add(name, strconv.FormatInt(delta, 10), "c", tags)
+}
+
+func (c *Client) add(name string, value string, kind string, tags []string) {
+	line := c.prefix + name + ":" + value + "|" + kind
+	if c.tagged {
+		if all := append(append([]string(nil), c.tags...), tags...); len(all) > 0 {
+			line += "|#" + strings.Join(all, ",")
+		}
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.packet.Len() > 0 && c.packet.Len()+1+len(line) > maxPacket {
+		c.packets = append(c.packets, bytes.Clone(c.packet.Bytes()))
+		c.packet.Reset()
+	}
+	if c.packet.Len() > 0 {
+		c.packet.WriteByte('\n')
+	}
+	c.packet.WriteString(line)
+}
+
+// Flush sends the metrics added since the last flush, reporting the first
+// packet that could not be sent.  Metrics that cannot be sent are dropped
+func (c *Client) Flush() error {
+	c.lock.Lock()
+	packets := c.packets
+	if c.packet.Len() > 0 {
+		packets = append(packets, bytes.Clone(c.packet.Bytes()))
+	}
+	c.packets = nil
+	c.packet.Reset()
+	c.lock.Unlock()
+	var errs []error
+	for _, p := range packets {
+		if _, err := c.conn.Write(p); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of %d statsd packets not sent: %w", len(errs), len(packets), errors.Join(errs...))
+	}
+	return nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
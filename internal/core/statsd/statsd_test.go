@@ -0,0 +1,82 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package statsd
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func server(t *testing.T) (*net.UDPConn, func() []string) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn, func() []string {
+		var packets []string
+		buf := make([]byte, 65536)
+		for {
+			_ = conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+			n, err := conn.Read(buf)
+			if err != nil {
+				return packets
+			}
+			packets = append(packets, string(buf[:n]))
+		}
+	}
+}
+
+func TestPlain(t *testing.T) {
+	conn, received := server(t)
+	c, err := New(conn.LocalAddr().String(), "auto_ssh", false, []string{"env:prod"})
+	require.NoError(t, err)
+	defer func() { _ = c.Close() }()
+	c.Gauge("tunnel.db.connections.active", 3, "tunnel:db")
+	c.Count("tunnel.db.bytes.in", 1024)
+	c.Gauge("tunnel.db.latency_ms", 1.5)
+	require.NoError(t, c.Flush())
+	assert.Equal(t, []string{"auto_ssh.tunnel.db.connections.active:3|g\nauto_ssh.tunnel.db.bytes.in:1024|c\nauto_ssh.tunnel.db.latency_ms:1.5|g"}, received())
+}
+
+func TestTagged(t *testing.T) {
+	conn, received := server(t)
+	c, err := New(conn.LocalAddr().String(), "auto_ssh.", true, []string{"env:prod"})
+	require.NoError(t, err)
+	defer func() { _ = c.Close() }()
+	c.Gauge("tunnel.connections.active", 3, "tunnel:db")
+	c.Count("tunnel.up", 1)
+	require.NoError(t, c.Flush())
+	assert.Equal(t, []string{"auto_ssh.tunnel.connections.active:3|g|#env:prod,tunnel:db\nauto_ssh.tunnel.up:1|c|#env:prod"}, received())
+}
+
+func TestPackets(t *testing.T) {
+	conn, received := server(t)
+	c, err := New(conn.LocalAddr().String(), "", false, nil)
+	require.NoError(t, err)
+	defer func() { _ = c.Close() }()
+	for i := 0; i < 200; i++ {
+		c.Count("tunnel.a_long_tunnel_name.connections", 1)
+	}
+	require.NoError(t, c.Flush())
+	packets := received()
+	assert.Greater(t, len(packets), 1)
+	lines := 0
+	for _, p := range packets {
+		assert.LessOrEqual(t, len(p), maxPacket)
+		lines += len(strings.Split(p, "\n"))
+	}
+	assert.Equal(t, 200, lines)
+	require.NoError(t, c.Flush())
+	assert.Empty(t, received(), "nothing is sent twice")
+}
+
+func TestSanitize(t *testing.T) {
+	assert.Equal(t, "db_primary_eu-west", Sanitize("db primary.eu-west"))
+	assert.Equal(t, "a_b_c", Sanitize("a:b|c"))
+}
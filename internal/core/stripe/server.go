@@ -0,0 +1,145 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package stripe
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Server is the far end of striped connections, gathering the streams of each
+// session and connecting on to the target the session names
+type Server struct {
+	// Dial connects to a session's target
+	Dial func(target string) (net.Conn, error)
+	// Timeout bounds how long a session's streams have to arrive
+	Timeout time.Duration
+	// Joined is told of each session once its target is connected to, or not
+	Joined func(target string, streams int, err error)
+
+	lock     sync.Mutex
+	sessions map[Session]*gathering
+}
+
+// gathering holds the streams of a session as they arrive
+type gathering struct {
+	target  string
+	streams []net.Conn
+	arrived int
+	timer   *time.Timer
+}
+
+// Serve accepts streams until the listener is closed
+func (s *Server) Serve(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.gather(conn)
+	}
+}
+
+func (s *Server) gather(conn net.Conn) {
+	_ = conn.SetReadDeadline(time.Now().Add(s.Timeout))
+	h, err := ReadHello(conn)
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+
+	s.lock.Lock()
+	if s.sessions == nil {
+		s.sessions = map[Session]*gathering{}
+	}
+	g, ok := s.sessions[h.Session]
+	if !ok {
+		g = &gathering{target: h.Target, streams: make([]net.Conn, h.Count)}
+		g.timer = time.AfterFunc(s.Timeout, func() { s.abandon(h.Session, g) })
+		s.sessions[h.Session] = g
+	}
+	if h.Count != len(g.streams) || h.Target != g.target || g.streams[h.Index] != nil {
+		s.lock.Unlock()
+		_ = conn.Close()
+		return
+	}
+	g.streams[h.Index] = conn
+	g.arrived++
+	complete := g.arrived == len(g.streams)
+	if complete {
+		g.timer.Stop()
+		delete(s.sessions, h.Session)
+	}
+	s.lock.Unlock()
+	if complete {
+		s.join(g)
+	}
+}
+
+// abandon closes the streams of a session not all of whose streams arrived
+func (s *Server) abandon(session Session, g *gathering) {
+	s.lock.Lock()
+	if s.sessions[session] != g {
+		s.lock.Unlock()
+		return
+	}
+	delete(s.sessions, session)
+	s.lock.Unlock()
+	for _, stream := range g.streams {
+		if stream != nil {
+			_ = WriteStatus(stream, fmt.Errorf("%d of %d streams arrived within %v", g.arrived, len(g.streams), s.Timeout))
+			_ = stream.Close()
+		}
+	}
+}
+
+func (s *Server) join(g *gathering) {
+	target, err := s.Dial(g.target)
+	if s.Joined != nil {
+		s.Joined(g.target, len(g.streams), err)
+	}
+	for _, stream := range g.streams {
+		if werr := WriteStatus(stream, err); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	if err != nil {
+		if target != nil {
+			_ = target.Close()
+		}
+		closeAll(g.streams)
+		return
+	}
+	Pipe(NewConn(g.streams), target)
+}
+
+// Pipe copies between the connections until both directions end, passing on
+// the end of each with CloseWrite where the connection has it
+func Pipe(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+	copyTo := func(dst, src net.Conn) {
+		_, _ = io.Copy(dst, src)
+		if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+			_ = cw.CloseWrite()
+		} else {
+			_ = dst.Close()
+		}
+		done <- struct{}{}
+	}
+	go copyTo(a, b)
+	go copyTo(b, a)
+	<-done
+	<-done
+	_ = a.Close()
+	_ = b.Close()
+}
@@ -0,0 +1,448 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+// Package stripe spreads one connection across several streams, each an ssh
+// channel of its own, and reassembles it at the far end, so a connection is
+// not held to the throughput of a single channel's window.  Data is cut into
+// numbered frames sent on whichever stream is free, and put back in order as
+// they arrive
+package stripe
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// MaxStreams is the most streams a connection may be spread across
+	MaxStreams = 32
+
+	magic   = "ASHS"
+	version = 1
+
+	// frameSize is the most data sent in one frame
+	frameSize = 64 * 1024
+	// frameHeader holds a frame's sequence number and length, a length of
+	// zero ending the data sent that way
+	frameHeader = 12
+	// framesAhead is how many frames beyond the next due may be held waiting
+	// for it before the streams they arrive on are no longer read
+	framesAhead = 4 * MaxStreams
+	// flushTimeout is how long Close waits for the frames sent before
+	// CloseWrite to be written
+	flushTimeout = 5 * time.Second
+
+	statusOK     = 0
+	statusFailed = 1
+)
+
+// Session names the streams of one connection, so the far end can gather them
+type Session [16]byte
+
+// Hello opens each stream, naming its session, its place among the session's
+// Count streams and the Target the far end connects on to
+type Hello struct {
+	Session Session
+	Index   int
+	Count   int
+	Target  string
+}
+
+func NewSession() (Session, error) {
+	var s Session
+	_, err := rand.Read(s[:])
+	return s, err
+}
+
+func writeHello(w io.Writer, h Hello) error {
+	if len(h.Target) > 0xffff {
+		return fmt.Errorf("target (%.20s...) too long", h.Target)
+	}
+	bs := make([]byte, 0, len(magic)+1+len(h.Session)+4+len(h.Target))
+	bs = append(bs, magic...)
+	bs = append(bs, version)
+	bs = append(bs, h.Session[:]...)
+	bs = append(bs, byte(h.Index), byte(h.Count))
+	bs = binary.BigEndian.AppendUint16(bs, uint16(len(h.Target)))
+	bs = append(bs, h.Target...)
+	_, err := w.Write(bs)
+	return err
+}
+
+func ReadHello(r io.Reader) (Hello, error) {
+	var h Hello
+	bs := make([]byte, len(magic)+1+len(h.Session)+4)
+	if _, err := io.ReadFull(r, bs); err != nil {
+		return h, err
+	}
+	if string(bs[:len(magic)]) != magic {
+		return h, errors.New("not a stripe stream")
+	}
+	bs = bs[len(magic):]
+	if bs[0] != version {
+		return h, fmt.Errorf("stripe version %d unsupported", bs[0])
+	}
+	bs = bs[1:]
+	copy(h.Session[:], bs)
+	bs = bs[len(h.Session):]
+	h.Index, h.Count = int(bs[0]), int(bs[1])
+	if h.Count < 1 || h.Count > MaxStreams || h.Index >= h.Count {
+		return h, fmt.Errorf("stream %d of %d out of range", h.Index, h.Count)
+	}
+	target := make([]byte, binary.BigEndian.Uint16(bs[2:]))
+	if _, err := io.ReadFull(r, target); err != nil {
+		return h, err
+	}
+	h.Target = string(target)
+	return h, nil
+}
+
+// WriteStatus answers each stream's hello once the session's target has been
+// connected to, or with the reason it could not be
+func WriteStatus(w io.Writer, err error) error {
+	if err == nil {
+		_, werr := w.Write([]byte{statusOK})
+		return werr
+	}
+	reason := err.Error()
+	if len(reason) > 0xff {
+		reason = reason[:0xff]
+	}
+	_, werr := w.Write(append([]byte{statusFailed, byte(len(reason))}, reason...))
+	return werr
+}
+
+func readStatus(r io.Reader) error {
+	bs := make([]byte, 2)
+	if _, err := io.ReadFull(r, bs[:1]); err != nil {
+		return err
+	}
+	if bs[0] == statusOK {
+		return nil
+	}
+	if _, err := io.ReadFull(r, bs[1:]); err != nil {
+		return err
+	}
+	reason := make([]byte, bs[1])
+	if _, err := io.ReadFull(r, reason); err != nil {
+		return err
+	}
+	return errors.New(string(reason))
+}
+
+// Dial opens a session across the streams for the far end to connect on to
+// the target, closing the streams should it not answer within the timeout
+func Dial(streams []net.Conn, target string, timeout time.Duration) (*Conn, error) {
+	if len(streams) < 1 || len(streams) > MaxStreams {
+		return nil, fmt.Errorf("%d streams out of range", len(streams))
+	}
+	session, err := NewSession()
+	if err != nil {
+		return nil, err
+	}
+	timer := time.AfterFunc(timeout, func() { closeAll(streams) })
+	for i, stream := range streams {
+		if err = writeHello(stream, Hello{Session: session, Index: i, Count: len(streams), Target: target}); err != nil {
+			break
+		}
+	}
+	for _, stream := range streams {
+		if err != nil {
+			break
+		}
+		err = readStatus(stream)
+	}
+	if !timer.Stop() {
+		err = fmt.Errorf("no answer within %v", timeout)
+	}
+	if err != nil {
+		closeAll(streams)
+		return nil, err
+	}
+	return NewConn(streams), nil
+}
+
+func closeAll(streams []net.Conn) {
+	for _, stream := range streams {
+		_ = stream.Close()
+	}
+}
+
+type frame struct {
+	seq  uint64
+	data []byte
+}
+
+// Conn is a connection spread across streams.  Its Write cuts data into
+// frames sent on whichever stream is free, while its Read puts the frames
+// arriving on every stream back in order
+type Conn struct {
+	streams []net.Conn
+	done    chan struct{}
+	once    sync.Once
+	werr    error
+
+	// Guards the sending side
+	wlock   sync.Mutex
+	frames  chan frame
+	nextOut uint64
+	ended   atomic.Bool
+	flushed chan struct{}
+
+	// Guards the receiving side
+	lock    sync.Mutex
+	arrived *sync.Cond
+	pending map[uint64][]byte
+	nextIn  uint64
+	buf     []byte
+	eof     bool
+	rerr    error
+	// finished counts the streams the far end has closed
+	finished int
+}
+
+// NewConn joins the streams of a session whose hellos have been exchanged,
+// in the order of their indexes
+func NewConn(streams []net.Conn) *Conn {
+	c := &Conn{
+		streams: streams,
+		done:    make(chan struct{}),
+		frames:  make(chan frame, len(streams)),
+		flushed: make(chan struct{}),
+		pending: map[uint64][]byte{},
+	}
+	c.arrived = sync.NewCond(&c.lock)
+	senders := &sync.WaitGroup{}
+	for _, stream := range streams {
+		senders.Add(1)
+		go c.send(stream, senders)
+		go c.receive(stream)
+	}
+	go func() {
+		senders.Wait()
+		close(c.flushed)
+	}()
+	return c
+}
+
+func (c *Conn) Write(p []byte) (int, error) {
+	c.wlock.Lock()
+	defer c.wlock.Unlock()
+	if c.ended.Load() {
+		return 0, net.ErrClosed
+	}
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), frameSize)
+		if err := c.enqueue(append([]byte(nil), p[:n]...)); err != nil {
+			return written, err
+		}
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// CloseWrite ends the data sent, the far end reading it to the end before
+// reading io.EOF
+func (c *Conn) CloseWrite() error {
+	c.wlock.Lock()
+	defer c.wlock.Unlock()
+	if c.ended.Load() {
+		return nil
+	}
+	err := c.enqueue(nil)
+	c.ended.Store(true)
+	close(c.frames)
+	return err
+}
+
+// enqueue numbers the frame and hands it to the first free stream.  Must be
+// called holding wlock
+func (c *Conn) enqueue(data []byte) error {
+	select {
+	case <-c.done:
+		return c.werr
+	default:
+	}
+	select {
+	case c.frames <- frame{seq: c.nextOut, data: data}:
+		c.nextOut++
+		return nil
+	case <-c.done:
+		return c.werr
+	}
+}
+
+func (c *Conn) send(stream net.Conn, senders *sync.WaitGroup) {
+	defer senders.Done()
+	header := make([]byte, frameHeader)
+	for {
+		var f frame
+		var ok bool
+		select {
+		case f, ok = <-c.frames:
+			if !ok {
+				return
+			}
+		case <-c.done:
+			return
+		}
+		binary.BigEndian.PutUint64(header, f.seq)
+		binary.BigEndian.PutUint32(header[8:], uint32(len(f.data)))
+		_, err := stream.Write(header)
+		if err == nil && len(f.data) > 0 {
+			_, err = stream.Write(f.data)
+		}
+		if err != nil {
+			c.fail(err)
+			return
+		}
+	}
+}
+
+func (c *Conn) receive(stream net.Conn) {
+	header := make([]byte, frameHeader)
+	for {
+		if _, err := io.ReadFull(stream, header); err != nil {
+			c.fail(err)
+			return
+		}
+		seq := binary.BigEndian.Uint64(header)
+		length := binary.BigEndian.Uint32(header[8:])
+		if length > frameSize {
+			c.fail(fmt.Errorf("frame of %d bytes exceeds %d", length, frameSize))
+			return
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(stream, data); err != nil {
+			c.fail(err)
+			return
+		}
+		c.lock.Lock()
+		for seq >= c.nextIn+framesAhead && c.rerr == nil {
+			c.arrived.Wait()
+		}
+		if c.rerr != nil {
+			c.lock.Unlock()
+			return
+		}
+		c.pending[seq] = data
+		c.arrived.Broadcast()
+		c.lock.Unlock()
+	}
+}
+
+func (c *Conn) Read(p []byte) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for len(c.buf) == 0 {
+		if c.eof {
+			return 0, io.EOF
+		}
+		if data, ok := c.pending[c.nextIn]; ok {
+			delete(c.pending, c.nextIn)
+			c.nextIn++
+			c.arrived.Broadcast()
+			c.buf, c.eof = data, len(data) == 0
+			continue
+		}
+		if c.rerr != nil {
+			return 0, c.rerr
+		}
+		c.arrived.Wait()
+	}
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+// fail closes the connection on an error a stream meets, the streams
+// carrying one connection being of no use apart.  A stream the far end closed
+// may only be the first of them, the others still to deliver their frames, so
+// only the last to close ends the connection
+func (c *Conn) fail(err error) {
+	c.lock.Lock()
+	if errors.Is(err, io.EOF) {
+		c.finished++
+		if c.finished < len(c.streams) {
+			c.lock.Unlock()
+			return
+		}
+		err = io.ErrUnexpectedEOF
+	}
+	if c.rerr == nil {
+		c.rerr = err
+	}
+	c.arrived.Broadcast()
+	c.lock.Unlock()
+	c.shutdown(err)
+}
+
+func (c *Conn) shutdown(err error) {
+	c.once.Do(func() {
+		c.werr = err
+		close(c.done)
+		closeAll(c.streams)
+	})
+}
+
+// Close waits briefly for the frames sent before CloseWrite to be written,
+// so closing a connection once its data has ended does not lose the last of it
+func (c *Conn) Close() error {
+	if c.ended.Load() {
+		timer := time.NewTimer(flushTimeout)
+		select {
+		case <-c.flushed:
+		case <-c.done:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+	c.lock.Lock()
+	if c.rerr == nil {
+		c.rerr = net.ErrClosed
+	}
+	c.arrived.Broadcast()
+	c.lock.Unlock()
+	c.shutdown(net.ErrClosed)
+	return nil
+}
+
+func (c *Conn) LocalAddr() net.Addr {
+	return c.streams[0].LocalAddr()
+}
+
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.streams[0].RemoteAddr()
+}
+
+func (c *Conn) SetDeadline(t time.Time) error {
+	return c.each(func(stream net.Conn) error { return stream.SetDeadline(t) })
+}
+
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.each(func(stream net.Conn) error { return stream.SetReadDeadline(t) })
+}
+
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.each(func(stream net.Conn) error { return stream.SetWriteDeadline(t) })
+}
+
+func (c *Conn) each(fn func(stream net.Conn) error) error {
+	var first error
+	for _, stream := range c.streams {
+		if err := fn(stream); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,178 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package stripe
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func pairs(n int) ([]net.Conn, []net.Conn) {
+	near, far := make([]net.Conn, n), make([]net.Conn, n)
+	for i := range near {
+		near[i], far[i] = net.Pipe()
+	}
+	return near, far
+}
+
+func TestHello(t *testing.T) {
+	var b bytes.Buffer
+	session, err := NewSession()
+	require.NoError(t, err)
+	hello := Hello{Session: session, Index: 2, Count: 3, Target: "db.internal:5432"}
+	require.NoError(t, writeHello(&b, hello))
+	read, err := ReadHello(&b)
+	require.NoError(t, err)
+	assert.Equal(t, hello, read)
+
+	_, err = ReadHello(bytes.NewReader([]byte("HTTP/1.1 200 OK\r\n\r\n0123456789")))
+	assert.EqualError(t, err, "not a stripe stream")
+
+	b.Reset()
+	require.NoError(t, writeHello(&b, Hello{Session: session, Index: 3, Count: 3}))
+	_, err = ReadHello(&b)
+	assert.EqualError(t, err, "stream 3 of 3 out of range")
+}
+
+func TestStatus(t *testing.T) {
+	var b bytes.Buffer
+	require.NoError(t, WriteStatus(&b, nil))
+	require.NoError(t, WriteStatus(&b, errors.New("connection refused")))
+	assert.NoError(t, readStatus(&b))
+	assert.EqualError(t, readStatus(&b), "connection refused")
+}
+
+func TestConnReassembles(t *testing.T) {
+	near, far := pairs(4)
+	sender, receiver := NewConn(near), NewConn(far)
+	defer func() { _ = sender.Close() }()
+	defer func() { _ = receiver.Close() }()
+
+	data := make([]byte, 3*1024*1024+17)
+	_, _ = rand.Read(data)
+	go func() {
+		_, _ = sender.Write(data)
+		_ = sender.CloseWrite()
+	}()
+	received, err := io.ReadAll(receiver)
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(data, received), "received data differs")
+}
+
+func TestConnBothWays(t *testing.T) {
+	near, far := pairs(3)
+	a, b := NewConn(near), NewConn(far)
+	defer func() { _ = a.Close() }()
+	defer func() { _ = b.Close() }()
+
+	go func() {
+		_, _ = a.Write([]byte("ping"))
+		_ = a.CloseWrite()
+	}()
+	got, err := io.ReadAll(b)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(got))
+
+	go func() {
+		_, _ = b.Write([]byte("pong"))
+		_ = b.CloseWrite()
+	}()
+	got, err = io.ReadAll(a)
+	require.NoError(t, err)
+	assert.Equal(t, "pong", string(got))
+}
+
+func TestConnStreamLost(t *testing.T) {
+	near, far := pairs(2)
+	a, b := NewConn(near), NewConn(far)
+	defer func() { _ = a.Close() }()
+	_ = far[1].Close()
+	_ = b.Close()
+	_, err := io.ReadAll(a)
+	assert.Error(t, err)
+	_, err = a.Write([]byte("lost"))
+	assert.Error(t, err)
+}
+
+func TestServer(t *testing.T) {
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = backend.Close() }()
+	go func() {
+		conn, err := backend.Accept()
+		if err != nil {
+			return
+		}
+		_, _ = io.Copy(conn, conn)
+		_ = conn.Close()
+	}()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = ln.Close() }()
+	server := &Server{
+		Timeout: time.Second,
+		Dial:    func(target string) (net.Conn, error) { return net.Dial("tcp", target) },
+	}
+	go func() { _ = server.Serve(ln) }()
+
+	streams := make([]net.Conn, 3)
+	for i := range streams {
+		streams[i], err = net.Dial("tcp", ln.Addr().String())
+		require.NoError(t, err)
+	}
+	conn, err := Dial(streams, backend.Addr().String(), time.Second)
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+	data := bytes.Repeat([]byte("striped "), 100_000)
+	go func() {
+		_, _ = conn.Write(data)
+		_ = conn.CloseWrite()
+	}()
+	echoed, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(data, echoed), "echoed data differs")
+}
+
+func TestServerTargetRefused(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = ln.Close() }()
+	server := &Server{
+		Timeout: time.Second,
+		Dial:    func(target string) (net.Conn, error) { return nil, errors.New("refused") },
+	}
+	go func() { _ = server.Serve(ln) }()
+
+	stream, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	_, err = Dial([]net.Conn{stream}, "nowhere:1", time.Second)
+	assert.EqualError(t, err, "refused")
+}
+
+func TestServerIncompleteSession(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = ln.Close() }()
+	server := &Server{
+		Timeout: 100 * time.Millisecond,
+		Dial:    func(target string) (net.Conn, error) { return nil, errors.New("not reached") },
+	}
+	go func() { _ = server.Serve(ln) }()
+
+	stream, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	session, _ := NewSession()
+	require.NoError(t, writeHello(stream, Hello{Session: session, Index: 0, Count: 2, Target: "db:1"}))
+	assert.EqualError(t, readStatus(stream), "1 of 2 streams arrived within 100ms")
+}
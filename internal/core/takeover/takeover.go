@@ -0,0 +1,80 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package takeover
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/log"
+)
+
+var (
+	// exitTimeout is how long a previous instance is given to shut down before it is killed
+	exitTimeout = 10 * time.Second
+)
+
+// Port stops a previous auto-ssh instance listening on the port of address so
+// the caller can listen in its place. Processes that are not auto-ssh are left alone
+func Port(address string) error {
+	port, err := portOf(address)
+	if err != nil {
+		return err
+	}
+	pid, err := owner(port)
+	if err != nil {
+		return err
+	}
+	if pid == os.Getpid() {
+		return fmt.Errorf("port %d is already held by this process", port)
+	}
+	program, err := executable(pid)
+	if err != nil {
+		return fmt.Errorf("unable to identify process %d holding port %d: %v", pid, port, err)
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if filepath.Base(program) != filepath.Base(self) {
+		return fmt.Errorf("port %d is held by %s (pid %d) which is not auto-ssh", port, filepath.Base(program), pid)
+	}
+	log.Printf("  Warn  - taking over port %d from previous auto-ssh instance (pid %d)\n", port, pid)
+	return terminate(pid, exitTimeout)
+}
+
+// Owner describes the process listening on the port of address, such as
+// "sshd (pid 812)", or returns an empty string when it cannot be identified
+func Owner(address string) string {
+	port, err := portOf(address)
+	if err != nil {
+		return ""
+	}
+	pid, err := owner(port)
+	if err != nil {
+		return ""
+	}
+	program, err := executable(pid)
+	if err != nil {
+		return fmt.Sprintf("pid %d", pid)
+	}
+	return fmt.Sprintf("%s (pid %d)", filepath.Base(program), pid)
+}
+
+func portOf(address string) (int, error) {
+	_, p, err := net.SplitHostPort(address)
+	if err != nil {
+		return 0, err
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil || port <= 0 {
+		return 0, fmt.Errorf("invalid port (%s)", p)
+	}
+	return port, nil
+}
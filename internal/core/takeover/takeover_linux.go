@@ -0,0 +1,105 @@
+//go:build linux
+
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package takeover
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/log"
+)
+
+const (
+	tcpListen = "0A"
+)
+
+func owner(port int) (int, error) {
+	inodes := map[string]bool{}
+	for _, table := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		data, err := os.ReadFile(table)
+		if err != nil {
+			continue
+		}
+		for _, inode := range listeningInodes(data, port) {
+			inodes[inode] = true
+		}
+	}
+	if len(inodes) == 0 {
+		return 0, fmt.Errorf("no listener found on port %d", port)
+	}
+
+	procs, err := filepath.Glob("/proc/[0-9]*/fd/*")
+	if err != nil {
+		return 0, err
+	}
+	for _, fd := range procs {
+		link, err := os.Readlink(fd)
+		if err != nil || !strings.HasPrefix(link, "socket:[") {
+			continue
+		}
+		if inodes[strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")] {
+			return strconv.Atoi(strings.Split(fd, "/")[2])
+		}
+	}
+	return 0, fmt.Errorf("the process listening on port %d cannot be found", port)
+}
+
+// listeningInodes returns the socket inodes from a /proc/net/tcp table that are listening on port
+func listeningInodes(data []byte, port int) []string {
+	var inodes []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Scan() // Header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[3] != tcpListen {
+			continue
+		}
+		index := strings.LastIndex(fields[1], ":")
+		if index < 0 {
+			continue
+		}
+		if p, err := strconv.ParseInt(fields[1][index+1:], 16, 32); err == nil && int(p) == port && fields[9] != "0" {
+			inodes = append(inodes, fields[9])
+		}
+	}
+	return inodes
+}
+
+func executable(pid int) (string, error) {
+	path, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+	if err != nil {
+		return "", err
+	}
+	// An executable replaced on disk since the process started is reported as deleted
+	return strings.TrimSuffix(path, " (deleted)"), nil
+}
+
+func terminate(pid int, timeout time.Duration) error {
+	if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if syscall.Kill(pid, 0) != nil {
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	log.Printf("  Warn  - previous auto-ssh instance (pid %d) did not exit within %s. Killing\n", pid, timeout)
+	if err := syscall.Kill(pid, syscall.SIGKILL); err != nil && !errors.Is(err, syscall.ESRCH) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+//go:build linux
+
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package takeover
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const table = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 0100007F:1F99 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1234 1 0000000000000000 100 0 0 10 0
+   1: 00000000:1F99 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 5678 1 0000000000000000 100 0 0 10 0
+   2: 0100007F:1F99 0100007F:D2F0 01 00000000:00000000 00:00000000 00000000     0        0 9999 1 0000000000000000 20 4 30 10 -1
+   3: 0100007F:0016 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 4321 1 0000000000000000 100 0 0 10 0
+`
+
+func TestListeningInodes(t *testing.T) {
+	tests := map[string]struct {
+		port     int
+		expected []string
+	}{
+		"listening": {port: 8089, expected: []string{"1234", "5678"}},
+		"ssh":       {port: 22, expected: []string{"4321"}},
+		"none":      {port: 9000, expected: nil},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			assert.Equal(tt, test.expected, listeningInodes([]byte(table), test.port))
+		})
+	}
+}
@@ -0,0 +1,26 @@
+//go:build !linux
+
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package takeover
+
+import (
+	"errors"
+	"time"
+)
+
+var errUnsupported = errors.New("taking over a port is not supported on this platform")
+
+func owner(_ int) (int, error) {
+	return 0, errUnsupported
+}
+
+func executable(_ int) (string, error) {
+	return "", errUnsupported
+}
+
+func terminate(_ int, _ time.Duration) error {
+	return errUnsupported
+}
@@ -0,0 +1,219 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+// Package tor reaches addresses through the SOCKS port of a local Tor, and
+// publishes onion services through its control port
+package tor
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+const onionSuffix = ".onion"
+
+// IsOnion reports whether the host is an onion address, reachable only
+// through Tor
+func IsOnion(host string) bool {
+	return strings.HasSuffix(strings.ToLower(strings.TrimSuffix(host, ".")), onionSuffix)
+}
+
+// Dial connects to the address through Tor's SOCKS port, Tor resolving the
+// address's name so it is not leaked to the local resolver
+func Dial(socks string, address string, timeout time.Duration) (net.Conn, error) {
+	dialer, err := proxy.SOCKS5("tcp", socks, nil, &net.Dialer{Timeout: timeout})
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	conn, err := dialer.(proxy.ContextDialer).DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("tor (%s) %w", socks, err)
+	}
+	return conn, nil
+}
+
+// Controller speaks Tor's control protocol.  Onion services added through it
+// last as long as its connection
+type Controller struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// Control connects to Tor's control port and authenticates with the password,
+// or without one, with the cookie Tor names or as Tor allows when it asks for
+// nothing
+func Control(address string, password string, timeout time.Duration) (*Controller, error) {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	c := newController(conn)
+	if err = c.authenticate(password); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return c, nil
+}
+
+func newController(conn net.Conn) *Controller {
+	return &Controller{conn: conn, reader: bufio.NewReader(conn)}
+}
+
+func (c *Controller) authenticate(password string) error {
+	lines, err := c.command("PROTOCOLINFO 1")
+	if err != nil {
+		return err
+	}
+	var methods []string
+	var cookieFile string
+	for _, line := range lines {
+		auth, ok := strings.CutPrefix(line, "AUTH ")
+		if !ok {
+			continue
+		}
+		for _, field := range fields(auth) {
+			if value, ok := strings.CutPrefix(field, "METHODS="); ok {
+				methods = strings.Split(value, ",")
+			} else if value, ok := strings.CutPrefix(field, "COOKIEFILE="); ok {
+				if cookieFile, err = strconv.Unquote(value); err != nil {
+					return fmt.Errorf("tor cookie file (%s) unreadable: %w", value, err)
+				}
+			}
+		}
+	}
+	has := func(method string) bool {
+		for _, m := range methods {
+			if m == method {
+				return true
+			}
+		}
+		return false
+	}
+	var credential string
+	switch {
+	case password != "":
+		if !has("HASHEDPASSWORD") {
+			return fmt.Errorf("tor does not accept a password, it accepts %s", strings.Join(methods, ", "))
+		}
+		credential = " " + strconv.Quote(password)
+	case has("NULL"):
+	case has("COOKIE") && cookieFile != "":
+		cookie, err := os.ReadFile(cookieFile)
+		if err != nil {
+			return fmt.Errorf("tor cookie %w", err)
+		}
+		credential = " " + hex.EncodeToString(cookie)
+	default:
+		return fmt.Errorf("tor requires a control password, it accepts %s", strings.Join(methods, ", "))
+	}
+	_, err = c.command("AUTHENTICATE" + credential)
+	return err
+}
+
+// AddOnion publishes an onion service forwarding its port to the target, an
+// ip:port, with the key given or, when blank, a new one, which is returned
+// with the service's id
+func (c *Controller) AddOnion(key string, port int, target string) (serviceID string, newKey string, err error) {
+	if key == "" {
+		key = "NEW:ED25519-V3"
+	}
+	lines, err := c.command(fmt.Sprintf("ADD_ONION %s Port=%d,%s", key, port, target))
+	if err != nil {
+		return "", "", err
+	}
+	for _, line := range lines {
+		if value, ok := strings.CutPrefix(line, "ServiceID="); ok {
+			serviceID = value
+		} else if value, ok := strings.CutPrefix(line, "PrivateKey="); ok {
+			newKey = value
+		}
+	}
+	if serviceID == "" {
+		return "", "", errors.New("tor returned no service id")
+	}
+	return serviceID, newKey, nil
+}
+
+// Wait blocks until the connection to Tor is lost or closed, taking its
+// onion services with it
+func (c *Controller) Wait() error {
+	for {
+		if _, err := c.reader.ReadString('\n'); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Controller) Close() error {
+	return c.conn.Close()
+}
+
+// command sends a command and returns the lines of a successful reply,
+// without their status codes
+func (c *Controller) command(cmd string) ([]string, error) {
+	if _, err := fmt.Fprintf(c.conn, "%s\r\n", cmd); err != nil {
+		return nil, err
+	}
+	var lines []string
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if len(line) < 4 {
+			return nil, fmt.Errorf("tor replied %q", line)
+		}
+		code, separator, text := line[:3], line[3], line[4:]
+		if code != "250" {
+			return nil, fmt.Errorf("tor refused %s: %s %s", strings.Fields(cmd)[0], code, text)
+		}
+		lines = append(lines, text)
+		if separator == ' ' {
+			return lines, nil
+		}
+	}
+}
+
+// fields splits a reply line on spaces outside quotes
+func fields(s string) []string {
+	var out []string
+	var b strings.Builder
+	quoted, escaped := false, false
+	for _, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\' && quoted:
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+		case r == ' ' && !quoted:
+			if b.Len() > 0 {
+				out = append(out, b.String())
+				b.Reset()
+			}
+			continue
+		}
+		b.WriteRune(r)
+	}
+	if b.Len() > 0 {
+		out = append(out, b.String())
+	}
+	return out
+}
@@ -0,0 +1,109 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package tor
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTor answers each command it is sent with the reply given for it,
+// recording the commands
+func fakeTor(t *testing.T, replies map[string]string) (*Controller, *[]string) {
+	client, server := net.Pipe()
+	t.Cleanup(func() { _ = client.Close() })
+	received := &[]string{}
+	go func() {
+		reader := bufio.NewReader(server)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.TrimRight(line, "\r\n")
+			*received = append(*received, cmd)
+			reply, ok := replies[strings.Fields(cmd)[0]]
+			if !ok {
+				reply = "510 Unrecognized command\r\n"
+			}
+			if _, err = server.Write([]byte(reply)); err != nil {
+				return
+			}
+		}
+	}()
+	return newController(client), received
+}
+
+func TestIsOnion(t *testing.T) {
+	assert.True(t, IsOnion("duskgytldkxiuqc6.onion"))
+	assert.True(t, IsOnion("Example.ONION."))
+	assert.False(t, IsOnion("onion.example.com"))
+	assert.False(t, IsOnion("127.0.0.1"))
+}
+
+func TestAuthenticateNull(t *testing.T) {
+	c, received := fakeTor(t, map[string]string{
+		"PROTOCOLINFO": "250-PROTOCOLINFO 1\r\n250-AUTH METHODS=NULL\r\n250-VERSION Tor=\"0.4.8.10\"\r\n250 OK\r\n",
+		"AUTHENTICATE": "250 OK\r\n",
+	})
+	require.NoError(t, c.authenticate(""))
+	assert.Equal(t, []string{"PROTOCOLINFO 1", "AUTHENTICATE"}, *received)
+}
+
+func TestAuthenticatePassword(t *testing.T) {
+	c, received := fakeTor(t, map[string]string{
+		"PROTOCOLINFO": "250-PROTOCOLINFO 1\r\n250-AUTH METHODS=HASHEDPASSWORD\r\n250 OK\r\n",
+		"AUTHENTICATE": "250 OK\r\n",
+	})
+	require.NoError(t, c.authenticate(`pa"ss`))
+	assert.Equal(t, `AUTHENTICATE "pa\"ss"`, (*received)[1])
+}
+
+func TestAuthenticateCookie(t *testing.T) {
+	cookie := filepath.Join(t.TempDir(), "control auth cookie")
+	require.NoError(t, os.WriteFile(cookie, []byte{0xde, 0xad, 0xbe, 0xef}, 0600))
+	c, received := fakeTor(t, map[string]string{
+		"PROTOCOLINFO": "250-PROTOCOLINFO 1\r\n250-AUTH METHODS=COOKIE,SAFECOOKIE COOKIEFILE=\"" + cookie + "\"\r\n250 OK\r\n",
+		"AUTHENTICATE": "250 OK\r\n",
+	})
+	require.NoError(t, c.authenticate(""))
+	assert.Equal(t, "AUTHENTICATE deadbeef", (*received)[1])
+}
+
+func TestAuthenticateRefused(t *testing.T) {
+	c, _ := fakeTor(t, map[string]string{
+		"PROTOCOLINFO": "250-PROTOCOLINFO 1\r\n250-AUTH METHODS=HASHEDPASSWORD\r\n250 OK\r\n",
+		"AUTHENTICATE": "515 Authentication failed: Password did not match HashedControlPassword value\r\n",
+	})
+	assert.EqualError(t, c.authenticate(""), "tor requires a control password, it accepts HASHEDPASSWORD")
+	assert.EqualError(t, c.authenticate("wrong"),
+		"tor refused AUTHENTICATE: 515 Authentication failed: Password did not match HashedControlPassword value")
+}
+
+func TestAddOnion(t *testing.T) {
+	c, received := fakeTor(t, map[string]string{
+		"ADD_ONION": "250-ServiceID=abcdefghijklmnop\r\n250-PrivateKey=ED25519-V3:a2V5\r\n250 OK\r\n",
+	})
+	id, key, err := c.AddOnion("", 80, "127.0.0.1:8080")
+	require.NoError(t, err)
+	assert.Equal(t, "abcdefghijklmnop", id)
+	assert.Equal(t, "ED25519-V3:a2V5", key)
+	assert.Equal(t, "ADD_ONION NEW:ED25519-V3 Port=80,127.0.0.1:8080", (*received)[0])
+
+	_, _, err = c.AddOnion("ED25519-V3:a2V5", 22, "127.0.0.1:22")
+	require.NoError(t, err)
+	assert.Equal(t, "ADD_ONION ED25519-V3:a2V5 Port=22,127.0.0.1:22", (*received)[1])
+}
+
+func TestFields(t *testing.T) {
+	assert.Equal(t, []string{`METHODS=COOKIE`, `COOKIEFILE="/run/tor/a b\"c"`}, fields(`METHODS=COOKIE  COOKIEFILE="/run/tor/a b\"c"`))
+}
@@ -0,0 +1,125 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+// Package totp generates the time-based one-time passwords of RFC 6238, as
+// shown by authenticator apps
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1" //nolint: gosec
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultDigits = 6
+	DefaultPeriod = 30 * time.Second
+)
+
+// Generator produces the codes of a secret
+type Generator struct {
+	key       []byte
+	digits    int
+	period    time.Duration
+	algorithm func() hash.Hash
+}
+
+// New returns the generator of a base32 secret, or of an otpauth:// uri whose
+// digits, period and algorithm take precedence over those given.  Zero digits
+// or period are the defaults
+func New(secret string, digits int, period time.Duration) (*Generator, error) {
+	g := &Generator{digits: digits, period: period, algorithm: sha1.New}
+	if strings.HasPrefix(secret, "otpauth://") {
+		u, err := url.Parse(secret)
+		if err != nil {
+			return nil, fmt.Errorf("otpauth uri cannot be parsed: %v", err)
+		}
+		query := u.Query()
+		secret = query.Get("secret")
+		if v := query.Get("digits"); v != "" {
+			if g.digits, err = strconv.Atoi(v); err != nil {
+				return nil, fmt.Errorf("otpauth uri digits (%s) must be a number", v)
+			}
+		}
+		if v := query.Get("period"); v != "" {
+			seconds, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("otpauth uri period (%s) must be a number", v)
+			}
+			g.period = time.Duration(seconds) * time.Second
+		}
+		switch strings.ToUpper(query.Get("algorithm")) {
+		case "", "SHA1":
+		case "SHA256":
+			g.algorithm = sha256.New
+		case "SHA512":
+			g.algorithm = sha512.New
+		default:
+			return nil, fmt.Errorf("otpauth uri algorithm (%s) is not supported", query.Get("algorithm"))
+		}
+	}
+	if g.digits == 0 {
+		g.digits = DefaultDigits
+	}
+	if g.period == 0 {
+		g.period = DefaultPeriod
+	}
+	if g.digits < 6 || g.digits > 10 {
+		return nil, fmt.Errorf("digits (%d) must be between 6 and 10", g.digits)
+	}
+	if g.period < time.Second {
+		return nil, fmt.Errorf("period (%s) must be at least a second", g.period)
+	}
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(secret, "="))
+	if err != nil {
+		return nil, fmt.Errorf("secret is not base32: %v", err)
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("secret is empty")
+	}
+	g.key = key
+	return g, nil
+}
+
+// Counter is the number of periods elapsed at the time
+func (g *Generator) Counter(t time.Time) uint64 {
+	return uint64(t.Unix() / int64(g.period/time.Second))
+}
+
+// Next is when the period following the time's begins
+func (g *Generator) Next(t time.Time) time.Time {
+	seconds := int64(g.period / time.Second)
+	return time.Unix((t.Unix()/seconds+1)*seconds, 0)
+}
+
+// Code returns the code for the counter
+func (g *Generator) Code(counter uint64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+	mac := hmac.New(g.algorithm, g.key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := uint64(binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff)
+	mod := uint64(1)
+	for range g.digits {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", g.digits, value%mod)
+}
+
+// Clear overwrites the secret
+func (g *Generator) Clear() {
+	clear(g.key)
+}
@@ -0,0 +1,44 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package totp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The RFC 6238 test vectors, the ascii seeds given in base32
+func TestCode(t *testing.T) {
+	tests := []struct {
+		uri  string
+		at   int64
+		code string
+	}{
+		{"otpauth://totp/t?digits=8&secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", 59, "94287082"},
+		{"otpauth://totp/t?digits=8&secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", 1111111109, "07081804"},
+		{"otpauth://totp/t?digits=8&algorithm=SHA256&secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZA", 59, "46119246"},
+		{"otpauth://totp/t?digits=8&algorithm=SHA512&secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNA", 59, "90693936"},
+	}
+	for _, test := range tests {
+		g, err := New(test.uri, 0, 0)
+		require.NoError(t, err)
+		assert.Equal(t, test.code, g.Code(g.Counter(time.Unix(test.at, 0))))
+	}
+}
+
+func TestSecret(t *testing.T) {
+	g, err := New("gezd gnbv gy3t qojq gezd gnbv gy3t qojq", 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "287082", g.Code(g.Counter(time.Unix(59, 0))))
+	assert.Equal(t, time.Unix(60, 0), g.Next(time.Unix(59, 0)))
+
+	_, err = New("not base32!", 0, 0)
+	assert.Error(t, err)
+	_, err = New("GEZDGNBV", 4, 0)
+	assert.Error(t, err)
+}
@@ -0,0 +1,165 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package traffic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/log"
+)
+
+// Totals are the cumulative traffic of a tunnel's closed connections since the
+// counters were created or last reset
+type Totals struct {
+	BytesIn     int64     `json:"bytesIn"`
+	BytesOut    int64     `json:"bytesOut"`
+	Connections int64     `json:"connections"`
+	Since       time.Time `json:"since"`
+}
+
+type store struct {
+	lock    sync.Mutex
+	file    string
+	tunnels map[string]*Totals
+	dirty   bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+var (
+	defaultStore = &store{tunnels: make(map[string]*Totals)}
+)
+
+// Open loads the totals kept in the state file, which is written back every
+// flush interval while the totals change and once more on Close.  An empty
+// filename keeps the totals in memory only
+func Open(filename string, flush time.Duration) error {
+	Close()
+	s := defaultStore
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.file = filename
+	if filename == "" {
+		return nil
+	}
+	bs, err := os.ReadFile(filename)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("traffic state (%s) cannot be read: %w", filename, err)
+	}
+	if len(bs) > 0 {
+		tunnels := make(map[string]*Totals)
+		if err = json.Unmarshal(bs, &tunnels); err != nil {
+			return fmt.Errorf("traffic state (%s) cannot be decoded: %w", filename, err)
+		}
+		s.tunnels = tunnels
+	}
+	s.stop, s.done = make(chan struct{}), make(chan struct{})
+	go s.flusher(flush, s.stop, s.done)
+	return nil
+}
+
+// Close writes the totals to the state file and stops flushing them
+func Close() {
+	s := defaultStore
+	s.lock.Lock()
+	stop, done := s.stop, s.done
+	s.stop, s.done = nil, nil
+	s.lock.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+// Add counts a closed connection of the tunnel and the bytes it carried
+func Add(tunnelId string, bytesIn int64, bytesOut int64) {
+	s := defaultStore
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	t := s.totals(tunnelId)
+	t.BytesIn += bytesIn
+	t.BytesOut += bytesOut
+	t.Connections++
+	s.dirty = true
+}
+
+// Get returns the totals of the tunnel
+func Get(tunnelId string) Totals {
+	s := defaultStore
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if t, ok := s.tunnels[tunnelId]; ok {
+		return *t
+	}
+	return Totals{}
+}
+
+// Reset zeroes the totals of the tunnels, or of every tunnel when none are given
+func Reset(tunnelIds ...string) {
+	s := defaultStore
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(tunnelIds) == 0 {
+		s.tunnels = make(map[string]*Totals)
+	}
+	for _, id := range tunnelIds {
+		delete(s.tunnels, id)
+	}
+	s.dirty = true
+}
+
+// totals returns the tunnel's totals, starting them if necessary.  Must be
+// called holding the lock
+func (s *store) totals(tunnelId string) *Totals {
+	t, ok := s.tunnels[tunnelId]
+	if !ok {
+		t = &Totals{Since: time.Now().UTC().Truncate(time.Second)}
+		s.tunnels[tunnelId] = t
+	}
+	return t
+}
+
+func (s *store) flusher(interval time.Duration, stop chan struct{}, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			s.save()
+			return
+		case <-ticker.C:
+			s.save()
+		}
+	}
+}
+
+// save replaces the state file with the current totals when they have changed
+func (s *store) save() {
+	s.lock.Lock()
+	if !s.dirty || s.file == "" {
+		s.lock.Unlock()
+		return
+	}
+	bs, err := json.MarshalIndent(s.tunnels, "", "  ")
+	file := s.file
+	s.dirty = false
+	s.lock.Unlock()
+	if err == nil {
+		tmp := filepath.Join(filepath.Dir(file), "."+filepath.Base(file)+".tmp")
+		if err = os.WriteFile(tmp, bs, 0600); err == nil {
+			err = os.Rename(tmp, file)
+		}
+	}
+	if err != nil {
+		log.Printf("  Error - traffic state (%s) cannot be written: %v\n", file, err)
+	}
+}
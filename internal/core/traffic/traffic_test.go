@@ -0,0 +1,42 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package traffic
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTotalsPersisted(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "traffic.json")
+
+	assert.NoError(t, Open(filename, time.Hour))
+	Add("one", 10, 20)
+	Add("one", 1, 2)
+	Add("two", 5, 0)
+	Close()
+
+	assert.NoError(t, Open(filename, time.Hour))
+	one := Get("one")
+	assert.Equal(t, int64(11), one.BytesIn)
+	assert.Equal(t, int64(22), one.BytesOut)
+	assert.Equal(t, int64(2), one.Connections)
+	assert.False(t, one.Since.IsZero())
+	assert.Equal(t, int64(1), Get("two").Connections)
+
+	Reset("one")
+	assert.Equal(t, Totals{}, Get("one"))
+	assert.Equal(t, int64(5), Get("two").BytesIn)
+	Close()
+
+	assert.NoError(t, Open(filename, time.Hour))
+	assert.Equal(t, int64(0), Get("one").Connections)
+	Reset()
+	assert.Equal(t, Totals{}, Get("two"))
+	Close()
+}
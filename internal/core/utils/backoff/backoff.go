@@ -0,0 +1,50 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package backoff
+
+import (
+	"context"
+	"time"
+)
+
+// Backoff hands out exponentially growing delays, doubling from initial up to max
+type Backoff struct {
+	initial time.Duration
+	max     time.Duration
+	next    time.Duration
+}
+
+func NewBackoff(initial, max time.Duration) *Backoff {
+	if max < initial {
+		max = initial
+	}
+	return &Backoff{initial: initial, max: max, next: initial}
+}
+
+// Next returns the delay to wait before the next attempt
+func (b *Backoff) Next() time.Duration {
+	delay := b.next
+	b.next *= 2
+	if b.next > b.max {
+		b.next = b.max
+	}
+	return delay
+}
+
+func (b *Backoff) Reset() {
+	b.next = b.initial
+}
+
+// Wait sleeps for the next delay, returning false if the context ended first
+func (b *Backoff) Wait(ctx context.Context) bool {
+	timer := time.NewTimer(b.Next())
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
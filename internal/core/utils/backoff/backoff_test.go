@@ -0,0 +1,45 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package backoff
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNext(t *testing.T) {
+	tests := map[string]struct {
+		initial  time.Duration
+		max      time.Duration
+		expected []time.Duration
+	}{
+		"doubles": {initial: time.Second, max: time.Minute, expected: []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second}},
+		"capped":  {initial: time.Second, max: 3 * time.Second, expected: []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second}},
+		"fixed":   {initial: time.Second, max: 0, expected: []time.Duration{time.Second, time.Second}},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			b := NewBackoff(test.initial, test.max)
+			for _, expected := range test.expected {
+				assert.Equal(tt, expected, b.Next())
+			}
+			b.Reset()
+			assert.Equal(tt, test.initial, b.Next())
+		})
+	}
+}
+
+func TestWait(t *testing.T) {
+	b := NewBackoff(time.Millisecond, time.Millisecond)
+	assert.True(t, b.Wait(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	b = NewBackoff(time.Hour, time.Hour)
+	assert.False(t, b.Wait(ctx))
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package ratelimit
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often clients that have fallen quiet are forgotten
+const sweepInterval = time.Minute
+
+// Limiter limits how often, and how many at once, each key is allowed: rate a
+// second after a burst, with a bucket of tokens refilling at rate, and
+// concurrent until as many are done.  A rate or concurrent of zero is unlimited
+type Limiter struct {
+	lock       sync.Mutex
+	rate       float64
+	burst      float64
+	concurrent int
+	keys       map[string]*bucket
+	swept      time.Time
+	now        func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	open   int
+}
+
+func New(rate float64, burst, concurrent int) *Limiter {
+	return &Limiter{
+		rate:       rate,
+		burst:      float64(max(burst, 1)),
+		concurrent: concurrent,
+		keys:       make(map[string]*bucket),
+		now:        time.Now,
+	}
+}
+
+// Allow takes one of the key's allowance, explaining why not once it is spent.
+// Each one allowed must be followed by Done
+func (l *Limiter) Allow(key string) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := l.now()
+	l.sweep(now)
+	b, ok := l.keys[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.keys[key] = b
+	}
+	b.refill(now, l.rate, l.burst)
+	if l.concurrent > 0 && b.open >= l.concurrent {
+		return fmt.Errorf("more than %d connections at once", l.concurrent)
+	}
+	if l.rate > 0 {
+		if b.tokens < 1 {
+			return fmt.Errorf("more than %g connections a second", l.rate)
+		}
+		b.tokens--
+	}
+	b.open++
+	return nil
+}
+
+// Done returns one allowed by Allow, once finished with
+func (l *Limiter) Done(key string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if b, ok := l.keys[key]; ok && b.open > 0 {
+		b.open--
+	}
+}
+
+func (b *bucket) refill(now time.Time, rate, burst float64) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = min(burst, b.tokens+elapsed*rate)
+	}
+	b.last = now
+}
+
+// sweep forgets keys with nothing open and their allowance back in full, so
+// the clients tracked do not grow without bound
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < sweepInterval {
+		return
+	}
+	l.swept = now
+	for key, b := range l.keys {
+		b.refill(now, l.rate, l.burst)
+		if b.open == 0 && (l.rate == 0 || b.tokens >= l.burst) {
+			delete(l.keys, key)
+		}
+	}
+}
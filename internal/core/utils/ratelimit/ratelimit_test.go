@@ -0,0 +1,57 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRate(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := New(2, 3, 0)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, l.Allow("a"))
+	}
+	assert.Error(t, l.Allow("a"))
+	assert.NoError(t, l.Allow("b"), "each key has its own allowance")
+
+	now = now.Add(500 * time.Millisecond)
+	assert.NoError(t, l.Allow("a"))
+	assert.Error(t, l.Allow("a"))
+
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, l.Allow("a"), "refilled no further than the burst")
+	}
+	assert.Error(t, l.Allow("a"))
+}
+
+func TestConcurrent(t *testing.T) {
+	l := New(0, 0, 2)
+	assert.NoError(t, l.Allow("a"))
+	assert.NoError(t, l.Allow("a"))
+	assert.Error(t, l.Allow("a"))
+	l.Done("a")
+	assert.NoError(t, l.Allow("a"))
+}
+
+func TestSweep(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := New(1, 1, 0)
+	l.now = func() time.Time { return now }
+	assert.NoError(t, l.Allow("a"))
+	assert.NoError(t, l.Allow("b"))
+	l.Done("a")
+
+	now = now.Add(2 * sweepInterval)
+	assert.NoError(t, l.Allow("c"))
+	assert.NotContains(t, l.keys, "a")
+	assert.Contains(t, l.keys, "b", "still open")
+}
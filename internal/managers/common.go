@@ -71,3 +71,11 @@ func ExtractTunnelOptions(opts []models.TunnelOptionFunc) *models.TunnelOptions
 	}
 	return options
 }
+
+func ExtractStatusOptions(opts []models.StatusOptionFunc) *models.StatusOptions {
+	options := &models.StatusOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
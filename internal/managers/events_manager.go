@@ -0,0 +1,73 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package managers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"us.figge.auto-ssh/internal/core/events"
+	managerModels "us.figge.auto-ssh/internal/rest/models"
+)
+
+// watchBuffer is the number of events held for a watcher that is slow to read
+// them before they are dropped
+const watchBuffer = 64
+
+var (
+	ErrInvalidEventKind = fmt.Errorf("event kind invalid")
+
+	eventKinds = []string{events.KindTunnel, events.KindHost, events.KindConnection}
+)
+
+type EventsManager struct {
+}
+
+func NewEventsManager(ctx context.Context) (*EventsManager, error) {
+	return &EventsManager{}, nil
+}
+
+// WatchEvents subscribes to the events matching the input, handing them on
+// until the context is done
+func (m *EventsManager) WatchEvents(
+	ctx context.Context,
+	input *managerModels.WatchEventsInput,
+) (*managerModels.WatchEventsOutput, error) {
+	for _, kind := range input.Kinds {
+		if !slices.Contains(eventKinds, kind) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidEventKind, kind)
+		}
+	}
+	sub := events.Subscribe(watchBuffer)
+	out := make(chan events.Event)
+	go func() {
+		defer close(out)
+		defer events.Unsubscribe(sub)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e := <-sub.C:
+				if !wanted(input, e) {
+					continue
+				}
+				select {
+				case out <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return &managerModels.WatchEventsOutput{Events: out}, nil
+}
+
+func wanted(input *managerModels.WatchEventsInput, e events.Event) bool {
+	if len(input.Kinds) > 0 && !slices.Contains(input.Kinds, e.Kind) {
+		return false
+	}
+	return len(input.Ids) == 0 || slices.Contains(input.Ids, e.Id) || slices.Contains(input.Ids, e.Name)
+}
@@ -0,0 +1,150 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package managers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/config"
+	engineModels "us.figge.auto-ssh/internal/resources/models"
+	managerModels "us.figge.auto-ssh/internal/rest/models"
+)
+
+// HealthManager checks the required tunnels.  auto-ssh is ready while every one
+// of them is started, and healthy until one has been down longer than the grace
+type HealthManager struct {
+	cfg       *config.Health
+	hosts     engineModels.HostEngine
+	tunnels   engineModels.TunnelEngine
+	downSince map[string]time.Time
+	lock      sync.Mutex
+}
+
+func NewHealthManager(
+	ctx context.Context, cfg *config.Health, hosts engineModels.HostEngine, tunnels engineModels.TunnelEngine,
+) (*HealthManager, error) {
+	manager := &HealthManager{
+		cfg:       cfg,
+		hosts:     hosts,
+		tunnels:   tunnels,
+		downSince: make(map[string]time.Time),
+	}
+	return manager, nil
+}
+
+func (m *HealthManager) GetHealth(ctx context.Context) (*managerModels.GetHealthOutput, error) {
+	now := time.Now()
+	grace := m.cfg.GraceOrDefault()
+	output := m.check(now)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	output.Ok = true
+	for _, check := range output.Checks {
+		if check.Ok {
+			continue
+		}
+		if down := now.Sub(m.downSince[check.Id]); down < grace {
+			check.Ok = true
+			check.Reason = fmt.Sprintf("%s for %v", check.Reason, down.Truncate(time.Second))
+			continue
+		}
+		output.Ok = false
+	}
+	return output, nil
+}
+
+func (m *HealthManager) GetReadiness(ctx context.Context) (*managerModels.GetHealthOutput, error) {
+	output := m.check(time.Now())
+	output.Ok = true
+	for _, check := range output.Checks {
+		output.Ok = output.Ok && check.Ok
+	}
+	return output, nil
+}
+
+// check tests each required tunnel, noting when those down were first seen down
+func (m *HealthManager) check(now time.Time) *managerModels.GetHealthOutput {
+	output := &managerModels.GetHealthOutput{Checks: []*managerModels.HealthCheck{}}
+	for _, required := range m.required(now) {
+		check := &managerModels.HealthCheck{Id: required.id, Name: required.id}
+		if required.tunnel != nil {
+			check.Name = required.tunnel.Name()
+			check.Reason = m.reason(required.tunnel)
+		} else {
+			check.Reason = "not configured"
+		}
+		check.Ok = check.Reason == ""
+		output.Checks = append(output.Checks, check)
+	}
+	sort.Slice(output.Checks, func(i, j int) bool { return output.Checks[i].Id < output.Checks[j].Id })
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	down := make(map[string]time.Time)
+	for _, check := range output.Checks {
+		if check.Ok {
+			continue
+		}
+		since, ok := m.downSince[check.Id]
+		if !ok {
+			since = now
+		}
+		down[check.Id] = since
+	}
+	m.downSince = down
+	return output
+}
+
+type requirement struct {
+	id     string
+	tunnel engineModels.Tunnel
+}
+
+// required returns the tunnels configured as required, or otherwise every
+// tunnel auto-ssh is expected to have started by itself
+func (m *HealthManager) required(now time.Time) []*requirement {
+	var requirements []*requirement
+	if m.cfg != nil && len(m.cfg.Require) > 0 {
+		tunnels := m.tunnels.Tunnels()
+		for _, id := range m.cfg.Require {
+			required := &requirement{id: id}
+			for _, tunnel := range tunnels {
+				if tunnel.Id() == id || tunnel.Name() == id {
+					required.id, required.tunnel = tunnel.Id(), tunnel
+					break
+				}
+			}
+			requirements = append(requirements, required)
+		}
+		return requirements
+	}
+	for _, tunnel := range m.tunnels.Tunnels() {
+		if tunnel.Valid() && tunnel.AutoStarts() && tunnel.InSchedule(now) {
+			requirements = append(requirements, &requirement{id: tunnel.Id(), tunnel: tunnel})
+		}
+	}
+	return requirements
+}
+
+// reason explains why the tunnel is not up, or is blank when it is
+func (m *HealthManager) reason(tunnel engineModels.Tunnel) string {
+	if !tunnel.Valid() {
+		return "invalid"
+	}
+	if running := tunnel.Running(); running != "Started" {
+		return running
+	}
+	if m.cfg == nil || !m.cfg.Hosts || tunnel.Host() == "" {
+		return ""
+	}
+	if host, ok := m.hosts.Host(tunnel.Host()); !ok || !host.Connected() {
+		return fmt.Sprintf("host (%s) not connected", tunnel.Host())
+	}
+	return ""
+}
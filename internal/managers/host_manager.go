@@ -76,6 +76,7 @@ func (m *HostManager) GetHost(
 			Identity:   host.Identity(),
 			KnownHosts: host.KnownHosts(),
 			JumpHost:   host.JumpHost(),
+			Algorithms: host.Algorithms(),
 			Metadata:   host.Metadata(),
 		},
 	}
@@ -0,0 +1,30 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package managers
+
+import (
+	"context"
+
+	"us.figge.auto-ssh/internal/core/killswitch"
+	managerModels "us.figge.auto-ssh/internal/rest/models"
+)
+
+type KillSwitchManager struct {
+}
+
+func NewKillSwitchManager(ctx context.Context) (*KillSwitchManager, error) {
+	return &KillSwitchManager{}, nil
+}
+
+// PullKillSwitch closes every tunnel and host connection, wipes the keys held
+// in memory and exits.  The switch is pulled once the request has returned,
+// the web server being the last to be shut down
+func (m *KillSwitchManager) PullKillSwitch(
+	ctx context.Context,
+	input *managerModels.PullKillSwitchInput,
+) (*managerModels.PullKillSwitchOutput, error) {
+	go killswitch.Pull(input.Reason)
+	return &managerModels.PullKillSwitchOutput{Pulled: true, Reason: input.Reason}, nil
+}
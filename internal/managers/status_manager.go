@@ -0,0 +1,182 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package managers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/traffic"
+	engineModels "us.figge.auto-ssh/internal/resources/models"
+	managerModels "us.figge.auto-ssh/internal/rest/models"
+)
+
+type StatusManager struct {
+	hosts     engineModels.HostEngine
+	tunnels   engineModels.TunnelEngine
+	startedAt time.Time
+}
+
+func NewStatusManager(ctx context.Context, hosts engineModels.HostEngine, tunnels engineModels.TunnelEngine) (*StatusManager, error) {
+	manager := &StatusManager{
+		hosts:     hosts,
+		tunnels:   tunnels,
+		startedAt: time.Now(),
+	}
+	return manager, nil
+}
+
+func (m *StatusManager) GetStatus(
+	ctx context.Context,
+	options ...managerModels.StatusOptionFunc,
+) (*managerModels.GetStatusOutput, error) {
+	opts := ExtractStatusOptions(options)
+	now := time.Now()
+	output := &managerModels.GetStatusOutput{
+		StartedAt: m.startedAt,
+		Uptime:    now.Sub(m.startedAt).Truncate(time.Second).String(),
+		Tunnels:   []*managerModels.TunnelStatus{},
+		Hosts:     []*managerModels.HostStatus{},
+	}
+	for _, tunnel := range m.tunnels.Tunnels() {
+		item := &managerModels.TunnelStatus{
+			Id:          tunnel.Id(),
+			Name:        tunnel.Name(),
+			Host:        tunnel.Host(),
+			Reverse:     tunnel.Reverse(),
+			Valid:       tunnel.Valid(),
+			Enabled:     tunnel.Enabled(),
+			Running:     tunnel.Running(),
+			Connections: tunnel.Connections(),
+		}
+		if tunnel.Local() != nil {
+			item.Local = tunnel.Local().String()
+			item.Port = tunnel.Local().Port()
+			if bound := tunnel.BoundAddress(); bound != item.Local {
+				// The port was left to the host or the address moved
+				item.Bound = bound
+				if _, port, err := net.SplitHostPort(bound); err == nil {
+					item.Port, _ = strconv.Atoi(port)
+				}
+			}
+		}
+		if tunnel.Remote() != nil {
+			item.Remote = tunnel.Remote().String()
+		}
+		if startedAt := tunnel.StartedAt(); !startedAt.IsZero() {
+			item.StartedAt = &startedAt
+			item.Uptime = now.Sub(startedAt).Truncate(time.Second).String()
+		}
+		if latency := tunnel.Latency(); latency > 0 {
+			item.Latency = latency.Round(time.Microsecond).String()
+		}
+		if totals := traffic.Get(tunnel.Id()); totals.Connections > 0 {
+			item.Traffic = &managerModels.Traffic{
+				BytesIn:     totals.BytesIn,
+				BytesOut:    totals.BytesOut,
+				Connections: totals.Connections,
+				Since:       totals.Since,
+			}
+		}
+		if opts.Connections() {
+			for _, conn := range tunnel.ActiveConnections() {
+				item.ActiveConnections = append(item.ActiveConnections, &managerModels.ConnectionStatus{
+					Id:        conn.Id,
+					Client:    conn.Client,
+					Target:    conn.Target,
+					Protocol:  conn.Protocol,
+					StartedAt: conn.Started,
+					Duration:  now.Sub(conn.Started).Truncate(time.Second).String(),
+					BytesIn:   conn.BytesIn,
+					BytesOut:  conn.BytesOut,
+				})
+			}
+		}
+		output.Tunnels = append(output.Tunnels, item)
+	}
+	for _, host := range m.hosts.Hosts() {
+		item := &managerModels.HostStatus{
+			Id:         host.Id(),
+			Name:       host.Name(),
+			JumpHost:   host.JumpHost(),
+			Valid:      host.Valid(),
+			Connected:  host.Connected(),
+			References: host.References(),
+			Banner:     host.Banner(),
+			BannerHash: host.BannerHash(),
+		}
+		if host.Remote() != nil {
+			item.Remote = host.Remote().String()
+		}
+		if latency := host.Latency(); latency > 0 {
+			item.Latency = latency.Round(time.Microsecond).String()
+		}
+		output.Hosts = append(output.Hosts, item)
+	}
+	sort.Slice(output.Tunnels, func(i, j int) bool { return output.Tunnels[i].Id < output.Tunnels[j].Id })
+	sort.Slice(output.Hosts, func(i, j int) bool { return output.Hosts[i].Id < output.Hosts[j].Id })
+	return output, nil
+}
+
+// ResetStats zeroes the traffic totals of the tunnels, by id or name, or of
+// every tunnel when none are given
+func (m *StatusManager) ResetStats(
+	ctx context.Context,
+	input *managerModels.ResetStatsInput,
+) (*managerModels.ResetStatsOutput, error) {
+	output := &managerModels.ResetStatsOutput{Tunnels: []string{}}
+	if len(input.Tunnels) == 0 {
+		traffic.Reset()
+		for _, tunnel := range m.tunnels.Tunnels() {
+			output.Tunnels = append(output.Tunnels, tunnel.Id())
+		}
+		return output, nil
+	}
+	for _, ref := range input.Tunnels {
+		id := ""
+		for _, tunnel := range m.tunnels.Tunnels() {
+			if tunnel.Id() == ref {
+				id = ref
+				break
+			} else if tunnel.Name() == ref && id == "" {
+				id = tunnel.Id()
+			}
+		}
+		if id == "" {
+			return nil, fmt.Errorf("%w: %s", ErrTunnelNotFound, ref)
+		}
+		output.Tunnels = append(output.Tunnels, id)
+	}
+	traffic.Reset(output.Tunnels...)
+	return output, nil
+}
+
+// GetMetrics gathers each tunnel's gauges, traffic totals and histograms
+func (m *StatusManager) GetMetrics(ctx context.Context) (*managerModels.GetMetricsOutput, error) {
+	output := &managerModels.GetMetricsOutput{Tunnels: []*managerModels.TunnelMetrics{}}
+	for _, tunnel := range m.tunnels.Tunnels() {
+		totals := traffic.Get(tunnel.Id())
+		distributions := tunnel.Distributions()
+		output.Tunnels = append(output.Tunnels, &managerModels.TunnelMetrics{
+			Id:                tunnel.Id(),
+			Name:              tunnel.Name(),
+			Up:                tunnel.Running() == engineModels.Started.String(),
+			Connections:       tunnel.Connections(),
+			TrafficIn:         totals.BytesIn,
+			TrafficOut:        totals.BytesOut,
+			TrafficClosed:     totals.Connections,
+			ConnectionSeconds: distributions.Duration,
+			ConnectionIn:      distributions.BytesIn,
+			ConnectionOut:     distributions.BytesOut,
+			DialSeconds:       distributions.Dial,
+		})
+	}
+	sort.Slice(output.Tunnels, func(i, j int) bool { return output.Tunnels[i].Id < output.Tunnels[j].Id })
+	return output, nil
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package managers
+
+import (
+	"context"
+	"fmt"
+
+	"us.figge.auto-ssh/internal/core/apitoken"
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/log"
+	managerModels "us.figge.auto-ssh/internal/rest/models"
+)
+
+var (
+	ErrInvalidToken = fmt.Errorf("token definition invalid")
+)
+
+type TokenManager struct {
+}
+
+func NewTokenManager(ctx context.Context) (*TokenManager, error) {
+	return &TokenManager{}, nil
+}
+
+// ListTokens lists the tokens issued through the api, those in the
+// configuration excluded
+func (m *TokenManager) ListTokens(
+	ctx context.Context,
+) (*managerModels.ListTokensOutput, error) {
+	output := &managerModels.ListTokensOutput{Items: []*managerModels.TokenHeader{}}
+	for _, t := range apitoken.List() {
+		output.Items = append(output.Items, &managerModels.TokenHeader{Name: t.Name, Access: t.Access, Created: t.Created})
+	}
+	return output, nil
+}
+
+// CreateToken issues a new api token.  Once a token exists every request
+// must present one
+func (m *TokenManager) CreateToken(
+	ctx context.Context,
+	input *managerModels.CreateTokenInput,
+) (*managerModels.CreateTokenOutput, error) {
+	if input.Name == "" {
+		return nil, fmt.Errorf("%w: a name is required", ErrInvalidToken)
+	}
+	switch input.Access {
+	case "":
+		input.Access = config.TokenAccessRead
+	case config.TokenAccessRead, config.TokenAccessAdmin:
+	default:
+		return nil, fmt.Errorf("%w: access must be %s or %s", ErrInvalidToken, config.TokenAccessRead, config.TokenAccessAdmin)
+	}
+	token, issued, err := apitoken.Issue(input.Name, input.Access)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("  Info  - api token (%s) issued with %s access\n", issued.Name, issued.Access)
+	return &managerModels.CreateTokenOutput{
+		TokenHeader: managerModels.TokenHeader{Name: issued.Name, Access: issued.Access, Created: issued.Created},
+		Token:       token,
+	}, nil
+}
+
+func (m *TokenManager) RevokeToken(
+	ctx context.Context,
+	input *managerModels.RevokeTokenInput,
+) (*managerModels.RevokeTokenOutput, error) {
+	if err := apitoken.Revoke(input.Name); err != nil {
+		return nil, err
+	}
+	log.Printf("  Info  - api token (%s) revoked\n", input.Name)
+	return &managerModels.RevokeTokenOutput{Name: input.Name}, nil
+}
@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/journal"
 	"us.figge.auto-ssh/internal/core/utils/cache"
 	engineModels "us.figge.auto-ssh/internal/resources/models"
 	managerModels "us.figge.auto-ssh/internal/rest/models"
@@ -22,6 +23,10 @@ var (
 	ErrTunnelNotFound = fmt.Errorf("tunnel not found")
 	ErrInvalidTunnel  = fmt.Errorf("tunnel definition invalid")
 	ErrTunnelRunning  = fmt.Errorf("tunnel already running")
+	ErrTunnelDisabled = fmt.Errorf("tunnel disabled")
+	ErrOutOfSchedule  = fmt.Errorf("tunnel outside its schedule")
+
+	ErrConnectionNotFound = fmt.Errorf("connection not found")
 )
 
 type TunnelManager struct {
@@ -138,9 +143,16 @@ func (m *TunnelManager) StartTunnel(
 	if !tunnel.Valid() {
 		return nil, fmt.Errorf("%w: %s(%s)", ErrInvalidTunnel, tunnel.Name(), input.Id)
 	}
+	if !tunnel.Enabled() {
+		return nil, fmt.Errorf("%w: %s(%s)", ErrTunnelDisabled, tunnel.Name(), input.Id)
+	}
+	if !tunnel.InSchedule(time.Now()) {
+		return nil, fmt.Errorf("%w: %s(%s)", ErrOutOfSchedule, tunnel.Name(), input.Id)
+	}
 	if strings.EqualFold(tunnel.Running(), "Running") {
 		return nil, fmt.Errorf("%w: %s(%s)", ErrTunnelRunning, tunnel.Name(), input.Id)
 	}
+	journal.Request(tunnel.Id(), journal.Started)
 	tunnel.Start()
 	// TODO Move to function and start with Stop
 	for range 5 {
@@ -168,6 +180,7 @@ func (m *TunnelManager) StopTunnel(
 	if !ok {
 		return nil, fmt.Errorf("%w: %s", ErrTunnelNotFound, input.Id)
 	}
+	journal.Request(tunnel.Id(), journal.Stopped)
 	tunnel.Stop()
 	tunnel, _ = m.tunnels.Tunnel(input.Id)
 	output := &managerModels.StopTunnelOutput{Id: input.Id}
@@ -178,6 +191,37 @@ func (m *TunnelManager) StopTunnel(
 	return output, nil
 }
 
+// CloseConnection closes one of the client connections a tunnel is forwarding
+func (m *TunnelManager) CloseConnection(
+	ctx context.Context,
+	input *managerModels.CloseConnectionInput,
+	opts ...managerModels.TunnelOptionFunc,
+) (*managerModels.CloseConnectionOutput, error) {
+	tunnel, ok := m.tunnels.Tunnel(input.Id)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTunnelNotFound, input.Id)
+	}
+	if !tunnel.CloseConnection(input.Connection) {
+		return nil, fmt.Errorf("%w: %s(%s) %d", ErrConnectionNotFound, tunnel.Name(), input.Id, input.Connection)
+	}
+	return &managerModels.CloseConnectionOutput{Id: input.Id, Connection: input.Connection}, nil
+}
+
+// TunnelReady reports whether a tunnel can forward connections, connecting its
+// host when it is not already
+func (m *TunnelManager) TunnelReady(
+	ctx context.Context,
+	input *managerModels.TunnelReadyInput,
+	opts ...managerModels.TunnelOptionFunc,
+) (*managerModels.TunnelReadyOutput, error) {
+	tunnel, ok := m.tunnels.Tunnel(input.Id)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTunnelNotFound, input.Id)
+	}
+	ready, reason := tunnel.Ready()
+	return &managerModels.TunnelReadyOutput{Id: input.Id, Name: tunnel.Name(), Ready: ready, Reason: reason}, nil
+}
+
 func tunnelFilter(input managerModels.FiltersInput, tunnel engineModels.Tunnel) bool {
 	for _, filter := range input.Filters {
 		match := false
@@ -0,0 +1,199 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package host
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/killswitch"
+	"us.figge.auto-ssh/internal/core/log"
+	"us.figge.auto-ssh/internal/core/sshagent"
+)
+
+const ttyName = "/dev/tty"
+
+var (
+	errAgentReadOnly = errors.New("forwarded agent cannot be changed")
+	errKeyRefused    = errors.New("key not offered through the forwarded agent")
+)
+
+// ForwardAgent offers an ssh agent to the command run in the session, as the
+// host's agent settings allow or, when forced, even though they do not enable
+// forwarding.  The returned func closes the connection to the local agent
+func (h *Entry) ForwardAgent(client *ssh.Client, session *ssh.Session, force bool) (func(), error) {
+	cfg := &config.Agent{}
+	if h.hostData.Agent != nil {
+		*cfg = *h.hostData.Agent
+	}
+	if !cfg.Forward && !force {
+		return func() {}, nil
+	}
+	keyring, closer, err := h.agentSource(cfg)
+	if err != nil {
+		return nil, err
+	}
+	forwarded := &policyAgent{agent: keyring, host: h.hostData.Name, keys: cfg.Keys, confirm: cfg.Confirm}
+	if err = agent.ForwardToAgent(client, forwarded); err == nil {
+		err = agent.RequestAgentForwarding(session)
+	}
+	if err != nil {
+		closer()
+		return nil, fmt.Errorf("host (%s) agent cannot be forwarded: %v", h.hostData.Name, err)
+	}
+	return closer, nil
+}
+
+// agentSource connects to the local agent, or builds one holding only the
+// host's identity
+func (h *Entry) agentSource(cfg *config.Agent) (agent.ExtendedAgent, func(), error) {
+	if cfg.Source == config.AgentSourceIdentity {
+		if h.hostData.Identity == "" {
+			return nil, nil, fmt.Errorf("host (%s) has no identity to forward", h.hostData.Name)
+		}
+		key, err := config.ReadIdentity(h.hostData.Identity)
+		if err != nil {
+			return nil, nil, err
+		}
+		var raw any
+		if h.hostData.Passphrase != "" {
+			raw, err = ssh.ParseRawPrivateKeyWithPassphrase(key, []byte(h.hostData.Passphrase))
+		} else {
+			raw, err = ssh.ParseRawPrivateKey(key)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		killswitch.Protect("agent "+h.hostData.Id, raw)
+		keyring := agent.NewKeyring()
+		if err = keyring.Add(agent.AddedKey{PrivateKey: raw, Comment: config.RedactIdentity(h.hostData.Identity)}); err != nil {
+			return nil, nil, err
+		}
+		return keyring.(agent.ExtendedAgent), func() {}, nil
+	}
+	conn, err := sshagent.Dial()
+	if err != nil {
+		return nil, nil, fmt.Errorf("host (%s) agent cannot be forwarded: %v", h.hostData.Name, err)
+	}
+	return agent.NewClient(conn), func() { _ = conn.Close() }, nil
+}
+
+func validateAgent(name string, cfg *config.Agent) bool {
+	if cfg == nil {
+		return true
+	}
+	valid := true
+	switch cfg.Source {
+	case "", config.AgentSourceAgent, config.AgentSourceIdentity:
+	default:
+		log.Printf("  Error - host (%s) agent source (%s) must be %s or %s\n", name, cfg.Source, config.AgentSourceAgent, config.AgentSourceIdentity)
+		valid = false
+	}
+	if cfg.Forward && !cfg.Confirm && len(cfg.Keys) == 0 {
+		log.Printf("  Warn  - host (%s) forwards every agent key without confirmation\n", name)
+	}
+	return valid
+}
+
+// policyAgent offers the remote end the allowed keys of an agent, asking for
+// each signature to be confirmed when required, and refuses any change to it
+type policyAgent struct {
+	agent   agent.ExtendedAgent
+	host    string
+	keys    []string
+	confirm bool
+	lock    sync.Mutex
+}
+
+func (a *policyAgent) List() ([]*agent.Key, error) {
+	keys, err := a.agent.List()
+	if err != nil {
+		return nil, err
+	}
+	var allowed []*agent.Key
+	for _, key := range keys {
+		if a.allowed(key) {
+			allowed = append(allowed, key)
+		}
+	}
+	return allowed, nil
+}
+
+func (a *policyAgent) Sign(key ssh.PublicKey, data []byte) (*ssh.Signature, error) {
+	return a.SignWithFlags(key, data, 0)
+}
+
+func (a *policyAgent) SignWithFlags(key ssh.PublicKey, data []byte, flags agent.SignatureFlags) (*ssh.Signature, error) {
+	listed, err := a.List()
+	if err != nil {
+		return nil, err
+	}
+	var found *agent.Key
+	for _, k := range listed {
+		if bytes.Equal(k.Marshal(), key.Marshal()) {
+			found = k
+			break
+		}
+	}
+	if found == nil {
+		return nil, errKeyRefused
+	}
+	if a.confirm && !a.confirmed(found) {
+		return nil, fmt.Errorf("use of key %s refused", ssh.FingerprintSHA256(key))
+	}
+	if config.VerboseFlag {
+		log.Printf("  Info  - host (%s) used forwarded key %s %s\n", a.host, ssh.FingerprintSHA256(key), found.Comment)
+	}
+	return a.agent.SignWithFlags(key, data, flags)
+}
+
+func (a *policyAgent) allowed(key *agent.Key) bool {
+	if len(a.keys) == 0 {
+		return true
+	}
+	fingerprint := ssh.FingerprintSHA256(key)
+	for _, k := range a.keys {
+		if k == fingerprint || k == key.Comment {
+			return true
+		}
+	}
+	return false
+}
+
+// confirmed asks at the terminal whether the key may be used, one question at
+// a time.  Without a terminal the signature is refused
+func (a *policyAgent) confirmed(key *agent.Key) bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	tty, err := os.OpenFile(ttyName, os.O_RDWR, 0)
+	if err != nil {
+		log.Printf("  Warn  - host (%s) agent confirmation cannot be asked: %v\n", a.host, err)
+		return false
+	}
+	defer func() { _ = tty.Close() }()
+	_, _ = fmt.Fprintf(tty, "Allow host (%s) to use key %s %s? [y/N] ", a.host, ssh.FingerprintSHA256(key), key.Comment)
+	answer, _ := bufio.NewReader(tty).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+func (a *policyAgent) Add(agent.AddedKey) error       { return errAgentReadOnly }
+func (a *policyAgent) Remove(ssh.PublicKey) error     { return errAgentReadOnly }
+func (a *policyAgent) RemoveAll() error               { return errAgentReadOnly }
+func (a *policyAgent) Lock([]byte) error              { return errAgentReadOnly }
+func (a *policyAgent) Unlock([]byte) error            { return errAgentReadOnly }
+func (a *policyAgent) Signers() ([]ssh.Signer, error) { return nil, errAgentReadOnly }
+
+func (a *policyAgent) Extension(string, []byte) ([]byte, error) {
+	return nil, agent.ErrExtensionUnsupported
+}
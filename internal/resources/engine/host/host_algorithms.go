@@ -0,0 +1,126 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package host
+
+import (
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/log"
+)
+
+const (
+	compressionAlgorithm = "zlib@openssh.com"
+)
+
+var (
+	supportedCiphers = []string{
+		"aes128-ctr", "aes192-ctr", "aes256-ctr",
+		"aes128-gcm@openssh.com", "aes256-gcm@openssh.com",
+		"chacha20-poly1305@openssh.com",
+		"arcfour256", "arcfour128", "arcfour",
+		"aes128-cbc", "3des-cbc",
+	}
+	supportedMACs = []string{
+		"hmac-sha2-256-etm@openssh.com", "hmac-sha2-512-etm@openssh.com",
+		"hmac-sha2-256", "hmac-sha2-512", "hmac-sha1", "hmac-sha1-96",
+	}
+	supportedKeyExchanges = []string{
+		"curve25519-sha256", "curve25519-sha256@libssh.org",
+		"ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521",
+		"diffie-hellman-group14-sha256", "diffie-hellman-group16-sha512",
+		"diffie-hellman-group14-sha1", "diffie-hellman-group1-sha1",
+		"diffie-hellman-group-exchange-sha256", "diffie-hellman-group-exchange-sha1",
+	}
+	supportedHostKeyAlgorithms = []string{
+		ssh.CertAlgoRSASHA256v01, ssh.CertAlgoRSASHA512v01,
+		ssh.CertAlgoRSAv01, ssh.CertAlgoDSAv01, ssh.CertAlgoECDSA256v01,
+		ssh.CertAlgoECDSA384v01, ssh.CertAlgoECDSA521v01, ssh.CertAlgoED25519v01,
+		ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521,
+		ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSASHA512,
+		ssh.KeyAlgoRSA, ssh.KeyAlgoDSA,
+		ssh.KeyAlgoED25519,
+	}
+	// insecureAlgorithms are supported for legacy appliances but warrant a warning
+	insecureAlgorithms = []string{
+		"arcfour256", "arcfour128", "arcfour", "aes128-cbc", "3des-cbc",
+		"hmac-sha1", "hmac-sha1-96",
+		"diffie-hellman-group14-sha1", "diffie-hellman-group1-sha1", "diffie-hellman-group-exchange-sha1",
+		ssh.CertAlgoRSAv01, ssh.CertAlgoDSAv01, ssh.KeyAlgoRSA, ssh.KeyAlgoDSA,
+	}
+)
+
+// validateAlgorithms trims and checks each configured algorithm against those
+// supported by the ssh library, flagging any considered insecure
+func validateAlgorithms(name string, algorithms *config.Algorithms) bool {
+	if algorithms == nil {
+		return true
+	}
+	valid := true
+	check := func(kind string, values []string, supported []string) []string {
+		var out []string
+		for _, value := range values {
+			value = strings.TrimSpace(value)
+			if !slices.Contains(supported, value) {
+				log.Printf("  Error - host (%s) %s (%s) is not supported\n", name, kind, value)
+				valid = false
+				continue
+			}
+			if slices.Contains(insecureAlgorithms, value) {
+				log.Printf("  Warn  - host (%s) %s (%s) is considered insecure\n", name, kind, value)
+			}
+			out = append(out, value)
+		}
+		return out
+	}
+	algorithms.Ciphers = check("cipher", algorithms.Ciphers, supportedCiphers)
+	algorithms.MACs = check("mac", algorithms.MACs, supportedMACs)
+	algorithms.KeyExchanges = check("key exchange", algorithms.KeyExchanges, supportedKeyExchanges)
+	algorithms.HostKeyAlgorithms = check("host key algorithm", algorithms.HostKeyAlgorithms, supportedHostKeyAlgorithms)
+	return valid
+}
+
+// applyAlgorithms restricts the client configuration to the configured
+// algorithms. Empty lists retain the library defaults
+func applyAlgorithms(cfg *ssh.ClientConfig, algorithms *config.Algorithms) {
+	if algorithms == nil {
+		return
+	}
+	cfg.Ciphers = algorithms.Ciphers
+	cfg.MACs = algorithms.MACs
+	cfg.KeyExchanges = algorithms.KeyExchanges
+	cfg.HostKeyAlgorithms = algorithms.HostKeyAlgorithms
+}
+
+// validateCompression warns that requested compression cannot yet be negotiated,
+// as the ssh library only offers none.  The setting is kept so the connection
+// compresses once the library supports it
+func validateCompression(name string, compression bool) {
+	if compression {
+		log.Printf("  Warn  - host (%s) compression (%s) is not supported by the ssh library, the connection is uncompressed\n", name, compressionAlgorithm)
+	}
+}
+
+// logNegotiated reports the algorithms agreed with the host during the handshake
+func logNegotiated(name string, conn ssh.Conn) {
+	meta, ok := conn.(ssh.AlgorithmsConnMetadata)
+	if !ok {
+		return
+	}
+	algorithms := meta.Algorithms()
+	log.Printf("  Info  - host (%s) negotiated key exchange %s, host key %s, cipher %s/%s, mac %s/%s, compression none\n",
+		name, algorithms.KeyExchange, algorithms.HostKey,
+		algorithms.Write.Cipher, algorithms.Read.Cipher, dash(algorithms.Write.MAC), dash(algorithms.Read.MAC))
+}
+
+// dash stands in for a mac made redundant by an aead cipher
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package host
+
+import (
+	"fmt"
+	"strings"
+
+	"us.figge.auto-ssh/internal/core/banner"
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/log"
+)
+
+// BannerUnacknowledgedError refuses a connection to a host whose banner has
+// not been acknowledged
+type BannerUnacknowledgedError struct {
+	Host string
+	Hash string
+}
+
+func (e *BannerUnacknowledgedError) Error() string {
+	return fmt.Sprintf("host (%s) banner %s has not been acknowledged", e.Host, e.Hash)
+}
+
+// Banner is the text the host last showed before login
+func (h *Entry) Banner() string {
+	h.bannerLock.Lock()
+	defer h.bannerLock.Unlock()
+	return h.banner
+}
+
+// BannerAcks is the file acknowledging the host's banners, empty when they
+// need no acknowledgement
+func (h *Entry) BannerAcks() string {
+	return h.hostData.BannerAcks
+}
+
+// BannerHash identifies the banner the host last showed, empty without one
+func (h *Entry) BannerHash() string {
+	if text := h.Banner(); text != "" {
+		return banner.Hash(text)
+	}
+	return ""
+}
+
+// bannerCallback keeps the banner shown by the host, logging it when it
+// changes, and refuses to log in while it has yet to be acknowledged
+func (h *Entry) bannerCallback(message string) error {
+	h.bannerLock.Lock()
+	changed := h.banner != message
+	h.banner = message
+	h.bannerLock.Unlock()
+	hash := banner.Hash(message)
+	if changed && config.VerboseFlag {
+		log.Printf("  Info  - host (%s) banner %s:\n", h.hostData.Name, hash)
+		for _, line := range strings.Split(strings.TrimRight(message, "\r\n"), "\n") {
+			log.Printf("  Info  -   %s\n", strings.TrimRight(line, "\r"))
+		}
+	}
+	if h.hostData.BannerAcks == "" {
+		return nil
+	}
+	ok, err := banner.Acknowledged(h.hostData.BannerAcks, h.hostData.Name, hash)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return &BannerUnacknowledgedError{Host: h.hostData.Name, Hash: hash}
+	}
+	return nil
+}
+
+// FetchBanner connects to the host for the banner it shows before login,
+// whether or not the login then succeeds
+func (h *Entry) FetchBanner() (string, error) {
+	if h.config == nil {
+		return "", fmt.Errorf("host (%s) is invalid", h.hostData.Name)
+	}
+	var message string
+	cfg := *h.config
+	cfg.BannerCallback = func(m string) error {
+		message = m
+		return nil
+	}
+	client, err := h.connect(&cfg)
+	if err == nil {
+		_ = client.Close()
+	}
+	if message == "" && err != nil {
+		return "", err
+	}
+	return message, nil
+}
+
+func (h *Entry) logBannerUnacknowledged(unacknowledged *BannerUnacknowledgedError) {
+	log.Printf("  Error - host (%s) banner %s has not been acknowledged. Connections are refused until it is\n",
+		h.hostData.Name, unacknowledged.Hash)
+	log.Printf("  Error -   to read and acknowledge it, run: ash banner ack %s\n", h.hostData.Name)
+}
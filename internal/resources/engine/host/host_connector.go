@@ -0,0 +1,120 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package host
+
+import (
+	"errors"
+
+	"us.figge.auto-ssh/internal/core/events"
+	"us.figge.auto-ssh/internal/core/log"
+)
+
+// Open connects to the host unless already connected.  Connecting is left to
+// the host's connector, so the lock is not held through a slow handshake and
+// callers using the connection already made, or asking after the host, are
+// not stalled behind it
+func (h *Entry) Open() bool {
+	h.lock.Lock()
+	if h.client != nil {
+		h.lock.Unlock()
+		return true
+	}
+	if h.requests == nil {
+		h.requests = make(chan chan bool)
+	}
+	h.pending++
+	if !h.connecting {
+		h.connecting = true
+		go h.connector()
+	}
+	requests := h.requests
+	h.lock.Unlock()
+
+	done := make(chan bool, 1)
+	requests <- done
+	return <-done
+}
+
+// connector serves the requests to connect one at a time, answering those
+// made while an attempt was under way with its outcome, so a host that cannot
+// be reached is tried once rather than once per waiting caller.  It runs until
+// no requests remain
+func (h *Entry) connector() {
+	for {
+		h.lock.Lock()
+		if h.pending == 0 {
+			h.connecting = false
+			h.lock.Unlock()
+			return
+		}
+		h.lock.Unlock()
+
+		done := h.receive()
+		ok := h.establish()
+		done <- ok
+		for waiting := true; waiting; {
+			select {
+			case done = <-h.requests:
+				h.lock.Lock()
+				h.pending--
+				h.lock.Unlock()
+				done <- ok
+			default:
+				waiting = false
+			}
+		}
+	}
+}
+
+func (h *Entry) receive() chan bool {
+	done := <-h.requests
+	h.lock.Lock()
+	h.pending--
+	h.lock.Unlock()
+	return done
+}
+
+// establish connects to the host unless it is already connected, holding the
+// lock only to read and install the connection
+func (h *Entry) establish() bool {
+	h.lock.Lock()
+	if h.client != nil {
+		h.lock.Unlock()
+		return true
+	}
+	if h.heldDown() {
+		h.lock.Unlock()
+		return false
+	}
+	cfg := h.config
+	h.lock.Unlock()
+
+	client, err := h.connect(cfg)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if err != nil {
+		h.connectFailed()
+		var changed *HostKeyChangedError
+		var unacknowledged *BannerUnacknowledgedError
+		if errors.As(err, &changed) {
+			h.logKeyChanged(changed)
+		} else if errors.As(err, &unacknowledged) {
+			h.logBannerUnacknowledged(unacknowledged)
+		} else {
+			log.Printf("  Error - failed to connect to remote address: %v\n", err)
+		}
+		events.Publish(events.KindHost, h.hostData.Id, h.hostData.Name, "Failed", err.Error())
+		return false
+	}
+	h.client = client
+	h.watchClient(h.client)
+	h.connected(h.client)
+	if h.refs == 0 {
+		h.idle()
+	}
+	h.expire(h.client)
+	h.watchAddress(h.client)
+	return true
+}
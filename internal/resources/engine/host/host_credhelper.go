@@ -0,0 +1,73 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package host
+
+import (
+	"context"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/credhelper"
+	"us.figge.auto-ssh/internal/core/log"
+)
+
+// helperSecret asks the host's credential helper for a secret of the kind
+func (h *Entry) helperSecret(kind string, prompt string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), config.DefaultCredentialHelperTimeout)
+	defer cancel()
+	secret, err := h.helper.Get(ctx, h.helperRequest(kind, prompt))
+	if err != nil {
+		log.Printf("  Error - host (%s) %v\n", h.hostData.Name, err)
+	}
+	return secret, err
+}
+
+// helperRefused tells the credential helper the secret of the kind was refused
+func (h *Entry) helperRefused(kind string) {
+	ctx, cancel := context.WithTimeout(context.Background(), config.DefaultCredentialHelperTimeout)
+	defer cancel()
+	if err := h.helper.Erase(ctx, h.helperRequest(kind, "")); err != nil {
+		log.Printf("  Warn  - host (%s) %v\n", h.hostData.Name, err)
+	}
+}
+
+func (h *Entry) helperRequest(kind string, prompt string) *credhelper.Request {
+	req := &credhelper.Request{
+		Username: h.hostData.Username,
+		Name:     h.hostData.Name,
+		Kind:     kind,
+		Prompt:   prompt,
+	}
+	if h.hostData.Remote != nil {
+		req.Host = h.hostData.Remote.String()
+	}
+	return req
+}
+
+// helperPassword offers the password of the credential helper
+func (h *Entry) helperPassword() (string, error) {
+	return h.helperSecret(credhelper.KindPassword, "")
+}
+
+// helperPassphrase decrypts an identity with the passphrase of the credential
+// helper, once the key has been found to need one
+func (h *Entry) helperPassphrase(key []byte) (any, error) {
+	passphrase, err := h.helperSecret(credhelper.KindPassphrase, "")
+	if err != nil {
+		return nil, err
+	}
+	raw, err := ssh.ParseRawPrivateKeyWithPassphrase(key, []byte(passphrase))
+	if err != nil {
+		h.helperRefused(credhelper.KindPassphrase)
+	}
+	return raw, err
+}
+
+// refusedAuthentication tells whether the handshake failed for want of
+// accepted credentials
+func refusedAuthentication(err error) bool {
+	return strings.Contains(err.Error(), "ssh: unable to authenticate")
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package host
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/damping"
+	"us.figge.auto-ssh/internal/core/events"
+	"us.figge.auto-ssh/internal/core/log"
+)
+
+func newDamper(d *config.Damping) *damping.Damper {
+	if d == nil {
+		return nil
+	}
+	return damping.NewDamper(d.FlapsOrDefault(), d.WindowOrDefault(), d.HoldDownOrDefault(), d.MaxHoldDownOrDefault(), d.RetryIntervalOrDefault())
+}
+
+// heldDown reports whether the host is not to be connected to yet, being held
+// down as unstable or having just failed to connect.  Must be called holding
+// the lock
+func (h *Entry) heldDown() bool {
+	if h.damper == nil {
+		return false
+	}
+	wait, ok := h.damper.Allow(time.Now())
+	if !ok && config.VerboseFlag {
+		log.Printf("  Info  - host (%s) not connected to for another %v\n", h.hostData.Name, wait.Round(time.Millisecond))
+	}
+	return !ok
+}
+
+// connectFailed spaces out the next attempt to connect.  Must be called
+// holding the lock
+func (h *Entry) connectFailed() {
+	if h.damper != nil {
+		h.damper.Failed(time.Now())
+	}
+}
+
+// connected notes the client connecting, declaring an unstable host stable
+// again once the client has stayed connected for the window.  Must be called
+// holding the lock
+func (h *Entry) connected(client *ssh.Client) {
+	if h.damper == nil {
+		return
+	}
+	h.damper.Connected(time.Now())
+	if h.stableTimer != nil {
+		h.stableTimer.Stop()
+	}
+	h.stableTimer = time.AfterFunc(h.damper.Window(), func() {
+		h.lock.Lock()
+		defer h.lock.Unlock()
+		if h.client == client && h.damper.Stable(time.Now()) {
+			log.Printf("  Info  - host (%s) stable again, connected for %v\n", h.hostData.Name, h.damper.Window())
+			events.Publish(events.KindHost, h.hostData.Id, h.hostData.Name, "Stable", "")
+		}
+	})
+}
+
+// flapped notes the connection dropping, holding the host down once it has
+// dropped too often.  Must be called holding the lock
+func (h *Entry) flapped() {
+	if h.damper == nil {
+		return
+	}
+	hold, declared := h.damper.Dropped(time.Now())
+	if !declared {
+		return
+	}
+	detail := fmt.Sprintf("dropped %d times within %v, held down for %v",
+		h.hostData.Damping.FlapsOrDefault(), h.damper.Window(), hold)
+	log.Printf("  Warn  - host (%s) is unstable, %s\n", h.hostData.Name, detail)
+	events.Publish(events.KindHost, h.hostData.Id, h.hostData.Name, "Unstable", detail)
+}
@@ -6,29 +6,47 @@ package host
 
 import (
 	"context"
-	"fmt"
 	"slices"
+	"sync"
 
 	"golang.org/x/crypto/ssh"
 	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/log"
 	engineModels "us.figge.auto-ssh/internal/resources/models"
 )
 
 type Engine struct {
-	hostEntries map[string]*Entry
-	identityMap map[string]ssh.Signer
-	hostKeysMap map[string]*HostKeyManager
+	lock         sync.RWMutex
+	hostEntries  map[string]*Entry
+	fingerprints map[string]string
+	identityMap  map[string]ssh.Signer
+	hostKeysMap  map[string]*HostKeyManager
 }
 
 func NewEngine(ctx context.Context, hosts []*config.Host) *Engine {
 	engine := &Engine{
-		hostEntries: make(map[string]*Entry),
-		identityMap: make(map[string]ssh.Signer),
-		hostKeysMap: make(map[string]*HostKeyManager),
+		hostEntries:  make(map[string]*Entry),
+		fingerprints: make(map[string]string),
+		identityMap:  make(map[string]ssh.Signer),
+		hostKeysMap:  make(map[string]*HostKeyManager),
 	}
+	engine.hostEntries, engine.fingerprints = engine.entries(hosts, nil)
+	return engine
+}
+
+// entries builds the host entries of a configuration, reusing the existing
+// entries named in keep rather than validating them again
+func (he *Engine) entries(hosts []*config.Host, keep map[string]*Entry) (map[string]*Entry, map[string]string) {
+	entries := make(map[string]*Entry)
+	fingerprints := make(map[string]string)
 	for _, cfgHost := range hosts {
-		if _, ok := engine.hostEntries[cfgHost.Name]; ok {
-			fmt.Printf("  Error - host name (%s) redfined\n", cfgHost.Name)
+		if _, ok := entries[cfgHost.Id]; ok {
+			log.Printf("  Error - host id (%s) redefined by host (%s)\n", cfgHost.Id, cfgHost.Name)
+			continue
+		}
+		fingerprints[cfgHost.Id] = config.Fingerprint(cfgHost)
+		if host, ok := keep[cfgHost.Id]; ok {
+			entries[cfgHost.Id] = host
 			continue
 		}
 		host := &Entry{
@@ -38,13 +56,101 @@ func NewEngine(ctx context.Context, hosts []*config.Host) *Engine {
 				inUse: false,
 			},
 		}
-		host.Validate("", engine.identityMap, engine.hostKeysMap)
-		engine.hostEntries[cfgHost.Id] = host
+		host.Validate("", he.identityMap, he.hostKeysMap)
+		entries[cfgHost.Id] = host
 	}
-	return engine
+	for id, hostEntry := range entries {
+		if _, ok := keep[id]; ok || hostEntry.hostData.JumpHost == "" {
+			continue
+		}
+		if jump, ok := lookup(entries, hostEntry.hostData.JumpHost); ok {
+			hostEntry.jump = jump
+			jump.isJumpHost = true
+		} else {
+			log.Printf("  Error - host (%s) jump host (%s) undefined\n", hostEntry.hostData.Name, hostEntry.hostData.JumpHost)
+			hostEntry.valid = false
+		}
+	}
+	return entries, fingerprints
+}
+
+// Apply brings the hosts in line with a new configuration.  Hosts whose
+// definition, and that of their jump hosts, is unchanged are kept along with
+// their connections.  Changed and removed hosts are closed, and their ids returned
+func (he *Engine) Apply(hosts []*config.Host) map[string]bool {
+	he.lock.Lock()
+	defer he.lock.Unlock()
+	keep := make(map[string]*Entry)
+	for _, cfgHost := range hosts {
+		if host, ok := he.hostEntries[cfgHost.Id]; ok && he.fingerprints[cfgHost.Id] == config.Fingerprint(cfgHost) {
+			keep[cfgHost.Id] = host
+		}
+	}
+	// A kept host must be rebuilt too when the jump host it travels through is
+	for changed := true; changed; {
+		changed = false
+		for id, host := range keep {
+			if host.jump != nil && keep[host.jump.hostData.Id] != host.jump {
+				delete(keep, id)
+				changed = true
+			}
+		}
+	}
+
+	replaced := make(map[string]bool)
+	for id, host := range he.hostEntries {
+		if _, ok := keep[id]; !ok {
+			host.Close()
+			replaced[id] = true
+		}
+	}
+	he.hostEntries, he.fingerprints = he.entries(hosts, keep)
+	for id := range he.hostEntries {
+		if _, ok := keep[id]; !ok {
+			replaced[id] = true
+		}
+	}
+	return replaced
+}
+
+// Lookup locates a host entry by its id, falling back to its name
+func (he *Engine) Lookup(ref string) (*Entry, bool) {
+	he.lock.RLock()
+	defer he.lock.RUnlock()
+	return lookup(he.hostEntries, ref)
+}
+
+func lookup(entries map[string]*Entry, ref string) (*Entry, bool) {
+	if host, ok := entries[ref]; ok {
+		return host, true
+	}
+	for _, host := range entries {
+		if host.hostData.Name == ref {
+			return host, true
+		}
+	}
+	return nil, false
+}
+
+// HostKeyManager returns the manager for a known_hosts file, loading it if it
+// has not been referenced by any of the configured hosts
+func (he *Engine) HostKeyManager(knownHostFile string) (*HostKeyManager, error) {
+	he.lock.Lock()
+	defer he.lock.Unlock()
+	if hkManager, ok := he.hostKeysMap[knownHostFile]; ok {
+		return hkManager, nil
+	}
+	hkManager, err := NewHostKeyManager(knownHostFile)
+	if err != nil {
+		return nil, err
+	}
+	he.hostKeysMap[knownHostFile] = hkManager
+	return hkManager, nil
 }
 
 func (he *Engine) Hosts() []engineModels.Host {
+	he.lock.RLock()
+	defer he.lock.RUnlock()
 	hosts := make([]engineModels.Host, 0, len(he.hostEntries))
 	for _, hostEntry := range he.hostEntries {
 		hosts = append(hosts, hostEntry)
@@ -53,11 +159,15 @@ func (he *Engine) Hosts() []engineModels.Host {
 }
 
 func (he *Engine) Host(id string) (engineModels.Host, bool) {
+	he.lock.RLock()
+	defer he.lock.RUnlock()
 	host, ok := he.hostEntries[id]
 	return host, ok
 }
 
 func (he *Engine) KnownHosts() []string {
+	he.lock.RLock()
+	defer he.lock.RUnlock()
 	knownHosts := make([]string, 0)
 	for _, hostEntry := range he.hostEntries {
 		if hostEntry.hostData.KnownHosts != "" && !slices.Contains(knownHosts, hostEntry.hostData.KnownHosts) {
@@ -66,3 +176,33 @@ func (he *Engine) KnownHosts() []string {
 	}
 	return knownHosts
 }
+
+// Kill closes every host's ssh connections and forgets the means of
+// authenticating to them, for the kill switch
+func (he *Engine) Kill() {
+	he.lock.Lock()
+	defer he.lock.Unlock()
+	for _, hostEntry := range he.hostEntries {
+		hostEntry.Close()
+		hostEntry.lock.Lock()
+		hostEntry.valid = false
+		if hostEntry.config != nil {
+			hostEntry.config = &ssh.ClientConfig{User: hostEntry.config.User, HostKeyCallback: hostEntry.config.HostKeyCallback}
+		}
+		hostEntry.hostData.Passphrase = ""
+		if hostEntry.hostData.PKCS11 != nil {
+			hostEntry.hostData.PKCS11.Pin = ""
+		}
+		if hostEntry.plugin != nil {
+			hostEntry.plugin.clear()
+		}
+		if hostEntry.helper != nil {
+			hostEntry.helper.Clear()
+		}
+		if hostEntry.otp != nil {
+			hostEntry.otp.clear()
+		}
+		hostEntry.lock.Unlock()
+	}
+	clear(he.identityMap)
+}
@@ -5,25 +5,67 @@
 package host
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"os"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/credhelper"
+	"us.figge.auto-ssh/internal/core/damping"
+	"us.figge.auto-ssh/internal/core/events"
+	"us.figge.auto-ssh/internal/core/keychain"
+	"us.figge.auto-ssh/internal/core/log"
+	"us.figge.auto-ssh/internal/core/pkcs11"
+	"us.figge.auto-ssh/internal/core/tor"
+	"us.figge.auto-ssh/internal/core/utils"
+)
+
+var (
+	errKeyScanned  = errors.New("host key scanned")
+	scanAlgorithms = []string{
+		ssh.KeyAlgoED25519,
+		ssh.KeyAlgoECDSA256,
+		ssh.KeyAlgoECDSA384,
+		ssh.KeyAlgoECDSA521,
+		ssh.KeyAlgoRSASHA512,
+	}
 )
 
 type hostData struct {
 	*config.Host
-	lock       sync.Mutex
-	valid      bool
-	inUse      bool
-	referenced bool
-	isJumpHost bool
-	client     *ssh.Client
-	config     *ssh.ClientConfig
+	lock        sync.Mutex
+	valid       bool
+	inUse       bool
+	referenced  bool
+	isJumpHost  bool
+	jump        *Entry
+	client      *ssh.Client
+	config      *ssh.ClientConfig
+	refs        int
+	idleSince   time.Time
+	idleTimer   *time.Timer
+	latency     time.Duration
+	lifetime    time.Duration
+	lifeTimer   *time.Timer
+	retired     map[*ssh.Client]int
+	overflows   []*overflow
+	plugin      *pluginAuth
+	helper      *credhelper.Helper
+	otp         *otpResponder
+	krb5        *krb5Client
+	bannerLock  sync.Mutex
+	banner      string
+	damper      *damping.Damper
+	stableTimer *time.Timer
+	requests    chan chan bool
+	pending     int
+	connecting  bool
 }
 type Entry struct {
 	*hostData
@@ -44,9 +86,14 @@ func (h *Entry) Username() string {
 func (h *Entry) Passphrase() string {
 	return h.hostData.Passphrase
 }
+
+// Identity is the host's identity file, or a placeholder for a key given inline
 func (h *Entry) Identity() string {
-	return h.hostData.Identity
+	return config.RedactIdentity(h.hostData.Identity)
 }
+
+// KnownHosts is the host's configured known_hosts file, which its keys are
+// checked against whether or not it is reached through a jump host
 func (h *Entry) KnownHosts() string {
 	return h.hostData.KnownHosts
 }
@@ -56,9 +103,39 @@ func (h *Entry) JumpHost() string {
 func (h *Entry) Valid() bool {
 	return h.hostData.valid
 }
+func (h *Entry) Algorithms() *config.Algorithms {
+	return h.hostData.Algorithms
+}
+func (h *Entry) Timeouts() *config.Timeouts {
+	return h.hostData.Timeouts
+}
 func (h *Entry) Metadata() *config.Metadata {
 	return h.hostData.Metadata
 }
+func (h *Entry) Recording() *config.Recording {
+	return h.hostData.Recording
+}
+func (h *Entry) Connected() bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.client != nil
+}
+
+// Latency is the round trip time last probed on the ssh connection, or zero
+// when unknown
+func (h *Entry) Latency() time.Duration {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.client == nil {
+		return 0
+	}
+	return h.latency
+}
+func (h *Entry) References() int {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.refs + h.overflowRefs()
+}
 func (h *Entry) Referenced() {
 	h.referenced = true
 }
@@ -70,45 +147,416 @@ func (h *Entry) Referenced() {
 //	return h.hostData.inUse
 //}
 
-func (h *Entry) Open() bool {
+// watchClient publishes the host's connection and, once it has closed for
+// whatever reason, its disconnection.  A client closed after being replaced
+// is not reported.  One dropping while still in use is a flap, and is let go
+// so the next use connects again
+func (h *Entry) watchClient(client *ssh.Client) {
+	events.Publish(events.KindHost, h.hostData.Id, h.hostData.Name, "Connected", client.RemoteAddr().String())
+	go func() {
+		_ = client.Wait()
+		h.lock.Lock()
+		dropped := h.client == client
+		if dropped {
+			h.client = nil
+			h.flapped()
+		}
+		current := dropped || h.client == nil
+		h.lock.Unlock()
+		if current {
+			events.Publish(events.KindHost, h.hostData.Id, h.hostData.Name, "Disconnected", "")
+		}
+	}()
+}
+
+// Close drops the host's ssh connection, along with every channel open on it,
+// once the host has been replaced or removed from the configuration
+func (h *Entry) Close() {
 	h.lock.Lock()
 	defer h.lock.Unlock()
-	return h.open()
+	if h.idleTimer != nil {
+		h.idleTimer.Stop()
+		h.idleTimer = nil
+	}
+	if h.lifeTimer != nil {
+		h.lifeTimer.Stop()
+		h.lifeTimer = nil
+	}
+	if h.stableTimer != nil {
+		h.stableTimer.Stop()
+		h.stableTimer = nil
+	}
+	if h.client != nil {
+		_ = h.client.Close()
+		h.client = nil
+	}
+	for len(h.overflows) > 0 {
+		h.dropOverflow(h.overflows[0])
+	}
+	for client := range h.retired {
+		_ = client.Close()
+	}
+	h.retired = nil
 }
-func (h *Entry) open() bool {
-	if h.client == nil {
+
+// sharedConn is a channel on the host's shared ssh connection.  Closing it
+// releases the reference it holds on the connection
+type sharedConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *sharedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
+
+func (c *sharedConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return errors.ErrUnsupported
+}
+
+func (h *Entry) release(client *ssh.Client) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if refs, ok := h.retired[client]; ok {
+		h.drained(client, refs)
+		return
+	}
+	if h.releaseOverflow(client) {
+		return
+	}
+	h.refs--
+	if h.refs == 0 && h.client != nil {
+		h.idle()
+	}
+}
+
+// idle schedules the ssh connection to close once it has gone unused for the
+// host's idle timeout
+func (h *Entry) idle() {
+	timeout := h.hostData.Timeouts.IdleTimeout()
+	h.idleSince = time.Now()
+	if h.idleTimer != nil {
+		h.idleTimer.Stop()
+	}
+	h.idleTimer = time.AfterFunc(timeout, func() {
+		h.lock.Lock()
+		defer h.lock.Unlock()
+		if h.refs > 0 || h.client == nil || time.Since(h.idleSince) < timeout {
+			return
+		}
+		if config.VerboseFlag {
+			log.Printf("  Info  - host (%s) closing connection idle for %v\n", h.hostData.Name, timeout)
+		}
+		_ = h.client.Close()
+		h.client = nil
+		h.idleTimer = nil
+	})
+}
+
+// connect establishes a new ssh client to the host, travelling through the
+// jump host when one is configured.  The connect timeout spans both the
+// transport dial and the ssh handshake
+func (h *Entry) connect(cfg *ssh.ClientConfig) (*ssh.Client, error) {
+	address := h.hostData.Remote.String()
+	timeout := h.hostData.Timeouts.ConnectTimeout()
+	if h.plugin != nil {
+		h.plugin.expire()
+	}
+	var conn net.Conn
+	if h.hostData.Transport == config.TransportWebSocket {
+		var err error
+		if conn, err = h.dialWebSocket(timeout); err != nil {
+			return nil, err
+		}
+	} else if h.viaTor() {
 		var err error
-		h.client, err = ssh.Dial("tcp", h.hostData.Remote.String(), h.config)
+		if conn, err = tor.Dial(torSOCKS(), address, timeout); err != nil {
+			return nil, err
+		}
+	} else if h.jump == nil {
+		var err error
+		d := &net.Dialer{Timeout: timeout, FallbackDelay: h.hostData.Timeouts.FallbackDelay()}
+		if s := h.hostData.Socket; s != nil && s.KeepAlive != nil && !*s.KeepAlive {
+			d.KeepAlive = -1
+		}
+		conn, err = d.Dial("tcp", address)
 		if err != nil {
-			fmt.Printf("  Error - failed to connect to remote address: %v\n", err)
-			return false
+			return nil, err
+		}
+		if err = h.hostData.Socket.Apply(conn); err != nil {
+			log.Printf("  Warn  - host (%s) socket options cannot be applied: %v\n", h.hostData.Name, err)
+		}
+	} else {
+		if !h.jump.Open() {
+			return nil, fmt.Errorf("jump host (%s) unavailable", h.jump.Name())
+		}
+		var ok bool
+		conn, ok = h.jump.Dial(address)
+		if !ok {
+			return nil, fmt.Errorf("jump host (%s) failed to reach %s", h.jump.Name(), address)
+		}
+	}
+
+	// Closing the connection aborts a handshake stalled behind a black-holing firewall
+	timer := time.AfterFunc(timeout, func() { _ = conn.Close() })
+	c, chans, reqs, err := ssh.NewClientConn(conn, address, cfg)
+	if !timer.Stop() {
+		if err == nil {
+			_ = c.Close()
+		}
+		return nil, fmt.Errorf("ssh handshake with %s timed out after %v", address, timeout)
+	}
+	if err != nil {
+		_ = conn.Close()
+		if h.helper != nil && refusedAuthentication(err) {
+			h.helperRefused(credhelper.KindPassword)
+		}
+		return nil, err
+	}
+	if config.VerboseFlag {
+		logNegotiated(h.hostData.Name, c)
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// dialChannel opens a forwarding channel on the client, abandoning the attempt
+// when the channel timeout expires
+func (h *Entry) dialChannel(client *ssh.Client, address string) (net.Conn, error) {
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	timeout := h.hostData.Timeouts.ChannelTimeout()
+	results := make(chan result, 1)
+	go func() {
+		conn, err := client.Dial("tcp", address)
+		results <- result{conn: conn, err: err}
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r := <-results:
+		return r.conn, r.err
+	case <-timer.C:
+		go func() {
+			if r := <-results; r.conn != nil {
+				_ = r.conn.Close()
+			}
+		}()
+		return nil, fmt.Errorf("channel open to %s timed out after %v", address, timeout)
+	}
+}
+
+// ScanHostKeys performs a handshake with the host for each of the commonly
+// supported key algorithms and returns the keys presented by the server
+func (h *Entry) ScanHostKeys() ([]ssh.PublicKey, error) {
+	var keys []ssh.PublicKey
+	var lastErr error
+	for _, algorithm := range scanAlgorithms {
+		if config.FIPSFlag && !slices.Contains(fipsHostKeyAlgorithms, algorithm) {
+			continue
+		}
+		cfg := &ssh.ClientConfig{
+			User: h.hostData.Username,
+			HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+				keys = append(keys, key)
+				return errKeyScanned
+			},
+		}
+		applyAlgorithms(cfg, h.hostData.Algorithms)
+		applyFIPS(cfg)
+		cfg.HostKeyAlgorithms = []string{algorithm}
+		client, err := h.connect(cfg)
+		if err == nil {
+			_ = client.Close()
+		} else if !errors.Is(err, errKeyScanned) {
+			lastErr = err
 		}
 	}
-	return true
+	if len(keys) == 0 {
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no host keys presented")
+		}
+		return nil, lastErr
+	}
+	return keys, nil
 }
 
+// Dial opens a channel to the address on the host's shared ssh connection.
+// The lock only guards establishing the connection, so channel opens proceed
+// concurrently.  A failed open on a broken connection reconnects and retries
+// once
 func (h *Entry) Dial(address string) (net.Conn, bool) {
+	for attempt := 0; ; attempt++ {
+		client, ok := h.reserve()
+		if !ok {
+			return nil, false
+		}
+		conn, err := h.dialChannel(client, address)
+		if err == nil {
+			return &sharedConn{Conn: conn, release: func() { h.release(client) }}, true
+		}
+		var openErr *ssh.OpenChannelError
+		rejected := errors.As(err, &openErr)
+		if !rejected {
+			h.discard(client)
+		}
+		h.release(client)
+		if rejected || attempt > 0 {
+			log.Printf("  Error - Host (%s) failed to call forward address: %v\n", h.hostData.Name, err)
+			return nil, false
+		}
+	}
+}
+
+// Probe times a keepalive request on the host's ssh connection without
+// connecting when there is none.  A connection that fails to reply within the
+// channel timeout is dropped as broken
+func (h *Entry) Probe() (time.Duration, bool) {
+	h.lock.Lock()
+	client := h.client
+	h.lock.Unlock()
+	if client == nil {
+		return 0, false
+	}
+	timeout := h.hostData.Timeouts.ChannelTimeout()
+	results := make(chan error, 1)
+	start := time.Now()
+	go func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		results <- err
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	var err error
+	select {
+	case err = <-results:
+	case <-timer.C:
+		err = fmt.Errorf("no reply after %v", timeout)
+	}
+	if err != nil {
+		log.Printf("  Warn  - host (%s) keepalive failed, dropping connection: %v\n", h.hostData.Name, err)
+		h.discard(client)
+		return 0, false
+	}
+	latency := time.Since(start)
 	h.lock.Lock()
 	defer h.lock.Unlock()
-	return h.redial(address, false)
+	h.latency = latency
+	return latency, true
 }
 
-func (h *Entry) redial(address string, redialing bool) (net.Conn, bool) {
-	conn, err := h.client.Dial("tcp", address)
-	if err != nil {
+// Client returns the host's shared ssh client, connected through any jump hosts,
+// along with a func that releases the reference held on it once done
+func (h *Entry) Client() (*ssh.Client, func(), error) {
+	client, ok := h.reserve()
+	if !ok {
+		return nil, nil, fmt.Errorf("host (%s) unavailable", h.hostData.Name)
+	}
+	return client, func() { h.release(client) }, nil
+}
+
+// reserve takes a reference on the ssh connection, connecting if necessary,
+// so it cannot be closed as idle while a channel is being opened.  Once the
+// connection carries the host's maximum channels, an additional one is used
+func (h *Entry) reserve() (*ssh.Client, bool) {
+	if !h.Open() {
+		return nil, false
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.client == nil {
+		// Dropped again before it could be used
+		return nil, false
+	}
+	if h.hostData.MaxChannels > 0 && h.refs >= h.hostData.MaxChannels {
+		return h.reserveOverflow()
+	}
+	h.refs++
+	if h.idleTimer != nil {
+		h.idleTimer.Stop()
+		h.idleTimer = nil
+	}
+	return h.client, true
+}
+
+// discard closes a broken ssh connection unless another caller has already
+// replaced it
+func (h *Entry) discard(client *ssh.Client) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.client == client {
 		_ = h.client.Close()
 		h.client = nil
-		if !redialing {
-			if h.open() {
-				return h.redial(address, true)
-			} else {
-				return nil, false
-			}
+		h.flapped()
+	} else if o := h.overflow(client); o != nil {
+		h.dropOverflow(o)
+	}
+}
+
+// Recycle drops the host's ssh connection and connects again, as autossh
+// restarts ssh, for a connection that no longer carries traffic.  Channels
+// open on the dropped connection close with it
+func (h *Entry) Recycle() bool {
+	h.lock.Lock()
+	if h.client != nil {
+		_ = h.client.Close()
+		h.client = nil
+	}
+	h.lock.Unlock()
+	return h.Open()
+}
+
+// keychainSecrets retrieves the identity passphrase, unless one is configured,
+// and the password of the host from the OS keychain
+func (h *Entry) keychainSecrets() string {
+	if strings.TrimSpace(h.hostData.Passphrase) == "" {
+		passphrase, err := keychain.Get(keychain.Account(h.hostData.Name, keychain.KindPassphrase))
+		if err == nil {
+			h.hostData.Passphrase = passphrase
+		} else if !errors.Is(err, keychain.ErrNotFound) {
+			log.Printf("  Warn  - host (%s) keychain passphrase cannot be read: %v\n", h.hostData.Name, err)
 		}
-		fmt.Printf("  Error - Host (%s) failed to call forward address: %v\n", h.hostData.Name, err)
+	}
+	password, err := keychain.Get(keychain.Account(h.hostData.Name, keychain.KindPassword))
+	if err != nil && !errors.Is(err, keychain.ErrNotFound) {
+		log.Printf("  Warn  - host (%s) keychain password cannot be read: %v\n", h.hostData.Name, err)
+	}
+	return password
+}
+
+// tokenSigners returns the smart card keys of the host's PKCS#11 provider, or
+// of the --pkcs11 provider when the host has none
+func (h *Entry) tokenSigners() ([]ssh.Signer, bool) {
+	provider, pin := config.PKCS11Flag, ""
+	if h.hostData.PKCS11 != nil {
+		if strings.TrimSpace(h.hostData.PKCS11.Provider) != "" {
+			provider = h.hostData.PKCS11.Provider
+		}
+		pin = h.hostData.PKCS11.Pin
+		if name, ok := strings.CutPrefix(pin, "env:"); ok {
+			pin = os.Getenv(name)
+		}
+	}
+	provider = strings.TrimSpace(provider)
+	if provider == "" {
+		return nil, true
+	}
+	signers, err := pkcs11.Signers(provider, pin)
+	if err != nil {
+		log.Printf("  Error - host (%s) smart card keys unavailable: %v\n", h.hostData.Name, err)
 		return nil, false
 	}
-	return conn, true
+	if config.VerboseFlag {
+		log.Printf("  Info  - host (%s) offers %d smart card key(s) from %s\n", h.hostData.Name, len(signers), provider)
+	}
+	return signers, true
 }
 
 func (h *Entry) Validate(
@@ -119,34 +567,36 @@ func (h *Entry) Validate(
 	warning := false
 	h.hostData.Name = strings.TrimSpace(h.hostData.Name)
 	if h.hostData.Name == "" {
-		fmt.Printf("  Error - host name cannot be blank\n")
+		log.Printf("  Error - host name cannot be blank\n")
 		h.valid = false
 	}
 
 	h.hostData.Username = strings.TrimSpace(h.hostData.Username)
 	if strings.TrimSpace(h.hostData.Username) == "" && config.VerboseFlag {
-		fmt.Printf("  Info  - host (%s) will use default username: %s\n", h.hostData.Name, defaultUsername)
+		log.Printf("  Info  - host (%s) will use default username: %s\n", h.hostData.Name, defaultUsername)
 		h.hostData.Username = defaultUsername
 	}
 
 	h.hostData.KnownHosts = strings.TrimSpace(h.hostData.KnownHosts)
 	if h.hostData.KnownHosts == "" {
-		fmt.Printf("  Warn  - host (%s) not using a known_hosts file\n", h.hostData.Name)
+		log.Printf("  Warn  - host (%s) not using a known_hosts file\n", h.hostData.Name)
 		warning = true
 	} else if _, ok := hostKeysMap[h.hostData.KnownHosts]; !ok {
 		if fi, err := os.Stat(h.hostData.KnownHosts); os.IsNotExist(err) {
-			fmt.Printf("  Error - host (%s) known_hosts file (%s) cannot be read: file not found\n", h.hostData.Name, h.hostData.KnownHosts)
+			log.Printf("  Error - host (%s) known_hosts file (%s) cannot be read: file not found\n", h.hostData.Name, h.hostData.KnownHosts)
 			h.valid = false
 		} else if fi.IsDir() {
-			fmt.Printf("  Error - host (%s) known_hosts file (%s) cannot be read: file is a directory\n", h.hostData.Name, h.hostData.KnownHosts)
+			log.Printf("  Error - host (%s) known_hosts file (%s) cannot be read: file is a directory\n", h.hostData.Name, h.hostData.KnownHosts)
+			h.valid = false
+		} else if !config.CheckPermissions("host ("+h.hostData.Name+") known_hosts file", h.hostData.KnownHosts, config.SharedPerms) {
 			h.valid = false
 		} else {
 			var hkManager *HostKeyManager
 			if hkManager, err = NewHostKeyManager(h.hostData.KnownHosts); os.IsPermission(err) {
-				fmt.Printf("  Error - host (%s) known_hosts file (%s) cannot be read: permission denied\n", h.hostData.Name, h.hostData.KnownHosts)
+				log.Printf("  Error - host (%s) known_hosts file (%s) cannot be read: permission denied\n", h.hostData.Name, h.hostData.KnownHosts)
 				h.valid = false
 			} else if err != nil {
-				fmt.Printf("  Error - host (%s) known_hosts file (%s) cannot be read: %v\n", h.hostData.Name, h.hostData.KnownHosts, err)
+				log.Printf("  Error - host (%s) known_hosts file (%s) cannot be read: %v\n", h.hostData.Name, h.hostData.KnownHosts, err)
 				h.valid = false
 			} else {
 				hostKeysMap[h.hostData.KnownHosts] = hkManager
@@ -154,37 +604,93 @@ func (h *Entry) Validate(
 		}
 	}
 
-	h.hostData.Identity = strings.TrimSpace(h.hostData.Identity)
-	if h.hostData.Identity == "" {
-		fmt.Printf("  Error - host (%s) missing identity file\n", h.hostData.Name)
+	var password string
+	if h.hostData.Keychain {
+		password = h.keychainSecrets()
+	}
+	h.hostData.BannerAcks = utils.ExpandHome(strings.TrimSpace(h.hostData.BannerAcks))
+	h.hostData.CredentialHelper = strings.TrimSpace(h.hostData.CredentialHelper)
+	if h.hostData.CredentialHelper != "" {
+		h.helper = credhelper.New(h.hostData.CredentialHelper, h.hostData.CredentialTTL.OrDefault(config.DefaultCredentialTTL))
+	}
+	if h.hostData.OTP != nil {
+		otp, err := newOTPResponder(h.hostData.Host)
+		if err != nil {
+			log.Printf("  Error - host (%s) %v\n", h.hostData.Name, err)
+			h.valid = false
+		} else if otp.generator == nil && config.VerboseFlag {
+			log.Printf("  Info  - host (%s) one-time passwords will be asked for at the terminal\n", h.hostData.Name)
+		}
+		h.otp = otp
+	}
+	if h.hostData.GSSAPI != nil {
+		h.krb5 = newKrb5Client(h.hostData.GSSAPI)
+		if ok, msg := h.krb5.validate(h.hostData.Name); !ok {
+			log.Printf("  Error - host (%s) %s\n", h.hostData.Name, msg)
+			h.valid = false
+		} else if msg != "" {
+			log.Printf("  Warn  - host (%s) %s\n", h.hostData.Name, msg)
+			warning = true
+		}
+	}
+
+	tokenSigners, ok := h.tokenSigners()
+	if !ok {
 		h.valid = false
 	}
-	if _, ok := identityMap[h.hostData.Identity]; !ok {
-		if fi, err := os.Stat(h.hostData.Identity); os.IsNotExist(err) {
-			fmt.Printf("  Error - host (%s) identity file (%s) cannot be read: file not found\n", h.hostData.Name, h.hostData.Identity)
+
+	h.hostData.Identity = strings.TrimSpace(h.hostData.Identity)
+	if h.hostData.AuthPlugin != nil {
+		if !h.hostData.AuthPlugin.Validate("host", h.hostData.Name) {
+			h.valid = false
+		}
+		// Only the first means of authentication of each kind is tried, so the
+		// plugin's keys and password must be the only ones
+		if h.hostData.Identity != "" || h.hostData.Keychain || h.hostData.PKCS11 != nil || h.helper != nil || h.hostData.OTP != nil {
+			log.Printf("  Error - host (%s) authPlugin cannot be combined with an identity, keychain, pkcs11, credentialHelper or otp\n", h.hostData.Name)
+			h.valid = false
+		}
+	} else if h.hostData.Identity == "" {
+		if password == "" && len(tokenSigners) == 0 && h.helper == nil && h.otp == nil && h.krb5 == nil {
+			log.Printf("  Error - host (%s) missing identity file\n", h.hostData.Name)
+			h.valid = false
+		}
+	} else if _, ok := identityMap[h.hostData.Identity]; !ok {
+		h.hostData.Passphrase = strings.TrimSpace(h.hostData.Passphrase)
+		if !config.IsFileIdentity(h.hostData.Identity) {
+			key, err := config.ReadIdentity(h.hostData.Identity)
+			var signer ssh.Signer
+			if err == nil {
+				signer, err = h.parseIdentity(key)
+			}
+			if err != nil {
+				log.Printf("  Error - host (%s) identity %s cannot be decoded: %v\n", h.hostData.Name, config.RedactIdentity(h.hostData.Identity), err)
+				h.valid = false
+			} else {
+				identityMap[h.hostData.Identity] = signer
+			}
+		} else if fi, err := os.Stat(h.hostData.Identity); os.IsNotExist(err) {
+			log.Printf("  Error - host (%s) identity file (%s) cannot be read: file not found\n", h.hostData.Name, h.hostData.Identity)
 			h.valid = false
 		} else if fi.IsDir() {
-			fmt.Printf("  Error - host (%s) identity file (%s) cannot be read: file is a directory\n", h.hostData.Name, h.hostData.Identity)
+			log.Printf("  Error - host (%s) identity file (%s) cannot be read: file is a directory\n", h.hostData.Name, h.hostData.Identity)
+			h.valid = false
+		} else if !config.CheckPermissions("host ("+h.hostData.Name+") identity file", h.hostData.Identity, config.PrivatePerms) {
 			h.valid = false
 		} else {
 			var key []byte
 			key, err = os.ReadFile(h.hostData.Identity)
 			if os.IsPermission(err) {
-				fmt.Printf("  Error - host (%s) identity file (%s) cannot be read: permission denied\n", h.hostData.Name, h.hostData.Identity)
+				log.Printf("  Error - host (%s) identity file (%s) cannot be read: permission denied\n", h.hostData.Name, h.hostData.Identity)
 				h.valid = false
 			} else if err != nil {
-				fmt.Printf("  Error - host (%s) identity file (%s) cannot be read: %v\n", h.hostData.Name, h.hostData.Identity, err)
+				log.Printf("  Error - host (%s) identity file (%s) cannot be read: %v\n", h.hostData.Name, h.hostData.Identity, err)
 				h.valid = false
 			} else {
 				var signer ssh.Signer
-				h.hostData.Passphrase = strings.TrimSpace(h.hostData.Passphrase)
-				if h.hostData.Passphrase != "" {
-					signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(h.hostData.Passphrase))
-				} else {
-					signer, err = ssh.ParsePrivateKey(key)
-				}
+				signer, err = h.parseIdentity(key)
 				if err != nil {
-					fmt.Printf("  Error - host (%s) identity file (%s) cannot be decode: %v\n", h.hostData.Name, h.hostData.Identity, err)
+					log.Printf("  Error - host (%s) identity file (%s) cannot be decode: %v\n", h.hostData.Name, h.hostData.Identity, err)
 					h.valid = false
 				} else {
 					identityMap[h.hostData.Identity] = signer
@@ -194,30 +700,123 @@ func (h *Entry) Validate(
 	}
 
 	if h.hostData.Remote == nil || h.hostData.Remote.IsBlank() {
-		fmt.Printf("  Error - host (%s) requires an address\n", h.hostData.Name)
+		log.Printf("  Error - host (%s) requires an address\n", h.hostData.Name)
+		h.valid = false
+	} else if !h.hostData.Remote.Validate("host", h.hostData.Name, "address",
+		h.hostData.JumpHost != "" || h.hostData.Transport == config.TransportWebSocket || h.viaTor(), true) {
 		h.valid = false
-	} else if !h.hostData.Remote.Validate("host", h.hostData.Name, "address", h.hostData.JumpHost != "", true) {
+	}
+	if !h.validateTransport() {
 		h.valid = false
 	}
 
-	if h.hostData.JumpHost != "" {
-		if h.hostData.JumpHost == h.hostData.Name {
-			fmt.Printf("  Error - host (%s) jump_host cannot reference itself\n", h.hostData.Name)
-			h.valid = false
-		} else {
-			h.hostData.KnownHosts = ""
-		}
+	if h.hostData.JumpHost != "" && h.hostData.JumpHost == h.hostData.Name {
+		log.Printf("  Error - host (%s) jump_host cannot reference itself\n", h.hostData.Name)
+		h.valid = false
+	}
+	if !h.hostData.Timeouts.Validate("host", h.hostData.Name) {
+		h.valid = false
+	}
+	if !h.hostData.Recording.Validate("host", h.hostData.Name) {
+		h.valid = false
+	}
+	if !h.hostData.Socket.Validate("host", h.hostData.Name) {
+		h.valid = false
+	} else if s := h.hostData.Socket; s != nil && (s.ReuseAddress || s.ReusePort) {
+		log.Printf("  Warn  - host (%s) socket reuse options ignored, as hosts have no listener\n", h.hostData.Name)
+	} else if h.hostData.Socket != nil && h.hostData.JumpHost != "" {
+		log.Printf("  Warn  - host (%s) socket ignored, as it is reached through jump host (%s)\n", h.hostData.Name, h.hostData.JumpHost)
+	}
+	if !h.hostData.Damping.Validate("host", h.hostData.Name) {
+		h.valid = false
+	} else {
+		h.damper = newDamper(h.hostData.Damping)
+	}
+	h.lifetime = h.hostData.Timeouts.MaxLifetime()
+	if !validateAlgorithms(h.hostData.Name, h.hostData.Algorithms) {
+		h.valid = false
+	}
+	if !validateFIPS(h.hostData.Name, h.hostData.Algorithms) {
+		h.valid = false
+	}
+	validateCompression(h.hostData.Name, h.hostData.Compression)
+	if h.hostData.MaxChannels < 0 {
+		log.Printf("  Error - host (%s) maxChannels (%d) cannot be negative\n", h.hostData.Name, h.hostData.MaxChannels)
+		h.valid = false
+	}
+	if !validateAgent(h.hostData.Name, h.hostData.Agent) {
+		h.valid = false
+	}
+	var auth []ssh.AuthMethod
+	if signer, ok := identityMap[h.hostData.Identity]; ok {
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if len(tokenSigners) > 0 {
+		auth = append(auth, ssh.PublicKeys(tokenSigners...))
+	}
+	if h.krb5 != nil {
+		auth = append(auth, h.gssapiMethod())
+	}
+	if config.FIPSFlag && (password != "" || h.helper != nil) {
+		log.Printf("  Warn  - host (%s) password authentication is refused in fips mode\n", h.hostData.Name)
+		warning = true
+	} else if password != "" {
+		auth = append(auth, ssh.Password(password))
+	} else if h.helper != nil {
+		auth = append(auth, ssh.PasswordCallback(h.helperPassword))
+	}
+	if h.helper != nil || h.otp != nil {
+		auth = append(auth, ssh.KeyboardInteractive(h.challenge))
+	}
+	if h.hostData.AuthPlugin != nil {
+		h.plugin = newPluginAuth(h.hostData.Host)
+		auth = append(auth, h.plugin.methods()...)
+	}
+	if config.FIPSFlag && len(auth) == 0 {
+		log.Printf("  Error - host (%s) has no means of authentication allowed in fips mode\n", h.hostData.Name)
+		h.valid = false
 	}
 	h.config = &ssh.ClientConfig{
-		User: h.hostData.Username,
-		Auth: []ssh.AuthMethod{
-			ssh.PublicKeys(identityMap[h.hostData.Identity]),
-		},
+		User:            h.hostData.Username,
+		Auth:            auth,
 		HostKeyCallback: hostKeysMap[h.hostData.KnownHosts].Callback,
+		BannerCallback:  h.bannerCallback,
+	}
+	switch h.hostData.HostKeyPolicy {
+	case "", config.HostKeyAcceptNew:
+		if config.FIPSFlag {
+			// Unknown keys are refused rather than trusted on first use
+			h.config.HostKeyCallback = hostKeysMap[h.hostData.KnownHosts].StrictCallback
+		}
+	case config.HostKeyStrict:
+		if hostKeysMap[h.hostData.KnownHosts] == nil {
+			log.Printf("  Error - host (%s) strict host key policy requires a known_hosts file\n", h.hostData.Name)
+			h.valid = false
+		}
+		h.config.HostKeyCallback = hostKeysMap[h.hostData.KnownHosts].StrictCallback
+	case config.HostKeyOff:
+		if config.FIPSFlag {
+			log.Printf("  Error - host (%s) host key policy (%s) is refused in fips mode\n", h.hostData.Name, config.HostKeyOff)
+			h.valid = false
+			break
+		}
+		log.Printf("  Warn  - host (%s) host keys are not checked\n", h.hostData.Name)
+		warning = true
+		h.config.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+	default:
+		log.Printf("  Error - host (%s) host key policy (%s) must be %s, %s or %s\n",
+			h.hostData.Name, h.hostData.HostKeyPolicy, config.HostKeyAcceptNew, config.HostKeyStrict, config.HostKeyOff)
+		h.valid = false
+	}
+	if config.FIPSFlag && h.hostData.HostKeyPolicy != config.HostKeyOff && hostKeysMap[h.hostData.KnownHosts] == nil {
+		log.Printf("  Error - host (%s) host keys must be checked in fips mode, which requires a known_hosts file\n", h.hostData.Name)
+		h.valid = false
 	}
+	applyAlgorithms(h.config, h.hostData.Algorithms)
+	applyFIPS(h.config)
 
 	if config.VerboseFlag && h.valid && !warning {
-		fmt.Printf("  Info  - host (%s) validated\n", h.hostData.Name)
+		log.Printf("  Info  - host (%s) validated\n", h.hostData.Name)
 	}
 	return h.valid
 }
@@ -0,0 +1,80 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package host
+
+import (
+	"slices"
+
+	"golang.org/x/crypto/ssh"
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/log"
+)
+
+// The algorithms approved by FIPS 140-3 that the ssh library supports, to
+// which --fips restricts every host.  Curve25519 and ed25519 are left out, as
+// they are not approved for key agreement and signing in every profile
+var (
+	fipsCiphers = []string{
+		"aes128-gcm@openssh.com", "aes256-gcm@openssh.com",
+		"aes128-ctr", "aes192-ctr", "aes256-ctr",
+	}
+	fipsMACs = []string{
+		"hmac-sha2-256-etm@openssh.com", "hmac-sha2-512-etm@openssh.com",
+		"hmac-sha2-256", "hmac-sha2-512",
+	}
+	fipsKeyExchanges = []string{
+		"ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521",
+		"diffie-hellman-group16-sha512", "diffie-hellman-group14-sha256",
+		"diffie-hellman-group-exchange-sha256",
+	}
+	fipsHostKeyAlgorithms = []string{
+		ssh.CertAlgoECDSA256v01, ssh.CertAlgoECDSA384v01, ssh.CertAlgoECDSA521v01,
+		ssh.CertAlgoRSASHA512v01, ssh.CertAlgoRSASHA256v01,
+		ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521,
+		ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256,
+	}
+)
+
+// validateFIPS checks the host's configured algorithms are each approved in
+// fips mode
+func validateFIPS(name string, algorithms *config.Algorithms) bool {
+	if !config.FIPSFlag || algorithms == nil {
+		return true
+	}
+	valid := true
+	check := func(kind string, values []string, approved []string) {
+		for _, value := range values {
+			if !slices.Contains(approved, value) {
+				log.Printf("  Error - host (%s) %s (%s) is not approved in fips mode\n", name, kind, value)
+				valid = false
+			}
+		}
+	}
+	check("cipher", algorithms.Ciphers, fipsCiphers)
+	check("mac", algorithms.MACs, fipsMACs)
+	check("key exchange", algorithms.KeyExchanges, fipsKeyExchanges)
+	check("host key algorithm", algorithms.HostKeyAlgorithms, fipsHostKeyAlgorithms)
+	return valid
+}
+
+// applyFIPS restricts the algorithms the host has not configured to those
+// approved, in fips mode
+func applyFIPS(cfg *ssh.ClientConfig) {
+	if !config.FIPSFlag {
+		return
+	}
+	if len(cfg.Ciphers) == 0 {
+		cfg.Ciphers = fipsCiphers
+	}
+	if len(cfg.MACs) == 0 {
+		cfg.MACs = fipsMACs
+	}
+	if len(cfg.KeyExchanges) == 0 {
+		cfg.KeyExchanges = fipsKeyExchanges
+	}
+	if len(cfg.HostKeyAlgorithms) == 0 {
+		cfg.HostKeyAlgorithms = fipsHostKeyAlgorithms
+	}
+}
@@ -0,0 +1,172 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package host
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	krbclient "github.com/jcmturner/gokrb5/v8/client"
+	krbconfig "github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"golang.org/x/crypto/ssh"
+	"us.figge.auto-ssh/internal/core/config"
+)
+
+const defaultKrb5Conf = "/etc/krb5.conf"
+
+// krb5Client answers gssapi-with-mic authentication with the Kerberos tickets
+// of a credentials cache, read afresh for each connection so tickets renewed
+// by kinit or sssd are used
+type krb5Client struct {
+	ccache   string
+	krb5Conf string
+	lock     sync.Mutex
+	key      types.EncryptionKey
+	seq      int64
+	flags    byte
+}
+
+func newKrb5Client(cfg *config.GSSAPI) *krb5Client {
+	k := &krb5Client{ccache: cfg.CCache, krb5Conf: cfg.Krb5Conf}
+	if k.ccache == "" {
+		k.ccache = os.Getenv("KRB5CCNAME")
+	}
+	if k.ccache == "" && os.Getuid() >= 0 {
+		k.ccache = fmt.Sprintf("/tmp/krb5cc_%d", os.Getuid())
+	}
+	k.ccache = strings.TrimPrefix(k.ccache, "FILE:")
+	if k.krb5Conf == "" {
+		k.krb5Conf = os.Getenv("KRB5_CONFIG")
+	}
+	if k.krb5Conf == "" {
+		k.krb5Conf = defaultKrb5Conf
+	}
+	return k
+}
+
+// validate checks the Kerberos configuration can be read, and warns when the
+// credentials cache holds no tickets yet
+func (k *krb5Client) validate(hostName string) (bool, string) {
+	if k.ccache == "" {
+		return false, "gssapi credentials cache unknown. Set gssapi.ccache or KRB5CCNAME"
+	}
+	if kind, _, ok := strings.Cut(k.ccache, ":"); ok && len(kind) > 1 {
+		return false, fmt.Sprintf("gssapi credentials cache (%s) must be a file, %s caches are not supported", k.ccache, kind)
+	}
+	if _, err := krbconfig.Load(k.krb5Conf); err != nil {
+		return false, fmt.Sprintf("gssapi kerberos configuration (%s) cannot be read: %v", k.krb5Conf, err)
+	}
+	if _, err := os.Stat(k.ccache); err != nil {
+		return true, fmt.Sprintf("gssapi credentials cache (%s) not found. Run kinit before host (%s) connects", k.ccache, hostName)
+	}
+	return true, ""
+}
+
+// InitSecContext sends the service ticket of the target in an AP-REQ, then
+// takes the session subkey from the server's AP-REP when it asserts one
+func (k *krb5Client) InitSecContext(target string, token []byte, _ bool) ([]byte, bool, error) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	if token != nil {
+		return nil, false, k.acceptReply(token)
+	}
+	cfg, err := krbconfig.Load(k.krb5Conf)
+	if err != nil {
+		return nil, false, err
+	}
+	ccache, err := credentials.LoadCCache(k.ccache)
+	if err != nil {
+		return nil, false, fmt.Errorf("kerberos credentials cache (%s) cannot be read: %v", k.ccache, err)
+	}
+	cl, err := krbclient.NewFromCCache(ccache, cfg, krbclient.DisablePAFXFAST(true))
+	if err != nil {
+		return nil, false, fmt.Errorf("kerberos credentials cache (%s) cannot be used: %v", k.ccache, err)
+	}
+	defer cl.Destroy()
+	tkt, key, err := cl.GetServiceTicket(target)
+	if err != nil {
+		return nil, false, fmt.Errorf("kerberos service ticket for %s unavailable: %v", target, err)
+	}
+	krbToken, err := spnego.NewKRB5TokenAPREQ(cl, tkt, key,
+		[]int{gssapi.ContextFlagInteg, gssapi.ContextFlagMutual}, []int{flags.APOptionMutualRequired})
+	if err != nil {
+		return nil, false, err
+	}
+	if err = krbToken.APReq.DecryptAuthenticator(key); err != nil {
+		return nil, false, err
+	}
+	k.key, k.seq, k.flags = key, krbToken.APReq.Authenticator.SeqNumber, 0
+	out, err := krbToken.Marshal()
+	return out, true, err
+}
+
+func (k *krb5Client) acceptReply(token []byte) error {
+	var reply spnego.KRB5Token
+	if err := reply.Unmarshal(token); err != nil {
+		return err
+	}
+	if reply.IsKRBError() {
+		return fmt.Errorf("kerberos error: %s", reply.KRBError.Error())
+	}
+	if !reply.IsAPRep() {
+		return errors.New("kerberos reply is not an AP-REP")
+	}
+	bs, err := crypto.DecryptEncPart(reply.APRep.EncPart, k.key, keyusage.AP_REP_ENCPART)
+	if err != nil {
+		return fmt.Errorf("kerberos AP-REP cannot be decrypted: %v", err)
+	}
+	var part messages.EncAPRepPart
+	if err = part.Unmarshal(bs); err != nil {
+		return err
+	}
+	if len(part.Subkey.KeyValue) > 0 {
+		k.key, k.flags = part.Subkey, gssapi.MICTokenFlagAcceptorSubkey
+	}
+	return nil
+}
+
+// GetMIC signs the ssh session identifier, proving the context is ours
+func (k *krb5Client) GetMIC(micField []byte) ([]byte, error) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	token := gssapi.MICToken{Flags: k.flags, SndSeqNum: uint64(k.seq), Payload: micField}
+	if err := token.SetChecksum(k.key, keyusage.GSSAPI_INITIATOR_SIGN); err != nil {
+		return nil, err
+	}
+	return token.Marshal()
+}
+
+func (k *krb5Client) DeleteSecContext() error {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	clear(k.key.KeyValue)
+	k.key = types.EncryptionKey{}
+	return nil
+}
+
+// gssapiMethod authenticates the host with its Kerberos tickets
+func (h *Entry) gssapiMethod() ssh.AuthMethod {
+	target := h.hostData.GSSAPI.ServicePrincipal
+	if target == "" {
+		host, _, err := net.SplitHostPort(h.hostData.Remote.String())
+		if err != nil {
+			host = h.hostData.Remote.String()
+		}
+		target = "host/" + strings.ToLower(host)
+	}
+	return ssh.GSSAPIWithMICAuthMethod(h.krb5, target)
+}
@@ -5,19 +5,27 @@
 package host
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"os"
+	"slices"
+	"strings"
 	"sync"
 
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/knownhosts"
+	"us.figge.auto-ssh/internal/core/log"
 )
 
 type hostKeyEntry struct {
-	hash string
-	line int
+	hash        string
+	fingerprint string
+	line        int
 }
 
 type HostKeyManager struct {
@@ -27,6 +35,29 @@ type HostKeyManager struct {
 	lines         int
 }
 
+// KnownKey is a key of a host recorded in the known_hosts file
+type KnownKey struct {
+	Type        string
+	Fingerprint string
+	Line        int
+}
+
+// HostKeyChangedError reports a host presenting a key other than the one
+// recorded for it in the known_hosts file
+type HostKeyChangedError struct {
+	Host      string
+	File      string
+	Line      int
+	Type      string
+	Known     string
+	Presented string
+}
+
+func (e *HostKeyChangedError) Error() string {
+	return fmt.Sprintf("host '%s' %s key has changed from %s (known_hosts (%s) line %d) to %s",
+		e.Host, e.Type, e.Known, e.File, e.Line, e.Presented)
+}
+
 var (
 	InsecureHostKey = &HostKeyManager{
 		knownHostFile: "",
@@ -34,42 +65,60 @@ var (
 )
 
 func NewHostKeyManager(knownHostFile string) (*HostKeyManager, error) {
-	bs, err := os.ReadFile(knownHostFile)
-	if err != nil {
+	h := &HostKeyManager{knownHostFile: knownHostFile}
+	if err := h.load(); err != nil {
 		return nil, err
 	}
-	var hs []string
-	var pk ssh.PublicKey
+	return h, nil
+}
 
+// load reads the keys of the known_hosts file, recording the line each is on
+func (h *HostKeyManager) load() error {
+	bs, err := os.ReadFile(h.knownHostFile)
+	if err != nil {
+		return err
+	}
 	knownKeys := make(map[string]map[string]hostKeyEntry)
-	line := 1
-	for _, hs, pk, _, bs, err = ssh.ParseKnownHosts(bs); err == nil; _, hs, pk, _, bs, err = ssh.ParseKnownHosts(bs) {
-		key := hostKeyEntry{hash: base64.StdEncoding.EncodeToString(pk.Marshal())}
-		for _, h := range hs {
-			if types, ok := knownKeys[h]; !ok {
-				knownKeys[h] = map[string]hostKeyEntry{pk.Type(): key}
+	lines := strings.Split(string(bs), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	for i, text := range lines {
+		line := i + 1
+		_, hs, pk, _, _, err := ssh.ParseKnownHosts([]byte(text))
+		if errors.Is(err, io.EOF) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("%w, line %d", err, line)
+		}
+		key := hostKeyEntry{hash: base64.StdEncoding.EncodeToString(pk.Marshal()), fingerprint: ssh.FingerprintSHA256(pk), line: line}
+		for _, hst := range hs {
+			if types, ok := knownKeys[hst]; !ok {
+				knownKeys[hst] = map[string]hostKeyEntry{pk.Type(): key}
 			} else if knownKey, ok2 := types[pk.Type()]; !ok2 {
 				types[pk.Type()] = key
 			} else if knownKey.hash == key.hash {
-				fmt.Printf("  Info  - known_hosts (%s) duplicate entries on lines %d and %d\n", knownHostFile, key.line, line)
+				log.Printf("  Info  - known_hosts (%s) duplicate entries on lines %d and %d\n", h.knownHostFile, knownKey.line, line)
 			} else {
-				return nil, fmt.Errorf("known_hosts (%s) inconsistent entries on lines %d and %d\n", knownHostFile, key.line, line)
+				return fmt.Errorf("known_hosts (%s) inconsistent entries on lines %d and %d", h.knownHostFile, knownKey.line, line)
 			}
 		}
-		line++
-	}
-	if err.Error() != "EOF" {
-		return nil, fmt.Errorf("%w, line %d", err, line)
 	}
-	return &HostKeyManager{
-		knownHostFile: knownHostFile,
-		knownKeys:     knownKeys,
-		lines:         line,
-	}, nil
+	h.knownKeys, h.lines = knownKeys, len(lines)
+	return nil
 }
 
 func (h *HostKeyManager) Callback(hostname string, remote net.Addr, key ssh.PublicKey) error {
-	if h.knownKeys == nil {
+	return h.check(hostname, key, true)
+}
+
+// StrictCallback accepts only the keys already in the known_hosts file
+func (h *HostKeyManager) StrictCallback(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	return h.check(hostname, key, false)
+}
+
+func (h *HostKeyManager) check(hostname string, key ssh.PublicKey, acceptNew bool) error {
+	if h == nil || h.knownKeys == nil {
 		return nil
 	}
 	h.lock.Lock()
@@ -77,27 +126,50 @@ func (h *HostKeyManager) Callback(hostname string, remote net.Addr, key ssh.Publ
 	ip := knownhosts.Normalize(hostname)
 	hash := base64.StdEncoding.EncodeToString(key.Marshal())
 	types, ok := h.knownKeys[ip]
+	if !ok && !acceptNew {
+		return fmt.Errorf("host '%s' is not in known_hosts (%s)", ip, h.knownHostFile)
+	}
 	if !ok {
 		err := h.appendHostKey(hostname, key)
 		if err == nil {
 			h.lines++
-			h.knownKeys[ip] = map[string]hostKeyEntry{key.Type(): {hash: hash, line: h.lines}}
+			h.knownKeys[ip] = map[string]hostKeyEntry{key.Type(): {hash: hash, fingerprint: ssh.FingerprintSHA256(key), line: h.lines}}
 		}
 		return err
 	}
 	knownKey, ok2 := types[key.Type()]
+	if !ok2 && !acceptNew {
+		return fmt.Errorf("host '%s' %s key is not in known_hosts (%s)", ip, key.Type(), h.knownHostFile)
+	}
 	if !ok2 {
 		err := h.appendHostKey(hostname, key)
 		if err == nil {
 			h.lines++
-			types[key.Type()] = hostKeyEntry{hash: hash, line: h.lines}
+			types[key.Type()] = hostKeyEntry{hash: hash, fingerprint: ssh.FingerprintSHA256(key), line: h.lines}
 		}
 		return err
 	}
 	if knownKey.hash == hash {
 		return nil
 	}
-	return fmt.Errorf("the authenticity of host '%s' can't be established", ip)
+	return &HostKeyChangedError{
+		Host:      ip,
+		File:      h.knownHostFile,
+		Line:      knownKey.line,
+		Type:      key.Type(),
+		Known:     knownKey.fingerprint,
+		Presented: ssh.FingerprintSHA256(key),
+	}
+}
+
+// logKeyChanged explains the host key mismatch that refused the connection and
+// how to accept the new key once it is known to be genuine
+func (h *Entry) logKeyChanged(changed *HostKeyChangedError) {
+	log.Printf("  Error - host (%s) %s key has changed. Someone could be impersonating the host, or its key was replaced\n",
+		h.hostData.Name, changed.Type)
+	log.Printf("  Error -   known     %s (known_hosts (%s) line %d)\n", changed.Known, changed.File, changed.Line)
+	log.Printf("  Error -   presented %s\n", changed.Presented)
+	log.Printf("  Error -   once the new key is verified, run: ash hostkey replace %s\n", h.hostData.Name)
 }
 
 func (h *HostKeyManager) appendHostKey(hostname string, key ssh.PublicKey) error {
@@ -105,19 +177,97 @@ func (h *HostKeyManager) appendHostKey(hostname string, key ssh.PublicKey) error
 		return nil
 	}
 	ip := knownhosts.Normalize(hostname)
-	fmt.Printf("Warning: Permanently added '%s' (%s) to the list of known hosts.\n", ip, key.Type())
-	line := fmt.Sprintf("%s %s %s", ip, key.Type(), base64.StdEncoding.EncodeToString(key.Marshal()))
+	log.Printf("  Warn  - permanently added '%s' (%s) to the list of known hosts\n", ip, key.Type())
+	line := knownhosts.Line([]string{hostname}, key) + "\n"
 
 	f, err := os.OpenFile(h.knownHostFile, os.O_APPEND|os.O_WRONLY, 0600)
 	if err != nil {
-		fmt.Printf("  Error - failed to append known host to %s: %v\n", h.knownHostFile, err)
+		log.Printf("  Error - failed to append known host to %s: %v\n", h.knownHostFile, err)
 		return err
 	}
 	defer func() { _ = f.Close() }()
 
 	if _, err = f.WriteString(line); err != nil {
-		fmt.Printf("  Error - failed to write known host to %s: %v\n", h.knownHostFile, err)
+		log.Printf("  Error - failed to write known host to %s: %v\n", h.knownHostFile, err)
+		return err
+	}
+	return nil
+}
+
+// Add appends the key for the hostname to the known_hosts file.  A key that is
+// already known is silently accepted
+func (h *HostKeyManager) Add(hostname string, key ssh.PublicKey) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	ip := knownhosts.Normalize(hostname)
+	hash := base64.StdEncoding.EncodeToString(key.Marshal())
+	types, ok := h.knownKeys[ip]
+	if !ok {
+		types = make(map[string]hostKeyEntry)
+		h.knownKeys[ip] = types
+	} else if knownKey, ok2 := types[key.Type()]; ok2 {
+		if knownKey.hash == hash {
+			return nil
+		}
+		return fmt.Errorf("known_hosts (%s) has a different %s key for %s on line %d", h.knownHostFile, key.Type(), ip, knownKey.line)
+	}
+	if err := h.appendHostKey(hostname, key); err != nil {
 		return err
 	}
+	h.lines++
+	types[key.Type()] = hostKeyEntry{hash: hash, fingerprint: ssh.FingerprintSHA256(key), line: h.lines}
 	return nil
 }
+
+// Remove deletes every plain-text known_hosts line that references the hostname,
+// returning the number of lines removed
+func (h *HostKeyManager) Remove(hostname string) (int, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	ip := knownhosts.Normalize(hostname)
+	bs, err := os.ReadFile(h.knownHostFile)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	out := bytes.Buffer{}
+	scanner := bufio.NewScanner(bytes.NewReader(bs))
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+		if len(fields) > 1 && !strings.HasPrefix(fields[0], "#") && !strings.HasPrefix(fields[0], "@") &&
+			slices.Contains(strings.Split(fields[0], ","), ip) {
+			removed++
+			continue
+		}
+		out.WriteString(line)
+		out.WriteString("\n")
+	}
+	if err = scanner.Err(); err != nil {
+		return 0, err
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	if err = os.WriteFile(h.knownHostFile, out.Bytes(), 0600); err != nil {
+		return 0, err
+	}
+	// The lines that follow have moved up, so their numbers are read again
+	if err = h.load(); err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
+
+// Known lists the keys recorded for the hostname, by type
+func (h *HostKeyManager) Known(hostname string) []KnownKey {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	var known []KnownKey
+	for keyType, entry := range h.knownKeys[knownhosts.Normalize(hostname)] {
+		known = append(known, KnownKey{Type: keyType, Fingerprint: entry.fingerprint, Line: entry.line})
+	}
+	slices.SortFunc(known, func(a, b KnownKey) int { return a.Line - b.Line })
+	return known
+}
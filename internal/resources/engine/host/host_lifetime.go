@@ -0,0 +1,139 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package host
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/killswitch"
+	"us.figge.auto-ssh/internal/core/log"
+)
+
+// LimitLifetime shortens the lifetime of the host's ssh connection to that of
+// a tunnel using it
+func (h *Entry) LimitLifetime(lifetime time.Duration) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.lifetime == 0 || lifetime < h.lifetime {
+		h.lifetime = lifetime
+	}
+}
+
+// expire arms the renewal of a newly connected ssh client once its lifetime
+// is up.  Must be called holding the lock
+func (h *Entry) expire(client *ssh.Client) {
+	if h.lifeTimer != nil {
+		h.lifeTimer.Stop()
+		h.lifeTimer = nil
+	}
+	if h.lifetime > 0 {
+		h.lifeTimer = time.AfterFunc(h.lifetime, func() { h.renew(client) })
+	}
+}
+
+// renew replaces the ssh client once it has reached its lifetime.  The client
+// is retired, left to carry the connections already forwarded through it until
+// they close, while new ones are opened on a fresh client.  The identity is
+// read again first, so a short-lived key or certificate renewed on disk is used
+func (h *Entry) renew(client *ssh.Client) {
+	h.lock.Lock()
+	if h.client != client {
+		h.lock.Unlock()
+		return
+	}
+	log.Printf("  Info  - host (%s) connection reached its lifetime of %v. Renewing\n", h.hostData.Name, h.lifetime)
+	h.lifeTimer = nil
+	inUse := h.refs > 0
+	h.retire()
+	h.reloadIdentity()
+	h.lock.Unlock()
+	if inUse {
+		h.Open()
+	}
+}
+
+// retire takes the current client out of use, closing it straight away when
+// nothing is forwarded through it.  Must be called holding the lock
+func (h *Entry) retire() {
+	if h.idleTimer != nil {
+		h.idleTimer.Stop()
+		h.idleTimer = nil
+	}
+	if h.refs == 0 {
+		_ = h.client.Close()
+	} else {
+		if h.retired == nil {
+			h.retired = make(map[*ssh.Client]int)
+		}
+		h.retired[h.client] = h.refs
+		log.Printf("  Info  - host (%s) draining %d connection(s) from the previous ssh connection\n", h.hostData.Name, h.refs)
+	}
+	h.client = nil
+	h.refs = 0
+	h.retireOverflows()
+}
+
+// drained releases a reference on a retired client, closing it with the last.
+// Must be called holding the lock
+func (h *Entry) drained(client *ssh.Client, refs int) {
+	if refs > 1 {
+		h.retired[client] = refs - 1
+		return
+	}
+	delete(h.retired, client)
+	_ = client.Close()
+	log.Printf("  Info  - host (%s) previous ssh connection drained\n", h.hostData.Name)
+}
+
+// parseIdentity returns the signer of the identity, delegating to ssh-agent
+// for a security key.  The private key is protected by the kill switch
+func (h *Entry) parseIdentity(key []byte) (ssh.Signer, error) {
+	if public, ok := securityKey(key); ok {
+		return newAgentSigner(h.hostData.Name, public), nil
+	}
+	var raw any
+	var err error
+	if h.hostData.Passphrase != "" {
+		raw, err = ssh.ParseRawPrivateKeyWithPassphrase(key, []byte(h.hostData.Passphrase))
+	} else {
+		raw, err = ssh.ParseRawPrivateKey(key)
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) && h.helper != nil {
+			raw, err = h.helperPassphrase(key)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	killswitch.Protect("identity "+h.hostData.Id, raw)
+	return ssh.NewSignerFromKey(raw)
+}
+
+// reloadIdentity parses the identity file again for the next connection,
+// keeping the current identity when it can no longer be read.  Must be called
+// holding the lock
+func (h *Entry) reloadIdentity() {
+	if h.hostData.Identity == "" || !config.IsFileIdentity(h.hostData.Identity) || len(h.config.Auth) == 0 {
+		return
+	}
+	key, err := os.ReadFile(h.hostData.Identity)
+	if err != nil {
+		log.Printf("  Warn  - host (%s) identity file (%s) cannot be reloaded: %v\n", h.hostData.Name, h.hostData.Identity, err)
+		return
+	}
+	signer, err := h.parseIdentity(key)
+	if err != nil {
+		log.Printf("  Warn  - host (%s) identity file (%s) cannot be reloaded: %v\n", h.hostData.Name, h.hostData.Identity, err)
+		return
+	}
+	// The identity, when there is one, is always the first means of authentication
+	cfg := *h.config
+	cfg.Auth = append([]ssh.AuthMethod{ssh.PublicKeys(signer)}, h.config.Auth[1:]...)
+	h.config = &cfg
+}
@@ -0,0 +1,52 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package host
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// remoteListener is a listener on the host's shared ssh connection.  Closing it
+// releases the reference it holds on the connection
+type remoteListener struct {
+	net.Listener
+	once    sync.Once
+	release func()
+}
+
+func (l *remoteListener) Close() error {
+	err := l.Listener.Close()
+	l.once.Do(l.release)
+	return err
+}
+
+// Listen has the host listen on the address, as ssh -R does, the connections
+// it accepts arriving over the host's shared ssh connection.  The connection
+// is kept open while the listener is.  A request failing on a broken
+// connection reconnects and retries once
+func (h *Entry) Listen(address string) (net.Listener, error) {
+	for attempt := 0; ; attempt++ {
+		client, ok := h.reserve()
+		if !ok {
+			return nil, fmt.Errorf("host (%s) unavailable", h.hostData.Name)
+		}
+		ln, err := client.Listen("tcp", address)
+		if err == nil {
+			return &remoteListener{Listener: ln, release: func() { h.release(client) }}, nil
+		}
+		broken := errors.Is(err, io.EOF)
+		if broken {
+			h.discard(client)
+		}
+		h.release(client)
+		if !broken || attempt > 0 {
+			return nil, fmt.Errorf("host (%s) refused to listen on %s: %w", h.hostData.Name, address, err)
+		}
+	}
+}
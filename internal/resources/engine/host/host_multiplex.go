@@ -0,0 +1,132 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package host
+
+import (
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/log"
+)
+
+// overflow is an additional ssh connection to the host, opened once the shared
+// connection carries the host's maximum number of channels, so chatty tunnels
+// are not held to the bandwidth of a single connection
+type overflow struct {
+	client    *ssh.Client
+	refs      int
+	idleTimer *time.Timer
+}
+
+// reserveOverflow takes a reference on an additional connection with a free
+// channel, connecting a new one when all are full.  Must be called holding
+// the lock, which is let go while connecting
+func (h *Entry) reserveOverflow() (*ssh.Client, bool) {
+	for _, o := range h.overflows {
+		if o.refs < h.hostData.MaxChannels {
+			o.refs++
+			if o.idleTimer != nil {
+				o.idleTimer.Stop()
+				o.idleTimer = nil
+			}
+			return o.client, true
+		}
+	}
+	cfg := h.config
+	h.lock.Unlock()
+	client, err := h.connect(cfg)
+	h.lock.Lock()
+	if err != nil {
+		log.Printf("  Error - host (%s) failed to open an additional connection: %v\n", h.hostData.Name, err)
+		return nil, false
+	}
+	h.overflows = append(h.overflows, &overflow{client: client, refs: 1})
+	if config.VerboseFlag {
+		log.Printf("  Info  - host (%s) opened additional ssh connection %d of %d channels each\n",
+			h.hostData.Name, len(h.overflows)+1, h.hostData.MaxChannels)
+	}
+	return client, true
+}
+
+// releaseOverflow releases a reference on an additional connection, closing it
+// once it has gone unused for the host's idle timeout.  Must be called holding
+// the lock
+func (h *Entry) releaseOverflow(client *ssh.Client) bool {
+	o := h.overflow(client)
+	if o == nil {
+		return false
+	}
+	o.refs--
+	if o.refs == 0 {
+		o.idleTimer = time.AfterFunc(h.hostData.Timeouts.IdleTimeout(), func() {
+			h.lock.Lock()
+			defer h.lock.Unlock()
+			if o.refs == 0 && h.overflow(client) == o {
+				h.dropOverflow(o)
+			}
+		})
+	}
+	return true
+}
+
+func (h *Entry) overflow(client *ssh.Client) *overflow {
+	for _, o := range h.overflows {
+		if o.client == client {
+			return o
+		}
+	}
+	return nil
+}
+
+// dropOverflow closes an additional connection, its channels still to be
+// released as those of a retired one.  Must be called holding the lock
+func (h *Entry) dropOverflow(o *overflow) {
+	if o.idleTimer != nil {
+		o.idleTimer.Stop()
+	}
+	_ = o.client.Close()
+	if o.refs > 0 {
+		if h.retired == nil {
+			h.retired = make(map[*ssh.Client]int)
+		}
+		h.retired[o.client] = o.refs
+	}
+	for i, other := range h.overflows {
+		if other == o {
+			h.overflows = append(h.overflows[:i], h.overflows[i+1:]...)
+			break
+		}
+	}
+}
+
+// retireOverflows retires the additional connections along with the shared one,
+// leaving those in use to drain.  Must be called holding the lock
+func (h *Entry) retireOverflows() {
+	for _, o := range h.overflows {
+		if o.idleTimer != nil {
+			o.idleTimer.Stop()
+		}
+		if o.refs == 0 {
+			_ = o.client.Close()
+		} else {
+			if h.retired == nil {
+				h.retired = make(map[*ssh.Client]int)
+			}
+			h.retired[o.client] = o.refs
+		}
+	}
+	h.overflows = nil
+}
+
+// overflowRefs is the number of channels open on additional connections.  Must
+// be called holding the lock
+func (h *Entry) overflowRefs() int {
+	refs := 0
+	for _, o := range h.overflows {
+		refs += o.refs
+	}
+	return refs
+}
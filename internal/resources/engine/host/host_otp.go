@@ -0,0 +1,158 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package host
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/credhelper"
+	"us.figge.auto-ssh/internal/core/keychain"
+	"us.figge.auto-ssh/internal/core/log"
+	"us.figge.auto-ssh/internal/core/totp"
+)
+
+var defaultOTPPrompt = regexp.MustCompile(`(?i)code|token|otp|one[- ]time|verification`)
+
+// otpResponder answers a host's one-time password prompts with the codes of
+// its TOTP secret, or by asking at the terminal when it has none
+type otpResponder struct {
+	host      string
+	prompt    *regexp.Regexp
+	generator *totp.Generator
+	lock      sync.Mutex
+	last      uint64
+}
+
+// newOTPResponder resolves the host's otp secret, from the environment or the
+// keychain as configured
+func newOTPResponder(host *config.Host) (*otpResponder, error) {
+	o := &otpResponder{host: host.Name, prompt: defaultOTPPrompt}
+	if host.OTP.Prompt != "" {
+		prompt, err := regexp.Compile(host.OTP.Prompt)
+		if err != nil {
+			return nil, fmt.Errorf("otp prompt (%s) is not a regular expression: %v", host.OTP.Prompt, err)
+		}
+		o.prompt = prompt
+	}
+	secret := host.OTP.Secret
+	if name, ok := strings.CutPrefix(secret, "env:"); ok {
+		if secret = os.Getenv(name); secret == "" {
+			return nil, fmt.Errorf("otp secret environment variable (%s) is not set", name)
+		}
+	}
+	if secret == "" && host.Keychain {
+		var err error
+		secret, err = keychain.Get(keychain.Account(host.Name, keychain.KindOTP))
+		if err != nil && !errors.Is(err, keychain.ErrNotFound) {
+			return nil, fmt.Errorf("otp secret cannot be read from the keychain: %v", err)
+		}
+	}
+	if secret == "" {
+		return o, nil
+	}
+	if host.OTP.Period < 0 {
+		return nil, fmt.Errorf("otp period (%s) cannot be negative", host.OTP.Period)
+	}
+	generator, err := totp.New(secret, host.OTP.Digits, time.Duration(host.OTP.Period))
+	if err != nil {
+		return nil, fmt.Errorf("otp secret cannot be used: %v", err)
+	}
+	o.generator = generator
+	return o, nil
+}
+
+func (o *otpResponder) matches(prompt string) bool {
+	return o.prompt.MatchString(prompt)
+}
+
+// answer returns a code for the prompt.  Servers refuse a code used before, so
+// a reconnect within the period of the last code waits for the next one
+func (o *otpResponder) answer(prompt string, echo bool) (string, error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.generator == nil {
+		return o.ask(prompt, echo)
+	}
+	now := time.Now()
+	counter := o.generator.Counter(now)
+	if counter <= o.last {
+		next := o.generator.Next(now)
+		log.Printf("  Info  - host (%s) waiting %s for a fresh one-time password\n", o.host, next.Sub(now).Round(time.Second))
+		time.Sleep(time.Until(next))
+		counter = o.generator.Counter(next)
+	}
+	o.last = counter
+	return o.generator.Code(counter), nil
+}
+
+// ask reads the code from the terminal.  Without one the prompt goes unanswered
+func (o *otpResponder) ask(prompt string, echo bool) (string, error) {
+	tty, err := os.OpenFile(ttyName, os.O_RDWR, 0)
+	if err != nil {
+		return "", fmt.Errorf("one-time password cannot be asked: %v", err)
+	}
+	defer func() { _ = tty.Close() }()
+	_, _ = fmt.Fprintf(tty, "host (%s) %s", o.host, prompt)
+	var answer string
+	if echo {
+		answer, err = bufio.NewReader(tty).ReadString('\n')
+	} else {
+		var bs []byte
+		bs, err = term.ReadPassword(int(tty.Fd()))
+		_, _ = fmt.Fprintln(tty)
+		answer = string(bs)
+	}
+	if err != nil {
+		return "", fmt.Errorf("one-time password cannot be read: %v", err)
+	}
+	return strings.TrimSpace(answer), nil
+}
+
+// clear forgets the secret, for the kill switch
+func (o *otpResponder) clear() {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.generator != nil {
+		o.generator.Clear()
+		o.generator = nil
+	}
+}
+
+// challenge answers keyboard-interactive questions, one-time password prompts
+// with the host's otp and any others through its credential helper
+func (h *Entry) challenge(_ string, _ string, prompts []string, echos []bool) ([]string, error) {
+	answers := make([]string, len(prompts))
+	for i, prompt := range prompts {
+		var err error
+		switch {
+		case h.otp != nil && h.otp.matches(prompt):
+			answers[i], err = h.otp.answer(prompt, echos[i])
+		case config.FIPSFlag && !echos[i] && strings.Contains(strings.ToLower(prompt), "password"):
+			err = fmt.Errorf("password prompt %q refused in fips mode", strings.TrimSpace(prompt))
+		case h.helper != nil:
+			kind := credhelper.KindOTP
+			if !echos[i] && strings.Contains(strings.ToLower(prompt), "password") {
+				kind = credhelper.KindPassword
+			}
+			answers[i], err = h.helperSecret(kind, prompt)
+		default:
+			err = fmt.Errorf("no answer to prompt %q", strings.TrimSpace(prompt))
+		}
+		if err != nil {
+			log.Printf("  Error - host (%s) keyboard-interactive: %v\n", h.hostData.Name, err)
+			return nil, err
+		}
+	}
+	return answers, nil
+}
@@ -0,0 +1,157 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package host
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"us.figge.auto-ssh/internal/core/authplugin"
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/killswitch"
+	"us.figge.auto-ssh/internal/core/log"
+)
+
+// pluginAuth authenticates a host with the credentials of its auth plugin,
+// asking for them once per connection unless the plugin says they last longer
+type pluginAuth struct {
+	host    *config.Host
+	lock    sync.Mutex
+	creds   *authplugin.Response
+	signers []ssh.Signer
+}
+
+func newPluginAuth(host *config.Host) *pluginAuth {
+	return &pluginAuth{host: host}
+}
+
+// methods are the means of authentication backed by the plugin, passwords
+// being refused in fips mode
+func (p *pluginAuth) methods() []ssh.AuthMethod {
+	if config.FIPSFlag {
+		return []ssh.AuthMethod{ssh.PublicKeysCallback(p.publicKeys), ssh.KeyboardInteractive(p.challenge)}
+	}
+	return []ssh.AuthMethod{
+		ssh.PublicKeysCallback(p.publicKeys),
+		ssh.PasswordCallback(p.password),
+		ssh.KeyboardInteractive(p.challenge),
+	}
+}
+
+// expire drops the credentials of the previous connection, unless they have
+// yet to expire
+func (p *pluginAuth) expire() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.creds != nil && !p.creds.Usable(time.Now()) {
+		p.creds, p.signers = nil, nil
+	}
+}
+
+func (p *pluginAuth) credentials() (*authplugin.Response, []ssh.Signer, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.creds != nil {
+		return p.creds, p.signers, nil
+	}
+	resp, err := p.run(&authplugin.Request{Type: authplugin.RequestCredentials})
+	if err != nil {
+		log.Printf("  Error - host (%s) %v\n", p.host.Name, err)
+		return nil, nil, err
+	}
+	var signers []ssh.Signer
+	if resp.PrivateKey != "" {
+		signer, err := pluginSigner(p.host.Id, resp)
+		if err != nil {
+			log.Printf("  Error - host (%s) auth plugin key cannot be used: %v\n", p.host.Name, err)
+			return nil, nil, err
+		}
+		signers = append(signers, signer)
+	}
+	p.creds, p.signers = resp, signers
+	return resp, signers, nil
+}
+
+func (p *pluginAuth) publicKeys() ([]ssh.Signer, error) {
+	_, signers, err := p.credentials()
+	return signers, err
+}
+
+func (p *pluginAuth) password() (string, error) {
+	creds, _, err := p.credentials()
+	if err != nil {
+		return "", err
+	}
+	if creds.Password == "" {
+		return "", fmt.Errorf("auth plugin gave no password")
+	}
+	return creds.Password, nil
+}
+
+func (p *pluginAuth) challenge(name string, instruction string, prompts []string, echos []bool) ([]string, error) {
+	if len(prompts) == 0 {
+		return nil, nil
+	}
+	req := &authplugin.Request{Type: authplugin.RequestChallenge, Name: name, Instruction: instruction}
+	for i, prompt := range prompts {
+		req.Questions = append(req.Questions, authplugin.Question{Prompt: prompt, Echo: echos[i]})
+	}
+	resp, err := p.run(req)
+	if err != nil {
+		log.Printf("  Error - host (%s) %v\n", p.host.Name, err)
+		return nil, err
+	}
+	return resp.Answers, nil
+}
+
+func (p *pluginAuth) run(req *authplugin.Request) (*authplugin.Response, error) {
+	plugin := p.host.AuthPlugin
+	req.Host, req.Username, req.Config = p.host.Name, p.host.Username, plugin.Config
+	if p.host.Remote != nil {
+		req.Remote = p.host.Remote.String()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), plugin.TimeoutOrDefault())
+	defer cancel()
+	return authplugin.Run(ctx, plugin.Command, plugin.Args, req)
+}
+
+// clear forgets the credentials, for the kill switch
+func (p *pluginAuth) clear() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.creds, p.signers = nil, nil
+}
+
+// pluginSigner parses the plugin's private key, signing with its certificate
+// when one accompanies it
+func pluginSigner(id string, resp *authplugin.Response) (ssh.Signer, error) {
+	var raw any
+	var err error
+	if resp.Passphrase != "" {
+		raw, err = ssh.ParseRawPrivateKeyWithPassphrase([]byte(resp.PrivateKey), []byte(resp.Passphrase))
+	} else {
+		raw, err = ssh.ParseRawPrivateKey([]byte(resp.PrivateKey))
+	}
+	if err != nil {
+		return nil, err
+	}
+	killswitch.Protect("plugin "+id, raw)
+	signer, err := ssh.NewSignerFromKey(raw)
+	if err != nil || resp.Certificate == "" {
+		return signer, err
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(resp.Certificate))
+	if err != nil {
+		return nil, fmt.Errorf("certificate cannot be parsed: %v", err)
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("certificate is a public key, not a certificate")
+	}
+	return ssh.NewCertSigner(cert, signer)
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package host
+
+import (
+	"net"
+	"slices"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/log"
+)
+
+// watchAddress looks the host's name up again each resolve interval for as long
+// as the connection lasts, so a name moved elsewhere, as when a bastion fails
+// over by dns, is followed rather than the address resolved at connect.  Hosts
+// given by address, or reached through a jump host which resolves the name
+// itself, are not watched
+func (h *Entry) watchAddress(client *ssh.Client) {
+	if h.jump != nil {
+		return
+	}
+	name, _, err := net.SplitHostPort(h.hostData.Remote.String())
+	if err != nil || net.ParseIP(name) != nil {
+		return
+	}
+	remote, ok := client.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return
+	}
+	interval := h.hostData.Timeouts.ResolveTimeout()
+	time.AfterFunc(interval, func() { h.checkAddress(client, name, remote.IP, interval) })
+}
+
+// checkAddress drops the connection once the name no longer resolves to the
+// address connected to, leaving the next use to connect afresh.  A failed lookup
+// keeps the connection
+func (h *Entry) checkAddress(client *ssh.Client, name string, connected net.IP, interval time.Duration) {
+	ips, err := net.LookupIP(name)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.client != client {
+		return
+	}
+	if err != nil {
+		if config.VerboseFlag {
+			log.Printf("  Warn  - host (%s) %s cannot be resolved, keeping connection: %v\n", h.hostData.Name, name, err)
+		}
+	} else if !slices.ContainsFunc(ips, connected.Equal) {
+		log.Printf("  Info  - host (%s) %s no longer resolves to %s, dropping connection\n", h.hostData.Name, name, connected)
+		if h.idleTimer != nil {
+			h.idleTimer.Stop()
+			h.idleTimer = nil
+		}
+		_ = h.client.Close()
+		h.client = nil
+		return
+	}
+	time.AfterFunc(interval, func() { h.checkAddress(client, name, connected, interval) })
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package host
+
+import (
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"us.figge.auto-ssh/internal/core/log"
+	"us.figge.auto-ssh/internal/core/sshagent"
+)
+
+const opensshKeyMagic = "openssh-key-v1\x00"
+
+// securityKey returns the public key of an sk-ssh-ed25519 or sk-ecdsa identity.
+// Its private part is only a handle to the key held by the security key, so
+// the key is read from the unencrypted public section of the file
+func securityKey(key []byte) (ssh.PublicKey, bool) {
+	block, _ := pem.Decode(key)
+	if block == nil || block.Type != "OPENSSH PRIVATE KEY" || !strings.HasPrefix(string(block.Bytes), opensshKeyMagic) {
+		return nil, false
+	}
+	var header struct {
+		CipherName   string
+		KdfName      string
+		KdfOpts      string
+		NumKeys      uint32
+		PubKey       []byte
+		PrivKeyBlock []byte
+	}
+	if err := ssh.Unmarshal(block.Bytes[len(opensshKeyMagic):], &header); err != nil || header.NumKeys != 1 {
+		return nil, false
+	}
+	public, err := ssh.ParsePublicKey(header.PubKey)
+	if err != nil {
+		return nil, false
+	}
+	switch public.Type() {
+	case ssh.KeyAlgoSKED25519, ssh.KeyAlgoSKECDSA256:
+		return public, true
+	}
+	return nil, false
+}
+
+// agentSigner signs with a security key through ssh-agent, which asks for
+// the key to be touched.  The agent is dialed for each signature so it may be
+// started, or the key added to it, after auto-ssh
+type agentSigner struct {
+	host string
+	key  ssh.PublicKey
+}
+
+func newAgentSigner(host string, key ssh.PublicKey) *agentSigner {
+	s := &agentSigner{host: host, key: key}
+	if err := s.withAgent(func(a agent.ExtendedAgent) error {
+		_, err := s.find(a)
+		return err
+	}); err != nil {
+		log.Printf("  Warn  - host (%s) security key %s: %v\n", host, ssh.FingerprintSHA256(key), err)
+	}
+	return s
+}
+
+func (s *agentSigner) PublicKey() ssh.PublicKey {
+	return s.key
+}
+
+func (s *agentSigner) Sign(_ io.Reader, data []byte) (*ssh.Signature, error) {
+	var signature *ssh.Signature
+	err := s.withAgent(func(a agent.ExtendedAgent) error {
+		key, err := s.find(a)
+		if err != nil {
+			return err
+		}
+		log.Printf("  Info  - host (%s) confirm user presence on security key %s\n", s.host, key.Comment)
+		signature, err = a.Sign(s.key, data)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("security key %s: %w", ssh.FingerprintSHA256(s.key), err)
+	}
+	return signature, nil
+}
+
+func (s *agentSigner) withAgent(fn func(agent.ExtendedAgent) error) error {
+	conn, err := sshagent.Dial()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+	return fn(agent.NewClient(conn))
+}
+
+func (s *agentSigner) find(a agent.ExtendedAgent) (*agent.Key, error) {
+	keys, err := a.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if string(key.Marshal()) == string(s.key.Marshal()) {
+			return key, nil
+		}
+	}
+	return nil, errors.New("not loaded in ssh-agent, add it with ssh-add")
+}
@@ -0,0 +1,27 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package host
+
+import (
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/tor"
+)
+
+// viaTor reports whether the host is connected to through tor, as its
+// transport asks or its onion address requires.  A jump host reaches onion
+// addresses only when it runs tor itself, so those are left to it
+func (h *Entry) viaTor() bool {
+	if h.hostData.Transport == config.TransportTor {
+		return true
+	}
+	return h.hostData.JumpHost == "" && h.hostData.Transport == "" && h.hostData.Remote != nil && tor.IsOnion(h.hostData.Remote.Host())
+}
+
+func torSOCKS() string {
+	if config.C == nil {
+		return config.DefaultTorSOCKS
+	}
+	return config.C.Tor.SOCKSOrDefault()
+}
@@ -0,0 +1,149 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package host
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/websocket"
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/log"
+)
+
+// validateTransport checks how the host's ssh connection is carried
+func (h *Entry) validateTransport() bool {
+	switch h.hostData.Transport {
+	case "", config.TransportTCP:
+		if h.hostData.WebSocket != nil {
+			log.Printf("  Warn  - host (%s) websocket ignored, as its transport is tcp\n", h.hostData.Name)
+		}
+		if h.viaTor() && h.hostData.JumpHost == "" {
+			log.Printf("  Info  - host (%s) is an onion address, connected to through tor\n", h.hostData.Name)
+		}
+		return true
+	case config.TransportTor:
+		if h.hostData.JumpHost != "" {
+			log.Printf("  Error - host (%s) tor transport cannot be combined with a jump host\n", h.hostData.Name)
+			return false
+		}
+		return true
+	case config.TransportWebSocket:
+		if h.hostData.JumpHost != "" {
+			log.Printf("  Error - host (%s) websocket transport cannot be combined with a jump host\n", h.hostData.Name)
+			return false
+		}
+		return h.hostData.WebSocket.Validate("host", h.hostData.Name)
+	default:
+		log.Printf("  Error - host (%s) transport (%s) must be %s, %s or %s\n",
+			h.hostData.Name, h.hostData.Transport, config.TransportTCP, config.TransportWebSocket, config.TransportTor)
+		return false
+	}
+}
+
+// dialWebSocket opens the WebSocket the host's ssh connection is carried in,
+// through the environment's proxy when it names one
+func (h *Entry) dialWebSocket(timeout time.Duration) (net.Conn, error) {
+	ws := h.hostData.WebSocket
+	u, err := url.Parse(ws.URL)
+	if err != nil {
+		return nil, err
+	}
+	origin := &url.URL{Scheme: "http", Host: u.Host}
+	if u.Scheme == "wss" {
+		origin.Scheme = "https"
+	}
+	cfg, err := websocket.NewConfig(u.String(), origin.String())
+	if err != nil {
+		return nil, err
+	}
+	cfg.Header = ws.Header()
+
+	address := u.Host
+	if u.Port() == "" {
+		address = net.JoinHostPort(u.Hostname(), map[string]string{"ws": "80", "wss": "443"}[u.Scheme])
+	}
+	conn, err := dialThroughProxy(origin, address, timeout, h.hostData.Timeouts.FallbackDelay())
+	if err != nil {
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	if u.Scheme == "wss" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12})
+		if err = tlsConn.Handshake(); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("websocket (%s) tls handshake failed: %w", u.Redacted(), err)
+		}
+		conn = tlsConn
+	}
+	wsConn, err := websocket.NewClient(cfg, conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("websocket (%s) upgrade failed: %w", u.Redacted(), err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	wsConn.PayloadType = websocket.BinaryFrame
+	return wsConn, nil
+}
+
+// dialThroughProxy connects to the address, asking the proxy the environment
+// names for the url to connect to it when there is one
+func dialThroughProxy(target *url.URL, address string, timeout time.Duration, fallback time.Duration) (net.Conn, error) {
+	d := &net.Dialer{Timeout: timeout, FallbackDelay: fallback}
+	proxy, err := http.ProxyFromEnvironment(&http.Request{URL: target})
+	if err != nil {
+		return nil, err
+	}
+	if proxy == nil {
+		return d.Dial("tcp", address)
+	}
+	proxyAddress := proxy.Host
+	if proxy.Port() == "" {
+		proxyAddress = net.JoinHostPort(proxy.Hostname(), map[string]string{"http": "80", "https": "443"}[proxy.Scheme])
+	}
+	conn, err := d.Dial("tcp", proxyAddress)
+	if err != nil {
+		return nil, fmt.Errorf("proxy (%s) %w", proxy.Redacted(), err)
+	}
+	if proxy.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: proxy.Hostname(), MinVersion: tls.VersionTLS12})
+		conn = tlsConn
+	}
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	connect := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: http.Header{},
+	}
+	if user := proxy.User; user != nil {
+		password, _ := user.Password()
+		connect.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(user.Username()+":"+password)))
+	}
+	if err = connect.Write(conn); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("proxy (%s) %w", proxy.Redacted(), err)
+	}
+	// The proxy says nothing more until the tunnel it opens is spoken into, so
+	// nothing the reader buffers is lost
+	resp, err := http.ReadResponse(bufio.NewReader(conn), connect)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("proxy (%s) %w", proxy.Redacted(), err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_ = conn.Close()
+		return nil, fmt.Errorf("proxy (%s) refused to connect to %s: %s", proxy.Redacted(), address, resp.Status)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return conn, nil
+}
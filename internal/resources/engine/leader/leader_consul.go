@@ -0,0 +1,116 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package leader
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/discovery"
+)
+
+const (
+	// consulMinTTL and consulMaxTTL bound the session ttls consul accepts
+	consulMinTTL = 10 * time.Second
+	consulMaxTTL = 24 * time.Hour
+)
+
+// consulLock is a consul key acquired with a session.  The session is renewed
+// while held, and releases the key should it expire
+type consulLock struct {
+	agent   *discovery.Consul
+	key     string
+	ttl     time.Duration
+	session string
+}
+
+func newConsulLock(client *http.Client, cfg *config.Consul, key string, ttl time.Duration) *consulLock {
+	return &consulLock{
+		agent: discovery.NewConsul(client, cfg),
+		key:   strings.TrimPrefix(key, "/"),
+		ttl:   min(max(ttl, consulMinTTL), consulMaxTTL),
+	}
+}
+
+func (c *consulLock) Name() string {
+	return "consul " + c.key
+}
+
+func (c *consulLock) Acquire(ctx context.Context, holder string) (bool, string, error) {
+	if c.session != "" {
+		if err := c.Renew(ctx); err != nil {
+			c.session = ""
+		}
+	}
+	if c.session == "" {
+		session := map[string]string{
+			"Name":     "auto-ssh leader",
+			"TTL":      c.ttl.String(),
+			"Behavior": "release",
+			// Taken over as soon as it is released or expires
+			"LockDelay": "0s",
+		}
+		created := &struct{ ID string }{}
+		if err := c.agent.Call(ctx, http.MethodPut, "/v1/session/create", session, created); err != nil {
+			return false, "", err
+		}
+		c.session = created.ID
+	}
+	held := false
+	acquire := "/v1/kv/" + c.key + "?acquire=" + url.QueryEscape(c.session)
+	if err := c.agent.Call(ctx, http.MethodPut, acquire, holder, &held); err != nil {
+		return false, "", err
+	}
+	if held {
+		return true, holder, nil
+	}
+	return false, c.holder(ctx), nil
+}
+
+// holder is who the key names as holding it
+func (c *consulLock) holder(ctx context.Context) string {
+	var entries []struct{ Value string }
+	if err := c.agent.Call(ctx, http.MethodGet, "/v1/kv/"+c.key, nil, &entries); err != nil || len(entries) == 0 {
+		return "another instance"
+	}
+	value, err := base64.StdEncoding.DecodeString(entries[0].Value)
+	var holder string
+	if err != nil || json.Unmarshal(value, &holder) != nil {
+		return "another instance"
+	}
+	return holder
+}
+
+func (c *consulLock) Renew(ctx context.Context) error {
+	if c.session == "" {
+		return errLost
+	}
+	err := c.agent.Call(ctx, http.MethodPut, "/v1/session/renew/"+url.PathEscape(c.session), nil, nil)
+	if errors.Is(err, discovery.ErrNotFound) {
+		// The session expired, releasing the key
+		return fmt.Errorf("%w: %v", errLost, err)
+	}
+	return err
+}
+
+func (c *consulLock) Release(ctx context.Context) {
+	if c.session == "" {
+		return
+	}
+	release := "/v1/kv/" + c.key + "?release=" + url.QueryEscape(c.session)
+	err := c.agent.Call(ctx, http.MethodPut, release, nil, nil)
+	if err == nil || errors.Is(err, discovery.ErrNotFound) {
+		_ = c.agent.Call(ctx, http.MethodPut, "/v1/session/destroy/"+url.PathEscape(c.session), nil, nil)
+	}
+	c.session = ""
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package leader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/log"
+)
+
+const (
+	requestTimeout = 5 * time.Second
+)
+
+// errLost is a lock no longer held, rather than one that cannot be renewed for now
+var errLost = errors.New("no longer held")
+
+// lock is held by the one instance of a pair that runs the tunnels
+type lock interface {
+	Name() string
+	// Acquire tries once to take the lock, naming the holder when it is taken
+	Acquire(ctx context.Context, holder string) (bool, string, error)
+	// Renew keeps the lock held, failing once it no longer is
+	Renew(ctx context.Context) error
+	Release(ctx context.Context)
+}
+
+type Engine struct {
+	lock     lock
+	holder   string
+	ttl      time.Duration
+	interval time.Duration
+}
+
+func NewEngine(cfg *config.Leader) *Engine {
+	host, _ := os.Hostname()
+	e := &Engine{
+		holder:   fmt.Sprintf("%s pid %d", host, os.Getpid()),
+		ttl:      cfg.TTLOrDefault(),
+		interval: cfg.TTLOrDefault() / 3,
+	}
+	client := &http.Client{Timeout: requestTimeout}
+	switch {
+	case cfg.Consul != nil:
+		e.lock = newConsulLock(client, cfg.Consul, cfg.KeyOrDefault(), e.ttl)
+	case cfg.Etcd != nil:
+		e.lock = newEtcdLock(client, cfg.Etcd, cfg.KeyOrDefault(), e.ttl)
+	default:
+		e.lock = newFileLock(cfg.File)
+	}
+	return e
+}
+
+// Lead stands by until the lock is taken, reporting false should the context
+// end first.  The lock is then kept until the context ends, calling lost
+// should it be lost, the tunnels no longer being this instance's to run
+func (e *Engine) Lead(ctx context.Context, wg *sync.WaitGroup, lost func()) bool {
+	if !e.acquire(ctx) {
+		return false
+	}
+	log.Printf("  Info  - leading, holding leader lock (%s)\n", e.lock.Name())
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(e.interval)
+		defer ticker.Stop()
+		var failingSince time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				release, cancel := context.WithTimeout(context.Background(), requestTimeout)
+				e.lock.Release(release)
+				cancel()
+				log.Printf("  Info  - leader lock (%s) released\n", e.lock.Name())
+				return
+			case <-ticker.C:
+			}
+			err := e.lock.Renew(ctx)
+			if err == nil {
+				if !failingSince.IsZero() {
+					log.Printf("  Info  - leader lock (%s) renewed again\n", e.lock.Name())
+				}
+				failingSince = time.Time{}
+				continue
+			}
+			if failingSince.IsZero() {
+				failingSince = time.Now()
+				log.Printf("  Warn  - leader lock (%s) cannot be renewed: %v\n", e.lock.Name(), err)
+			}
+			if errors.Is(err, errLost) || time.Since(failingSince) >= e.ttl-e.interval {
+				// Given up before it expires, so a standby taking over never
+				// finds the tunnels still running here
+				log.Printf("  Error - leader lock (%s) lost: %v\n", e.lock.Name(), err)
+				lost()
+				return
+			}
+		}
+	}()
+	return true
+}
+
+func (e *Engine) acquire(ctx context.Context) bool {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	standingBy := ""
+	failing := false
+	for {
+		held, holder, err := e.lock.Acquire(ctx, e.holder)
+		switch {
+		case held:
+			return true
+		case err != nil && !failing:
+			log.Printf("  Warn  - leader lock (%s) unavailable: %v\n", e.lock.Name(), err)
+		case err == nil && holder != standingBy:
+			log.Printf("  Info  - standing by, leader lock (%s) held by %s\n", e.lock.Name(), holder)
+			standingBy = holder
+		}
+		failing = err != nil
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package leader
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/discovery"
+)
+
+// etcdLock is an etcd key created, through the v3 json gateway, only while it
+// does not exist, bound to a lease kept alive while held so the key is deleted
+// should the lease expire
+type etcdLock struct {
+	cluster *discovery.Etcd
+	key     string
+	ttl     time.Duration
+	lease   string
+}
+
+type etcdTxn struct {
+	Succeeded bool `json:"succeeded"`
+	Responses []struct {
+		ResponseRange struct {
+			Kvs []struct {
+				Value string `json:"value"`
+			} `json:"kvs"`
+		} `json:"response_range"`
+	} `json:"responses"`
+}
+
+func newEtcdLock(client *http.Client, cfg *config.Etcd, key string, ttl time.Duration) *etcdLock {
+	return &etcdLock{
+		cluster: discovery.NewEtcd(client, cfg),
+		key:     key,
+		ttl:     ttl,
+	}
+}
+
+func (e *etcdLock) Name() string {
+	return "etcd " + e.key
+}
+
+func (e *etcdLock) Acquire(ctx context.Context, holder string) (bool, string, error) {
+	lease, err := e.cluster.Grant(ctx, e.ttl)
+	if err != nil {
+		return false, "", err
+	}
+	key := base64.StdEncoding.EncodeToString([]byte(e.key))
+	txn := map[string]interface{}{
+		"compare": []map[string]string{{"key": key, "target": "CREATE", "result": "EQUAL", "create_revision": "0"}},
+		"success": []map[string]interface{}{{"request_put": map[string]string{
+			"key":   key,
+			"value": base64.StdEncoding.EncodeToString([]byte(holder)),
+			"lease": lease,
+		}}},
+		"failure": []map[string]interface{}{{"request_range": map[string]string{"key": key}}},
+	}
+	result := &etcdTxn{}
+	if err = e.cluster.Call(ctx, "/v3/kv/txn", txn, result); err != nil || !result.Succeeded {
+		_ = e.cluster.Revoke(ctx, lease)
+		if err != nil {
+			return false, "", err
+		}
+		return false, result.holder(), nil
+	}
+	e.lease = lease
+	return true, holder, nil
+}
+
+func (t *etcdTxn) holder() string {
+	for _, response := range t.Responses {
+		for _, kv := range response.ResponseRange.Kvs {
+			if value, err := base64.StdEncoding.DecodeString(kv.Value); err == nil {
+				return string(value)
+			}
+		}
+	}
+	return "another instance"
+}
+
+func (e *etcdLock) Renew(ctx context.Context) error {
+	if e.lease == "" {
+		return errLost
+	}
+	err := e.cluster.KeepAlive(ctx, e.lease)
+	if errors.Is(err, discovery.ErrLeaseExpired) {
+		return fmt.Errorf("%w: %v", errLost, err)
+	}
+	return err
+}
+
+func (e *etcdLock) Release(ctx context.Context) {
+	if e.lease == "" {
+		return
+	}
+	_ = e.cluster.Revoke(ctx, e.lease)
+	e.lease = ""
+}
@@ -0,0 +1,35 @@
+//go:build !unix
+
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package leader
+
+import (
+	"context"
+	"fmt"
+)
+
+// fileLock is not supported without flock, leaving consul or etcd
+type fileLock struct {
+	path string
+}
+
+func newFileLock(path string) *fileLock {
+	return &fileLock{path: path}
+}
+
+func (f *fileLock) Name() string {
+	return "file " + f.path
+}
+
+func (f *fileLock) Acquire(context.Context, string) (bool, string, error) {
+	return false, "", fmt.Errorf("file locks are not supported on this platform, use consul or etcd")
+}
+
+func (f *fileLock) Renew(context.Context) error {
+	return errLost
+}
+
+func (f *fileLock) Release(context.Context) {}
@@ -0,0 +1,85 @@
+//go:build unix
+
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package leader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// fileLock is an exclusive lock on a file every instance can reach, which the
+// kernel, or the file server, releases should the instance holding it die
+type fileLock struct {
+	path string
+	file *os.File
+}
+
+func newFileLock(path string) *fileLock {
+	return &fileLock{path: path}
+}
+
+func (f *fileLock) Name() string {
+	return "file " + f.path
+}
+
+func (f *fileLock) Acquire(_ context.Context, holder string) (bool, string, error) {
+	file, err := os.OpenFile(f.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return false, "", err
+	}
+	if err = unix.Flock(int(file.Fd()), unix.LOCK_EX|unix.LOCK_NB); err != nil {
+		defer func() { _ = file.Close() }()
+		if errors.Is(err, unix.EWOULDBLOCK) {
+			bs, _ := os.ReadFile(f.path)
+			if current := strings.TrimSpace(string(bs)); current != "" {
+				return false, current, nil
+			}
+			return false, "another instance", nil
+		}
+		return false, "", err
+	}
+	if err = file.Truncate(0); err == nil {
+		_, err = file.WriteAt([]byte(holder+"\n"), 0)
+	}
+	if err != nil {
+		_ = file.Close()
+		return false, "", err
+	}
+	f.file = file
+	return true, holder, nil
+}
+
+// Renew checks the file locked is still the one at the path, a standby
+// otherwise being free to lock whatever replaced it
+func (f *fileLock) Renew(_ context.Context) error {
+	if f.file == nil {
+		return errLost
+	}
+	locked, err := f.file.Stat()
+	if err != nil {
+		return err
+	}
+	current, err := os.Stat(f.path)
+	if err != nil || !os.SameFile(locked, current) {
+		return fmt.Errorf("%w: %s was removed or replaced", errLost, f.path)
+	}
+	return nil
+}
+
+func (f *fileLock) Release(_ context.Context) {
+	if f.file == nil {
+		return
+	}
+	_ = f.file.Truncate(0)
+	_ = f.file.Close()
+	f.file = nil
+}
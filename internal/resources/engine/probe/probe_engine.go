@@ -0,0 +1,97 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package probe
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/log"
+	engineModels "us.figge.auto-ssh/internal/resources/models"
+)
+
+// Engine measures latency through hosts and to forward addresses on an interval,
+// leaving the results on the hosts and tunnels for the status and stats to report
+type Engine struct {
+	cfg     *config.Probe
+	hosts   engineModels.HostEngine
+	tunnels engineModels.TunnelEngine
+	failing map[string]bool
+	lock    sync.Mutex
+}
+
+func NewEngine(cfg *config.Probe, hosts engineModels.HostEngine, tunnels engineModels.TunnelEngine) *Engine {
+	return &Engine{
+		cfg:     cfg,
+		hosts:   hosts,
+		tunnels: tunnels,
+		failing: make(map[string]bool),
+	}
+}
+
+// Start probes until the context ends
+func (e *Engine) Start(ctx context.Context, wg *sync.WaitGroup) {
+	if e.cfg == nil {
+		return
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(e.cfg.IntervalOrDefault())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				e.probe()
+			}
+		}
+	}()
+}
+
+// probe measures every host and tunnel concurrently, so one slow to answer
+// does not delay the others
+func (e *Engine) probe() {
+	wg := &sync.WaitGroup{}
+	for _, host := range e.hosts.Hosts() {
+		if internal, ok := host.(engineModels.HostInternal); ok && host.Valid() {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if latency, ok := internal.Probe(); ok && config.VerboseFlag {
+					log.Printf("  Info  - host (%s) round trip %v\n", host.Name(), latency)
+				}
+			}()
+		}
+	}
+	for _, tunnel := range e.tunnels.Tunnels() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			latency, err := tunnel.Probe()
+			e.failed(tunnel, err)
+			if err == nil && latency > 0 && config.VerboseFlag {
+				log.Printf("  Info  - tunnel (%s) forward connect %v\n", tunnel.Name(), latency)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// failed warns once when a tunnel's forward address stops answering, and notes
+// when it recovers
+func (e *Engine) failed(tunnel engineModels.Tunnel, err error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if err != nil && !e.failing[tunnel.Id()] {
+		log.Printf("  Warn  - tunnel (%s) forward address probe failed: %v\n", tunnel.Name(), err)
+	} else if err == nil && e.failing[tunnel.Id()] {
+		log.Printf("  Info  - tunnel (%s) forward address reachable again\n", tunnel.Name())
+	}
+	e.failing[tunnel.Id()] = err != nil
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package registry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/discovery"
+)
+
+const (
+	// consulMinDeregister is the smallest critical period consul accepts before reaping a service
+	consulMinDeregister = time.Minute
+)
+
+// consul registers services with the local consul agent, each with a ttl check
+// that passes while the tunnel is started
+type consul struct {
+	agent *discovery.Consul
+	ttl   time.Duration
+}
+
+func newConsul(client *http.Client, cfg *config.Consul, ttl time.Duration) *consul {
+	return &consul{agent: discovery.NewConsul(client, cfg), ttl: ttl}
+}
+
+func (c *consul) Name() string {
+	return "consul"
+}
+
+func (c *consul) Register(ctx context.Context, svc *service) error {
+	deregister := 10 * c.ttl
+	if deregister < consulMinDeregister {
+		deregister = consulMinDeregister
+	}
+	registration := map[string]interface{}{
+		"ID":      svc.Id,
+		"Name":    svc.Name,
+		"Address": svc.Address,
+		"Port":    svc.Port,
+		"Tags":    svc.Tags,
+		"Meta":    svc.Meta,
+		"Check": map[string]interface{}{
+			"CheckID": c.checkId(svc),
+			"Name":    fmt.Sprintf("auto-ssh tunnel %s", svc.Name),
+			"TTL":     c.ttl.String(),
+			// Reaps the service should auto-ssh die without deregistering
+			"DeregisterCriticalServiceAfter": deregister.String(),
+		},
+	}
+	if err := c.agent.Call(ctx, http.MethodPut, "/v1/agent/service/register", registration, nil); err != nil {
+		return err
+	}
+	return c.Update(ctx, svc)
+}
+
+func (c *consul) Update(ctx context.Context, svc *service) error {
+	status := "critical"
+	if svc.healthy() {
+		status = "passing"
+	}
+	update := map[string]string{
+		"Status": status,
+		"Output": fmt.Sprintf("tunnel %s", strings.ToLower(svc.Status)),
+	}
+	return c.agent.Call(ctx, http.MethodPut, "/v1/agent/check/update/"+url.PathEscape(c.checkId(svc)), update, nil)
+}
+
+func (c *consul) Deregister(ctx context.Context, svc *service) error {
+	return c.agent.Call(ctx, http.MethodPut, "/v1/agent/service/deregister/"+url.PathEscape(svc.Id), nil, nil)
+}
+
+func (c *consul) checkId(svc *service) string {
+	return "service:" + svc.Id
+}
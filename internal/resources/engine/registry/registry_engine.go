@@ -0,0 +1,199 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package registry
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/log"
+	engineModels "us.figge.auto-ssh/internal/resources/models"
+)
+
+const (
+	requestTimeout = 5 * time.Second
+)
+
+// backend is a service discovery system tunnel entrances are published to
+type backend interface {
+	Name() string
+	Register(ctx context.Context, svc *service) error
+	Update(ctx context.Context, svc *service) error
+	Deregister(ctx context.Context, svc *service) error
+}
+
+type service struct {
+	Id      string            `json:"id"`
+	Name    string            `json:"name"`
+	Address string            `json:"address"`
+	Port    int               `json:"port"`
+	Tags    []string          `json:"tags,omitempty"`
+	Status  string            `json:"status"`
+	Meta    map[string]string `json:"meta,omitempty"`
+	// Backends the service is currently registered with
+	registered map[string]bool
+	lease      string
+}
+
+func (s *service) healthy() bool {
+	return s.Status == "Started"
+}
+
+type Engine struct {
+	cfg      *config.Registry
+	tunnels  engineModels.TunnelEngine
+	backends []backend
+	services map[string]*service
+	failing  map[string]bool
+}
+
+func NewEngine(cfg *config.Registry, tunnels engineModels.TunnelEngine) *Engine {
+	e := &Engine{
+		cfg:      cfg,
+		tunnels:  tunnels,
+		services: make(map[string]*service),
+		failing:  make(map[string]bool),
+	}
+	if cfg == nil {
+		return e
+	}
+	client := &http.Client{Timeout: requestTimeout}
+	ttl := 3 * cfg.IntervalOrDefault()
+	if cfg.Consul != nil {
+		e.backends = append(e.backends, newConsul(client, cfg.Consul, ttl))
+	}
+	if cfg.Etcd != nil {
+		e.backends = append(e.backends, newEtcd(client, cfg.Etcd, ttl))
+	}
+	return e
+}
+
+// Start keeps the registered services in line with the tunnels until the context
+// ends, at which point every service is deregistered
+func (e *Engine) Start(ctx context.Context, wg *sync.WaitGroup) {
+	if len(e.backends) == 0 {
+		return
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(e.cfg.IntervalOrDefault())
+		defer ticker.Stop()
+		for {
+			e.reconcile(ctx)
+			select {
+			case <-ctx.Done():
+				e.deregisterAll()
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (e *Engine) reconcile(ctx context.Context) {
+	seen := make(map[string]bool)
+	for _, tunnel := range e.tunnels.Tunnels() {
+		running := tunnel.Running()
+		if !tunnel.Valid() || tunnel.Reverse() || running == engineModels.Stopped.String() || running == engineModels.Stopping.String() {
+			continue
+		}
+		svc := e.serviceOf(tunnel)
+		seen[svc.Id] = true
+		current, ok := e.services[svc.Id]
+		if ok && (current.Address != svc.Address || current.Port != svc.Port) {
+			// The entrance moved, so the old registration is stale
+			e.deregister(ctx, current)
+			ok = false
+		}
+		if !ok {
+			current = svc
+			e.services[svc.Id] = current
+		}
+		current.Status = svc.Status
+		for _, b := range e.backends {
+			var err error
+			if !current.registered[b.Name()] {
+				if err = b.Register(ctx, current); err == nil {
+					current.registered[b.Name()] = true
+					log.Printf("  Info  - tunnel (%s) registered with %s as %s:%d\n", tunnel.Name(), b.Name(), current.Address, current.Port)
+				}
+			} else if err = b.Update(ctx, current); err != nil {
+				// Most likely the registration expired, so register again next time
+				current.registered[b.Name()] = false
+			}
+			e.failed(b, err)
+		}
+	}
+	for id, svc := range e.services {
+		if !seen[id] {
+			e.deregister(ctx, svc)
+		}
+	}
+}
+
+func (e *Engine) deregister(ctx context.Context, svc *service) {
+	for _, b := range e.backends {
+		if !svc.registered[b.Name()] {
+			continue
+		}
+		err := b.Deregister(ctx, svc)
+		if err == nil {
+			log.Printf("  Info  - tunnel (%s) deregistered from %s\n", svc.Name, b.Name())
+		}
+		e.failed(b, err)
+	}
+	delete(e.services, svc.Id)
+}
+
+func (e *Engine) deregisterAll() {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	for _, svc := range e.services {
+		e.deregister(ctx, svc)
+	}
+}
+
+// failed reports a backend starting, or ceasing, to fail without repeating
+// the same complaint every interval
+func (e *Engine) failed(b backend, err error) {
+	if err != nil && !e.failing[b.Name()] {
+		log.Printf("  Warn  - registry %s unavailable: %v\n", b.Name(), err)
+	} else if err == nil && e.failing[b.Name()] {
+		log.Printf("  Info  - registry %s available again\n", b.Name())
+	}
+	e.failing[b.Name()] = err != nil
+}
+
+func (e *Engine) serviceOf(tunnel engineModels.Tunnel) *service {
+	host, _, _ := net.SplitHostPort(tunnel.Local().String())
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		host = e.cfg.Advertise
+		if host == "" {
+			host, _ = os.Hostname()
+		}
+	}
+	svc := &service{
+		Id:         "auto-ssh-" + tunnel.Id(),
+		Name:       tunnel.Name(),
+		Address:    host,
+		Port:       tunnel.Local().Port(),
+		Status:     tunnel.Running(),
+		Meta:       map[string]string{"tunnel": tunnel.Id(), "forward": tunnel.Remote().String()},
+		registered: make(map[string]bool),
+	}
+	if tunnel.Host() != "" {
+		svc.Meta["host"] = tunnel.Host()
+	}
+	if metadata := tunnel.Metadata(); metadata != nil {
+		svc.Tags = metadata.Tags
+	}
+	return svc
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package registry
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"path"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/discovery"
+)
+
+// etcd writes services as json values under prefix/<name>/<id> through the etcd v3
+// json gateway.  Each key is bound to a lease kept alive while the tunnel runs, so
+// entries vanish on their own should auto-ssh die without deregistering
+type etcd struct {
+	cluster *discovery.Etcd
+	prefix  string
+	ttl     time.Duration
+}
+
+func newEtcd(client *http.Client, cfg *config.Etcd, ttl time.Duration) *etcd {
+	e := &etcd{
+		cluster: discovery.NewEtcd(client, cfg),
+		prefix:  cfg.Prefix,
+		ttl:     ttl,
+	}
+	if e.prefix == "" {
+		e.prefix = config.DefaultEtcdPrefix
+	}
+	return e
+}
+
+func (e *etcd) Name() string {
+	return "etcd"
+}
+
+func (e *etcd) Register(ctx context.Context, svc *service) error {
+	lease, err := e.cluster.Grant(ctx, e.ttl)
+	if err != nil {
+		return err
+	}
+	svc.lease = lease
+	return e.put(ctx, svc)
+}
+
+func (e *etcd) Update(ctx context.Context, svc *service) error {
+	if err := e.cluster.KeepAlive(ctx, svc.lease); err != nil {
+		return err
+	}
+	// Rewritten every time so the value follows the tunnel's status
+	return e.put(ctx, svc)
+}
+
+func (e *etcd) Deregister(ctx context.Context, svc *service) error {
+	return e.cluster.Revoke(ctx, svc.lease)
+}
+
+func (e *etcd) put(ctx context.Context, svc *service) error {
+	value, err := json.Marshal(svc)
+	if err != nil {
+		return err
+	}
+	put := map[string]string{
+		"key":   base64.StdEncoding.EncodeToString([]byte(e.key(svc))),
+		"value": base64.StdEncoding.EncodeToString(value),
+		"lease": svc.lease,
+	}
+	return e.cluster.Call(ctx, "/v3/kv/put", put, nil)
+}
+
+func (e *etcd) key(svc *service) string {
+	return path.Join(e.prefix, svc.Name, svc.Id)
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package schedule
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/log"
+	engineModels "us.figge.auto-ssh/internal/resources/models"
+)
+
+const checkInterval = 15 * time.Second
+
+// Engine starts scheduled tunnels as one of their windows opens and stops them
+// once outside every window.  Within a window a tunnel stopped by hand is left
+// stopped, while outside of one it is never left running
+type Engine struct {
+	tunnels engineModels.TunnelEngine
+	active  map[string]bool
+}
+
+func NewEngine(tunnels engineModels.TunnelEngine) *Engine {
+	return &Engine{
+		tunnels: tunnels,
+		active:  make(map[string]bool),
+	}
+}
+
+// Start checks the schedules until the context ends
+func (e *Engine) Start(ctx context.Context, wg *sync.WaitGroup) {
+	e.check(time.Now())
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				e.check(now)
+			}
+		}
+	}()
+}
+
+func (e *Engine) check(now time.Time) {
+	seen := make(map[string]bool)
+	for _, tunnel := range e.tunnels.Tunnels() {
+		if !tunnel.Scheduled() || !tunnel.Valid() || !tunnel.Enabled() {
+			continue
+		}
+		seen[tunnel.Id()] = true
+		active := tunnel.InSchedule(now)
+		was, known := e.active[tunnel.Id()]
+		e.active[tunnel.Id()] = active
+		running := tunnel.Running()
+		switch {
+		case !active && running != "Stopped" && running != "Stopping":
+			log.Printf("  Info  - tunnel (%s) schedule closed. Stopping\n", tunnel.Name())
+			tunnel.Stop()
+		case active && known && !was && tunnel.AutoStarts() && running == "Stopped":
+			log.Printf("  Info  - tunnel (%s) schedule opened. Starting\n", tunnel.Name())
+			tunnel.Start()
+		}
+	}
+	for id := range e.active {
+		if !seen[id] {
+			delete(e.active, id)
+		}
+	}
+}
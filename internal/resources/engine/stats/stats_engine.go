@@ -13,10 +13,15 @@ import (
 	"sync"
 	"time"
 
+	"us.figge.auto-ssh/internal/core/activation"
 	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/log"
 	engineModels "us.figge.auto-ssh/internal/resources/models"
 )
 
+// activatedName is the systemd FileDescriptorName of a socket passed in for the stats monitor
+const activatedName = "stats"
+
 var (
 	zeros    = string(make([]byte, 256))
 	interval = time.Second * 5
@@ -44,25 +49,39 @@ func (s *Engine) StartStatsTunnel(ctx context.Context, port int) error {
 	if config.C.Monitor.StatsPort != -1 {
 		var err error
 		s.statsAddress = fmt.Sprintf("127.0.0.1:%d", port)
-		s.statsListener, err = net.Listen("tcp", s.statsAddress)
-		if err != nil {
-			fmt.Printf("Warn - Failed to initialize stats monitor: %v\n", err)
-			return err
+		listener, activated := activation.Listener(s.statsAddress, activatedName)
+		if !activated {
+			if listener, err = net.Listen("tcp", s.statsAddress); err != nil {
+				log.Printf("  Warn  - Failed to initialize stats monitor: %v\n", err)
+				return err
+			}
 		}
+		s.lock.Lock()
+		s.statsListener = listener
+		s.lock.Unlock()
 	}
 	go s.statsTransmitter(ctx, port)
 	return nil
 }
 
+// Listener is the stats monitor's listening socket, if any, for an upgrading
+// instance to take over
+func (s *Engine) Listener() net.Listener {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.statsListener
+}
+
 func (s *Engine) NewEntry() engineModels.Stats {
 	return &Entry{
 		statsData:  &statsData{},
+		histograms: newHistograms(),
 		updateChan: s.updateChan,
 	}
 }
 
 func (s *Engine) statsTransmitter(ctx context.Context, port int) {
-	fmt.Printf("  Info  - auto-ssh stats listening on %d\n", port)
+	log.Printf("  Info  - auto-ssh stats listening on %d\n", port)
 	go s.statsBroadcaster(ctx)
 	for {
 		conn, err := s.statsListener.Accept()
@@ -74,10 +93,10 @@ func (s *Engine) statsTransmitter(ctx context.Context, port int) {
 					return
 				}
 			}
-			fmt.Printf("  Error - auto-ssh stats listener accept failed: %v\n", err)
+			log.Printf("  Error - auto-ssh stats listener accept failed: %v\n", err)
 			return
 		}
-		fmt.Printf("  Info  - Connected stats client\n")
+		log.Printf("  Info  - Connected stats client\n")
 		s.addConnection(conn)
 	}
 }
@@ -87,7 +106,7 @@ func (s *Engine) statsBroadcaster(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
-			fmt.Printf("  Info  - auto-ssh stats closed\n")
+			log.Printf("  Info  - auto-ssh stats closed\n")
 			s.closeAllConnections()
 			return
 		case <-s.updateChan:
@@ -126,7 +145,7 @@ func (s *Engine) writeUpdate(update []byte) {
 	var alive []net.Conn
 	for _, conn := range s.connections {
 		if _, err := conn.Write(s.lastUpdate); err != nil {
-			fmt.Printf("  Info  - Disconnected stats client\n")
+			log.Printf("  Info  - Disconnected stats client\n")
 			_ = conn.Close()
 		} else {
 			alive = append(alive, conn)
@@ -143,7 +162,7 @@ func (s *Engine) addConnection(conn net.Conn) {
 	defer s.lock.Unlock()
 	_, err := conn.Write(s.lastUpdate)
 	if err != nil {
-		fmt.Printf("  Error - Unable to send current update to new client: %v\n", err)
+		log.Printf("  Error - Unable to send current update to new client: %v\n", err)
 	}
 	s.connections = append(s.connections, conn)
 }
@@ -5,9 +5,13 @@
 package stats
 
 import (
-	"fmt"
+	"encoding/json"
+	"strings"
 	"sync/atomic"
 	"time"
+
+	"us.figge.auto-ssh/internal/core/histogram"
+	engineModels "us.figge.auto-ssh/internal/resources/models"
 )
 
 var (
@@ -25,34 +29,94 @@ type statsData struct {
 	Connections int       `json:"c" title:"Used" format:"%%%ds "  sort:"%[2]s%[1]s"`
 	JumpTunnel  bool      `json:"j" title:"Jump" format:"%%%ds "  sort:"%[2]s%[1]s"`
 	LastUpdate  time.Time `json:"u" title:"Last" format:"%%-%ds " sort:"%[1]s%[2]s"`
+	// lastClose and idleClosed are written as connections close, while the
+	// stats are being sent, so are held atomically and added by MarshalJSON
+	lastClose  atomic.Value
+	idleClosed atomic.Int32
+	// RTT is the latest probed connect time to the forward address in microseconds
+	RTT int64 `json:"l,omitempty" title:"RTT" format:"%%%ds " sort:"%[2]s%[1]s"`
+}
+
+func (d *statsData) MarshalJSON() ([]byte, error) {
+	type fields statsData
+	lastClose, _ := d.lastClose.Load().(string)
+	return json.Marshal(struct {
+		*fields
+		LastClose  string `json:"x,omitempty"`
+		IdleClosed int32  `json:"d,omitempty"`
+	}{(*fields)(d), lastClose, d.idleClosed.Load()})
 }
 
 type Entry struct {
 	*statsData
+	*histograms
 	updateChan chan struct{}
 }
 
+type histograms struct {
+	duration *histogram.Histogram
+	bytesIn  *histogram.Histogram
+	bytesOut *histogram.Histogram
+	dial     *histogram.Histogram
+}
+
+func newHistograms() *histograms {
+	return &histograms{
+		duration: histogram.New(histogram.DurationBounds),
+		bytesIn:  histogram.New(histogram.SizeBounds),
+		bytesOut: histogram.New(histogram.SizeBounds),
+		dial:     histogram.New(histogram.LatencyBounds),
+	}
+}
+
 func (e Entry) Connected() int {
 	currentConnections.Add(1)
 	totalConnections.Add(1)
 	return int(currentConnections.Load())
 }
 
-func (e Entry) Disconnected() {
+// Disconnected records the end of a connection and why it closed, counting
+// those ended by an idle timeout
+func (e Entry) Disconnected(reason string) {
 	currentConnections.Add(-1)
+	e.lastClose.Store(reason)
+	if strings.Contains(reason, "idle timeout") {
+		e.idleClosed.Add(1)
+	}
 }
 
 func (e Entry) Received(n int64) {
-	fmt.Printf("  Info  - Recieved %d\n", n)
 	e.In += n
 }
 
 func (e Entry) Transmitted(n int64) {
-	fmt.Printf("  Info  - Transmitted %d\n", n)
 	e.Out += n
 }
 
+func (e Entry) Latency(d time.Duration) {
+	e.RTT = d.Microseconds()
+}
+
 func (e Entry) Updated() {
 	e.LastUpdate = time.Now()
 
 }
+
+func (e Entry) Closed(d time.Duration, bytesIn int64, bytesOut int64) {
+	e.duration.Observe(d.Seconds())
+	e.bytesIn.Observe(float64(bytesIn))
+	e.bytesOut.Observe(float64(bytesOut))
+}
+
+func (e Entry) Dialed(d time.Duration) {
+	e.dial.Observe(d.Seconds())
+}
+
+func (e Entry) Distributions() engineModels.Distributions {
+	return engineModels.Distributions{
+		Duration: e.duration.Snapshot(),
+		BytesIn:  e.bytesIn.Snapshot(),
+		BytesOut: e.bytesOut.Snapshot(),
+		Dial:     e.dial.Snapshot(),
+	}
+}
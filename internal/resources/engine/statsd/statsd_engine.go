@@ -0,0 +1,130 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package statsd
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/histogram"
+	"us.figge.auto-ssh/internal/core/log"
+	"us.figge.auto-ssh/internal/core/statsd"
+	"us.figge.auto-ssh/internal/core/traffic"
+	engineModels "us.figge.auto-ssh/internal/resources/models"
+)
+
+var percentiles = []int{50, 90, 99}
+
+// Engine pushes each tunnel's metrics to StatsD on an interval: gauges of
+// whether it is up, its open connections, the latency last probed and the
+// percentiles of its connections' durations and dial times since it started,
+// and counts of the connections closed and bytes they carried since the last push
+type Engine struct {
+	cfg     *config.StatsD
+	tunnels engineModels.TunnelEngine
+	// pushed are the traffic totals of each tunnel as of the last push
+	pushed  map[string]traffic.Totals
+	failing bool
+}
+
+func NewEngine(cfg *config.StatsD, tunnels engineModels.TunnelEngine) *Engine {
+	return &Engine{
+		cfg:     cfg,
+		tunnels: tunnels,
+		pushed:  make(map[string]traffic.Totals),
+	}
+}
+
+// Start pushes until the context ends
+func (e *Engine) Start(ctx context.Context, wg *sync.WaitGroup) {
+	if e.cfg == nil {
+		return
+	}
+	client, err := statsd.New(e.cfg.AddressOrDefault(), e.cfg.PrefixOrDefault(), e.cfg.DogStatsD, e.cfg.Tags)
+	if err != nil {
+		log.Printf("  Error - %v\n", err)
+		return
+	}
+	log.Printf("  Info  - pushing metrics to statsd (%s) every %v\n", e.cfg.AddressOrDefault(), e.cfg.IntervalOrDefault())
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer func() { _ = client.Close() }()
+		ticker := time.NewTicker(e.cfg.IntervalOrDefault())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				e.push(client)
+			}
+		}
+	}()
+}
+
+func (e *Engine) push(client *statsd.Client) {
+	for _, t := range e.tunnels.Tunnels() {
+		if !t.Valid() {
+			continue
+		}
+		tags := []string{"tunnel:" + statsd.Sanitize(t.Name()), "tunnel_id:" + statsd.Sanitize(t.Id())}
+		up := 0.0
+		if t.Running() == engineModels.Started.String() {
+			up = 1
+		}
+		client.Gauge(e.name(t, "up"), up, tags...)
+		client.Gauge(e.name(t, "connections.open"), float64(t.Connections()), tags...)
+		if latency := t.Latency(); latency > 0 {
+			client.Gauge(e.name(t, "latency_ms"), float64(latency.Microseconds())/1000, tags...)
+		}
+		distributions := t.Distributions()
+		e.percentiles(client, t, "connection.duration_ms", distributions.Duration, tags)
+		e.percentiles(client, t, "dial_ms", distributions.Dial, tags)
+
+		totals := traffic.Get(t.Id())
+		last, ok := e.pushed[t.Id()]
+		if !ok || !totals.Since.Equal(last.Since) {
+			// Counted from zero, the totals having been reset, or never pushed
+			// should they have been kept from before auto-ssh started
+			last = traffic.Totals{Since: totals.Since}
+			if !ok {
+				last = totals
+			}
+		}
+		client.Count(e.name(t, "connections.closed"), totals.Connections-last.Connections, tags...)
+		client.Count(e.name(t, "bytes.in"), totals.BytesIn-last.BytesIn, tags...)
+		client.Count(e.name(t, "bytes.out"), totals.BytesOut-last.BytesOut, tags...)
+		e.pushed[t.Id()] = totals
+	}
+	err := client.Flush()
+	if err != nil && !e.failing {
+		log.Printf("  Warn  - metrics cannot be pushed to statsd (%s): %v\n", e.cfg.AddressOrDefault(), err)
+	} else if err == nil && e.failing {
+		log.Printf("  Info  - metrics pushed to statsd (%s) again\n", e.cfg.AddressOrDefault())
+	}
+	e.failing = err != nil
+}
+
+// percentiles gauges the percentiles of a histogram of seconds in milliseconds
+func (e *Engine) percentiles(client *statsd.Client, t engineModels.Tunnel, metric string, s histogram.Snapshot, tags []string) {
+	for _, p := range percentiles {
+		if v := s.Quantile(float64(p) / 100); !math.IsNaN(v) {
+			client.Gauge(e.name(t, fmt.Sprintf("%s.p%d", metric, p)), math.Round(v*1e6)/1e3, tags...)
+		}
+	}
+}
+
+// name is the metric's name for the tunnel, which DogStatsD tags instead
+func (e *Engine) name(t engineModels.Tunnel, metric string) string {
+	if e.cfg.DogStatsD {
+		return "tunnel." + metric
+	}
+	return "tunnel." + statsd.Sanitize(t.Name()) + "." + metric
+}
@@ -0,0 +1,37 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package tunnel
+
+import (
+	"us.figge.auto-ssh/internal/core/access"
+	"us.figge.auto-ssh/internal/core/geoip"
+	"us.figge.auto-ssh/internal/core/log"
+)
+
+// validateAccess reads the tunnel's access rules, checking the geoip databases
+// any name countries or autonomous systems in are configured
+func (t *Entry) validateAccess() bool {
+	t.access = nil
+	a := t.tunnelData.Access
+	if a == nil {
+		return true
+	}
+	rules, err := access.Parse(a.Allow, a.Deny)
+	if err != nil {
+		log.Printf("  Error - tunnel (%s) %v\n", t.tunnelData.Name, err)
+		return false
+	}
+	valid := true
+	if rules.NeedsCountry() && !geoip.HasCountry() {
+		log.Printf("  Error - tunnel (%s) access rules naming countries require a geoip country database\n", t.tunnelData.Name)
+		valid = false
+	}
+	if rules.NeedsASN() && !geoip.HasASN() {
+		log.Printf("  Error - tunnel (%s) access rules naming autonomous systems require a geoip asn database\n", t.tunnelData.Name)
+		valid = false
+	}
+	t.access = rules
+	return valid
+}
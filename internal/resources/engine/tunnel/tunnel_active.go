@@ -0,0 +1,154 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package tunnel
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/log"
+	engineModels "us.figge.auto-ssh/internal/resources/models"
+)
+
+const closedByRequest = "closed by request"
+
+// activeConn is a client connection being forwarded by the tunnel, numbered
+// in the order the tunnel accepted them
+type activeConn struct {
+	id       int64
+	client   net.Conn
+	target   string
+	protocol string
+	started  time.Time
+	lock     sync.Mutex
+	tc       *tunnelConn
+	closed   bool
+}
+
+// forwarding records the connection carrying the client's traffic, closing
+// it straight away should the client have been closed while it was dialed
+func (c *activeConn) forwarding(tc *tunnelConn) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.tc = tc
+	if c.closed {
+		tc.setReason(closedByRequest)
+		tc.closeAll()
+	}
+}
+
+// setProtocol records the protocol the connection was sniffed to carry
+func (c *activeConn) setProtocol(protocol string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.protocol = protocol
+}
+
+func (c *activeConn) sniffed() string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.protocol
+}
+
+// setTarget records the address a socks client asked for
+func (c *activeConn) setTarget(target string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.target = target
+}
+
+func (c *activeConn) close() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.closed = true
+	if c.tc != nil {
+		c.tc.setReason(closedByRequest)
+		c.tc.closeAll()
+	} else {
+		_ = c.client.Close()
+	}
+}
+
+func (c *activeConn) closedByRequest() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.closed
+}
+
+func (c *activeConn) info() engineModels.Connection {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	info := engineModels.Connection{
+		Id:       c.id,
+		Client:   c.client.RemoteAddr().String(),
+		Target:   c.target,
+		Protocol: c.protocol,
+		Started:  c.started,
+	}
+	if c.tc != nil {
+		info.BytesIn, info.BytesOut = c.tc.BytesIn(), c.tc.BytesOut()
+	}
+	return info
+}
+
+// ActiveConnections lists the client connections the tunnel is forwarding
+func (t *Entry) ActiveConnections() []engineModels.Connection {
+	t.lock.Lock()
+	conns := append([]*activeConn{}, t.conns...)
+	t.lock.Unlock()
+	infos := make([]engineModels.Connection, 0, len(conns))
+	for _, c := range conns {
+		infos = append(infos, c.info())
+	}
+	return infos
+}
+
+// CloseConnection closes one of the tunnel's client connections, reporting
+// whether it was open
+func (t *Entry) CloseConnection(id int64) bool {
+	t.lock.Lock()
+	var conn *activeConn
+	for _, c := range t.conns {
+		if c.id == id {
+			conn = c
+			break
+		}
+	}
+	t.lock.Unlock()
+	if conn == nil {
+		return false
+	}
+	log.Printf("  Info  - tunnel (%s) closing connection %d from %s by request\n", t.Name(), id, conn.client.RemoteAddr())
+	conn.close()
+	return true
+}
+
+// kill closes the tunnel's entrance and every client connection at once, for
+// the kill switch
+func (t *Entry) kill() {
+	t.lock.Lock()
+	cancel := t.cancel
+	if t.listener != nil {
+		_ = t.listener.Close()
+	}
+	conns := append([]*activeConn{}, t.conns...)
+	t.lock.Unlock()
+	for _, c := range conns {
+		c.close()
+	}
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// Kill closes the entrance and connections of every tunnel
+func (te *Engine) Kill() {
+	te.lock.RLock()
+	defer te.lock.RUnlock()
+	for _, t := range te.tunnelEntries {
+		t.kill()
+	}
+}
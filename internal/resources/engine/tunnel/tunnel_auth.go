@@ -0,0 +1,73 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package tunnel
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/log"
+	"us.figge.auto-ssh/internal/core/preauth"
+)
+
+// validateAuth checks the secrets clients authenticate to the entrance with,
+// and the tunnel authenticates to its forward address with.  Authenticating to
+// the forward address needs one of its own, dialed as each client connects
+func (t *Entry) validateAuth() bool {
+	valid := t.tunnelData.Auth.Validate("tunnel", t.tunnelData.Name)
+	r := t.tunnelData.RemoteAuth
+	if r == nil {
+		return valid
+	}
+	if !r.Validate("tunnel", t.tunnelData.Name) {
+		valid = false
+	}
+	if t.tunnelData.HTTP != nil || t.tunnelData.Socks != nil || len(t.tunnelData.Routes) > 0 {
+		log.Printf("  Error - tunnel (%s) remoteAuth requires a forward address of its own\n", t.tunnelData.Name)
+		valid = false
+	}
+	if t.tunnelData.Prewarm != nil {
+		log.Printf("  Error - tunnel (%s) remoteAuth cannot prewarm, the forward address expecting to be answered as it connects\n", t.tunnelData.Name)
+		valid = false
+	}
+	return valid
+}
+
+// authenticate challenges the client before anything it sends is forwarded,
+// returning who it is when it presented a token
+func (t *Entry) authenticate(conn net.Conn) (string, error) {
+	return preauth.Challenge(conn, []byte(t.tunnelData.Auth.SecretOrBlank()), t.Name())
+}
+
+// presentAuth authenticates to the forward address, an entrance of another
+// auto-ssh requiring auth
+func (t *Entry) presentAuth(conn net.Conn) error {
+	r := t.tunnelData.RemoteAuth
+	if err := respond(conn, r.SecretOrBlank(), r.TokenOrBlank()); err != nil {
+		return fmt.Errorf("forward address authentication failed: %w", err)
+	}
+	return nil
+}
+
+// probeAuth answers a watchdog probe's challenge, from the tunnel's own
+// entrance for a reverse tunnel and otherwise from its forward address
+func (t *Entry) probeAuth(conn net.Conn) error {
+	if t.tunnelData.Reverse && t.tunnelData.Auth != nil {
+		return respond(conn, t.tunnelData.Auth.SecretOrBlank(), "")
+	}
+	if !t.tunnelData.Reverse && t.tunnelData.RemoteAuth != nil {
+		return t.presentAuth(conn)
+	}
+	return nil
+}
+
+// respond answers the challenge on conn.  Channels have no deadlines, so one
+// left unanswered is ended by closing it
+func respond(conn net.Conn, secret string, token string) error {
+	timer := time.AfterFunc(preauth.Timeout, func() { _ = conn.Close() })
+	defer timer.Stop()
+	return preauth.Respond(conn, []byte(secret), token)
+}
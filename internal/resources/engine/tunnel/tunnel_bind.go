@@ -0,0 +1,161 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/log"
+)
+
+const (
+	BindLoopback          = "loopback"
+	BindAll               = "all"
+	interfacePollInterval = 5 * time.Second
+)
+
+// bindHost converts a bind setting into the ip address a listener binds to,
+// also returning the interface name when the setting names one
+func bindHost(bind string) (string, string, error) {
+	switch strings.ToLower(bind) {
+	case "", BindLoopback:
+		return "127.0.0.1", "", nil
+	case BindAll:
+		return "0.0.0.0", "", nil
+	}
+	if ip := net.ParseIP(bind); ip != nil {
+		if ip.To4() == nil {
+			return "", "", fmt.Errorf("must be an ip4 address")
+		}
+		return ip.To4().String(), "", nil
+	}
+	if _, err := net.InterfaceByName(bind); err != nil {
+		return "", "", fmt.Errorf("must be %s, %s, an ip4 address or a network interface", BindLoopback, BindAll)
+	}
+	host, err := interfaceAddress(bind)
+	if err != nil {
+		return "", "", err
+	}
+	return host, bind, nil
+}
+
+// interfaceAddress returns the first ip4 address currently assigned to the
+// named network interface
+func interfaceAddress(name string) (string, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return "", err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", err
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+			return ipNet.IP.To4().String(), nil
+		}
+	}
+	return "", fmt.Errorf("interface %s has no ip4 address", name)
+}
+
+func isLoopback(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// bindLocal replaces the host of the local address with the one selected by
+// the tunnel's bind setting, or the --bind override, so a tunnel only listens
+// beyond the loopback interface when asked to explicitly
+func (t *Entry) bindLocal(typed string) bool {
+	bind := strings.TrimSpace(t.tunnelData.Bind)
+	source := "bind"
+	if config.BindFlag != "" {
+		bind = strings.TrimSpace(config.BindFlag)
+		source = "--bind"
+	}
+	host, iface, err := bindHost(bind)
+	if err != nil {
+		log.Printf("  Error - tunnel (%s) %s (%s) %v\n", t.tunnelData.Name, source, bind, err)
+		return false
+	}
+
+	if typedHost, _, ok := strings.Cut(typed, ":"); ok && bind == "" && !isLoopback(typedHost) {
+		suggestion := BindAll
+		if ip := net.ParseIP(typedHost); ip == nil || !ip.IsUnspecified() {
+			suggestion = fmt.Sprintf("%s or %s", BindAll, typedHost)
+		}
+		log.Printf("  Warn  - tunnel (%s) local address (%s) listens on loopback only. Set bind to %s to listen elsewhere\n",
+			t.tunnelData.Name, typed, suggestion)
+	}
+	address := config.NewAddress(fmt.Sprintf("%s:%d", host, t.tunnelData.Local.Port()))
+	if !address.Validate("tunnel", t.tunnelData.Name, "local address", true, false) {
+		return false
+	}
+	t.tunnelData.Local = address
+	t.iface = iface
+	return true
+}
+
+// interfaceLocal returns the local address on the bound interface's current
+// address when it differs from the one in use
+func (t *Entry) interfaceLocal() (*config.Address, bool) {
+	host, err := interfaceAddress(t.iface)
+	if err != nil {
+		return nil, false
+	}
+	current, _, _ := strings.Cut(t.Local().String(), ":")
+	if host == current {
+		return nil, false
+	}
+	address := config.NewAddress(fmt.Sprintf("%s:%d", host, t.Local().Port()))
+	if !address.Validate("tunnel", t.tunnelData.Name, "local address", true, false) {
+		return nil, false
+	}
+	return address, true
+}
+
+// watchInterface follows the address of the bound interface, moving the
+// listener when it changes, for instance when a laptop switches networks.
+// Established connections are left undisturbed
+func (t *Entry) watchInterface(ctx context.Context) {
+	ticker := time.NewTicker(interfacePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		address, changed := t.interfaceLocal()
+		if !changed {
+			continue
+		}
+		listener, err := listenConfig(t.tunnelData.Socket).Listen(ctx, "tcp", address.String())
+		if err != nil {
+			log.Printf("  Error - tunnel (%s) interface (%s) address changed but entrance (%s) cannot be created: %v\n",
+				t.Name(), t.iface, address.String(), err)
+			continue
+		}
+		previous := t.Local().String()
+		t.lock.Lock()
+		old := t.listener
+		t.listener = listener
+		t.tunnelData.Local = address
+		t.lock.Unlock()
+		if old != nil {
+			_ = old.Close()
+		}
+		log.Printf("  Info  - tunnel (%s) interface (%s) address changed, entrance moved from %s to %s\n",
+			t.Name(), t.iface, previous, address.String())
+	}
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package tunnel
+
+import (
+	"net"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/log"
+	"us.figge.auto-ssh/internal/core/pcap"
+	"us.figge.auto-ssh/internal/core/utils"
+)
+
+// startCapture opens the tunnel's capture file as its entrance opens, the
+// capture running while the tunnel does
+func (t *Entry) startCapture() {
+	if t.tunnelData.Capture == nil {
+		return
+	}
+	var until time.Time
+	if d := time.Duration(t.tunnelData.Capture.Duration); d > 0 {
+		until = time.Now().Add(d)
+	}
+	file := utils.ExpandHome(t.tunnelData.Capture.File)
+	capture, err := pcap.Create(file, t.Name(), t.tunnelData.Capture.MaxBytes(), until)
+	if err != nil {
+		log.Printf("  Error - tunnel (%s) cannot capture traffic: %v\n", t.Name(), err)
+		return
+	}
+	log.Printf("  Warn  - tunnel (%s) is capturing its traffic to %s\n", t.Name(), file)
+	t.lock.Lock()
+	t.capture = capture
+	t.lock.Unlock()
+}
+
+// stopCapture closes the capture file.  Must be called holding the lock
+func (t *Entry) stopCapture() {
+	if t.capture == nil {
+		return
+	}
+	if err := t.capture.Close(); err != nil {
+		log.Printf("  Error - tunnel (%s) capture cannot be closed: %v\n", t.Name(), err)
+	}
+	t.capture = nil
+}
+
+// captureStream begins the capture of a client's connection, nil when the
+// tunnel is not capturing
+func (t *Entry) captureStream(client net.Conn) *pcap.Stream {
+	t.lock.Lock()
+	capture := t.capture
+	t.lock.Unlock()
+	if capture == nil {
+		return nil
+	}
+	return capture.Stream(client.RemoteAddr(), client.LocalAddr())
+}
+
+// captureTo writes the connection's traffic to the stream.  Spliced traffic
+// never passes through the tunnel, so is not spliced while capturing
+func (t *tunnelConn) captureTo(stream *pcap.Stream) {
+	t.capture = stream
+	t.splice = false
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"syscall"
+
+	"us.figge.auto-ssh/internal/core/activation"
+	"us.figge.auto-ssh/internal/core/log"
+	"us.figge.auto-ssh/internal/core/takeover"
+)
+
+// checkConflicts reports every added tunnel whose entrance overlaps that of a
+// kept tunnel or an earlier added one, marking it invalid so it is not started,
+// then warns of added tunnels whose entrance another process already listens on.
+// Those are still started, as the port may be released before long
+func checkConflicts(kept []*Entry, added []*Entry) {
+	claimed := make([]*Entry, 0, len(kept)+len(added))
+	for _, tunnel := range kept {
+		if tunnel.Valid() {
+			claimed = append(claimed, tunnel)
+		}
+	}
+	for _, tunnel := range added {
+		if !tunnel.Valid() {
+			continue
+		}
+		conflict := false
+		for _, other := range claimed {
+			if tunnel.Reverse() != other.Reverse() || tunnel.Reverse() && tunnel.Host() != other.Host() {
+				// The entrances are on different machines
+				continue
+			}
+			if overlaps(tunnel.Local().String(), other.Local().String()) {
+				log.Printf("  Error - tunnel (%s) local address (%s) conflicts with tunnel (%s) on %s\n",
+					tunnel.Name(), tunnel.Local(), other.Name(), other.Local())
+				conflict = true
+			}
+		}
+		if conflict {
+			tunnel.Status.Valid = false
+			continue
+		}
+		claimed = append(claimed, tunnel)
+		if !tunnel.Reverse() {
+			tunnel.checkBound()
+		}
+	}
+}
+
+// overlaps reports whether two listen addresses claim the same port, either on
+// the same address or because one listens on every address, or name the same
+// abstract unix socket
+func overlaps(a string, b string) bool {
+	if strings.HasPrefix(a, "@") || strings.HasPrefix(b, "@") {
+		return a == b
+	}
+	hostA, portA, errA := net.SplitHostPort(a)
+	hostB, portB, errB := net.SplitHostPort(b)
+	if errA != nil || errB != nil || portA != portB || portA == "0" {
+		return false
+	}
+	return hostA == hostB || unspecified(hostA) || unspecified(hostB)
+}
+
+func unspecified(host string) bool {
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsUnspecified()
+}
+
+// checkBound warns when the tunnel's entrance is already listened on by another
+// process, naming the process when it can be identified
+func (t *Entry) checkBound() {
+	address := t.Local().String()
+	if activation.Activated(address, t.Name(), t.Id()) {
+		return
+	}
+	ln, err := listenConfig(t.tunnelData.Socket).Listen(context.Background(), t.Local().Network(), address)
+	if err == nil {
+		_ = ln.Close()
+		return
+	}
+	if !errors.Is(err, syscall.EADDRINUSE) {
+		return
+	}
+	if owner := takeover.Owner(address); owner != "" {
+		log.Printf("  Warn  - tunnel (%s) local address (%s) is already in use by %s\n", t.Name(), address, owner)
+	} else {
+		log.Printf("  Warn  - tunnel (%s) local address (%s) is already in use\n", t.Name(), address)
+	}
+}
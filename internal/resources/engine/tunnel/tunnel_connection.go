@@ -6,36 +6,68 @@ package tunnel
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/log"
+	"us.figge.auto-ssh/internal/core/pcap"
 	engineModels "us.figge.auto-ssh/internal/resources/models"
 )
 
+const (
+	spliceChunk = 256 * 1024
+)
+
+var (
+	// halfCloseLinger bounds a half-closed connection whose end of stream
+	// could not be passed on
+	halfCloseLinger = 30 * time.Second
+)
+
 type tunnelConn struct {
-	id        string
-	name      string
-	stats     engineModels.Stats
-	conns     [2]net.Conn
-	connected [2]bool
+	id       string
+	name     string
+	stats    engineModels.Stats
+	conns    [2]net.Conn
+	open     atomic.Int32
+	bytes    [2]atomic.Int64
+	idle     *idleMonitor
+	splice   bool
+	sniffer  *sniffer
+	capture  *pcap.Stream
+	filter   *connFilter
+	reason   string
+	reasonMu sync.Mutex
 }
 
-func NewTunnelConnection(name string, id string, stats engineModels.Stats, sshConn net.Conn, localConn net.Conn) *tunnelConn {
-	return &tunnelConn{
-		name:      name,
-		id:        id,
-		stats:     stats,
-		conns:     [2]net.Conn{localConn, sshConn},
-		connected: [2]bool{true, true},
+func NewTunnelConnection(name string, id string, stats engineModels.Stats, timeouts *config.Timeouts, sshConn net.Conn, localConn net.Conn) *tunnelConn {
+	t := &tunnelConn{
+		name:  name,
+		id:    id,
+		stats: stats,
+		conns: [2]net.Conn{localConn, sshConn},
 	}
+	t.open.Store(2)
+	t.idle = newIdleMonitor(timeouts.ReadIdleTimeout(), timeouts.WriteIdleTimeout(), t.expire)
+	// Spliced traffic is only seen a chunk at a time, too coarse for idle tracking
+	t.splice = timeouts.ReadIdleTimeout() == 0 && timeouts.WriteIdleTimeout() == 0
+	return t
 }
 
 func (t *tunnelConn) Start(ctx context.Context) {
 	tunnelCtx, cancel := context.WithCancel(ctx)
+	go func() {
+		// Stopping the tunnel must also end a direction left half-closed
+		<-tunnelCtx.Done()
+		t.closeAll()
+	}()
+	t.idle.start()
 	wg := &sync.WaitGroup{}
 	wg.Add(2)
 	go func() {
@@ -47,35 +79,89 @@ func (t *tunnelConn) Start(ctx context.Context) {
 		wg.Done()
 	}()
 	wg.Wait()
+	t.idle.stop()
 	cancel()
 	if config.VerboseFlag {
-		fmt.Printf("  Info  - id:%s closing connection %s\n", t.id, t.conns[0].RemoteAddr())
+		log.Printf("  Info  - tunnel (%s) id:%s closing connection %s: %s\n", t.name, t.id, t.conns[0].RemoteAddr(), t.Reason())
 	}
 }
 
 func (t *tunnelConn) send(ctx context.Context, index int, name string) {
 	if config.VerboseFlag {
-		fmt.Printf("  Info  - tunnel (%s) id:%s %s tunnel opened\n", t.name, t.id, name)
+		log.Printf("  Info  - tunnel (%s) id:%s %s tunnel opened\n", t.name, t.id, name)
 	}
 	err := t.copy(t.conns[index], t.conns[1-index], index == 0)
 	if err != nil && config.VerboseFlag {
-		fmt.Printf("  Error - tunnel (%s) id:%s encountered a closed tunnel: %v\n", t.name, t.id, err)
+		log.Printf("  Error - tunnel (%s) id:%s encountered a closed tunnel: %v\n", t.name, t.id, err)
 	}
-	t.connected[index] = false
+	t.closedBy(ctx, index, err)
+	if config.VerboseFlag {
+		log.Printf("  Info  - tunnel (%s) id:%s %s tunnel closed\n", t.name, t.id, name)
+	}
+	if t.open.Add(-1) == 0 {
+		return
+	}
+	if err != nil {
+		t.closeAll()
+		return
+	}
+	// Pass the end of stream on to the peer and leave the other direction
+	// running, so a response sent after a half-close still arrives
+	if closeWrite(t.conns[1-index]) != nil {
+		t.idle.lingerFor(halfCloseLinger)
+	}
+}
+
+// expire closes a connection whose idle deadline has passed
+func (t *tunnelConn) expire(reason string) {
+	t.setReason(reason)
 	if config.VerboseFlag {
-		fmt.Printf("  Info  - tunnel (%s) id:%s %s tunnel closed\n", t.name, t.id, name)
+		log.Printf("  Info  - tunnel (%s) id:%s connection %s expired: %s\n", t.name, t.id, t.conns[0].RemoteAddr(), reason)
 	}
-	if t.connected[1-index] {
-		go t.autoClose(ctx)
+	t.closeAll()
+}
+
+// closeWrite shuts down the writing side of a connection when supported, as
+// it is by tcp connections and ssh channels
+func closeWrite(conn net.Conn) error {
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return errors.ErrUnsupported
+}
+
+func (t *tunnelConn) closeAll() {
+	for i := range 2 {
+		if t.conns[i] != nil {
+			_ = t.conns[i].Close()
+		}
 	}
 }
 
 func (t *tunnelConn) copy(src io.Reader, dst io.Writer, read bool) (err error) {
+	if srcTCP, ok := src.(*net.TCPConn); ok && t.splice {
+		if dstTCP, ok := dst.(*net.TCPConn); ok {
+			return t.spliceCopy(srcTCP, dstTCP, read)
+		}
+	}
 	buf := make([]byte, 32*1024)
 	for {
 		nr, er := src.Read(buf)
 		if nr > 0 {
-			fmt.Printf("%v => %s\n", read, buf[0:nr])
+			if read && t.filter != nil {
+				if reason, denied := t.filter.inspect(buf[0:nr]); denied {
+					log.Printf("  Warn  - tunnel (%s) id:%s connection %s denied by filter: %s\n", t.name, t.id, t.conns[0].RemoteAddr(), reason)
+					t.setReason("denied by filter: " + reason)
+					err = errFiltered
+					break
+				}
+			}
+			if t.sniffer != nil {
+				t.sniffer.observe(buf[0:nr], read)
+			}
+			if t.capture != nil {
+				t.capture.Write(buf[0:nr], read)
+			}
 			nw, ew := dst.Write(buf[0:nr])
 			if nw < 0 || nr < nw {
 				nw = 0
@@ -83,12 +169,7 @@ func (t *tunnelConn) copy(src io.Reader, dst io.Writer, read bool) (err error) {
 					ew = errInvalidWrite
 				}
 			}
-			if read {
-				t.stats.Received(int64(nw))
-			} else {
-				t.stats.Transmitted(int64(nw))
-			}
-			t.stats.Updated()
+			t.count(int64(nw), read)
 
 			if ew != nil {
 				err = ew
@@ -109,23 +190,73 @@ func (t *tunnelConn) copy(src io.Reader, dst io.Writer, read bool) (err error) {
 	return err
 }
 
-func (t *tunnelConn) autoClose(ctx context.Context) {
-	status := "terminated"
-	if config.VerboseFlag {
-		fmt.Printf("  Info  - tunnel (%s) id:%s auto-closer initiated\n", t.name, t.id)
+// spliceCopy copies between two tcp connections without passing the data through
+// user space, which on linux uses splice(2).  The copy proceeds in chunks so
+// the traffic counters advance during long transfers
+func (t *tunnelConn) spliceCopy(src *net.TCPConn, dst *net.TCPConn, read bool) error {
+	for {
+		n, err := dst.ReadFrom(&io.LimitedReader{R: src, N: spliceChunk})
+		if n > 0 {
+			t.count(n, read)
+		}
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
 	}
-	timer := time.NewTimer(30 * time.Second)
-	select {
-	case <-timer.C:
-		status = "triggered"
-	case <-ctx.Done():
+}
+
+func (t *tunnelConn) count(n int64, read bool) {
+	if read {
+		t.bytes[0].Add(n)
+		t.idle.read()
+		t.stats.Received(n)
+	} else {
+		t.bytes[1].Add(n)
+		t.idle.wrote()
+		t.stats.Transmitted(n)
 	}
-	for i := range 2 {
-		if t.conns[i] != nil {
-			_ = t.conns[i].Close()
-		}
+	t.stats.Updated()
+}
+
+// closedBy records why the connection ended.  Only the first side to close
+// determines the reason
+func (t *tunnelConn) closedBy(ctx context.Context, index int, err error) {
+	side := "client"
+	if index == 1 {
+		side = "server"
 	}
-	if config.VerboseFlag {
-		fmt.Printf("  Info  - tunnel (%s) id:%s auto-closer %s\n", t.name, t.id, status)
+	reason := side + " closed"
+	if ctx.Err() != nil {
+		reason = "tunnel stopped"
+	} else if err != nil {
+		reason = fmt.Sprintf("%s error: %v", side, err)
+	}
+	t.setReason(reason)
+}
+
+func (t *tunnelConn) setReason(reason string) {
+	t.reasonMu.Lock()
+	defer t.reasonMu.Unlock()
+	if t.reason == "" {
+		t.reason = reason
 	}
 }
+
+// BytesIn returns the bytes read from the client and forwarded to the target
+func (t *tunnelConn) BytesIn() int64 {
+	return t.bytes[0].Load()
+}
+
+// BytesOut returns the bytes read from the target and returned to the client
+func (t *tunnelConn) BytesOut() int64 {
+	return t.bytes[1].Load()
+}
+
+func (t *tunnelConn) Reason() string {
+	t.reasonMu.Lock()
+	defer t.reasonMu.Unlock()
+	return t.reason
+}
@@ -0,0 +1,122 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package tunnel
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/resources/engine/stats"
+)
+
+// tcpPair returns both ends of a loopback tcp connection
+func tcpPair(t *testing.T) (*net.TCPConn, *net.TCPConn) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := ln.Accept()
+		accepted <- conn
+	}()
+	dialed, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	conn := <-accepted
+	require.NotNil(t, conn)
+	t.Cleanup(func() {
+		_ = dialed.Close()
+		_ = conn.Close()
+	})
+	return dialed.(*net.TCPConn), conn.(*net.TCPConn)
+}
+
+// startConn runs a tunnel connection between the local and remote ends,
+// returning a channel closed once it ends
+func startConn(t *testing.T, timeouts *config.Timeouts, remote net.Conn, local net.Conn) (*tunnelConn, chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	conn := NewTunnelConnection("test", "01", stats.NewEngine().NewEntry(), timeouts, remote, local)
+	done := make(chan struct{})
+	go func() {
+		conn.Start(ctx)
+		close(done)
+	}()
+	return conn, done
+}
+
+func waitDone(t *testing.T, done chan struct{}, within time.Duration) {
+	select {
+	case <-done:
+	case <-time.After(within):
+		t.Fatalf("connection still open after %v", within)
+	}
+}
+
+func TestTunnelConnHalfClose(t *testing.T) {
+	tests := map[string]*config.Timeouts{
+		"splice": nil,
+		"copy":   {ReadIdle: config.Duration(time.Minute)},
+	}
+	for name, timeouts := range tests {
+		t.Run(name, func(tt *testing.T) {
+			client, local := tcpPair(tt)
+			remote, server := tcpPair(tt)
+			conn, done := startConn(tt, timeouts, remote, local)
+
+			_, err := client.Write([]byte("request"))
+			require.NoError(tt, err)
+			require.NoError(tt, client.CloseWrite())
+			request, err := io.ReadAll(server)
+			require.NoError(tt, err)
+			assert.Equal(tt, "request", string(request))
+
+			// The response follows the half-close of the client
+			_, err = server.Write([]byte("response"))
+			require.NoError(tt, err)
+			require.NoError(tt, server.Close())
+			response, err := io.ReadAll(client)
+			require.NoError(tt, err)
+			assert.Equal(tt, "response", string(response))
+
+			waitDone(tt, done, 5*time.Second)
+			assert.Equal(tt, "client closed", conn.Reason())
+			assert.Equal(tt, int64(len("request")), conn.BytesIn())
+			assert.Equal(tt, int64(len("response")), conn.BytesOut())
+		})
+	}
+}
+
+func TestTunnelConnHalfCloseLinger(t *testing.T) {
+	linger := halfCloseLinger
+	halfCloseLinger = 100 * time.Millisecond
+	t.Cleanup(func() { halfCloseLinger = linger })
+
+	// A pipe, as a connection through an http proxy is, cannot pass the end
+	// of stream on
+	client, local := tcpPair(t)
+	remote, server := net.Pipe()
+	t.Cleanup(func() { _ = server.Close() })
+	conn, done := startConn(t, nil, remote, local)
+
+	_, err := client.Write([]byte("request"))
+	require.NoError(t, err)
+	buf := make([]byte, len("request"))
+	_, err = io.ReadFull(server, buf)
+	require.NoError(t, err)
+	closed := time.Now()
+	require.NoError(t, client.CloseWrite())
+
+	waitDone(t, done, 5*time.Second)
+	assert.GreaterOrEqual(t, time.Since(closed), halfCloseLinger)
+	assert.Equal(t, "client closed", conn.Reason())
+	_, err = server.Read(buf)
+	assert.ErrorIs(t, err, io.EOF)
+}
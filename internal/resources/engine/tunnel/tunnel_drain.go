@@ -0,0 +1,59 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package tunnel
+
+import (
+	"net"
+
+	"us.figge.auto-ssh/internal/core/log"
+)
+
+// Entrances are the listeners of the tunnels' local entrances, named by their
+// address, for an upgrading instance to take over
+func (te *Engine) Entrances() map[string]net.Listener {
+	te.lock.RLock()
+	defer te.lock.RUnlock()
+	entrances := make(map[string]net.Listener)
+	for _, t := range te.tunnelEntries {
+		if listener := t.currentListener(); listener != nil && !t.tunnelData.Reverse {
+			entrances[listener.Addr().String()] = listener
+		}
+	}
+	return entrances
+}
+
+// Drain closes every tunnel's entrance once an upgraded instance has taken
+// them over, leaving the client connections to finish
+func (te *Engine) Drain() {
+	te.lock.RLock()
+	defer te.lock.RUnlock()
+	for _, t := range te.tunnelEntries {
+		t.drain()
+	}
+}
+
+// drain closes the entrance without stopping the tunnel, so its connections
+// carry on.  A reverse tunnel's entrance on its host is closed too, for the
+// upgraded instance to open in its place
+func (t *Entry) drain() {
+	t.lock.Lock()
+	listener := t.listener
+	t.listener = nil
+	t.drained = true
+	t.lock.Unlock()
+	if listener == nil {
+		// Stopped, or still waiting for its entrance, so there is nothing to drain
+		t.Stop()
+		return
+	}
+	log.Printf("  Info  - tunnel (%s) entrance handed over, %d connections draining\n", t.Name(), t.Connections())
+	_ = listener.Close()
+}
+
+func (t *Entry) isDrained() bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.drained
+}
@@ -6,42 +6,65 @@ package tunnel
 
 import (
 	"context"
-	"fmt"
 	"sync"
+	"time"
 
 	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/journal"
+	"us.figge.auto-ssh/internal/core/log"
 	engineModels "us.figge.auto-ssh/internal/resources/models"
 )
 
+const (
+	// stopWait bounds how long a replaced tunnel is given to release its entrance
+	stopWait = 2 * time.Second
+)
+
 type Engine struct {
+	lock          sync.RWMutex
 	tunnelEntries map[string]*Entry
+	fingerprints  map[string]string
+	ctx           context.Context
+	statsEngine   engineModels.StatsEngine
+	wg            *sync.WaitGroup
 }
 
 func NewEngine(ctx context.Context, he engineModels.HostEngineInternal, tunnels []*config.Tunnel) *Engine {
 	engine := &Engine{
 		tunnelEntries: make(map[string]*Entry),
+		fingerprints:  make(map[string]string),
 	}
+	added := make([]*Entry, 0, len(tunnels))
 	for _, cfgTunnel := range tunnels {
-		if _, ok := engine.tunnelEntries[cfgTunnel.Name]; ok {
-			fmt.Printf("  Error - tunnel name (%s) redfined\n", cfgTunnel.Name)
+		if _, ok := engine.tunnelEntries[cfgTunnel.Id]; ok {
+			log.Printf("  Error - tunnel id (%s) redefined by tunnel (%s)\n", cfgTunnel.Id, cfgTunnel.Name)
 			continue
 		}
-		tunnel := &Entry{
-			tunnelData: &tunnelData{
-				Tunnel: cfgTunnel,
-			},
-		}
-		tunnel.Status = &config.Status{
-			Running: "Stopped",
-			Valid:   true,
-		}
-		tunnel.Validate(he)
-		engine.tunnelEntries[tunnel.tunnelData.Id] = tunnel
+		engine.fingerprints[cfgTunnel.Id] = config.Fingerprint(cfgTunnel)
+		engine.tunnelEntries[cfgTunnel.Id] = newEntry(he, cfgTunnel)
+		added = append(added, engine.tunnelEntries[cfgTunnel.Id])
 	}
+	checkConflicts(nil, added)
 	return engine
 }
 
+func newEntry(he engineModels.HostEngineInternal, cfgTunnel *config.Tunnel) *Entry {
+	tunnel := &Entry{
+		tunnelData: &tunnelData{
+			Tunnel: cfgTunnel,
+		},
+	}
+	tunnel.Status = &config.Status{
+		Running: "Stopped",
+		Valid:   true,
+	}
+	tunnel.Validate(he)
+	return tunnel
+}
+
 func (te *Engine) Tunnels() []engineModels.Tunnel {
+	te.lock.RLock()
+	defer te.lock.RUnlock()
 	tunnels := make([]engineModels.Tunnel, 0, len(te.tunnelEntries))
 	for _, tunnelEntry := range te.tunnelEntries {
 		tunnels = append(tunnels, tunnelEntry)
@@ -50,17 +73,116 @@ func (te *Engine) Tunnels() []engineModels.Tunnel {
 }
 
 func (te *Engine) Tunnel(id string) (engineModels.Tunnel, bool) {
+	te.lock.RLock()
+	defer te.lock.RUnlock()
 	tunnel, ok := te.tunnelEntries[id]
 	return tunnel, ok
 }
 
 func (te *Engine) StartTunnels(ctx context.Context, statsEngine engineModels.StatsEngine, wg *sync.WaitGroup) {
+	te.lock.Lock()
+	defer te.lock.Unlock()
+	te.ctx, te.statsEngine, te.wg = ctx, statsEngine, wg
 	for _, tunnel := range te.tunnelEntries {
 		statsEntry := statsEngine.NewEntry()
 		tunnel.init(ctx, statsEntry, wg)
-		if !tunnel.Valid() {
+		if tunnel.Valid() && tunnel.autostart() {
+			tunnel.Start()
+		}
+	}
+}
+
+// Apply brings the tunnels in line with a new configuration.  Tunnels whose
+// definition is unchanged, and whose host was not replaced, carry on undisturbed.
+// Changed tunnels are stopped and started afresh, new tunnels started and
+// removed tunnels stopped
+func (te *Engine) Apply(he engineModels.HostEngineInternal, tunnels []*config.Tunnel, replacedHosts map[string]bool) {
+	te.lock.Lock()
+	defer te.lock.Unlock()
+	entries := make(map[string]*Entry)
+	fingerprints := make(map[string]string)
+	var kept, started []*Entry
+	for _, cfgTunnel := range tunnels {
+		if _, ok := entries[cfgTunnel.Id]; ok {
+			log.Printf("  Error - tunnel id (%s) redefined by tunnel (%s)\n", cfgTunnel.Id, cfgTunnel.Name)
 			continue
 		}
-		tunnel.Start()
+		fingerprint := config.Fingerprint(cfgTunnel)
+		fingerprints[cfgTunnel.Id] = fingerprint
+		if tunnel, ok := te.tunnelEntries[cfgTunnel.Id]; ok {
+			if te.fingerprints[cfgTunnel.Id] == fingerprint && !replacedHosts[tunnel.Host()] {
+				entries[cfgTunnel.Id] = tunnel
+				kept = append(kept, tunnel)
+				continue
+			}
+			log.Printf("  Info  - tunnel (%s) changed. Restarting\n", tunnel.Name())
+			stop(tunnel)
+		}
+		tunnel := newEntry(he, cfgTunnel)
+		entries[cfgTunnel.Id] = tunnel
+		started = append(started, tunnel)
+	}
+	for id, tunnel := range te.tunnelEntries {
+		if _, ok := entries[id]; !ok {
+			log.Printf("  Info  - tunnel (%s) removed\n", tunnel.Name())
+			stop(tunnel)
+		}
+	}
+	checkConflicts(kept, started)
+	te.tunnelEntries, te.fingerprints = entries, fingerprints
+	if te.ctx == nil {
+		// Not running yet, so StartTunnels will start them
+		return
+	}
+	for _, tunnel := range started {
+		tunnel.init(te.ctx, te.statsEngine.NewEntry(), te.wg)
+		if tunnel.Valid() && tunnel.autostart() {
+			tunnel.Start()
+		}
+	}
+}
+
+// autostart reports whether the tunnel starts along with auto-ssh, noting those
+// left for the api or cli to start.  A tunnel last started or stopped by request
+// is resumed that way, as the journal recorded
+func (t *Entry) autostart() bool {
+	if !t.IsEnabled() {
+		log.Printf("  Info  - tunnel (%s) is disabled\n", t.Name())
+		return false
+	}
+	switch journal.Requested(t.Id()) {
+	case journal.Stopped:
+		log.Printf("  Info  - tunnel (%s) left stopped, as it was stopped by request\n", t.Name())
+		return false
+	case journal.Started:
+		if !t.InSchedule(time.Now()) {
+			log.Printf("  Info  - tunnel (%s) outside its schedule\n", t.Name())
+			return false
+		}
+		if !t.AutoStarts() {
+			log.Printf("  Info  - tunnel (%s) resuming, as it was started by request\n", t.Name())
+		}
+		return true
+	}
+	if !t.AutoStarts() {
+		log.Printf("  Info  - tunnel (%s) awaiting start\n", t.Name())
+		return false
+	}
+	if !t.InSchedule(time.Now()) {
+		log.Printf("  Info  - tunnel (%s) outside its schedule\n", t.Name())
+		return false
+	}
+	return true
+}
+
+// stop stops the tunnel and waits a moment for it to release its entrance so
+// a replacement can listen on the same address
+func stop(tunnel *Entry) {
+	tunnel.Stop()
+	for deadline := time.Now().Add(stopWait); time.Now().Before(deadline); {
+		if tunnel.Running() == "Stopped" {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
 	}
 }
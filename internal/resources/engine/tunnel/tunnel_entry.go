@@ -6,28 +6,64 @@ package tunnel
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
 	"strings"
 	"sync"
+	"time"
 
+	"us.figge.auto-ssh/internal/core/access"
+	"us.figge.auto-ssh/internal/core/activation"
+	"us.figge.auto-ssh/internal/core/audit"
 	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/events"
+	"us.figge.auto-ssh/internal/core/filter"
+	"us.figge.auto-ssh/internal/core/log"
+	"us.figge.auto-ssh/internal/core/pcap"
+	"us.figge.auto-ssh/internal/core/takeover"
+	"us.figge.auto-ssh/internal/core/traffic"
+	"us.figge.auto-ssh/internal/core/utils/backoff"
+	"us.figge.auto-ssh/internal/core/utils/ratelimit"
 	engineModels "us.figge.auto-ssh/internal/resources/models"
 )
 
+const (
+	listenRetryInitial = time.Second
+	listenRetryMax     = 30 * time.Second
+)
+
 var (
 	errInvalidWrite = errors.New("invalid write result")
 )
 
 type tunnelData struct {
 	*config.Tunnel
-	lock   sync.Mutex
-	host   engineModels.HostInternal
-	conns  []net.Conn
-	stats  engineModels.Stats
-	cancel context.CancelFunc
-	wg     *sync.WaitGroup
+	lock      sync.Mutex
+	host      engineModels.HostInternal
+	conns     []*activeConn
+	nextConn  int64
+	stats     engineModels.Stats
+	cancel    context.CancelFunc
+	wg        *sync.WaitGroup
+	startedAt time.Time
+	listener  net.Listener
+	iface     string
+	latency   time.Duration
+	pool      *prewarmPool
+	tlsConfig *tls.Config
+	capture   *pcap.Writer
+	filters   []filter.Filter
+	drained   bool
+	limiter   *ratelimit.Limiter
+	access    *access.Rules
+	// refused counts the connections refused by the access rules, rate limit
+	// or queue since the last were reported, at refusedLogged
+	refused       int
+	refusedLogged time.Time
+	// queued counts the clients waiting for the host to reconnect
+	queued int
 }
 
 type Entry struct {
@@ -42,122 +78,497 @@ func (t *Entry) init(ctx context.Context, stats engineModels.Stats, wg *sync.Wai
 }
 
 func (t *Entry) Start() {
+	if !t.IsEnabled() {
+		log.Printf("  Warn  - tunnel (%s) is disabled\n", t.Name())
+		return
+	}
+	t.lock.Lock()
 	if t.Status.Running != "Stopped" {
+		t.lock.Unlock()
 		return
 	}
 	t.Status.Running = "Starting"
 	var ctx context.Context
 	ctx, t.cancel = context.WithCancel(t.appCtx)
-	localListener, err := net.Listen("tcp", t.Local().String())
-	if err != nil {
-		fmt.Printf("  Error - tunnel (%s) entrance (%s) cannot be created: %v\n", t.Name(), t.Local().String(), err)
-		return
+	t.lock.Unlock()
+	if err := t.listen(ctx); err != nil {
+		if config.TakeoverFlag && !t.tunnelData.Reverse && !t.Local().IsAbstract() {
+			if err = takeover.Port(t.Local().String()); err != nil {
+				log.Printf("  Warn  - tunnel (%s) cannot take over entrance (%s): %v\n", t.Name(), t.Local().String(), err)
+			} else if err = t.listen(ctx); err == nil {
+				return
+			}
+		}
+		t.wg.Add(1)
+		go t.retryListen(ctx, err)
+	}
+}
+
+// retryListen keeps trying to open the tunnel entrance, backing off between
+// attempts, until it succeeds or the tunnel is stopped
+func (t *Entry) retryListen(ctx context.Context, err error) {
+	defer t.wg.Done()
+	b := backoff.NewBackoff(listenRetryInitial, listenRetryMax)
+	for {
+		delay := b.Next()
+		log.Printf("  Error - tunnel (%s) entrance (%s) cannot be created: %v. Retrying in %s\n", t.Name(), t.Local().String(), err, delay)
+		select {
+		case <-ctx.Done():
+			log.Printf("  Info  - tunnel (%s) stopped before its entrance could be created\n", t.Name())
+			t.lock.Lock()
+			t.cancel = nil
+			t.lock.Unlock()
+			t.setRunning("Stopped")
+			return
+		case <-time.After(delay):
+		}
+		if err = t.listen(ctx); err == nil {
+			return
+		}
+	}
+}
+
+func (t *Entry) listen(ctx context.Context) error {
+	if t.iface != "" {
+		// The interface may have moved since the configuration was validated
+		if address, changed := t.interfaceLocal(); changed {
+			t.lock.Lock()
+			t.tunnelData.Local = address
+			t.lock.Unlock()
+		}
+	}
+	var localListener net.Listener
+	if t.tunnelData.Reverse {
+		var err error
+		if localListener, err = t.listenReverse(); err != nil {
+			return err
+		}
+		t.logReverseOpened(localListener)
+	} else {
+		var activated bool
+		localListener, activated = activation.Listener(t.Local().String(), t.Name(), t.Id())
+		if !activated {
+			var err error
+			localListener, err = listenConfig(t.tunnelData.Socket).Listen(ctx, t.Local().Network(), t.Local().String())
+			if err != nil {
+				return err
+			}
+		}
+		log.Printf("  Info  - tunnel (%s) entrance opened at %s\n", t.Name(), t.Local().String())
 	}
-	fmt.Printf("  Info  - tunnel (%s) entrance opened at %s\n", t.Name(), t.Local().String())
+	t.startCapture()
+	t.setListener(localListener)
+	t.setRunning("Started")
 	t.wg.Add(1)
-	go t.waitForTermination(ctx, localListener)
+	go t.waitForTermination(ctx)
 	go t.runningAcceptLoop(ctx, localListener)
-	t.Status.Running = "Started"
+	if t.iface != "" {
+		go t.watchInterface(ctx)
+	}
+	if t.tunnelData.Prewarm.SizeOrZero() > 0 {
+		t.wg.Add(1)
+		go t.prewarm(ctx)
+	}
+	if t.tunnelData.Watchdog != nil {
+		t.wg.Add(1)
+		go t.watchdog(ctx)
+	}
+	if t.tunnelData.Onion != nil {
+		t.wg.Add(1)
+		go t.publishOnion(ctx)
+	}
+	return nil
 }
 
 func (t *Entry) Stop() {
-	if t.cancel != nil {
+	t.lock.Lock()
+	cancel := t.cancel
+	if cancel != nil {
 		t.Status.Running = "Stopping"
-		t.cancel()
+	}
+	t.lock.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// setRunning records the tunnel's running state, and when it started
+func (t *Entry) setRunning(running string) {
+	t.lock.Lock()
+	changed := t.Status.Running != running
+	t.Status.Running = running
+	switch running {
+	case "Started":
+		t.startedAt = time.Now()
+	case "Stopped":
+		t.startedAt = time.Time{}
+	}
+	t.lock.Unlock()
+	if changed {
+		events.Publish(events.KindTunnel, t.Id(), t.Name(), running, "")
 	}
 }
 
 func (t *Entry) runningAcceptLoop(ctx context.Context, localListener net.Listener) {
 	defer func() {
-		t.Status.Running = "Stopped"
+		t.setRunning("Stopped")
 		t.wg.Done()
 	}()
 	for {
 		localConn, err := localListener.Accept()
 		if err != nil {
+			if current := t.currentListener(); ctx.Err() == nil && current != nil && current != localListener {
+				// The listener was replaced after the interface address changed
+				localListener = current
+				continue
+			}
+			if ctx.Err() != nil || t.isDrained() {
+				// The entrance was closed as the tunnel stopped, or handed over
+				return
+			}
+			if t.tunnelData.Reverse {
+				var ok bool
+				if localListener, ok = t.relisten(ctx, localListener, err); ok {
+					continue
+				}
+				return
+			}
 			var opErr *net.OpError
 			if errors.As(err, &opErr) && opErr.Op == "accept" && opErr.Err.Error() == "use of closed network connection" {
 				// Close quietly and we're likely shutting down
 				return
 			}
-			fmt.Printf("  Error - tunnel (%s) listener accept failed: %v\n", t.Name(), err)
+			log.Printf("  Error - tunnel (%s) listener accept failed: %v\n", t.Name(), err)
 			return
 		}
-		fmt.Printf("  Info  - Connected tunnel: %v\n", t.Name())
-		go t.forward(ctx, localConn)
+		release, ok := t.admit(localConn)
+		if !ok {
+			continue
+		}
+		queued, ok := t.enqueue(localConn)
+		if !ok {
+			release()
+			continue
+		}
+		log.Printf("  Info  - Connected tunnel: %v\n", t.Name())
+		t.wg.Add(1)
+		go func() {
+			defer t.wg.Done()
+			defer release()
+			if queued && !t.awaitHost(ctx, localConn) {
+				return
+			}
+			t.forward(ctx, localConn)
+		}()
 	}
 }
 
 func (t *Entry) forward(ctx context.Context, localConn net.Conn) {
-	id := t.addConnection(localConn)
-	defer t.removeConnection(localConn)
-	if config.VerboseFlag {
-		fmt.Printf("  Info  - tunnel (%s) id:%s conneting to forward server %s\n", t.Name(), t.Id(), t.Remote().String())
+	record := &audit.Record{
+		Started:  time.Now(),
+		TunnelId: t.Id(),
+		Tunnel:   t.Name(),
+		Host:     t.Host(),
+		Client:   localConn.RemoteAddr().String(),
+		Target:   t.Remote().String(),
 	}
-
-	var sshConn net.Conn
-	if t.host != nil {
-		if !t.host.(engineModels.HostInternal).Open() {
-			// TODO Failed to connect
+	conn, id := t.addConnection(localConn)
+	events.PublishConnection(t.Id(), t.Name(), conn.id, "Opened", record.Client)
+	defer func() {
+		if conn.closedByRequest() {
+			record.Reason = closedByRequest
+		}
+		t.removeConnection(conn, record.Reason)
+		events.PublishConnection(t.Id(), t.Name(), conn.id, "Closed", record.Reason)
+		audit.Write(record)
+		traffic.Add(t.Id(), record.BytesIn, record.BytesOut)
+	}()
+	if err := t.tunnelData.Socket.Apply(localConn); err != nil {
+		log.Printf("  Warn  - tunnel (%s) socket options cannot be applied to client connection: %v\n", t.Name(), err)
+	}
+	if t.tlsConfig != nil {
+		tlsConn, err := t.tlsHandshake(localConn)
+		if err != nil {
+			log.Printf("  Warn  - tunnel (%s) id:%d client %s refused: %v\n", t.Name(), id, record.Client, err)
+			record.Reason = err.Error()
 			return
 		}
-		var ok bool
-		sshConn, ok = t.host.(engineModels.HostInternal).Dial(t.Remote().String())
-		if !ok {
-			// TODO failed to connect
+		localConn = tlsConn
+	}
+	if t.tunnelData.Auth != nil {
+		var err error
+		if record.Subject, err = t.authenticate(localConn); err != nil {
+			log.Printf("  Warn  - tunnel (%s) id:%d client %s refused: %v\n", t.Name(), id, record.Client, err)
+			record.Reason = err.Error()
 			return
 		}
-	} else {
-		// Direct forward
+		if config.VerboseFlag && record.Subject != "" {
+			log.Printf("  Info  - tunnel (%s) id:%d client %s authenticated as %s\n", t.Name(), id, record.Client, record.Subject)
+		}
+	}
+	target := t.Remote().String()
+	if len(t.tunnelData.Routes) > 0 {
 		var err error
-		sshConn, err = net.Dial("tcp", t.Remote().String())
-		if err != nil {
-			fmt.Printf("  Error - tunnel (%s) id:%d unable to forward to server %s\n", t.Name(), id, t.Remote().String())
+		if localConn, target, err = t.route(localConn); err != nil {
+			log.Printf("  Warn  - tunnel (%s) id:%d client %s refused: %v\n", t.Name(), id, record.Client, err)
+			record.Reason = err.Error()
 			return
 		}
+		record.Target = target
+		conn.setTarget(target)
+	}
+	if t.tunnelData.Socks != nil {
+		var err error
+		if target, err = t.socksHandshake(localConn); err != nil {
+			log.Printf("  Warn  - tunnel (%s) id:%d client %s refused: %v\n", t.Name(), id, record.Client, err)
+			record.Reason = err.Error()
+			return
+		}
+		record.Target = target
+		conn.setTarget(target)
+	}
+	if config.VerboseFlag {
+		log.Printf("  Info  - tunnel (%s) id:%s conneting to forward server %s\n", t.Name(), t.Id(), target)
+	}
+
+	var sshConn net.Conn
+	var reason string
+	if t.tunnelData.HTTP != nil {
+		// The proxy dials the forward address for each of the client's requests
+		sshConn = t.httpProxy(id, localConn, t.tlsConfig != nil)
+	} else {
+		sshConn, reason = t.dialForward(ctx, id, target)
+	}
+	if sshConn == nil {
+		if t.tunnelData.Socks != nil {
+			socksReply(localConn, socksHostUnreachable)
+		}
+		record.Reason = reason
+		return
+	}
+	if t.tunnelData.Socks != nil {
+		socksReply(localConn, socksSucceeded)
+	}
+	defer func() { _ = sshConn.Close() }()
+	if t.tunnelData.RemoteAuth != nil {
+		if err := t.presentAuth(sshConn); err != nil {
+			log.Printf("  Error - tunnel (%s) id:%d %v\n", t.Name(), id, err)
+			record.Reason = err.Error()
+			return
+		}
+	}
+	tc := NewTunnelConnection(t.Name(), t.Id(), t.stats, t.tunnelData.Timeouts, sshConn, localConn)
+	if f := t.newConnFilter(localConn, target); f != nil {
+		tc.filterWith(f)
+	}
+	if stream := t.captureStream(localConn); stream != nil {
+		defer stream.Close()
+		tc.captureTo(stream)
+	}
+	if t.tunnelData.Sniff {
+		tc.sniff(func(protocol string) {
+			conn.setProtocol(protocol)
+			log.Printf("  Info  - tunnel (%s) id:%d client %s carries %s\n", t.Name(), id, record.Client, protocol)
+		})
+	}
+	conn.forwarding(tc)
+	tc.Start(ctx)
+	record.BytesIn, record.BytesOut, record.Reason = tc.BytesIn(), tc.BytesOut(), tc.Reason()
+	record.Protocol = conn.sniffed()
+	t.stats.Closed(time.Since(record.Started), record.BytesIn, record.BytesOut)
+}
+
+// dialForward connects to the forward address, using a prewarmed channel when
+// there is one, retrying with backoff as many times as the tunnel allows.  On failure the reason is returned for the audit
+func (t *Entry) dialForward(ctx context.Context, id int, target string) (net.Conn, string) {
+	if conn := t.takePrewarmed(); conn != nil {
+		return conn, ""
+	}
+	attempts := t.tunnelData.Retry.AttemptsOrZero()
+	b := backoff.NewBackoff(t.tunnelData.Retry.DelayOrDefault(), t.tunnelData.Retry.MaxDelayOrDefault())
+	for attempt := 1; ; attempt++ {
+		started := time.Now()
+		conn, reason := t.dialForwardOnce(target)
+		if conn != nil {
+			t.stats.Dialed(time.Since(started))
+			return conn, ""
+		}
+		if attempt > attempts {
+			log.Printf("  Error - tunnel (%s) id:%d unable to forward to server %s: %s\n", t.Name(), id, target, reason)
+			return nil, reason
+		}
+		log.Printf("  Warn  - tunnel (%s) id:%d %s. Retrying (%d of %d)\n", t.Name(), id, reason, attempt, attempts)
+		if !b.Wait(ctx) {
+			return nil, reason
+		}
 	}
-	NewTunnelConnection(t.Name(), t.Id(), t.stats, sshConn, localConn).Start(ctx)
+}
+
+func (t *Entry) dialForwardOnce(target string) (net.Conn, string) {
+	if t.host != nil && !t.tunnelData.Reverse {
+		if !t.host.(engineModels.HostInternal).Open() {
+			return nil, "host unavailable"
+		}
+		if t.tunnelData.Stripe != nil {
+			return t.dialStriped(target)
+		}
+		sshConn, ok := t.host.(engineModels.HostInternal).Dial(target)
+		if !ok {
+			return nil, "forward dial failed"
+		}
+		return sshConn, ""
+	}
+	// Direct forward
+	network := "tcp"
+	if config.NewAddress(target).IsAbstract() {
+		network = "unix"
+	}
+	conn, err := dialer(t.tunnelData.Timeouts, t.tunnelData.Socket).Dial(network, target)
+	if err != nil {
+		return nil, fmt.Sprintf("forward dial failed: %v", err)
+	}
+	if err = t.tunnelData.Socket.Apply(conn); err != nil {
+		log.Printf("  Warn  - tunnel (%s) socket options cannot be applied to forward connection: %v\n", t.Name(), err)
+	}
+	return conn, ""
 }
 
 func (t *Entry) Validate(he engineModels.HostEngineInternal) bool {
 	t.tunnelData.Name = strings.TrimSpace(t.tunnelData.Name)
 	if t.tunnelData.Name == "" {
-		fmt.Printf("  Error - tunnel name cannot be blank\n")
+		log.Printf("  Error - tunnel name cannot be blank\n")
+		t.Status.Valid = false
+	}
+	if len(t.tunnelData.Routes) > 0 && !t.validateRoutes() {
 		t.Status.Valid = false
 	}
-	if t.tunnelData.Remote == nil || t.tunnelData.Remote.IsBlank() {
-		fmt.Printf("  Error - tunnel (%s) requires a forward address\n", t.tunnelData.Name)
+	if t.tunnelData.HTTP != nil && !t.validateHTTP() {
+		t.Status.Valid = false
+	}
+	if t.tunnelData.Socks != nil {
+		if !t.validateSocks() {
+			t.Status.Valid = false
+		}
+	} else if len(t.tunnelData.Routes) > 0 && (t.tunnelData.Remote == nil || t.tunnelData.Remote.IsBlank()) {
+		// Clients matching no route are refused
+	} else if t.tunnelData.Remote == nil || t.tunnelData.Remote.IsBlank() {
+		log.Printf("  Error - tunnel (%s) requires a forward address\n", t.tunnelData.Name)
 		t.Status.Valid = false
 	} else if !t.tunnelData.Remote.Validate("tunnel", t.tunnelData.Name, "forward address", true, false) {
 		t.Status.Valid = false
+	} else if t.tunnelData.Remote.IsAbstract() && strings.TrimSpace(t.tunnelData.Host) != "" && !t.tunnelData.Reverse {
+		// ssh forwards to unix sockets by path, which cannot name an abstract one
+		log.Printf("  Error - tunnel (%s) forward address (%s) is an abstract unix socket, which cannot be reached through a host\n",
+			t.tunnelData.Name, t.tunnelData.Remote)
+		t.Status.Valid = false
 	}
 
-	if (t.tunnelData.Local == nil || t.tunnelData.Local.IsBlank()) && t.tunnelData.Remote != nil && t.tunnelData.Remote.IsValid() {
-		fmt.Printf("  Warn  - tunnel (%s) Local entrance undefined. Defaulting to 127.0.0.1:%d\n", t.tunnelData.Name, t.tunnelData.Remote.Port())
+	if (t.tunnelData.Local == nil || t.tunnelData.Local.IsBlank()) && t.tunnelData.Remote != nil && t.tunnelData.Remote.IsValid() &&
+		!t.tunnelData.Remote.IsAbstract() {
+		log.Printf("  Warn  - tunnel (%s) Local entrance undefined. Defaulting to 127.0.0.1:%d\n", t.tunnelData.Name, t.tunnelData.Remote.Port())
 		t.tunnelData.Local = config.NewAddress(fmt.Sprintf("127.0.0.1:%d", t.tunnelData.Remote.Port()))
 	}
 	if t.tunnelData.Local == nil || t.tunnelData.Local.IsBlank() {
-		fmt.Printf("  Error - tunnel (%s) missing a local address that cannot be derived\n", t.tunnelData.Name)
-	} else if !t.tunnelData.Local.Validate("tunnel", t.tunnelData.Name, "local address", true, false) {
+		log.Printf("  Error - tunnel (%s) missing a local address that cannot be derived\n", t.tunnelData.Name)
+		t.Status.Valid = false
+	} else if t.tunnelData.Local.IsAbstract() {
+		if t.tunnelData.Reverse {
+			log.Printf("  Error - tunnel (%s) local address (%s) is an abstract unix socket, which cannot be opened on a host\n",
+				t.tunnelData.Name, t.tunnelData.Local)
+			t.Status.Valid = false
+		} else if !t.tunnelData.Local.Validate("tunnel", t.tunnelData.Name, "local address", true, false) {
+			t.Status.Valid = false
+		}
+	} else if t.tunnelData.Reverse {
+		if !t.validateReverse() {
+			t.Status.Valid = false
+		} else if t.tunnelData.Socks != nil {
+			t.warnOpenProxy()
+		}
+	} else if typed := t.tunnelData.Local.String(); !t.tunnelData.Local.Validate("tunnel", t.tunnelData.Name, "local address", true, false) {
+		t.Status.Valid = false
+	} else if !t.bindLocal(typed) {
+		t.Status.Valid = false
+	} else if t.tunnelData.Socks != nil {
+		t.warnOpenProxy()
+	}
+	if t.tunnelData.TLS != nil && !t.validateTLS() {
+		t.Status.Valid = false
+	}
+
+	if !t.tunnelData.Timeouts.Validate("tunnel", t.tunnelData.Name) {
+		t.Status.Valid = false
+	}
+	if !t.tunnelData.Socket.Validate("tunnel", t.tunnelData.Name) {
+		t.Status.Valid = false
+	}
+	if !t.tunnelData.Schedule.Validate("tunnel", t.tunnelData.Name) {
+		t.Status.Valid = false
+	}
+	if !t.tunnelData.Retry.Validate("tunnel", t.tunnelData.Name) {
+		t.Status.Valid = false
+	}
+	if !t.tunnelData.Queue.Validate("tunnel", t.tunnelData.Name) {
+		t.Status.Valid = false
+	} else if t.tunnelData.Queue != nil && (t.tunnelData.Reverse || t.tunnelData.Host == "") {
+		log.Printf("  Warn  - tunnel (%s) queue has no effect without a host to reconnect to on this side\n", t.Name())
+	}
+	if !t.tunnelData.Stripe.Validate("tunnel", t.tunnelData.Name) {
+		t.Status.Valid = false
+	} else if t.tunnelData.Stripe != nil && (t.tunnelData.Reverse || strings.TrimSpace(t.tunnelData.Host) == "") {
+		log.Printf("  Error - tunnel (%s) stripe requires a host to spread its connections across the channels of\n", t.Name())
+		t.Status.Valid = false
+	} else if t.tunnelData.Stripe != nil && t.tunnelData.Prewarm != nil {
+		log.Printf("  Error - tunnel (%s) stripe cannot be combined with prewarm\n", t.Name())
+		t.Status.Valid = false
+	}
+	if !t.tunnelData.Prewarm.Validate("tunnel", t.tunnelData.Name) {
+		t.Status.Valid = false
+	}
+	if !t.validateWatchdog() {
+		t.Status.Valid = false
+	}
+	if !t.validateOnion() {
+		t.Status.Valid = false
+	}
+	if !t.validateRateLimit() {
+		t.Status.Valid = false
+	}
+	if !t.validateAccess() {
+		t.Status.Valid = false
+	}
+	if !t.validateAuth() {
+		t.Status.Valid = false
+	}
+	if !t.tunnelData.Capture.Validate("tunnel", t.tunnelData.Name) {
+		t.Status.Valid = false
+	}
+	if !t.validateFilters() {
 		t.Status.Valid = false
 	}
 
 	t.tunnelData.Host = strings.TrimSpace(t.tunnelData.Host)
-	if t.tunnelData.Host == "" {
-		fmt.Printf("  Info  - tunnel (%s) exits on the local host\n", t.tunnelData.Name)
+	if t.tunnelData.Host == "" && t.tunnelData.Reverse {
+		log.Printf("  Error - tunnel (%s) reverse tunnel requires a host to open its entrance on\n", t.tunnelData.Name)
+		t.Status.Valid = false
+	} else if t.tunnelData.Host == "" {
+		log.Printf("  Info  - tunnel (%s) exits on the local host\n", t.tunnelData.Name)
 	} else if host, ok := he.Host(t.tunnelData.Host); !ok {
-		fmt.Printf("  Error - tunnel (%s) remote host (%s) undefined\n", t.tunnelData.Name, t.tunnelData.Host)
+		log.Printf("  Error - tunnel (%s) remote host (%s) undefined\n", t.tunnelData.Name, t.tunnelData.Host)
 		t.Status.Valid = false
 	} else if !host.Valid() {
-		fmt.Printf("  Error - tunnel (%s) remote host (%s) is invalid\n", t.tunnelData.Name, t.tunnelData.Host)
+		log.Printf("  Error - tunnel (%s) remote host (%s) is invalid\n", t.tunnelData.Name, t.tunnelData.Host)
 		t.Status.Valid = false
 	} else if t.Status.Valid {
 		t.host = host.(engineModels.HostInternal)
 		t.host.Referenced()
+		if lifetime := t.tunnelData.Timeouts.MaxLifetime(); lifetime > 0 {
+			t.host.LimitLifetime(lifetime)
+		}
 	}
 
 	if config.VerboseFlag && t.Status.Valid {
-		fmt.Printf("  Info  - tunnel (%s) validated\n", t.tunnelData.Name)
+		log.Printf("  Info  - tunnel (%s) validated\n", t.tunnelData.Name)
 	}
 
 	//t.stats = &TunnelStats{
@@ -174,55 +585,125 @@ func (t *Entry) Id() string {
 func (t *Entry) Name() string {
 	return t.tunnelData.Name
 }
+
+// Local is the tunnel's entrance address, which follows the address of a bound
+// interface as it changes
 func (t *Entry) Local() *config.Address {
+	t.lock.Lock()
+	defer t.lock.Unlock()
 	return t.tunnelData.Local
 }
 func (t *Entry) Remote() *config.Address {
 	return t.tunnelData.Remote
 }
+
+// Reverse reports whether the tunnel's entrance is on its host
+func (t *Entry) Reverse() bool {
+	return t.tunnelData.Reverse
+}
 func (t *Entry) Host() string {
 	return t.tunnelData.Host
 }
 func (t *Entry) Valid() bool {
 	return t.tunnelData.Status.Valid
 }
+func (t *Entry) Enabled() bool {
+	return t.IsEnabled()
+}
+func (t *Entry) Scheduled() bool {
+	return t.tunnelData.Schedule != nil
+}
+func (t *Entry) InSchedule(now time.Time) bool {
+	return t.tunnelData.Schedule.Active(now)
+}
 func (t *Entry) Running() string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
 	return t.tunnelData.Status.Running
 }
 func (t *Entry) Metadata() *config.Metadata {
 	return t.tunnelData.Metadata
 }
+func (t *Entry) StartedAt() time.Time {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.startedAt
+}
+func (t *Entry) Connections() int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return len(t.conns)
+}
 
-func (t *Entry) waitForTermination(ctx context.Context, localListener net.Listener) {
+func (t *Entry) Distributions() engineModels.Distributions {
+	if t.stats == nil {
+		return engineModels.Distributions{}
+	}
+	return t.stats.Distributions()
+}
+
+func (t *Entry) waitForTermination(ctx context.Context) {
 	<-ctx.Done()
-	fmt.Printf("  Info  - tunnel (%s) stopped listening on %s\n", t.Name(), t.Local().String())
-	_ = localListener.Close()
+	log.Printf("  Info  - tunnel (%s) stopped listening on %s\n", t.Name(), t.Local().String())
 	t.lock.Lock()
 	defer t.lock.Unlock()
+	if t.listener != nil {
+		_ = t.listener.Close()
+		t.listener = nil
+	}
 	for _, conn := range t.conns {
-		_ = conn.Close()
+		_ = conn.client.Close()
 	}
-	t.conns = []net.Conn{}
+	t.conns = []*activeConn{}
 	t.cancel = nil
+	t.stopCapture()
+}
+
+func (t *Entry) setListener(listener net.Listener) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.listener = listener
+}
+
+// BoundAddress is the address the tunnel's entrance is listening on, or its
+// configured address when it is not
+func (t *Entry) BoundAddress() string {
+	if listener := t.currentListener(); listener != nil {
+		return listener.Addr().String()
+	}
+	return t.Local().String()
 }
 
-func (t *Entry) addConnection(conn net.Conn) int {
+func (t *Entry) currentListener() net.Listener {
 	t.lock.Lock()
 	defer t.lock.Unlock()
+	return t.listener
+}
+
+func (t *Entry) addConnection(client net.Conn) (*activeConn, int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.nextConn++
+	conn := &activeConn{
+		id:      t.nextConn,
+		client:  client,
+		target:  t.Remote().String(),
+		started: time.Now(),
+	}
 	t.conns = append(t.conns, conn)
-	return t.stats.Connected()
+	return conn, t.stats.Connected()
 }
 
-func (t *Entry) removeConnection(conn net.Conn) {
+func (t *Entry) removeConnection(conn *activeConn, reason string) {
 	t.lock.Lock()
 	defer t.lock.Unlock()
-	conns := make([]net.Conn, 0, len(t.conns)-1)
+	conns := make([]*activeConn, 0, len(t.conns))
 	for _, c := range t.conns {
 		if conn != c {
 			conns = append(conns, c)
 		}
 	}
-	_ = conn.Close()
-	t.stats.Disconnected()
+	_ = conn.client.Close()
+	t.stats.Disconnected(reason)
 	t.conns = conns
 }
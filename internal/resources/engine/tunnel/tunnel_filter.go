@@ -0,0 +1,106 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package tunnel
+
+import (
+	"errors"
+	"net"
+
+	"us.figge.auto-ssh/internal/core/filter"
+	"us.figge.auto-ssh/internal/core/log"
+)
+
+// filterWindow is how much of what a client sends is inspected before any
+// filters still undecided are taken to allow the connection
+const filterWindow = 64 * 1024
+
+var errFiltered = errors.New("connection denied by filter")
+
+// validateFilters makes the tunnel's filters, which are shared by its
+// connections
+func (t *Entry) validateFilters() bool {
+	valid := true
+	t.filters = nil
+	for _, f := range t.tunnelData.Filters {
+		if f == nil {
+			log.Printf("  Error - tunnel (%s) filter cannot be blank\n", t.tunnelData.Name)
+			valid = false
+			continue
+		}
+		if !f.Validate("tunnel", t.tunnelData.Name) {
+			valid = false
+			continue
+		}
+		if f.Command != "" {
+			t.filters = append(t.filters, &filter.Command{
+				Command: f.Command,
+				Args:    f.Args,
+				Config:  f.Config,
+				Timeout: f.TimeoutOrDefault(),
+			})
+			continue
+		}
+		made, err := filter.New(f.Name, f.Config)
+		if err != nil {
+			log.Printf("  Error - tunnel (%s) %v\n", t.tunnelData.Name, err)
+			valid = false
+			continue
+		}
+		t.filters = append(t.filters, made)
+	}
+	return valid
+}
+
+// connFilter runs a tunnel's filters over what one client sends, until each has
+// allowed the connection or the window has been inspected
+type connFilter struct {
+	conn      *filter.Connection
+	undecided []filter.Filter
+	data      []byte
+}
+
+func (t *Entry) newConnFilter(client net.Conn, target string) *connFilter {
+	if len(t.filters) == 0 {
+		return nil
+	}
+	return &connFilter{
+		conn:      &filter.Connection{Tunnel: t.Name(), Client: client.RemoteAddr().String(), Target: target},
+		undecided: append([]filter.Filter{}, t.filters...),
+	}
+}
+
+// inspect adds what the client sent to that inspected, returning the reason
+// when a filter denies the connection
+func (f *connFilter) inspect(chunk []byte) (string, bool) {
+	if len(f.undecided) == 0 {
+		return "", false
+	}
+	f.data = append(f.data, chunk[:min(len(chunk), filterWindow-len(f.data))]...)
+	undecided := f.undecided[:0]
+	for _, each := range f.undecided {
+		switch verdict, reason := each.Inspect(f.conn, f.data); verdict {
+		case filter.Deny:
+			return reason, true
+		case filter.Continue:
+			undecided = append(undecided, each)
+		}
+	}
+	f.undecided = undecided
+	if len(f.data) >= filterWindow {
+		f.undecided = nil
+	}
+	if len(f.undecided) == 0 {
+		f.data = nil
+	}
+	return "", false
+}
+
+// filterWith has the client's traffic inspected before it is forwarded.
+// Spliced traffic never passes through the tunnel, so is not spliced while
+// filtering
+func (t *tunnelConn) filterWith(f *connFilter) {
+	t.filter = f
+	t.splice = false
+}
@@ -0,0 +1,167 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/log"
+)
+
+const httpHeaderTimeout = 30 * time.Second
+
+// pipeConn is the proxy's end of the pipe carrying a client's traffic, which
+// reports the client's address so the proxy can pass it on
+type pipeConn struct {
+	net.Conn
+	remote net.Addr
+}
+
+func (c pipeConn) RemoteAddr() net.Addr { return c.remote }
+
+// pipeListener hands its one connection to the proxy's server, then waits
+// for the connection to close
+type pipeListener struct {
+	conn net.Conn
+	done chan struct{}
+	once sync.Once
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	if conn := l.conn; conn != nil {
+		l.conn = nil
+		return conn, nil
+	}
+	<-l.done
+	return nil, net.ErrClosed
+}
+
+func (l *pipeListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr { return pipeAddr{} }
+
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "pipe" }
+
+// httpProxy serves the client's requests through a reverse proxy to the
+// forward address.  The client's end of a pipe is returned, to be forwarded to
+// as the forward address itself would be, so the client's traffic is counted
+// and timed out as any other
+func (t *Entry) httpProxy(id int, client net.Conn, secure bool) net.Conn {
+	clientEnd, proxyEnd := net.Pipe()
+	target := t.Remote().String()
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _ string, _ string) (net.Conn, error) {
+			conn, reason := t.dialForward(ctx, id, target)
+			if conn == nil {
+				return nil, errors.New(reason)
+			}
+			return conn, nil
+		},
+		IdleConnTimeout: t.tunnelData.Timeouts.IdleTimeout(),
+	}
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(&url.URL{Scheme: "http", Host: target})
+			pr.Out.Host = t.tunnelData.HTTP.HostOrDefault(target)
+			pr.SetXForwarded()
+			if secure {
+				pr.Out.Header.Set("X-Forwarded-Proto", "https")
+			}
+		},
+		Transport: transport,
+		ModifyResponse: func(resp *http.Response) error {
+			t.rewriteLocation(resp, secure)
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("  Warn  - tunnel (%s) id:%d %s %s failed: %v\n", t.Name(), id, r.Method, r.URL.Path, err)
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+	listener := &pipeListener{conn: pipeConn{Conn: proxyEnd, remote: client.RemoteAddr()}, done: make(chan struct{})}
+	server := &http.Server{
+		Handler:           proxy,
+		ReadHeaderTimeout: httpHeaderTimeout,
+		ConnState: func(_ net.Conn, state http.ConnState) {
+			if state == http.StateClosed || state == http.StateHijacked {
+				_ = listener.Close()
+			}
+		},
+	}
+	go func() {
+		_ = server.Serve(listener)
+		transport.CloseIdleConnections()
+	}()
+	return clientEnd
+}
+
+// rewriteLocation points the absolute urls the service gives for itself back
+// at the entrance the client used
+func (t *Entry) rewriteLocation(resp *http.Response, secure bool) {
+	entrance := resp.Request.Header.Get("X-Forwarded-Host")
+	if entrance == "" {
+		return
+	}
+	for _, header := range []string{"Location", "Content-Location"} {
+		location := resp.Header.Get(header)
+		if location == "" {
+			continue
+		}
+		u, err := url.Parse(location)
+		if err != nil || u.Host == "" || !t.serviceHost(u.Hostname()) {
+			continue
+		}
+		u.Scheme, u.Host = "http", entrance
+		if secure {
+			u.Scheme = "https"
+		}
+		resp.Header.Set(header, u.String())
+	}
+}
+
+// serviceHost reports whether a host name is one the service goes by
+func (t *Entry) serviceHost(name string) bool {
+	for _, address := range []string{t.Remote().String(), t.tunnelData.HTTP.HostOrDefault("")} {
+		if address == "" {
+			continue
+		}
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			host = address
+		}
+		if strings.EqualFold(strings.Trim(host, "[]"), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateHTTP checks an http tunnel, which proxies to its one forward address
+func (t *Entry) validateHTTP() bool {
+	valid := t.tunnelData.HTTP.Validate("tunnel", t.tunnelData.Name)
+	if t.tunnelData.Socks != nil {
+		log.Printf("  Error - tunnel (%s) cannot be both an http and a socks proxy\n", t.tunnelData.Name)
+		valid = false
+	}
+	if len(t.tunnelData.Routes) > 0 {
+		log.Printf("  Error - tunnel (%s) http proxy cannot have routes\n", t.tunnelData.Name)
+		valid = false
+	}
+	return valid
+}
@@ -0,0 +1,125 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package tunnel
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// idleMonitor ends a connection once traffic stops.  Read idle covers data
+// arriving from the client, write idle data returned to the client, and linger
+// bounds a half-closed connection that could not pass its end of stream on.
+// Each deadline is measured from the last traffic, so busy connections never
+// expire
+type idleMonitor struct {
+	readIdle  time.Duration
+	writeIdle time.Duration
+	linger    atomic.Int64
+	lastRead  atomic.Int64
+	lastWrite atomic.Int64
+	expired   func(reason string)
+	lock      sync.Mutex
+	timer     *time.Timer
+	stopped   bool
+}
+
+func newIdleMonitor(readIdle time.Duration, writeIdle time.Duration, expired func(reason string)) *idleMonitor {
+	m := &idleMonitor{
+		readIdle:  readIdle,
+		writeIdle: writeIdle,
+		expired:   expired,
+	}
+	now := time.Now().UnixNano()
+	m.lastRead.Store(now)
+	m.lastWrite.Store(now)
+	return m
+}
+
+func (m *idleMonitor) read() {
+	m.lastRead.Store(time.Now().UnixNano())
+}
+
+func (m *idleMonitor) wrote() {
+	m.lastWrite.Store(time.Now().UnixNano())
+}
+
+// lingerFor closes the connection once it has been quiet in both directions
+// for the duration
+func (m *idleMonitor) lingerFor(d time.Duration) {
+	m.linger.Store(int64(d))
+	m.start()
+}
+
+func (m *idleMonitor) start() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.timer != nil {
+		m.timer.Stop()
+		m.timer = nil
+	}
+	m.schedule()
+}
+
+func (m *idleMonitor) stop() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.stopped = true
+	if m.timer != nil {
+		m.timer.Stop()
+		m.timer = nil
+	}
+}
+
+func (m *idleMonitor) check() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.timer = nil
+	m.schedule()
+}
+
+// schedule expires the connection if a deadline has passed, or otherwise arms
+// the timer for the nearest deadline
+func (m *idleMonitor) schedule() {
+	if m.stopped {
+		return
+	}
+	now := time.Now()
+	lastRead := time.Unix(0, m.lastRead.Load())
+	lastWrite := time.Unix(0, m.lastWrite.Load())
+	lastTraffic := lastRead
+	if lastWrite.After(lastTraffic) {
+		lastTraffic = lastWrite
+	}
+	deadlines := []struct {
+		timeout time.Duration
+		last    time.Time
+		reason  string
+	}{
+		{m.readIdle, lastRead, "read idle timeout"},
+		{m.writeIdle, lastWrite, "write idle timeout"},
+		{time.Duration(m.linger.Load()), lastTraffic, "half-closed idle timeout"},
+	}
+	var next time.Duration
+	for _, deadline := range deadlines {
+		if deadline.timeout <= 0 {
+			continue
+		}
+		remaining := deadline.timeout - now.Sub(deadline.last)
+		if remaining <= 0 {
+			m.stopped = true
+			go m.expired(fmt.Sprintf("%s (%v)", deadline.reason, deadline.timeout))
+			return
+		}
+		if next == 0 || remaining < next {
+			next = remaining
+		}
+	}
+	if next > 0 {
+		m.timer = time.AfterFunc(next, m.check)
+	}
+}
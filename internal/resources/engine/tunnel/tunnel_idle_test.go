@@ -0,0 +1,79 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package tunnel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// startMonitor starts an idle monitor, returning a channel receiving the reason
+// it expires
+func startMonitor(t *testing.T, readIdle time.Duration, writeIdle time.Duration) (*idleMonitor, chan string) {
+	expired := make(chan string, 1)
+	m := newIdleMonitor(readIdle, writeIdle, func(reason string) { expired <- reason })
+	m.start()
+	t.Cleanup(m.stop)
+	return m, expired
+}
+
+// busy keeps traffic flowing through the monitor for the duration
+func busy(traffic func(), d time.Duration) {
+	for end := time.Now().Add(d); time.Now().Before(end); {
+		traffic()
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func expiry(t *testing.T, expired chan string, within time.Duration) string {
+	select {
+	case reason := <-expired:
+		return reason
+	case <-time.After(within):
+		t.Fatalf("monitor not expired after %v", within)
+		return ""
+	}
+}
+
+func TestIdleMonitorReadIdle(t *testing.T) {
+	m, expired := startMonitor(t, 100*time.Millisecond, time.Minute)
+	started := time.Now()
+	// Data returned to the client does not keep the read side alive
+	go busy(m.wrote, 500*time.Millisecond)
+	assert.Equal(t, "read idle timeout (100ms)", expiry(t, expired, 5*time.Second))
+	assert.Less(t, time.Since(started), 500*time.Millisecond)
+}
+
+func TestIdleMonitorWriteIdle(t *testing.T) {
+	m, expired := startMonitor(t, time.Minute, 100*time.Millisecond)
+	started := time.Now()
+	go busy(m.read, 500*time.Millisecond)
+	assert.Equal(t, "write idle timeout (100ms)", expiry(t, expired, 5*time.Second))
+	assert.Less(t, time.Since(started), 500*time.Millisecond)
+}
+
+func TestIdleMonitorTrafficDefers(t *testing.T) {
+	m, expired := startMonitor(t, 100*time.Millisecond, 100*time.Millisecond)
+	started := time.Now()
+	busy(func() {
+		m.read()
+		m.wrote()
+	}, 400*time.Millisecond)
+	select {
+	case reason := <-expired:
+		t.Fatalf("monitor expired during traffic: %s", reason)
+	default:
+	}
+	assert.Contains(t, expiry(t, expired, 5*time.Second), "idle timeout (100ms)")
+	assert.GreaterOrEqual(t, time.Since(started), 400*time.Millisecond)
+}
+
+func TestIdleMonitorLinger(t *testing.T) {
+	m, expired := startMonitor(t, 0, 0)
+	m.lingerFor(100 * time.Millisecond)
+	assert.Equal(t, "half-closed idle timeout (100ms)", expiry(t, expired, 5*time.Second))
+}
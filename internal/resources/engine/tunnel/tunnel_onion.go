@@ -0,0 +1,113 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/log"
+	"us.figge.auto-ssh/internal/core/tor"
+	"us.figge.auto-ssh/internal/core/utils/backoff"
+)
+
+const onionTimeout = 10 * time.Second
+
+// validateOnion checks the tunnel can be published as an onion service, which
+// exposes its forward address, so only reverse tunnels' may be
+func (t *Entry) validateOnion() bool {
+	o := t.tunnelData.Onion
+	if !o.Validate("tunnel", t.tunnelData.Name) {
+		return false
+	}
+	if o != nil && !t.tunnelData.Reverse {
+		log.Printf("  Error - tunnel (%s) onion requires a reverse tunnel\n", t.Name())
+		return false
+	}
+	return true
+}
+
+// publishOnion keeps the tunnel's forward address published as an onion
+// service for as long as the tunnel runs, publishing it again should tor
+// restart
+func (t *Entry) publishOnion(ctx context.Context) {
+	defer t.wg.Done()
+	b := backoff.NewBackoff(listenRetryInitial, listenRetryMax)
+	for {
+		controller, err := t.addOnion()
+		if err != nil {
+			delay := b.Next()
+			log.Printf("  Error - tunnel (%s) onion service cannot be published: %v. Retrying in %s\n", t.Name(), err, delay)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+				continue
+			}
+		}
+		b.Reset()
+		lost := make(chan error, 1)
+		go func() { lost <- controller.Wait() }()
+		select {
+		case <-ctx.Done():
+			_ = controller.Close()
+			log.Printf("  Info  - tunnel (%s) onion service withdrawn\n", t.Name())
+			return
+		case err = <-lost:
+			_ = controller.Close()
+			log.Printf("  Warn  - tunnel (%s) onion service lost with tor: %v\n", t.Name(), err)
+		}
+	}
+}
+
+// addOnion publishes the onion service through tor's control port, keeping a
+// new key in the key file so the next start publishes the same address
+func (t *Entry) addOnion() (*tor.Controller, error) {
+	o := t.tunnelData.Onion
+	target, err := net.ResolveTCPAddr("tcp", t.Remote().String())
+	if err != nil {
+		return nil, err
+	}
+	port := o.Port
+	if port == 0 {
+		port = target.Port
+	}
+	key := ""
+	if o.KeyFile != "" {
+		bs, err := os.ReadFile(o.KeyFile)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		key = strings.TrimSpace(string(bs))
+	}
+
+	var torConfig *config.Tor
+	if config.C != nil {
+		torConfig = config.C.Tor
+	}
+	controller, err := tor.Control(torConfig.ControlOrDefault(), torConfig.ControlPasswordOrBlank(), onionTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("tor control (%s) %w", torConfig.ControlOrDefault(), err)
+	}
+	serviceID, newKey, err := controller.AddOnion(key, port, target.String())
+	if err != nil {
+		_ = controller.Close()
+		return nil, err
+	}
+	if newKey != "" && o.KeyFile != "" {
+		if err = os.WriteFile(o.KeyFile, []byte(newKey+"\n"), 0600); err != nil {
+			log.Printf("  Warn  - tunnel (%s) onion key cannot be kept in %s, the address will change on restart: %v\n",
+				t.Name(), o.KeyFile, err)
+		}
+	}
+	log.Printf("  Info  - tunnel (%s) published as onion service %s.onion:%d\n", t.Name(), serviceID, port)
+	return controller, nil
+}
@@ -0,0 +1,163 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package tunnel
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/log"
+)
+
+const prewarmRetry = 5 * time.Second
+
+type warmConn struct {
+	conn   net.Conn
+	opened time.Time
+}
+
+// prewarmPool holds channels to the forward address opened ahead of clients
+type prewarmPool struct {
+	lock   sync.Mutex
+	conns  []*warmConn
+	refill chan struct{}
+}
+
+// prewarm keeps the tunnel's pool of channels full until the tunnel stops,
+// replacing channels once they reach their maximum idle age
+func (t *Entry) prewarm(ctx context.Context) {
+	defer t.wg.Done()
+	p := &prewarmPool{refill: make(chan struct{}, 1)}
+	t.lock.Lock()
+	t.pool = p
+	t.lock.Unlock()
+	defer func() {
+		t.lock.Lock()
+		t.pool = nil
+		t.lock.Unlock()
+		p.drain()
+	}()
+
+	size := t.tunnelData.Prewarm.SizeOrZero()
+	maxIdle := t.tunnelData.Prewarm.MaxIdleOrDefault()
+	for {
+		wait := maxIdle
+		p.expire(maxIdle)
+		for p.size() < size && ctx.Err() == nil {
+			conn, reason := t.dialForwardOnce(t.Remote().String())
+			if conn == nil {
+				log.Printf("  Warn  - tunnel (%s) channel cannot be prewarmed: %s\n", t.Name(), reason)
+				wait = prewarmRetry
+				break
+			}
+			p.put(conn)
+		}
+		if oldest := p.oldest(); !oldest.IsZero() && time.Until(oldest.Add(maxIdle)) < wait {
+			wait = time.Until(oldest.Add(maxIdle))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.refill:
+		case <-time.After(wait):
+		}
+	}
+}
+
+// takePrewarmed hands out a channel from the pool, or nil when there is none.
+// With ping set the host's connection is checked first, and the pool emptied
+// should it have failed
+func (t *Entry) takePrewarmed() net.Conn {
+	t.lock.Lock()
+	p := t.pool
+	t.lock.Unlock()
+	if p == nil {
+		return nil
+	}
+	conn := p.take(t.tunnelData.Prewarm.MaxIdleOrDefault())
+	if conn == nil {
+		return nil
+	}
+	if t.tunnelData.Prewarm.Ping && t.host != nil {
+		if _, ok := t.host.Probe(); !ok {
+			_ = conn.Close()
+			p.drain()
+			return nil
+		}
+	}
+	if config.VerboseFlag {
+		log.Printf("  Info  - tunnel (%s) using prewarmed channel\n", t.Name())
+	}
+	return conn
+}
+
+func (p *prewarmPool) put(conn net.Conn) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.conns = append(p.conns, &warmConn{conn: conn, opened: time.Now()})
+}
+
+// take returns the most recently opened channel, closing any too old to use,
+// and asks for the pool to be refilled
+func (p *prewarmPool) take(maxIdle time.Duration) net.Conn {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	defer func() {
+		select {
+		case p.refill <- struct{}{}:
+		default:
+		}
+	}()
+	for len(p.conns) > 0 {
+		w := p.conns[len(p.conns)-1]
+		p.conns = p.conns[:len(p.conns)-1]
+		if time.Since(w.opened) < maxIdle {
+			return w.conn
+		}
+		_ = w.conn.Close()
+	}
+	return nil
+}
+
+func (p *prewarmPool) expire(maxIdle time.Duration) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	kept := p.conns[:0]
+	for _, w := range p.conns {
+		if time.Since(w.opened) < maxIdle {
+			kept = append(kept, w)
+		} else {
+			_ = w.conn.Close()
+		}
+	}
+	p.conns = kept
+}
+
+func (p *prewarmPool) oldest() time.Time {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if len(p.conns) == 0 {
+		return time.Time{}
+	}
+	return p.conns[0].opened
+}
+
+func (p *prewarmPool) size() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return len(p.conns)
+}
+
+func (p *prewarmPool) drain() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, w := range p.conns {
+		_ = w.conn.Close()
+	}
+	p.conns = nil
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package tunnel
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	engineModels "us.figge.auto-ssh/internal/resources/models"
+)
+
+// Latency is the time last probed to connect to the forward address, or zero
+// when unknown
+func (t *Entry) Latency() time.Duration {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.Status.Running != engineModels.Started.String() {
+		return 0
+	}
+	return t.latency
+}
+
+// Probe times a connection to the forward address of a started tunnel.  Through
+// a host this is the channel open, which includes the host's own connect, and is
+// only attempted while the host is already connected
+func (t *Entry) Probe() (time.Duration, error) {
+	if t.Running() != engineModels.Started.String() {
+		return 0, nil
+	}
+	if t.host != nil && !t.host.Connected() {
+		return 0, nil
+	}
+	if t.tunnelData.Remote == nil || t.tunnelData.Remote.IsBlank() {
+		// A socks or routed tunnel may have no forward address of its own to time
+		return 0, nil
+	}
+	latency, err := t.dialProbe()
+	t.lock.Lock()
+	t.latency = latency
+	t.lock.Unlock()
+	if t.stats != nil {
+		t.stats.Latency(latency)
+	}
+	return latency, err
+}
+
+func (t *Entry) dialProbe() (time.Duration, error) {
+	start := time.Now()
+	var conn net.Conn
+	if t.host != nil && !t.tunnelData.Reverse {
+		var ok bool
+		if conn, ok = t.host.Dial(t.Remote().String()); !ok {
+			return 0, fmt.Errorf("forward address %s unreachable through host (%s)", t.Remote(), t.Host())
+		}
+	} else {
+		var err error
+		if conn, err = dialer(t.tunnelData.Timeouts, t.tunnelData.Socket).Dial(t.Remote().Network(), t.Remote().String()); err != nil {
+			return 0, err
+		}
+	}
+	latency := time.Since(start)
+	_ = conn.Close()
+	return latency, nil
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/log"
+	"us.figge.auto-ssh/internal/core/utils/backoff"
+)
+
+const (
+	queueRetryInitial = 250 * time.Millisecond
+	queueRetryMax     = 2 * time.Second
+)
+
+// enqueue holds the client while the tunnel's host is reconnecting, should the
+// tunnel queue them, reporting whether it was queued.  A client the queue has
+// no room for is reset and not ok
+func (t *Entry) enqueue(client net.Conn) (queued bool, ok bool) {
+	if t.tunnelData.Queue == nil || t.host == nil || t.tunnelData.Reverse || t.host.Connected() {
+		return false, true
+	}
+	size := t.tunnelData.Queue.SizeOrDefault()
+	t.lock.Lock()
+	if t.queued >= size {
+		t.lock.Unlock()
+		t.reset(client, fmt.Errorf("host (%s) is reconnecting and the queue is full (%d waiting)", t.host.Name(), size))
+		return false, false
+	}
+	t.queued++
+	first := t.queued == 1
+	t.lock.Unlock()
+	if first {
+		log.Printf("  Info  - tunnel (%s) holding clients while host (%s) reconnects\n", t.Name(), t.host.Name())
+	}
+	return true, true
+}
+
+// awaitHost waits for the host of a queued client to connect, resetting the
+// client should it not within the queue's timeout
+func (t *Entry) awaitHost(ctx context.Context, client net.Conn) bool {
+	defer func() {
+		t.lock.Lock()
+		t.queued--
+		t.lock.Unlock()
+	}()
+	timeout := t.tunnelData.Queue.TimeoutOrDefault()
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	b := backoff.NewBackoff(queueRetryInitial, queueRetryMax)
+	for {
+		if t.host.Open() {
+			return true
+		}
+		if waitCtx.Err() != nil || !b.Wait(waitCtx) {
+			break
+		}
+	}
+	if ctx.Err() != nil {
+		_ = client.Close()
+		return false
+	}
+	t.reset(client, fmt.Errorf("host (%s) did not reconnect within %v", t.host.Name(), timeout))
+	return false
+}
+
+// reset turns the client away, telling an http client why with a 503, and
+// resetting any other's connection so it is not mistaken for one the service
+// closed
+func (t *Entry) reset(client net.Conn, err error) {
+	if t.tunnelData.HTTP != nil && t.tlsConfig == nil {
+		_ = client.SetWriteDeadline(time.Now().Add(time.Second))
+		body := err.Error() + "\n"
+		_, _ = fmt.Fprintf(client, "HTTP/1.1 %d %s\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Length: %d\r\nConnection: close\r\n\r\n%s",
+			http.StatusServiceUnavailable, http.StatusText(http.StatusServiceUnavailable), len(body), body)
+	} else if tcpConn, ok := client.(*net.TCPConn); ok {
+		_ = tcpConn.SetLinger(0)
+	}
+	_ = client.Close()
+	ip := client.RemoteAddr().String()
+	if host, _, splitErr := net.SplitHostPort(ip); splitErr == nil {
+		ip = host
+	}
+	t.refuse(ip, err)
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package tunnel
+
+import (
+	"net"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/log"
+	"us.figge.auto-ssh/internal/core/utils/ratelimit"
+)
+
+// refusedLogInterval keeps a runaway or unwelcome client from flooding the log
+// with its refusals, which are reported at most this often
+const refusedLogInterval = 10 * time.Second
+
+// validateRateLimit makes the tunnel's limiter, which is kept while the tunnel
+// is stopped and started, so a client cannot reset its allowance that way
+func (t *Entry) validateRateLimit() bool {
+	t.limiter = nil
+	r := t.tunnelData.RateLimit
+	if !r.Validate("tunnel", t.tunnelData.Name) {
+		return false
+	}
+	if r != nil {
+		t.limiter = ratelimit.New(r.Rate, r.BurstOrDefault(), r.Concurrent)
+	}
+	return true
+}
+
+// admit checks the client is allowed by the tunnel's access rules and within
+// its rate limit, closing its connection when not.  Release is called once an
+// admitted connection closes
+func (t *Entry) admit(client net.Conn) (release func(), ok bool) {
+	if t.access == nil && t.limiter == nil {
+		return func() {}, true
+	}
+	ip := client.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	if t.access != nil {
+		if err := t.access.Check(net.ParseIP(ip)); err != nil {
+			_ = client.Close()
+			t.refuse(ip, err)
+			return nil, false
+		}
+	}
+	if t.limiter == nil {
+		return func() {}, true
+	}
+	if err := t.limiter.Allow(ip); err != nil {
+		_ = client.Close()
+		t.refuse(ip, err)
+		return nil, false
+	}
+	return func() { t.limiter.Done(ip) }, true
+}
+
+func (t *Entry) refuse(ip string, err error) {
+	t.lock.Lock()
+	t.refused++
+	refused := t.refused
+	due := time.Since(t.refusedLogged) >= refusedLogInterval
+	if due {
+		t.refused = 0
+		t.refusedLogged = time.Now()
+	}
+	t.lock.Unlock()
+	if !due {
+		return
+	}
+	if refused > 1 {
+		log.Printf("  Warn  - tunnel (%s) client %s refused: %v (%d refused since last reported)\n", t.Name(), ip, err, refused)
+	} else {
+		log.Printf("  Warn  - tunnel (%s) client %s refused: %v\n", t.Name(), ip, err)
+	}
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package tunnel
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/log"
+)
+
+// Required reports whether auto-ssh cannot do without the tunnel, by its
+// configuration or the fail-fast flag
+func (t *Entry) Required() bool {
+	return t.tunnelData.Require || config.FailFastFlag
+}
+
+// CheckRequired confirms each required tunnel started with its entrance open
+// and its host connected, for those depending on the tunnels, such as CI jobs,
+// to be told straight away rather than find out from a refused connection
+func (te *Engine) CheckRequired() error {
+	te.lock.RLock()
+	defer te.lock.RUnlock()
+	var failed []string
+	for _, t := range te.tunnelEntries {
+		if !t.Required() {
+			continue
+		}
+		if reason := t.startFailure(); reason != "" {
+			log.Printf("  Error - tunnel (%s) is required but %s\n", t.Name(), reason)
+			failed = append(failed, t.Name())
+		}
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return fmt.Errorf("required tunnels failed to start: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// Ready reports whether the tunnel can forward connections, with its
+// entrance open and its host connected, and if not the reason why
+func (t *Entry) Ready() (bool, string) {
+	reason := t.startFailure()
+	return reason == "", reason
+}
+
+// Ready reports whether every tunnel that should be running can forward
+// connections
+func (te *Engine) Ready() bool {
+	te.lock.RLock()
+	defer te.lock.RUnlock()
+	now := time.Now()
+	for _, t := range te.tunnelEntries {
+		if t.Valid() && t.IsEnabled() && t.AutoStarts() && t.InSchedule(now) && t.startFailure() != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// startFailure explains why the tunnel is not ready to forward connections,
+// empty when it is
+func (t *Entry) startFailure() string {
+	if !t.Valid() {
+		return "is invalid"
+	}
+	if running := t.Running(); running == "Starting" {
+		return fmt.Sprintf("its entrance (%s) cannot be opened", t.Local().String())
+	} else if running != "Started" {
+		return "did not start"
+	}
+	if t.host != nil && !t.host.Open() {
+		return fmt.Sprintf("its host (%s) cannot be connected to", t.Host())
+	}
+	return ""
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package tunnel
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/journal"
+	"us.figge.auto-ssh/internal/core/log"
+	"us.figge.auto-ssh/internal/core/utils/backoff"
+)
+
+// validateReverse checks the entrance a reverse tunnel opens on its host, whose
+// port may be left to the host as 0.  An entrance other than loopback is only
+// listened on as given when the host's sshd allows it, as openssh does with
+// GatewayPorts clientspecified, and is otherwise listened on loopback or all
+// addresses as the sshd decides
+func (t *Entry) validateReverse() bool {
+	if !t.tunnelData.Local.ValidateListen("tunnel", t.tunnelData.Name, "local address") {
+		return false
+	}
+	if host, _, err := net.SplitHostPort(t.Local().String()); err == nil {
+		if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+			log.Printf("  Info  - tunnel (%s) entrance (%s) on its host requires the host's sshd to allow GatewayPorts\n",
+				t.tunnelData.Name, t.Local().String())
+		}
+	}
+	return true
+}
+
+// listenReverse opens the entrance on the host.  When the port is left to the
+// host, the one it assigned before a restart is asked for again first, so
+// clients can keep using it
+func (t *Entry) listenReverse() (net.Listener, error) {
+	if port := journal.Port(t.Id()); port > 0 && t.Local().Port() == 0 {
+		host, _, _ := net.SplitHostPort(t.Local().String())
+		if listener, err := t.host.Listen(net.JoinHostPort(host, strconv.Itoa(port))); err == nil {
+			return listener, nil
+		}
+		log.Printf("  Info  - tunnel (%s) port %d assigned before cannot be had again\n", t.Name(), port)
+	}
+	return t.host.Listen(t.Local().String())
+}
+
+// logReverseOpened reports the entrance opened on the host, naming the port the
+// host chose when it was left to it and recording it in the journal
+func (t *Entry) logReverseOpened(listener net.Listener) {
+	bound := listener.Addr().String()
+	if t.Local().Port() == 0 {
+		log.Printf("  Info  - tunnel (%s) entrance opened on host (%s) at %s, the port assigned by the host\n", t.Name(), t.Host(), bound)
+		if _, port, err := net.SplitHostPort(bound); err == nil {
+			if p, err := strconv.Atoi(port); err == nil {
+				journal.SetPort(t.Id(), p)
+			}
+		}
+		return
+	}
+	log.Printf("  Info  - tunnel (%s) entrance opened on host (%s) at %s\n", t.Name(), t.Host(), bound)
+}
+
+// relisten reopens the entrance of a reverse tunnel on its host once the
+// host's connection has dropped, taking the entrance with it, backing off
+// between attempts until it reopens or the tunnel is stopped.  A port the host
+// assigned is asked for again, so clients can keep using it
+func (t *Entry) relisten(ctx context.Context, dropped net.Listener, err error) (net.Listener, bool) {
+	_ = dropped.Close()
+	log.Printf("  Warn  - tunnel (%s) entrance on host (%s) was lost: %v. Reopening\n", t.Name(), t.Host(), err)
+	t.setRunning("Starting")
+	addresses := []string{t.Local().String()}
+	if t.Local().Port() == 0 {
+		addresses = append([]string{dropped.Addr().String()}, addresses...)
+	}
+	b := backoff.NewBackoff(listenRetryInitial, listenRetryMax)
+	for {
+		var listener net.Listener
+		for _, address := range addresses {
+			if listener, err = t.host.Listen(address); err == nil {
+				break
+			}
+		}
+		if err == nil {
+			t.setListener(listener)
+			if ctx.Err() != nil {
+				// Stopped while the entrance was reopened
+				_ = listener.Close()
+				return nil, false
+			}
+			t.logReverseOpened(listener)
+			t.setRunning("Started")
+			return listener, true
+		}
+		delay := b.Next()
+		log.Printf("  Error - tunnel (%s) entrance cannot be reopened on host (%s): %v. Retrying in %s\n", t.Name(), t.Host(), err, delay)
+		select {
+		case <-ctx.Done():
+			return nil, false
+		case <-time.After(delay):
+		}
+	}
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package tunnel
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/log"
+)
+
+var errHelloRead = errors.New("client hello read")
+
+// helloConn lets a handshake read the client's hello while keeping a copy of
+// it, and answer nothing
+type helloConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c helloConn) Read(b []byte) (int, error)  { return c.r.Read(b) }
+func (c helloConn) Write(b []byte) (int, error) { return 0, io.ErrClosedPipe }
+
+// peekedConn replays the client's hello ahead of the rest of its traffic
+type peekedConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *peekedConn) Read(b []byte) (int, error) { return c.r.Read(b) }
+
+func (c *peekedConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return c.Conn.Close()
+}
+
+// route picks the forward address of a client from the server name it asked
+// for, read from its hello when the tunnel leaves tls to the service.  The
+// connection to forward is returned, with the hello still to be read
+func (t *Entry) route(conn net.Conn) (net.Conn, string, error) {
+	var serverName string
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		serverName = tlsConn.ConnectionState().ServerName
+	} else {
+		var err error
+		if serverName, conn, err = peekServerName(conn); err != nil {
+			return nil, "", err
+		}
+	}
+	if route := config.MatchRoute(t.tunnelData.Routes, serverName); route != nil {
+		return conn, route.Remote.String(), nil
+	}
+	if t.tunnelData.Remote != nil && !t.tunnelData.Remote.IsBlank() {
+		return conn, t.tunnelData.Remote.String(), nil
+	}
+	if serverName == "" {
+		return nil, "", fmt.Errorf("client named no server and there is no default forward address")
+	}
+	return nil, "", fmt.Errorf("no route for server name (%s)", serverName)
+}
+
+// peekServerName reads the server name from the client's tls hello, returning
+// a connection that replays the hello for the service to handshake with
+func peekServerName(conn net.Conn) (string, net.Conn, error) {
+	var hello bytes.Buffer
+	var serverName string
+	read := false
+	_ = conn.SetReadDeadline(time.Now().Add(tlsHandshakeTimeout))
+	defer func() { _ = conn.SetReadDeadline(time.Time{}) }()
+	err := tls.Server(helloConn{Conn: conn, r: io.TeeReader(conn, &hello)}, &tls.Config{
+		GetConfigForClient: func(info *tls.ClientHelloInfo) (*tls.Config, error) {
+			serverName, read = info.ServerName, true
+			return nil, errHelloRead
+		},
+	}).Handshake()
+	if !read {
+		return "", nil, fmt.Errorf("tls hello unreadable: %v", err)
+	}
+	return serverName, &peekedConn{Conn: conn, r: io.MultiReader(&hello, conn)}, nil
+}
+
+// validateRoutes checks the routes of a tunnel, which needs no forward address
+// of its own when every client is routed
+func (t *Entry) validateRoutes() bool {
+	valid := true
+	seen := make(map[string]bool)
+	for _, route := range t.tunnelData.Routes {
+		if route == nil {
+			log.Printf("  Error - tunnel (%s) route cannot be blank\n", t.tunnelData.Name)
+			valid = false
+			continue
+		}
+		if !route.Validate("tunnel", t.tunnelData.Name) {
+			valid = false
+		} else if seen[route.ServerName] {
+			log.Printf("  Error - tunnel (%s) has more than one route for %s\n", t.tunnelData.Name, route.ServerName)
+			valid = false
+		}
+		seen[route.ServerName] = true
+	}
+	if t.tunnelData.Socks != nil {
+		log.Printf("  Error - tunnel (%s) socks proxy cannot have routes\n", t.tunnelData.Name)
+		valid = false
+	}
+	if t.tunnelData.Prewarm.SizeOrZero() > 0 {
+		log.Printf("  Error - tunnel (%s) with routes cannot prewarm channels\n", t.tunnelData.Name)
+		valid = false
+	}
+	if config.VerboseFlag && valid {
+		names := make([]string, 0, len(t.tunnelData.Routes))
+		for _, route := range t.tunnelData.Routes {
+			names = append(names, route.ServerName)
+		}
+		log.Printf("  Info  - tunnel (%s) routes %s\n", t.tunnelData.Name, strings.Join(names, ", "))
+	}
+	return valid
+}
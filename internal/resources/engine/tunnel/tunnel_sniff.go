@@ -0,0 +1,48 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package tunnel
+
+import (
+	"sync"
+
+	"us.figge.auto-ssh/internal/core/sniff"
+)
+
+// sniffer labels a connection from the first bytes each side sends, the
+// client's being tried first and the server's for protocols it speaks first in
+type sniffer struct {
+	lock    sync.Mutex
+	seen    [2]bool
+	labeled bool
+	label   func(protocol string)
+}
+
+func (s *sniffer) observe(data []byte, fromClient bool) {
+	side := 0
+	if !fromClient {
+		side = 1
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.labeled || s.seen[side] {
+		return
+	}
+	s.seen[side] = true
+	protocol := sniff.Server(data)
+	if fromClient {
+		protocol = sniff.Client(data)
+	}
+	if protocol != "" {
+		s.labeled = true
+		s.label(protocol)
+	}
+}
+
+// sniff labels the connection with the protocol it carries.  Spliced traffic
+// never passes through the tunnel, so is not spliced while sniffing
+func (t *tunnelConn) sniff(label func(protocol string)) {
+	t.sniffer = &sniffer{label: label}
+	t.splice = false
+}
@@ -0,0 +1,44 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package tunnel
+
+import (
+	"net"
+	"syscall"
+
+	"us.figge.auto-ssh/internal/core/config"
+)
+
+// listenConfig applies the reuse options to the tunnel's listener, unix
+// sockets having none to apply
+func listenConfig(socket *config.Socket) *net.ListenConfig {
+	lc := &net.ListenConfig{}
+	if socket != nil && (socket.ReuseAddress || socket.ReusePort) {
+		lc.Control = func(network, address string, c syscall.RawConn) error {
+			if network == "unix" {
+				return nil
+			}
+			var err error
+			ctrlErr := c.Control(func(fd uintptr) {
+				err = setReuse(fd, socket.ReuseAddress, socket.ReusePort)
+			})
+			if ctrlErr != nil {
+				return ctrlErr
+			}
+			return err
+		}
+	}
+	return lc
+}
+
+// dialer dials direct forward connections with the tunnel's keep alive, racing
+// the address families of a dual stack name
+func dialer(timeouts *config.Timeouts, socket *config.Socket) *net.Dialer {
+	d := &net.Dialer{Timeout: timeouts.DialTimeout(), FallbackDelay: timeouts.FallbackDelay()}
+	if socket != nil && socket.KeepAlive != nil && !*socket.KeepAlive {
+		d.KeepAlive = -1
+	}
+	return d
+}
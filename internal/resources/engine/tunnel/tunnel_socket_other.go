@@ -0,0 +1,15 @@
+//go:build !unix
+
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package tunnel
+
+import (
+	"errors"
+)
+
+func setReuse(_ uintptr, _ bool, _ bool) error {
+	return errors.New("socket reuse options are not supported on this platform")
+}
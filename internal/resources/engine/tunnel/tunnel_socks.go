@@ -0,0 +1,187 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package tunnel
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/log"
+)
+
+const (
+	socksVersion          = 5
+	socksAuthVersion      = 1
+	socksHandshakeTimeout = 10 * time.Second
+
+	socksNoAuth       = 0x00
+	socksUserPassword = 0x02
+	socksNoMethods    = 0xff
+
+	socksConnect = 0x01
+
+	socksIPv4   = 0x01
+	socksDomain = 0x03
+	socksIPv6   = 0x04
+
+	socksSucceeded          = 0x00
+	socksHostUnreachable    = 0x04
+	socksCommandUnsupported = 0x07
+	socksAddressUnsupported = 0x08
+)
+
+var errSocksAuth = errors.New("socks authentication failed")
+
+// socksHandshake negotiates a SOCKS5 connect with the client, requiring the
+// tunnel's credentials when it has them, and returns the address the client
+// asked for.  The client is answered once the address has been dialed
+func (t *Entry) socksHandshake(conn net.Conn) (string, error) {
+	_ = conn.SetDeadline(time.Now().Add(socksHandshakeTimeout))
+	defer func() { _ = conn.SetDeadline(time.Time{}) }()
+
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return "", fmt.Errorf("socks greeting unreadable: %v", err)
+	}
+	if header[0] != socksVersion {
+		return "", fmt.Errorf("socks version %d unsupported", header[0])
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", fmt.Errorf("socks greeting unreadable: %v", err)
+	}
+	username, password := t.tunnelData.Socks.Credentials()
+	method := byte(socksNoAuth)
+	if username != "" {
+		method = socksUserPassword
+	}
+	offered := false
+	for _, m := range methods {
+		offered = offered || m == method
+	}
+	if !offered {
+		_, _ = conn.Write([]byte{socksVersion, socksNoMethods})
+		if method == socksUserPassword {
+			return "", fmt.Errorf("%w: client offered no username and password", errSocksAuth)
+		}
+		return "", fmt.Errorf("socks client requires authentication")
+	}
+	if _, err := conn.Write([]byte{socksVersion, method}); err != nil {
+		return "", err
+	}
+	if method == socksUserPassword {
+		if err := socksAuthenticate(conn, username, password); err != nil {
+			return "", err
+		}
+	}
+
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return "", fmt.Errorf("socks request unreadable: %v", err)
+	}
+	if request[1] != socksConnect {
+		socksReply(conn, socksCommandUnsupported)
+		return "", fmt.Errorf("socks command %d unsupported", request[1])
+	}
+	var host string
+	switch request[3] {
+	case socksIPv4, socksIPv6:
+		ip := make(net.IP, net.IPv4len)
+		if request[3] == socksIPv6 {
+			ip = make(net.IP, net.IPv6len)
+		}
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", fmt.Errorf("socks request unreadable: %v", err)
+		}
+		host = ip.String()
+	case socksDomain:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return "", fmt.Errorf("socks request unreadable: %v", err)
+		}
+		name := make([]byte, length[0])
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return "", fmt.Errorf("socks request unreadable: %v", err)
+		}
+		host = string(name)
+	default:
+		socksReply(conn, socksAddressUnsupported)
+		return "", fmt.Errorf("socks address type %d unsupported", request[3])
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return "", fmt.Errorf("socks request unreadable: %v", err)
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
+
+// socksAuthenticate checks the username and password the client sends, as
+// RFC 1929 has it
+func socksAuthenticate(conn net.Conn, username string, password string) error {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return fmt.Errorf("socks authentication unreadable: %v", err)
+	}
+	user := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, user); err != nil {
+		return fmt.Errorf("socks authentication unreadable: %v", err)
+	}
+	length := make([]byte, 1)
+	if _, err := io.ReadFull(conn, length); err != nil {
+		return fmt.Errorf("socks authentication unreadable: %v", err)
+	}
+	pass := make([]byte, length[0])
+	if _, err := io.ReadFull(conn, pass); err != nil {
+		return fmt.Errorf("socks authentication unreadable: %v", err)
+	}
+	userOk := subtle.ConstantTimeCompare(user, []byte(username))
+	passOk := subtle.ConstantTimeCompare(pass, []byte(password))
+	if header[0] != socksAuthVersion || userOk&passOk != 1 {
+		_, _ = conn.Write([]byte{socksAuthVersion, 0x01})
+		return fmt.Errorf("%w: user (%s)", errSocksAuth, user)
+	}
+	_, err := conn.Write([]byte{socksAuthVersion, 0x00})
+	return err
+}
+
+// socksReply answers the client's connect request.  The bound address is not
+// known through the host, so zeros are sent, as ssh -D does
+func socksReply(conn net.Conn, code byte) {
+	_, _ = conn.Write([]byte{socksVersion, code, 0, socksIPv4, 0, 0, 0, 0, 0, 0})
+}
+
+// validateSocks checks a socks tunnel, which has no forward address
+func (t *Entry) validateSocks() bool {
+	valid := t.tunnelData.Socks.Validate("tunnel", t.tunnelData.Name)
+	if t.tunnelData.Remote != nil && !t.tunnelData.Remote.IsBlank() {
+		log.Printf("  Error - tunnel (%s) socks proxy cannot have a forward address\n", t.tunnelData.Name)
+		valid = false
+	}
+	if t.tunnelData.Prewarm.SizeOrZero() > 0 {
+		log.Printf("  Error - tunnel (%s) socks proxy cannot prewarm channels without a forward address\n", t.tunnelData.Name)
+		valid = false
+	}
+	return valid
+}
+
+// warnOpenProxy warns of a socks tunnel without credentials whose entrance can
+// be reached from other machines
+func (t *Entry) warnOpenProxy() {
+	if username, _ := t.tunnelData.Socks.Credentials(); username != "" {
+		return
+	}
+	if host, _, err := net.SplitHostPort(t.Local().String()); err == nil {
+		if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+			log.Printf("  Warn  - tunnel (%s) socks proxy on %s is open to anyone reaching it. Set socks username and password\n",
+				t.tunnelData.Name, t.Local().String())
+		}
+	}
+}
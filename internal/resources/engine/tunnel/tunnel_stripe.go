@@ -0,0 +1,34 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package tunnel
+
+import (
+	"fmt"
+	"net"
+
+	"us.figge.auto-ssh/internal/core/stripe"
+)
+
+// dialStriped opens the tunnel's channels to its stripe server, which
+// connects on to the target and reassembles what is sent across them
+func (t *Entry) dialStriped(target string) (net.Conn, string) {
+	s := t.tunnelData.Stripe
+	streams := make([]net.Conn, 0, s.StreamsOrDefault())
+	for range s.StreamsOrDefault() {
+		conn, ok := t.host.Dial(s.Server.String())
+		if !ok {
+			for _, stream := range streams {
+				_ = stream.Close()
+			}
+			return nil, fmt.Sprintf("stripe server %s unreachable", s.Server)
+		}
+		streams = append(streams, conn)
+	}
+	conn, err := stripe.Dial(streams, target, t.tunnelData.Timeouts.DialTimeout())
+	if err != nil {
+		return nil, fmt.Sprintf("stripe server %s failed to reach %s: %v", s.Server, target, err)
+	}
+	return conn, ""
+}
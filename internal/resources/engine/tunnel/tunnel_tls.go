@@ -0,0 +1,110 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package tunnel
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/log"
+	"us.figge.auto-ssh/internal/core/utils"
+)
+
+const (
+	tlsHandshakeTimeout = 10 * time.Second
+	selfSignedValidity  = 365 * 24 * time.Hour
+)
+
+// validateTLS loads the certificate the tunnel's entrance serves, or signs one
+// for it when none is given
+func (t *Entry) validateTLS() bool {
+	if !t.tunnelData.TLS.Validate("tunnel", t.tunnelData.Name) {
+		return false
+	}
+	var cert tls.Certificate
+	var err error
+	if t.tunnelData.TLS.SelfSigned() {
+		cert, err = t.selfSignedCertificate()
+		if err != nil {
+			log.Printf("  Error - tunnel (%s) tls certificate cannot be signed: %v\n", t.tunnelData.Name, err)
+			return false
+		}
+		sum := sha256.Sum256(cert.Certificate[0])
+		log.Printf("  Info  - tunnel (%s) entrance serves a self-signed certificate SHA256:%s\n",
+			t.tunnelData.Name, base64.RawStdEncoding.EncodeToString(sum[:]))
+	} else {
+		t.tunnelData.TLS.CertificateFile = utils.ExpandHome(t.tunnelData.TLS.CertificateFile)
+		t.tunnelData.TLS.CertificateKey = utils.ExpandHome(t.tunnelData.TLS.CertificateKey)
+		cert, err = tls.LoadX509KeyPair(t.tunnelData.TLS.CertificateFile, t.tunnelData.TLS.CertificateKey)
+		if err != nil {
+			log.Printf("  Error - tunnel (%s) tls certificate cannot be loaded: %v\n", t.tunnelData.Name, err)
+			return false
+		}
+	}
+	t.tlsConfig = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	return true
+}
+
+// selfSignedCertificate signs a certificate for the tunnel's entrance, naming
+// localhost and the entrance's address
+func (t *Entry) selfSignedCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: fmt.Sprintf("auto-ssh tunnel %s", t.tunnelData.Name)},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if host, _, err := net.SplitHostPort(t.Local().String()); err == nil {
+		if ip := net.ParseIP(host); ip == nil {
+			template.DNSNames = append(template.DNSNames, host)
+		} else if !ip.IsLoopback() && !ip.IsUnspecified() {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// tlsHandshake completes the handshake of a client connecting to the tunnel's
+// tls entrance, giving up on clients that stall
+func (t *Entry) tlsHandshake(conn net.Conn) (net.Conn, error) {
+	tlsConn := tls.Server(conn, t.tlsConfig)
+	_ = conn.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+	defer func() { _ = conn.SetDeadline(time.Time{}) }()
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, fmt.Errorf("tls handshake failed: %v", err)
+	}
+	return tlsConn, nil
+}
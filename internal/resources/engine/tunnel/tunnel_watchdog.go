@@ -0,0 +1,170 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/log"
+	engineModels "us.figge.auto-ssh/internal/resources/models"
+)
+
+const watchdogEchoSize = 16
+
+// validateWatchdog checks the tunnel can be watched, which needs a host
+// whose connection can be recycled and, to echo, a forward address of its own
+func (t *Entry) validateWatchdog() bool {
+	w := t.tunnelData.Watchdog
+	if w == nil {
+		return true
+	}
+	if !w.Validate("tunnel", t.tunnelData.Name) {
+		return false
+	}
+	valid := true
+	if t.tunnelData.Host == "" {
+		log.Printf("  Error - tunnel (%s) watchdog requires a host whose connection it can recycle\n", t.tunnelData.Name)
+		valid = false
+	}
+	if w.Echo && (t.tunnelData.Socks != nil || len(t.tunnelData.Routes) > 0) {
+		log.Printf("  Error - tunnel (%s) watchdog cannot echo without a forward address\n", t.tunnelData.Name)
+		valid = false
+	}
+	if !t.tunnelData.Reverse && (t.tunnelData.Remote == nil || t.tunnelData.Remote.IsBlank()) {
+		log.Printf("  Error - tunnel (%s) watchdog requires a forward address to probe\n", t.tunnelData.Name)
+		valid = false
+	}
+	return valid
+}
+
+// watchdog probes the tunnel on the watchdog's interval until it stops,
+// recycling the host's connection once too many probes in a row have failed
+func (t *Entry) watchdog(ctx context.Context) {
+	defer t.wg.Done()
+	w := t.tunnelData.Watchdog
+	ticker := time.NewTicker(w.IntervalOrDefault())
+	defer ticker.Stop()
+	failures := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if t.Running() != engineModels.Started.String() {
+			// A reverse tunnel reopening its entrance has nothing to probe
+			continue
+		}
+		err := t.watchdogProbe(w)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			if failures > 0 {
+				log.Printf("  Info  - tunnel (%s) watchdog probe succeeded again\n", t.Name())
+			} else if config.VerboseFlag {
+				log.Printf("  Info  - tunnel (%s) watchdog probe succeeded\n", t.Name())
+			}
+			failures = 0
+			continue
+		}
+		failures++
+		log.Printf("  Warn  - tunnel (%s) watchdog probe failed (%d of %d): %v\n", t.Name(), failures, w.FailuresOrDefault(), err)
+		if failures >= w.FailuresOrDefault() {
+			log.Printf("  Warn  - tunnel (%s) watchdog recycling the connection to host (%s)\n", t.Name(), t.Host())
+			if t.host.Recycle() {
+				log.Printf("  Info  - tunnel (%s) watchdog reconnected host (%s)\n", t.Name(), t.Host())
+			}
+			failures = 0
+		}
+	}
+}
+
+// watchdogProbe connects through the host to the forward address or, for a
+// reverse tunnel, to the entrance it opened there, echoing random bytes over
+// the connection when asked.  An entrance requiring auth is answered first
+func (t *Entry) watchdogProbe(w *config.Watchdog) error {
+	address := t.Remote().String()
+	if t.tunnelData.Reverse {
+		listener := t.currentListener()
+		if listener == nil {
+			return fmt.Errorf("entrance is not open")
+		}
+		address = watchdogAddress(listener.Addr())
+	}
+	timeout := w.TimeoutOrDefault()
+	type result struct {
+		conn net.Conn
+		ok   bool
+	}
+	results := make(chan result, 1)
+	go func() {
+		conn, ok := t.host.Dial(address)
+		results <- result{conn: conn, ok: ok}
+	}()
+	var conn net.Conn
+	select {
+	case r := <-results:
+		if !r.ok {
+			return fmt.Errorf("%s unreachable through host (%s)", address, t.Host())
+		}
+		conn = r.conn
+	case <-time.After(timeout):
+		go func() {
+			if r := <-results; r.conn != nil {
+				_ = r.conn.Close()
+			}
+		}()
+		return fmt.Errorf("%s did not connect through host (%s) within %v", address, t.Host(), timeout)
+	}
+	defer func() { _ = conn.Close() }()
+	if err := t.probeAuth(conn); err != nil {
+		return fmt.Errorf("%s cannot be authenticated to: %v", address, err)
+	}
+	if !w.Echo {
+		return nil
+	}
+
+	// Channels have no deadlines, so a stalled echo is ended by closing it
+	timer := time.AfterFunc(timeout, func() { _ = conn.Close() })
+	defer timer.Stop()
+	sent := make([]byte, watchdogEchoSize)
+	_, _ = rand.Read(sent)
+	if _, err := conn.Write(sent); err != nil {
+		return fmt.Errorf("echo to %s cannot be sent: %v", address, err)
+	}
+	received := make([]byte, len(sent))
+	if _, err := io.ReadFull(conn, received); err != nil {
+		return fmt.Errorf("echo from %s not received: %v", address, err)
+	}
+	if !bytes.Equal(sent, received) {
+		return fmt.Errorf("echo from %s does not match what was sent", address)
+	}
+	return nil
+}
+
+// watchdogAddress is the address the host reaches the entrance of a reverse
+// tunnel at, its loopback when the entrance listens on every address
+func watchdogAddress(addr net.Addr) string {
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		if ip.To4() != nil {
+			host = "127.0.0.1"
+		} else {
+			host = "::1"
+		}
+	}
+	return net.JoinHostPort(host, port)
+}
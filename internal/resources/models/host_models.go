@@ -6,6 +6,7 @@ package models
 
 import (
 	"net"
+	"time"
 
 	"us.figge.auto-ssh/internal/core/config"
 )
@@ -18,6 +19,8 @@ type HostEngine interface {
 
 type HostEngineInternal interface {
 	HostEngine
+	Apply(hosts []*config.Host) map[string]bool
+	Kill()
 }
 
 type Host interface {
@@ -30,12 +33,23 @@ type Host interface {
 	KnownHosts() string
 	JumpHost() string
 	Valid() bool
+	Algorithms() *config.Algorithms
+	Timeouts() *config.Timeouts
 	Metadata() *config.Metadata
+	Connected() bool
+	References() int
+	Latency() time.Duration
+	Banner() string
+	BannerHash() string
 }
 
 type HostInternal interface {
 	Host
 	Open() bool
 	Dial(address string) (net.Conn, bool)
+	Listen(address string) (net.Listener, error)
 	Referenced()
+	LimitLifetime(lifetime time.Duration)
+	Probe() (time.Duration, bool)
+	Recycle() bool
 }
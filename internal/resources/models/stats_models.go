@@ -6,17 +6,38 @@ package models
 
 import (
 	"context"
+	"net"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/histogram"
 )
 
 type StatsEngine interface {
 	StartStatsTunnel(ctx context.Context, port int) error
 	NewEntry() Stats
+	Listener() net.Listener
 }
 
 type Stats interface {
 	Connected() int
-	Disconnected()
+	Disconnected(reason string)
 	Received(i int64)
 	Transmitted(i int64)
+	Latency(d time.Duration)
 	Updated()
+	// Closed observes a forwarded connection once it closes
+	Closed(d time.Duration, bytesIn int64, bytesOut int64)
+	// Dialed observes the time taken to connect to the forward address
+	Dialed(d time.Duration)
+	Distributions() Distributions
+}
+
+// Distributions are histograms of a tunnel's forwarded connections: how long
+// they lasted and the bytes they carried each way, and how long the forward
+// address took to connect to.  Times are in seconds
+type Distributions struct {
+	Duration histogram.Snapshot
+	BytesIn  histogram.Snapshot
+	BytesOut histogram.Snapshot
+	Dial     histogram.Snapshot
 }
@@ -6,7 +6,9 @@ package models
 
 import (
 	"context"
+	"net"
 	"sync"
+	"time"
 
 	"us.figge.auto-ssh/internal/core/config"
 )
@@ -15,17 +17,48 @@ type TunnelEngine interface {
 	Tunnels() []Tunnel
 	Tunnel(string) (Tunnel, bool)
 	StartTunnels(ctx context.Context, stats StatsEngine, wg *sync.WaitGroup)
+	CheckRequired() error
+	Ready() bool
+	Apply(he HostEngineInternal, tunnels []*config.Tunnel, replacedHosts map[string]bool)
+	Entrances() map[string]net.Listener
+	Drain()
+	Kill()
 }
 
 type Tunnel interface {
 	Id() string
 	Name() string
 	Local() *config.Address
+	BoundAddress() string
 	Remote() *config.Address
 	Host() string
+	Reverse() bool
 	Valid() bool
+	Enabled() bool
+	AutoStarts() bool
+	Scheduled() bool
+	InSchedule(now time.Time) bool
 	Running() string
 	Metadata() *config.Metadata
+	StartedAt() time.Time
+	Connections() int
+	ActiveConnections() []Connection
+	CloseConnection(id int64) bool
+	Latency() time.Duration
+	Distributions() Distributions
+	Probe() (time.Duration, error)
+	Ready() (bool, string)
 	Start()
 	Stop()
 }
+
+// Connection is a client connection a tunnel is forwarding
+type Connection struct {
+	Id       int64
+	Client   string
+	Target   string
+	Protocol string
+	Started  time.Time
+	BytesIn  int64
+	BytesOut int64
+}
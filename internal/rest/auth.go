@@ -0,0 +1,162 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package rest
+
+import (
+	"crypto/subtle"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"us.figge.auto-ssh/internal/core/apitoken"
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/log"
+	"us.figge.auto-ssh/internal/rest/endpoints"
+)
+
+const (
+	minTokenLength = 16
+	bearerPrefix   = "Bearer "
+)
+
+// unauthenticated paths remain open to the health checks of orchestrators
+// that cannot present a token
+var unauthenticated = []string{"/healthz", "/readyz"}
+
+func (s *Server) validateTokens(v *config.Validations) {
+	seen := make(map[string]bool)
+	for i, token := range s.webCfg.Tokens {
+		name := token.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		switch {
+		case token.Token == "":
+			v.Errorf("web.tokens(%s) requires a token", name)
+		case len(token.Token) < minTokenLength:
+			v.Errorf("web.tokens(%s) must be at least %d characters", name, minTokenLength)
+		case seen[token.Token]:
+			v.Errorf("web.tokens(%s) repeats the token of another", name)
+		}
+		seen[token.Token] = true
+		switch token.Access {
+		case "":
+			token.Access = config.TokenAccessRead
+		case config.TokenAccessRead, config.TokenAccessAdmin:
+		default:
+			v.Errorf("web.tokens(%s) access must be %s or %s", name, config.TokenAccessRead, config.TokenAccessAdmin)
+		}
+	}
+	if len(s.webCfg.Tokens) == 0 && s.webCfg.TokenFile == "" && s.webCfg.ClientCA == "" && !s.webCfg.ReadOnly {
+		v.Warnf("web.tokens not set.  Anyone reaching the auto-ssh API can change its tunnels")
+	}
+}
+
+func (s *Server) validateClientCA(v *config.Validations) {
+	if s.webCfg.ClientCA == "" {
+		return
+	}
+	if s.webCfg.CertificateFile == "" {
+		v.Errorf("web.clientCA requires web.certificateFile, client certificates only being verified over https")
+		return
+	}
+	pem, err := os.ReadFile(s.webCfg.ClientCA)
+	if err != nil {
+		v.Errorf("web.clientCA cannot be read: %v", err)
+		return
+	}
+	if !x509.NewCertPool().AppendCertsFromPEM(pem) {
+		v.Errorf("web.clientCA holds no pem certificates")
+	}
+}
+
+// clientCAs returns the pool client certificates are verified against
+func (s *Server) clientCAs() (*x509.CertPool, error) {
+	pem, err := os.ReadFile(s.webCfg.ClientCA)
+	if err != nil {
+		return nil, fmt.Errorf("web.clientCA cannot be read: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(pem)
+	return pool, nil
+}
+
+// authorize requires a verified client certificate of each request when a
+// client CA is configured, and a known bearer token when tokens are configured
+// or issued.  Changes are refused to read tokens, and to everyone when the api
+// is read only
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if slices.Contains(unauthenticated, req.URL.Path) {
+			next.ServeHTTP(resp, req)
+			return
+		}
+		if s.webCfg.ClientCA != "" && (req.TLS == nil || len(req.TLS.VerifiedChains) == 0) {
+			http.Error(resp, "a client certificate is required", http.StatusUnauthorized)
+			return
+		}
+		changes := changesState(req)
+		if s.tokensRequired() {
+			token := s.token(req)
+			if token == nil {
+				resp.Header().Set("WWW-Authenticate", `Bearer realm="auto-ssh"`)
+				http.Error(resp, "a valid api token is required", http.StatusUnauthorized)
+				return
+			}
+			if changes && !token.Admin() {
+				log.Printf("  Warn  - api token (%s) refused %s %s: read access only\n", token.Name, req.Method, req.URL.Path)
+				http.Error(resp, "api token has read access only", http.StatusForbidden)
+				return
+			}
+		}
+		if changes && s.webCfg.ReadOnly {
+			http.Error(resp, "api is read only", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(resp, req)
+	})
+}
+
+// tokensRequired tells whether requests must present a token, as they must once
+// any are configured or issued
+func (s *Server) tokensRequired() bool {
+	return len(s.webCfg.Tokens) > 0 || apitoken.Count() > 0
+}
+
+// token returns the configured or issued token the request presents, if any
+func (s *Server) token(req *http.Request) *config.Token {
+	return s.bearer(req.Header.Get("Authorization"))
+}
+
+// bearer returns the configured or issued token of an authorization header
+func (s *Server) bearer(header string) *config.Token {
+	if !strings.HasPrefix(header, bearerPrefix) {
+		return nil
+	}
+	presented := strings.TrimSpace(header[len(bearerPrefix):])
+	for _, token := range s.webCfg.Tokens {
+		if subtle.ConstantTimeCompare([]byte(presented), []byte(token.Token)) == 1 {
+			return token
+		}
+	}
+	if issued, ok := apitoken.Lookup(presented); ok {
+		return &config.Token{Name: issued.Name, Access: issued.Access}
+	}
+	return nil
+}
+
+// changesState tells whether a request may change anything.  Routes marked as
+// queries only take a POST for queries too long for a url
+func changesState(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return !endpoints.IsQuery(mux.CurrentRoute(req))
+}
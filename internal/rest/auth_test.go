@@ -0,0 +1,121 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package rest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"us.figge.auto-ssh/internal/core/apitoken"
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/rest/endpoints"
+)
+
+const (
+	readToken  = "read-token-0123456789"
+	adminToken = "admin-token-0123456789"
+)
+
+func testRoutes(t *testing.T, web *config.Web) *mux.Router {
+	require.NoError(t, apitoken.Open(""))
+	t.Cleanup(func() { _ = apitoken.Open("") })
+	s := &Server{webCfg: web}
+	ok := func(resp http.ResponseWriter, req *http.Request) {}
+	routes := mux.NewRouter()
+	routes.Use(s.authorize)
+	routes.Methods(http.MethodGet).Path("/healthz").HandlerFunc(ok)
+	routes.Methods(http.MethodGet).Path("/readyz").HandlerFunc(ok)
+	endpoints.Query(routes.Methods(http.MethodGet, http.MethodPost).Path("/tunnels")).HandlerFunc(ok)
+	routes.Methods(http.MethodGet, http.MethodPost).Path("/unmarked").HandlerFunc(ok)
+	routes.Methods(http.MethodPut).Path("/tunnels/{id}").HandlerFunc(ok)
+	return routes
+}
+
+func testTokens() []*config.Token {
+	return []*config.Token{
+		{Name: "reader", Token: readToken, Access: config.TokenAccessRead},
+		{Name: "admin", Token: adminToken, Access: config.TokenAccessAdmin},
+	}
+}
+
+func serve(routes *mux.Router, method, path, token string, state *tls.ConnectionState) int {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", bearerPrefix+token)
+	}
+	req.TLS = state
+	resp := httptest.NewRecorder()
+	routes.ServeHTTP(resp, req)
+	return resp.Code
+}
+
+func TestAuthorizeTokens(t *testing.T) {
+	routes := testRoutes(t, &config.Web{Tokens: testTokens()})
+	tests := map[string]struct {
+		method   string
+		path     string
+		token    string
+		expected int
+	}{
+		"none":          {method: http.MethodGet, path: "/tunnels", expected: http.StatusUnauthorized},
+		"unknown":       {method: http.MethodGet, path: "/tunnels", token: "unknown-token-0123456789", expected: http.StatusUnauthorized},
+		"read":          {method: http.MethodGet, path: "/tunnels", token: readToken, expected: http.StatusOK},
+		"read-query":    {method: http.MethodPost, path: "/tunnels", token: readToken, expected: http.StatusOK},
+		"read-change":   {method: http.MethodPut, path: "/tunnels/01", token: readToken, expected: http.StatusForbidden},
+		"read-unmarked": {method: http.MethodPost, path: "/unmarked", token: readToken, expected: http.StatusForbidden},
+		"admin-change":  {method: http.MethodPut, path: "/tunnels/01", token: adminToken, expected: http.StatusOK},
+		"healthz":       {method: http.MethodGet, path: "/healthz", expected: http.StatusOK},
+		"readyz":        {method: http.MethodGet, path: "/readyz", expected: http.StatusOK},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			assert.Equal(tt, test.expected, serve(routes, test.method, test.path, test.token, nil))
+		})
+	}
+}
+
+func TestAuthorizeReadOnly(t *testing.T) {
+	routes := testRoutes(t, &config.Web{Tokens: testTokens(), ReadOnly: true})
+	assert.Equal(t, http.StatusOK, serve(routes, http.MethodGet, "/tunnels", adminToken, nil))
+	assert.Equal(t, http.StatusOK, serve(routes, http.MethodPost, "/tunnels", adminToken, nil))
+	assert.Equal(t, http.StatusForbidden, serve(routes, http.MethodPut, "/tunnels/01", adminToken, nil))
+
+	routes = testRoutes(t, &config.Web{ReadOnly: true})
+	assert.Equal(t, http.StatusOK, serve(routes, http.MethodGet, "/tunnels", "", nil))
+	assert.Equal(t, http.StatusForbidden, serve(routes, http.MethodPut, "/tunnels/01", "", nil))
+}
+
+func TestAuthorizeClientCA(t *testing.T) {
+	routes := testRoutes(t, &config.Web{ClientCA: "ca.pem"})
+	verified := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{}}}}
+	assert.Equal(t, http.StatusUnauthorized, serve(routes, http.MethodGet, "/tunnels", "", nil))
+	assert.Equal(t, http.StatusUnauthorized, serve(routes, http.MethodGet, "/tunnels", "", &tls.ConnectionState{}))
+	assert.Equal(t, http.StatusOK, serve(routes, http.MethodGet, "/tunnels", "", verified))
+	assert.Equal(t, http.StatusOK, serve(routes, http.MethodGet, "/healthz", "", nil))
+	assert.Equal(t, http.StatusOK, serve(routes, http.MethodGet, "/readyz", "", nil))
+}
+
+func TestAuthorizeIssuedTokens(t *testing.T) {
+	routes := testRoutes(t, &config.Web{})
+	assert.Equal(t, http.StatusOK, serve(routes, http.MethodPut, "/tunnels/01", "", nil))
+
+	read, _, err := apitoken.Issue("reader", config.TokenAccessRead)
+	require.NoError(t, err)
+	admin, _, err := apitoken.Issue("admin", config.TokenAccessAdmin)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, serve(routes, http.MethodGet, "/tunnels", "", nil))
+	assert.Equal(t, http.StatusOK, serve(routes, http.MethodGet, "/tunnels", read, nil))
+	assert.Equal(t, http.StatusForbidden, serve(routes, http.MethodPut, "/tunnels/01", read, nil))
+	assert.Equal(t, http.StatusOK, serve(routes, http.MethodPut, "/tunnels/01", admin, nil))
+
+	require.NoError(t, apitoken.Revoke("admin"))
+	assert.Equal(t, http.StatusUnauthorized, serve(routes, http.MethodPut, "/tunnels/01", admin, nil))
+}
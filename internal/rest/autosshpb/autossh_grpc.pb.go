@@ -0,0 +1,301 @@
+//
+// Copyright (C) 2024 by Jason Figge
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: autossh.proto
+
+package autosshpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	AutoSSH_GetStatus_FullMethodName    = "/autossh.v1.AutoSSH/GetStatus"
+	AutoSSH_StartTunnel_FullMethodName  = "/autossh.v1.AutoSSH/StartTunnel"
+	AutoSSH_StopTunnel_FullMethodName   = "/autossh.v1.AutoSSH/StopTunnel"
+	AutoSSH_WatchTunnels_FullMethodName = "/autossh.v1.AutoSSH/WatchTunnels"
+	AutoSSH_WatchHosts_FullMethodName   = "/autossh.v1.AutoSSH/WatchHosts"
+)
+
+// AutoSSHClient is the client API for AutoSSH service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// AutoSSH controls a running auto-ssh.  Calls are authorized as the REST api's
+// are: a bearer token in the authorization metadata when tokens are in use and
+// a client certificate when web.clientCA is set
+type AutoSSHClient interface {
+	// GetStatus returns the state of every tunnel and host
+	GetStatus(ctx context.Context, in *GetStatusRequest, opts ...grpc.CallOption) (*GetStatusResponse, error)
+	// StartTunnel starts a tunnel, by id
+	StartTunnel(ctx context.Context, in *TunnelRequest, opts ...grpc.CallOption) (*TunnelResponse, error)
+	// StopTunnel stops a tunnel, by id
+	StopTunnel(ctx context.Context, in *TunnelRequest, opts ...grpc.CallOption) (*TunnelResponse, error)
+	// WatchTunnels streams the changes in state of the tunnels
+	WatchTunnels(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TunnelEvent], error)
+	// WatchHosts streams the connections and disconnections of the hosts
+	WatchHosts(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[HostEvent], error)
+}
+
+type autoSSHClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAutoSSHClient(cc grpc.ClientConnInterface) AutoSSHClient {
+	return &autoSSHClient{cc}
+}
+
+func (c *autoSSHClient) GetStatus(ctx context.Context, in *GetStatusRequest, opts ...grpc.CallOption) (*GetStatusResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetStatusResponse)
+	err := c.cc.Invoke(ctx, AutoSSH_GetStatus_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *autoSSHClient) StartTunnel(ctx context.Context, in *TunnelRequest, opts ...grpc.CallOption) (*TunnelResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(TunnelResponse)
+	err := c.cc.Invoke(ctx, AutoSSH_StartTunnel_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *autoSSHClient) StopTunnel(ctx context.Context, in *TunnelRequest, opts ...grpc.CallOption) (*TunnelResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(TunnelResponse)
+	err := c.cc.Invoke(ctx, AutoSSH_StopTunnel_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *autoSSHClient) WatchTunnels(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TunnelEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &AutoSSH_ServiceDesc.Streams[0], AutoSSH_WatchTunnels_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchRequest, TunnelEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AutoSSH_WatchTunnelsClient = grpc.ServerStreamingClient[TunnelEvent]
+
+func (c *autoSSHClient) WatchHosts(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[HostEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &AutoSSH_ServiceDesc.Streams[1], AutoSSH_WatchHosts_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchRequest, HostEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AutoSSH_WatchHostsClient = grpc.ServerStreamingClient[HostEvent]
+
+// AutoSSHServer is the server API for AutoSSH service.
+// All implementations must embed UnimplementedAutoSSHServer
+// for forward compatibility.
+//
+// AutoSSH controls a running auto-ssh.  Calls are authorized as the REST api's
+// are: a bearer token in the authorization metadata when tokens are in use and
+// a client certificate when web.clientCA is set
+type AutoSSHServer interface {
+	// GetStatus returns the state of every tunnel and host
+	GetStatus(context.Context, *GetStatusRequest) (*GetStatusResponse, error)
+	// StartTunnel starts a tunnel, by id
+	StartTunnel(context.Context, *TunnelRequest) (*TunnelResponse, error)
+	// StopTunnel stops a tunnel, by id
+	StopTunnel(context.Context, *TunnelRequest) (*TunnelResponse, error)
+	// WatchTunnels streams the changes in state of the tunnels
+	WatchTunnels(*WatchRequest, grpc.ServerStreamingServer[TunnelEvent]) error
+	// WatchHosts streams the connections and disconnections of the hosts
+	WatchHosts(*WatchRequest, grpc.ServerStreamingServer[HostEvent]) error
+	mustEmbedUnimplementedAutoSSHServer()
+}
+
+// UnimplementedAutoSSHServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedAutoSSHServer struct{}
+
+func (UnimplementedAutoSSHServer) GetStatus(context.Context, *GetStatusRequest) (*GetStatusResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetStatus not implemented")
+}
+func (UnimplementedAutoSSHServer) StartTunnel(context.Context, *TunnelRequest) (*TunnelResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method StartTunnel not implemented")
+}
+func (UnimplementedAutoSSHServer) StopTunnel(context.Context, *TunnelRequest) (*TunnelResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method StopTunnel not implemented")
+}
+func (UnimplementedAutoSSHServer) WatchTunnels(*WatchRequest, grpc.ServerStreamingServer[TunnelEvent]) error {
+	return status.Error(codes.Unimplemented, "method WatchTunnels not implemented")
+}
+func (UnimplementedAutoSSHServer) WatchHosts(*WatchRequest, grpc.ServerStreamingServer[HostEvent]) error {
+	return status.Error(codes.Unimplemented, "method WatchHosts not implemented")
+}
+func (UnimplementedAutoSSHServer) mustEmbedUnimplementedAutoSSHServer() {}
+func (UnimplementedAutoSSHServer) testEmbeddedByValue()                 {}
+
+// UnsafeAutoSSHServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AutoSSHServer will
+// result in compilation errors.
+type UnsafeAutoSSHServer interface {
+	mustEmbedUnimplementedAutoSSHServer()
+}
+
+func RegisterAutoSSHServer(s grpc.ServiceRegistrar, srv AutoSSHServer) {
+	// If the following call panics, it indicates UnimplementedAutoSSHServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&AutoSSH_ServiceDesc, srv)
+}
+
+func _AutoSSH_GetStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AutoSSHServer).GetStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AutoSSH_GetStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AutoSSHServer).GetStatus(ctx, req.(*GetStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AutoSSH_StartTunnel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TunnelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AutoSSHServer).StartTunnel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AutoSSH_StartTunnel_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AutoSSHServer).StartTunnel(ctx, req.(*TunnelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AutoSSH_StopTunnel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TunnelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AutoSSHServer).StopTunnel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AutoSSH_StopTunnel_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AutoSSHServer).StopTunnel(ctx, req.(*TunnelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AutoSSH_WatchTunnels_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AutoSSHServer).WatchTunnels(m, &grpc.GenericServerStream[WatchRequest, TunnelEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AutoSSH_WatchTunnelsServer = grpc.ServerStreamingServer[TunnelEvent]
+
+func _AutoSSH_WatchHosts_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AutoSSHServer).WatchHosts(m, &grpc.GenericServerStream[WatchRequest, HostEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AutoSSH_WatchHostsServer = grpc.ServerStreamingServer[HostEvent]
+
+// AutoSSH_ServiceDesc is the grpc.ServiceDesc for AutoSSH service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var AutoSSH_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "autossh.v1.AutoSSH",
+	HandlerType: (*AutoSSHServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetStatus",
+			Handler:    _AutoSSH_GetStatus_Handler,
+		},
+		{
+			MethodName: "StartTunnel",
+			Handler:    _AutoSSH_StartTunnel_Handler,
+		},
+		{
+			MethodName: "StopTunnel",
+			Handler:    _AutoSSH_StopTunnel_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchTunnels",
+			Handler:       _AutoSSH_WatchTunnels_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WatchHosts",
+			Handler:       _AutoSSH_WatchHosts_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "autossh.proto",
+}
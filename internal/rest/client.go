@@ -0,0 +1,112 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package rest
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/config"
+)
+
+// tokenEnv names the environment variable holding the api token when --token
+// is not given
+const tokenEnv = "AUTO_SSH_TOKEN"
+
+// ErrUnreachable reports no auto-ssh answering at the api address
+var ErrUnreachable = errors.New("unable to reach auto-ssh")
+
+// Client issues requests against the control api of a running auto-ssh instance
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	token      string
+}
+
+func NewClient(web *config.Web) (*Client, error) {
+	webCfg := cliArgs.Merge(web)
+	if webCfg.Port == 0 {
+		return nil, fmt.Errorf("auto-ssh API server is disabled. Set web.port or --port")
+	}
+	address := webCfg.Address
+	if ip := net.ParseIP(address); address == "" || (ip != nil && ip.IsUnspecified()) {
+		address = "127.0.0.1"
+	}
+
+	c := &Client{
+		baseURL:    fmt.Sprintf("http://%s", net.JoinHostPort(address, fmt.Sprintf("%d", webCfg.Port))),
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		token:      clientToken,
+	}
+	if c.token == "" {
+		c.token = os.Getenv(tokenEnv)
+	}
+	if webCfg.CertificateFile != "" {
+		pem, err := os.ReadFile(webCfg.CertificateFile)
+		if err != nil {
+			return nil, fmt.Errorf("web.certificate_file cannot be read: %v", err)
+		}
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(pem)
+		c.baseURL = "https" + strings.TrimPrefix(c.baseURL, "http")
+		tlsConfig := &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+		if webCfg.ClientCertificate != "" {
+			cert, err := tls.LoadX509KeyPair(webCfg.ClientCertificate, webCfg.ClientKey)
+			if err != nil {
+				return nil, fmt.Errorf("client certificate cannot be loaded: %v", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+		c.httpClient.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+	}
+	return c, nil
+}
+
+// Do sends the input, if any, as json and decodes the response into output
+func (c *Client) Do(ctx context.Context, method string, path string, input any, output any) error {
+	var body io.Reader
+	if input != nil {
+		bs, err := json.Marshal(input)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(bs)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	if input != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w at %s: %v", ErrUnreachable, c.baseURL, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s %s failed: %s %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if output == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(output)
+}
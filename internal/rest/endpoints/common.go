@@ -12,12 +12,17 @@ import (
 	"fmt"
 	"net/http"
 	"reflect"
+	"strings"
 
+	"github.com/gorilla/mux"
+	"us.figge.auto-ssh/internal/core/apitoken"
 	managers2 "us.figge.auto-ssh/internal/managers"
 )
 
 const (
 	id = "id"
+	// queryPrefix starts the names of routes marked as queries
+	queryPrefix = "query "
 )
 
 var (
@@ -25,6 +30,18 @@ var (
 	ErrEncodeOutput = fmt.Errorf("failed to encode output")
 )
 
+// Query marks a route as taking a POST only for a query too long for a url, so
+// that the POST is not taken as a change
+func Query(route *mux.Route) *mux.Route {
+	template, _ := route.GetPathTemplate()
+	return route.Name(queryPrefix + template)
+}
+
+// IsQuery tells whether a route was marked by Query
+func IsQuery(route *mux.Route) bool {
+	return route != nil && strings.HasPrefix(route.GetName(), queryPrefix)
+}
+
 func handleErrorResponse(resp http.ResponseWriter, err error) {
 	httpStatus := http.StatusInternalServerError
 	switch {
@@ -32,12 +49,26 @@ func handleErrorResponse(resp http.ResponseWriter, err error) {
 		httpStatus = http.StatusNotFound
 	case errors.Is(errors.Unwrap(err), managers2.ErrTunnelNotFound):
 		httpStatus = http.StatusNotFound
+	case errors.Is(errors.Unwrap(err), managers2.ErrConnectionNotFound):
+		httpStatus = http.StatusNotFound
+	case errors.Is(errors.Unwrap(err), apitoken.ErrTokenNotFound):
+		httpStatus = http.StatusNotFound
+	case errors.Is(errors.Unwrap(err), apitoken.ErrTokenExists):
+		httpStatus = http.StatusConflict
+	case errors.Is(errors.Unwrap(err), managers2.ErrInvalidToken):
+		httpStatus = http.StatusBadRequest
+	case errors.Is(errors.Unwrap(err), managers2.ErrInvalidEventKind):
+		httpStatus = http.StatusBadRequest
 	}
 	resp.WriteHeader(httpStatus)
 	resp.Write([]byte(err.Error()))
 }
 
 func handleOutputResponse(resp http.ResponseWriter, output any) {
+	handleOutputStatusResponse(resp, http.StatusOK, output)
+}
+
+func handleOutputStatusResponse(resp http.ResponseWriter, httpStatus int, output any) {
 	if output == nil || reflect.ValueOf(output).IsNil() {
 		resp.WriteHeader(http.StatusNoContent)
 	} else {
@@ -54,7 +85,7 @@ func handleOutputResponse(resp http.ResponseWriter, output any) {
 
 		resp.Header().Set("Content-Type", "application/json")
 		resp.Header().Set("Content-Length", fmt.Sprintf("%d", len(b.Bytes())))
-		resp.WriteHeader(http.StatusOK)
+		resp.WriteHeader(httpStatus)
 		resp.Write(b.Bytes())
 	}
 }
@@ -0,0 +1,85 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package endpoints
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	managerModels "us.figge.auto-ssh/internal/rest/models"
+)
+
+// keepAliveInterval is how often an idle event stream is sent a comment, so
+// proxies between it and the client do not close it
+const keepAliveInterval = 15 * time.Second
+
+type EventsRest struct {
+	ctx     context.Context
+	manager managerModels.Events
+}
+
+func NewEventsRest(ctx context.Context, manager managerModels.Events, router *mux.Router) {
+	apis := &EventsRest{
+		ctx:     ctx,
+		manager: manager,
+	}
+	router.Methods(http.MethodGet).Path("/events").HandlerFunc(apis.WatchEvents)
+}
+
+// WatchEvents streams tunnel, host and connection events as server-sent
+// events, limited by kind and id query parameters.  Each event is named for
+// its kind and carries the event as json
+func (a *EventsRest) WatchEvents(resp http.ResponseWriter, req *http.Request) {
+	flusher, ok := resp.(http.Flusher)
+	if !ok {
+		http.Error(resp, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+	stop := context.AfterFunc(a.ctx, cancel)
+	defer stop()
+
+	query := req.URL.Query()
+	input := &managerModels.WatchEventsInput{Kinds: query["kind"], Ids: query["id"]}
+	output, err := a.manager.WatchEvents(ctx, input)
+	if err != nil {
+		handleErrorResponse(resp, err)
+		return
+	}
+
+	resp.Header().Set("Content-Type", "text/event-stream")
+	resp.Header().Set("Cache-Control", "no-cache")
+	resp.Header().Set("Connection", "keep-alive")
+	resp.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case e, ok := <-output.Events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			if _, err = fmt.Fprintf(resp, "event: %s\ndata: %s\n\n", e.Kind, data); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(resp, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
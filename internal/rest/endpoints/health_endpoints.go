@@ -0,0 +1,49 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package endpoints
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	managerModels "us.figge.auto-ssh/internal/rest/models"
+)
+
+type HealthRest struct {
+	manager managerModels.Health
+}
+
+// NewHealthRest serves the liveness and readiness of auto-ssh to container
+// orchestrators, answering 503 Service Unavailable when a check fails
+func NewHealthRest(ctx context.Context, manager managerModels.Health, router *mux.Router) {
+	apis := &HealthRest{
+		manager: manager,
+	}
+	router.Methods(http.MethodGet).Path("/healthz").HandlerFunc(apis.GetHealth)
+	router.Methods(http.MethodGet).Path("/readyz").HandlerFunc(apis.GetReadiness)
+}
+
+func (a *HealthRest) GetHealth(resp http.ResponseWriter, req *http.Request) {
+	output, err := a.manager.GetHealth(req.Context())
+	handleHealthResponse(resp, output, err)
+}
+
+func (a *HealthRest) GetReadiness(resp http.ResponseWriter, req *http.Request) {
+	output, err := a.manager.GetReadiness(req.Context())
+	handleHealthResponse(resp, output, err)
+}
+
+func handleHealthResponse(resp http.ResponseWriter, output *managerModels.GetHealthOutput, err error) {
+	if err != nil {
+		handleErrorResponse(resp, err)
+		return
+	}
+	httpStatus := http.StatusOK
+	if !output.Ok {
+		httpStatus = http.StatusServiceUnavailable
+	}
+	handleOutputStatusResponse(resp, httpStatus, output)
+}
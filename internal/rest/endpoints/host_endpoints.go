@@ -23,7 +23,7 @@ func NewHostRest(ctx context.Context, manager managerModels.Host, router *mux.Ro
 	apis := &HostRest{
 		manager: manager,
 	}
-	router.Methods(http.MethodGet, http.MethodPost).Path("/hosts").HandlerFunc(apis.ListHosts)
+	Query(router.Methods(http.MethodGet, http.MethodPost).Path("/hosts")).HandlerFunc(apis.ListHosts)
 	router.Methods(http.MethodPost).Path("/hosts").HandlerFunc(apis.AddHost)
 	router.Methods(http.MethodGet).Path("/hosts/known-hosts").HandlerFunc(apis.ListKnownHosts)
 	router.Methods(http.MethodGet).Path("/hosts/{id}").HandlerFunc(apis.GetHost)
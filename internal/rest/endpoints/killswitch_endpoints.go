@@ -0,0 +1,47 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package endpoints
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	managerModels "us.figge.auto-ssh/internal/rest/models"
+)
+
+type KillSwitchRest struct {
+	manager managerModels.KillSwitch
+}
+
+func NewKillSwitchRest(ctx context.Context, manager managerModels.KillSwitch, router *mux.Router) {
+	apis := &KillSwitchRest{
+		manager: manager,
+	}
+	router.Methods(http.MethodPost).Path("/panic").HandlerFunc(apis.PullKillSwitch)
+}
+
+// PullKillSwitch cuts all access at once, closing every tunnel and connection
+// before auto-ssh exits
+func (a *KillSwitchRest) PullKillSwitch(resp http.ResponseWriter, req *http.Request) {
+	input := &managerModels.PullKillSwitchInput{}
+	if req.Body != http.NoBody {
+		if err := json.NewDecoder(req.Body).Decode(input); err != nil {
+			resp.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	if input.Reason == "" {
+		input.Reason = fmt.Sprintf("requested by %s", req.RemoteAddr)
+	}
+	output, err := a.manager.PullKillSwitch(req.Context(), input)
+	if err != nil {
+		handleErrorResponse(resp, err)
+		return
+	}
+	handleOutputResponse(resp, output)
+}
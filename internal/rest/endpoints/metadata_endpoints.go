@@ -21,8 +21,8 @@ func NewMetadataRest(ctx context.Context, manager managerModels.Metadata, router
 	apis := &MetadataRest{
 		manager: manager,
 	}
-	router.Methods(http.MethodGet, http.MethodPost).Path("/metadata/states").HandlerFunc(apis.States)
-	router.Methods(http.MethodGet, http.MethodPost).Path("/metadata/tags").HandlerFunc(apis.Tags)
+	Query(router.Methods(http.MethodGet, http.MethodPost).Path("/metadata/states")).HandlerFunc(apis.States)
+	Query(router.Methods(http.MethodGet, http.MethodPost).Path("/metadata/tags")).HandlerFunc(apis.Tags)
 }
 
 func (m MetadataRest) States(resp http.ResponseWriter, req *http.Request) {
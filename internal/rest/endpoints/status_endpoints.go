@@ -0,0 +1,137 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package endpoints
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"us.figge.auto-ssh/internal/core/openmetrics"
+	managerModels "us.figge.auto-ssh/internal/rest/models"
+)
+
+type StatusRest struct {
+	manager managerModels.Status
+}
+
+func NewStatusRest(ctx context.Context, manager managerModels.Status, router *mux.Router) {
+	apis := &StatusRest{
+		manager: manager,
+	}
+	router.Methods(http.MethodGet).Path("/status").HandlerFunc(apis.GetStatus)
+	router.Methods(http.MethodDelete).Path("/stats").HandlerFunc(apis.ResetStats)
+	router.Methods(http.MethodGet).Path("/metrics").HandlerFunc(apis.GetMetrics)
+}
+
+func (a *StatusRest) GetStatus(resp http.ResponseWriter, req *http.Request) {
+	output, err := a.manager.GetStatus(req.Context(), extractStatusOptions(req)...)
+	if err != nil {
+		handleErrorResponse(resp, err)
+		return
+	}
+	handleOutputResponse(resp, output)
+}
+
+// ResetStats zeroes the traffic totals of the tunnels named by tunnel query
+// parameters, or of every tunnel
+func (a *StatusRest) ResetStats(resp http.ResponseWriter, req *http.Request) {
+	input := &managerModels.ResetStatsInput{Tunnels: req.URL.Query()["tunnel"]}
+	output, err := a.manager.ResetStats(req.Context(), input)
+	if err != nil {
+		handleErrorResponse(resp, err)
+		return
+	}
+	handleOutputResponse(resp, output)
+}
+
+// GetMetrics serves the tunnels' metrics for Prometheus to scrape, as
+// OpenMetrics when asked for it
+func (a *StatusRest) GetMetrics(resp http.ResponseWriter, req *http.Request) {
+	output, err := a.manager.GetMetrics(req.Context())
+	if err != nil {
+		handleErrorResponse(resp, err)
+		return
+	}
+	open := openmetrics.Accepts(req.Header.Get("Accept"))
+	b := &bytes.Buffer{}
+	writeMetrics(openmetrics.NewWriter(b, open), output)
+	if open {
+		resp.Header().Set("Content-Type", openmetrics.ContentType)
+	} else {
+		resp.Header().Set("Content-Type", openmetrics.TextContentType)
+	}
+	resp.Header().Set("Content-Length", fmt.Sprintf("%d", b.Len()))
+	resp.WriteHeader(http.StatusOK)
+	_, _ = resp.Write(b.Bytes())
+}
+
+func writeMetrics(w *openmetrics.Writer, output *managerModels.GetMetricsOutput) {
+	labels := func(t *managerModels.TunnelMetrics) []openmetrics.Label {
+		return []openmetrics.Label{{Name: "tunnel", Value: t.Name}, {Name: "tunnel_id", Value: t.Id}}
+	}
+	families := []struct {
+		name  string
+		kind  openmetrics.Kind
+		unit  string
+		help  string
+		write func(t *managerModels.TunnelMetrics)
+	}{
+		{"auto_ssh_tunnel_up", openmetrics.Gauge, "", "Whether the tunnel is started", func(t *managerModels.TunnelMetrics) {
+			up := 0.0
+			if t.Up {
+				up = 1
+			}
+			w.Sample(up, labels(t)...)
+		}},
+		{"auto_ssh_tunnel_open_connections", openmetrics.Gauge, "", "Connections the tunnel is forwarding", func(t *managerModels.TunnelMetrics) {
+			w.Sample(float64(t.Connections), labels(t)...)
+		}},
+		{"auto_ssh_tunnel_connections", openmetrics.Counter, "", "Connections the tunnel has forwarded and closed", func(t *managerModels.TunnelMetrics) {
+			w.Sample(float64(t.TrafficClosed), labels(t)...)
+		}},
+		{"auto_ssh_tunnel_in_bytes", openmetrics.Counter, "bytes", "Bytes the tunnel's closed connections carried in", func(t *managerModels.TunnelMetrics) {
+			w.Sample(float64(t.TrafficIn), labels(t)...)
+		}},
+		{"auto_ssh_tunnel_out_bytes", openmetrics.Counter, "bytes", "Bytes the tunnel's closed connections carried out", func(t *managerModels.TunnelMetrics) {
+			w.Sample(float64(t.TrafficOut), labels(t)...)
+		}},
+		{"auto_ssh_tunnel_connection_duration_seconds", openmetrics.Histogram, "seconds", "How long the tunnel's connections lasted", func(t *managerModels.TunnelMetrics) {
+			w.Histogram(t.ConnectionSeconds, labels(t)...)
+		}},
+		{"auto_ssh_tunnel_connection_in_bytes", openmetrics.Histogram, "bytes", "Bytes each of the tunnel's connections carried in", func(t *managerModels.TunnelMetrics) {
+			w.Histogram(t.ConnectionIn, labels(t)...)
+		}},
+		{"auto_ssh_tunnel_connection_out_bytes", openmetrics.Histogram, "bytes", "Bytes each of the tunnel's connections carried out", func(t *managerModels.TunnelMetrics) {
+			w.Histogram(t.ConnectionOut, labels(t)...)
+		}},
+		{"auto_ssh_tunnel_dial_duration_seconds", openmetrics.Histogram, "seconds", "How long the tunnel's forward address took to connect to", func(t *managerModels.TunnelMetrics) {
+			w.Histogram(t.DialSeconds, labels(t)...)
+		}},
+	}
+	for _, f := range families {
+		w.Family(f.name, f.kind, f.unit, f.help)
+		for _, t := range output.Tunnels {
+			f.write(t)
+		}
+	}
+	_ = w.Close()
+}
+
+func extractStatusOptions(req *http.Request) []managerModels.StatusOptionFunc {
+	var opts []managerModels.StatusOptionFunc
+	for key, values := range req.URL.Query() {
+		switch key {
+		case "connections":
+			if b, err := strconv.ParseBool(values[0]); err == nil {
+				opts = append(opts, managerModels.StatusOptionConnections(b))
+			}
+		}
+	}
+	return opts
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package endpoints
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	managerModels "us.figge.auto-ssh/internal/rest/models"
+)
+
+type TokenRest struct {
+	manager managerModels.APIToken
+}
+
+func NewTokenRest(ctx context.Context, manager managerModels.APIToken, router *mux.Router) {
+	apis := &TokenRest{
+		manager: manager,
+	}
+	router.Methods(http.MethodGet).Path("/tokens").HandlerFunc(apis.ListTokens)
+	router.Methods(http.MethodPost).Path("/tokens").HandlerFunc(apis.CreateToken)
+	router.Methods(http.MethodDelete).Path("/tokens/{name}").HandlerFunc(apis.RevokeToken)
+}
+
+func (a *TokenRest) ListTokens(resp http.ResponseWriter, req *http.Request) {
+	output, err := a.manager.ListTokens(req.Context())
+	if err != nil {
+		handleErrorResponse(resp, err)
+		return
+	}
+	handleOutputResponse(resp, output)
+}
+
+func (a *TokenRest) CreateToken(resp http.ResponseWriter, req *http.Request) {
+	input := &managerModels.CreateTokenInput{}
+	if err := json.NewDecoder(req.Body).Decode(input); err != nil {
+		resp.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	output, err := a.manager.CreateToken(req.Context(), input)
+	if err != nil {
+		handleErrorResponse(resp, err)
+		return
+	}
+	handleOutputStatusResponse(resp, http.StatusCreated, output)
+}
+
+func (a *TokenRest) RevokeToken(resp http.ResponseWriter, req *http.Request) {
+	input := &managerModels.RevokeTokenInput{Name: mux.Vars(req)["name"]}
+	output, err := a.manager.RevokeToken(req.Context(), input)
+	if err != nil {
+		handleErrorResponse(resp, err)
+		return
+	}
+	handleOutputResponse(resp, output)
+}
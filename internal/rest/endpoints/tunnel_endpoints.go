@@ -23,13 +23,15 @@ func NewTunnelRest(ctx context.Context, manager managerModels.Tunnel, router *mu
 	apis := &TunnelRest{
 		manager: manager,
 	}
-	router.Methods(http.MethodGet, http.MethodPost).Path("/tunnels").HandlerFunc(apis.ListTunnels)
+	Query(router.Methods(http.MethodGet, http.MethodPost).Path("/tunnels")).HandlerFunc(apis.ListTunnels)
 	router.Methods(http.MethodPost).Path("/tunnels").HandlerFunc(apis.AddTunnel)
 	router.Methods(http.MethodGet).Path("/tunnels/{id}").HandlerFunc(apis.GetTunnel)
 	router.Methods(http.MethodPut).Path("/tunnels/{id}").HandlerFunc(apis.UpdateTunnel)
 	router.Methods(http.MethodDelete).Path("/tunnels/{id}").HandlerFunc(apis.RemoveTunnel)
 	router.Methods(http.MethodPatch).Path("/tunnels/{id}/start").HandlerFunc(apis.StartTunnel)
 	router.Methods(http.MethodPatch).Path("/tunnels/{id}/stop").HandlerFunc(apis.StopTunnel)
+	router.Methods(http.MethodDelete).Path("/tunnels/{id}/connections/{connection}").HandlerFunc(apis.CloseConnection)
+	router.Methods(http.MethodGet).Path("/tunnels/{id}/ready").HandlerFunc(apis.TunnelReady)
 }
 
 func (a *TunnelRest) ListTunnels(resp http.ResponseWriter, req *http.Request) {
@@ -112,6 +114,36 @@ func (a *TunnelRest) StopTunnel(resp http.ResponseWriter, req *http.Request) {
 	handleOutputResponse(resp, output)
 }
 
+// CloseConnection force-closes one of the client connections a tunnel is
+// forwarding, by the id status lists it under
+func (a *TunnelRest) CloseConnection(resp http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	connection, err := strconv.ParseInt(vars["connection"], 10, 64)
+	if err != nil {
+		resp.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	input := &managerModels.CloseConnectionInput{Id: vars[id], Connection: connection}
+	output, err := a.manager.CloseConnection(req.Context(), input, extractTunnelOptions(req)...)
+	if err != nil {
+		handleErrorResponse(resp, err)
+		return
+	}
+	handleOutputResponse(resp, output)
+}
+
+// TunnelReady reports whether a tunnel can forward connections, for scripts
+// waiting on it
+func (a *TunnelRest) TunnelReady(resp http.ResponseWriter, req *http.Request) {
+	input := &managerModels.TunnelReadyInput{Id: mux.Vars(req)[id]}
+	output, err := a.manager.TunnelReady(req.Context(), input, extractTunnelOptions(req)...)
+	if err != nil {
+		handleErrorResponse(resp, err)
+		return
+	}
+	handleOutputResponse(resp, output)
+}
+
 func extractTunnelOptions(req *http.Request) []managerModels.TunnelOptionFunc {
 	var opts []managerModels.TunnelOptionFunc
 	for key, values := range req.URL.Query() {
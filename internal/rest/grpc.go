@@ -0,0 +1,311 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package rest
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"us.figge.auto-ssh/internal/core/activation"
+	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/events"
+	"us.figge.auto-ssh/internal/core/log"
+	managers2 "us.figge.auto-ssh/internal/managers"
+	"us.figge.auto-ssh/internal/rest/autosshpb"
+	managerModels "us.figge.auto-ssh/internal/rest/models"
+)
+
+// changingMethods are the rpcs refused to read tokens and in read only mode
+var changingMethods = []string{
+	autosshpb.AutoSSH_StartTunnel_FullMethodName,
+	autosshpb.AutoSSH_StopTunnel_FullMethodName,
+}
+
+type grpcService struct {
+	autosshpb.UnimplementedAutoSSHServer
+	statusManager managerModels.Status
+	tunnelManager managerModels.Tunnel
+	eventsManager managerModels.Events
+}
+
+func (s *Server) validateGrpcPort(v *config.Validations) {
+	if s.webCfg.GrpcPort == 0 {
+		return
+	}
+	if s.webCfg.GrpcPort < 0 {
+		v.Errorf("web.grpcPort cannot be negative")
+	} else if s.webCfg.GrpcPort == s.webCfg.Port {
+		v.Errorf("web.grpcPort cannot be the same as web.port")
+	} else if address := fmt.Sprintf("%s:%d", s.webCfg.Address, s.webCfg.GrpcPort); activation.Activated(address, activatedGrpcName) {
+		return
+	} else if !waitForPort(address) {
+		v.Errorf("web.grpcPort is already in use [%s]", address)
+	}
+}
+
+// serveGrpc starts the gRPC control interface on the grpc port, over tls when
+// the web server uses https
+func (s *Server) serveGrpc(
+	statusManager managerModels.Status, tunnelManager managerModels.Tunnel, eventsManager managerModels.Events,
+) error {
+	listenAddress := fmt.Sprintf("%s:%d", s.webCfg.Address, s.webCfg.GrpcPort)
+	opts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(s.authorizeUnary),
+		grpc.StreamInterceptor(s.authorizeStream),
+	}
+	if s.webCfg.CertificateFile != "" {
+		cert, err := tls.LoadX509KeyPair(s.webCfg.CertificateFile, s.webCfg.CertificateKey)
+		if err != nil {
+			return fmt.Errorf("grpc server cannot load certificate: %w", err)
+		}
+		tlsConfig := &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+		if s.webCfg.ClientCA != "" {
+			pool, err := s.clientCAs()
+			if err != nil {
+				return err
+			}
+			tlsConfig.ClientCAs = pool
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	ln, activated := activation.Listener(listenAddress, activatedGrpcName)
+	if !activated {
+		var err error
+		if ln, err = net.Listen("tcp", listenAddress); err != nil {
+			return err
+		}
+	}
+	s.listeners[activatedGrpcName] = ln
+	s.grpcServer = grpc.NewServer(opts...)
+	autosshpb.RegisterAutoSSHServer(s.grpcServer, &grpcService{
+		statusManager: statusManager,
+		tunnelManager: tunnelManager,
+		eventsManager: eventsManager,
+	})
+	go func(server *grpc.Server) {
+		log.Printf("  Info  - Listening on grpc -> %s\n", listenAddress)
+		if err := server.Serve(ln); err != nil {
+			log.Printf("  Info  - grpc server has shut down: %v\n", err)
+		}
+	}(s.grpcServer)
+	return nil
+}
+
+func (s *Server) authorizeUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := s.authorizeCall(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) authorizeStream(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := s.authorizeCall(stream.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
+
+// authorizeCall applies the rules of authorize to a gRPC call, the token being
+// read from the call's authorization metadata
+func (s *Server) authorizeCall(ctx context.Context, method string) error {
+	if s.webCfg.ClientCA != "" {
+		p, ok := peer.FromContext(ctx)
+		if !ok {
+			return status.Error(codes.Unauthenticated, "a client certificate is required")
+		}
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); !ok || len(tlsInfo.State.VerifiedChains) == 0 {
+			return status.Error(codes.Unauthenticated, "a client certificate is required")
+		}
+	}
+	changes := slices.Contains(changingMethods, method)
+	if s.tokensRequired() {
+		var token *config.Token
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get("authorization"); len(values) > 0 {
+				token = s.bearer(values[0])
+			}
+		}
+		if token == nil {
+			return status.Error(codes.Unauthenticated, "a valid api token is required")
+		}
+		if changes && !token.Admin() {
+			log.Printf("  Warn  - api token (%s) refused %s: read access only\n", token.Name, method)
+			return status.Error(codes.PermissionDenied, "api token has read access only")
+		}
+	}
+	if changes && s.webCfg.ReadOnly {
+		return status.Error(codes.PermissionDenied, "api is read only")
+	}
+	return nil
+}
+
+func (g *grpcService) GetStatus(ctx context.Context, _ *autosshpb.GetStatusRequest) (*autosshpb.GetStatusResponse, error) {
+	output, err := g.statusManager.GetStatus(ctx)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	resp := &autosshpb.GetStatusResponse{StartedAt: timestamppb.New(output.StartedAt)}
+	for _, tunnel := range output.Tunnels {
+		ts := &autosshpb.TunnelStatus{
+			Id:          tunnel.Id,
+			Name:        tunnel.Name,
+			Local:       tunnel.Local,
+			Remote:      tunnel.Remote,
+			Host:        tunnel.Host,
+			Valid:       tunnel.Valid,
+			Enabled:     tunnel.Enabled,
+			Running:     tunnel.Running,
+			Connections: int32(tunnel.Connections),
+		}
+		if tunnel.StartedAt != nil {
+			ts.StartedAt = timestamppb.New(*tunnel.StartedAt)
+		}
+		resp.Tunnels = append(resp.Tunnels, ts)
+	}
+	for _, host := range output.Hosts {
+		resp.Hosts = append(resp.Hosts, &autosshpb.HostStatus{
+			Id:         host.Id,
+			Name:       host.Name,
+			Remote:     host.Remote,
+			JumpHost:   host.JumpHost,
+			Valid:      host.Valid,
+			Connected:  host.Connected,
+			References: int32(host.References),
+		})
+	}
+	return resp, nil
+}
+
+func (g *grpcService) StartTunnel(ctx context.Context, req *autosshpb.TunnelRequest) (*autosshpb.TunnelResponse, error) {
+	output, err := g.tunnelManager.StartTunnel(ctx, &managerModels.StartTunnelInput{Id: req.GetId()})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &autosshpb.TunnelResponse{Id: output.Id, Running: output.Status.Running}, nil
+}
+
+func (g *grpcService) StopTunnel(ctx context.Context, req *autosshpb.TunnelRequest) (*autosshpb.TunnelResponse, error) {
+	output, err := g.tunnelManager.StopTunnel(ctx, &managerModels.StopTunnelInput{Id: req.GetId()})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &autosshpb.TunnelResponse{Id: output.Id, Running: output.Status.Running}, nil
+}
+
+func (g *grpcService) WatchTunnels(req *autosshpb.WatchRequest, stream grpc.ServerStreamingServer[autosshpb.TunnelEvent]) error {
+	return g.watch(stream.Context(), events.KindTunnel, req, func(e events.Event) error {
+		return stream.Send(&autosshpb.TunnelEvent{
+			Time:    timestamppb.New(e.Time),
+			Id:      e.Id,
+			Name:    e.Name,
+			Running: e.State,
+		})
+	})
+}
+
+func (g *grpcService) WatchHosts(req *autosshpb.WatchRequest, stream grpc.ServerStreamingServer[autosshpb.HostEvent]) error {
+	return g.watch(stream.Context(), events.KindHost, req, func(e events.Event) error {
+		return stream.Send(&autosshpb.HostEvent{
+			Time:   timestamppb.New(e.Time),
+			Id:     e.Id,
+			Name:   e.Name,
+			State:  e.State,
+			Detail: e.Detail,
+		})
+	})
+}
+
+// watch sends the events of a kind matching the request until the caller goes
+// away, starting with the current state of each tunnel or host when asked
+func (g *grpcService) watch(ctx context.Context, kind string, req *autosshpb.WatchRequest, send func(events.Event) error) error {
+	input := &managerModels.WatchEventsInput{Kinds: []string{kind}, Ids: req.GetIds()}
+	output, err := g.eventsManager.WatchEvents(ctx, input)
+	if err != nil {
+		return grpcError(err)
+	}
+	if req.GetInitial() {
+		initial, err := g.initial(ctx, kind)
+		if err != nil {
+			return grpcError(err)
+		}
+		for _, e := range initial {
+			if len(input.Ids) > 0 && !slices.Contains(input.Ids, e.Id) && !slices.Contains(input.Ids, e.Name) {
+				continue
+			}
+			if err = send(e); err != nil {
+				return err
+			}
+		}
+	}
+	for e := range output.Events {
+		if err = send(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// initial returns an event for the current state of each tunnel or host
+func (g *grpcService) initial(ctx context.Context, kind string) ([]events.Event, error) {
+	output, err := g.statusManager.GetStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var initial []events.Event
+	switch kind {
+	case events.KindTunnel:
+		for _, tunnel := range output.Tunnels {
+			initial = append(initial, events.Event{Kind: kind, Id: tunnel.Id, Name: tunnel.Name, State: tunnel.Running})
+		}
+	case events.KindHost:
+		for _, host := range output.Hosts {
+			state := "Disconnected"
+			if host.Connected {
+				state = "Connected"
+			}
+			initial = append(initial, events.Event{Kind: kind, Id: host.Id, Name: host.Name, State: state})
+		}
+	}
+	now := time.Now()
+	for i := range initial {
+		initial[i].Time = now
+	}
+	return initial, nil
+}
+
+// grpcError maps the errors of the managers to gRPC status codes, as
+// handleErrorResponse does to http statuses
+func grpcError(err error) error {
+	code := codes.Internal
+	switch {
+	case errors.Is(errors.Unwrap(err), managers2.ErrTunnelNotFound):
+		code = codes.NotFound
+	case errors.Is(errors.Unwrap(err), managers2.ErrInvalidEventKind):
+		code = codes.InvalidArgument
+	case errors.Is(errors.Unwrap(err), managers2.ErrTunnelRunning):
+		code = codes.AlreadyExists
+	case errors.Is(errors.Unwrap(err), managers2.ErrInvalidTunnel),
+		errors.Is(errors.Unwrap(err), managers2.ErrTunnelDisabled),
+		errors.Is(errors.Unwrap(err), managers2.ErrOutOfSchedule):
+		code = codes.FailedPrecondition
+	}
+	return status.Error(code, err.Error())
+}
@@ -0,0 +1,31 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package models
+
+import (
+	"context"
+
+	"us.figge.auto-ssh/internal/core/events"
+)
+
+type Events interface {
+	WatchEvents(
+		ctx context.Context,
+		input *WatchEventsInput,
+	) (*WatchEventsOutput, error)
+}
+
+// WatchEventsInput limits the events watched to those of the kinds, and of
+// the tunnels or hosts with these ids or names.  Empty for all
+type WatchEventsInput struct {
+	Kinds []string `json:"kinds,omitempty"`
+	Ids   []string `json:"ids,omitempty"`
+}
+
+// WatchEventsOutput delivers the events until the watch's context is done,
+// when Events is closed
+type WatchEventsOutput struct {
+	Events <-chan events.Event
+}
@@ -0,0 +1,26 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package models
+
+import (
+	"context"
+)
+
+type Health interface {
+	GetHealth(ctx context.Context) (*GetHealthOutput, error)
+	GetReadiness(ctx context.Context) (*GetHealthOutput, error)
+}
+
+type HealthCheck struct {
+	Id     string `json:"id"`
+	Name   string `json:"name"`
+	Ok     bool   `json:"ok"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type GetHealthOutput struct {
+	Ok     bool           `json:"ok"`
+	Checks []*HealthCheck `json:"checks"`
+}
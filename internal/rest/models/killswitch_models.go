@@ -0,0 +1,25 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package models
+
+import (
+	"context"
+)
+
+type KillSwitch interface {
+	PullKillSwitch(
+		ctx context.Context,
+		input *PullKillSwitchInput,
+	) (*PullKillSwitchOutput, error)
+}
+
+type PullKillSwitchInput struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+type PullKillSwitchOutput struct {
+	Pulled bool   `json:"pulled"`
+	Reason string `json:"reason"`
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package models
+
+import (
+	"context"
+	"time"
+
+	"us.figge.auto-ssh/internal/core/histogram"
+)
+
+type Status interface {
+	GetStatus(
+		ctx context.Context,
+		options ...StatusOptionFunc,
+	) (*GetStatusOutput, error)
+	ResetStats(
+		ctx context.Context,
+		input *ResetStatsInput,
+	) (*ResetStatsOutput, error)
+	GetMetrics(
+		ctx context.Context,
+	) (*GetMetricsOutput, error)
+}
+
+type TunnelStatus struct {
+	Id          string     `json:"id"`
+	Name        string     `json:"name"`
+	Local       string     `json:"local"`
+	Port        int        `json:"port"`
+	Bound       string     `json:"bound,omitempty"`
+	Remote      string     `json:"remote"`
+	Host        string     `json:"host,omitempty"`
+	Reverse     bool       `json:"reverse,omitempty"`
+	Valid       bool       `json:"valid"`
+	Enabled     bool       `json:"enabled"`
+	Running     string     `json:"running"`
+	Connections int        `json:"connections"`
+	StartedAt   *time.Time `json:"startedAt,omitempty"`
+	Uptime      string     `json:"uptime,omitempty"`
+	Latency     string     `json:"latency,omitempty"`
+	Traffic     *Traffic   `json:"traffic,omitempty"`
+
+	ActiveConnections []*ConnectionStatus `json:"activeConnections,omitempty"`
+}
+
+// ConnectionStatus is a client connection a tunnel is forwarding, the bytes
+// it has carried so far included
+type ConnectionStatus struct {
+	Id        int64     `json:"id"`
+	Client    string    `json:"client"`
+	Target    string    `json:"target"`
+	Protocol  string    `json:"protocol,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+	Duration  string    `json:"duration"`
+	BytesIn   int64     `json:"bytesIn"`
+	BytesOut  int64     `json:"bytesOut"`
+}
+
+// Traffic is a tunnel's lifetime totals over its closed connections
+type Traffic struct {
+	BytesIn     int64     `json:"bytesIn"`
+	BytesOut    int64     `json:"bytesOut"`
+	Connections int64     `json:"connections"`
+	Since       time.Time `json:"since"`
+}
+
+type HostStatus struct {
+	Id         string `json:"id"`
+	Name       string `json:"name"`
+	Remote     string `json:"remote"`
+	JumpHost   string `json:"jumpHost,omitempty"`
+	Valid      bool   `json:"valid"`
+	Connected  bool   `json:"connected"`
+	References int    `json:"references"`
+	Latency    string `json:"latency,omitempty"`
+	Banner     string `json:"banner,omitempty"`
+	BannerHash string `json:"bannerHash,omitempty"`
+}
+
+type GetStatusOutput struct {
+	StartedAt time.Time       `json:"startedAt"`
+	Uptime    string          `json:"uptime"`
+	Tunnels   []*TunnelStatus `json:"tunnels"`
+	Hosts     []*HostStatus   `json:"hosts"`
+}
+
+type StatusOptionFunc func(options *StatusOptions)
+type StatusOptions struct {
+	connections bool
+}
+
+func (s *StatusOptions) Connections() bool {
+	return s.connections
+}
+
+func StatusOptionConnections(connections bool) StatusOptionFunc {
+	return func(options *StatusOptions) {
+		options.connections = connections
+	}
+}
+
+// ResetStatsInput names the tunnels whose traffic totals are reset, every
+// tunnel's when empty
+type ResetStatsInput struct {
+	Tunnels []string `json:"tunnels,omitempty"`
+}
+
+type ResetStatsOutput struct {
+	Tunnels []string `json:"tunnels"`
+}
+
+// TunnelMetrics are a tunnel's gauges and the histograms of its forwarded
+// connections, durations in seconds
+type TunnelMetrics struct {
+	Id                string
+	Name              string
+	Up                bool
+	Connections       int
+	TrafficIn         int64
+	TrafficOut        int64
+	TrafficClosed     int64
+	ConnectionSeconds histogram.Snapshot
+	ConnectionIn      histogram.Snapshot
+	ConnectionOut     histogram.Snapshot
+	DialSeconds       histogram.Snapshot
+}
+
+type GetMetricsOutput struct {
+	Tunnels []*TunnelMetrics
+}
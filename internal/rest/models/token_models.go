@@ -0,0 +1,54 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package models
+
+import (
+	"context"
+	"time"
+)
+
+type APIToken interface {
+	ListTokens(
+		ctx context.Context,
+	) (*ListTokensOutput, error)
+	CreateToken(
+		ctx context.Context,
+		input *CreateTokenInput,
+	) (*CreateTokenOutput, error)
+	RevokeToken(
+		ctx context.Context,
+		input *RevokeTokenInput,
+	) (*RevokeTokenOutput, error)
+}
+
+type TokenHeader struct {
+	Name    string    `json:"name"`
+	Access  string    `json:"access"`
+	Created time.Time `json:"created"`
+}
+
+type ListTokensOutput struct {
+	Items []*TokenHeader `json:"items"`
+}
+
+type CreateTokenInput struct {
+	Name   string `json:"name"`
+	Access string `json:"access,omitempty"`
+}
+
+// CreateTokenOutput carries the only copy of the token, auto-ssh keeping just
+// a hash of it
+type CreateTokenOutput struct {
+	TokenHeader
+	Token string `json:"token"`
+}
+
+type RevokeTokenInput struct {
+	Name string `json:"name"`
+}
+
+type RevokeTokenOutput struct {
+	Name string `json:"name"`
+}
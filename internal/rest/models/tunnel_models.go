@@ -47,6 +47,16 @@ type Tunnel interface {
 		input *StopTunnelInput,
 		options ...TunnelOptionFunc,
 	) (*StopTunnelOutput, error)
+	CloseConnection(
+		ctx context.Context,
+		input *CloseConnectionInput,
+		options ...TunnelOptionFunc,
+	) (*CloseConnectionOutput, error)
+	TunnelReady(
+		ctx context.Context,
+		input *TunnelReadyInput,
+		options ...TunnelOptionFunc,
+	) (*TunnelReadyOutput, error)
 }
 
 type TunnelHeader struct {
@@ -103,6 +113,25 @@ type StopTunnelOutput struct {
 	Status *config.Status `yaml:"status,omitempty" json:"status,omitempty"`
 }
 
+type CloseConnectionInput struct {
+	Id         string `json:"id"`
+	Connection int64  `json:"connection"`
+}
+type CloseConnectionOutput struct {
+	Id         string `json:"id"`
+	Connection int64  `json:"connection"`
+}
+
+type TunnelReadyInput struct {
+	Id string `json:"id"`
+}
+type TunnelReadyOutput struct {
+	Id     string `json:"id"`
+	Name   string `json:"name"`
+	Ready  bool   `json:"ready"`
+	Reason string `json:"reason,omitempty"`
+}
+
 type TunnelOptionFunc func(options *TunnelOptions)
 type TunnelOptions struct {
 	status   bool
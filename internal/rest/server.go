@@ -6,43 +6,70 @@ package rest
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"us.figge.auto-ssh/internal/core/activation"
+	"us.figge.auto-ssh/internal/core/apitoken"
 	"us.figge.auto-ssh/internal/core/config"
+	"us.figge.auto-ssh/internal/core/log"
+	"us.figge.auto-ssh/internal/core/takeover"
+	"us.figge.auto-ssh/internal/core/utils/backoff"
 	managers2 "us.figge.auto-ssh/internal/managers"
 	engineModels "us.figge.auto-ssh/internal/resources/models"
 	"us.figge.auto-ssh/internal/rest/endpoints"
 	managerModels "us.figge.auto-ssh/internal/rest/models"
 )
 
+const (
+	portWaitTimeout = 30 * time.Second
+	// activatedName is the systemd FileDescriptorName of a socket passed in for the web server
+	activatedName = "web"
+	// activatedGrpcName is that of a socket passed in for the gRPC control interface
+	activatedGrpcName = "grpc"
+)
+
 var (
-	cliArgs = &config.Web{}
+	cliArgs     = &config.Web{}
+	clientToken string
 )
 
 type Server struct {
 	wg            *sync.WaitGroup
 	webCfg        *config.Web
+	healthCfg     *config.Health
 	httpServer    *http.Server
+	grpcServer    *grpc.Server
+	listeners     map[string]net.Listener
 	hostManager   managerModels.Host
 	tunnelManager managerModels.Tunnel
+	// streams is done once the server shuts down, ending the event streams
+	// that would otherwise hold the shutdown up
+	streams     context.Context
+	stopStreams context.CancelFunc
 }
 
 func NewServer(
 	ctx context.Context,
 	web *config.Web,
+	health *config.Health,
 	hosts engineModels.HostEngine,
 	tunnels engineModels.TunnelEngine,
 	wg *sync.WaitGroup,
 ) (*Server, error) {
 	s := &Server{
-		webCfg: cliArgs.Merge(web),
-		wg:     wg,
+		webCfg:    cliArgs.Merge(web),
+		healthCfg: health,
+		wg:        wg,
+		listeners: make(map[string]net.Listener),
 	}
 	v := s.Validate()
 	err := v.Output(fmt.Errorf("failed to validate server configuration"))
@@ -50,12 +77,21 @@ func NewServer(
 		return nil, err
 	}
 
-	hostMgr, tunnelMgr, metadataMgr := s.startManagers(ctx, hosts, tunnels)
-	routers := s.startHandlers(ctx, hostMgr, tunnelMgr, metadataMgr)
+	if err = apitoken.Open(s.webCfg.TokenFile); err != nil {
+		return nil, err
+	}
+	hostMgr, tunnelMgr, metadataMgr, statusMgr, healthMgr, killSwitchMgr, tokenMgr, eventsMgr := s.startManagers(ctx, hosts, tunnels)
+	s.streams, s.stopStreams = context.WithCancel(ctx)
+	routers := s.startHandlers(ctx, hostMgr, tunnelMgr, metadataMgr, statusMgr, healthMgr, killSwitchMgr, tokenMgr, eventsMgr)
 	err = s.Serve(ctx, routers)
 	if err != nil {
 		return nil, err
 	}
+	if s.webCfg.GrpcPort != 0 {
+		if err = s.serveGrpc(statusMgr, tunnelMgr, eventsMgr); err != nil {
+			return nil, err
+		}
+	}
 	return s, nil
 }
 
@@ -65,6 +101,15 @@ func Flags(cmd *cobra.Command) {
 	cmd.Flags().StringVar(&cliArgs.CertificateFile, "certificate-file", "", "Certificate required to place aut-ssh in https mode")
 	cmd.Flags().StringVar(&cliArgs.CertificateKey, "certificate-key", "", "Certificate private key required to place aut-ssh in https mode")
 	cmd.Flags().StringVar(&cliArgs.KeyPassphrase, "passphrase", "", "passphrase used to decrypt certificate key.  See -w to prompt")
+	cmd.Flags().StringVar(&clientToken, "token", "", "api token presented to auto-ssh.  Defaults to $"+tokenEnv)
+	cmd.Flags().StringVar(&cliArgs.ClientCertificate, "client-certificate", "", "client certificate presented to an auto-ssh API requiring one")
+	cmd.Flags().StringVar(&cliArgs.ClientKey, "client-key", "", "private key of the client certificate")
+}
+
+// ServerFlags adds the flags only the API server uses
+func ServerFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&cliArgs.ReadOnly, "read-only", false, "refuses every API request that would change auto-ssh")
+	cmd.Flags().Int16Var(&cliArgs.GrpcPort, "grpc-port", 0, "port for the auto-ssh gRPC control interface. Zero port disables it")
 }
 
 // routes map[string]http.Handler
@@ -75,6 +120,9 @@ func (s *Server) Validate() config.Validations {
 		s.validatePort(&v)
 		s.validateCertFile(&v)
 		s.validateCertKey(&v)
+		s.validateTokens(&v)
+		s.validateClientCA(&v)
+		s.validateGrpcPort(&v)
 	} else {
 		v.Infof("web server disabled. web.port=0")
 	}
@@ -119,11 +167,39 @@ func (s *Server) validatePort(v *config.Validations) {
 		v.Errorf("web.port cannot be negative")
 	} else {
 		address := fmt.Sprintf("%s:%d", s.webCfg.Address, s.webCfg.Port)
-		ln, err := net.Listen("tcp", address)
-		if err != nil {
+		if activation.Activated(address, activatedName) {
+			return
+		}
+		if !waitForPort(address) {
 			v.Errorf("web.port is already in use [%s]", address)
-		} else if ln != nil {
+		}
+	}
+}
+
+// waitForPort checks the address can be listened on, taking it over from a previous
+// instance when requested, and otherwise retrying with backoff for a while before giving up
+func waitForPort(address string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), portWaitTimeout)
+	defer cancel()
+	b := backoff.NewBackoff(time.Second, 8*time.Second)
+	tookOver := false
+	for {
+		ln, err := net.Listen("tcp", address)
+		if err == nil {
 			_ = ln.Close()
+			return true
+		}
+		if config.TakeoverFlag && !tookOver {
+			tookOver = true
+			takeoverErr := takeover.Port(address)
+			if takeoverErr == nil {
+				continue
+			}
+			log.Printf("  Warn  - web server cannot take over port [%s]: %v\n", address, takeoverErr)
+		}
+		log.Printf("  Warn  - web server port [%s] unavailable: %v. Retrying\n", address, err)
+		if !b.Wait(ctx) {
+			return false
 		}
 	}
 }
@@ -162,17 +238,27 @@ func (s *Server) validateCertKey(v *config.Validations) {
 
 func (s *Server) startManagers(
 	ctx context.Context, hosts engineModels.HostEngine, tunnels engineModels.TunnelEngine,
-) (managerModels.Host, managerModels.Tunnel, managerModels.Metadata) {
-	hostManager, tunnelManager, metadataManager, err := s.startManagersE(ctx, hosts, tunnels)
+) (managerModels.Host, managerModels.Tunnel, managerModels.Metadata, managerModels.Status, managerModels.Health, managerModels.KillSwitch, managerModels.APIToken, managerModels.Events) {
+	hostManager, tunnelManager, metadataManager, statusManager, healthManager, killSwitchManager, tokenManager, eventsManager, err := s.startManagersE(ctx, hosts, tunnels)
 	if err != nil {
 		fmt.Printf("failed to start managers: %v\n", err)
 		os.Exit(1)
 	}
-	return hostManager, tunnelManager, metadataManager
+	return hostManager, tunnelManager, metadataManager, statusManager, healthManager, killSwitchManager, tokenManager, eventsManager
 }
 func (s *Server) startManagersE(
 	ctx context.Context, hosts engineModels.HostEngine, tunnels engineModels.TunnelEngine,
-) (hostManager managerModels.Host, tunnelManager managerModels.Tunnel, metadataManager managerModels.Metadata, err error) {
+) (
+	hostManager managerModels.Host,
+	tunnelManager managerModels.Tunnel,
+	metadataManager managerModels.Metadata,
+	statusManager managerModels.Status,
+	healthManager managerModels.Health,
+	killSwitchManager managerModels.KillSwitch,
+	tokenManager managerModels.APIToken,
+	eventsManager managerModels.Events,
+	err error,
+) {
 	hostManager, err = managers2.NewHostManager(ctx, hosts)
 	if err != nil {
 		return
@@ -185,6 +271,26 @@ func (s *Server) startManagersE(
 	if err != nil {
 		return
 	}
+	statusManager, err = managers2.NewStatusManager(ctx, hosts, tunnels)
+	if err != nil {
+		return
+	}
+	healthManager, err = managers2.NewHealthManager(ctx, s.healthCfg, hosts, tunnels)
+	if err != nil {
+		return
+	}
+	killSwitchManager, err = managers2.NewKillSwitchManager(ctx)
+	if err != nil {
+		return
+	}
+	tokenManager, err = managers2.NewTokenManager(ctx)
+	if err != nil {
+		return
+	}
+	eventsManager, err = managers2.NewEventsManager(ctx)
+	if err != nil {
+		return
+	}
 	return
 }
 
@@ -193,11 +299,22 @@ func (s *Server) startHandlers(
 	hostManager managerModels.Host,
 	tunnelManager managerModels.Tunnel,
 	metadataManager managerModels.Metadata,
+	statusManager managerModels.Status,
+	healthManager managerModels.Health,
+	killSwitchManager managerModels.KillSwitch,
+	tokenManager managerModels.APIToken,
+	eventsManager managerModels.Events,
 ) *mux.Router {
 	routes := mux.NewRouter()
+	routes.Use(s.authorize)
 	endpoints.NewHostRest(ctx, hostManager, routes)
 	endpoints.NewTunnelRest(ctx, tunnelManager, routes)
 	endpoints.NewMetadataRest(ctx, metadataManager, routes)
+	endpoints.NewStatusRest(ctx, statusManager, routes)
+	endpoints.NewHealthRest(ctx, healthManager, routes)
+	endpoints.NewKillSwitchRest(ctx, killSwitchManager, routes)
+	endpoints.NewTokenRest(ctx, tokenManager, routes)
+	endpoints.NewEventsRest(s.streams, eventsManager, routes)
 	return routes
 }
 
@@ -208,11 +325,28 @@ func (s *Server) Serve(ctx context.Context, routes *mux.Router) error {
 	s.httpServer = &http.Server{
 		Handler: routes,
 	}
-	ln, err := net.Listen("tcp", listenAddress)
-	if err != nil {
-		return err
+	ln, activated := activation.Listener(listenAddress, activatedName)
+	if !activated {
+		var err error
+		ln, err = net.Listen("tcp", listenAddress)
+		if err != nil {
+			return err
+		}
 	}
+	s.listeners[activatedName] = ln
 
+	if s.webCfg.ClientCA != "" {
+		pool, err := s.clientCAs()
+		if err != nil {
+			return err
+		}
+		// Verified in authorize, so the health checks can do without one
+		s.httpServer.TLSConfig = &tls.Config{
+			ClientCAs:  pool,
+			ClientAuth: tls.VerifyClientCertIfGiven,
+			MinVersion: tls.VersionTLS12,
+		}
+	}
 	if s.webCfg.CertificateFile != "" {
 		certFile := s.webCfg.CertificateFile
 		keyFile := s.webCfg.CertificateKey
@@ -223,26 +357,41 @@ func (s *Server) Serve(ctx context.Context, routes *mux.Router) error {
 	return nil
 }
 func (s *Server) serveHTTPS(ln net.Listener, listenAddress, certFile, keyFile string) {
-	fmt.Printf("Listening on https -> %s\n", listenAddress)
+	log.Printf("  Info  - Listening on https -> %s\n", listenAddress)
 	err := s.httpServer.ServeTLS(ln, certFile, keyFile)
 	if err != nil {
-		fmt.Printf("web server has shut down: %v\n", err)
+		log.Printf("  Info  - web server has shut down: %v\n", err)
 	}
 }
 func (s *Server) serveHTTP(ln net.Listener, listenAddress string) {
-	fmt.Printf("Listening on http -> %s\n", listenAddress)
+	log.Printf("  Info  - Listening on http -> %s\n", listenAddress)
 	err := s.httpServer.Serve(ln)
 	if err != nil {
-		fmt.Printf("web server has shut down: %v\n", err)
+		log.Printf("  Info  - web server has shut down: %v\n", err)
 	}
 }
+
+// Listeners are the server's listening sockets, named as systemd would pass
+// them in, for an upgrading instance to take over
+func (s *Server) Listeners() map[string]net.Listener {
+	return s.listeners
+}
+
 func (s *Server) Shutdown() {
+	if s.grpcServer != nil {
+		// Stopped rather than drained, the watch streams never ending
+		s.grpcServer.Stop()
+		s.grpcServer = nil
+	}
+	if s.stopStreams != nil {
+		s.stopStreams()
+	}
 	if s.httpServer != nil {
 		err := s.httpServer.Shutdown(context.Background())
 		if err != nil {
-			fmt.Printf("error shutting down web server: %v", err)
+			log.Printf("  Error - error shutting down web server: %v\n", err)
 		}
-		fmt.Printf("server is shut down\n")
+		log.Printf("  Info  - server is shut down\n")
 		s.httpServer = nil
 		s.wg.Done()
 	}
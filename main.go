@@ -6,8 +6,14 @@ package main
 
 import (
 	"us.figge.auto-ssh/internal/cmd"
+	_ "us.figge.auto-ssh/internal/cmd/banner"
 	_ "us.figge.auto-ssh/internal/cmd/core"
+	_ "us.figge.auto-ssh/internal/cmd/hostkey"
 	_ "us.figge.auto-ssh/internal/cmd/hosts"
+	_ "us.figge.auto-ssh/internal/cmd/importer"
+	_ "us.figge.auto-ssh/internal/cmd/recording"
+	_ "us.figge.auto-ssh/internal/cmd/secret"
+	_ "us.figge.auto-ssh/internal/cmd/transfer"
 	_ "us.figge.auto-ssh/internal/cmd/tunnels"
 )
 